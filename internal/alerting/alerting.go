@@ -0,0 +1,180 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package alerting sends operational alerts to external paging and chat services.
+package alerting
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+)
+
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityCritical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityCritical:
+		return "critical"
+	}
+	return "unknown"
+}
+
+// ParseSeverity parses a severity name, returning def if it is empty or unknown.
+func ParseSeverity(name string, def Severity) Severity {
+	switch strings.ToLower(name) {
+	case "info":
+		return SeverityInfo
+	case "warning":
+		return SeverityWarning
+	case "critical":
+		return SeverityCritical
+	}
+	return def
+}
+
+type Condition string
+
+const (
+	ConditionRepeaterOffline Condition = "repeater_offline"
+	ConditionTalkgroupSilent Condition = "talkgroup_silent"
+	ConditionDatabaseErrors  Condition = "database_errors"
+	ConditionPubSubDrops     Condition = "pubsub_drops"
+	ConditionReplicaDown     Condition = "replica_down"
+)
+
+// Alert is a single firing or resolved condition. Key identifies the
+// condition instance so repeated checks don't page twice.
+type Alert struct {
+	Key       string
+	Condition Condition
+	Severity  Severity
+	Summary   string
+	Resolved  bool
+}
+
+// Notifier delivers alerts to an external service.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// Channel routes alerts at or above MinSeverity to a Notifier.
+type Channel struct {
+	Notifier    Notifier
+	MinSeverity Severity
+}
+
+// Manager fans alerts out to channels, suppressing duplicates while a condition stays firing.
+type Manager struct {
+	channels []Channel
+
+	mu     sync.Mutex
+	firing map[string]Alert
+}
+
+func NewManager(channels ...Channel) *Manager {
+	return &Manager{
+		channels: channels,
+		firing:   make(map[string]Alert),
+	}
+}
+
+// NewManagerFromConfig creates a Manager with a channel for each configured integration.
+func NewManagerFromConfig() *Manager {
+	cfg := config.GetConfig()
+	var channels []Channel
+	if cfg.AlertPagerDutyRoutingKey != "" {
+		channels = append(channels, Channel{
+			Notifier:    NewPagerDuty(cfg.AlertPagerDutyRoutingKey, cfg.NetworkName),
+			MinSeverity: ParseSeverity(cfg.AlertPagerDutySeverity, SeverityCritical),
+		})
+	}
+	if cfg.AlertNtfyURL != "" {
+		channels = append(channels, Channel{
+			Notifier:    NewNtfy(cfg.AlertNtfyURL, cfg.AlertNtfyToken),
+			MinSeverity: ParseSeverity(cfg.AlertNtfySeverity, SeverityWarning),
+		})
+	}
+	if cfg.AlertTelegramBotToken != "" && cfg.AlertTelegramChatID != "" {
+		channels = append(channels, Channel{
+			Notifier:    NewTelegram(cfg.AlertTelegramBotToken, cfg.AlertTelegramChatID),
+			MinSeverity: ParseSeverity(cfg.AlertTelegramSeverity, SeverityWarning),
+		})
+	}
+	return NewManager(channels...)
+}
+
+// Enabled reports whether any integration is configured.
+func (m *Manager) Enabled() bool {
+	return len(m.channels) > 0
+}
+
+// Fire sends an alert unless the same key is already firing.
+func (m *Manager) Fire(ctx context.Context, alert Alert) {
+	m.mu.Lock()
+	if _, ok := m.firing[alert.Key]; ok {
+		m.mu.Unlock()
+		return
+	}
+	m.firing[alert.Key] = alert
+	m.mu.Unlock()
+
+	m.send(ctx, alert)
+}
+
+// Resolve clears a firing alert and tells the channels that it was sent to.
+func (m *Manager) Resolve(ctx context.Context, key string, summary string) {
+	m.mu.Lock()
+	alert, ok := m.firing[key]
+	delete(m.firing, key)
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	alert.Resolved = true
+	alert.Summary = summary
+	m.send(ctx, alert)
+}
+
+func (m *Manager) send(ctx context.Context, alert Alert) {
+	for _, channel := range m.channels {
+		if alert.Severity < channel.MinSeverity {
+			continue
+		}
+		err := channel.Notifier.Notify(ctx, alert)
+		if err != nil {
+			logging.Errorf("Error sending %s alert %s: %v", channel.Notifier.Name(), alert.Key, err)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package alerting_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/alerting"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+)
+
+type recorder struct {
+	mu     sync.Mutex
+	alerts []alerting.Alert
+}
+
+func (r *recorder) Name() string {
+	return "recorder"
+}
+
+func (r *recorder) Notify(_ context.Context, alert alerting.Alert) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alerts = append(r.alerts, alert)
+	return nil
+}
+
+func TestSeverityRouting(t *testing.T) {
+	t.Parallel()
+	pager := &recorder{}
+	chat := &recorder{}
+	manager := alerting.NewManager(
+		alerting.Channel{Notifier: pager, MinSeverity: alerting.SeverityCritical},
+		alerting.Channel{Notifier: chat, MinSeverity: alerting.SeverityWarning},
+	)
+	ctx := context.Background()
+
+	manager.Fire(ctx, alerting.Alert{Key: "tg", Condition: alerting.ConditionTalkgroupSilent, Severity: alerting.SeverityWarning, Summary: "silent"})
+	manager.Fire(ctx, alerting.Alert{Key: "rpt", Condition: alerting.ConditionRepeaterOffline, Severity: alerting.SeverityCritical, Summary: "offline"})
+	// Still firing, so shouldn't notify again
+	manager.Fire(ctx, alerting.Alert{Key: "rpt", Condition: alerting.ConditionRepeaterOffline, Severity: alerting.SeverityCritical, Summary: "offline"})
+	manager.Resolve(ctx, "rpt", "online")
+	// Never fired, so nothing to resolve
+	manager.Resolve(ctx, "db", "ok")
+
+	if len(pager.alerts) != 2 {
+		t.Fatalf("Expected the pager to get 2 alerts, got %d", len(pager.alerts))
+	}
+	if pager.alerts[0].Key != "rpt" || !pager.alerts[1].Resolved {
+		t.Errorf("Unexpected pager alerts: %+v", pager.alerts)
+	}
+	if len(chat.alerts) != 3 {
+		t.Errorf("Expected chat to get 3 alerts, got %d", len(chat.alerts))
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	t.Parallel()
+	if alerting.ParseSeverity("Warning", alerting.SeverityCritical) != alerting.SeverityWarning {
+		t.Error("Expected severity names to be case insensitive")
+	}
+	if alerting.ParseSeverity("", alerting.SeverityCritical) != alerting.SeverityCritical {
+		t.Error("Expected an empty severity to use the default")
+	}
+}
+
+func TestPagerDutyPayload(t *testing.T) {
+	t.Parallel()
+	var event map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	pd := alerting.NewPagerDuty("key", "DMRHub")
+	pd.URL = server.URL
+	err := pd.Notify(context.Background(), alerting.Alert{Key: "rpt:1", Condition: alerting.ConditionRepeaterOffline, Severity: alerting.SeverityCritical, Summary: "offline"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if event["event_action"] != "trigger" || event["dedup_key"] != "rpt:1" || event["routing_key"] != "key" {
+		t.Errorf("Unexpected event: %v", event)
+	}
+	payload, ok := event["payload"].(map[string]any)
+	if !ok || payload["severity"] != "critical" {
+		t.Errorf("Unexpected payload: %v", event["payload"])
+	}
+}
+
+func TestNtfyFailure(t *testing.T) {
+	t.Parallel()
+	var priority string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		priority = r.Header.Get("Priority")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	err := alerting.NewNtfy(server.URL, "").Notify(context.Background(), alerting.Alert{Key: "db", Severity: alerting.SeverityCritical, Summary: "errors"})
+	if err == nil {
+		t.Error("Expected an error for a non-2xx response")
+	}
+	if priority != "urgent" {
+		t.Errorf("Expected urgent priority, got %q", priority)
+	}
+}
+
+func TestTelegramErrorHidesToken(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	telegram := alerting.NewTelegram("123:secret-token", "42")
+	telegram.URL = server.URL + "/bot123:secret-token/sendMessage"
+	err := telegram.Notify(context.Background(), alerting.Alert{Key: "db", Severity: alerting.SeverityCritical, Summary: "errors"})
+	if err == nil {
+		t.Fatal("Expected an error when the server is unreachable")
+	}
+	if strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("Expected the bot token to be left out of the error, got %q", err)
+	}
+}
+
+func TestReplicaDown(t *testing.T) {
+	t.Parallel()
+	_, redis := fakeredis.New(t)
+	chat := &recorder{}
+	manager := alerting.NewManager(alerting.Channel{Notifier: chat, MinSeverity: alerting.SeverityInfo})
+	monitor := alerting.NewMonitor(manager, nil, redis, "replica-a", time.Minute)
+	ctx := context.Background()
+
+	stale := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+	ancient := strconv.FormatInt(time.Now().Add(-48*time.Hour).Unix(), 10)
+	redis.HSet(ctx, "alerting:replicas", "replica-b", stale, "replica-c", ancient)
+
+	monitor.Check(ctx)
+	if len(chat.alerts) != 1 || chat.alerts[0].Key != "replica_down:replica-b" || chat.alerts[0].Resolved {
+		t.Fatalf("Expected replica-b to be reported down, got %+v", chat.alerts)
+	}
+	heartbeats := redis.HGetAll(ctx, "alerting:replicas").Val()
+	if _, ok := heartbeats["replica-a"]; !ok {
+		t.Error("Expected the monitor to record its own heartbeat")
+	}
+	if _, ok := heartbeats["replica-c"]; ok {
+		t.Error("Expected a replica that has been down for a day to be forgotten")
+	}
+
+	redis.HSet(ctx, "alerting:replicas", "replica-b", strconv.FormatInt(time.Now().Unix(), 10))
+	monitor.Check(ctx)
+	if len(chat.alerts) != 2 || !chat.alerts[1].Resolved {
+		t.Fatalf("Expected replica-b to be resolved, got %+v", chat.alerts)
+	}
+
+	monitor.Deregister(ctx)
+	if _, ok := redis.HGetAll(ctx, "alerting:replicas").Val()["replica-a"]; ok {
+		t.Error("Expected Deregister to remove the heartbeat")
+	}
+}
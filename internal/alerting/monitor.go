@@ -0,0 +1,272 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/pubsub"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	// replicasKey is a Redis hash of replica name to the unix time it last checked in
+	replicasKey = "alerting:replicas"
+	// A replica that misses this many minutely checks is considered down
+	replicaDownAfter = 3 * time.Minute
+	// Replicas that stay down this long are assumed to be decommissioned and are forgotten
+	replicaForgetAfter = 24 * time.Hour
+)
+
+// Monitor periodically evaluates the configured alert conditions.
+type Monitor struct {
+	manager  *Manager
+	db       *gorm.DB
+	redis    *redis.Client
+	instance string
+
+	offlineAfter     time.Duration
+	coreRepeaters    []uint
+	silentTalkgroups map[uint]time.Duration
+	dbErrorLimit     int
+	dbErrors         atomic.Int64
+	pubsubDropLimit  int
+	lastPubSubDrops  uint64
+}
+
+// NewMonitor creates a Monitor for the conditions in the config. Repeaters are
+// considered offline once they haven't pinged for offlineAfter, or their own
+// ping timeout if they have a keepalive interval. The monitor checks in to Redis
+// as instance so the other replicas can alert when it stops.
+func NewMonitor(manager *Manager, db *gorm.DB, redis *redis.Client, instance string, offlineAfter time.Duration) *Monitor {
+	cfg := config.GetConfig()
+	m := &Monitor{
+		manager:          manager,
+		db:               db,
+		redis:            redis,
+		instance:         instance,
+		offlineAfter:     offlineAfter,
+		silentTalkgroups: make(map[uint]time.Duration),
+		dbErrorLimit:     cfg.AlertDBErrorsPerMinute,
+		pubsubDropLimit:  cfg.AlertPubSubDropsPerMinute,
+		lastPubSubDrops:  pubsub.SubscriberDrops(),
+	}
+	for _, id := range cfg.AlertCoreRepeaters {
+		repeaterID, err := strconv.ParseUint(strings.TrimSpace(id), 10, 32)
+		if err != nil {
+			logging.Errorf("Invalid repeater ID in ALERT_CORE_REPEATERS: %s", id)
+			continue
+		}
+		m.coreRepeaters = append(m.coreRepeaters, uint(repeaterID))
+	}
+	for _, entry := range cfg.AlertSilentTalkgroups {
+		tg, hours, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		talkgroupID, err := strconv.ParseUint(tg, 10, 32)
+		if !ok || err != nil {
+			logging.Errorf("Invalid entry in ALERT_SILENT_TALKGROUPS: %s", entry)
+			continue
+		}
+		silentHours, err := strconv.ParseFloat(hours, 64)
+		if err != nil || silentHours <= 0 {
+			logging.Errorf("Invalid entry in ALERT_SILENT_TALKGROUPS: %s", entry)
+			continue
+		}
+		m.silentTalkgroups[uint(talkgroupID)] = time.Duration(silentHours * float64(time.Hour))
+	}
+	return m
+}
+
+// CountDatabaseErrors hooks db so that failed queries count towards the database error alert.
+func (m *Monitor) CountDatabaseErrors(db *gorm.DB) error {
+	count := func(tx *gorm.DB) {
+		if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			m.dbErrors.Add(1)
+		}
+	}
+	callbacks := db.Callback()
+	errs := []error{
+		callbacks.Create().After("gorm:create").Register("alerting:create_errors", count),
+		callbacks.Query().After("gorm:query").Register("alerting:query_errors", count),
+		callbacks.Update().After("gorm:update").Register("alerting:update_errors", count),
+		callbacks.Delete().After("gorm:delete").Register("alerting:delete_errors", count),
+		callbacks.Row().After("gorm:row").Register("alerting:row_errors", count),
+		callbacks.Raw().After("gorm:raw").Register("alerting:raw_errors", count),
+	}
+	return errors.Join(errs...)
+}
+
+// Check evaluates every condition once. It is meant to be run every minute.
+func (m *Monitor) Check(ctx context.Context) {
+	m.checkRepeaters(ctx)
+	m.checkTalkgroups(ctx)
+	m.checkDatabaseErrors(ctx)
+	m.checkPubSubDrops(ctx)
+	m.checkReplicas(ctx, time.Now())
+}
+
+// Deregister removes this replica from the heartbeat list so that a clean
+// shutdown doesn't page as a replica going down.
+func (m *Monitor) Deregister(ctx context.Context) {
+	err := m.redis.HDel(ctx, replicasKey, m.instance).Err()
+	if err != nil {
+		logging.Errorf("Error removing replica %s from the alert heartbeats: %v", m.instance, err)
+	}
+}
+
+// checkReplicas records this replica's heartbeat and fires for any other
+// replica that hasn't checked in recently
+func (m *Monitor) checkReplicas(ctx context.Context, now time.Time) {
+	err := m.redis.HSet(ctx, replicasKey, m.instance, now.Unix()).Err()
+	if err != nil {
+		logging.Errorf("Error recording the alert heartbeat: %v", err)
+		return
+	}
+	heartbeats, err := m.redis.HGetAll(ctx, replicasKey).Result()
+	if err != nil {
+		logging.Errorf("Error reading the alert heartbeats: %v", err)
+		return
+	}
+	for instance, value := range heartbeats {
+		if instance == m.instance {
+			continue
+		}
+		key := fmt.Sprintf("%s:%s", ConditionReplicaDown, instance)
+		seen, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			logging.Errorf("Invalid alert heartbeat for replica %s: %s", instance, value)
+			continue
+		}
+		lastSeen := time.Unix(seen, 0)
+		switch {
+		case now.Sub(lastSeen) > replicaForgetAfter:
+			err := m.redis.HDel(ctx, replicasKey, instance).Err()
+			if err != nil {
+				logging.Errorf("Error forgetting replica %s: %v", instance, err)
+			}
+			m.manager.Resolve(ctx, key, fmt.Sprintf("Replica %s has been down for a day and is no longer tracked", instance))
+		case now.Sub(lastSeen) > replicaDownAfter:
+			m.manager.Fire(ctx, Alert{
+				Key:       key,
+				Condition: ConditionReplicaDown,
+				Severity:  SeverityCritical,
+				Summary:   fmt.Sprintf("Replica %s has not checked in since %s", instance, lastSeen.Format(time.RFC3339)),
+			})
+		default:
+			m.manager.Resolve(ctx, key, fmt.Sprintf("Replica %s is back up", instance))
+		}
+	}
+}
+
+func (m *Monitor) checkRepeaters(ctx context.Context) {
+	for _, repeaterID := range m.coreRepeaters {
+		key := fmt.Sprintf("%s:%d", ConditionRepeaterOffline, repeaterID)
+		repeater, err := models.FindRepeaterByID(m.db, repeaterID)
+		if err != nil {
+			logging.Errorf("Error finding core repeater %d: %v", repeaterID, err)
+			continue
+		}
+		offlineAfter := m.offlineAfter
+		if repeater.KeepaliveInterval != 0 {
+			offlineAfter = repeater.PingTimeout()
+		}
+		if time.Since(repeater.LastPing) > offlineAfter {
+			m.manager.Fire(ctx, Alert{
+				Key:       key,
+				Condition: ConditionRepeaterOffline,
+				Severity:  SeverityCritical,
+				Summary:   fmt.Sprintf("Core repeater %d (%s) has been offline since %s", repeaterID, repeater.Callsign, repeater.LastPing.Format(time.RFC3339)),
+			})
+		} else {
+			m.manager.Resolve(ctx, key, fmt.Sprintf("Core repeater %d (%s) is back online", repeaterID, repeater.Callsign))
+		}
+	}
+}
+
+func (m *Monitor) checkTalkgroups(ctx context.Context) {
+	for talkgroupID, silentFor := range m.silentTalkgroups {
+		key := fmt.Sprintf("%s:%d", ConditionTalkgroupSilent, talkgroupID)
+		var calls []models.Call
+		err := m.db.Where("is_to_talkgroup = ? AND to_talkgroup_id = ?", true, talkgroupID).Order("start_time desc").Limit(1).Find(&calls).Error
+		if err != nil {
+			logging.Errorf("Error finding last call to talkgroup %d: %v", talkgroupID, err)
+			continue
+		}
+		if len(calls) == 0 || time.Since(calls[0].StartTime) > silentFor {
+			m.manager.Fire(ctx, Alert{
+				Key:       key,
+				Condition: ConditionTalkgroupSilent,
+				Severity:  SeverityWarning,
+				Summary:   fmt.Sprintf("Talkgroup %d has been silent for more than %s", talkgroupID, silentFor),
+			})
+		} else {
+			m.manager.Resolve(ctx, key, fmt.Sprintf("Talkgroup %d is active again", talkgroupID))
+		}
+	}
+}
+
+func (m *Monitor) checkDatabaseErrors(ctx context.Context) {
+	errorCount := m.dbErrors.Swap(0)
+	if m.dbErrorLimit <= 0 {
+		return
+	}
+	key := string(ConditionDatabaseErrors)
+	if errorCount >= int64(m.dbErrorLimit) {
+		m.manager.Fire(ctx, Alert{
+			Key:       key,
+			Condition: ConditionDatabaseErrors,
+			Severity:  SeverityCritical,
+			Summary:   fmt.Sprintf("%d database errors in the last minute", errorCount),
+		})
+	} else {
+		m.manager.Resolve(ctx, key, "Database errors are back below the alert threshold")
+	}
+}
+
+// checkPubSubDrops fires when subscriptions shed more messages than the limit in a minute,
+// which means a subscriber can't keep up with its traffic
+func (m *Monitor) checkPubSubDrops(ctx context.Context) {
+	drops := pubsub.SubscriberDrops()
+	dropped := drops - m.lastPubSubDrops
+	m.lastPubSubDrops = drops
+	if m.pubsubDropLimit <= 0 {
+		return
+	}
+	key := string(ConditionPubSubDrops)
+	if dropped >= uint64(m.pubsubDropLimit) {
+		m.manager.Fire(ctx, Alert{
+			Key:       key,
+			Condition: ConditionPubSubDrops,
+			Severity:  SeverityWarning,
+			Summary:   fmt.Sprintf("Pubsub subscribers dropped %d messages in the last minute", dropped),
+		})
+	} else {
+		m.manager.Resolve(ctx, key, "Pubsub subscribers are keeping up again")
+	}
+}
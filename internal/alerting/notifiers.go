@@ -0,0 +1,185 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+)
+
+const notifyTimeout = 10 * time.Second
+
+var ErrNotifyFailed = errors.New("alert notification failed")
+
+// withoutURL unwraps a *url.Error, since the URL can hold a secret
+// like the Telegram bot token and errors end up in the logs
+func withoutURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+func post(ctx context.Context, endpoint string, contentType string, body []byte, headers map[string]string) error {
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNotifyFailed, withoutURL(err))
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNotifyFailed, withoutURL(err))
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		if err := resp.Body.Close(); err != nil {
+			logging.Errorf("Error closing response body: %v", err)
+		}
+	}()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("%w: status %d", ErrNotifyFailed, resp.StatusCode)
+	}
+	return nil
+}
+
+// PagerDuty sends alerts to the PagerDuty Events API v2.
+type PagerDuty struct {
+	URL        string
+	RoutingKey string
+	Source     string
+}
+
+func NewPagerDuty(routingKey string, source string) *PagerDuty {
+	return &PagerDuty{
+		URL:        "https://events.pagerduty.com/v2/enqueue",
+		RoutingKey: routingKey,
+		Source:     source,
+	}
+}
+
+func (p *PagerDuty) Name() string {
+	return "pagerduty"
+}
+
+func (p *PagerDuty) Notify(ctx context.Context, alert Alert) error {
+	event := map[string]any{
+		"routing_key":  p.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    alert.Key,
+	}
+	if alert.Resolved {
+		event["event_action"] = "resolve"
+	} else {
+		event["payload"] = map[string]any{
+			"summary":  alert.Summary,
+			"source":   p.Source,
+			"severity": alert.Severity.String(),
+			"class":    string(alert.Condition),
+		}
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNotifyFailed, err)
+	}
+	return post(ctx, p.URL, "application/json", body, nil)
+}
+
+// Ntfy publishes alerts to an ntfy topic URL, such as https://ntfy.sh/my-topic.
+type Ntfy struct {
+	URL   string
+	Token string
+}
+
+func NewNtfy(url string, token string) *Ntfy {
+	return &Ntfy{
+		URL:   url,
+		Token: token,
+	}
+}
+
+func (n *Ntfy) Name() string {
+	return "ntfy"
+}
+
+func (n *Ntfy) Notify(ctx context.Context, alert Alert) error {
+	headers := map[string]string{
+		"Title": fmt.Sprintf("DMRHub %s", alert.Condition),
+		"Tags":  alert.Severity.String(),
+	}
+	switch {
+	case alert.Resolved:
+		headers["Tags"] = "white_check_mark"
+	case alert.Severity == SeverityCritical:
+		headers["Priority"] = "urgent"
+	case alert.Severity == SeverityWarning:
+		headers["Priority"] = "high"
+	}
+	if n.Token != "" {
+		headers["Authorization"] = "Bearer " + n.Token
+	}
+	return post(ctx, n.URL, "text/plain", []byte(alert.Summary), headers)
+}
+
+// Telegram sends alerts to a chat through a bot.
+type Telegram struct {
+	URL    string
+	ChatID string
+}
+
+func NewTelegram(botToken string, chatID string) *Telegram {
+	return &Telegram{
+		URL:    fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", botToken),
+		ChatID: chatID,
+	}
+}
+
+func (t *Telegram) Name() string {
+	return "telegram"
+}
+
+func (t *Telegram) Notify(ctx context.Context, alert Alert) error {
+	status := "FIRING"
+	if alert.Resolved {
+		status = "RESOLVED"
+	}
+	body, err := json.Marshal(map[string]string{
+		"chat_id": t.ChatID,
+		"text":    fmt.Sprintf("[%s] %s: %s", status, alert.Severity, alert.Summary),
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNotifyFailed, err)
+	}
+	return post(ctx, t.URL, "application/json", body, nil)
+}
@@ -0,0 +1,223 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package archive writes bursts on archived talkgroups to the append-only archive table.
+package archive
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/puzpuzpuz/xsync/v3"
+	"gorm.io/gorm"
+)
+
+const (
+	flushInterval = time.Second
+	flagCacheTime = 10 * time.Second
+	insertBatch   = 500
+)
+
+//nolint:golint,gochecknoglobals
+var (
+	archivedCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dmrhub_archive_records_total",
+		Help: "Bursts written to the talkgroup archive",
+	})
+	droppedCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dmrhub_archive_dropped_records_total",
+		Help: "Bursts on archived talkgroups that could not be queued or written",
+	})
+
+	defaultArchiver atomic.Pointer[Archiver]
+)
+
+type talkgroupFlags struct {
+	archive bool
+	payload bool
+	expires time.Time
+}
+
+// Archiver queues bursts off of the packet path and appends them to each talkgroup's chain.
+// Only Run touches the chain heads, so records are always chained in the order they're written.
+type Archiver struct {
+	db       *gorm.DB
+	queue    chan models.ArchiveRecord
+	capacity int
+	flags    *xsync.MapOf[uint, talkgroupFlags]
+	heads    map[uint]string
+	pending  []models.ArchiveRecord
+}
+
+// NewArchiver creates an Archiver holding at most capacity unwritten records
+func NewArchiver(db *gorm.DB, capacity int) *Archiver {
+	return &Archiver{
+		db:       db,
+		queue:    make(chan models.ArchiveRecord, capacity),
+		capacity: capacity,
+		flags:    xsync.NewMapOf[uint, talkgroupFlags](),
+		heads:    make(map[uint]string),
+	}
+}
+
+// SetDefault installs the archiver used by Record
+func SetDefault(a *Archiver) {
+	defaultArchiver.Store(a)
+}
+
+// Default returns the archiver installed with SetDefault, if any
+func Default() *Archiver {
+	return defaultArchiver.Load()
+}
+
+// Record archives a group voice burst with the default archiver if its talkgroup is archived
+func Record(packet models.Packet, at time.Time) {
+	if a := Default(); a != nil {
+		a.Record(packet, at)
+	}
+}
+
+// Record queues a burst if its talkgroup is archived. It never blocks; bursts that
+// don't fit in the queue are counted and logged, as they're missing from the record.
+func (a *Archiver) Record(packet models.Packet, at time.Time) bool {
+	flags := a.talkgroupFlags(packet.Dst, at)
+	if !flags.archive {
+		return false
+	}
+	select {
+	case a.queue <- models.NewArchiveRecord(packet, at, flags.payload):
+		return true
+	default:
+		droppedCounter.Inc()
+		logging.Errorf("Archive queue full, dropped burst from stream %d on talkgroup %d", packet.StreamID, packet.Dst)
+		return false
+	}
+}
+
+func (a *Archiver) talkgroupFlags(talkgroupID uint, now time.Time) talkgroupFlags {
+	if flags, ok := a.flags.Load(talkgroupID); ok && now.Before(flags.expires) {
+		return flags
+	}
+	var talkgroups []models.Talkgroup
+	err := a.db.Select("id", "archive", "archive_payload").Where("id = ?", talkgroupID).Limit(1).Find(&talkgroups).Error
+	if err != nil {
+		// Keep whatever was cached rather than silently stopping the archive
+		logging.Errorf("Error checking if talkgroup %d is archived: %v", talkgroupID, err)
+		flags, _ := a.flags.Load(talkgroupID)
+		return flags
+	}
+	flags := talkgroupFlags{expires: now.Add(flagCacheTime)}
+	if len(talkgroups) > 0 {
+		flags.archive = talkgroups[0].Archive
+		flags.payload = talkgroups[0].ArchivePayload
+	}
+	a.flags.Store(talkgroupID, flags)
+	return flags
+}
+
+// Forget drops the cached archive flags for a talkgroup so a change takes effect immediately
+func (a *Archiver) Forget(talkgroupID uint) {
+	a.flags.Delete(talkgroupID)
+}
+
+// Run writes queued records every second until ctx is cancelled, then writes once more.
+func (a *Archiver) Run(ctx context.Context) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			a.Flush()
+			return
+		case <-ticker.C:
+			a.Flush()
+		}
+	}
+}
+
+// Flush chains and writes everything queued. Must not be called concurrently with Run.
+func (a *Archiver) Flush() {
+drain:
+	for {
+		select {
+		case record := <-a.queue:
+			a.pending = append(a.pending, record)
+		default:
+			break drain
+		}
+	}
+	if len(a.pending) == 0 {
+		return
+	}
+
+	heads := make(map[uint]string)
+	for i := range a.pending {
+		talkgroupID := a.pending[i].TalkgroupID
+		head, ok := heads[talkgroupID]
+		if !ok {
+			var err error
+			head, err = a.head(talkgroupID)
+			if err != nil {
+				logging.Errorf("Error finding the archive head for talkgroup %d: %v", talkgroupID, err)
+				a.shed()
+				return
+			}
+		}
+		a.pending[i].ID = 0
+		a.pending[i].Chain(head)
+		heads[talkgroupID] = a.pending[i].Hash
+	}
+
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		return tx.CreateInBatches(a.pending, insertBatch).Error
+	})
+	if err != nil {
+		// The heads may not match the database any more, reload them on the next attempt
+		logging.Errorf("Error writing %d archive records: %v", len(a.pending), err)
+		a.heads = make(map[uint]string)
+		a.shed()
+		return
+	}
+	for talkgroupID, head := range heads {
+		a.heads[talkgroupID] = head
+	}
+	archivedCounter.Add(float64(len(a.pending)))
+	a.pending = a.pending[:0]
+}
+
+func (a *Archiver) head(talkgroupID uint) (string, error) {
+	if head, ok := a.heads[talkgroupID]; ok {
+		return head, nil
+	}
+	return models.LastArchiveHash(a.db, talkgroupID)
+}
+
+// shed keeps failed records for the next flush, dropping the oldest beyond capacity
+func (a *Archiver) shed() {
+	if over := len(a.pending) - a.capacity; over > 0 {
+		droppedCounter.Add(float64(over))
+		logging.Errorf("Dropped %d archive records that could not be written", over)
+		a.pending = append(a.pending[:0], a.pending[over:]...)
+	}
+}
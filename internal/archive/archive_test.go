@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package archive_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/archive"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func makeTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.AutoMigrate(&models.Talkgroup{}, &models.ArchiveRecord{})
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	err = db.Create(&[]models.Talkgroup{{ID: 1, Name: "Archived", Archive: true, ArchivePayload: true}, {ID: 2, Name: "Not archived"}}).Error
+	if err != nil {
+		t.Fatalf("Failed to create talkgroups: %v", err)
+	}
+	return db
+}
+
+func TestArchiverChainsAcrossFlushes(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	archiver := archive.NewArchiver(db, 100)
+	now := time.Now()
+
+	if archiver.Record(models.Packet{Dst: 2, StreamID: 9}, now) {
+		t.Error("Expected traffic on a talkgroup without archival to be skipped")
+	}
+	for i := 0; i < 3; i++ {
+		if !archiver.Record(models.Packet{Dst: 1, StreamID: 7, Seq: uint(i)}, now) {
+			t.Fatal("Expected traffic on an archived talkgroup to be queued")
+		}
+	}
+	archiver.Flush()
+	archiver.Record(models.Packet{Dst: 1, StreamID: 7, Seq: 3}, now)
+	archiver.Flush()
+
+	var records []models.ArchiveRecord
+	if err := db.Order("id asc").Find(&records).Error; err != nil {
+		t.Fatalf("Failed to list records: %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("Expected 4 records, got %d", len(records))
+	}
+	if len(records[0].Payload) != 33 {
+		t.Errorf("Expected the payload to be archived, got %d bytes", len(records[0].Payload))
+	}
+	result, err := models.VerifyArchive(db, 1)
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if !result.Valid || result.Checked != 4 {
+		t.Errorf("Expected a valid chain of 4 records, got %+v", result)
+	}
+}
+
+func TestArchiverDropsWhenFull(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	archiver := archive.NewArchiver(db, 1)
+	if !archiver.Record(models.Packet{Dst: 1}, time.Now()) {
+		t.Fatal("Expected the first burst to be queued")
+	}
+	if archiver.Record(models.Packet{Dst: 1}, time.Now()) {
+		t.Error("Expected a burst beyond capacity to be dropped")
+	}
+}
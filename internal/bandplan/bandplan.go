@@ -0,0 +1,225 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package bandplan checks the frequencies repeaters report in their RPTC
+// configuration against regional amateur band plans, so typos like a 70cm
+// frequency on a 33cm machine are caught.
+package bandplan
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+)
+
+const (
+	// IssueOutOfBand means a frequency isn't in any segment of the plan
+	IssueOutOfBand = "out_of_band"
+	// IssueNotForHotspots means a frequency is in a segment hotspots shouldn't use
+	IssueNotForHotspots = "not_for_hotspots"
+	// IssueSplitBand means the RX and TX frequencies are in different bands
+	IssueSplitBand = "split_band"
+	// IssueColorCode means the repeater reported a different color code than its owner expects
+	IssueColorCode = "color_code_mismatch"
+
+	mhz = 1000000
+)
+
+var ErrEmptyPlan = errors.New("band plan has no segments")
+
+// Segment is a range of frequencies, in Hz, that DMR repeaters may use
+type Segment struct {
+	Name     string `json:"name"`
+	MinHz    uint   `json:"min_hz"`
+	MaxHz    uint   `json:"max_hz"`
+	Hotspots bool   `json:"hotspots"`
+}
+
+// Plan is a regional band plan
+type Plan struct {
+	Name     string    `json:"name"`
+	Segments []Segment `json:"segments"`
+}
+
+// Issue is a single problem with a repeater's configuration
+type Issue struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Result is the outcome of validating a repeater's configuration
+type Result struct {
+	Plan   string  `json:"plan,omitempty"`
+	Valid  bool    `json:"valid"`
+	Issues []Issue `json:"issues"`
+}
+
+// Plans are the built-in IARU region band plans, selected with BAND_PLAN
+//
+//nolint:golint,gochecknoglobals
+var Plans = map[string]Plan{
+	// Europe, Africa and the Middle East
+	"iaru1": {Name: "iaru1", Segments: []Segment{
+		{Name: "2m", MinHz: 144 * mhz, MaxHz: 146 * mhz, Hotspots: true},
+		{Name: "70cm", MinHz: 430 * mhz, MaxHz: 440 * mhz, Hotspots: true},
+		{Name: "23cm", MinHz: 1240 * mhz, MaxHz: 1300 * mhz},
+	}},
+	// The Americas
+	"iaru2": {Name: "iaru2", Segments: []Segment{
+		{Name: "2m", MinHz: 144 * mhz, MaxHz: 148 * mhz, Hotspots: true},
+		{Name: "1.25m", MinHz: 222 * mhz, MaxHz: 225 * mhz, Hotspots: true},
+		{Name: "70cm", MinHz: 420 * mhz, MaxHz: 450 * mhz, Hotspots: true},
+		{Name: "33cm", MinHz: 902 * mhz, MaxHz: 928 * mhz, Hotspots: true},
+		{Name: "23cm", MinHz: 1240 * mhz, MaxHz: 1300 * mhz},
+	}},
+	// Asia and the Pacific
+	"iaru3": {Name: "iaru3", Segments: []Segment{
+		{Name: "2m", MinHz: 144 * mhz, MaxHz: 148 * mhz, Hotspots: true},
+		{Name: "70cm", MinHz: 430 * mhz, MaxHz: 440 * mhz, Hotspots: true},
+		{Name: "23cm", MinHz: 1240 * mhz, MaxHz: 1300 * mhz},
+	}},
+}
+
+//nolint:golint,gochecknoglobals
+var (
+	activeOnce sync.Once
+	active     *Plan
+)
+
+// Active returns the band plan selected with BAND_PLAN, which is either the name of a
+// built-in plan or the path to a JSON plan. It returns false when no plan is configured.
+func Active() (Plan, bool) {
+	activeOnce.Do(func() {
+		name := config.GetConfig().BandPlan
+		if name == "" {
+			return
+		}
+		if plan, ok := Plans[name]; ok {
+			active = &plan
+			return
+		}
+		plan, err := Load(name)
+		if err != nil {
+			logging.Errorf("Failed to load band plan %s, frequencies won't be validated: %v", name, err)
+			return
+		}
+		active = &plan
+	})
+	if active == nil {
+		return Plan{}, false
+	}
+	return *active, true
+}
+
+// Load reads a band plan from a JSON file
+func Load(path string) (Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Plan{}, fmt.Errorf("failed to read band plan: %w", err)
+	}
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return Plan{}, fmt.Errorf("failed to parse band plan: %w", err)
+	}
+	if len(plan.Segments) == 0 {
+		return Plan{}, ErrEmptyPlan
+	}
+	if plan.Name == "" {
+		plan.Name = path
+	}
+	return plan, nil
+}
+
+func (p Plan) segment(hz uint) (Segment, bool) {
+	for _, segment := range p.Segments {
+		if hz >= segment.MinHz && hz <= segment.MaxHz {
+			return segment, true
+		}
+	}
+	return Segment{}, false
+}
+
+// Check validates a repeater's frequencies against the plan. Repeaters that
+// report no frequencies, such as software clients, aren't checked.
+func (p Plan) Check(rxHz, txHz uint, hotspot bool) []Issue {
+	issues := []Issue{}
+	if rxHz == 0 && txHz == 0 {
+		return issues
+	}
+	rx, rxOK := p.frequency(&issues, "rx_frequency", "RX", rxHz, hotspot)
+	tx, txOK := p.frequency(&issues, "tx_frequency", "TX", txHz, hotspot)
+	if rxOK && txOK && rx.Name != tx.Name {
+		issues = append(issues, Issue{
+			Field:   "rx_frequency",
+			Code:    IssueSplitBand,
+			Message: fmt.Sprintf("RX frequency is in the %s band but TX frequency is in the %s band", rx.Name, tx.Name),
+		})
+	}
+	return issues
+}
+
+func (p Plan) frequency(issues *[]Issue, field, label string, hz uint, hotspot bool) (Segment, bool) {
+	segment, ok := p.segment(hz)
+	if !ok {
+		*issues = append(*issues, Issue{
+			Field:   field,
+			Code:    IssueOutOfBand,
+			Message: fmt.Sprintf("%s frequency %s is outside the %s band plan", label, formatMHz(hz), p.Name),
+		})
+		return Segment{}, false
+	}
+	if hotspot && !segment.Hotspots {
+		*issues = append(*issues, Issue{
+			Field:   field,
+			Code:    IssueNotForHotspots,
+			Message: fmt.Sprintf("%s frequency %s is in the %s band, which hotspots shouldn't use", label, formatMHz(hz), segment.Name),
+		})
+	}
+	return segment, true
+}
+
+// Validate checks a repeater's reported configuration against the active band
+// plan and the color code its owner expects
+func Validate(repeater models.Repeater) Result {
+	result := Result{Issues: []Issue{}}
+	if plan, ok := Active(); ok {
+		result.Plan = plan.Name
+		result.Issues = plan.Check(repeater.RXFrequency, repeater.TXFrequency, repeater.Hotspot)
+	}
+	if repeater.ExpectedColorCode != nil && repeater.ColorCode != *repeater.ExpectedColorCode {
+		result.Issues = append(result.Issues, Issue{
+			Field:   "color_code",
+			Code:    IssueColorCode,
+			Message: fmt.Sprintf("Color code %d doesn't match the expected color code %d", repeater.ColorCode, *repeater.ExpectedColorCode),
+		})
+	}
+	result.Valid = len(result.Issues) == 0
+	return result
+}
+
+func formatMHz(hz uint) string {
+	return fmt.Sprintf("%.4f MHz", float64(hz)/mhz)
+}
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package bandplan_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/bandplan"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func codes(issues []bandplan.Issue) []string {
+	out := []string{}
+	for _, issue := range issues {
+		out = append(out, issue.Code)
+	}
+	return out
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+	plan := bandplan.Plans["iaru2"]
+	tests := []struct {
+		name    string
+		rx, tx  uint
+		hotspot bool
+		want    []string
+	}{
+		{"70cm repeater", 444000000, 449000000, false, []string{}},
+		{"simplex hotspot", 438800000, 438800000, true, []string{}},
+		{"no frequencies", 0, 0, true, []string{}},
+		{"43x typo on a 900MHz machine", 437000000, 927000000, false, []string{bandplan.IssueSplitBand}},
+		{"out of band", 460000000, 465000000, false, []string{bandplan.IssueOutOfBand, bandplan.IssueOutOfBand}},
+		{"23cm hotspot", 1293000000, 1293000000, true, []string{bandplan.IssueNotForHotspots, bandplan.IssueNotForHotspots}},
+	}
+	for _, test := range tests {
+		got := codes(plan.Check(test.rx, test.tx, test.hotspot))
+		if len(got) != len(test.want) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: expected %v, got %v", test.name, test.want, got)
+			}
+		}
+	}
+
+	// 146MHz is in the 2m band in region 2 but not region 1
+	if issues := bandplan.Plans["iaru1"].Check(146520000, 146520000, true); len(issues) != 2 {
+		t.Errorf("Expected 146.52MHz to be out of band in region 1, got %+v", issues)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "plan.json")
+	err := os.WriteFile(path, []byte(`{"name": "club", "segments": [{"name": "70cm", "min_hz": 440000000, "max_hz": 450000000, "hotspots": false}]}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := bandplan.Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load plan: %v", err)
+	}
+	if issues := plan.Check(442000000, 447000000, false); len(issues) != 0 {
+		t.Errorf("Expected no issues, got %+v", issues)
+	}
+
+	empty := filepath.Join(dir, "empty.json")
+	if err := os.WriteFile(empty, []byte(`{"name": "empty"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bandplan.Load(empty); !errors.Is(err, bandplan.ErrEmptyPlan) {
+		t.Errorf("Expected ErrEmptyPlan, got %v", err)
+	}
+}
+
+func TestValidateColorCode(t *testing.T) {
+	t.Parallel()
+	expected := uint8(3)
+	repeater := models.Repeater{ExpectedColorCode: &expected}
+	repeater.ColorCode = 1
+	result := bandplan.Validate(repeater)
+	if result.Valid || len(result.Issues) != 1 || result.Issues[0].Code != bandplan.IssueColorCode {
+		t.Errorf("Expected a color code mismatch, got %+v", result)
+	}
+	repeater.ColorCode = 3
+	if result := bandplan.Validate(repeater); !result.Valid {
+		t.Errorf("Expected a matching color code to be valid, got %+v", result)
+	}
+}
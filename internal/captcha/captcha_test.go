@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package captcha
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+)
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("Failed to parse form: %v", err)
+		}
+		if r.PostForm.Get("secret") != "s3cret" || r.PostForm.Get("remoteip") != "192.0.2.1" {
+			t.Errorf("Unexpected form: %v", r.PostForm)
+		}
+		if r.PostForm.Get("response") == "good" {
+			_, _ = w.Write([]byte(`{"success": true}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+	}))
+	defer server.Close()
+
+	verifier, err := NewVerifier(config.CaptchaTurnstile, "s3cret")
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+	verifier.url = server.URL
+
+	if ok, err := verifier.Verify(context.Background(), "good", "192.0.2.1"); !ok || err != nil {
+		t.Errorf("Expected a valid token to pass, got %t, %v", ok, err)
+	}
+	if ok, err := verifier.Verify(context.Background(), "bad", "192.0.2.1"); ok || err != nil {
+		t.Errorf("Expected an invalid token to be rejected without error, got %t, %v", ok, err)
+	}
+	if ok, _ := verifier.Verify(context.Background(), "", "192.0.2.1"); ok {
+		t.Error("Expected an empty token to be rejected")
+	}
+}
+
+func TestVerifyProviderDown(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	verifier, err := NewVerifier(config.CaptchaHCaptcha, "s3cret")
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+	verifier.url = server.URL
+	if ok, err := verifier.Verify(context.Background(), "good", ""); ok || err == nil {
+		t.Errorf("Expected an error when the provider is down, got %t, %v", ok, err)
+	}
+}
+
+func TestNewVerifierUnknownProvider(t *testing.T) {
+	t.Parallel()
+	if _, err := NewVerifier("recaptcha", "s3cret"); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("Expected ErrUnknownProvider, got %v", err)
+	}
+}
@@ -22,6 +22,7 @@ package config
 import (
 	"crypto/sha256"
 	"fmt"
+	"net"
 	"os"
 	"strconv"
 	"strings"
@@ -35,44 +36,130 @@ import (
 
 // Config stores the application configuration.
 type Config struct {
-	RedisHost                string
-	RedisPassword            string
-	PostgresDSN              string
-	postgresUser             string
-	postgresPassword         string
-	postgresHost             string
-	postgresPort             int
-	postgresDatabase         string
-	Secret                   []byte
-	strSecret                string
-	PasswordSalt             string
-	ListenAddr               string
-	DMRPort                  int
-	MetricsPort              int
-	OpenBridgePort           int
-	HTTPPort                 int
-	CORSHosts                []string
-	TrustedProxies           []string
-	HIBPAPIKey               string
-	OTLPEndpoint             string
-	InitialAdminUserPassword string
-	Debug                    bool
-	NetworkName              string
-	AllowScraping            bool
-	CustomRobotsTxt          string
-	FeatureFlags             []string
-	SMTPHost                 string
-	SMTPPort                 int
-	SMTPImplicitTLS          bool
-	SMTPUsername             string
-	SMTPPassword             string
-	SMTPFrom                 string
-	SMTPAuthMethod           string
-	AdminEmail               string
-	EnableEmail              bool
-	CanonicalHost            string
+	RedisHost                 string
+	RedisPassword             string
+	PostgresDSN               string
+	postgresUser              string
+	postgresPassword          string
+	postgresHost              string
+	postgresPort              int
+	postgresDatabase          string
+	Secret                    []byte
+	strSecret                 string
+	PasswordSalt              string
+	ListenAddr                string
+	DMRPort                   int
+	MetricsPort               int
+	OpenBridgePort            int
+	HTTPPort                  int
+	HBRPListen                []string
+	OpenBridgeListen          []string
+	HTTPListen                []string
+	AdminHTTPListen           []string
+	CORSHosts                 []string
+	CORS                      CORSPolicy
+	AdminCORS                 CORSPolicy
+	TrustedProxies            []string
+	HIBPAPIKey                string
+	CaptchaProvider           string
+	CaptchaSiteKey            string
+	CaptchaSecret             string
+	WatermarkSecret           string
+	RegistrationRateLimit     int
+	RateLimitAnonymous        RateLimit
+	RateLimitUser             RateLimit
+	RateLimitAdmin            RateLimit
+	RateLimitOverrides        map[string]RateLimit
+	Networks                  map[string]net.IP
+	OTLPEndpoint              string
+	InitialAdminUserPassword  string
+	Debug                     bool
+	NetworkName               string
+	AllowScraping             bool
+	CustomRobotsTxt           string
+	FeatureFlags              []string
+	SMTPHost                  string
+	SMTPPort                  int
+	SMTPImplicitTLS           bool
+	SMTPUsername              string
+	SMTPPassword              string
+	SMTPFrom                  string
+	SMTPAuthMethod            string
+	AdminEmail                string
+	EnableEmail               bool
+	EnableProfiling           bool
+	EnablePacketInjection     bool
+	CanonicalHost             string
+	HBRPPublicAddress         string
+	HBRPDisableExtensions     bool
+	HBRPFailoverMasters       []string
+	M17Callsign               string
+	M17Bridges                []M17Bridge
+	BandPlan                  string
+	BandPlanEnforce           bool
+	CallGroupingWindow        time.Duration
+	MissedCallWindow          time.Duration
+	DeferredDataTTL           time.Duration
+	DeferredDataLimit         int
+	MaxDatagramSize           int
+	CallRetention             time.Duration
+	AutoCreateTalkgroups      bool
+	AutoCreateNeedsApproval   bool
+	TalkgroupMutePrefix       string
+	TalkgroupMuteDuration     time.Duration
+	IngressFilter             bool
+	IngressBannedNetworks     []string
+	IngressMinSourcePort      int
+	IngressQuarantine         bool
+	IngressQuarantineLimit    int
+	RoutingExplainPercent     int
+	WriteBehindInterval       time.Duration
+	WriteBehindQueueSize      int
+	ArchiveQueueSize          int
+	SlowQueryThreshold        time.Duration
+	PubSubBufferSize          int
+	PubSubReplayWindow        time.Duration
+	PubSubMaxPending          int
+	PubSubMessageTTL          time.Duration
+	CallWatchdogTimeout       time.Duration
+	SimulcastWindow           time.Duration
+	PrivateCallFanout         string
+	PrivateCallRingTimeout    time.Duration
+	ShutdownDrainTimeout      time.Duration
+	ShutdownTimeout           time.Duration
+	DefaultLocale             string
+	AlertPagerDutyRoutingKey  string
+	AlertPagerDutySeverity    string
+	AlertNtfyURL              string
+	AlertNtfyToken            string
+	AlertNtfySeverity         string
+	AlertTelegramBotToken     string
+	AlertTelegramChatID       string
+	AlertTelegramSeverity     string
+	AlertCoreRepeaters        []string
+	AlertSilentTalkgroups     []string
+	AlertDBErrorsPerMinute    int
+	AlertPubSubDropsPerMinute int
+	Plugins                   []string
 }
 
+// CAPTCHA providers that can guard registration, selected with CAPTCHA_PROVIDER.
+const (
+	CaptchaHCaptcha  = "hcaptcha"
+	CaptchaTurnstile = "turnstile"
+)
+
+// Private call fan-out policies, selected with PRIVATE_CALL_FANOUT.
+const (
+	// PrivateCallFanoutLastHeard delivers only to the repeater the user was last heard on.
+	PrivateCallFanoutLastHeard = "lastheard"
+	// PrivateCallFanoutAll delivers to the last-heard repeater and every online repeater the user owns.
+	PrivateCallFanoutAll = "all"
+	// PrivateCallFanoutRing tries each of those repeaters in turn until the user keys up to answer,
+	// then sends the rest of the conversation to the repeater they answered on.
+	PrivateCallFanoutRing = "ring"
+)
+
 var currentConfig atomic.Value //nolint:golint,gochecknoglobals
 var isInit atomic.Bool         //nolint:golint,gochecknoglobals
 var loaded atomic.Bool         //nolint:golint,gochecknoglobals
@@ -114,38 +201,265 @@ func loadConfig() Config {
 		smtpPort = 0
 	}
 
+	callGroupingSeconds, err := strconv.ParseInt(os.Getenv("CALL_GROUPING_SECONDS"), 10, 0)
+	if err != nil || callGroupingSeconds < 0 {
+		callGroupingSeconds = 0
+	}
+
+	// A private call that isn't returned within this many seconds is recorded as missed
+	const defaultMissedCallSeconds = 120
+	missedCallSeconds, err := strconv.ParseInt(os.Getenv("MISSED_CALL_SECONDS"), 10, 0)
+	if err != nil {
+		missedCallSeconds = defaultMissedCallSeconds
+	} else if missedCallSeconds < 0 {
+		missedCallSeconds = 0
+	}
+
+	// Data calls to an offline repeater or user are held for this many hours waiting for it to come back
+	const defaultDeferredDataHours = 24
+	deferredDataHours, err := strconv.ParseInt(os.Getenv("DEFERRED_DATA_TTL_HOURS"), 10, 0)
+	if err != nil || deferredDataHours <= 0 {
+		deferredDataHours = defaultDeferredDataHours
+	}
+
+	// At most this many data packets are held for each offline destination, 0 disables store-and-forward
+	const defaultDeferredDataLimit = 256
+	deferredDataLimit, err := strconv.ParseInt(os.Getenv("DEFERRED_DATA_LIMIT"), 10, 0)
+	if err != nil || deferredDataLimit < 0 {
+		deferredDataLimit = defaultDeferredDataLimit
+	}
+
+	// Datagrams larger than this many bytes are trimmed, split or dropped unless a repeater or peer sets its own size, 0 disables the limit
+	maxDatagramSize, err := strconv.ParseInt(os.Getenv("MAX_DATAGRAM_SIZE"), 10, 0)
+	if err != nil || maxDatagramSize < 0 {
+		maxDatagramSize = 0
+	}
+
+	// Calls older than this many days are purged unless their talkgroup sets its own retention
+	callRetentionDays, err := strconv.ParseInt(os.Getenv("CALL_RETENTION_DAYS"), 10, 0)
+	if err != nil || callRetentionDays < 0 {
+		callRetentionDays = 0
+	}
+
+	// Static talkgroups muted from the radio are restored after this many minutes
+	const defaultTalkgroupMuteMinutes = 60
+	talkgroupMuteMinutes, err := strconv.ParseInt(os.Getenv("TALKGROUP_MUTE_MINUTES"), 10, 0)
+	if err != nil || talkgroupMuteMinutes <= 0 {
+		talkgroupMuteMinutes = defaultTalkgroupMuteMinutes
+	}
+
+	// Malformed packets a source may send in a minute before it is quarantined
+	const defaultIngressQuarantineLimit = 20
+	ingressQuarantineLimit, err := strconv.ParseInt(os.Getenv("INGRESS_QUARANTINE_LIMIT"), 10, 0)
+	if err != nil || ingressQuarantineLimit <= 0 {
+		ingressQuarantineLimit = defaultIngressQuarantineLimit
+	}
+
+	// Non-critical packet-path writes such as repeater pings are batched and flushed this often
+	const defaultWriteBehindMilliseconds = 1000
+	writeBehindMilliseconds, err := strconv.ParseInt(os.Getenv("WRITE_BEHIND_FLUSH_MS"), 10, 0)
+	if err != nil || writeBehindMilliseconds <= 0 {
+		writeBehindMilliseconds = defaultWriteBehindMilliseconds
+	}
+
+	// Pending writes beyond this are shed rather than allowed to back up into the packet path
+	const defaultWriteBehindQueueSize = 10000
+	writeBehindQueueSize, err := strconv.ParseInt(os.Getenv("WRITE_BEHIND_QUEUE_SIZE"), 10, 0)
+	if err != nil || writeBehindQueueSize <= 0 {
+		writeBehindQueueSize = defaultWriteBehindQueueSize
+	}
+
+	// Bursts on archived talkgroups waiting to be written. Archive writes are never shed
+	// silently, so size this for the busiest archived traffic expected during a database stall
+	const defaultArchiveQueueSize = 50000
+	archiveQueueSize, err := strconv.ParseInt(os.Getenv("ARCHIVE_QUEUE_SIZE"), 10, 0)
+	if err != nil || archiveQueueSize <= 0 {
+		archiveQueueSize = defaultArchiveQueueSize
+	}
+
+	// Database queries slower than this are logged along with their call site. 0 disables the log
+	const defaultSlowQueryMilliseconds = 250
+	slowQueryMilliseconds, err := strconv.ParseInt(os.Getenv("SLOW_QUERY_MS"), 10, 0)
+	if err != nil || slowQueryMilliseconds < 0 {
+		slowQueryMilliseconds = defaultSlowQueryMilliseconds
+	}
+
+	// Control-plane messages published while Redis is down are kept for replay, up to this many
+	const defaultPubSubBufferSize = 1000
+	pubSubBufferSize, err := strconv.ParseInt(os.Getenv("PUBSUB_BUFFER_SIZE"), 10, 0)
+	if err != nil || pubSubBufferSize < 0 {
+		pubSubBufferSize = defaultPubSubBufferSize
+	}
+
+	// Buffered messages older than this are dropped instead of replayed
+	const defaultPubSubReplaySeconds = 300
+	pubSubReplaySeconds, err := strconv.ParseInt(os.Getenv("PUBSUB_REPLAY_SECONDS"), 10, 0)
+	if err != nil || pubSubReplaySeconds <= 0 {
+		pubSubReplaySeconds = defaultPubSubReplaySeconds
+	}
+
+	// Each packet subscription queues at most this many messages, newer ones are dropped while it's full
+	const defaultPubSubMaxPending = 500
+	pubSubMaxPending, err := strconv.ParseInt(os.Getenv("PUBSUB_MAX_PENDING"), 10, 0)
+	if err != nil || pubSubMaxPending <= 0 {
+		pubSubMaxPending = defaultPubSubMaxPending
+	}
+
+	// Queued packets older than this are dropped, stale audio is worse than none. 0 disables the TTL
+	const defaultPubSubMessageTTLMilliseconds = 1000
+	pubSubMessageTTLMilliseconds, err := strconv.ParseInt(os.Getenv("PUBSUB_MESSAGE_TTL_MS"), 10, 0)
+	if err != nil || pubSubMessageTTLMilliseconds < 0 {
+		pubSubMessageTTLMilliseconds = defaultPubSubMessageTTLMilliseconds
+	}
+
+	// Calls that go this long without a burst are force-ended as truncated, like a lost voice terminator
+	const defaultCallWatchdogMilliseconds = 2000
+	callWatchdogMilliseconds, err := strconv.ParseInt(os.Getenv("CALL_WATCHDOG_MS"), 10, 0)
+	if err != nil || callWatchdogMilliseconds <= 0 {
+		callWatchdogMilliseconds = defaultCallWatchdogMilliseconds
+	}
+
+	// Simulcast groups without their own window hold traffic this long so members transmit together
+	const defaultSimulcastWindowMilliseconds = 250
+	simulcastWindowMilliseconds, err := strconv.ParseInt(os.Getenv("SIMULCAST_WINDOW_MS"), 10, 0)
+	if err != nil || simulcastWindowMilliseconds <= 0 {
+		simulcastWindowMilliseconds = defaultSimulcastWindowMilliseconds
+	}
+
+	// Registration attempts allowed from one IP per hour
+	const defaultRegistrationRateLimit = 5
+	registrationRateLimit, err := strconv.ParseInt(os.Getenv("REGISTRATION_RATE_LIMIT"), 10, 0)
+	if err != nil || registrationRateLimit <= 0 {
+		registrationRateLimit = defaultRegistrationRateLimit
+	}
+
+	// With the ring fan-out policy, each of a user's repeaters gets a private call this long before the next is tried
+	const defaultPrivateCallRingSeconds = 5
+	privateCallRingSeconds, err := strconv.ParseInt(os.Getenv("PRIVATE_CALL_RING_SECONDS"), 10, 0)
+	if err != nil || privateCallRingSeconds <= 0 {
+		privateCallRingSeconds = defaultPrivateCallRingSeconds
+	}
+
+	// On shutdown, calls already on the air get this long to finish before the servers stop. 0 skips the wait
+	const defaultShutdownDrainSeconds = 20
+	shutdownDrainSeconds, err := strconv.ParseInt(os.Getenv("SHUTDOWN_DRAIN_SECONDS"), 10, 0)
+	if err != nil || shutdownDrainSeconds < 0 {
+		shutdownDrainSeconds = defaultShutdownDrainSeconds
+	}
+
+	// Once drained, queues are flushed and servers stopped, giving up after this long
+	const defaultShutdownTimeoutSeconds = 10
+	shutdownTimeoutSeconds, err := strconv.ParseInt(os.Getenv("SHUTDOWN_TIMEOUT_SECONDS"), 10, 0)
+	if err != nil || shutdownTimeoutSeconds <= 0 {
+		shutdownTimeoutSeconds = defaultShutdownTimeoutSeconds
+	}
+
+	alertDBErrorsPerMinute, err := strconv.ParseInt(os.Getenv("ALERT_DB_ERRORS_PER_MINUTE"), 10, 0)
+	if err != nil || alertDBErrorsPerMinute < 0 {
+		alertDBErrorsPerMinute = 0
+	}
+
+	alertPubSubDropsPerMinute, err := strconv.ParseInt(os.Getenv("ALERT_PUBSUB_DROPS_PER_MINUTE"), 10, 0)
+	if err != nil || alertPubSubDropsPerMinute < 0 {
+		alertPubSubDropsPerMinute = 0
+	}
+
+	portStr = os.Getenv("INGRESS_MIN_SOURCE_PORT")
+	ingressMinSourcePort, err := strconv.ParseInt(portStr, 10, 0)
+	if err != nil {
+		ingressMinSourcePort = 0
+	}
+
 	tmpConfig := Config{
-		RedisHost:                os.Getenv("REDIS_HOST"),
-		postgresUser:             os.Getenv("PG_USER"),
-		postgresPassword:         os.Getenv("PG_PASSWORD"),
-		postgresHost:             os.Getenv("PG_HOST"),
-		postgresPort:             int(pgPort),
-		postgresDatabase:         os.Getenv("PG_DATABASE"),
-		strSecret:                os.Getenv("SECRET"),
-		PasswordSalt:             os.Getenv("PASSWORD_SALT"),
-		ListenAddr:               os.Getenv("LISTEN_ADDR"),
-		DMRPort:                  int(dmrPort),
-		HTTPPort:                 int(httpPort),
-		MetricsPort:              int(metricsPort),
-		HIBPAPIKey:               os.Getenv("HIBP_API_KEY"),
-		OTLPEndpoint:             os.Getenv("OTLP_ENDPOINT"),
-		InitialAdminUserPassword: os.Getenv("INIT_ADMIN_USER_PASSWORD"),
-		RedisPassword:            os.Getenv("REDIS_PASSWORD"),
-		Debug:                    os.Getenv("DEBUG") != "",
-		NetworkName:              os.Getenv("NETWORK_NAME"),
-		AllowScraping:            os.Getenv("ALLOW_SCRAPING") != "",
-		CustomRobotsTxt:          os.Getenv("CUSTOM_ROBOTS_TXT"),
-		OpenBridgePort:           int(openBridgePort),
-		SMTPHost:                 os.Getenv("SMTP_HOST"),
-		SMTPPort:                 int(smtpPort),
-		SMTPImplicitTLS:          os.Getenv("SMTP_IMPLICIT_TLS") != "",
-		SMTPUsername:             os.Getenv("SMTP_USERNAME"),
-		SMTPPassword:             os.Getenv("SMTP_PASSWORD"),
-		SMTPFrom:                 os.Getenv("SMTP_FROM"),
-		SMTPAuthMethod:           os.Getenv("SMTP_AUTH_METHOD"),
-		AdminEmail:               os.Getenv("ADMIN_EMAIL"),
-		EnableEmail:              os.Getenv("ENABLE_EMAIL") != "",
-		CanonicalHost:            os.Getenv("CANONICAL_HOST"),
+		RedisHost:                 os.Getenv("REDIS_HOST"),
+		postgresUser:              os.Getenv("PG_USER"),
+		postgresPassword:          mustReadSecret("PG_PASSWORD"),
+		postgresHost:              os.Getenv("PG_HOST"),
+		postgresPort:              int(pgPort),
+		postgresDatabase:          os.Getenv("PG_DATABASE"),
+		strSecret:                 mustReadSecret("SECRET"),
+		PasswordSalt:              mustReadSecret("PASSWORD_SALT"),
+		ListenAddr:                os.Getenv("LISTEN_ADDR"),
+		DMRPort:                   int(dmrPort),
+		HTTPPort:                  int(httpPort),
+		MetricsPort:               int(metricsPort),
+		HIBPAPIKey:                mustReadSecret("HIBP_API_KEY"),
+		CaptchaProvider:           strings.ToLower(os.Getenv("CAPTCHA_PROVIDER")),
+		CaptchaSiteKey:            os.Getenv("CAPTCHA_SITE_KEY"),
+		CaptchaSecret:             mustReadSecret("CAPTCHA_SECRET"),
+		WatermarkSecret:           mustReadSecret("WATERMARK_SECRET"),
+		RegistrationRateLimit:     int(registrationRateLimit),
+		RateLimitAnonymous:        parseRateLimit("RATE_LIMIT_ANONYMOUS", RateLimit{PerSecond: 10, Burst: 20}),
+		RateLimitUser:             parseRateLimit("RATE_LIMIT_USER", RateLimit{PerSecond: 20, Burst: 60}),
+		RateLimitAdmin:            parseRateLimit("RATE_LIMIT_ADMIN", RateLimit{PerSecond: 50, Burst: 200}),
+		RateLimitOverrides:        parseRateLimitOverrides("RATE_LIMIT_OVERRIDES"),
+		Networks:                  parseNetworks("NETWORKS"),
+		OTLPEndpoint:              os.Getenv("OTLP_ENDPOINT"),
+		InitialAdminUserPassword:  mustReadSecret("INIT_ADMIN_USER_PASSWORD"),
+		RedisPassword:             mustReadSecret("REDIS_PASSWORD"),
+		Debug:                     os.Getenv("DEBUG") != "",
+		NetworkName:               os.Getenv("NETWORK_NAME"),
+		AllowScraping:             os.Getenv("ALLOW_SCRAPING") != "",
+		CustomRobotsTxt:           os.Getenv("CUSTOM_ROBOTS_TXT"),
+		OpenBridgePort:            int(openBridgePort),
+		SMTPHost:                  os.Getenv("SMTP_HOST"),
+		SMTPPort:                  int(smtpPort),
+		SMTPImplicitTLS:           os.Getenv("SMTP_IMPLICIT_TLS") != "",
+		SMTPUsername:              mustReadSecret("SMTP_USERNAME"),
+		SMTPPassword:              mustReadSecret("SMTP_PASSWORD"),
+		SMTPFrom:                  os.Getenv("SMTP_FROM"),
+		SMTPAuthMethod:            os.Getenv("SMTP_AUTH_METHOD"),
+		AdminEmail:                os.Getenv("ADMIN_EMAIL"),
+		EnableEmail:               os.Getenv("ENABLE_EMAIL") != "",
+		EnableProfiling:           os.Getenv("ENABLE_PROFILING") != "",
+		EnablePacketInjection:     os.Getenv("ENABLE_PACKET_INJECTION") != "",
+		CanonicalHost:             os.Getenv("CANONICAL_HOST"),
+		HBRPPublicAddress:         os.Getenv("HBRP_PUBLIC_ADDRESS"),
+		HBRPDisableExtensions:     os.Getenv("HBRP_DISABLE_EXTENSIONS") != "",
+		M17Callsign:               strings.ToUpper(strings.TrimSpace(os.Getenv("M17_CALLSIGN"))),
+		M17Bridges:                parseM17Bridges("M17_BRIDGES"),
+		BandPlan:                  os.Getenv("BAND_PLAN"),
+		BandPlanEnforce:           os.Getenv("BAND_PLAN_ENFORCE") != "",
+		CallGroupingWindow:        time.Duration(callGroupingSeconds) * time.Second,
+		MissedCallWindow:          time.Duration(missedCallSeconds) * time.Second,
+		DeferredDataTTL:           time.Duration(deferredDataHours) * time.Hour,
+		DeferredDataLimit:         int(deferredDataLimit),
+		MaxDatagramSize:           int(maxDatagramSize),
+		CallRetention:             time.Duration(callRetentionDays) * 24 * time.Hour,
+		AutoCreateTalkgroups:      os.Getenv("AUTO_CREATE_TALKGROUPS") != "",
+		AutoCreateNeedsApproval:   os.Getenv("AUTO_CREATE_TALKGROUPS_REQUIRE_APPROVAL") != "",
+		TalkgroupMutePrefix:       os.Getenv("TALKGROUP_MUTE_PREFIX"),
+		TalkgroupMuteDuration:     time.Duration(talkgroupMuteMinutes) * time.Minute,
+		IngressFilter:             os.Getenv("INGRESS_FILTER") != "",
+		IngressMinSourcePort:      int(ingressMinSourcePort),
+		IngressQuarantine:         os.Getenv("INGRESS_QUARANTINE") != "",
+		IngressQuarantineLimit:    int(ingressQuarantineLimit),
+		RoutingExplainPercent:     parseRoutingExplainPercent("ROUTING_EXPLAIN_PERCENT"),
+		WriteBehindInterval:       time.Duration(writeBehindMilliseconds) * time.Millisecond,
+		WriteBehindQueueSize:      int(writeBehindQueueSize),
+		ArchiveQueueSize:          int(archiveQueueSize),
+		SlowQueryThreshold:        time.Duration(slowQueryMilliseconds) * time.Millisecond,
+		PubSubBufferSize:          int(pubSubBufferSize),
+		PubSubReplayWindow:        time.Duration(pubSubReplaySeconds) * time.Second,
+		PubSubMaxPending:          int(pubSubMaxPending),
+		PubSubMessageTTL:          time.Duration(pubSubMessageTTLMilliseconds) * time.Millisecond,
+		CallWatchdogTimeout:       time.Duration(callWatchdogMilliseconds) * time.Millisecond,
+		SimulcastWindow:           time.Duration(simulcastWindowMilliseconds) * time.Millisecond,
+		PrivateCallFanout:         strings.ToLower(os.Getenv("PRIVATE_CALL_FANOUT")),
+		PrivateCallRingTimeout:    time.Duration(privateCallRingSeconds) * time.Second,
+		ShutdownDrainTimeout:      time.Duration(shutdownDrainSeconds) * time.Second,
+		ShutdownTimeout:           time.Duration(shutdownTimeoutSeconds) * time.Second,
+		DefaultLocale:             os.Getenv("DEFAULT_LOCALE"),
+		AlertPagerDutyRoutingKey:  mustReadSecret("ALERT_PAGERDUTY_ROUTING_KEY"),
+		AlertPagerDutySeverity:    os.Getenv("ALERT_PAGERDUTY_SEVERITY"),
+		AlertNtfyURL:              os.Getenv("ALERT_NTFY_URL"),
+		AlertNtfyToken:            mustReadSecret("ALERT_NTFY_TOKEN"),
+		AlertNtfySeverity:         os.Getenv("ALERT_NTFY_SEVERITY"),
+		AlertTelegramBotToken:     mustReadSecret("ALERT_TELEGRAM_BOT_TOKEN"),
+		AlertTelegramChatID:       os.Getenv("ALERT_TELEGRAM_CHAT_ID"),
+		AlertTelegramSeverity:     os.Getenv("ALERT_TELEGRAM_SEVERITY"),
+		AlertDBErrorsPerMinute:    int(alertDBErrorsPerMinute),
+		AlertPubSubDropsPerMinute: int(alertPubSubDropsPerMinute),
 	}
 	if tmpConfig.RedisHost == "" {
 		tmpConfig.RedisHost = "localhost:6379"
@@ -165,7 +479,7 @@ func loadConfig() Config {
 	if tmpConfig.postgresDatabase == "" {
 		tmpConfig.postgresDatabase = "postgres"
 	}
-	tmpConfig.PostgresDSN = "host=" + tmpConfig.postgresHost + " port=" + strconv.FormatInt(int64(tmpConfig.postgresPort), 10) + " user=" + tmpConfig.postgresUser + " dbname=" + tmpConfig.postgresDatabase + " password=" + tmpConfig.postgresPassword
+	tmpConfig.PostgresDSN = tmpConfig.postgresDSN()
 	if tmpConfig.strSecret == "" {
 		tmpConfig.strSecret = "secret"
 		logging.Error("SECRET not set, using INSECURE default")
@@ -180,7 +494,7 @@ func loadConfig() Config {
 	if tmpConfig.DMRPort == 0 {
 		tmpConfig.DMRPort = 62031
 	}
-	if tmpConfig.OpenBridgePort == 0 {
+	if tmpConfig.OpenBridgePort == 0 && os.Getenv("OPENBRIDGE_LISTEN") == "" {
 		logging.Error("OPENBRIDGE_PORT not set, disabling OpenBridge support")
 	}
 	if tmpConfig.HTTPPort == 0 {
@@ -214,6 +528,17 @@ func loadConfig() Config {
 	} else {
 		tmpConfig.CORSHosts = strings.Split(corsHosts, ",")
 	}
+	// CORS_METHODS, CORS_HEADERS, CORS_ALLOW_CREDENTIALS, CORS_MAX_AGE_SECONDS and CSRF_PROTECTION
+	// complete the policy for HTTPListen. ADMIN_CORS_* and ADMIN_CSRF_PROTECTION override it
+	// for ADMIN_HTTP_LISTEN, so a separately hosted admin frontend can have its own origins.
+	tmpConfig.CORS = parseCORSPolicy("CORS_", "CSRF_PROTECTION", CORSPolicy{
+		Origins:          tmpConfig.CORSHosts,
+		Methods:          []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
+		Headers:          []string{"Origin", "Content-Length", "Content-Type", CSRFHeader},
+		AllowCredentials: true,
+		MaxAge:           defaultCORSMaxAge,
+	})
+	tmpConfig.AdminCORS = parseCORSPolicy("ADMIN_CORS_", "ADMIN_CSRF_PROTECTION", tmpConfig.CORS)
 	// FEATURE_FLAGS is a comma separated list of enabled feature flags
 	featureFlags := os.Getenv("FEATURE_FLAGS")
 	if featureFlags == "" {
@@ -221,17 +546,83 @@ func loadConfig() Config {
 	} else {
 		tmpConfig.FeatureFlags = strings.Split(featureFlags, ",")
 	}
+	// INGRESS_BANNED_NETWORKS is a comma separated list of IPs or CIDRs whose DMR traffic is dropped
+	ingressBannedNetworks := os.Getenv("INGRESS_BANNED_NETWORKS")
+	if ingressBannedNetworks == "" {
+		tmpConfig.IngressBannedNetworks = []string{}
+	} else {
+		tmpConfig.IngressBannedNetworks = strings.Split(ingressBannedNetworks, ",")
+	}
+	// PLUGINS is a comma separated list of plugin commands to run
+	plugins := os.Getenv("PLUGINS")
+	if plugins == "" {
+		tmpConfig.Plugins = []string{}
+	} else {
+		tmpConfig.Plugins = strings.Split(plugins, ",")
+	}
+	// ALERT_CORE_REPEATERS is a comma separated list of repeater IDs to alert on when offline
+	alertCoreRepeaters := os.Getenv("ALERT_CORE_REPEATERS")
+	if alertCoreRepeaters == "" {
+		tmpConfig.AlertCoreRepeaters = []string{}
+	} else {
+		tmpConfig.AlertCoreRepeaters = strings.Split(alertCoreRepeaters, ",")
+	}
+	// ALERT_SILENT_TALKGROUPS is a comma separated list of talkgroup:hours pairs to alert on when no calls are heard
+	alertSilentTalkgroups := os.Getenv("ALERT_SILENT_TALKGROUPS")
+	if alertSilentTalkgroups == "" {
+		tmpConfig.AlertSilentTalkgroups = []string{}
+	} else {
+		tmpConfig.AlertSilentTalkgroups = strings.Split(alertSilentTalkgroups, ",")
+	}
 	trustedProxies := os.Getenv("TRUSTED_PROXIES")
 	if trustedProxies == "" {
 		tmpConfig.TrustedProxies = []string{}
 	} else {
 		tmpConfig.TrustedProxies = strings.Split(trustedProxies, ",")
 	}
+	// HBRP_LISTEN, OPENBRIDGE_LISTEN, and HTTP_LISTEN are comma separated lists of host:port
+	// pairs to bind each protocol to. They default to LISTEN_ADDR and the protocol's port.
+	tmpConfig.HBRPListen = parseListenAddrs("HBRP_LISTEN")
+	tmpConfig.HBRPFailoverMasters = parseListenAddrs("HBRP_FAILOVER_MASTERS")
+	if len(tmpConfig.HBRPListen) == 0 {
+		tmpConfig.HBRPListen = []string{net.JoinHostPort(tmpConfig.ListenAddr, strconv.Itoa(tmpConfig.DMRPort))}
+	}
+	tmpConfig.OpenBridgeListen = parseListenAddrs("OPENBRIDGE_LISTEN")
+	if len(tmpConfig.OpenBridgeListen) == 0 && tmpConfig.OpenBridgePort != 0 {
+		tmpConfig.OpenBridgeListen = []string{net.JoinHostPort(tmpConfig.ListenAddr, strconv.Itoa(tmpConfig.OpenBridgePort))}
+	}
+	tmpConfig.HTTPListen = parseListenAddrs("HTTP_LISTEN")
+	if len(tmpConfig.HTTPListen) == 0 {
+		tmpConfig.HTTPListen = []string{net.JoinHostPort(tmpConfig.ListenAddr, strconv.Itoa(tmpConfig.HTTPPort))}
+	}
+	// When set, admin-only endpoints are only served on these addresses and are hidden from HTTPListen
+	tmpConfig.AdminHTTPListen = parseListenAddrs("ADMIN_HTTP_LISTEN")
 
 	if tmpConfig.CanonicalHost == "" {
 		tmpConfig.CanonicalHost = "localhost"
 	}
 
+	switch tmpConfig.CaptchaProvider {
+	case "":
+	case CaptchaHCaptcha, CaptchaTurnstile:
+		if tmpConfig.CaptchaSiteKey == "" || tmpConfig.CaptchaSecret == "" {
+			logging.Errorf("CAPTCHA_PROVIDER is %s but CAPTCHA_SITE_KEY or CAPTCHA_SECRET is not set, registration CAPTCHAs are disabled", tmpConfig.CaptchaProvider)
+			tmpConfig.CaptchaProvider = ""
+		}
+	default:
+		logging.Errorf("CAPTCHA_PROVIDER %q is not one of hcaptcha or turnstile, registration CAPTCHAs are disabled", tmpConfig.CaptchaProvider)
+		tmpConfig.CaptchaProvider = ""
+	}
+
+	switch tmpConfig.PrivateCallFanout {
+	case PrivateCallFanoutLastHeard, PrivateCallFanoutAll, PrivateCallFanoutRing:
+	case "":
+		tmpConfig.PrivateCallFanout = PrivateCallFanoutAll
+	default:
+		logging.Errorf("PRIVATE_CALL_FANOUT %q is not one of lastheard, all or ring, using all", tmpConfig.PrivateCallFanout)
+		tmpConfig.PrivateCallFanout = PrivateCallFanoutAll
+	}
+
 	switch tmpConfig.SMTPAuthMethod {
 	case "PLAIN":
 	case "LOGIN":
@@ -239,9 +630,13 @@ func loadConfig() Config {
 		logging.Error("SMTP_AUTH_METHOD not set to a valid value. You can ignore this if you are not using email features.")
 	}
 
+	if tmpConfig.EnablePacketInjection {
+		logging.Error("Packet injection enabled, admins can send arbitrary traffic into the network. This should not be used in production")
+	}
+
 	if tmpConfig.Debug {
 		logging.Error("Debug mode enabled, this should not be used in production")
-		logging.Errorf("Config: %+v", tmpConfig)
+		logging.Errorf("Config: %+v", tmpConfig.Redacted())
 	}
 	const iterations = 4096
 	const keyLen = 32
@@ -249,6 +644,236 @@ func loadConfig() Config {
 	return tmpConfig
 }
 
+// RateLimit is a token bucket: requests refill at PerSecond up to Burst.
+// A zero PerSecond disables the limit.
+type RateLimit struct {
+	PerSecond int
+	Burst     int
+}
+
+// parseRateLimit reads a rate limit written as "per-second:burst" from the given
+// environment variable. The burst can be left off, and defaults to the rate.
+func parseRateLimit(env string, def RateLimit) RateLimit {
+	value := strings.TrimSpace(os.Getenv(env))
+	if value == "" {
+		return def
+	}
+	limit, ok := parseRateLimitValue(value)
+	if !ok {
+		logging.Errorf("%s %q is not a valid rate limit, using %d:%d", env, value, def.PerSecond, def.Burst)
+		return def
+	}
+	return limit
+}
+
+func parseRateLimitValue(value string) (RateLimit, bool) {
+	rateStr, burstStr, hasBurst := strings.Cut(value, ":")
+	rate, err := strconv.Atoi(strings.TrimSpace(rateStr))
+	if err != nil || rate < 0 {
+		return RateLimit{}, false
+	}
+	burst := rate
+	if hasBurst {
+		burst, err = strconv.Atoi(strings.TrimSpace(burstStr))
+		if err != nil || burst < 1 {
+			return RateLimit{}, false
+		}
+	}
+	return RateLimit{PerSecond: rate, Burst: max(burst, 1)}, true
+}
+
+// parseRateLimitOverrides reads a comma separated list of route=per-second:burst
+// entries, where route is the path as registered, e.g. /api/v1/lastheard/user/:id
+func parseRateLimitOverrides(env string) map[string]RateLimit {
+	overrides := map[string]RateLimit{}
+	value := os.Getenv(env)
+	if value == "" {
+		return overrides
+	}
+	for _, entry := range strings.Split(value, ",") {
+		route, limitStr, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			logging.Errorf("%s entry %q is not route=per-second:burst, ignoring it", env, entry)
+			continue
+		}
+		limit, ok := parseRateLimitValue(limitStr)
+		if !ok {
+			logging.Errorf("%s entry %q is not a valid rate limit, ignoring it", env, entry)
+			continue
+		}
+		overrides[strings.TrimSpace(route)] = limit
+	}
+	return overrides
+}
+
+// parseNetworks reads a comma separated list of name=ip entries naming the local addresses of
+// private networks, e.g. wg0=10.8.0.1. Repeaters and peers bound to a network must reach the hub
+// through a socket listening on that address, and are only sent traffic through it.
+func parseNetworks(env string) map[string]net.IP {
+	networks := map[string]net.IP{}
+	value := os.Getenv(env)
+	if value == "" {
+		return networks
+	}
+	for _, entry := range strings.Split(value, ",") {
+		name, ipStr, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		ip := net.ParseIP(strings.TrimSpace(ipStr))
+		if !ok || strings.TrimSpace(name) == "" || ip == nil {
+			logging.Errorf("%s entry %q is not name=ip, ignoring it", env, entry)
+			continue
+		}
+		networks[strings.TrimSpace(name)] = ip
+	}
+	return networks
+}
+
+// M17Bridge links a talkgroup to a module on an M17 reflector
+type M17Bridge struct {
+	Talkgroup uint
+	Reflector string
+	Module    byte
+}
+
+// parseM17Bridges reads a comma separated list of talkgroup=host:port/module entries,
+// e.g. 31700=m17.example.org:17000/A, bridging each talkgroup to a reflector module
+func parseM17Bridges(env string) []M17Bridge {
+	value := os.Getenv(env)
+	if value == "" {
+		return nil
+	}
+	bridges := []M17Bridge{}
+	for _, entry := range strings.Split(value, ",") {
+		tgStr, target, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		slash := strings.LastIndex(target, "/")
+		if !ok || slash < 0 {
+			logging.Errorf("%s entry %q is not talkgroup=host:port/module, ignoring it", env, entry)
+			continue
+		}
+		talkgroup, err := strconv.ParseUint(strings.TrimSpace(tgStr), 10, 32)
+		reflector, module := strings.TrimSpace(target[:slash]), strings.ToUpper(strings.TrimSpace(target[slash+1:]))
+		if _, _, addrErr := net.SplitHostPort(reflector); err != nil || talkgroup == 0 || addrErr != nil {
+			logging.Errorf("%s entry %q is not talkgroup=host:port/module, ignoring it", env, entry)
+			continue
+		}
+		if len(module) != 1 || module[0] < 'A' || module[0] > 'Z' {
+			logging.Errorf("%s entry %q needs a module from A to Z, ignoring it", env, entry)
+			continue
+		}
+		bridges = append(bridges, M17Bridge{Talkgroup: uint(talkgroup), Reflector: reflector, Module: module[0]})
+	}
+	return bridges
+}
+
+// CSRFHeader carries the CSRF token on state-changing requests when CSRF protection is on
+const CSRFHeader = "X-CSRF-Token"
+
+// How long browsers may cache a preflight response
+const defaultCORSMaxAge = 12 * time.Hour
+
+// CORSPolicy is the CORS and CSRF configuration of one HTTP listener
+type CORSPolicy struct {
+	Origins          []string
+	Methods          []string
+	Headers          []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+	// CSRF requires a token header on state-changing requests from logged in sessions
+	CSRF bool
+}
+
+// parseCORSPolicy reads a CORS policy from environment variables starting with
+// prefix. Anything that isn't set is taken from def.
+func parseCORSPolicy(prefix string, csrfEnv string, def CORSPolicy) CORSPolicy {
+	policy := def
+	if origins := parseList(prefix + "HOSTS"); origins != nil {
+		policy.Origins = origins
+	}
+	if methods := parseList(prefix + "METHODS"); methods != nil {
+		policy.Methods = methods
+	}
+	if headers := parseList(prefix + "HEADERS"); headers != nil {
+		policy.Headers = headers
+	}
+	policy.AllowCredentials = parseBool(prefix+"ALLOW_CREDENTIALS", def.AllowCredentials)
+	if value := os.Getenv(prefix + "MAX_AGE_SECONDS"); value != "" {
+		seconds, err := strconv.ParseInt(value, 10, 0)
+		if err != nil || seconds < 0 {
+			logging.Errorf("%sMAX_AGE_SECONDS %q is not a number of seconds, using %s", prefix, value, def.MaxAge)
+		} else {
+			policy.MaxAge = time.Duration(seconds) * time.Second
+		}
+	}
+	policy.CSRF = parseBool(csrfEnv, def.CSRF)
+	return policy
+}
+
+// parseBool reads a boolean that has to be able to be turned off, unlike the
+// enable flags that are on whenever they're set
+func parseBool(env string, def bool) bool {
+	value := os.Getenv(env)
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		logging.Errorf("%s %q is not a boolean, using %t", env, value, def)
+		return def
+	}
+	return parsed
+}
+
+// parseList reads a comma separated list, returning nil if the variable isn't set
+func parseList(env string) []string {
+	value := os.Getenv(env)
+	if value == "" {
+		return nil
+	}
+	list := []string{}
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// parseListenAddrs reads a comma separated list of host:port pairs from the
+// given environment variable, dropping any entries that don't parse.
+func parseListenAddrs(env string) []string {
+	value := os.Getenv(env)
+	if value == "" {
+		return nil
+	}
+	addrs := []string{}
+	for _, addr := range strings.Split(value, ",") {
+		addr = strings.TrimSpace(addr)
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			logging.Errorf("%s entry %q is not a valid host:port, ignoring it", env, addr)
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// parseRoutingExplainPercent reads the percentage of streams whose routing decisions are recorded
+// for the explain API. Recording costs a redis write per decision on the packet path, so only a
+// small sample is kept unless an admin asks for more while investigating.
+func parseRoutingExplainPercent(env string) int {
+	const defaultRoutingExplainPercent = 1
+	const maxRoutingExplainPercent = 100
+	percent, err := strconv.ParseInt(os.Getenv(env), 10, 0)
+	switch {
+	case err != nil:
+		return defaultRoutingExplainPercent
+	case percent > maxRoutingExplainPercent:
+		return maxRoutingExplainPercent
+	case percent < 0:
+		return 0
+	}
+	return int(percent)
+}
+
 // GetConfig obtains the current configuration
 // On the first call, it will load the configuration from the environment variables.
 func GetConfig() *Config {
@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package config
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseCORSPolicy(t *testing.T) {
+	def := CORSPolicy{
+		Origins:          []string{"http://localhost:3005"},
+		Methods:          []string{"GET", "POST"},
+		AllowCredentials: true,
+		MaxAge:           time.Hour,
+	}
+	t.Setenv("TEST_CORS_HOSTS", "https://dmrhub.example.com, https://admin.example.com")
+	t.Setenv("TEST_CORS_ALLOW_CREDENTIALS", "false")
+	t.Setenv("TEST_CORS_MAX_AGE_SECONDS", "soon")
+	t.Setenv("TEST_CSRF", "true")
+
+	policy := parseCORSPolicy("TEST_CORS_", "TEST_CSRF", def)
+	if !slices.Equal(policy.Origins, []string{"https://dmrhub.example.com", "https://admin.example.com"}) {
+		t.Errorf("Unexpected origins %v", policy.Origins)
+	}
+	if !slices.Equal(policy.Methods, def.Methods) {
+		t.Errorf("Expected unset methods to be inherited, got %v", policy.Methods)
+	}
+	if policy.AllowCredentials {
+		t.Error("Expected credentials to be turned off")
+	}
+	if policy.MaxAge != time.Hour {
+		t.Errorf("Expected an invalid max age to fall back to the default, got %s", policy.MaxAge)
+	}
+	if !policy.CSRF {
+		t.Error("Expected CSRF protection to be turned on")
+	}
+}
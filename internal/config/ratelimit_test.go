@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package config
+
+import "testing"
+
+func TestParseRateLimit(t *testing.T) {
+	def := RateLimit{PerSecond: 10, Burst: 20}
+	cases := map[string]RateLimit{
+		"":      def,
+		"5:15":  {PerSecond: 5, Burst: 15},
+		"5":     {PerSecond: 5, Burst: 5},
+		"0":     {PerSecond: 0, Burst: 1},
+		"fast":  def,
+		"5:0":   def,
+		"-1:10": def,
+	}
+	for value, want := range cases {
+		t.Setenv("TEST_RATE_LIMIT", value)
+		if got := parseRateLimit("TEST_RATE_LIMIT", def); got != want {
+			t.Errorf("parseRateLimit(%q) = %+v, want %+v", value, got, want)
+		}
+	}
+}
+
+func TestParseRateLimitOverrides(t *testing.T) {
+	t.Setenv("TEST_RATE_LIMIT_OVERRIDES", "/api/v1/lastheard=2:5, /api/v1/auth/login=1,broken,/api/v1/users=x")
+	overrides := parseRateLimitOverrides("TEST_RATE_LIMIT_OVERRIDES")
+	if len(overrides) != 2 {
+		t.Fatalf("Expected the two valid overrides, got %+v", overrides)
+	}
+	if overrides["/api/v1/lastheard"] != (RateLimit{PerSecond: 2, Burst: 5}) {
+		t.Errorf("Unexpected lastheard override %+v", overrides["/api/v1/lastheard"])
+	}
+	if overrides["/api/v1/auth/login"] != (RateLimit{PerSecond: 1, Burst: 1}) {
+		t.Errorf("Unexpected login override %+v", overrides["/api/v1/auth/login"])
+	}
+}
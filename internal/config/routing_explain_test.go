@@ -0,0 +1,39 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package config
+
+import "testing"
+
+func TestParseRoutingExplainPercent(t *testing.T) {
+	cases := map[string]int{
+		"":    1,
+		"all": 1,
+		"0":   0,
+		"25":  25,
+		"250": 100,
+		"-5":  0,
+	}
+	for value, want := range cases {
+		t.Setenv("TEST_ROUTING_EXPLAIN_PERCENT", value)
+		if got := parseRoutingExplainPercent("TEST_ROUTING_EXPLAIN_PERCENT"); got != want {
+			t.Errorf("parseRoutingExplainPercent(%q) = %d, want %d", value, got, want)
+		}
+	}
+}
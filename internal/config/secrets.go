@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+)
+
+// SECRETS_DIR points at a directory of mounted secret files, one per variable name
+const secretsDirEnv = "SECRETS_DIR"
+
+const redacted = "REDACTED"
+
+// readSecret looks up a sensitive value. NAME_FILE takes precedence over NAME,
+// which takes precedence over a file called NAME in SECRETS_DIR.
+func readSecret(name string) (string, error) {
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		if os.Getenv(name) != "" {
+			return "", fmt.Errorf("both %s and %s_FILE are set", name, name)
+		}
+		return readSecretFile(path)
+	}
+	if value := os.Getenv(name); value != "" {
+		return value, nil
+	}
+	if dir := os.Getenv(secretsDirEnv); dir != "" {
+		value, err := readSecretFile(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return value, err
+	}
+	return "", nil
+}
+
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	// Secret files written by hand or by editors usually end with a newline
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// mustReadSecret reads a secret, exiting if a configured secret file can't be read
+func mustReadSecret(name string) string {
+	value, err := readSecret(name)
+	if err != nil {
+		// Only the variable name is logged, never the value
+		logging.Errorf("Failed to load %s: %s", name, err)
+		os.Exit(1)
+	}
+	return value
+}
+
+// Redacted returns a copy of the config that is safe to log
+func (c Config) Redacted() Config {
+	secrets := []*string{
+		&c.RedisPassword,
+		&c.postgresPassword,
+		&c.strSecret,
+		&c.PasswordSalt,
+		&c.HIBPAPIKey,
+		&c.CaptchaSecret,
+		&c.WatermarkSecret,
+		&c.InitialAdminUserPassword,
+		&c.SMTPUsername,
+		&c.SMTPPassword,
+		&c.AlertPagerDutyRoutingKey,
+		&c.AlertNtfyToken,
+		&c.AlertTelegramBotToken,
+	}
+	for _, secret := range secrets {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+	if c.Secret != nil {
+		c.Secret = []byte(redacted)
+	}
+	if c.PostgresDSN != "" {
+		c.PostgresDSN = c.postgresDSN()
+	}
+	return c
+}
+
+func (c Config) postgresDSN() string {
+	return "host=" + c.postgresHost + " port=" + strconv.Itoa(c.postgresPort) + " user=" + c.postgresUser + " dbname=" + c.postgresDatabase + " password=" + c.postgresPassword
+}
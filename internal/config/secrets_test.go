@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadSecretFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pg_password")
+	if err := os.WriteFile(path, []byte("hunter2\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+	t.Setenv("TEST_SECRET_FILE", path)
+
+	value, err := readSecret("TEST_SECRET")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if value != "hunter2" {
+		t.Errorf("Expected the trailing newline to be trimmed, got %q", value)
+	}
+
+	t.Setenv("TEST_SECRET", "plaintext")
+	if _, err := readSecret("TEST_SECRET"); err == nil {
+		t.Error("Expected an error when both the variable and its file are set")
+	}
+}
+
+func TestReadSecretFromSecretsDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "TEST_DIR_SECRET"), []byte("mounted"), 0o600); err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+	t.Setenv(secretsDirEnv, dir)
+
+	value, err := readSecret("TEST_DIR_SECRET")
+	if err != nil || value != "mounted" {
+		t.Errorf("Expected mounted secret, got %q (%v)", value, err)
+	}
+
+	value, err = readSecret("TEST_MISSING_SECRET")
+	if err != nil || value != "" {
+		t.Errorf("Expected a missing secret to be empty, got %q (%v)", value, err)
+	}
+
+	t.Setenv("TEST_DIR_SECRET", "env")
+	if value, _ := readSecret("TEST_DIR_SECRET"); value != "env" {
+		t.Errorf("Expected the environment to win over SECRETS_DIR, got %q", value)
+	}
+}
+
+func TestRedactedHidesSecrets(t *testing.T) {
+	t.Parallel()
+	config := Config{
+		RedisPassword:            "redis-pass",
+		postgresPassword:         "pg-pass",
+		postgresHost:             "db",
+		strSecret:                "session-secret",
+		PasswordSalt:             "salty",
+		SMTPUsername:             "smtp-user",
+		SMTPPassword:             "smtp-pass",
+		AlertTelegramBotToken:    "bot-token",
+		InitialAdminUserPassword: "admin-pass",
+		Secret:                   []byte("derived-key"),
+		NetworkName:              "DMRHub",
+	}
+	config.PostgresDSN = config.postgresDSN()
+
+	logged := fmt.Sprintf("%+v", config.Redacted())
+	for _, secret := range []string{"redis-pass", "pg-pass", "session-secret", "salty", "smtp-user", "smtp-pass", "bot-token", "admin-pass", "derived-key"} {
+		if strings.Contains(logged, secret) {
+			t.Errorf("Redacted config leaks %q", secret)
+		}
+	}
+	if !strings.Contains(logged, "DMRHub") {
+		t.Error("Expected non-secret values to be kept")
+	}
+	if config.RedisPassword != "redis-pass" {
+		t.Error("Expected Redacted not to modify the original config")
+	}
+}
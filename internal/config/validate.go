@@ -0,0 +1,255 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Severity is how serious a configuration problem is. Errors stop a deployment
+// from working, warnings are risky but run.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// m17CallsignRegex matches the callsigns M17's base-40 address encoding can carry
+var m17CallsignRegex = regexp.MustCompile(`^[A-Z0-9][A-Z0-9 ./-]{0,8}$`) //nolint:golint,gochecknoglobals
+
+// Problem is a configuration mistake found by Validate or ValidateSecrets
+type Problem struct {
+	Severity Severity `json:"severity"`
+	Setting  string   `json:"setting"`
+	Message  string   `json:"message"`
+}
+
+// secretNames are the settings read with readSecret, and so can come from files
+//
+//nolint:golint,gochecknoglobals
+var secretNames = []string{
+	"PG_PASSWORD",
+	"SECRET",
+	"PASSWORD_SALT",
+	"HIBP_API_KEY",
+	"CAPTCHA_SECRET",
+	"WATERMARK_SECRET",
+	"INIT_ADMIN_USER_PASSWORD",
+	"REDIS_PASSWORD",
+	"SMTP_USERNAME",
+	"SMTP_PASSWORD",
+	"ALERT_PAGERDUTY_ROUTING_KEY",
+	"ALERT_NTFY_TOKEN",
+	"ALERT_TELEGRAM_BOT_TOKEN",
+}
+
+// ValidateSecrets checks the files secrets are read from. It needs to run before
+// the config is loaded, since loading exits on a secret file it can't read.
+func ValidateSecrets() []Problem {
+	problems := []Problem{}
+	dir := os.Getenv(secretsDirEnv)
+	if dir != "" {
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() {
+			problems = append(problems, Problem{SeverityError, secretsDirEnv, fmt.Sprintf("%s is not a directory", dir)})
+			dir = ""
+		}
+	}
+	for _, name := range secretNames {
+		setting, path := name+"_FILE", os.Getenv(name+"_FILE")
+		if path == "" && dir != "" && os.Getenv(name) == "" {
+			setting, path = secretsDirEnv, filepath.Join(dir, name)
+			if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+		}
+		if path == "" {
+			continue
+		}
+		if _, err := readSecret(name); err != nil {
+			problems = append(problems, Problem{SeverityError, setting, fmt.Sprintf("%s: %s", name, err)})
+			continue
+		}
+		info, err := os.Stat(path)
+		// Anyone who can read the file can read the secret
+		if err == nil && info.Mode().Perm()&0o077 != 0 {
+			problems = append(problems, Problem{SeverityWarning, setting, fmt.Sprintf("%s is readable by other users (mode %04o)", path, info.Mode().Perm())})
+		}
+	}
+	return problems
+}
+
+// Validate checks rules that span settings, which loading can't fix up on its own
+func (c Config) Validate() []Problem {
+	problems := c.listenerProblems()
+	problems = append(problems, c.networkProblems()...)
+
+	if c.strSecret == "secret" {
+		problems = append(problems, Problem{SeverityError, "SECRET", "not set, sessions are signed with an insecure default"})
+	}
+	if c.PasswordSalt == "salt" {
+		problems = append(problems, Problem{SeverityError, "PASSWORD_SALT", "not set, passwords are hashed with an insecure default"})
+	}
+	if c.postgresPassword == "password" {
+		problems = append(problems, Problem{SeverityWarning, "PG_PASSWORD", "not set, using the default password"})
+	}
+	if host, _, err := net.SplitHostPort(c.RedisHost); err != nil {
+		problems = append(problems, Problem{SeverityError, "REDIS_HOST", fmt.Sprintf("%q is not a host:port", c.RedisHost)})
+	} else if isLoopback(host) {
+		problems = append(problems, Problem{SeverityWarning, "REDIS_HOST", "Redis is on localhost, replicas on other hosts can't share calls through it"})
+	}
+
+	if c.EnableEmail {
+		if c.SMTPHost == "" {
+			problems = append(problems, Problem{SeverityError, "SMTP_HOST", "required when ENABLE_EMAIL is set"})
+		}
+		if c.SMTPPort == 0 {
+			problems = append(problems, Problem{SeverityError, "SMTP_PORT", "required when ENABLE_EMAIL is set"})
+		}
+		if c.SMTPFrom == "" {
+			problems = append(problems, Problem{SeverityError, "SMTP_FROM", "required when ENABLE_EMAIL is set"})
+		}
+		if c.SMTPAuthMethod != "PLAIN" && c.SMTPAuthMethod != "LOGIN" {
+			problems = append(problems, Problem{SeverityError, "SMTP_AUTH_METHOD", "must be PLAIN or LOGIN when ENABLE_EMAIL is set"})
+		}
+		if c.CanonicalHost == "localhost" {
+			problems = append(problems, Problem{SeverityWarning, "CANONICAL_HOST", "not set, links in emails point at localhost"})
+		}
+	}
+
+	if provider := os.Getenv("CAPTCHA_PROVIDER"); provider != "" && c.CaptchaProvider == "" {
+		problems = append(problems, Problem{SeverityWarning, "CAPTCHA_PROVIDER", fmt.Sprintf("%q is unknown or missing its site key or secret, registration CAPTCHAs are disabled", provider)})
+	}
+	policies := []struct {
+		setting string
+		policy  CORSPolicy
+	}{{"CORS_HOSTS", c.CORS}, {"ADMIN_CORS_HOSTS", c.AdminCORS}}
+	for _, p := range policies {
+		for _, origin := range p.policy.Origins {
+			if origin == "*" && p.policy.AllowCredentials {
+				problems = append(problems, Problem{SeverityError, p.setting, "a wildcard origin can't be used with credentials, list the frontend origins instead"})
+			}
+		}
+	}
+	if len(c.M17Bridges) > 0 && !m17CallsignRegex.MatchString(c.M17Callsign) {
+		problems = append(problems, Problem{SeverityError, "M17_CALLSIGN", "must be a callsign of up to 9 letters, digits, or - / . when M17_BRIDGES is set"})
+	}
+	if c.Debug {
+		problems = append(problems, Problem{SeverityWarning, "DEBUG", "debug mode logs the configuration and shouldn't be used in production"})
+	}
+	if c.EnablePacketInjection {
+		problems = append(problems, Problem{SeverityWarning, "ENABLE_PACKET_INJECTION", "admins can send arbitrary traffic into the network"})
+	}
+	if c.EnableProfiling {
+		problems = append(problems, Problem{SeverityWarning, "ENABLE_PROFILING", "pprof endpoints are exposed"})
+	}
+	if slices.Contains(c.FeatureFlags, "voice_watermark") && c.WatermarkSecret == "" {
+		problems = append(problems, Problem{SeverityWarning, "WATERMARK_SECRET", "not set, voice_watermark has no key and voice is sent unmarked"})
+	}
+	return problems
+}
+
+// networkProblems finds named networks that no DMR socket listens on, whose repeaters and peers could never connect
+func (c Config) networkProblems() []Problem {
+	problems := []Problem{}
+	names := make([]string, 0, len(c.Networks))
+	for name := range c.Networks {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		found := false
+		for _, addr := range slices.Concat(c.HBRPListen, c.OpenBridgeListen) {
+			host, _, err := net.SplitHostPort(addr)
+			if err == nil && c.Networks[name].Equal(net.ParseIP(host)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, Problem{SeverityWarning, "NETWORKS", fmt.Sprintf("no HBRP_LISTEN or OPENBRIDGE_LISTEN address is on network %s (%s)", name, c.Networks[name])})
+		}
+	}
+	return problems
+}
+
+type listener struct {
+	setting string
+	network string
+	addr    string
+}
+
+// listenerProblems finds listeners of the same protocol that would fight over a port
+func (c Config) listenerProblems() []Problem {
+	listeners := []listener{}
+	add := func(setting string, network string, addrs []string) {
+		for _, addr := range addrs {
+			listeners = append(listeners, listener{setting: setting, network: network, addr: addr})
+		}
+	}
+	add("HBRP_LISTEN", "udp", c.HBRPListen)
+	add("OPENBRIDGE_LISTEN", "udp", c.OpenBridgeListen)
+	add("HTTP_LISTEN", "tcp", c.HTTPListen)
+	add("ADMIN_HTTP_LISTEN", "tcp", c.AdminHTTPListen)
+	if c.MetricsPort != 0 {
+		add("METRICS_PORT", "tcp", []string{net.JoinHostPort("", strconv.Itoa(c.MetricsPort))})
+	}
+
+	problems := []Problem{}
+	for i, a := range listeners {
+		for _, b := range listeners[i+1:] {
+			if a.network == b.network && listenersOverlap(a.addr, b.addr) {
+				problems = append(problems, Problem{SeverityError, b.setting, fmt.Sprintf("%s collides with %s %s", b.addr, a.setting, a.addr)})
+			}
+		}
+	}
+	return problems
+}
+
+func listenersOverlap(a string, b string) bool {
+	hostA, portA, errA := net.SplitHostPort(a)
+	hostB, portB, errB := net.SplitHostPort(b)
+	if errA != nil || errB != nil || portA != portB {
+		return false
+	}
+	return hostA == hostB || isWildcard(hostA) || isWildcard(hostB)
+}
+
+func isWildcard(host string) bool {
+	return host == "" || host == "0.0.0.0" || host == "::"
+}
+
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
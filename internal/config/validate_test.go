@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func hasProblem(problems []Problem, severity Severity, setting string) bool {
+	for _, problem := range problems {
+		if problem.Severity == severity && problem.Setting == setting {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidateCrossFieldRules(t *testing.T) {
+	t.Setenv("SECRET", "")
+	t.Setenv("PASSWORD_SALT", "pepper")
+	t.Setenv("REDIS_HOST", "redis:6379")
+	t.Setenv("HTTP_LISTEN", "0.0.0.0:3005")
+	t.Setenv("ADMIN_HTTP_LISTEN", "127.0.0.1:3005")
+	t.Setenv("HBRP_LISTEN", "0.0.0.0:3005")
+	t.Setenv("ENABLE_EMAIL", "1")
+	t.Setenv("SMTP_HOST", "")
+	t.Setenv("SMTP_FROM", "hub@example.com")
+	problems := loadConfig().Validate()
+
+	if !hasProblem(problems, SeverityError, "SECRET") {
+		t.Error("Expected an error for the default SECRET")
+	}
+	if hasProblem(problems, SeverityError, "PASSWORD_SALT") {
+		t.Error("Expected no error for a set PASSWORD_SALT")
+	}
+	if !hasProblem(problems, SeverityError, "ADMIN_HTTP_LISTEN") {
+		t.Error("Expected the admin listener to collide with the wildcard HTTP listener")
+	}
+	if hasProblem(problems, SeverityError, "HBRP_LISTEN") {
+		t.Error("Expected UDP and TCP listeners on the same port not to collide")
+	}
+	if !hasProblem(problems, SeverityError, "SMTP_HOST") {
+		t.Error("Expected an error for email without SMTP_HOST")
+	}
+	if hasProblem(problems, SeverityError, "SMTP_FROM") {
+		t.Error("Expected no error for a set SMTP_FROM")
+	}
+	if hasProblem(problems, SeverityWarning, "REDIS_HOST") {
+		t.Error("Expected no warning for a remote Redis")
+	}
+}
+
+func TestValidateSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "SECRET"), []byte("s3cret"), 0o644); err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+	t.Setenv("SECRET", "")
+	t.Setenv(secretsDirEnv, dir)
+	t.Setenv("PASSWORD_SALT_FILE", filepath.Join(dir, "missing"))
+
+	problems := ValidateSecrets()
+	if !hasProblem(problems, SeverityWarning, secretsDirEnv) {
+		t.Errorf("Expected a warning for a world-readable secret, got %+v", problems)
+	}
+	if !hasProblem(problems, SeverityError, "PASSWORD_SALT_FILE") {
+		t.Errorf("Expected an error for a missing secret file, got %+v", problems)
+	}
+	for _, problem := range problems {
+		if strings.Contains(problem.Message, "s3cret") {
+			t.Errorf("Expected secret values to stay out of the report, got %q", problem.Message)
+		}
+	}
+}
+
+func TestValidateNetworks(t *testing.T) {
+	t.Setenv("HBRP_LISTEN", "203.0.113.5:62031,10.8.0.1:62031")
+	t.Setenv("NETWORKS", "wg0=10.8.0.1,bogus,lan=192.168.1.10")
+	config := loadConfig()
+	if len(config.Networks) != 2 {
+		t.Fatalf("Expected the malformed entry to be ignored, got %v", config.Networks)
+	}
+	problems := config.networkProblems()
+	if len(problems) != 1 || !strings.Contains(problems[0].Message, "lan") {
+		t.Errorf("Expected a warning for the network nothing listens on, got %+v", problems)
+	}
+}
+
+func TestValidateM17Bridges(t *testing.T) {
+	t.Setenv("M17_BRIDGES", "31700=m17.example.org:17000/a, 3100=[2001:db8::1]:17000/B,9=no-port/C,10=host:17000/AB,x=host:17000/C")
+	t.Setenv("M17_CALLSIGN", "")
+	config := loadConfig()
+
+	want := []M17Bridge{
+		{Talkgroup: 31700, Reflector: "m17.example.org:17000", Module: 'A'},
+		{Talkgroup: 3100, Reflector: "[2001:db8::1]:17000", Module: 'B'},
+	}
+	if len(config.M17Bridges) != len(want) {
+		t.Fatalf("Expected the two valid bridges, got %+v", config.M17Bridges)
+	}
+	for i := range want {
+		if config.M17Bridges[i] != want[i] {
+			t.Errorf("Expected %+v, got %+v", want[i], config.M17Bridges[i])
+		}
+	}
+	if !hasProblem(config.Validate(), SeverityError, "M17_CALLSIGN") {
+		t.Error("Expected an error for bridges without an M17_CALLSIGN")
+	}
+
+	t.Setenv("M17_CALLSIGN", "ki5vmf h")
+	if hasProblem(loadConfig().Validate(), SeverityError, "M17_CALLSIGN") {
+		t.Error("Expected no error for a valid M17_CALLSIGN")
+	}
+}
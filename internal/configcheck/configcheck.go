@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package configcheck implements the `dmrhub config validate` subcommand, which
+// lints a deployment's configuration without starting the hub.
+package configcheck
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+)
+
+const usage = "Usage: dmrhub config validate [--json] [--strict]"
+
+// Report is the result of a validation, as printed in JSON output mode
+type Report struct {
+	Problems []config.Problem `json:"problems"`
+	Errors   int              `json:"errors"`
+	Warnings int              `json:"warnings"`
+}
+
+// Run parses the subcommand arguments and validates the configuration in the environment.
+// It exits non-zero when there are errors, or warnings with --strict, so it can gate CI.
+func Run(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "validate" {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+	flags := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	jsonOutput := flags.Bool("json", false, "Print the report as JSON")
+	strict := flags.Bool("strict", false, "Fail on warnings as well as errors")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	report := Validate()
+	if *jsonOutput {
+		encoded, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Fprintf(stderr, "Failed to encode report: %v\n", err)
+			return 1
+		}
+		fmt.Fprintln(stdout, string(encoded))
+	} else {
+		Print(stdout, report)
+	}
+
+	if report.Errors > 0 || (*strict && report.Warnings > 0) {
+		return 1
+	}
+	return 0
+}
+
+// Validate checks secret files, then loads and checks the rest of the config.
+// Loading is skipped if a secret file is broken, since loading would exit.
+func Validate() Report {
+	report := Report{Problems: config.ValidateSecrets()}
+	count(&report)
+	if report.Errors == 0 {
+		report.Problems = append(report.Problems, config.GetConfig().Validate()...)
+		count(&report)
+	}
+	return report
+}
+
+func count(report *Report) {
+	report.Errors, report.Warnings = 0, 0
+	for _, problem := range report.Problems {
+		switch problem.Severity {
+		case config.SeverityError:
+			report.Errors++
+		case config.SeverityWarning:
+			report.Warnings++
+		}
+	}
+}
+
+// Print writes a report one problem per line, followed by a summary
+func Print(out io.Writer, report Report) {
+	for _, problem := range report.Problems {
+		fmt.Fprintf(out, "%-7s %s: %s\n", problem.Severity, problem.Setting, problem.Message)
+	}
+	if len(report.Problems) == 0 {
+		fmt.Fprintln(out, "Configuration is valid")
+		return
+	}
+	fmt.Fprintf(out, "%d errors, %d warnings\n", report.Errors, report.Warnings)
+}
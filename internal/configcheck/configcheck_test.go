@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package configcheck_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/configcheck"
+)
+
+func TestRunUsage(t *testing.T) {
+	t.Parallel()
+	var stdout, stderr bytes.Buffer
+	if code := configcheck.Run([]string{"lint"}, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected exit code 2 for an unknown subcommand, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "config validate") {
+		t.Errorf("Expected usage on stderr, got %q", stderr.String())
+	}
+}
+
+func TestPrint(t *testing.T) {
+	t.Parallel()
+	var out bytes.Buffer
+	configcheck.Print(&out, configcheck.Report{
+		Problems: []config.Problem{
+			{Severity: config.SeverityError, Setting: "SMTP_HOST", Message: "required when ENABLE_EMAIL is set"},
+			{Severity: config.SeverityWarning, Setting: "DEBUG", Message: "debug mode"},
+		},
+		Errors:   1,
+		Warnings: 1,
+	})
+	want := "error   SMTP_HOST: required when ENABLE_EMAIL is set\nwarning DEBUG: debug mode\n1 errors, 1 warnings\n"
+	if out.String() != want {
+		t.Errorf("Unexpected report:\n%s", out.String())
+	}
+
+	out.Reset()
+	configcheck.Print(&out, configcheck.Report{})
+	if out.String() != "Configuration is valid\n" {
+		t.Errorf("Unexpected report for no problems: %q", out.String())
+	}
+}
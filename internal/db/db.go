@@ -59,18 +59,30 @@ func MakeDB() *gorm.DB {
 		}
 	}
 
+	err = Instrument(db, config.GetConfig().SlowQueryThreshold)
+	if err != nil {
+		logging.Errorf("Could not instrument database: %s", err)
+		os.Exit(1)
+	}
+
 	err = migration.Migrate(db)
 	if err != nil {
 		logging.Errorf("Could not migrate database: %v", err)
 		os.Exit(1)
 	}
 
-	err = db.AutoMigrate(&models.AppSettings{}, &models.Call{}, &models.Peer{}, &models.PeerRule{}, &models.Repeater{}, &models.Talkgroup{}, &models.User{})
+	err = db.AutoMigrate(&models.AirtimeRollup{}, &models.AppSettings{}, &models.ArchiveRecord{}, &models.AudioTest{}, &models.CalloutGroup{}, &models.Call{}, &models.CallTelemetry{}, &models.ConfigVersion{}, &models.DeferredData{}, &models.DigestSubscription{}, &models.FeatureFlag{}, &models.HubEvent{}, &models.Incident{}, &models.InstanceSettings{}, &models.Job{}, &models.MissedCall{}, &models.NotificationPreferences{}, &models.Peer{}, &models.PeerRule{}, &models.Repeater{}, &models.RepeaterGroup{}, &models.RepeaterLink{}, &models.RepeaterPermission{}, &models.RepeaterSession{}, &models.RepeaterTemplate{}, &models.Talkgroup{}, &models.TalkgroupAllowedRepeater{}, &models.TalkgroupCategory{}, &models.TalkgroupProfile{}, &models.TalkgroupQuota{}, &models.Tombstone{}, &models.TXInhibit{}, &models.User{})
 	if err != nil {
 		logging.Errorf("Could not migrate database: %s", err)
 		os.Exit(1)
 	}
 
+	err = models.ProtectArchiveRecords(db)
+	if err != nil {
+		logging.Errorf("Could not protect the archive table: %s", err)
+		os.Exit(1)
+	}
+
 	// Grab the first (and only) AppSettings record. If that record doesn't exist, create it.
 	var appSettings models.AppSettings
 	result := db.First(&appSettings)
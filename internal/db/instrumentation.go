@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package db
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+)
+
+const (
+	queryStartKey = "dmrhub:query_start"
+	// Deep enough to get out of gorm's callback chain and the models package
+	maxCallerDepth = 32
+)
+
+//nolint:golint,gochecknoglobals
+var (
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dmrhub_db_query_duration_seconds",
+		Help:    "Database query latency, by operation and the function outside the models package that issued it",
+		Buckets: []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+	}, []string{"operation", "caller"})
+	slowQueries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dmrhub_db_slow_queries_total",
+		Help: "Database queries slower than SLOW_QUERY_MS, by the function that issued them",
+	}, []string{"caller"})
+
+	// Frames in gorm, the models package and our own callbacks are skipped when looking for a query's call site
+	queryInternalPackages = []string{
+		"gorm.io/",
+		"github.com/USA-RedDragon/DMRHub/internal/db.Instrument",
+		"github.com/USA-RedDragon/DMRHub/internal/db/models.",
+		"github.com/uptrace/opentelemetry-go-extra/otelgorm.",
+	}
+)
+
+// Instrument records the latency of every query against the call site that
+// issued it, and logs queries slower than slowThreshold. Slow queries are logged
+// with their placeholders rather than bound parameters, which can hold
+// passwords and personal data. A zero slowThreshold disables the log.
+func Instrument(db *gorm.DB, slowThreshold time.Duration) error {
+	before := func(tx *gorm.DB) {
+		tx.InstanceSet(queryStartKey, time.Now())
+	}
+	after := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			observeQuery(tx, operation, slowThreshold)
+		}
+	}
+
+	callbacks := db.Callback()
+	errs := []error{
+		callbacks.Create().Before("gorm:create").Register("instrumentation:before_create", before),
+		callbacks.Create().After("gorm:create").Register("instrumentation:after_create", after("create")),
+		callbacks.Query().Before("gorm:query").Register("instrumentation:before_query", before),
+		callbacks.Query().After("gorm:query").Register("instrumentation:after_query", after("query")),
+		callbacks.Update().Before("gorm:update").Register("instrumentation:before_update", before),
+		callbacks.Update().After("gorm:update").Register("instrumentation:after_update", after("update")),
+		callbacks.Delete().Before("gorm:delete").Register("instrumentation:before_delete", before),
+		callbacks.Delete().After("gorm:delete").Register("instrumentation:after_delete", after("delete")),
+		callbacks.Row().Before("gorm:row").Register("instrumentation:before_row", before),
+		callbacks.Row().After("gorm:row").Register("instrumentation:after_row", after("row")),
+		callbacks.Raw().Before("gorm:raw").Register("instrumentation:before_raw", before),
+		callbacks.Raw().After("gorm:raw").Register("instrumentation:after_raw", after("raw")),
+	}
+	return errors.Join(errs...)
+}
+
+func observeQuery(tx *gorm.DB, operation string, slowThreshold time.Duration) {
+	value, ok := tx.InstanceGet(queryStartKey)
+	if !ok {
+		return
+	}
+	start, ok := value.(time.Time)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(start)
+	caller := queryCaller()
+	queryDuration.WithLabelValues(operation, caller).Observe(elapsed.Seconds())
+
+	if slowThreshold <= 0 || elapsed < slowThreshold {
+		return
+	}
+	slowQueries.WithLabelValues(caller).Inc()
+	logging.Errorf("Slow %s query (%s) from %s: %s [%d parameters redacted]",
+		operation, elapsed.Round(time.Millisecond), caller, tx.Statement.SQL.String(), len(tx.Statement.Vars))
+}
+
+// queryCaller names the first function on the stack outside gorm and the
+// database packages, such as an API controller or a packet handler
+func queryCaller() string {
+	pcs := make([]uintptr, maxCallerDepth)
+	n := runtime.Callers(3, pcs) //nolint:golint,gomnd // skip runtime.Callers, queryCaller and observeQuery
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if frame.Function != "" && !isQueryInternal(frame.Function) {
+			return shortFunctionName(frame.Function)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+func isQueryInternal(function string) bool {
+	for _, prefix := range queryInternalPackages {
+		if strings.HasPrefix(function, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// shortFunctionName drops the import path, leaving e.g. hbrp.(*Server).handlePacket
+func shortFunctionName(function string) string {
+	if i := strings.LastIndex(function, "/"); i >= 0 {
+		return function[i+1:]
+	}
+	return function
+}
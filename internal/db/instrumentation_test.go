@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package db
+
+import (
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/glebarez/sqlite"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gorm.io/gorm"
+)
+
+func TestInstrumentAttributesQueriesToCaller(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.AutoMigrate(&models.Talkgroup{})
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	// Every query is slow with a 1ns threshold
+	err = Instrument(db, 1)
+	if err != nil {
+		t.Fatalf("Failed to instrument database: %v", err)
+	}
+
+	const caller = "db.TestInstrumentAttributesQueriesToCaller"
+	_, err = models.ListTalkgroups(db)
+	if err != nil {
+		t.Fatalf("Failed to list talkgroups: %v", err)
+	}
+	if got := testutil.ToFloat64(slowQueries.WithLabelValues(caller)); got != 1 {
+		t.Errorf("Expected the query to be attributed to %s past the models package, got %v slow queries", caller, got)
+	}
+	if got := testutil.CollectAndCount(queryDuration); got == 0 {
+		t.Error("Expected query latency to be recorded")
+	}
+}
+
+func TestShortFunctionName(t *testing.T) {
+	t.Parallel()
+	got := shortFunctionName("github.com/USA-RedDragon/DMRHub/internal/dmr/servers/hbrp.(*Server).handlePacket")
+	if got != "hbrp.(*Server).handlePacket" {
+		t.Errorf("Expected the import path to be dropped, got %s", got)
+	}
+	if !isQueryInternal("github.com/USA-RedDragon/DMRHub/internal/db/models.ListTalkgroups") {
+		t.Error("Expected the models package to be skipped")
+	}
+	if isQueryInternal("github.com/USA-RedDragon/DMRHub/internal/db/writebehind.(*Writer).Flush") {
+		t.Error("Expected the write-behind queue to count as a call site")
+	}
+}
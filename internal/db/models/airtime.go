@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AirtimeRollup is the transmit time of one user through one repeater to one talkgroup over a UTC day.
+// Private calls are rolled up with a zero TalkgroupID.
+type AirtimeRollup struct {
+	Day         time.Time     `json:"day" gorm:"primaryKey"`
+	UserID      uint          `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	TalkgroupID uint          `json:"talkgroup_id" gorm:"primaryKey;autoIncrement:false"`
+	RepeaterID  uint          `json:"repeater_id" gorm:"primaryKey;autoIncrement:false"`
+	Calls       uint          `json:"calls"`
+	Duration    time.Duration `json:"duration"`
+}
+
+// AirtimeGroup selects the column that airtime reports are totalled by
+type AirtimeGroup string
+
+const (
+	AirtimeByUser      AirtimeGroup = "user"
+	AirtimeByTalkgroup AirtimeGroup = "talkgroup"
+	AirtimeByRepeater  AirtimeGroup = "repeater"
+)
+
+func (g AirtimeGroup) column() (string, bool) {
+	switch g {
+	case AirtimeByUser:
+		return "user_id", true
+	case AirtimeByTalkgroup:
+		return "talkgroup_id", true
+	case AirtimeByRepeater:
+		return "repeater_id", true
+	default:
+		return "", false
+	}
+}
+
+// AirtimeTotal is the transmit time of one user, talkgroup, or repeater over a report window
+type AirtimeTotal struct {
+	ID       uint          `json:"id"`
+	Calls    uint          `json:"calls"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Seconds is the total in whole seconds, as shown in reports
+func (t AirtimeTotal) Seconds() int64 {
+	return int64(t.Duration.Seconds())
+}
+
+// RollupAirtime replaces the rollups for the UTC day containing when with totals from the calls table.
+// It can be run repeatedly for the same day, which keeps the current day up to date.
+func RollupAirtime(db *gorm.DB, when time.Time) error {
+	start := when.UTC().Truncate(day)
+	end := start.Add(day)
+	return db.Transaction(func(tx *gorm.DB) error {
+		var rollups []AirtimeRollup
+		err := tx.Model(&Call{}).
+			Select("user_id, repeater_id, COALESCE(to_talkgroup_id, 0) AS talkgroup_id, COUNT(*) AS calls, SUM(duration) AS duration").
+			Where("active = ? AND start_time >= ? AND start_time < ?", false, start, end).
+			Group("user_id, repeater_id, COALESCE(to_talkgroup_id, 0)").
+			Scan(&rollups).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("day = ?", start).Delete(&AirtimeRollup{}).Error
+		if err != nil {
+			return err
+		}
+		if len(rollups) == 0 {
+			return nil
+		}
+		for i := range rollups {
+			rollups[i].Day = start
+		}
+		const batchSize = 500
+		return tx.CreateInBatches(&rollups, batchSize).Error
+	})
+}
+
+// VisibleAirtime scopes a rollup query to airtime on talkgroups a user may see.
+// An anonymous visitor is the zero User.
+func VisibleAirtime(db *gorm.DB, user User) *gorm.DB {
+	if user.Admin {
+		return db
+	}
+	return db.Where("airtime_rollups.talkgroup_id NOT IN (?)", HiddenTalkgroups(db, user))
+}
+
+// ListAirtimeTotals totals the rollups between from and to by user, talkgroup, or repeater,
+// busiest first. A zero limit returns every total.
+func ListAirtimeTotals(db *gorm.DB, group AirtimeGroup, from, to time.Time, limit int) ([]AirtimeTotal, error) {
+	column, ok := group.column()
+	if !ok {
+		return nil, gorm.ErrInvalidField
+	}
+	query := db.Model(&AirtimeRollup{}).
+		Select(column+" AS id, SUM(calls) AS calls, SUM(duration) AS duration").
+		Where("day >= ? AND day < ?", from.UTC().Truncate(day), to.UTC()).
+		Group(column).
+		Order("duration DESC, id ASC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var totals []AirtimeTotal
+	err := query.Scan(&totals).Error
+	return totals, err
+}
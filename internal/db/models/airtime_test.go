@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func TestRollupAirtime(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.AirtimeRollup{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	day := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	tg := uint(91)
+	calls := []models.Call{
+		{UserID: 3110001, RepeaterID: 311001, IsToTalkgroup: true, ToTalkgroupID: &tg, StartTime: day.Add(time.Hour), Duration: 10 * time.Second},
+		{UserID: 3110001, RepeaterID: 311001, IsToTalkgroup: true, ToTalkgroupID: &tg, StartTime: day.Add(2 * time.Hour), Duration: 20 * time.Second},
+		{UserID: 3110002, RepeaterID: 311001, IsToUser: true, StartTime: day.Add(3 * time.Hour), Duration: 5 * time.Second},
+		// Still on the air
+		{UserID: 3110002, RepeaterID: 311001, IsToTalkgroup: true, ToTalkgroupID: &tg, StartTime: day.Add(4 * time.Hour), Active: true, Duration: time.Second},
+		// The next day
+		{UserID: 3110002, RepeaterID: 311002, IsToTalkgroup: true, ToTalkgroupID: &tg, StartTime: day.Add(25 * time.Hour), Duration: 60 * time.Second},
+	}
+	if err := db.Create(&calls).Error; err != nil {
+		t.Fatalf("Failed to create calls: %v", err)
+	}
+
+	// Rolling up twice must not double count
+	for range 2 {
+		if err := models.RollupAirtime(db, day.Add(12*time.Hour)); err != nil {
+			t.Fatalf("Failed to roll up airtime: %v", err)
+		}
+	}
+	if err := models.RollupAirtime(db, day.Add(36*time.Hour)); err != nil {
+		t.Fatalf("Failed to roll up airtime: %v", err)
+	}
+
+	totals, err := models.ListAirtimeTotals(db, models.AirtimeByUser, day, day.Add(24*time.Hour), 0)
+	if err != nil {
+		t.Fatalf("Failed to list totals: %v", err)
+	}
+	if len(totals) != 2 || totals[0].ID != 3110001 || totals[0].Seconds() != 30 || totals[0].Calls != 2 || totals[1].Seconds() != 5 {
+		t.Errorf("Unexpected first day totals: %+v", totals)
+	}
+
+	totals, err = models.ListAirtimeTotals(db, models.AirtimeByTalkgroup, day, day.Add(48*time.Hour), 1)
+	if err != nil {
+		t.Fatalf("Failed to list totals: %v", err)
+	}
+	if len(totals) != 1 || totals[0].ID != tg || totals[0].Seconds() != 90 {
+		t.Errorf("Expected the talkgroup to lead with 90 seconds, got %+v", totals)
+	}
+
+	if _, err := models.ListAirtimeTotals(db, "callsign", day, day, 0); err == nil {
+		t.Error("Expected an unknown grouping to be rejected")
+	}
+}
+
+func TestVisibleAirtime(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.AirtimeRollup{}, &models.TalkgroupAllowedRepeater{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	day := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	db.Create(&models.Talkgroup{ID: 91})
+	db.Create(&models.Talkgroup{ID: 31665, Private: true})
+	db.Create(&[]models.AirtimeRollup{
+		{Day: day, UserID: 3110001, TalkgroupID: 91, RepeaterID: 311001, Calls: 1, Duration: 10 * time.Second},
+		{Day: day, UserID: 3110001, TalkgroupID: 31665, RepeaterID: 311001, Calls: 1, Duration: time.Minute},
+		// Private calls
+		{Day: day, UserID: 3110001, TalkgroupID: 0, RepeaterID: 311001, Calls: 1, Duration: time.Second},
+	})
+
+	outsider := models.User{ID: 3110002, Callsign: "N0CALL", Username: "outsider", Approved: true}
+	totals, err := models.ListAirtimeTotals(models.VisibleAirtime(db, outsider), models.AirtimeByTalkgroup, day, day.Add(24*time.Hour), 0)
+	if err != nil {
+		t.Fatalf("Failed to list totals: %v", err)
+	}
+	for _, total := range totals {
+		if total.ID == 31665 {
+			t.Errorf("Expected the private talkgroup to be left off, got %+v", totals)
+		}
+	}
+	if len(totals) != 2 {
+		t.Errorf("Expected the public talkgroup and private calls, got %+v", totals)
+	}
+
+	totals, err = models.ListAirtimeTotals(models.VisibleAirtime(db, models.User{Admin: true}), models.AirtimeByTalkgroup, day, day.Add(24*time.Hour), 0)
+	if err != nil || len(totals) != 3 || totals[0].ID != 31665 {
+		t.Errorf("Expected admins to see the private talkgroup lead, got %+v err=%v", totals, err)
+	}
+}
@@ -0,0 +1,192 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ArchiveRecord is one routed burst on an archived talkgroup. Records are append-only and
+// chained per talkgroup: each hash covers the record and the hash of the one before it,
+// so editing, removing or reordering records breaks the chain.
+type ArchiveRecord struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	TalkgroupID uint      `json:"talkgroup_id" gorm:"index:idx_archive_talkgroup_time"`
+	ReceivedAt  time.Time `json:"received_at" gorm:"index:idx_archive_talkgroup_time"`
+	StreamID    uint      `json:"stream_id"`
+	Src         uint      `json:"src"`
+	RepeaterID  uint      `json:"repeater_id"`
+	Slot        bool      `json:"slot"`
+	FrameType   uint      `json:"frame_type"`
+	DTypeOrVSeq uint      `json:"dtype_or_vseq"`
+	Seq         uint      `json:"seq"`
+	Payload     []byte    `json:"payload,omitempty"`
+	PrevHash    string    `json:"prev_hash"`
+	Hash        string    `json:"hash"`
+}
+
+// NewArchiveRecord captures a packet for the archive. The payload is only kept when asked for.
+// The timestamp is truncated to what every supported database can store so the hash survives a round trip.
+func NewArchiveRecord(packet Packet, at time.Time, includePayload bool) ArchiveRecord {
+	record := ArchiveRecord{
+		TalkgroupID: packet.Dst,
+		ReceivedAt:  at.UTC().Truncate(time.Microsecond),
+		StreamID:    packet.StreamID,
+		Src:         packet.Src,
+		RepeaterID:  packet.Repeater,
+		Slot:        packet.Slot,
+		FrameType:   uint(packet.FrameType),
+		DTypeOrVSeq: packet.DTypeOrVSeq,
+		Seq:         packet.Seq,
+	}
+	if includePayload {
+		record.Payload = append([]byte(nil), packet.DMRData[:]...)
+	}
+	return record
+}
+
+// ComputeHash returns the hash of the record chained onto PrevHash
+func (r *ArchiveRecord) ComputeHash() string {
+	hash := sha256.New()
+	hash.Write([]byte(r.PrevHash))
+	var slot uint64
+	if r.Slot {
+		slot = 1
+	}
+	fields := []uint64{
+		uint64(r.TalkgroupID),
+		uint64(r.ReceivedAt.UnixNano()),
+		uint64(r.StreamID),
+		uint64(r.Src),
+		uint64(r.RepeaterID),
+		slot,
+		uint64(r.FrameType),
+		uint64(r.DTypeOrVSeq),
+		uint64(r.Seq),
+		uint64(len(r.Payload)),
+	}
+	buf := make([]byte, 8) //nolint:golint,mnd
+	for _, field := range fields {
+		binary.BigEndian.PutUint64(buf, field)
+		hash.Write(buf)
+	}
+	hash.Write(r.Payload)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Chain links the record onto prevHash and seals it
+func (r *ArchiveRecord) Chain(prevHash string) {
+	r.PrevHash = prevHash
+	r.Hash = r.ComputeHash()
+}
+
+// ProtectArchiveRecords installs triggers that reject updates and deletes on the archive table,
+// so records can't be changed through the application or a stray query
+func ProtectArchiveRecords(db *gorm.DB) error {
+	var statements []string
+	switch db.Dialector.Name() {
+	case "postgres":
+		statements = []string{
+			`CREATE OR REPLACE FUNCTION archive_records_immutable() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'archive records are append-only';
+END;
+$$ LANGUAGE plpgsql`,
+			`DROP TRIGGER IF EXISTS archive_records_immutable ON archive_records`,
+			`CREATE TRIGGER archive_records_immutable BEFORE UPDATE OR DELETE ON archive_records FOR EACH ROW EXECUTE FUNCTION archive_records_immutable()`,
+			`DROP TRIGGER IF EXISTS archive_records_no_truncate ON archive_records`,
+			`CREATE TRIGGER archive_records_no_truncate BEFORE TRUNCATE ON archive_records FOR EACH STATEMENT EXECUTE FUNCTION archive_records_immutable()`,
+		}
+	case "sqlite":
+		statements = []string{
+			`CREATE TRIGGER IF NOT EXISTS archive_records_no_update BEFORE UPDATE ON archive_records BEGIN SELECT RAISE(ABORT, 'archive records are append-only'); END`,
+			`CREATE TRIGGER IF NOT EXISTS archive_records_no_delete BEFORE DELETE ON archive_records BEGIN SELECT RAISE(ABORT, 'archive records are append-only'); END`,
+		}
+	default:
+		return fmt.Errorf("archive protection is not supported on %s", db.Dialector.Name())
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LastArchiveHash returns the hash at the head of a talkgroup's chain, or "" if nothing is archived yet
+func LastArchiveHash(db *gorm.DB, talkgroupID uint) (string, error) {
+	var records []ArchiveRecord
+	err := db.Where("talkgroup_id = ?", talkgroupID).Order("id desc").Limit(1).Find(&records).Error
+	if err != nil || len(records) == 0 {
+		return "", err
+	}
+	return records[0].Hash, nil
+}
+
+// ArchiveRecordsBetween selects a talkgroup's records received in [from, to), in chain order
+func ArchiveRecordsBetween(db *gorm.DB, talkgroupID uint, from, to time.Time) *gorm.DB {
+	return db.Model(&ArchiveRecord{}).
+		Where("talkgroup_id = ? AND received_at >= ? AND received_at < ?", talkgroupID, from.UTC(), to.UTC()).
+		Order("id asc")
+}
+
+// ArchiveVerification is the result of walking a talkgroup's chain
+type ArchiveVerification struct {
+	Checked  int   `json:"checked"`
+	Valid    bool  `json:"valid"`
+	BrokenAt *uint `json:"broken_at,omitempty"`
+}
+
+const archiveVerifyBatch = 1000
+
+var errArchiveBroken = errors.New("archive chain is broken")
+
+// VerifyArchive walks a talkgroup's whole chain from the first record and reports the first record
+// whose hash doesn't match its contents or whose link doesn't match the record before it
+func VerifyArchive(db *gorm.DB, talkgroupID uint) (ArchiveVerification, error) {
+	result := ArchiveVerification{Valid: true}
+	prevHash := ""
+	var batch []ArchiveRecord
+	err := db.Where("talkgroup_id = ?", talkgroupID).Order("id asc").FindInBatches(&batch, archiveVerifyBatch, func(_ *gorm.DB, _ int) error {
+		for i := range batch {
+			if batch[i].PrevHash != prevHash || batch[i].Hash != batch[i].ComputeHash() {
+				id := batch[i].ID
+				result.Valid = false
+				result.BrokenAt = &id
+				return errArchiveBroken
+			}
+			prevHash = batch[i].Hash
+			result.Checked++
+		}
+		return nil
+	}).Error
+	if err != nil && !errors.Is(err, errArchiveBroken) {
+		return result, err
+	}
+	return result, nil
+}
@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"gorm.io/gorm"
+)
+
+func makeArchiveDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.ArchiveRecord{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	if err := models.ProtectArchiveRecords(db); err != nil {
+		t.Fatalf("Failed to protect archive: %v", err)
+	}
+	return db
+}
+
+func appendArchive(t *testing.T, db *gorm.DB, talkgroupID uint, count int) {
+	t.Helper()
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 123456789, time.UTC)
+	for i := 0; i < count; i++ {
+		head, err := models.LastArchiveHash(db, talkgroupID)
+		if err != nil {
+			t.Fatalf("Failed to find head: %v", err)
+		}
+		packet := models.Packet{Dst: talkgroupID, Src: 3191868, StreamID: 42, Seq: uint(i)}
+		record := models.NewArchiveRecord(packet, start.Add(time.Duration(i)*60*time.Millisecond), i%2 == 0)
+		record.Chain(head)
+		if err := db.Create(&record).Error; err != nil {
+			t.Fatalf("Failed to append record: %v", err)
+		}
+	}
+}
+
+func TestArchiveChainVerifies(t *testing.T) {
+	t.Parallel()
+	db := makeArchiveDB(t)
+	appendArchive(t, db, 1, 5)
+	appendArchive(t, db, 2, 3)
+
+	result, err := models.VerifyArchive(db, 1)
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if !result.Valid || result.Checked != 5 {
+		t.Errorf("Expected 5 valid records, got %+v", result)
+	}
+}
+
+func TestArchiveRejectsChanges(t *testing.T) {
+	t.Parallel()
+	db := makeArchiveDB(t)
+	appendArchive(t, db, 1, 2)
+
+	if err := db.Model(&models.ArchiveRecord{}).Where("id = ?", 1).Update("src", 1).Error; err == nil {
+		t.Error("Expected updating an archive record to fail")
+	}
+	if err := db.Where("id = ?", 1).Delete(&models.ArchiveRecord{}).Error; err == nil {
+		t.Error("Expected deleting an archive record to fail")
+	}
+}
+
+func TestArchiveDetectsForgedRecord(t *testing.T) {
+	t.Parallel()
+	db := makeArchiveDB(t)
+	appendArchive(t, db, 1, 2)
+
+	// Appended with a valid hash but not linked to the previous record
+	forged := models.NewArchiveRecord(models.Packet{Dst: 1, Src: 1}, time.Now(), false)
+	forged.Chain("")
+	if err := db.Create(&forged).Error; err != nil {
+		t.Fatalf("Failed to append record: %v", err)
+	}
+	appendArchive(t, db, 1, 1)
+
+	result, err := models.VerifyArchive(db, 1)
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if result.Valid || result.BrokenAt == nil || *result.BrokenAt != forged.ID || result.Checked != 2 {
+		t.Errorf("Expected the chain to break at record %d, got %+v", forged.ID, result)
+	}
+}
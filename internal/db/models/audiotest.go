@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// maxAudioTestsPerUser bounds how many audio test results are kept for each user
+const maxAudioTestsPerUser = 50
+
+// AudioTest is the link quality measured while a user transmitted to the audio test talkgroup
+type AudioTest struct {
+	ID         uint          `json:"id" gorm:"primaryKey"`
+	UserID     uint          `json:"-" gorm:"index"`
+	RepeaterID uint          `json:"repeater_id"`
+	StreamID   uint          `json:"-"`
+	TimeSlot   bool          `json:"time_slot"`
+	StartedAt  time.Time     `json:"started_at"`
+	Duration   time.Duration `json:"duration"`
+	Packets    uint          `json:"packets"`
+	Lost       uint          `json:"lost"`
+	Loss       float32       `json:"loss"`
+	BER        float32       `json:"ber"`
+	Jitter     float32       `json:"jitter"`
+	RSSI       float32       `json:"rssi"`
+	CreatedAt  time.Time     `json:"created_at"`
+}
+
+// Summary is a one line report of the test, short enough for a hotspot display
+func (t AudioTest) Summary() string {
+	const pct = 100
+	summary := fmt.Sprintf("Test %.1fs BER %.2f%% Loss %.1f%% Jitter %.0fms", t.Duration.Seconds(), t.BER*pct, t.Loss*pct, t.Jitter)
+	if t.RSSI > 0 {
+		summary += fmt.Sprintf(" RSSI -%.0fdBm", t.RSSI)
+	}
+	return summary
+}
+
+// CreateAudioTest saves a test result, dropping the user's oldest results beyond the most recent few
+func CreateAudioTest(db *gorm.DB, test *AudioTest) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(test).Error
+		if err != nil {
+			return err
+		}
+		var keep []uint
+		err = tx.Model(&AudioTest{}).Where("user_id = ?", test.UserID).Order("id desc").Limit(maxAudioTestsPerUser).Pluck("id", &keep).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ? AND id NOT IN ?", test.UserID, keep).Delete(&AudioTest{}).Error
+	})
+}
+
+func ListAudioTests(db *gorm.DB, userID uint) ([]AudioTest, error) {
+	var tests []AudioTest
+	err := db.Where("user_id = ?", userID).Order("id desc").Find(&tests).Error
+	return tests, err
+}
+
+func CountAudioTests(db *gorm.DB, userID uint) (int, error) {
+	var count int64
+	err := db.Model(&AudioTest{}).Where("user_id = ?", userID).Count(&count).Error
+	return int(count), err
+}
+
+func DeleteAudioTestsForUser(db *gorm.DB, userID uint) error {
+	return db.Where("user_id = ?", userID).Delete(&AudioTest{}).Error
+}
@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func TestCreateAudioTestKeepsRecentResults(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	for i := range 55 {
+		if err := models.CreateAudioTest(db, &models.AudioTest{UserID: 3110001, StreamID: uint(i)}); err != nil {
+			t.Fatalf("Failed to save audio test: %v", err)
+		}
+	}
+	if err := models.CreateAudioTest(db, &models.AudioTest{UserID: 3110002}); err != nil {
+		t.Fatalf("Failed to save audio test: %v", err)
+	}
+
+	tests, err := models.ListAudioTests(db, 3110001)
+	if err != nil {
+		t.Fatalf("Failed to list audio tests: %v", err)
+	}
+	if len(tests) != 50 || tests[0].StreamID != 54 || tests[49].StreamID != 5 {
+		t.Errorf("Expected the 50 newest results, got %d", len(tests))
+	}
+	if count, _ := models.CountAudioTests(db, 3110002); count != 1 {
+		t.Errorf("Expected other users' results to be kept, got %d", count)
+	}
+}
+
+func TestAudioTestSummary(t *testing.T) {
+	t.Parallel()
+	test := models.AudioTest{Duration: 4200 * time.Millisecond, BER: 0.0123, Loss: 0.02, Jitter: 3.4, RSSI: 87}
+	if summary := test.Summary(); summary != "Test 4.2s BER 1.23% Loss 2.0% Jitter 3ms RSSI -87dBm" {
+		t.Errorf("Unexpected summary %q", summary)
+	}
+}
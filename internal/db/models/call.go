@@ -61,6 +61,9 @@ type Call struct {
 	LastPacketTime time.Time      `json:"-"`
 	HasHeader      bool           `json:"-"`
 	HasTerm        bool           `json:"-"`
+	Truncated      bool           `json:"truncated"`
+	ConversationID uint           `json:"conversation_id" gorm:"index"`
+	Transmissions  uint           `json:"transmissions,omitempty" gorm:"-"`
 	CreatedAt      time.Time      `json:"-"`
 	UpdatedAt      time.Time      `json:"-"`
 	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
@@ -121,6 +124,61 @@ func CountTalkgroupCalls(db *gorm.DB, talkgroupID uint) int {
 	return int(count)
 }
 
+// ConversationHeads scopes a call query down to the first transmission of each conversation.
+// Calls recorded before conversations were tracked have no conversation and stand on their own.
+func ConversationHeads(db *gorm.DB) *gorm.DB {
+	return db.Where("conversation_id = id OR conversation_id = 0")
+}
+
+// AggregateConversations fills in each conversation head with the total duration
+// and number of transmissions in its conversation.
+func AggregateConversations(db *gorm.DB, calls []Call) ([]Call, error) {
+	ids := make([]uint, 0, len(calls))
+	for _, call := range calls {
+		if call.ConversationID != 0 {
+			ids = append(ids, call.ConversationID)
+		}
+	}
+
+	type conversationTotals struct {
+		ConversationID uint
+		Transmissions  uint
+		Duration       int64
+	}
+	var totals []conversationTotals
+	if len(ids) > 0 {
+		err := db.Model(&Call{}).Select("conversation_id, COUNT(*) AS transmissions, COALESCE(SUM(duration), 0) AS duration").
+			Where("conversation_id IN ?", ids).Group("conversation_id").Scan(&totals).Error
+		if err != nil {
+			return calls, err //nolint:golint,wrapcheck
+		}
+	}
+
+	byID := make(map[uint]conversationTotals, len(totals))
+	for _, t := range totals {
+		byID[t.ConversationID] = t
+	}
+	for i := range calls {
+		calls[i].Transmissions = 1
+		if t, ok := byID[calls[i].ConversationID]; ok {
+			calls[i].Transmissions = t.Transmissions
+			calls[i].Duration = time.Duration(t.Duration)
+		}
+	}
+	return calls, nil
+}
+
+// FindLastCompletedCall finds the most recent finished call from a user to a destination
+func FindLastCompletedCall(db *gorm.DB, userID uint, dst uint, groupCall bool) (Call, bool) {
+	var calls []Call
+	db.Where("user_id = ? AND destination_id = ? AND group_call = ? AND active = ?", userID, dst, groupCall, false).
+		Order("start_time desc").Limit(1).Find(&calls)
+	if len(calls) == 0 {
+		return Call{}, false
+	}
+	return calls[0], true
+}
+
 func FindActiveCall(db *gorm.DB, streamID uint, src uint, dst uint, slot bool, groupCall bool) (Call, error) {
 	var call Call
 	err := db.Preload("User").Preload("Repeater").Preload("ToTalkgroup").Preload("ToUser").Preload("ToRepeater").Where("stream_id = ? AND active = ? AND user_id = ? AND destination_id = ? AND time_slot = ? AND group_call = ?", streamID, true, src, dst, slot, groupCall).First(&call).Error
@@ -135,3 +193,38 @@ func ActiveCallExists(db *gorm.DB, streamID uint, src uint, dst uint, slot bool,
 	db.Model(&Call{}).Where("stream_id = ? AND active = ? AND user_id = ? AND destination_id = ? AND time_slot = ? AND group_call = ?", streamID, true, src, dst, slot, groupCall).Count(&count)
 	return count > 0
 }
+
+// SumUserCalls counts a user's calls in a time range and totals their talk time
+func SumUserCalls(db *gorm.DB, userID uint, since time.Time, until time.Time) (int, time.Duration, error) {
+	var result struct {
+		Calls    int64
+		TalkTime int64
+	}
+	err := db.Model(&Call{}).Select("COUNT(*) AS calls, COALESCE(SUM(duration), 0) AS talk_time").
+		Where("user_id = ? AND start_time >= ? AND start_time < ?", userID, since, until).
+		Scan(&result).Error
+	return int(result.Calls), time.Duration(result.TalkTime), err
+}
+
+// RepeaterCallCount is the number of calls through a repeater at a position to one talkgroup.
+// TalkgroupID is nil for private calls.
+type RepeaterCallCount struct {
+	RepeaterID  uint
+	Latitude    float64
+	Longitude   float64
+	TalkgroupID *uint
+	Calls       int64
+}
+
+// CountCallsByRepeaterPosition counts calls started since a time through each repeater with a
+// position, split by talkgroup
+func CountCallsByRepeaterPosition(db *gorm.DB, since time.Time) ([]RepeaterCallCount, error) {
+	var counts []RepeaterCallCount
+	err := db.Model(&Call{}).
+		Select("calls.repeater_id, repeaters.latitude, repeaters.longitude, calls.to_talkgroup_id AS talkgroup_id, COUNT(*) AS calls").
+		Joins("JOIN repeaters ON repeaters.id = calls.repeater_id").
+		Where("calls.start_time >= ? AND (repeaters.latitude <> 0 OR repeaters.longitude <> 0)", since).
+		Group("calls.repeater_id, repeaters.latitude, repeaters.longitude, calls.to_talkgroup_id").
+		Scan(&counts).Error
+	return counts, err
+}
@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// CallTelemetry is a downsampled BER/RSSI sample taken during a call,
+// positioned by its offset from the start of the transmission
+type CallTelemetry struct {
+	ID       uint    `json:"-" gorm:"primaryKey"`
+	CallID   uint    `json:"-" gorm:"index"`
+	OffsetMS uint    `json:"offset_ms"`
+	BER      float32 `json:"ber"`
+	RSSI     float32 `json:"rssi"`
+}
+
+func FindCallTelemetry(db *gorm.DB, callID uint) ([]CallTelemetry, error) {
+	var points []CallTelemetry
+	err := db.Where("call_id = ?", callID).Order("offset_ms asc").Find(&points).Error
+	return points, err
+}
+
+// DownsampleTelemetry averages consecutive samples so that no more than maxPoints remain
+func DownsampleTelemetry(points []CallTelemetry, maxPoints int) []CallTelemetry {
+	if maxPoints <= 0 || len(points) <= maxPoints {
+		return points
+	}
+	size := (len(points) + maxPoints - 1) / maxPoints
+	downsampled := make([]CallTelemetry, 0, maxPoints)
+	for start := 0; start < len(points); start += size {
+		end := min(start+size, len(points))
+		bucket := points[start:end]
+		point := CallTelemetry{CallID: bucket[0].CallID, OffsetMS: bucket[0].OffsetMS}
+		var rssiSamples int
+		for _, sample := range bucket {
+			point.BER += sample.BER
+			if sample.RSSI > 0 {
+				point.RSSI += sample.RSSI
+				rssiSamples++
+			}
+		}
+		point.BER /= float32(len(bucket))
+		if rssiSamples > 0 {
+			point.RSSI /= float32(rssiSamples)
+		}
+		downsampled = append(downsampled, point)
+	}
+	return downsampled
+}
+
+// deleteOrphanedTelemetry removes telemetry belonging to calls that no longer exist
+func deleteOrphanedTelemetry(tx *gorm.DB) error {
+	return tx.Where("call_id NOT IN (?)", tx.Unscoped().Model(&Call{}).Select("id")).Delete(&CallTelemetry{}).Error
+}
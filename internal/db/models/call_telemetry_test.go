@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func TestDownsampleTelemetry(t *testing.T) {
+	t.Parallel()
+	points := make([]models.CallTelemetry, 0, 10)
+	for i := range 10 {
+		points = append(points, models.CallTelemetry{OffsetMS: uint(i * 360), BER: float32(i%2) / 10, RSSI: 50})
+	}
+
+	if got := models.DownsampleTelemetry(points, 20); len(got) != 10 {
+		t.Errorf("Expected short series to be untouched, got %d points", len(got))
+	}
+
+	got := models.DownsampleTelemetry(points, 5)
+	if len(got) != 5 {
+		t.Fatalf("Expected 5 points, got %d", len(got))
+	}
+	if got[1].OffsetMS != 720 {
+		t.Errorf("Expected bucket to start at 720ms, got %d", got[1].OffsetMS)
+	}
+	if got[1].BER != 0.05 {
+		t.Errorf("Expected averaged BER of 0.05, got %f", got[1].BER)
+	}
+	if got[1].RSSI != 50 {
+		t.Errorf("Expected averaged RSSI of 50, got %f", got[1].RSSI)
+	}
+}
+
+func TestPurgeRemovesTelemetry(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	now := time.Now()
+
+	call := models.Call{StartTime: now.Add(-40 * 24 * time.Hour)}
+	if err := db.Create(&call).Error; err != nil {
+		t.Fatalf("Failed to create call: %v", err)
+	}
+	if err := db.Create(&models.CallTelemetry{CallID: call.ID, BER: 0.1}).Error; err != nil {
+		t.Fatalf("Failed to create telemetry: %v", err)
+	}
+
+	if _, err := models.PurgeExpiredCalls(db, 30*24*time.Hour, now); err != nil {
+		t.Fatalf("Failed to purge calls: %v", err)
+	}
+
+	points, err := models.FindCallTelemetry(db, call.ID)
+	if err != nil {
+		t.Fatalf("Failed to find telemetry: %v", err)
+	}
+	if len(points) != 0 {
+		t.Errorf("Expected telemetry to be purged with its call, got %d points", len(points))
+	}
+}
@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func TestConversations(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	start := time.Now().Add(-time.Hour)
+	calls := []models.Call{
+		// Two transmissions in one conversation
+		{ID: 1, ConversationID: 1, UserID: 1, DestinationID: 3100, GroupCall: true, StartTime: start, Duration: 5 * time.Second},
+		{ID: 2, ConversationID: 1, UserID: 1, DestinationID: 3100, GroupCall: true, StartTime: start.Add(10 * time.Second), Duration: 3 * time.Second},
+		// A conversation of its own
+		{ID: 3, ConversationID: 3, UserID: 1, DestinationID: 3100, GroupCall: true, StartTime: start.Add(time.Minute), Duration: 2 * time.Second},
+		// Recorded before conversations were tracked
+		{ID: 4, UserID: 1, DestinationID: 3100, GroupCall: true, StartTime: start.Add(-time.Minute), Duration: time.Second},
+		// Still on the air
+		{ID: 5, ConversationID: 5, UserID: 1, DestinationID: 3100, GroupCall: true, StartTime: start.Add(2 * time.Minute), Active: true},
+	}
+	if err := db.Create(&calls).Error; err != nil {
+		t.Fatalf("Failed to create calls: %v", err)
+	}
+
+	var heads []models.Call
+	models.ConversationHeads(db).Order("id").Find(&heads)
+	if len(heads) != 4 || heads[0].ID != 1 || heads[1].ID != 3 || heads[2].ID != 4 || heads[3].ID != 5 {
+		t.Fatalf("Expected conversation heads 1, 3, 4 and 5, got %+v", heads)
+	}
+
+	heads, err := models.AggregateConversations(db, heads)
+	if err != nil {
+		t.Fatalf("Failed to aggregate conversations: %v", err)
+	}
+	if heads[0].Transmissions != 2 || heads[0].Duration != 8*time.Second {
+		t.Errorf("Expected the first conversation to total 2 transmissions over 8s, got %d over %s", heads[0].Transmissions, heads[0].Duration)
+	}
+	if heads[1].Transmissions != 1 || heads[1].Duration != 2*time.Second {
+		t.Errorf("Expected the second conversation to be a single 2s transmission, got %d over %s", heads[1].Transmissions, heads[1].Duration)
+	}
+	if heads[2].Transmissions != 1 || heads[2].Duration != time.Second {
+		t.Errorf("Expected the untracked call to stand alone, got %d over %s", heads[2].Transmissions, heads[2].Duration)
+	}
+
+	// The active call isn't completed, so the last completed one is call 3
+	last, ok := models.FindLastCompletedCall(db, 1, 3100, true)
+	if !ok || last.ID != 3 {
+		t.Errorf("Expected call 3 to be the last completed call, got %d, %v", last.ID, ok)
+	}
+	if _, ok := models.FindLastCompletedCall(db, 1, 3100, false); ok {
+		t.Error("Expected no completed private calls to 3100")
+	}
+}
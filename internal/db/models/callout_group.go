@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CalloutGroup is a list of users that can all be reached with one private call
+// to the group's ID. The ID is a virtual DMR ID that must not belong to a user,
+// repeater, or talkgroup.
+type CalloutGroup struct {
+	ID          uint           `json:"id" gorm:"primaryKey;autoIncrement:false"`
+	Name        string         `json:"name" gorm:"uniqueIndex"`
+	Description string         `json:"description"`
+	Members     []User         `json:"members" gorm:"many2many:callout_group_members;"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"-"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+func ListCalloutGroups(db *gorm.DB) ([]CalloutGroup, error) {
+	var groups []CalloutGroup
+	err := db.Preload("Members").Order("id asc").Find(&groups).Error
+	return groups, err
+}
+
+func CountCalloutGroups(db *gorm.DB) (int, error) {
+	var count int64
+	err := db.Model(&CalloutGroup{}).Count(&count).Error
+	return int(count), err
+}
+
+func CalloutGroupIDExists(db *gorm.DB, id uint) (bool, error) {
+	var count int64
+	err := db.Model(&CalloutGroup{}).Where("id = ?", id).Limit(1).Count(&count).Error
+	return count > 0, err
+}
+
+func FindCalloutGroupByID(db *gorm.DB, id uint) (CalloutGroup, error) {
+	var group CalloutGroup
+	err := db.Preload("Members").First(&group, id).Error
+	return group, err
+}
+
+// FindCalloutRepeaters returns the repeater each member of a callout group was last heard on,
+// without duplicates. Members that have never made a call are skipped.
+func FindCalloutRepeaters(db *gorm.DB, id uint) ([]uint, error) {
+	var memberIDs []uint
+	err := db.Table("callout_group_members").Where("callout_group_id = ?", id).Order("user_id asc").Pluck("user_id", &memberIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[uint]bool, len(memberIDs))
+	repeaters := make([]uint, 0, len(memberIDs))
+	for _, userID := range memberIDs {
+		var repeaterIDs []uint
+		err := db.Model(&Call{}).Where("user_id = ?", userID).Order("created_at DESC").Limit(1).Pluck("repeater_id", &repeaterIDs).Error
+		if err != nil {
+			return nil, err
+		}
+		if len(repeaterIDs) == 0 || seen[repeaterIDs[0]] {
+			continue
+		}
+		seen[repeaterIDs[0]] = true
+		repeaters = append(repeaters, repeaterIDs[0])
+	}
+	return repeaters, nil
+}
+
+func DeleteCalloutGroup(db *gorm.DB, id uint) error {
+	err := db.Unscoped().Select(clause.Associations, "Members").Delete(&CalloutGroup{ID: id}).Error
+	if err != nil {
+		logging.Errorf("Error deleting callout group: %s", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func TestFindCalloutRepeaters(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.CalloutGroup{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	users := []models.User{{ID: 3110001, Username: "n0call", Callsign: "N0CALL"}, {ID: 3110002, Username: "n1call", Callsign: "N1CALL"}, {ID: 3110003, Username: "n2call", Callsign: "N2CALL"}, {ID: 3110004, Username: "n3call", Callsign: "N3CALL"}}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatalf("Failed to create users: %v", err)
+	}
+	now := time.Now()
+	calls := []models.Call{
+		// The first member moved from 311001 to 311002
+		{UserID: 3110001, RepeaterID: 311001, CreatedAt: now.Add(-time.Hour)},
+		{UserID: 3110001, RepeaterID: 311002, CreatedAt: now},
+		// The second member was last heard on the same repeater
+		{UserID: 3110002, RepeaterID: 311002, CreatedAt: now},
+		{UserID: 3110003, RepeaterID: 311003, CreatedAt: now},
+	}
+	if err := db.Create(&calls).Error; err != nil {
+		t.Fatalf("Failed to create calls: %v", err)
+	}
+	// The fourth member has never been heard
+	group := models.CalloutGroup{ID: 9990001, Name: "ARES", Members: []models.User{users[0], users[1], users[2], users[3]}}
+	if err := db.Create(&group).Error; err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+
+	repeaters, err := models.FindCalloutRepeaters(db, group.ID)
+	if err != nil {
+		t.Fatalf("Failed to find repeaters: %v", err)
+	}
+	if len(repeaters) != 2 || repeaters[0] != 311002 || repeaters[1] != 311003 {
+		t.Errorf("Expected each member's last heard repeater once, got %v", repeaters)
+	}
+}
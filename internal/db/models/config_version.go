@@ -0,0 +1,331 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of objects whose configuration is versioned
+const (
+	ConfigVersionRepeater  = "repeater"
+	ConfigVersionTalkgroup = "talkgroup"
+)
+
+// ErrConfigVersionKind is returned when a version is restored onto the wrong kind of object
+var ErrConfigVersionKind = errors.New("configuration version is for a different kind of object")
+
+// ConfigVersion is a snapshot of a repeater's or talkgroup's configuration taken after
+// a change, with who made the change and what it changed from the version before.
+// Versions are numbered from 1 per object and are never rewritten.
+type ConfigVersion struct {
+	ID        uint            `json:"id" gorm:"primaryKey"`
+	Kind      string          `json:"kind" gorm:"uniqueIndex:idx_config_version"`
+	ObjectID  uint            `json:"object_id" gorm:"uniqueIndex:idx_config_version"`
+	Version   uint            `json:"version" gorm:"uniqueIndex:idx_config_version"`
+	UserID    uint            `json:"user_id"`
+	Snapshot  json.RawMessage `json:"snapshot" gorm:"serializer:json"`
+	Changes   []ConfigChange  `json:"changes" gorm:"serializer:json"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// ConfigChange is one field that differs between two versions
+type ConfigChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+// RepeaterSnapshot is the part of a repeater's configuration that is versioned. Dynamic
+// talkgroups are left out because keying up changes them as often as any API call.
+type RepeaterSnapshot struct {
+	TS1StaticTalkgroups  []uint `json:"ts1_static_talkgroups"`
+	TS2StaticTalkgroups  []uint `json:"ts2_static_talkgroups"`
+	SkipTalkgroupProfile bool   `json:"skip_talkgroup_profile"`
+	ExpectedColorCode    *uint8 `json:"expected_color_code"`
+	MaxDatagram          uint   `json:"max_datagram"`
+	KeepaliveInterval    uint   `json:"keepalive_interval"`
+	Network              string `json:"network"`
+}
+
+// TalkgroupSnapshot is the part of a talkgroup's configuration that is versioned
+type TalkgroupSnapshot struct {
+	Name           string      `json:"name"`
+	Description    string      `json:"description"`
+	RetentionDays  uint        `json:"retention_days"`
+	Archive        bool        `json:"archive"`
+	ArchivePayload bool        `json:"archive_payload"`
+	Language       string      `json:"language"`
+	Region         string      `json:"region"`
+	BridgeHint     BridgeHint  `json:"bridge_hint"`
+	Private        bool        `json:"private"`
+	CodecPolicy    CodecPolicy `json:"codec_policy"`
+	Admins         []uint      `json:"admins"`
+	NCOs           []uint      `json:"ncos"`
+	Categories     []uint      `json:"categories"`
+}
+
+// SnapshotRepeater captures a repeater's versioned configuration. The repeater must
+// have its static talkgroups loaded.
+func SnapshotRepeater(repeater Repeater) RepeaterSnapshot {
+	return RepeaterSnapshot{
+		TS1StaticTalkgroups:  sortedIDs(repeater.TS1StaticTalkgroups, func(tg Talkgroup) uint { return tg.ID }),
+		TS2StaticTalkgroups:  sortedIDs(repeater.TS2StaticTalkgroups, func(tg Talkgroup) uint { return tg.ID }),
+		SkipTalkgroupProfile: repeater.SkipTalkgroupProfile,
+		ExpectedColorCode:    repeater.ExpectedColorCode,
+		MaxDatagram:          repeater.MaxDatagram,
+		KeepaliveInterval:    repeater.KeepaliveInterval,
+		Network:              repeater.Network,
+	}
+}
+
+// SnapshotTalkgroup captures a talkgroup's versioned configuration. The talkgroup must
+// have its admins, NCOs and categories loaded.
+func SnapshotTalkgroup(talkgroup Talkgroup) TalkgroupSnapshot {
+	return TalkgroupSnapshot{
+		Name:           talkgroup.Name,
+		Description:    talkgroup.Description,
+		RetentionDays:  talkgroup.RetentionDays,
+		Archive:        talkgroup.Archive,
+		ArchivePayload: talkgroup.ArchivePayload,
+		Language:       talkgroup.Language,
+		Region:         talkgroup.Region,
+		BridgeHint:     talkgroup.BridgeHint,
+		Private:        talkgroup.Private,
+		CodecPolicy:    talkgroup.CodecPolicy,
+		Admins:         sortedIDs(talkgroup.Admins, func(u User) uint { return u.ID }),
+		NCOs:           sortedIDs(talkgroup.NCOs, func(u User) uint { return u.ID }),
+		Categories:     sortedIDs(talkgroup.Categories, func(c TalkgroupCategory) uint { return c.ID }),
+	}
+}
+
+// RecordRepeaterVersion saves the repeater's current configuration as a new version
+// if it differs from the latest one. It reports whether a version was saved.
+func RecordRepeaterVersion(db *gorm.DB, repeaterID uint, userID uint) (ConfigVersion, bool, error) {
+	repeater, err := FindRepeaterByID(db, repeaterID)
+	if err != nil {
+		return ConfigVersion{}, false, err
+	}
+	return recordConfigVersion(db, ConfigVersionRepeater, repeaterID, userID, SnapshotRepeater(repeater))
+}
+
+// RecordTalkgroupVersion saves the talkgroup's current configuration as a new version
+// if it differs from the latest one. It reports whether a version was saved.
+func RecordTalkgroupVersion(db *gorm.DB, talkgroupID uint, userID uint) (ConfigVersion, bool, error) {
+	talkgroup, err := FindTalkgroupByID(db, talkgroupID)
+	if err != nil {
+		return ConfigVersion{}, false, err
+	}
+	return recordConfigVersion(db, ConfigVersionTalkgroup, talkgroupID, userID, SnapshotTalkgroup(talkgroup))
+}
+
+func recordConfigVersion(db *gorm.DB, kind string, objectID uint, userID uint, snapshot any) (ConfigVersion, bool, error) {
+	current, err := json.Marshal(snapshot)
+	if err != nil {
+		return ConfigVersion{}, false, err
+	}
+	var version ConfigVersion
+	saved := false
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var latest []ConfigVersion
+		err := tx.Where("kind = ? AND object_id = ?", kind, objectID).Order("version desc").Limit(1).Find(&latest).Error
+		if err != nil {
+			return err
+		}
+		var previous json.RawMessage
+		var number uint = 1
+		if len(latest) > 0 {
+			previous = latest[0].Snapshot
+			number = latest[0].Version + 1
+		}
+		changes, err := DiffConfigSnapshots(previous, current)
+		if err != nil {
+			return err
+		}
+		if len(latest) > 0 && len(changes) == 0 {
+			version = latest[0]
+			return nil
+		}
+		version = ConfigVersion{
+			Kind:     kind,
+			ObjectID: objectID,
+			Version:  number,
+			UserID:   userID,
+			Snapshot: current,
+			Changes:  changes,
+		}
+		saved = true
+		return tx.Create(&version).Error
+	})
+	return version, saved, err
+}
+
+// DiffConfigSnapshots lists the fields that differ between two snapshots, in field
+// order. An empty before snapshot lists every field of after as a change.
+func DiffConfigSnapshots(before, after json.RawMessage) ([]ConfigChange, error) {
+	oldFields := map[string]any{}
+	if len(before) > 0 {
+		if err := json.Unmarshal(before, &oldFields); err != nil {
+			return nil, err
+		}
+	}
+	newFields := map[string]any{}
+	if err := json.Unmarshal(after, &newFields); err != nil {
+		return nil, err
+	}
+	fields := make([]string, 0, len(newFields))
+	for field := range newFields {
+		fields = append(fields, field)
+	}
+	for field := range oldFields {
+		if _, ok := newFields[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []ConfigChange{}
+	for _, field := range fields {
+		if !reflect.DeepEqual(oldFields[field], newFields[field]) {
+			changes = append(changes, ConfigChange{Field: field, Old: oldFields[field], New: newFields[field]})
+		}
+	}
+	return changes, nil
+}
+
+// ListConfigVersions returns an object's versions, newest first
+func ListConfigVersions(db *gorm.DB, kind string, objectID uint) ([]ConfigVersion, error) {
+	var versions []ConfigVersion
+	err := db.Where("kind = ? AND object_id = ?", kind, objectID).Order("version desc").Find(&versions).Error
+	return versions, err
+}
+
+func FindConfigVersion(db *gorm.DB, kind string, objectID uint, version uint) (ConfigVersion, error) {
+	var configVersion ConfigVersion
+	err := db.Where("kind = ? AND object_id = ? AND version = ?", kind, objectID, version).First(&configVersion).Error
+	return configVersion, err
+}
+
+// RestoreRepeaterVersion puts a repeater's configuration back to a saved version.
+// Talkgroups deleted since the version was taken are left out. The caller records
+// the result as a new version and reloads the repeater's subscriptions.
+func RestoreRepeaterVersion(db *gorm.DB, repeater *Repeater, version ConfigVersion) error {
+	if version.Kind != ConfigVersionRepeater {
+		return ErrConfigVersionKind
+	}
+	var snapshot RepeaterSnapshot
+	if err := json.Unmarshal(version.Snapshot, &snapshot); err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var ts1, ts2 []Talkgroup
+		if err := findExisting(tx, snapshot.TS1StaticTalkgroups, &ts1); err != nil {
+			return err
+		}
+		if err := findExisting(tx, snapshot.TS2StaticTalkgroups, &ts2); err != nil {
+			return err
+		}
+		if err := tx.Model(repeater).Association("TS1StaticTalkgroups").Replace(ts1); err != nil {
+			return err
+		}
+		if err := tx.Model(repeater).Association("TS2StaticTalkgroups").Replace(ts2); err != nil {
+			return err
+		}
+		return tx.Model(repeater).Select("skip_talkgroup_profile", "expected_color_code", "max_datagram", "keepalive_interval", "network").
+			Updates(map[string]any{
+				"skip_talkgroup_profile": snapshot.SkipTalkgroupProfile,
+				"expected_color_code":    snapshot.ExpectedColorCode,
+				"max_datagram":           snapshot.MaxDatagram,
+				"keepalive_interval":     snapshot.KeepaliveInterval,
+				"network":                snapshot.Network,
+			}).Error
+	})
+}
+
+// RestoreTalkgroupVersion puts a talkgroup's configuration back to a saved version.
+// Users and categories deleted since the version was taken are left out. Whether the
+// talkgroup is pending approval isn't configuration and is left alone.
+func RestoreTalkgroupVersion(db *gorm.DB, talkgroup *Talkgroup, version ConfigVersion) error {
+	if version.Kind != ConfigVersionTalkgroup {
+		return ErrConfigVersionKind
+	}
+	var snapshot TalkgroupSnapshot
+	if err := json.Unmarshal(version.Snapshot, &snapshot); err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var admins, ncos []User
+		var categories []TalkgroupCategory
+		if err := findExisting(tx, snapshot.Admins, &admins); err != nil {
+			return err
+		}
+		if err := findExisting(tx, snapshot.NCOs, &ncos); err != nil {
+			return err
+		}
+		if err := findExisting(tx, snapshot.Categories, &categories); err != nil {
+			return err
+		}
+		if err := tx.Model(talkgroup).Association("Admins").Replace(admins); err != nil {
+			return err
+		}
+		if err := tx.Model(talkgroup).Association("NCOs").Replace(ncos); err != nil {
+			return err
+		}
+		if err := tx.Model(talkgroup).Association("Categories").Replace(categories); err != nil {
+			return err
+		}
+		return tx.Model(talkgroup).Select("name", "description", "retention_days", "archive", "archive_payload", "language", "region", "bridge_hint", "private", "codec_policy").
+			Updates(map[string]any{
+				"name":            snapshot.Name,
+				"description":     snapshot.Description,
+				"retention_days":  snapshot.RetentionDays,
+				"archive":         snapshot.Archive,
+				"archive_payload": snapshot.ArchivePayload,
+				"language":        snapshot.Language,
+				"region":          snapshot.Region,
+				"bridge_hint":     snapshot.BridgeHint,
+				"private":         snapshot.Private,
+				"codec_policy":    snapshot.CodecPolicy,
+			}).Error
+	})
+}
+
+func findExisting(db *gorm.DB, ids []uint, dest any) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return db.Where("id IN ?", ids).Order("id asc").Find(dest).Error
+}
+
+func sortedIDs[T any](items []T, id func(T) uint) []uint {
+	ids := make([]uint, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, id(item))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func TestRepeaterConfigVersions(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.ConfigVersion{}, &models.TalkgroupCategory{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	db.Create(&models.Talkgroup{ID: 1, Name: "Local"})
+	db.Create(&models.Talkgroup{ID: 3100, Name: "USA"})
+	db.Create(&models.Repeater{RepeaterConfiguration: models.RepeaterConfiguration{ID: 311860}, TS1StaticTalkgroups: []models.Talkgroup{{ID: 1}}})
+
+	first, saved, err := models.RecordRepeaterVersion(db, 311860, 1)
+	if err != nil || !saved || first.Version != 1 {
+		t.Fatalf("Expected the first version to be saved, got %+v saved=%v err=%v", first, saved, err)
+	}
+	if _, saved, err = models.RecordRepeaterVersion(db, 311860, 1); err != nil || saved {
+		t.Errorf("Expected an unchanged repeater not to be versioned, got saved=%v err=%v", saved, err)
+	}
+
+	repeater, _ := models.FindRepeaterByID(db, 311860)
+	if err := db.Model(&repeater).Association("TS1StaticTalkgroups").Replace([]models.Talkgroup{{ID: 3100}}); err != nil {
+		t.Fatalf("Failed to update talkgroups: %v", err)
+	}
+	db.Model(&repeater).Update("max_datagram", 512)
+	second, saved, err := models.RecordRepeaterVersion(db, 311860, 2)
+	if err != nil || !saved || second.Version != 2 || second.UserID != 2 {
+		t.Fatalf("Expected a second version by user 2, got %+v saved=%v err=%v", second, saved, err)
+	}
+	if len(second.Changes) != 2 || second.Changes[0].Field != "max_datagram" || second.Changes[1].Field != "ts1_static_talkgroups" {
+		t.Errorf("Expected max_datagram and ts1_static_talkgroups to change, got %+v", second.Changes)
+	}
+
+	if err := models.RestoreRepeaterVersion(db, &repeater, first); err != nil {
+		t.Fatalf("Failed to restore version: %v", err)
+	}
+	repeater, _ = models.FindRepeaterByID(db, 311860)
+	if len(repeater.TS1StaticTalkgroups) != 1 || repeater.TS1StaticTalkgroups[0].ID != 1 || repeater.MaxDatagram != 0 {
+		t.Errorf("Expected the first version's configuration, got %+v max_datagram=%d", repeater.TS1StaticTalkgroups, repeater.MaxDatagram)
+	}
+	third, saved, err := models.RecordRepeaterVersion(db, 311860, 1)
+	if err != nil || !saved || third.Version != 3 {
+		t.Fatalf("Expected the restore to be recorded as version 3, got %+v saved=%v err=%v", third, saved, err)
+	}
+
+	versions, err := models.ListConfigVersions(db, models.ConfigVersionRepeater, 311860)
+	if err != nil || len(versions) != 3 || versions[0].Version != 3 {
+		t.Errorf("Expected three versions newest first, got %+v (%v)", versions, err)
+	}
+	found, err := models.FindConfigVersion(db, models.ConfigVersionRepeater, 311860, 2)
+	if err != nil || found.ID != second.ID {
+		t.Errorf("Expected to find version 2, got %+v (%v)", found, err)
+	}
+
+	talkgroup, _ := models.FindTalkgroupByID(db, 1)
+	if err := models.RestoreTalkgroupVersion(db, &talkgroup, first); err == nil {
+		t.Error("Expected restoring a repeater version onto a talkgroup to fail")
+	}
+}
+
+func TestTalkgroupConfigVersionsSkipDeletedUsers(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.ConfigVersion{}, &models.TalkgroupCategory{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	db.Create(&models.User{ID: 1000001, Callsign: "N0CALL", Username: "first"})
+	db.Create(&models.User{ID: 1000002, Callsign: "N1CALL", Username: "second"})
+	db.Create(&models.Talkgroup{ID: 3100, Name: "USA", Admins: []models.User{{ID: 1000001}, {ID: 1000002}}})
+
+	first, _, err := models.RecordTalkgroupVersion(db, 3100, 1)
+	if err != nil {
+		t.Fatalf("Failed to record version: %v", err)
+	}
+	db.Model(&models.Talkgroup{ID: 3100}).Update("name", "United States")
+	db.Unscoped().Delete(&models.User{ID: 1000002})
+
+	talkgroup, _ := models.FindTalkgroupByID(db, 3100)
+	if err := models.RestoreTalkgroupVersion(db, &talkgroup, first); err != nil {
+		t.Fatalf("Failed to restore version: %v", err)
+	}
+	talkgroup, _ = models.FindTalkgroupByID(db, 3100)
+	if talkgroup.Name != "USA" {
+		t.Errorf("Expected the name to be restored, got %q", talkgroup.Name)
+	}
+	if len(talkgroup.Admins) != 1 || talkgroup.Admins[0].ID != 1000001 {
+		t.Errorf("Expected only the remaining admin to be restored, got %+v", talkgroup.Admins)
+	}
+}
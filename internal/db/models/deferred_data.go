@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DeferredData is one packet of a data call, such as an SMS, held until its offline destination reconnects
+type DeferredData struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	StreamID      uint      `json:"stream_id"`
+	Source        uint      `json:"source"`
+	DestinationID uint      `json:"destination_id" gorm:"index"`
+	ToRepeater    bool      `json:"to_repeater"`
+	Packet        []byte    `json:"-"`
+	Size          int       `json:"size"`
+	QueuedAt      time.Time `json:"queued_at"`
+	ExpiresAt     time.Time `json:"expires_at" gorm:"index"`
+}
+
+var ErrDeferredDataFull = errors.New("deferred data queue is full for this destination")
+
+// QueueDeferredData holds a packet for an offline destination, refusing it if the
+// destination already has limit packets waiting
+func QueueDeferredData(db *gorm.DB, data DeferredData, limit int) error {
+	var count int64
+	err := db.Model(&DeferredData{}).Where("destination_id = ? AND to_repeater = ? AND expires_at > ?", data.DestinationID, data.ToRepeater, data.QueuedAt).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count >= int64(limit) {
+		return ErrDeferredDataFull
+	}
+	data.Size = len(data.Packet)
+	return db.Create(&data).Error
+}
+
+// TakeDeferredData removes and returns the unexpired packets waiting for a destination,
+// oldest first. Packets taken here can't be delivered twice by a concurrent caller.
+func TakeDeferredData(db *gorm.DB, destinationID uint, toRepeater bool, now time.Time) ([]DeferredData, error) {
+	var taken []DeferredData
+	err := db.Clauses(clause.Returning{}).
+		Where("destination_id = ? AND to_repeater = ? AND expires_at > ?", destinationID, toRepeater, now).
+		Delete(&taken).Error
+	slices.SortFunc(taken, func(a, b DeferredData) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return taken, err
+}
+
+// ListDeferredUsers returns the users that have unexpired packets waiting for them
+func ListDeferredUsers(db *gorm.DB, now time.Time) ([]uint, error) {
+	var users []uint
+	err := db.Model(&DeferredData{}).Where("to_repeater = ? AND expires_at > ?", false, now).Distinct().Order("destination_id asc").Pluck("destination_id", &users).Error
+	return users, err
+}
+
+func HasDeferredData(db *gorm.DB, destinationID uint, toRepeater bool, now time.Time) (bool, error) {
+	var count int64
+	err := db.Model(&DeferredData{}).Where("destination_id = ? AND to_repeater = ? AND expires_at > ?", destinationID, toRepeater, now).Limit(1).Count(&count).Error
+	return count > 0, err
+}
+
+func ListDeferredData(db *gorm.DB) ([]DeferredData, error) {
+	var queued []DeferredData
+	err := db.Order("id asc").Find(&queued).Error
+	return queued, err
+}
+
+func CountDeferredData(db *gorm.DB) (int, error) {
+	var count int64
+	err := db.Model(&DeferredData{}).Count(&count).Error
+	return int(count), err
+}
+
+// PurgeDeferredData deletes queued packets, every packet if destinationID is zero
+func PurgeDeferredData(db *gorm.DB, destinationID uint) (int64, error) {
+	query := db.Where("1 = 1")
+	if destinationID != 0 {
+		query = db.Where("destination_id = ?", destinationID)
+	}
+	result := query.Delete(&DeferredData{})
+	return result.RowsAffected, result.Error
+}
+
+func DeleteDeferredData(db *gorm.DB, id uint) (bool, error) {
+	result := db.Delete(&DeferredData{ID: id})
+	return result.RowsAffected > 0, result.Error
+}
+
+// PurgeExpiredDeferredData deletes packets whose destination didn't reconnect in time
+func PurgeExpiredDeferredData(db *gorm.DB, now time.Time) (int64, error) {
+	result := db.Where("expires_at <= ?", now).Delete(&DeferredData{})
+	return result.RowsAffected, result.Error
+}
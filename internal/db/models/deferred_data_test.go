@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func TestDeferredData(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.DeferredData{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	now := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	queue := func(destination uint, toRepeater bool, packet string, expires time.Time) error {
+		return models.QueueDeferredData(db, models.DeferredData{DestinationID: destination, ToRepeater: toRepeater, Packet: []byte(packet), QueuedAt: now, ExpiresAt: expires}, 2)
+	}
+	for _, packet := range []string{"header", "block"} {
+		if err := queue(3110001, false, packet, now.Add(time.Hour)); err != nil {
+			t.Fatalf("Failed to queue packet: %v", err)
+		}
+	}
+	if err := queue(3110001, false, "overflow", now.Add(time.Hour)); !errors.Is(err, models.ErrDeferredDataFull) {
+		t.Errorf("Expected the queue to be bounded, got %v", err)
+	}
+	// A repeater with the same ID is a different destination
+	if err := queue(3110001, true, "repeater", now.Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to queue packet: %v", err)
+	}
+	if err := queue(3110002, false, "stale", now.Add(-time.Minute)); err != nil {
+		t.Fatalf("Failed to queue packet: %v", err)
+	}
+
+	users, err := models.ListDeferredUsers(db, now)
+	if err != nil || len(users) != 1 || users[0] != 3110001 {
+		t.Errorf("Expected only the user with unexpired packets, got %v (%v)", users, err)
+	}
+
+	taken, err := models.TakeDeferredData(db, 3110001, false, now)
+	if err != nil {
+		t.Fatalf("Failed to take packets: %v", err)
+	}
+	if len(taken) != 2 || string(taken[0].Packet) != "header" || string(taken[1].Packet) != "block" {
+		t.Fatalf("Expected both packets in order, got %+v", taken)
+	}
+	if taken, _ = models.TakeDeferredData(db, 3110001, false, now); len(taken) != 0 {
+		t.Errorf("Expected packets to be delivered once, got %d more", len(taken))
+	}
+
+	purged, err := models.PurgeExpiredDeferredData(db, now)
+	if err != nil || purged != 1 {
+		t.Errorf("Expected the stale packet to be purged, got %d (%v)", purged, err)
+	}
+	if count, _ := models.CountDeferredData(db); count != 1 {
+		t.Errorf("Expected the repeater's packet to remain, got %d", count)
+	}
+}
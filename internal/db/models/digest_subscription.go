@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DigestFrequency is how often a user receives their activity digest
+type DigestFrequency string
+
+const (
+	DigestDaily  DigestFrequency = "daily"
+	DigestWeekly DigestFrequency = "weekly"
+)
+
+// digestSlack lets a digest go out slightly early so a daily job doesn't skip a day when it runs late
+const digestSlack = time.Hour
+
+// Period is how much activity a digest of this frequency covers
+func (f DigestFrequency) Period() time.Duration {
+	if f == DigestWeekly {
+		return 7 * day
+	}
+	return day
+}
+
+// DigestSubscription opts a user into a periodic email summarizing their activity.
+// The address is kept here rather than on User so it never ends up in public call data.
+type DigestSubscription struct {
+	UserID     uint            `json:"-" gorm:"primaryKey;autoIncrement:false"`
+	Email      string          `json:"email"`
+	Frequency  DigestFrequency `json:"frequency"`
+	LastSentAt *time.Time      `json:"last_sent_at"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"-"`
+}
+
+// Due reports whether a digest should be sent now
+func (s *DigestSubscription) Due(now time.Time) bool {
+	return s.LastSentAt == nil || now.Sub(*s.LastSentAt) >= s.Frequency.Period()-digestSlack
+}
+
+func FindDigestSubscription(db *gorm.DB, userID uint) (DigestSubscription, bool, error) {
+	var subscriptions []DigestSubscription
+	err := db.Where("user_id = ?", userID).Limit(1).Find(&subscriptions).Error
+	if err != nil || len(subscriptions) == 0 {
+		return DigestSubscription{}, false, err
+	}
+	return subscriptions[0], true, nil
+}
+
+// ListDueDigestSubscriptions returns the subscriptions whose next digest should be sent now
+func ListDueDigestSubscriptions(db *gorm.DB, now time.Time) ([]DigestSubscription, error) {
+	var subscriptions []DigestSubscription
+	err := db.Order("user_id asc").Find(&subscriptions).Error
+	if err != nil {
+		return nil, err
+	}
+	due := make([]DigestSubscription, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		if subscription.Due(now) {
+			due = append(due, subscription)
+		}
+	}
+	return due, nil
+}
+
+// ClaimDigest marks a subscription's digest as sent at now if it is still due, reporting whether
+// it did. Every replica runs the digest job, so only the one whose claim succeeds sends the email.
+func ClaimDigest(db *gorm.DB, subscription DigestSubscription, now time.Time) (bool, error) {
+	dueBefore := now.Add(-(subscription.Frequency.Period() - digestSlack))
+	result := db.Model(&DigestSubscription{}).
+		Where("user_id = ? AND (last_sent_at IS NULL OR last_sent_at <= ?)", subscription.UserID, dueBefore).
+		Update("last_sent_at", now)
+	return result.RowsAffected == 1, result.Error
+}
+
+// UnclaimDigest restores the last sent time of a claimed digest that couldn't be sent,
+// so it is retried on the next run
+func UnclaimDigest(db *gorm.DB, subscription DigestSubscription) error {
+	return db.Model(&DigestSubscription{}).Where("user_id = ?", subscription.UserID).Update("last_sent_at", subscription.LastSentAt).Error
+}
+
+func DeleteDigestSubscription(db *gorm.DB, userID uint) error {
+	return db.Where("user_id = ?", userID).Delete(&DigestSubscription{}).Error
+}
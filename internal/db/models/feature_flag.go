@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FeatureFlag is an instance-wide override of a feature flag's default
+type FeatureFlag struct {
+	Name      string    `json:"name" gorm:"primaryKey"`
+	Enabled   bool      `json:"enabled"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func ListFeatureFlags(db *gorm.DB) ([]FeatureFlag, error) {
+	var flags []FeatureFlag
+	err := db.Order("name asc").Find(&flags).Error
+	return flags, err
+}
+
+// SetFeatureFlag creates or updates the override for a flag
+func SetFeatureFlag(db *gorm.DB, name string, enabled bool) error {
+	return db.Save(&FeatureFlag{Name: name, Enabled: enabled}).Error
+}
+
+// DeleteFeatureFlag removes the override for a flag so it falls back to its default
+func DeleteFeatureFlag(db *gorm.DB, name string) error {
+	return db.Where("name = ?", name).Delete(&FeatureFlag{}).Error
+}
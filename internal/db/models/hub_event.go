@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of hub state transitions recorded in the hub event log
+const (
+	HubEventRepeaterActivated   = "repeater_activated"
+	HubEventRepeaterDeactivated = "repeater_deactivated"
+	HubEventTalkgroupLinked     = "talkgroup_linked"
+	HubEventTalkgroupUnlinked   = "talkgroup_unlinked"
+	HubEventServerRegistered    = "server_registered"
+	HubEventServerUnregistered  = "server_unregistered"
+)
+
+// HubEvent is one state transition on one replica. The table is append-only, so
+// replaying it in ID order rebuilds what every replica was subscribed to at any time.
+type HubEvent struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Time        time.Time `json:"time" gorm:"index"`
+	Instance    string    `json:"instance" gorm:"index"`
+	Kind        string    `json:"kind"`
+	RepeaterID  uint      `json:"repeater_id,omitempty" gorm:"index"`
+	TalkgroupID uint      `json:"talkgroup_id,omitempty"`
+	Server      string    `json:"server,omitempty"`
+}
+
+// HubEventFilter narrows a hub event query. Zero fields match everything.
+type HubEventFilter struct {
+	Instance   string
+	RepeaterID uint
+	Until      time.Time
+}
+
+func (f HubEventFilter) apply(db *gorm.DB) *gorm.DB {
+	if f.Instance != "" {
+		db = db.Where("instance = ?", f.Instance)
+	}
+	if f.RepeaterID != 0 {
+		db = db.Where("repeater_id = ?", f.RepeaterID)
+	}
+	if !f.Until.IsZero() {
+		db = db.Where("time <= ?", f.Until)
+	}
+	return db
+}
+
+// ListHubEvents returns the newest matching events first, at most limit of them
+func ListHubEvents(db *gorm.DB, filter HubEventFilter, limit int) ([]HubEvent, error) {
+	var events []HubEvent
+	err := filter.apply(db).Order("id desc").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+// FindHubEventsInBatches walks matching events oldest first, for replaying the log
+func FindHubEventsInBatches(db *gorm.DB, filter HubEventFilter, batchSize int, fn func([]HubEvent) error) error {
+	var events []HubEvent
+	return filter.apply(db).Order("id asc").FindInBatches(&events, batchSize, func(_ *gorm.DB, _ int) error {
+		return fn(events)
+	}).Error
+}
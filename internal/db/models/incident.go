@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Incident states, in the order an incident normally moves through them
+const (
+	IncidentInvestigating = "investigating"
+	IncidentIdentified    = "identified"
+	IncidentMonitoring    = "monitoring"
+	IncidentResolved      = "resolved"
+)
+
+// Incident is an admin-written notice shown in the public status page's history
+type Incident struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Status      string         `json:"status"`
+	ResolvedAt  *time.Time     `json:"resolved_at"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// ListRecentIncidents returns incidents that are still open or were created after since, newest first
+func ListRecentIncidents(db *gorm.DB, since time.Time, limit int) ([]Incident, error) {
+	var incidents []Incident
+	err := db.Where("status <> ? OR created_at >= ?", IncidentResolved, since).
+		Order("created_at desc").Limit(limit).Find(&incidents).Error
+	return incidents, err
+}
+
+// FindIncidentByID returns the incident with the given ID
+func FindIncidentByID(db *gorm.DB, id uint) (Incident, error) {
+	var incident Incident
+	err := db.First(&incident, id).Error
+	return incident, err
+}
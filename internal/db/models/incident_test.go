@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func TestListRecentIncidents(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.Incident{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	now := time.Now()
+	old := now.Add(-60 * 24 * time.Hour)
+	incidents := []models.Incident{
+		{Title: "old and resolved", Status: models.IncidentResolved, CreatedAt: old},
+		{Title: "old but still open", Status: models.IncidentMonitoring, CreatedAt: old.Add(time.Hour)},
+		{Title: "recent", Status: models.IncidentResolved, CreatedAt: now.Add(-time.Hour)},
+	}
+	if err := db.Create(&incidents).Error; err != nil {
+		t.Fatalf("Failed to create incidents: %v", err)
+	}
+
+	recent, err := models.ListRecentIncidents(db, now.Add(-30*24*time.Hour), 10)
+	if err != nil {
+		t.Fatalf("Failed to list incidents: %v", err)
+	}
+	if len(recent) != 2 {
+		t.Fatalf("Expected 2 incidents, got %d", len(recent))
+	}
+	if recent[0].Title != "recent" || recent[1].Title != "old but still open" {
+		t.Errorf("Unexpected incidents or order: %q, %q", recent[0].Title, recent[1].Title)
+	}
+}
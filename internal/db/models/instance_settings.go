@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"gorm.io/gorm"
+)
+
+// InstanceSettings holds the branding and metadata shown on this network's dashboard.
+// There is only ever one row.
+type InstanceSettings struct {
+	ID           uint           `json:"-" gorm:"primaryKey"`
+	NetworkName  string         `json:"network_name"`
+	LogoURL      string         `json:"logo_url"`
+	ContactEmail string         `json:"contact_email"`
+	TermsOfUse   string         `json:"terms_of_use"`
+	MOTD         string         `json:"motd"`
+	CreatedAt    time.Time      `json:"-"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// GetInstanceSettings returns the instance settings, falling back
+// to the configured network name if none has been set
+func GetInstanceSettings(db *gorm.DB) (InstanceSettings, error) {
+	var settings []InstanceSettings
+	err := db.Order("id asc").Limit(1).Find(&settings).Error
+	if err != nil {
+		return InstanceSettings{NetworkName: config.GetConfig().NetworkName}, err
+	}
+	if len(settings) == 0 {
+		return InstanceSettings{NetworkName: config.GetConfig().NetworkName}, nil
+	}
+	if settings[0].NetworkName == "" {
+		settings[0].NetworkName = config.GetConfig().NetworkName
+	}
+	return settings[0], nil
+}
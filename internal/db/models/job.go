@@ -0,0 +1,234 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// JobState is where a Job is in its lifecycle
+type JobState string
+
+const (
+	// JobPending jobs run once RunAt passes
+	JobPending JobState = "pending"
+	// JobRunning jobs have been claimed by a worker
+	JobRunning JobState = "running"
+	// JobSucceeded jobs are kept for a while so admins can see what ran
+	JobSucceeded JobState = "succeeded"
+	// JobDead jobs ran out of attempts, or were dead-lettered by an admin, and won't run again unless retried
+	JobDead JobState = "dead"
+)
+
+// Job is a unit of background work. Jobs live in the database so they survive restarts
+// and can be picked up by any replica. UniqueKey is set on jobs that only one of may be
+// pending or running at a time, which a partial unique index enforces.
+type Job struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Kind        string     `json:"kind" gorm:"index"`
+	UniqueKey   *string    `json:"unique_key,omitempty" gorm:"uniqueIndex:idx_jobs_unique_key,where:state = 'pending' OR state = 'running'"`
+	Payload     string     `json:"payload"`
+	State       JobState   `json:"state" gorm:"index:idx_jobs_state_run_at"`
+	RunAt       time.Time  `json:"run_at" gorm:"index:idx_jobs_state_run_at"`
+	Attempts    int        `json:"attempts"`
+	MaxAttempts int        `json:"max_attempts"`
+	LastError   string     `json:"last_error"`
+	Worker      string     `json:"worker"`
+	StartedAt   *time.Time `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// EnqueueJob saves a new pending job
+func EnqueueJob(db *gorm.DB, job *Job) error {
+	job.State = JobPending
+	return db.Create(job).Error
+}
+
+// EnqueueUniqueJob saves a new pending job unless a job of the same kind is already
+// pending or running, returning false if it wasn't saved
+func EnqueueUniqueJob(db *gorm.DB, job *Job) (bool, error) {
+	job.State = JobPending
+	job.UniqueKey = &job.Kind
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(job)
+	return result.RowsAffected > 0, result.Error
+}
+
+// ClaimJob marks the oldest due job of one of the given kinds as running on worker and returns it.
+// The claim is a conditional update, so two workers never get the same job.
+func ClaimJob(db *gorm.DB, worker string, kinds []string, now time.Time) (Job, bool, error) {
+	const maxContention = 5
+	for range maxContention {
+		var job Job
+		err := db.Where("state = ? AND run_at <= ? AND kind IN ?", JobPending, now, kinds).Order("run_at asc, id asc").Limit(1).Find(&job).Error
+		if err != nil || job.ID == 0 {
+			return Job{}, false, err
+		}
+		result := db.Model(&Job{}).Where("id = ? AND state = ?", job.ID, JobPending).Updates(map[string]any{
+			"state":      JobRunning,
+			"worker":     worker,
+			"attempts":   gorm.Expr("attempts + 1"),
+			"started_at": now,
+		})
+		if result.Error != nil {
+			return Job{}, false, result.Error
+		}
+		if result.RowsAffected == 1 {
+			job.State = JobRunning
+			job.Worker = worker
+			job.Attempts++
+			job.StartedAt = &now
+			return job, true, nil
+		}
+		// Another worker claimed it first, try the next one
+	}
+	return Job{}, false, nil
+}
+
+// CompleteJob marks a running job as succeeded
+func CompleteJob(db *gorm.DB, id uint, now time.Time) error {
+	return db.Model(&Job{}).Where("id = ? AND state = ?", id, JobRunning).Updates(map[string]any{
+		"state":       JobSucceeded,
+		"last_error":  "",
+		"finished_at": now,
+	}).Error
+}
+
+// FailJob records a failed attempt. The job runs again at retryAt, unless it is out of
+// attempts or dead is set, in which case it is dead-lettered.
+func FailJob(db *gorm.DB, job Job, reason string, retryAt time.Time, dead bool, now time.Time) error {
+	updates := map[string]any{
+		"state":      JobPending,
+		"last_error": reason,
+		"run_at":     retryAt,
+	}
+	if dead || job.Attempts >= job.MaxAttempts {
+		updates = map[string]any{
+			"state":       JobDead,
+			"last_error":  reason,
+			"finished_at": now,
+		}
+	}
+	return db.Model(&Job{}).Where("id = ? AND state = ?", job.ID, JobRunning).Updates(updates).Error
+}
+
+// ReleaseJob puts a running job back without counting the attempt, for when its worker
+// is shutting down rather than the job failing
+func ReleaseJob(db *gorm.DB, id uint) error {
+	return db.Model(&Job{}).Where("id = ? AND state = ?", id, JobRunning).Updates(map[string]any{
+		"state":    JobPending,
+		"attempts": gorm.Expr("attempts - 1"),
+	}).Error
+}
+
+// RequeueWorkerJobs puts back the jobs a worker was running when it last stopped
+func RequeueWorkerJobs(db *gorm.DB, worker string, now time.Time) (int64, error) {
+	return requeueJobs(db, now, func(db *gorm.DB) *gorm.DB {
+		return db.Where("worker = ?", worker)
+	})
+}
+
+// RequeueStaleJobs puts back jobs that have been running since before cutoff, whose worker must have died
+func RequeueStaleJobs(db *gorm.DB, cutoff time.Time, now time.Time) (int64, error) {
+	return requeueJobs(db, now, func(db *gorm.DB) *gorm.DB {
+		return db.Where("started_at < ?", cutoff)
+	})
+}
+
+// requeueJobs puts back the running jobs in scope. Jobs that were on their last attempt
+// are dead-lettered instead, so a job that mustn't run twice doesn't.
+func requeueJobs(db *gorm.DB, now time.Time, scope func(*gorm.DB) *gorm.DB) (int64, error) {
+	var requeued int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Job{}).Scopes(scope).Where("state = ? AND attempts >= max_attempts", JobRunning).Updates(map[string]any{
+			"state":       JobDead,
+			"last_error":  "Interrupted on its last attempt",
+			"finished_at": now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Model(&Job{}).Scopes(scope).Where("state = ?", JobRunning).Update("state", JobPending)
+		requeued = result.RowsAffected
+		return result.Error
+	})
+	return requeued, err
+}
+
+// RetryJob runs a dead or pending job again right away with a fresh set of attempts
+func RetryJob(db *gorm.DB, id uint, now time.Time) (bool, error) {
+	result := db.Model(&Job{}).Where("id = ? AND state IN ?", id, []JobState{JobDead, JobPending}).Updates(map[string]any{
+		"state":       JobPending,
+		"attempts":    0,
+		"run_at":      now,
+		"finished_at": nil,
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeadLetterJob stops a pending job from running
+func DeadLetterJob(db *gorm.DB, id uint, reason string, now time.Time) (bool, error) {
+	result := db.Model(&Job{}).Where("id = ? AND state = ?", id, JobPending).Updates(map[string]any{
+		"state":       JobDead,
+		"last_error":  reason,
+		"finished_at": now,
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
+// JobsMatching scopes a job query to a state and kind, either of which may be empty to match all
+func JobsMatching(db *gorm.DB, state JobState, kind string) *gorm.DB {
+	if state != "" {
+		db = db.Where("state = ?", state)
+	}
+	if kind != "" {
+		db = db.Where("kind = ?", kind)
+	}
+	return db
+}
+
+func ListJobs(db *gorm.DB) ([]Job, error) {
+	var jobs []Job
+	err := db.Order("id desc").Find(&jobs).Error
+	return jobs, err
+}
+
+func CountJobs(db *gorm.DB) (int, error) {
+	var count int64
+	err := db.Model(&Job{}).Count(&count).Error
+	return int(count), err
+}
+
+func FindJobByID(db *gorm.DB, id uint) (Job, error) {
+	var job Job
+	err := db.First(&job, id).Error
+	return job, err
+}
+
+// PurgeFinishedJobs deletes succeeded and dead jobs that finished before cutoff
+func PurgeFinishedJobs(db *gorm.DB, cutoff time.Time) (int64, error) {
+	result := db.Where("state IN ? AND finished_at < ?", []JobState{JobSucceeded, JobDead}, cutoff).Delete(&Job{})
+	return result.RowsAffected, result.Error
+}
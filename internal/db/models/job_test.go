@@ -0,0 +1,178 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func TestClaimJob(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.Job{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	now := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	later := models.Job{Kind: "test", RunAt: now.Add(time.Minute), MaxAttempts: 3}
+	due := models.Job{Kind: "test", RunAt: now, MaxAttempts: 3}
+	other := models.Job{Kind: "other", RunAt: now, MaxAttempts: 3}
+	for _, job := range []*models.Job{&later, &due, &other} {
+		if err := models.EnqueueJob(db, job); err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+	}
+
+	job, ok, err := models.ClaimJob(db, "worker", []string{"test"}, now)
+	if err != nil || !ok || job.ID != due.ID || job.Attempts != 1 {
+		t.Fatalf("Expected to claim job %d, got %+v ok=%v err=%v", due.ID, job, ok, err)
+	}
+	// The other due job is a kind this worker can't run, and the last one isn't due yet
+	_, ok, err = models.ClaimJob(db, "worker", []string{"test"}, now)
+	if err != nil || ok {
+		t.Errorf("Expected nothing left to claim, got ok=%v err=%v", ok, err)
+	}
+
+	requeued, err := models.RequeueWorkerJobs(db, "worker", now)
+	if err != nil || requeued != 1 {
+		t.Errorf("Expected 1 job requeued, got %d err=%v", requeued, err)
+	}
+	job, ok, _ = models.ClaimJob(db, "worker", []string{"test"}, now)
+	if !ok || job.Attempts != 2 {
+		t.Errorf("Expected the requeued job to be claimed again, got %+v ok=%v", job, ok)
+	}
+}
+
+func TestFailJob(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.Job{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	now := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	job := models.Job{Kind: "test", RunAt: now, MaxAttempts: 2}
+	if err := models.EnqueueJob(db, &job); err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+
+	claimed, _, _ := models.ClaimJob(db, "worker", []string{"test"}, now)
+	if err := models.FailJob(db, claimed, "boom", now.Add(time.Minute), false, now); err != nil {
+		t.Fatalf("Failed to fail job: %v", err)
+	}
+	job, _ = models.FindJobByID(db, job.ID)
+	if job.State != models.JobPending || job.LastError != "boom" || !job.RunAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("Expected job to be retried later, got %+v", job)
+	}
+
+	// The second failure uses up the last attempt
+	claimed, _, _ = models.ClaimJob(db, "worker", []string{"test"}, now.Add(time.Minute))
+	if err := models.FailJob(db, claimed, "boom again", now.Add(time.Hour), false, now); err != nil {
+		t.Fatalf("Failed to fail job: %v", err)
+	}
+	job, _ = models.FindJobByID(db, job.ID)
+	if job.State != models.JobDead {
+		t.Errorf("Expected job to be dead-lettered, got %s", job.State)
+	}
+
+	retried, err := models.RetryJob(db, job.ID, now)
+	if err != nil || !retried {
+		t.Fatalf("Expected job to be retried, got %v err=%v", retried, err)
+	}
+	job, _ = models.FindJobByID(db, job.ID)
+	if job.State != models.JobPending || job.Attempts != 0 {
+		t.Errorf("Expected a fresh pending job, got %+v", job)
+	}
+}
+
+func TestEnqueueUniqueJob(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.Job{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	created, err := models.EnqueueUniqueJob(db, &models.Job{Kind: "test"})
+	if err != nil || !created {
+		t.Fatalf("Expected first job to be created, got %v err=%v", created, err)
+	}
+	created, err = models.EnqueueUniqueJob(db, &models.Job{Kind: "test"})
+	if err != nil || created {
+		t.Errorf("Expected duplicate job to be skipped, got %v err=%v", created, err)
+	}
+	// The index holds even for a replica that skips the conflict handling
+	key := "test"
+	if err := db.Create(&models.Job{Kind: "test", State: models.JobPending, UniqueKey: &key}).Error; err == nil {
+		t.Error("Expected the unique index to refuse a second pending job")
+	}
+	// Jobs that aren't unique don't count
+	if err := models.EnqueueJob(db, &models.Job{Kind: "test"}); err != nil {
+		t.Errorf("Expected a job that isn't unique to be queued, got %v", err)
+	}
+
+	now := time.Now()
+	job, ok, err := models.ClaimJob(db, "worker", []string{"test"}, now)
+	if err != nil || !ok {
+		t.Fatalf("Failed to claim job: ok=%v err=%v", ok, err)
+	}
+	created, err = models.EnqueueUniqueJob(db, &models.Job{Kind: "test"})
+	if err != nil || created {
+		t.Errorf("Expected a running job to block a duplicate, got %v err=%v", created, err)
+	}
+	if err := models.CompleteJob(db, job.ID, now); err != nil {
+		t.Fatalf("Failed to complete job: %v", err)
+	}
+	created, err = models.EnqueueUniqueJob(db, &models.Job{Kind: "test"})
+	if err != nil || !created {
+		t.Errorf("Expected a new job once the last one finished, got %v err=%v", created, err)
+	}
+}
+
+func TestRequeueDeadLettersLastAttempts(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.Job{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	now := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	once := models.Job{Kind: "once", RunAt: now, MaxAttempts: 1}
+	retried := models.Job{Kind: "retried", RunAt: now, MaxAttempts: 3}
+	for _, job := range []*models.Job{&once, &retried} {
+		if err := models.EnqueueJob(db, job); err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+		if _, ok, err := models.ClaimJob(db, "worker", []string{job.Kind}, now); err != nil || !ok {
+			t.Fatalf("Failed to claim job: ok=%v err=%v", ok, err)
+		}
+	}
+
+	requeued, err := models.RequeueStaleJobs(db, now.Add(time.Minute), now.Add(time.Hour))
+	if err != nil || requeued != 1 {
+		t.Errorf("Expected only the job with attempts left to be requeued, got %d err=%v", requeued, err)
+	}
+	once, _ = models.FindJobByID(db, once.ID)
+	if once.State != models.JobDead {
+		t.Errorf("Expected the single attempt job to be dead-lettered, got %+v", once)
+	}
+	retried, _ = models.FindJobByID(db, retried.ID)
+	if retried.State != models.JobPending {
+		t.Errorf("Expected the retried job to be pending, got %+v", retried)
+	}
+}
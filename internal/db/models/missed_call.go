@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MissedCall is a private call to a user that they didn't return
+type MissedCall struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	UserID    uint           `json:"-" gorm:"index"`
+	CallerID  uint           `json:"-"`
+	Caller    User           `json:"caller" gorm:"foreignKey:CallerID"`
+	CallID    uint           `json:"call_id"`
+	CallTime  time.Time      `json:"call_time"`
+	Seen      bool           `json:"seen"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"-"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+func FindMissedCalls(db *gorm.DB, userID uint) ([]MissedCall, error) {
+	var missedCalls []MissedCall
+	err := db.Preload("Caller").Where("user_id = ?", userID).Order("call_time desc").Find(&missedCalls).Error
+	return missedCalls, err
+}
+
+func CountUnseenMissedCalls(db *gorm.DB, userID uint) (int, error) {
+	var count int64
+	err := db.Model(&MissedCall{}).Where("user_id = ? AND seen = ?", userID, false).Count(&count).Error
+	return int(count), err
+}
+
+func MarkMissedCallsSeen(db *gorm.DB, userID uint) error {
+	return db.Model(&MissedCall{}).Where("user_id = ? AND seen = ?", userID, false).Update("seen", true).Error
+}
+
+func DeleteMissedCallsForUser(db *gorm.DB, userID uint) error {
+	return db.Unscoped().Where("user_id = ? OR caller_id = ?", userID, userID).Delete(&MissedCall{}).Error
+}
+
+// CallReturned reports whether a user placed a private call back to the caller after the call started
+func CallReturned(db *gorm.DB, call Call) (bool, error) {
+	var count int64
+	err := db.Model(&Call{}).Where("user_id = ? AND destination_id = ? AND group_call = ? AND start_time > ?", call.DestinationID, call.UserID, false, call.StartTime).
+		Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func TestMissedCallsSeen(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	now := time.Now()
+	db.Create(&[]models.MissedCall{
+		{UserID: 1, CallerID: 2, CallID: 10, CallTime: now.Add(-2 * time.Minute)},
+		{UserID: 1, CallerID: 3, CallID: 11, CallTime: now.Add(-time.Minute)},
+		{UserID: 2, CallerID: 1, CallID: 12, CallTime: now},
+	})
+
+	missed, err := models.FindMissedCalls(db, 1)
+	if err != nil || len(missed) != 2 || missed[0].CallID != 11 {
+		t.Fatalf("Expected user 1's missed calls newest first, got %+v, %v", missed, err)
+	}
+	if count, err := models.CountUnseenMissedCalls(db, 1); err != nil || count != 2 {
+		t.Errorf("Expected 2 unseen, got %d, %v", count, err)
+	}
+
+	if err := models.MarkMissedCallsSeen(db, 1); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := models.CountUnseenMissedCalls(db, 1); count != 0 {
+		t.Errorf("Expected none unseen after marking, got %d", count)
+	}
+	if count, _ := models.CountUnseenMissedCalls(db, 2); count != 1 {
+		t.Errorf("Expected other users' calls to stay unseen, got %d", count)
+	}
+
+	// Deleting a user removes the calls they missed and the ones they placed
+	if err := models.DeleteMissedCallsForUser(db, 1); err != nil {
+		t.Fatal(err)
+	}
+	var remaining int64
+	db.Unscoped().Model(&models.MissedCall{}).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("Expected every missed call involving user 1 to be deleted, %d remain", remaining)
+	}
+}
+
+func TestCallReturned(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	start := time.Now().Add(-time.Hour)
+	call := models.Call{ID: 1, UserID: 1, IsToUser: true, DestinationID: 2, StartTime: start}
+	db.Create(&call)
+	// Calls before the missed one, and group calls, don't count as calling back
+	db.Create(&models.Call{ID: 2, UserID: 2, IsToUser: true, DestinationID: 1, StartTime: start.Add(-time.Minute)})
+	db.Create(&models.Call{ID: 3, UserID: 2, GroupCall: true, DestinationID: 1, StartTime: start.Add(time.Minute)})
+
+	if returned, err := models.CallReturned(db, call); err != nil || returned {
+		t.Errorf("Expected the call not to be returned, got %v, %v", returned, err)
+	}
+	db.Create(&models.Call{ID: 4, UserID: 2, IsToUser: true, DestinationID: 1, StartTime: start.Add(time.Minute)})
+	if returned, err := models.CallReturned(db, call); err != nil || !returned {
+		t.Errorf("Expected the call to be returned, got %v, %v", returned, err)
+	}
+}
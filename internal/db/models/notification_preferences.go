@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// NotificationEvent is something a user can be notified about
+type NotificationEvent string
+
+const (
+	NotificationMissedCall      NotificationEvent = "missed_call"
+	NotificationRepeaterOffline NotificationEvent = "repeater_offline"
+	NotificationQuota           NotificationEvent = "quota"
+)
+
+// NotificationChannels selects how a user is told about one kind of event
+type NotificationChannels struct {
+	Email     bool `json:"email"`
+	Webhook   bool `json:"webhook"`
+	WebSocket bool `json:"websocket" gorm:"column:websocket"`
+}
+
+// NotificationPreferences controls which channels fire for which events.
+// Like DigestSubscription, addresses are kept here rather than on User so they never end up in public data.
+type NotificationPreferences struct {
+	UserID          uint                 `json:"-" gorm:"primaryKey;autoIncrement:false"`
+	Email           string               `json:"email"`
+	WebhookURL      string               `json:"webhook_url"`
+	MissedCall      NotificationChannels `json:"missed_call" gorm:"embedded;embeddedPrefix:missed_call_"`
+	RepeaterOffline NotificationChannels `json:"repeater_offline" gorm:"embedded;embeddedPrefix:repeater_offline_"`
+	Quota           NotificationChannels `json:"quota" gorm:"embedded;embeddedPrefix:quota_"`
+	CreatedAt       time.Time            `json:"-"`
+	UpdatedAt       time.Time            `json:"-"`
+}
+
+// DefaultNotificationPreferences is what users who never saved preferences get:
+// missed calls and talk time quota warnings in the browser, and nothing else
+func DefaultNotificationPreferences(userID uint) NotificationPreferences {
+	return NotificationPreferences{
+		UserID:     userID,
+		MissedCall: NotificationChannels{WebSocket: true},
+		Quota:      NotificationChannels{WebSocket: true},
+	}
+}
+
+// Channels returns the channels enabled for an event
+func (p *NotificationPreferences) Channels(event NotificationEvent) NotificationChannels {
+	switch event {
+	case NotificationMissedCall:
+		return p.MissedCall
+	case NotificationRepeaterOffline:
+		return p.RepeaterOffline
+	case NotificationQuota:
+		return p.Quota
+	}
+	return NotificationChannels{}
+}
+
+// FindNotificationPreferences returns the user's preferences, or the defaults if they haven't saved any
+func FindNotificationPreferences(db *gorm.DB, userID uint) (NotificationPreferences, error) {
+	var preferences []NotificationPreferences
+	err := db.Where("user_id = ?", userID).Limit(1).Find(&preferences).Error
+	if err != nil || len(preferences) == 0 {
+		return DefaultNotificationPreferences(userID), err
+	}
+	return preferences[0], nil
+}
+
+// ListUsersNotifiedOf returns the preferences of every user with at least one channel enabled for an event
+func ListUsersNotifiedOf(db *gorm.DB, event NotificationEvent) ([]NotificationPreferences, error) {
+	prefix := string(event) + "_"
+	var preferences []NotificationPreferences
+	err := db.Where(prefix+"email = ? OR "+prefix+"webhook = ? OR "+prefix+"websocket = ?", true, true, true).
+		Order("user_id asc").Find(&preferences).Error
+	return preferences, err
+}
+
+func DeleteNotificationPreferences(db *gorm.DB, userID uint) error {
+	return db.Where("user_id = ?", userID).Delete(&NotificationPreferences{}).Error
+}
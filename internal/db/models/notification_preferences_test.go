@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func TestNotificationPreferences(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.NotificationPreferences{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	preferences, err := models.FindNotificationPreferences(db, 1)
+	if err != nil {
+		t.Fatalf("Failed to find preferences: %v", err)
+	}
+	if channels := preferences.Channels(models.NotificationMissedCall); !channels.WebSocket || channels.Email || channels.Webhook {
+		t.Errorf("Expected missed calls over the websocket by default, got %+v", channels)
+	}
+	if channels := preferences.Channels(models.NotificationRepeaterOffline); channels.WebSocket || channels.Email || channels.Webhook {
+		t.Errorf("Expected no repeater offline notifications by default, got %+v", channels)
+	}
+	if channels := preferences.Channels(models.NotificationQuota); !channels.WebSocket || channels.Email || channels.Webhook {
+		t.Errorf("Expected quota warnings over the websocket by default, got %+v", channels)
+	}
+
+	db.Create(&models.NotificationPreferences{UserID: 1, WebhookURL: "https://example.com", RepeaterOffline: models.NotificationChannels{Webhook: true}})
+	db.Create(&models.NotificationPreferences{UserID: 2})
+	subscribers, err := models.ListUsersNotifiedOf(db, models.NotificationRepeaterOffline)
+	if err != nil || len(subscribers) != 1 || subscribers[0].UserID != 1 {
+		t.Errorf("Expected only user 1 to be notified of offline repeaters, got %+v err=%v", subscribers, err)
+	}
+
+	preferences, _ = models.FindNotificationPreferences(db, 2)
+	if preferences.Channels(models.NotificationMissedCall).WebSocket {
+		t.Error("Expected saved preferences to replace the defaults")
+	}
+
+	if err := models.DeleteNotificationPreferences(db, 1); err != nil {
+		t.Fatalf("Failed to delete preferences: %v", err)
+	}
+	if subscribers, _ := models.ListUsersNotifiedOf(db, models.NotificationRepeaterOffline); len(subscribers) != 0 {
+		t.Errorf("Expected no subscribers after deleting preferences, got %+v", subscribers)
+	}
+}
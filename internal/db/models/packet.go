@@ -44,6 +44,9 @@ type Packet struct {
 	// We also want to be able to represent -1 as a null, so we use int
 	BER  int `msg:"ber"`
 	RSSI int `msg:"rssi"`
+	// Codec is what DMRData is encoded with. It isn't part of the HBRP
+	// encoding, so packets read off the wire are always AMBE.
+	Codec dmrconst.Codec `msg:"codec,extension"`
 }
 
 func (p Packet) Equal(other Packet) bool {
@@ -86,6 +89,9 @@ func (p Packet) Equal(other Packet) bool {
 	if p.RSSI != other.RSSI {
 		return false
 	}
+	if p.Codec != other.Codec {
+		return false
+	}
 	return true
 }
 
@@ -31,18 +31,20 @@ import (
 //
 //go:generate go run github.com/tinylib/msgp
 type Peer struct {
-	ID        uint           `json:"id" gorm:"primaryKey" msg:"id"`
-	LastPing  time.Time      `json:"last_ping_time" msg:"last_ping"`
-	IP        string         `json:"-" gorm:"-" msg:"ip"`
-	Port      int            `json:"-" gorm:"-" msg:"port"`
-	Password  string         `json:"-" msg:"-"`
-	Owner     User           `json:"owner" gorm:"foreignKey:OwnerID" msg:"-"`
-	OwnerID   uint           `json:"-" msg:"-"`
-	Ingress   bool           `json:"ingress" msg:"-"`
-	Egress    bool           `json:"egress" msg:"-"`
-	CreatedAt time.Time      `json:"created_at" msg:"-"`
-	UpdatedAt time.Time      `json:"-" msg:"-"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index" msg:"-"`
+	ID          uint           `json:"id" gorm:"primaryKey" msg:"id"`
+	LastPing    time.Time      `json:"last_ping_time" msg:"last_ping"`
+	IP          string         `json:"-" gorm:"-" msg:"ip"`
+	Port        int            `json:"-" gorm:"-" msg:"port"`
+	Password    string         `json:"-" msg:"-"`
+	Owner       User           `json:"owner" gorm:"foreignKey:OwnerID" msg:"-"`
+	OwnerID     uint           `json:"-" msg:"-"`
+	Ingress     bool           `json:"ingress" msg:"-"`
+	Egress      bool           `json:"egress" msg:"-"`
+	MaxDatagram uint           `json:"max_datagram" msg:"max_datagram"`
+	Network     string         `json:"network" msg:"network"`
+	CreatedAt   time.Time      `json:"created_at" msg:"-"`
+	UpdatedAt   time.Time      `json:"-" msg:"-"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index" msg:"-"`
 }
 
 func (p *Peer) String() string {
@@ -19,6 +19,8 @@
 
 package models
 
+import "github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+
 // RawDMRPacket is a raw DMR packet
 //
 //go:generate go run github.com/tinylib/msgp
@@ -26,4 +28,7 @@ type RawDMRPacket struct {
 	Data       []byte `msg:"data"`
 	RemoteIP   string `msg:"remote_ip"`
 	RemotePort int    `msg:"remote_port"`
+	// Codec is the codec of the payload in Data, which bridges from other
+	// modes set when they publish to a talkgroup
+	Codec dmrconst.Codec `msg:"codec,extension"`
 }
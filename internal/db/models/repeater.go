@@ -41,6 +41,8 @@ type Repeater struct {
 	IP                    string         `json:"-" gorm:"-" msg:"ip"`
 	Port                  int            `json:"-" gorm:"-" msg:"port"`
 	Salt                  uint32         `json:"-" gorm:"-" msg:"salt"`
+	Extensions            uint32         `json:"-" gorm:"-" msg:"extensions"`
+	Codecs                uint32         `json:"-" gorm:"-" msg:"codecs"`
 	Password              string         `json:"-" msg:"-"`
 	TS1StaticTalkgroups   []Talkgroup    `json:"ts1_static_talkgroups" gorm:"many2many:repeater_ts1_static_talkgroups;" msg:"-"`
 	TS2StaticTalkgroups   []Talkgroup    `json:"ts2_static_talkgroups" gorm:"many2many:repeater_ts2_static_talkgroups;" msg:"-"`
@@ -51,12 +53,38 @@ type Repeater struct {
 	Owner                 User           `json:"owner" gorm:"foreignKey:OwnerID" msg:"-"`
 	OwnerID               uint           `json:"-" msg:"-"`
 	Hotspot               bool           `json:"hotspot" msg:"hotspot"`
+	SkipTalkgroupProfile  bool           `json:"skip_talkgroup_profile" msg:"-"`
+	ExpectedColorCode     *uint8         `json:"expected_color_code" msg:"-"`
+	MaxDatagram           uint           `json:"max_datagram" msg:"-"`
+	Network               string         `json:"network" msg:"-"`
+	KeepaliveInterval     uint           `json:"keepalive_interval" msg:"keepalive_interval"`
 	CreatedAt             time.Time      `json:"created_at" msg:"-"`
 	UpdatedAt             time.Time      `json:"-" msg:"-"`
 	DeletedAt             gorm.DeletedAt `json:"-" gorm:"index" msg:"-"`
 	RepeaterConfiguration
 }
 
+// DefaultPingTimeout is how long a repeater without a keepalive interval can go without pinging before it's considered disconnected
+const DefaultPingTimeout = 5 * time.Minute
+
+// MissedPingLimit is how many pings in a row a repeater with a keepalive interval can miss before it's considered disconnected
+const MissedPingLimit = 5
+
+// Keepalive intervals a repeater can be given, in seconds. Cellular hotspots
+// behind NAT often need to ping more often than every 20 seconds to keep their mapping.
+const (
+	MinKeepaliveInterval = 1
+	MaxKeepaliveInterval = 60
+)
+
+// PingTimeout is how long the repeater can go without pinging before it's considered disconnected
+func (p *Repeater) PingTimeout() time.Duration {
+	if p.KeepaliveInterval == 0 {
+		return DefaultPingTimeout
+	}
+	return time.Duration(p.KeepaliveInterval) * time.Second * MissedPingLimit
+}
+
 func (p *Repeater) String() string {
 	jsn, err := json.Marshal(p)
 	if err != nil {
@@ -74,6 +102,28 @@ func ListRepeaters(db *gorm.DB) ([]Repeater, error) {
 	return repeaters, err
 }
 
+// ListRepeatersForSubscriptions loads only what's needed to subscribe every repeater
+// to its talkgroups, so a hub with hundreds of repeaters can start with a few queries
+func ListRepeatersForSubscriptions(db *gorm.DB) ([]Repeater, error) {
+	var repeaters []Repeater
+	idOnly := func(db *gorm.DB) *gorm.DB { return db.Select("id") }
+	err := db.Select("id", "ts1_dynamic_talkgroup_id", "ts2_dynamic_talkgroup_id").
+		Preload("TS1StaticTalkgroups", idOnly).Preload("TS2StaticTalkgroups", idOnly).
+		Order("id asc").Find(&repeaters).Error
+	return repeaters, err
+}
+
+// ListRepeaterIDsWantingTalkgroup lists the repeaters with a talkgroup as a static or dynamic talkgroup
+func ListRepeaterIDsWantingTalkgroup(db *gorm.DB, talkgroupID uint) ([]uint, error) {
+	var ids []uint
+	err := db.Model(&Repeater{}).
+		Where("ts1_dynamic_talkgroup_id = ? OR ts2_dynamic_talkgroup_id = ?", talkgroupID, talkgroupID).
+		Or("id IN (?)", db.Table("repeater_ts1_static_talkgroups").Select("repeater_id").Where("talkgroup_id = ?", talkgroupID)).
+		Or("id IN (?)", db.Table("repeater_ts2_static_talkgroups").Select("repeater_id").Where("talkgroup_id = ?", talkgroupID)).
+		Order("id asc").Pluck("id", &ids).Error
+	return ids, err
+}
+
 func CountRepeaters(db *gorm.DB) (int, error) {
 	var count int64
 	err := db.Model(&Repeater{}).Count(&count).Error
@@ -113,8 +163,15 @@ func RepeaterIDExists(db *gorm.DB, id uint) (bool, error) {
 func DeleteRepeater(db *gorm.DB, id uint) error {
 	err := db.Transaction(func(tx *gorm.DB) error {
 		tx.Unscoped().Where("(is_to_repeater = ? AND to_repeater_id = ?) OR repeater_id = ?", true, id, id).Delete(&Call{})
+		tx.Where("call_id NOT IN (?)", tx.Unscoped().Model(&Call{}).Select("id")).Delete(&CallTelemetry{})
+		tx.Unscoped().Table("repeater_group_repeaters").Where("repeater_id = ?", id).Delete(&RepeaterGroup{})
+		tx.Unscoped().Where("repeater_id = ?", id).Delete(&RepeaterPermission{})
+		tx.Where("repeater_id = ?", id).Delete(&TalkgroupAllowedRepeater{})
+		tx.Unscoped().Where("repeater_id = ?", id).Delete(&RepeaterSession{})
+		tx.Where("repeater_id = ? OR linked_repeater_id = ?", id, id).Delete(&RepeaterLink{})
+		tx.Where("kind = ? AND object_id = ?", ConfigVersionRepeater, id).Delete(&ConfigVersion{})
 		tx.Unscoped().Where("id = ?", id).Select(clause.Associations, "TS1StaticTalkgroups").Select(clause.Associations, "TS2StaticTalkgroups").Delete(&Repeater{})
-		return nil
+		return recordTombstones(tx, TombstoneRepeater, id)
 	})
 	if err != nil {
 		logging.Errorf("Error deleting repeater: %s", err)
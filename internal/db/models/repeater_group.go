@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RepeaterGroup is a site or cluster of repeaters that can be managed together.
+// Traffic to members of a simulcast group is held for SimulcastWindowMS, less each
+// repeater's latency, so they all transmit together. A zero window uses the server default.
+type RepeaterGroup struct {
+	ID                uint           `json:"id" gorm:"primaryKey"`
+	Name              string         `json:"name" gorm:"uniqueIndex"`
+	Description       string         `json:"description"`
+	Repeaters         []Repeater     `json:"repeaters" gorm:"many2many:repeater_group_repeaters;"`
+	Simulcast         bool           `json:"simulcast"`
+	SimulcastWindowMS uint           `json:"simulcast_window_ms"`
+	LatencyMS         map[uint]int64 `json:"latency_ms,omitempty" gorm:"-"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"-"`
+	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+func ListRepeaterGroups(db *gorm.DB) ([]RepeaterGroup, error) {
+	var groups []RepeaterGroup
+	err := db.Preload("Repeaters").Order("id asc").Find(&groups).Error
+	return groups, err
+}
+
+func CountRepeaterGroups(db *gorm.DB) (int, error) {
+	var count int64
+	err := db.Model(&RepeaterGroup{}).Count(&count).Error
+	return int(count), err
+}
+
+// RepeatersInGroup scopes a repeater query to the members of a group
+func RepeatersInGroup(db *gorm.DB, groupID uint) *gorm.DB {
+	return db.Where("repeaters.id IN (SELECT repeater_id FROM repeater_group_repeaters WHERE repeater_group_id = ?)", groupID)
+}
+
+func RepeaterGroupIDExists(db *gorm.DB, id uint) (bool, error) {
+	var count int64
+	err := db.Model(&RepeaterGroup{}).Where("id = ?", id).Limit(1).Count(&count).Error
+	return count > 0, err
+}
+
+func FindRepeaterGroupByID(db *gorm.DB, id uint) (RepeaterGroup, error) {
+	var group RepeaterGroup
+	err := db.Preload("Repeaters").Preload("Repeaters.Owner").First(&group, id).Error
+	return group, err
+}
+
+// FindRepeaterGroupsForRepeater returns the groups that a repeater is a member of
+func FindRepeaterGroupsForRepeater(db *gorm.DB, repeaterID uint) ([]RepeaterGroup, error) {
+	var groups []RepeaterGroup
+	err := db.Joins("JOIN repeater_group_repeaters on repeater_group_repeaters.repeater_group_id=repeater_groups.id").
+		Where("repeater_group_repeaters.repeater_id = ?", repeaterID).
+		Order("repeater_groups.id asc").Find(&groups).Error
+	return groups, err
+}
+
+// FindSimulcastWindow returns the longest simulcast window of the groups a repeater is in, or false if none are simulcast
+func FindSimulcastWindow(db *gorm.DB, repeaterID uint, defaultWindow time.Duration) (time.Duration, bool, error) {
+	var windows []uint
+	err := db.Model(&RepeaterGroup{}).
+		Joins("JOIN repeater_group_repeaters on repeater_group_repeaters.repeater_group_id=repeater_groups.id").
+		Where("repeater_group_repeaters.repeater_id = ? AND repeater_groups.simulcast = ?", repeaterID, true).
+		Pluck("simulcast_window_ms", &windows).Error
+	if err != nil || len(windows) == 0 {
+		return 0, false, err
+	}
+	var longest time.Duration
+	for _, ms := range windows {
+		window := time.Duration(ms) * time.Millisecond
+		if ms == 0 {
+			window = defaultWindow
+		}
+		longest = max(longest, window)
+	}
+	return longest, true, nil
+}
+
+func DeleteRepeaterGroup(db *gorm.DB, id uint) error {
+	err := db.Unscoped().Select(clause.Associations, "Repeaters").Delete(&RepeaterGroup{ID: id}).Error
+	if err != nil {
+		logging.Errorf("Error deleting repeater group: %s", err)
+		return err
+	}
+	return nil
+}
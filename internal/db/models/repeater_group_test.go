@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func TestFindSimulcastWindow(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.RepeaterGroup{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	repeaters := []models.Repeater{{RepeaterConfiguration: models.RepeaterConfiguration{ID: 311001}}, {RepeaterConfiguration: models.RepeaterConfiguration{ID: 311002}}}
+	if err := db.Create(&repeaters).Error; err != nil {
+		t.Fatalf("Failed to create repeaters: %v", err)
+	}
+	groups := []models.RepeaterGroup{
+		{Name: "site", Repeaters: repeaters[:1]},
+		{Name: "simulcast", Simulcast: true, Repeaters: repeaters},
+		{Name: "slow simulcast", Simulcast: true, SimulcastWindowMS: 400, Repeaters: repeaters[1:]},
+	}
+	if err := db.Create(&groups).Error; err != nil {
+		t.Fatalf("Failed to create groups: %v", err)
+	}
+
+	window, enabled, err := models.FindSimulcastWindow(db, 311001, 250*time.Millisecond)
+	if err != nil || !enabled || window != 250*time.Millisecond {
+		t.Errorf("Expected the default window, got %s %v (%v)", window, enabled, err)
+	}
+	window, enabled, _ = models.FindSimulcastWindow(db, 311002, 250*time.Millisecond)
+	if !enabled || window != 400*time.Millisecond {
+		t.Errorf("Expected the longest window, got %s %v", window, enabled)
+	}
+	if _, enabled, _ = models.FindSimulcastWindow(db, 311003, 250*time.Millisecond); enabled {
+		t.Error("Expected repeaters outside simulcast groups not to be delayed")
+	}
+}
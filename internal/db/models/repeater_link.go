@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RepeaterLink bridges every call on one time slot between two repeaters,
+// regardless of the destination. TimeSlot is true for TS2, matching Call.
+// A nil ExpiresAt keeps the link until it is torn down.
+type RepeaterLink struct {
+	ID               uint       `json:"id" gorm:"primaryKey"`
+	RepeaterID       uint       `json:"repeater_id" gorm:"index"`
+	LinkedRepeaterID uint       `json:"linked_repeater_id" gorm:"index"`
+	TimeSlot         bool       `json:"time_slot"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+	CreatedByID      uint       `json:"created_by_id"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// Active reports whether the link hasn't expired
+func (l *RepeaterLink) Active(now time.Time) bool {
+	return l.ExpiresAt == nil || l.ExpiresAt.After(now)
+}
+
+// Peer returns the repeater on the other end of the link
+func (l *RepeaterLink) Peer(repeaterID uint) uint {
+	if l.RepeaterID == repeaterID {
+		return l.LinkedRepeaterID
+	}
+	return l.RepeaterID
+}
+
+func activeRepeaterLinks(db *gorm.DB, repeaterID uint, now time.Time) *gorm.DB {
+	return db.Where("(repeater_id = ? OR linked_repeater_id = ?) AND (expires_at IS NULL OR expires_at > ?)", repeaterID, repeaterID, now)
+}
+
+// ListRepeaterLinks returns the unexpired links on either end of a repeater
+func ListRepeaterLinks(db *gorm.DB, repeaterID uint, now time.Time) ([]RepeaterLink, error) {
+	var links []RepeaterLink
+	err := activeRepeaterLinks(db, repeaterID, now).Order("id asc").Find(&links).Error
+	return links, err
+}
+
+// ListActiveRepeaterLinks returns every unexpired link
+func ListActiveRepeaterLinks(db *gorm.DB, now time.Time) ([]RepeaterLink, error) {
+	var links []RepeaterLink
+	err := db.Where("expires_at IS NULL OR expires_at > ?", now).Order("id asc").Find(&links).Error
+	return links, err
+}
+
+// FindLinkedRepeaterIDs returns the repeaters bridged to a repeater on a time slot
+func FindLinkedRepeaterIDs(db *gorm.DB, repeaterID uint, slot bool, now time.Time) ([]uint, error) {
+	var links []RepeaterLink
+	err := activeRepeaterLinks(db, repeaterID, now).Where("time_slot = ?", slot).Find(&links).Error
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(links))
+	for _, link := range links {
+		ids = append(ids, link.Peer(repeaterID))
+	}
+	return ids, nil
+}
+
+// RepeatersLinked reports whether two repeaters are bridged on a time slot
+func RepeatersLinked(db *gorm.DB, repeaterID uint, otherID uint, slot bool, now time.Time) (bool, error) {
+	var count int64
+	err := db.Model(&RepeaterLink{}).
+		Where("((repeater_id = ? AND linked_repeater_id = ?) OR (repeater_id = ? AND linked_repeater_id = ?))", repeaterID, otherID, otherID, repeaterID).
+		Where("time_slot = ? AND (expires_at IS NULL OR expires_at > ?)", slot, now).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// FindRepeaterLink returns a link by ID if it involves the repeater
+func FindRepeaterLink(db *gorm.DB, repeaterID uint, linkID uint) (RepeaterLink, bool, error) {
+	var links []RepeaterLink
+	err := db.Where("id = ? AND (repeater_id = ? OR linked_repeater_id = ?)", linkID, repeaterID, repeaterID).Limit(1).Find(&links).Error
+	if err != nil || len(links) == 0 {
+		return RepeaterLink{}, false, err
+	}
+	return links[0], true, nil
+}
+
+func DeleteRepeaterLink(db *gorm.DB, linkID uint) error {
+	return db.Where("id = ?", linkID).Delete(&RepeaterLink{}).Error
+}
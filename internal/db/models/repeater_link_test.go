@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func TestRepeaterLinks(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.RepeaterLink{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	now := time.Now()
+	expired := now.Add(-time.Minute)
+
+	links := []models.RepeaterLink{
+		{RepeaterID: 311001, LinkedRepeaterID: 311002, TimeSlot: true},
+		{RepeaterID: 311003, LinkedRepeaterID: 311001, TimeSlot: true},
+		{RepeaterID: 311001, LinkedRepeaterID: 311004, TimeSlot: false},
+		{RepeaterID: 311001, LinkedRepeaterID: 311005, TimeSlot: true, ExpiresAt: &expired},
+	}
+	if err := db.Create(&links).Error; err != nil {
+		t.Fatalf("Failed to create links: %v", err)
+	}
+
+	ids, err := models.FindLinkedRepeaterIDs(db, 311001, true, now)
+	if err != nil {
+		t.Fatalf("Failed to find linked repeaters: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != 311002 || ids[1] != 311003 {
+		t.Errorf("Expected TS2 links to 311002 and 311003, got %v", ids)
+	}
+
+	linked, err := models.RepeatersLinked(db, 311002, 311001, true, now)
+	if err != nil || !linked {
+		t.Errorf("Expected links to work in both directions (%v)", err)
+	}
+	linked, _ = models.RepeatersLinked(db, 311001, 311002, false, now)
+	if linked {
+		t.Error("Expected links to be scoped to their slot")
+	}
+	linked, _ = models.RepeatersLinked(db, 311001, 311005, true, now)
+	if linked {
+		t.Error("Expected expired links to be ignored")
+	}
+
+	active, err := models.ListRepeaterLinks(db, 311001, now)
+	if err != nil || len(active) != 3 {
+		t.Errorf("Expected 3 active links, got %d (%v)", len(active), err)
+	}
+
+	if _, found, _ := models.FindRepeaterLink(db, 311004, links[0].ID); found {
+		t.Error("Expected a link not to be found from an unrelated repeater")
+	}
+}
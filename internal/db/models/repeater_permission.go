@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RepeaterPermissionType is a single delegated capability on a repeater
+type RepeaterPermissionType string
+
+const (
+	RepeaterPermissionEditTalkgroups RepeaterPermissionType = "edit_talkgroups"
+	RepeaterPermissionViewStats      RepeaterPermissionType = "view_stats"
+	RepeaterPermissionRotatePassword RepeaterPermissionType = "rotate_password"
+)
+
+// RepeaterPermission grants a user that doesn't own a repeater some management rights over it
+type RepeaterPermission struct {
+	ID             uint           `json:"id" gorm:"primaryKey"`
+	RepeaterID     uint           `json:"repeater_id" gorm:"uniqueIndex:idx_repeater_permission_user"`
+	UserID         uint           `json:"-" gorm:"uniqueIndex:idx_repeater_permission_user"`
+	User           User           `json:"user" gorm:"foreignKey:UserID"`
+	EditTalkgroups bool           `json:"edit_talkgroups"`
+	ViewStats      bool           `json:"view_stats"`
+	RotatePassword bool           `json:"rotate_password"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"-"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// Has reports whether the permission grants the given capability
+func (p *RepeaterPermission) Has(permission RepeaterPermissionType) bool {
+	switch permission {
+	case RepeaterPermissionEditTalkgroups:
+		return p.EditTalkgroups
+	case RepeaterPermissionViewStats:
+		return p.ViewStats
+	case RepeaterPermissionRotatePassword:
+		return p.RotatePassword
+	default:
+		return false
+	}
+}
+
+func ListRepeaterPermissions(db *gorm.DB, repeaterID uint) ([]RepeaterPermission, error) {
+	var permissions []RepeaterPermission
+	err := db.Preload("User").Where("repeater_id = ?", repeaterID).Order("id asc").Find(&permissions).Error
+	return permissions, err
+}
+
+// FindRepeaterPermission returns the permission a user holds on a repeater, if any
+func FindRepeaterPermission(db *gorm.DB, repeaterID uint, userID uint) (RepeaterPermission, bool, error) {
+	var permissions []RepeaterPermission
+	err := db.Where("repeater_id = ? AND user_id = ?", repeaterID, userID).Limit(1).Find(&permissions).Error
+	if err != nil || len(permissions) == 0 {
+		return RepeaterPermission{}, false, err
+	}
+	return permissions[0], true, nil
+}
+
+// UserCanManageRepeater reports whether a user is an admin, owns the repeater, or holds the permission on it
+func UserCanManageRepeater(db *gorm.DB, user User, repeaterID uint, permission RepeaterPermissionType) (bool, error) {
+	if user.Admin {
+		return true, nil
+	}
+	var repeaters []Repeater
+	err := db.Where("id = ?", repeaterID).Limit(1).Find(&repeaters).Error
+	if err != nil || len(repeaters) == 0 {
+		return false, err
+	}
+	if repeaters[0].OwnerID == user.ID {
+		return true, nil
+	}
+	perm, found, err := FindRepeaterPermission(db, repeaterID, user.ID)
+	if err != nil || !found {
+		return false, err
+	}
+	return perm.Has(permission), nil
+}
+
+func DeleteRepeaterPermission(db *gorm.DB, repeaterID uint, userID uint) error {
+	return db.Unscoped().Where("repeater_id = ? AND user_id = ?", repeaterID, userID).Delete(&RepeaterPermission{}).Error
+}
@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func TestUserCanManageRepeater(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.RepeaterPermission{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	admin := models.User{ID: 1, Callsign: "N0ADM", Username: "n0adm", Admin: true}
+	owner := models.User{ID: 2, Callsign: "N0OWN", Username: "n0own"}
+	delegate := models.User{ID: 3, Callsign: "N0DEL", Username: "n0del"}
+	stranger := models.User{ID: 4, Callsign: "N0STR", Username: "n0str"}
+	for _, user := range []models.User{admin, owner, delegate, stranger} {
+		db.Create(&user)
+	}
+	repeater := models.Repeater{OwnerID: owner.ID}
+	repeater.ID = 311860
+	db.Create(&repeater)
+	db.Create(&models.RepeaterPermission{RepeaterID: repeater.ID, UserID: delegate.ID, ViewStats: true})
+
+	cases := []struct {
+		user       models.User
+		repeaterID uint
+		permission models.RepeaterPermissionType
+		want       bool
+	}{
+		{admin, repeater.ID, models.RepeaterPermissionRotatePassword, true},
+		{owner, repeater.ID, models.RepeaterPermissionRotatePassword, true},
+		{delegate, repeater.ID, models.RepeaterPermissionViewStats, true},
+		{delegate, repeater.ID, models.RepeaterPermissionEditTalkgroups, false},
+		{delegate, repeater.ID, models.RepeaterPermissionType("unknown"), false},
+		{stranger, repeater.ID, models.RepeaterPermissionViewStats, false},
+		// A permission on one repeater doesn't carry over to others
+		{delegate, 311861, models.RepeaterPermissionViewStats, false},
+	}
+	for _, tc := range cases {
+		allowed, err := models.UserCanManageRepeater(db, tc.user, tc.repeaterID, tc.permission)
+		if err != nil || allowed != tc.want {
+			t.Errorf("UserCanManageRepeater(%s, %d, %s) = %v, %v, want %v", tc.user.Callsign, tc.repeaterID, tc.permission, allowed, err, tc.want)
+		}
+	}
+
+	// Revoking removes the delegation entirely
+	if err := models.DeleteRepeaterPermission(db, repeater.ID, delegate.ID); err != nil {
+		t.Fatalf("Failed to revoke: %v", err)
+	}
+	if _, found, err := models.FindRepeaterPermission(db, repeater.ID, delegate.ID); err != nil || found {
+		t.Errorf("Expected the permission to be gone, found=%v err=%v", found, err)
+	}
+	if allowed, _ := models.UserCanManageRepeater(db, delegate, repeater.ID, models.RepeaterPermissionViewStats); allowed {
+		t.Error("Expected a revoked delegate to lose access")
+	}
+}
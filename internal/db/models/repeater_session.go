@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RepeaterSession is a single interval during which a repeater was connected to the network
+type RepeaterSession struct {
+	ID             uint           `json:"id" gorm:"primaryKey"`
+	RepeaterID     uint           `json:"repeater_id" gorm:"index"`
+	ConnectedAt    time.Time      `json:"connected_at" gorm:"index"`
+	DisconnectedAt *time.Time     `json:"disconnected_at"`
+	CreatedAt      time.Time      `json:"-"`
+	UpdatedAt      time.Time      `json:"-"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// RepeaterDowntime is a gap between two connected intervals of a repeater
+type RepeaterDowntime struct {
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Duration time.Duration `json:"duration"`
+}
+
+// RepeaterUptime summarizes a repeater's availability over a window
+type RepeaterUptime struct {
+	RepeaterID uint               `json:"repeater_id"`
+	Callsign   string             `json:"callsign"`
+	From       time.Time          `json:"from"`
+	To         time.Time          `json:"to"`
+	Uptime     time.Duration      `json:"uptime"`
+	Downtime   time.Duration      `json:"downtime"`
+	Percent    float64            `json:"percent"`
+	Incidents  []RepeaterDowntime `json:"incidents"`
+}
+
+// OpenRepeaterSession starts a new connected interval, closing any the repeater left open
+func OpenRepeaterSession(db *gorm.DB, repeaterID uint, now time.Time) error {
+	err := CloseRepeaterSessions(db, repeaterID, now)
+	if err != nil {
+		return err
+	}
+	return db.Create(&RepeaterSession{RepeaterID: repeaterID, ConnectedAt: now}).Error
+}
+
+// CloseRepeaterSessions ends any open connected intervals of a repeater
+func CloseRepeaterSessions(db *gorm.DB, repeaterID uint, now time.Time) error {
+	return db.Model(&RepeaterSession{}).Where("repeater_id = ? AND disconnected_at IS NULL", repeaterID).Update("disconnected_at", now).Error
+}
+
+// CloseStaleRepeaterSessions ends open intervals for repeaters that stopped pinging for longer than their ping timeout
+// without disconnecting, using their last ping as the disconnect time
+func CloseStaleRepeaterSessions(db *gorm.DB, now time.Time) error {
+	var sessions []RepeaterSession
+	err := db.Where("disconnected_at IS NULL").Find(&sessions).Error
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		var repeaters []Repeater
+		err := db.Unscoped().Where("id = ?", session.RepeaterID).Limit(1).Find(&repeaters).Error
+		if err != nil {
+			return err
+		}
+		disconnectedAt := session.ConnectedAt
+		if len(repeaters) > 0 {
+			if repeaters[0].LastPing.After(now.Add(-repeaters[0].PingTimeout())) {
+				continue
+			}
+			if repeaters[0].LastPing.After(disconnectedAt) {
+				disconnectedAt = repeaters[0].LastPing
+			}
+		}
+		err = db.Model(&session).Update("disconnected_at", disconnectedAt).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindRepeaterSessions lists the connected intervals of a repeater that overlap a window
+func FindRepeaterSessions(db *gorm.DB, repeaterID uint, from time.Time, to time.Time) ([]RepeaterSession, error) {
+	var sessions []RepeaterSession
+	err := db.Where("repeater_id = ? AND connected_at < ? AND (disconnected_at IS NULL OR disconnected_at > ?)", repeaterID, to, from).
+		Order("connected_at asc").Find(&sessions).Error
+	return sessions, err
+}
+
+// DeleteRepeaterSessions removes the uptime history of a repeater
+func DeleteRepeaterSessions(db *gorm.DB, repeaterID uint) error {
+	return db.Unscoped().Where("repeater_id = ?", repeaterID).Delete(&RepeaterSession{}).Error
+}
+
+// GetRepeaterUptime computes the availability of a repeater over a window.
+// Time before the repeater was registered doesn't count against it.
+func GetRepeaterUptime(db *gorm.DB, repeater Repeater, from time.Time, to time.Time, now time.Time) (RepeaterUptime, error) {
+	if repeater.CreatedAt.After(from) {
+		from = repeater.CreatedAt
+	}
+	if to.After(now) {
+		to = now
+	}
+	uptime := RepeaterUptime{
+		RepeaterID: repeater.ID,
+		Callsign:   repeater.Callsign,
+		From:       from,
+		To:         to,
+		Incidents:  []RepeaterDowntime{},
+	}
+	if !to.After(from) {
+		return uptime, nil
+	}
+
+	sessions, err := FindRepeaterSessions(db, repeater.ID, from, to)
+	if err != nil {
+		return uptime, err
+	}
+	uptime.Uptime, uptime.Incidents = ComputeUptime(sessions, from, to, now)
+	uptime.Downtime = to.Sub(from) - uptime.Uptime
+	const percent = 100
+	uptime.Percent = float64(uptime.Uptime) / float64(to.Sub(from)) * percent
+	return uptime, nil
+}
+
+// ComputeUptime clips sessions to a window and returns the total connected time
+// along with the gaps between sessions. Sessions must be ordered by ConnectedAt.
+func ComputeUptime(sessions []RepeaterSession, from time.Time, to time.Time, now time.Time) (time.Duration, []RepeaterDowntime) {
+	var connected time.Duration
+	incidents := []RepeaterDowntime{}
+	cursor := from
+	for _, session := range sessions {
+		start := session.ConnectedAt
+		end := now
+		if session.DisconnectedAt != nil {
+			end = *session.DisconnectedAt
+		}
+		if start.Before(cursor) {
+			start = cursor
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !end.After(start) {
+			continue
+		}
+		if start.After(cursor) {
+			incidents = append(incidents, RepeaterDowntime{Start: cursor, End: start, Duration: start.Sub(cursor)})
+		}
+		connected += end.Sub(start)
+		cursor = end
+	}
+	if to.After(cursor) {
+		incidents = append(incidents, RepeaterDowntime{Start: cursor, End: to, Duration: to.Sub(cursor)})
+	}
+	return connected, incidents
+}
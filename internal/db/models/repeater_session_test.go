@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func TestComputeUptime(t *testing.T) {
+	t.Parallel()
+	from := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(10 * time.Hour)
+	at := func(hours int) *time.Time {
+		ts := from.Add(time.Duration(hours) * time.Hour)
+		return &ts
+	}
+
+	sessions := []models.RepeaterSession{
+		// Started before the window, clipped to its start
+		{ConnectedAt: from.Add(-time.Hour), DisconnectedAt: at(2)},
+		// Overlaps the previous session and shouldn't be counted twice
+		{ConnectedAt: *at(1), DisconnectedAt: at(3)},
+		{ConnectedAt: *at(5), DisconnectedAt: at(6)},
+		// Still connected
+		{ConnectedAt: *at(8)},
+	}
+
+	connected, incidents := models.ComputeUptime(sessions, from, to, to.Add(time.Hour))
+	if connected != 6*time.Hour {
+		t.Errorf("Expected 6h of uptime, got %s", connected)
+	}
+	if len(incidents) != 2 {
+		t.Fatalf("Expected 2 incidents, got %d", len(incidents))
+	}
+	if !incidents[0].Start.Equal(*at(3)) || incidents[0].Duration != 2*time.Hour {
+		t.Errorf("Unexpected first incident: %+v", incidents[0])
+	}
+	if !incidents[1].Start.Equal(*at(6)) || incidents[1].Duration != 2*time.Hour {
+		t.Errorf("Unexpected second incident: %+v", incidents[1])
+	}
+}
+
+func TestComputeUptimeNoSessions(t *testing.T) {
+	t.Parallel()
+	from := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	connected, incidents := models.ComputeUptime(nil, from, to, to)
+	if connected != 0 || len(incidents) != 1 || incidents[0].Duration != time.Hour {
+		t.Errorf("Expected the whole window to be downtime, got %s and %+v", connected, incidents)
+	}
+}
@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RepeaterTemplate is a named static talkgroup configuration that can be applied to repeaters.
+// At most one template is the default, which is applied to newly registered repeaters.
+type RepeaterTemplate struct {
+	ID                  uint           `json:"id" gorm:"primaryKey"`
+	Name                string         `json:"name" gorm:"uniqueIndex"`
+	Description         string         `json:"description"`
+	TS1StaticTalkgroups []Talkgroup    `json:"ts1_static_talkgroups" gorm:"many2many:repeater_template_ts1_talkgroups;"`
+	TS2StaticTalkgroups []Talkgroup    `json:"ts2_static_talkgroups" gorm:"many2many:repeater_template_ts2_talkgroups;"`
+	IsDefault           bool           `json:"default"`
+	CreatedAt           time.Time      `json:"created_at"`
+	UpdatedAt           time.Time      `json:"-"`
+	DeletedAt           gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// StaticTalkgroupChanges lists the talkgroup IDs added to and removed from one timeslot
+type StaticTalkgroupChanges struct {
+	Added   []uint `json:"added"`
+	Removed []uint `json:"removed"`
+}
+
+// RepeaterTemplateChanges is the difference between a repeater's static talkgroups and a template's
+type RepeaterTemplateChanges struct {
+	TS1 StaticTalkgroupChanges `json:"ts1"`
+	TS2 StaticTalkgroupChanges `json:"ts2"`
+}
+
+func ListRepeaterTemplates(db *gorm.DB) ([]RepeaterTemplate, error) {
+	var templates []RepeaterTemplate
+	err := db.Preload("TS1StaticTalkgroups").Preload("TS2StaticTalkgroups").Order("id asc").Find(&templates).Error
+	return templates, err
+}
+
+func CountRepeaterTemplates(db *gorm.DB) (int, error) {
+	var count int64
+	err := db.Model(&RepeaterTemplate{}).Count(&count).Error
+	return int(count), err
+}
+
+func RepeaterTemplateIDExists(db *gorm.DB, id uint) (bool, error) {
+	var count int64
+	err := db.Model(&RepeaterTemplate{}).Where("id = ?", id).Limit(1).Count(&count).Error
+	return count > 0, err
+}
+
+func FindRepeaterTemplateByID(db *gorm.DB, id uint) (RepeaterTemplate, error) {
+	var template RepeaterTemplate
+	err := db.Preload("TS1StaticTalkgroups").Preload("TS2StaticTalkgroups").First(&template, id).Error
+	return template, err
+}
+
+// FindDefaultRepeaterTemplate returns the template applied to new repeaters, if one is set
+func FindDefaultRepeaterTemplate(db *gorm.DB) (RepeaterTemplate, bool, error) {
+	var templates []RepeaterTemplate
+	err := db.Preload("TS1StaticTalkgroups").Preload("TS2StaticTalkgroups").Where("is_default = ?", true).Order("id asc").Limit(1).Find(&templates).Error
+	if err != nil || len(templates) == 0 {
+		return RepeaterTemplate{}, false, err
+	}
+	return templates[0], true, nil
+}
+
+// SetDefaultRepeaterTemplate makes the template the default, clearing the flag on any other template
+func SetDefaultRepeaterTemplate(db *gorm.DB, id uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&RepeaterTemplate{}).Where("id <> ? AND is_default = ?", id, true).Update("is_default", false).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&RepeaterTemplate{}).Where("id = ?", id).Update("is_default", true).Error
+	})
+}
+
+// ApplyRepeaterTemplate replaces the repeater's static talkgroups with the template's and reports what changed.
+// The repeater must have its static talkgroups loaded.
+func ApplyRepeaterTemplate(db *gorm.DB, repeater *Repeater, template RepeaterTemplate) (RepeaterTemplateChanges, error) {
+	changes := RepeaterTemplateChanges{
+		TS1: diffStaticTalkgroups(repeater.TS1StaticTalkgroups, template.TS1StaticTalkgroups),
+		TS2: diffStaticTalkgroups(repeater.TS2StaticTalkgroups, template.TS2StaticTalkgroups),
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(repeater).Association("TS1StaticTalkgroups").Replace(template.TS1StaticTalkgroups)
+		if err != nil {
+			return err
+		}
+		return tx.Model(repeater).Association("TS2StaticTalkgroups").Replace(template.TS2StaticTalkgroups)
+	})
+	return changes, err
+}
+
+func DeleteRepeaterTemplate(db *gorm.DB, id uint) error {
+	return db.Unscoped().Select(clause.Associations).Delete(&RepeaterTemplate{ID: id}).Error
+}
+
+func diffStaticTalkgroups(current, wanted []Talkgroup) StaticTalkgroupChanges {
+	changes := StaticTalkgroupChanges{Added: []uint{}, Removed: []uint{}}
+	have := make(map[uint]bool, len(current))
+	for _, tg := range current {
+		have[tg.ID] = true
+	}
+	want := make(map[uint]bool, len(wanted))
+	for _, tg := range wanted {
+		want[tg.ID] = true
+		if !have[tg.ID] {
+			changes.Added = append(changes.Added, tg.ID)
+		}
+	}
+	for _, tg := range current {
+		if !want[tg.ID] {
+			changes.Removed = append(changes.Removed, tg.ID)
+		}
+	}
+	return changes
+}
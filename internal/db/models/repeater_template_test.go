@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func TestRepeaterTemplates(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.RepeaterTemplate{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	db.Create(&models.Talkgroup{ID: 1, Name: "Local"})
+	db.Create(&models.Talkgroup{ID: 2, Name: "Regional"})
+	db.Create(&models.Talkgroup{ID: 3100, Name: "USA"})
+	db.Create(&models.Repeater{RepeaterConfiguration: models.RepeaterConfiguration{ID: 311860}, TS1StaticTalkgroups: []models.Talkgroup{{ID: 1}, {ID: 3100}}})
+
+	if _, ok, err := models.FindDefaultRepeaterTemplate(db); ok || err != nil {
+		t.Fatalf("Expected no default template, got ok=%v err=%v", ok, err)
+	}
+
+	club := models.RepeaterTemplate{Name: "Club", TS1StaticTalkgroups: []models.Talkgroup{{ID: 3100}, {ID: 2}}, TS2StaticTalkgroups: []models.Talkgroup{{ID: 1}}}
+	other := models.RepeaterTemplate{Name: "Other", IsDefault: true}
+	db.Create(&club)
+	db.Create(&other)
+	if err := models.SetDefaultRepeaterTemplate(db, club.ID); err != nil {
+		t.Fatalf("Failed to set default template: %v", err)
+	}
+	template, ok, err := models.FindDefaultRepeaterTemplate(db)
+	if err != nil || !ok || template.ID != club.ID {
+		t.Fatalf("Expected the Club template as default, got %+v ok=%v err=%v", template, ok, err)
+	}
+	if other, _ = models.FindRepeaterTemplateByID(db, other.ID); other.IsDefault {
+		t.Error("Expected the previous default to be cleared")
+	}
+
+	repeater, err := models.FindRepeaterByID(db, 311860)
+	if err != nil {
+		t.Fatalf("Failed to find repeater: %v", err)
+	}
+	changes, err := models.ApplyRepeaterTemplate(db, &repeater, template)
+	if err != nil {
+		t.Fatalf("Failed to apply template: %v", err)
+	}
+	if len(changes.TS1.Added) != 1 || changes.TS1.Added[0] != 2 || len(changes.TS1.Removed) != 1 || changes.TS1.Removed[0] != 1 {
+		t.Errorf("Unexpected TS1 changes: %+v", changes.TS1)
+	}
+	if len(changes.TS2.Added) != 1 || changes.TS2.Added[0] != 1 || len(changes.TS2.Removed) != 0 {
+		t.Errorf("Unexpected TS2 changes: %+v", changes.TS2)
+	}
+
+	repeater, _ = models.FindRepeaterByID(db, 311860)
+	if len(repeater.TS1StaticTalkgroups) != 2 || len(repeater.TS2StaticTalkgroups) != 1 {
+		t.Errorf("Expected the template's talkgroups on the repeater, got %+v / %+v", repeater.TS1StaticTalkgroups, repeater.TS2StaticTalkgroups)
+	}
+
+	if err := models.DeleteRepeaterTemplate(db, club.ID); err != nil {
+		t.Fatalf("Failed to delete template: %v", err)
+	}
+	if exists, _ := models.RepeaterTemplateIDExists(db, club.ID); exists {
+		t.Error("Expected the template to be deleted")
+	}
+	if _, ok, _ := models.FindDefaultRepeaterTemplate(db); ok {
+		t.Error("Expected no default template after deleting it")
+	}
+}
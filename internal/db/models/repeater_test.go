@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func TestListRepeatersForSubscriptions(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	dynamic := uint(3)
+	db.Create(&[]models.Talkgroup{{ID: 1, Name: "one"}, {ID: 2, Name: "two"}, {ID: dynamic, Name: "three"}})
+	repeaters := []models.Repeater{
+		{
+			RepeaterConfiguration: models.RepeaterConfiguration{ID: 311001},
+			TS1StaticTalkgroups:   []models.Talkgroup{{ID: 1}},
+			TS2StaticTalkgroups:   []models.Talkgroup{{ID: 1}, {ID: 2}},
+			TS2DynamicTalkgroupID: &dynamic,
+		},
+		{RepeaterConfiguration: models.RepeaterConfiguration{ID: 311002}},
+	}
+	if err := db.Create(&repeaters).Error; err != nil {
+		t.Fatalf("Failed to create repeaters: %v", err)
+	}
+
+	loaded, err := models.ListRepeatersForSubscriptions(db)
+	if err != nil {
+		t.Fatalf("Failed to list repeaters: %v", err)
+	}
+	if len(loaded) != 2 || loaded[0].ID != 311001 || loaded[1].ID != 311002 {
+		t.Fatalf("Expected repeaters 311001 and 311002, got %+v", loaded)
+	}
+	if len(loaded[0].TS1StaticTalkgroups) != 1 || len(loaded[0].TS2StaticTalkgroups) != 2 {
+		t.Errorf("Expected static talkgroups to be loaded, got %v and %v", loaded[0].TS1StaticTalkgroups, loaded[0].TS2StaticTalkgroups)
+	}
+	if loaded[0].TS2DynamicTalkgroupID == nil || *loaded[0].TS2DynamicTalkgroupID != dynamic {
+		t.Errorf("Expected the TS2 dynamic talkgroup to be loaded")
+	}
+	if len(loaded[1].TS1StaticTalkgroups) != 0 || loaded[1].TS1DynamicTalkgroupID != nil {
+		t.Errorf("Expected no talkgroups on 311002, got %+v", loaded[1])
+	}
+}
+
+func TestRepeaterPingTimeout(t *testing.T) {
+	t.Parallel()
+	repeater := models.Repeater{}
+	if repeater.PingTimeout() != models.DefaultPingTimeout {
+		t.Errorf("Expected the default timeout without a keepalive interval, got %s", repeater.PingTimeout())
+	}
+	repeater.KeepaliveInterval = 10
+	if repeater.PingTimeout() != 50*time.Second {
+		t.Errorf("Expected five missed 10 second pings to time out, got %s", repeater.PingTimeout())
+	}
+}
@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const day = 24 * time.Hour
+
+// PurgeExpiredCalls deletes calls, including their recorded voice data and telemetry, that are
+// older than their talkgroup's retention, or defaultRetention for everything else.
+// A zero retention keeps calls forever.
+func PurgeExpiredCalls(db *gorm.DB, defaultRetention time.Duration, now time.Time) (int64, error) {
+	var purged int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var talkgroups []Talkgroup
+		err := tx.Where("retention_days > ?", 0).Find(&talkgroups).Error
+		if err != nil {
+			return err
+		}
+		customRetention := make([]uint, 0, len(talkgroups))
+		for _, talkgroup := range talkgroups {
+			customRetention = append(customRetention, talkgroup.ID)
+			cutoff := now.Add(-time.Duration(talkgroup.RetentionDays) * day)
+			result := tx.Unscoped().Where("is_to_talkgroup = ? AND to_talkgroup_id = ? AND active = ? AND start_time < ?", true, talkgroup.ID, false, cutoff).Delete(&Call{})
+			if result.Error != nil {
+				return result.Error
+			}
+			purged += result.RowsAffected
+		}
+
+		if defaultRetention <= 0 {
+			return deleteOrphanedTelemetry(tx)
+		}
+		cutoff := now.Add(-defaultRetention)
+		query := tx.Unscoped().Where("active = ? AND start_time < ?", false, cutoff)
+		if len(customRetention) > 0 {
+			query = query.Where("NOT (is_to_talkgroup = ? AND to_talkgroup_id IN ?)", true, customRetention)
+		}
+		result := query.Delete(&Call{})
+		if result.Error != nil {
+			return result.Error
+		}
+		purged += result.RowsAffected
+		err = tx.Unscoped().Where("call_time < ?", cutoff).Delete(&MissedCall{}).Error
+		if err != nil {
+			return err
+		}
+		return deleteOrphanedTelemetry(tx)
+	})
+	return purged, err
+}
+
+// DataDeletionReport records what was erased for a DMR ID
+type DataDeletionReport struct {
+	DMRID              uint      `json:"dmr_id"`
+	CallsDeleted       int64     `json:"calls_deleted"`
+	MissedCallsDeleted int64     `json:"missed_calls_deleted"`
+	AudioTestsDeleted  int64     `json:"audio_tests_deleted"`
+	AirtimeDeleted     int64     `json:"airtime_deleted"`
+	DeferredDeleted    int64     `json:"deferred_data_deleted"`
+	ArchiveRetained    int64     `json:"archive_records_retained"`
+	DeletedAt          time.Time `json:"deleted_at"`
+}
+
+// DeleteUserData erases every call made by or to a DMR ID, along with the recorded voice data,
+// missed call history, audio test results, air time rollups and data held for delivery, without
+// deleting the account.
+//
+// Talkgroup archives are exempt. They are a tamper-evident record kept for talkgroups an admin
+// chose to archive, the table rejects deletes, and removing a record would break the chain.
+// The report counts the records that were retained so the request can be answered accurately.
+func DeleteUserData(db *gorm.DB, dmrID uint) (DataDeletionReport, error) {
+	report := DataDeletionReport{DMRID: dmrID}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Synced clients only hold recent calls, so those are the only ones they need telling about
+		var recent []uint
+		err := tx.Unscoped().Model(&Call{}).Where("(user_id = ? OR (is_to_user = ? AND to_user_id = ?)) AND start_time >= ?", dmrID, true, dmrID, time.Now().Add(-SyncCallWindow)).Pluck("id", &recent).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Unscoped().Where("user_id = ? OR (is_to_user = ? AND to_user_id = ?)", dmrID, true, dmrID).Delete(&Call{})
+		if result.Error != nil {
+			return result.Error
+		}
+		report.CallsDeleted = result.RowsAffected
+		if err := recordTombstones(tx, TombstoneCall, recent...); err != nil {
+			return err
+		}
+
+		result = tx.Unscoped().Where("user_id = ? OR caller_id = ?", dmrID, dmrID).Delete(&MissedCall{})
+		if result.Error != nil {
+			return result.Error
+		}
+		report.MissedCallsDeleted = result.RowsAffected
+
+		result = tx.Unscoped().Where("user_id = ?", dmrID).Delete(&AudioTest{})
+		if result.Error != nil {
+			return result.Error
+		}
+		report.AudioTestsDeleted = result.RowsAffected
+
+		result = tx.Where("user_id = ?", dmrID).Delete(&AirtimeRollup{})
+		if result.Error != nil {
+			return result.Error
+		}
+		report.AirtimeDeleted = result.RowsAffected
+
+		result = tx.Where("source = ? OR (to_repeater = ? AND destination_id = ?)", dmrID, false, dmrID).Delete(&DeferredData{})
+		if result.Error != nil {
+			return result.Error
+		}
+		report.DeferredDeleted = result.RowsAffected
+
+		err = tx.Model(&ArchiveRecord{}).Where("src = ?", dmrID).Count(&report.ArchiveRetained).Error
+		if err != nil {
+			return err
+		}
+		return deleteOrphanedTelemetry(tx)
+	})
+	report.DeletedAt = time.Now()
+	return report, err
+}
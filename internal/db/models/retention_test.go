@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func makeRetentionDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.AutoMigrate(&models.User{}, &models.Talkgroup{}, &models.Repeater{}, &models.Call{}, &models.CallTelemetry{}, &models.MissedCall{}, &models.AudioTest{}, &models.AirtimeRollup{}, &models.DeferredData{}, &models.ArchiveRecord{}, &models.Tombstone{})
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	return db
+}
+
+func TestPurgeExpiredCalls(t *testing.T) {
+	t.Parallel()
+	db := makeRetentionDB(t)
+	now := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	short := uint(1)
+	long := uint(2)
+	db.Create(&models.Talkgroup{ID: short, RetentionDays: 1})
+	db.Create(&models.Talkgroup{ID: long, RetentionDays: 60})
+
+	calls := []models.Call{
+		// Past the talkgroup's 1 day retention
+		{IsToTalkgroup: true, ToTalkgroupID: &short, StartTime: now.Add(-48 * time.Hour)},
+		{IsToTalkgroup: true, ToTalkgroupID: &short, StartTime: now.Add(-time.Hour)},
+		// Past the default but within the talkgroup's 60 days
+		{IsToTalkgroup: true, ToTalkgroupID: &long, StartTime: now.Add(-40 * 24 * time.Hour)},
+		// Private call past the 30 day default
+		{IsToUser: true, StartTime: now.Add(-31 * 24 * time.Hour)},
+		{IsToUser: true, StartTime: now.Add(-29 * 24 * time.Hour)},
+	}
+	for i := range calls {
+		db.Create(&calls[i])
+	}
+
+	purged, err := models.PurgeExpiredCalls(db, 30*24*time.Hour, now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if purged != 2 {
+		t.Errorf("Expected 2 calls purged, got %d", purged)
+	}
+	var remaining int64
+	db.Model(&models.Call{}).Count(&remaining)
+	if remaining != 3 {
+		t.Errorf("Expected 3 calls to remain, got %d", remaining)
+	}
+}
+
+func TestDeleteUserData(t *testing.T) {
+	t.Parallel()
+	db := makeRetentionDB(t)
+	const dmrID = 3191868
+	other := uint(3191869)
+	self := uint(dmrID)
+	db.Create(&models.Call{UserID: dmrID, CallData: []byte{1, 2, 3}})
+	db.Create(&models.Call{UserID: other, IsToUser: true, ToUserID: &self})
+	db.Create(&models.Call{UserID: other})
+	db.Create(&models.MissedCall{UserID: dmrID, CallerID: other})
+	db.Create(&models.AudioTest{UserID: dmrID})
+	db.Create(&models.AirtimeRollup{Day: time.Now().Truncate(24 * time.Hour), UserID: dmrID, TalkgroupID: 1, RepeaterID: 1, Calls: 1})
+	db.Create(&models.AirtimeRollup{Day: time.Now().Truncate(24 * time.Hour), UserID: other, TalkgroupID: 1, RepeaterID: 1, Calls: 1})
+	db.Create(&models.DeferredData{Source: dmrID, DestinationID: other})
+	db.Create(&models.DeferredData{Source: other, DestinationID: dmrID})
+	// A repeater that shares the ID isn't the user
+	db.Create(&models.DeferredData{Source: other, DestinationID: dmrID, ToRepeater: true})
+	record := models.NewArchiveRecord(models.Packet{Dst: 1, Src: dmrID}, time.Now(), false)
+	record.Chain("")
+	db.Create(&record)
+
+	report, err := models.DeleteUserData(db, dmrID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report.CallsDeleted != 2 || report.MissedCallsDeleted != 1 || report.AudioTestsDeleted != 1 ||
+		report.AirtimeDeleted != 1 || report.DeferredDeleted != 2 || report.ArchiveRetained != 1 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	userTables := map[string]*gorm.DB{
+		"calls":         db.Unscoped().Model(&models.Call{}).Where("user_id = ? OR (is_to_user = ? AND to_user_id = ?)", dmrID, true, dmrID),
+		"missed_calls":  db.Unscoped().Model(&models.MissedCall{}).Where("user_id = ? OR caller_id = ?", dmrID, dmrID),
+		"audio_tests":   db.Unscoped().Model(&models.AudioTest{}).Where("user_id = ?", dmrID),
+		"airtime":       db.Model(&models.AirtimeRollup{}).Where("user_id = ?", dmrID),
+		"deferred_data": db.Model(&models.DeferredData{}).Where("source = ? OR (to_repeater = ? AND destination_id = ?)", dmrID, false, dmrID),
+	}
+	for table, query := range userTables {
+		var count int64
+		query.Count(&count)
+		if count != 0 {
+			t.Errorf("Expected no %s left for the user, got %d", table, count)
+		}
+	}
+	var remaining int64
+	db.Model(&models.Call{}).Count(&remaining)
+	if remaining != 1 {
+		t.Errorf("Expected 1 call to remain, got %d", remaining)
+	}
+	db.Model(&models.AirtimeRollup{}).Count(&remaining)
+	if remaining != 1 {
+		t.Errorf("Expected other users' air time to remain, got %d", remaining)
+	}
+	db.Model(&models.DeferredData{}).Count(&remaining)
+	if remaining != 1 {
+		t.Errorf("Expected data for the repeater to remain, got %d", remaining)
+	}
+}
@@ -21,6 +21,7 @@
 package models
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
@@ -30,20 +31,96 @@ import (
 	"gorm.io/gorm/clause"
 )
 
+// Talkgroup is a DMR talkgroup. AutoCreated talkgroups were made the first
+// time someone keyed them. Archive talkgroups have every routed burst written to
+// the append-only archive, with the AMBE payload if ArchivePayload is set.
+// Categories are admin-defined tags used to organize the talkgroup list.
+// Language, Region and BridgeHint help users find talkgroups and tell
+// bridges whether a talkgroup should be shared with other networks.
+// Private talkgroups are only routed to repeaters on their allowlist and are
+// hidden from everyone who couldn't hear them, see TalkgroupAllowedRepeater.
+// CodecPolicy decides what happens to calls bridged in from modes that don't use AMBE.
 type Talkgroup struct {
-	ID          uint           `json:"id" gorm:"primaryKey"`
-	Name        string         `json:"name"`
-	Description string         `json:"description"`
-	Admins      []User         `json:"admins" gorm:"many2many:talkgroup_admins;"`
-	NCOs        []User         `json:"ncos" gorm:"many2many:talkgroup_ncos;"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"-"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// RetentionDays is how long calls to the talkgroup are kept. 0 uses the network default.
+	RetentionDays   uint                `json:"retention_days"`
+	Archive         bool                `json:"archive"`
+	ArchivePayload  bool                `json:"archive_payload"`
+	AutoCreated     bool                `json:"auto_created"`
+	PendingApproval bool                `json:"pending_approval"`
+	Language        string              `json:"language"`
+	Region          string              `json:"region"`
+	BridgeHint      BridgeHint          `json:"bridge_hint"`
+	Private         bool                `json:"private"`
+	CodecPolicy     CodecPolicy         `json:"codec_policy"`
+	Admins          []User              `json:"admins" gorm:"many2many:talkgroup_admins;"`
+	NCOs            []User              `json:"ncos" gorm:"many2many:talkgroup_ncos;"`
+	Categories      []TalkgroupCategory `json:"categories" gorm:"many2many:talkgroup_category_members;"`
+	CreatedAt       time.Time           `json:"created_at"`
+	UpdatedAt       time.Time           `json:"-"`
+	DeletedAt       gorm.DeletedAt      `json:"-" gorm:"index"`
+}
+
+// BridgeHint tells network bridges how to treat a talkgroup by default
+type BridgeHint string
+
+const (
+	// BridgeHintNone leaves the decision to each bridge's own rules
+	BridgeHintNone BridgeHint = ""
+	// BridgeHintShare offers the talkgroup to peered networks by default
+	BridgeHintShare BridgeHint = "share"
+	// BridgeHintLocal keeps the talkgroup on this network
+	BridgeHintLocal BridgeHint = "local"
+)
+
+// CodecPolicy is how a talkgroup routes calls in codecs other than AMBE
+type CodecPolicy string
+
+const (
+	// CodecPolicyBlock drops calls that aren't AMBE
+	CodecPolicyBlock CodecPolicy = ""
+	// CodecPolicyPassthrough only sends them to repeaters that take the codec
+	CodecPolicyPassthrough CodecPolicy = "passthrough"
+	// CodecPolicyTranscode also transcodes them to AMBE for every other repeater,
+	// when a transcoder for the codec is available
+	CodecPolicyTranscode CodecPolicy = "transcode"
+)
+
+// FindTalkgroupCodecPolicy returns a talkgroup's codec policy, blocking if the talkgroup doesn't exist
+func FindTalkgroupCodecPolicy(db *gorm.DB, id uint) (CodecPolicy, error) {
+	var talkgroups []Talkgroup
+	err := db.Select("id", "codec_policy").Where("id = ?", id).Limit(1).Find(&talkgroups).Error
+	if err != nil || len(talkgroups) == 0 {
+		return CodecPolicyBlock, err
+	}
+	return talkgroups[0].CodecPolicy, nil
+}
+
+// TalkgroupsWithMetadata scopes a talkgroup query by language and region. An empty
+// value matches everything, and a language also matches its regional variants,
+// so "en" matches "en-US".
+func TalkgroupsWithMetadata(db *gorm.DB, language string, region string) *gorm.DB {
+	if language != "" {
+		db = db.Where("talkgroups.language = ? OR talkgroups.language LIKE ?", language, language+"-%")
+	}
+	if region != "" {
+		db = db.Where("talkgroups.region = ?", region)
+	}
+	return db
+}
+
+// ListTalkgroupsByBridgeHint lists the talkgroups bridges should treat according to hint
+func ListTalkgroupsByBridgeHint(db *gorm.DB, hint BridgeHint) ([]Talkgroup, error) {
+	var talkgroups []Talkgroup
+	err := db.Where("bridge_hint = ? AND pending_approval = ? AND private = ?", hint, false, false).Order("id asc").Find(&talkgroups).Error
+	return talkgroups, err
 }
 
 func ListTalkgroups(db *gorm.DB) ([]Talkgroup, error) {
 	var talkgroups []Talkgroup
-	err := db.Preload("Admins").Preload("NCOs").Order("id asc").Find(&talkgroups).Error
+	err := db.Preload("Admins").Preload("NCOs").Preload("Categories").Order("id asc").Find(&talkgroups).Error
 	return talkgroups, err
 }
 
@@ -59,9 +136,39 @@ func TalkgroupIDExists(db *gorm.DB, id uint) (bool, error) {
 	return count > 0, err
 }
 
+// TalkgroupState reports whether a talkgroup exists and, if so, whether it is still waiting on admin approval
+func TalkgroupState(db *gorm.DB, id uint) (exists bool, pending bool, err error) {
+	var talkgroups []Talkgroup
+	err = db.Select("id", "pending_approval").Where("id = ?", id).Limit(1).Find(&talkgroups).Error
+	if err != nil || len(talkgroups) == 0 {
+		return false, false, err
+	}
+	return true, talkgroups[0].PendingApproval, nil
+}
+
+// AutoCreateTalkgroup creates a placeholder talkgroup for an ID that was keyed
+// but isn't configured. It reports false if the talkgroup already existed.
+func AutoCreateTalkgroup(db *gorm.DB, id uint, pendingApproval bool) (bool, error) {
+	talkgroup := Talkgroup{
+		ID:              id,
+		Name:            fmt.Sprintf("TG %d", id),
+		Description:     "Automatically created on first use",
+		AutoCreated:     true,
+		PendingApproval: pendingApproval,
+	}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&talkgroup)
+	return result.RowsAffected > 0, result.Error
+}
+
+func ListPendingTalkgroups(db *gorm.DB) ([]Talkgroup, error) {
+	var talkgroups []Talkgroup
+	err := db.Where("pending_approval = ?", true).Order("id asc").Find(&talkgroups).Error
+	return talkgroups, err
+}
+
 func FindTalkgroupByID(db *gorm.DB, id uint) (Talkgroup, error) {
 	var talkgroup Talkgroup
-	err := db.Preload("Admins").Preload("NCOs").First(&talkgroup, id).Error
+	err := db.Preload("Admins").Preload("NCOs").Preload("Categories").First(&talkgroup, id).Error
 	return talkgroup, err
 }
 
@@ -69,6 +176,7 @@ func DeleteTalkgroup(db *gorm.DB, id uint) error {
 	err := db.Transaction(func(tx *gorm.DB) error {
 		// Delete calls where IsToTalkgroup is true and IsToTalkgroupID is id
 		tx.Unscoped().Where("is_to_talkgroup = ? AND to_talkgroup_id = ?", true, id).Delete(&Call{})
+		tx.Where("call_id NOT IN (?)", tx.Unscoped().Model(&Call{}).Select("id")).Delete(&CallTelemetry{})
 		// Find repeaters with TS1DynamicTalkgroup or TS2DynamicTalkgroup set to id
 		var repeaters []Repeater
 		tx.Where("ts1_dynamic_talkgroup_id = ? OR ts2_dynamic_talkgroup_id = ?", id, id).Find(&repeaters)
@@ -92,10 +200,18 @@ func DeleteTalkgroup(db *gorm.DB, id uint) error {
 
 		tx.Unscoped().Table("repeater_ts1_static_talkgroups").Where("talkgroup_id = ?", id).Delete(&Repeater{})
 		tx.Unscoped().Table("repeater_ts2_static_talkgroups").Where("talkgroup_id = ?", id).Delete(&Repeater{})
+		tx.Unscoped().Table("talkgroup_profile_ts1_talkgroups").Where("talkgroup_id = ?", id).Delete(&TalkgroupProfile{})
+		tx.Unscoped().Table("talkgroup_profile_ts2_talkgroups").Where("talkgroup_id = ?", id).Delete(&TalkgroupProfile{})
+		tx.Unscoped().Table("repeater_template_ts1_talkgroups").Where("talkgroup_id = ?", id).Delete(&RepeaterTemplate{})
+		tx.Unscoped().Table("repeater_template_ts2_talkgroups").Where("talkgroup_id = ?", id).Delete(&RepeaterTemplate{})
+		tx.Unscoped().Where("talkgroup_id = ?", id).Delete(&TalkgroupQuota{})
+		tx.Where("talkgroup_id = ?", id).Delete(&TalkgroupAllowedRepeater{})
+		tx.Table(talkgroupCategoryMembers).Where("talkgroup_id = ?", id).Delete(&TalkgroupCategory{})
+		tx.Where("kind = ? AND object_id = ?", ConfigVersionTalkgroup, id).Delete(&ConfigVersion{})
 
 		tx.Unscoped().Select(clause.Associations, "Admins").Select(clause.Associations, "NCOs").Delete(&Talkgroup{ID: id})
 
-		return nil
+		return recordTombstones(tx, TombstoneTalkgroup, id)
 	})
 	if err != nil {
 		logging.Errorf("Error deleting talkgroup: %s", err)
@@ -106,7 +222,7 @@ func DeleteTalkgroup(db *gorm.DB, id uint) error {
 
 func FindTalkgroupsByOwnerID(db *gorm.DB, ownerID uint) ([]Talkgroup, error) {
 	var talkgroups []Talkgroup
-	if err := db.Joins("JOIN talkgroup_admins on talkgroup_admins.talkgroup_id=talkgroups.id").
+	if err := db.Preload("Categories").Joins("JOIN talkgroup_admins on talkgroup_admins.talkgroup_id=talkgroups.id").
 		Joins("JOIN users on talkgroup_admins.user_id=users.id").Order("id asc").Where("users.id=?", ownerID).
 		Group("talkgroups.id").Find(&talkgroups).Error; err != nil {
 		logging.Errorf("Error getting talkgroups owned by user %d: %v", ownerID, err)
@@ -147,3 +263,10 @@ func (s *TalkgroupsSeeder) Seed(db *gorm.DB) error {
 func (s *TalkgroupsSeeder) Clear(_ *gorm.DB) error {
 	return nil
 }
+
+// ListTalkgroupsCreatedSince returns approved talkgroups created in a time range
+func ListTalkgroupsCreatedSince(db *gorm.DB, since time.Time, until time.Time) ([]Talkgroup, error) {
+	var talkgroups []Talkgroup
+	err := db.Where("pending_approval = ? AND created_at >= ? AND created_at < ?", false, since, until).Order("id asc").Find(&talkgroups).Error
+	return talkgroups, err
+}
@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TalkgroupAllowedRepeater puts a repeater on a private talkgroup's allowlist.
+// Only allowlisted repeaters can transmit on or receive a private talkgroup.
+type TalkgroupAllowedRepeater struct {
+	TalkgroupID uint      `json:"talkgroup_id" gorm:"primaryKey;autoIncrement:false"`
+	RepeaterID  uint      `json:"repeater_id" gorm:"primaryKey;autoIncrement:false;index"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ListTalkgroupAllowedRepeaterIDs lists the repeaters on a talkgroup's allowlist
+func ListTalkgroupAllowedRepeaterIDs(db *gorm.DB, talkgroupID uint) ([]uint, error) {
+	ids := []uint{}
+	err := db.Model(&TalkgroupAllowedRepeater{}).Where("talkgroup_id = ?", talkgroupID).Order("repeater_id asc").Pluck("repeater_id", &ids).Error
+	return ids, err
+}
+
+// SetTalkgroupAllowedRepeaters replaces a talkgroup's allowlist
+func SetTalkgroupAllowedRepeaters(db *gorm.DB, talkgroupID uint, repeaterIDs []uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("talkgroup_id = ?", talkgroupID).Delete(&TalkgroupAllowedRepeater{}).Error; err != nil {
+			return err
+		}
+		if len(repeaterIDs) == 0 {
+			return nil
+		}
+		allowed := make([]TalkgroupAllowedRepeater, 0, len(repeaterIDs))
+		for _, repeaterID := range repeaterIDs {
+			allowed = append(allowed, TalkgroupAllowedRepeater{TalkgroupID: talkgroupID, RepeaterID: repeaterID})
+		}
+		return tx.Create(&allowed).Error
+	})
+}
+
+// TalkgroupAllowsRepeater reports whether a repeater may carry a talkgroup. Every repeater
+// may carry a talkgroup that isn't private, or doesn't exist.
+func TalkgroupAllowsRepeater(db *gorm.DB, talkgroupID uint, repeaterID uint) (bool, error) {
+	var private []bool
+	err := db.Model(&Talkgroup{}).Where("id = ?", talkgroupID).Limit(1).Pluck("private", &private).Error
+	if err != nil || len(private) == 0 || !private[0] {
+		return true, err
+	}
+	var count int64
+	err = db.Model(&TalkgroupAllowedRepeater{}).Where("talkgroup_id = ? AND repeater_id = ?", talkgroupID, repeaterID).Limit(1).Count(&count).Error
+	return count > 0, err
+}
+
+// TalkgroupIsPrivate reports whether a talkgroup exists and is private
+func TalkgroupIsPrivate(db *gorm.DB, talkgroupID uint) (bool, error) {
+	var count int64
+	err := db.Model(&Talkgroup{}).Where("id = ? AND private = ?", talkgroupID, true).Limit(1).Count(&count).Error
+	return count > 0, err
+}
+
+// VisibleTalkgroups scopes a talkgroup query to the talkgroups a user may see. Private talkgroups
+// are visible to admins, the talkgroup's admins and NCOs, and the owners of allowlisted repeaters.
+// An anonymous visitor is the zero User.
+func VisibleTalkgroups(db *gorm.DB, user User) *gorm.DB {
+	if user.Admin {
+		return db
+	}
+	if user.ID == 0 {
+		return db.Where("talkgroups.private = ?", false)
+	}
+	sub := db.Session(&gorm.Session{NewDB: true})
+	return db.Where("talkgroups.private = ? OR talkgroups.id IN (?) OR talkgroups.id IN (?) OR talkgroups.id IN (?)", false,
+		sub.Table("talkgroup_admins").Select("talkgroup_id").Where("user_id = ?", user.ID),
+		sub.Table("talkgroup_ncos").Select("talkgroup_id").Where("user_id = ?", user.ID),
+		sub.Model(&TalkgroupAllowedRepeater{}).Select("talkgroup_allowed_repeaters.talkgroup_id").
+			Joins("JOIN repeaters ON repeaters.id = talkgroup_allowed_repeaters.repeater_id").
+			Where("repeaters.owner_id = ? AND repeaters.deleted_at IS NULL", user.ID),
+	)
+}
+
+// TalkgroupVisibleTo reports whether a talkgroup exists and the user may see it
+func TalkgroupVisibleTo(db *gorm.DB, talkgroupID uint, user User) (bool, error) {
+	var count int64
+	err := VisibleTalkgroups(db.Model(&Talkgroup{}), user).Where("talkgroups.id = ?", talkgroupID).Limit(1).Count(&count).Error
+	return count > 0, err
+}
+
+// HiddenTalkgroups selects the IDs of the private talkgroups a user may not see
+func HiddenTalkgroups(db *gorm.DB, user User) *gorm.DB {
+	sub := db.Session(&gorm.Session{NewDB: true})
+	return sub.Model(&Talkgroup{}).Select("talkgroups.id").Where("talkgroups.private = ? AND talkgroups.id NOT IN (?)", true,
+		VisibleTalkgroups(sub.Model(&Talkgroup{}).Select("talkgroups.id"), user))
+}
+
+// HiddenTalkgroupIDs lists the private talkgroups a user may not see
+func HiddenTalkgroupIDs(db *gorm.DB, user User) ([]uint, error) {
+	ids := []uint{}
+	err := HiddenTalkgroups(db, user).Pluck("talkgroups.id", &ids).Error
+	return ids, err
+}
+
+// VisibleCalls scopes a call query to calls a user may see, hiding calls on private talkgroups
+// outside the user's VisibleTalkgroups. An anonymous visitor is the zero User.
+func VisibleCalls(db *gorm.DB, user User) *gorm.DB {
+	if user.Admin {
+		return db
+	}
+	sub := db.Session(&gorm.Session{NewDB: true})
+	return db.Where("calls.to_talkgroup_id IS NULL OR calls.to_talkgroup_id NOT IN (?) OR calls.to_talkgroup_id IN (?)",
+		sub.Model(&Talkgroup{}).Select("talkgroups.id").Where("talkgroups.private = ?", true),
+		VisibleTalkgroups(sub.Model(&Talkgroup{}).Select("talkgroups.id"), user),
+	)
+}
+
+// PublicCalls scopes a call query to calls that weren't made on a private talkgroup
+func PublicCalls(db *gorm.DB) *gorm.DB {
+	return VisibleCalls(db, User{})
+}
@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func TestTalkgroupAllowsRepeater(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.TalkgroupAllowedRepeater{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	db.Create(&models.Talkgroup{ID: 1})
+	db.Create(&models.Talkgroup{ID: 2, Private: true})
+	if err := models.SetTalkgroupAllowedRepeaters(db, 2, []uint{311860}); err != nil {
+		t.Fatalf("Failed to set allowed repeaters: %v", err)
+	}
+
+	cases := []struct {
+		talkgroupID uint
+		repeaterID  uint
+		want        bool
+	}{
+		{1, 311861, true},
+		{2, 311860, true},
+		{2, 311861, false},
+		// Talkgroups that don't exist are never private
+		{3, 311861, true},
+	}
+	for _, tc := range cases {
+		allowed, err := models.TalkgroupAllowsRepeater(db, tc.talkgroupID, tc.repeaterID)
+		if err != nil || allowed != tc.want {
+			t.Errorf("TalkgroupAllowsRepeater(%d, %d) = %v, %v, want %v", tc.talkgroupID, tc.repeaterID, allowed, err, tc.want)
+		}
+	}
+
+	// Replacing the allowlist drops repeaters that aren't in it anymore
+	if err := models.SetTalkgroupAllowedRepeaters(db, 2, []uint{311861}); err != nil {
+		t.Fatalf("Failed to set allowed repeaters: %v", err)
+	}
+	ids, err := models.ListTalkgroupAllowedRepeaterIDs(db, 2)
+	if err != nil || len(ids) != 1 || ids[0] != 311861 {
+		t.Errorf("Unexpected allowed repeaters: %v err=%v", ids, err)
+	}
+}
+
+func TestVisibleTalkgroups(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.TalkgroupAllowedRepeater{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	owner := models.User{ID: 3191868, Callsign: "KI5VMF", Username: "owner", Approved: true}
+	outsider := models.User{ID: 3191869, Callsign: "N0CALL", Username: "outsider", Approved: true}
+	admin := models.User{ID: 3191870, Callsign: "W1AW", Username: "admin", Approved: true, Admin: true}
+	db.Create(&owner)
+	db.Create(&outsider)
+	db.Create(&admin)
+	db.Create(&models.Repeater{RepeaterConfiguration: models.RepeaterConfiguration{ID: 311860}, OwnerID: owner.ID})
+	db.Create(&models.Talkgroup{ID: 1})
+	db.Create(&models.Talkgroup{ID: 2, Private: true})
+	if err := models.SetTalkgroupAllowedRepeaters(db, 2, []uint{311860}); err != nil {
+		t.Fatalf("Failed to set allowed repeaters: %v", err)
+	}
+
+	cases := []struct {
+		name string
+		user models.User
+		want int
+	}{
+		{"anonymous", models.User{}, 1},
+		{"outsider", outsider, 1},
+		{"repeater owner", owner, 2},
+		{"admin", admin, 2},
+	}
+	for _, tc := range cases {
+		talkgroups, err := models.ListTalkgroups(models.VisibleTalkgroups(db, tc.user))
+		if err != nil || len(talkgroups) != tc.want {
+			t.Errorf("%s: expected %d visible talkgroups, got %d err=%v", tc.name, tc.want, len(talkgroups), err)
+		}
+	}
+
+	visible, err := models.TalkgroupVisibleTo(db, 2, outsider)
+	if err != nil || visible {
+		t.Errorf("Expected private talkgroup to be hidden from an outsider, got %v err=%v", visible, err)
+	}
+	hidden, err := models.HiddenTalkgroupIDs(db, outsider)
+	if err != nil || len(hidden) != 1 || hidden[0] != 2 {
+		t.Errorf("Expected the private talkgroup hidden from an outsider, got %v err=%v", hidden, err)
+	}
+	hidden, err = models.HiddenTalkgroupIDs(db, owner)
+	if err != nil || len(hidden) != 0 {
+		t.Errorf("Expected nothing hidden from the repeater owner, got %v err=%v", hidden, err)
+	}
+}
+
+func TestPublicCalls(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	public := uint(1)
+	private := uint(2)
+	db.Create(&models.Talkgroup{ID: public})
+	db.Create(&models.Talkgroup{ID: private, Private: true})
+	db.Create(&models.Call{IsToTalkgroup: true, ToTalkgroupID: &public})
+	db.Create(&models.Call{IsToTalkgroup: true, ToTalkgroupID: &private})
+	db.Create(&models.Call{IsToUser: true})
+
+	var count int64
+	models.PublicCalls(db.Model(&models.Call{})).Count(&count)
+	if count != 2 {
+		t.Errorf("Expected 2 public calls, got %d", count)
+	}
+	models.VisibleCalls(db.Model(&models.Call{}), models.User{Admin: true}).Count(&count)
+	if count != 3 {
+		t.Errorf("Expected admins to see 3 calls, got %d", count)
+	}
+}
@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrUnknownTalkgroupCategory = errors.New("unknown talkgroup category")
+
+// TalkgroupCategory is an admin-defined tag, such as Regional or Tactical,
+// used to organize large talkgroup lists and filter traffic.
+type TalkgroupCategory struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"uniqueIndex"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"-"`
+}
+
+const talkgroupCategoryMembers = "talkgroup_category_members"
+
+func ListTalkgroupCategories(db *gorm.DB) ([]TalkgroupCategory, error) {
+	var categories []TalkgroupCategory
+	err := db.Order("name asc").Find(&categories).Error
+	return categories, err
+}
+
+func FindTalkgroupCategoryByID(db *gorm.DB, id uint) (TalkgroupCategory, error) {
+	var category TalkgroupCategory
+	err := db.First(&category, id).Error
+	return category, err
+}
+
+// DeleteTalkgroupCategory removes a category and untags every talkgroup in it
+func DeleteTalkgroupCategory(db *gorm.DB, id uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Table(talkgroupCategoryMembers).Where("talkgroup_category_id = ?", id).Delete(&TalkgroupCategory{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&TalkgroupCategory{ID: id}).Error
+	})
+}
+
+// SetTalkgroupCategories replaces a talkgroup's categories. It returns
+// ErrUnknownTalkgroupCategory if any of the IDs don't exist.
+func SetTalkgroupCategories(db *gorm.DB, talkgroup *Talkgroup, categoryIDs []uint) error {
+	categories := []TalkgroupCategory{}
+	if len(categoryIDs) > 0 {
+		err := db.Where("id IN ?", categoryIDs).Find(&categories).Error
+		if err != nil {
+			return err
+		}
+	}
+	if len(categories) != len(uniqueIDs(categoryIDs)) {
+		return ErrUnknownTalkgroupCategory
+	}
+	return db.Model(talkgroup).Association("Categories").Replace(categories)
+}
+
+func uniqueIDs(ids []uint) map[uint]struct{} {
+	seen := make(map[uint]struct{}, len(ids))
+	for _, id := range ids {
+		seen[id] = struct{}{}
+	}
+	return seen
+}
+
+// TalkgroupsInCategory scopes a talkgroup query to one category
+func TalkgroupsInCategory(db *gorm.DB, categoryID uint) *gorm.DB {
+	return db.Where("talkgroups.id IN (SELECT talkgroup_id FROM "+talkgroupCategoryMembers+" WHERE talkgroup_category_id = ?)", categoryID)
+}
+
+// CallsInTalkgroupCategory scopes a call query to calls made to talkgroups in one category
+func CallsInTalkgroupCategory(db *gorm.DB, categoryID uint) *gorm.DB {
+	return db.Where("is_to_talkgroup = ? AND to_talkgroup_id IN (SELECT talkgroup_id FROM "+talkgroupCategoryMembers+" WHERE talkgroup_category_id = ?)", true, categoryID)
+}
@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func TestTalkgroupCategories(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.TalkgroupCategory{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	regional := models.TalkgroupCategory{Name: "Regional"}
+	tactical := models.TalkgroupCategory{Name: "Tactical"}
+	db.Create(&regional)
+	db.Create(&tactical)
+	db.Create(&models.Talkgroup{ID: 3100, Name: "USA"})
+	db.Create(&models.Talkgroup{ID: 8951, Name: "TAC 1"})
+
+	talkgroup, err := models.FindTalkgroupByID(db, 8951)
+	if err != nil {
+		t.Fatalf("Failed to find talkgroup: %v", err)
+	}
+	err = models.SetTalkgroupCategories(db, &talkgroup, []uint{tactical.ID, 999})
+	if !errors.Is(err, models.ErrUnknownTalkgroupCategory) {
+		t.Fatalf("Expected ErrUnknownTalkgroupCategory, got %v", err)
+	}
+	err = models.SetTalkgroupCategories(db, &talkgroup, []uint{tactical.ID, tactical.ID})
+	if err != nil {
+		t.Fatalf("Failed to set categories: %v", err)
+	}
+
+	talkgroup, _ = models.FindTalkgroupByID(db, 8951)
+	if len(talkgroup.Categories) != 1 || talkgroup.Categories[0].Name != "Tactical" {
+		t.Errorf("Expected the Tactical category, got %+v", talkgroup.Categories)
+	}
+
+	talkgroups, err := models.ListTalkgroups(models.TalkgroupsInCategory(db, tactical.ID))
+	if err != nil || len(talkgroups) != 1 || talkgroups[0].ID != 8951 {
+		t.Errorf("Expected only TG 8951 in Tactical, got %+v err=%v", talkgroups, err)
+	}
+
+	tg := uint(8951)
+	other := uint(3100)
+	db.Create(&models.Call{IsToTalkgroup: true, ToTalkgroupID: &tg})
+	db.Create(&models.Call{IsToTalkgroup: true, ToTalkgroupID: &other})
+	if count := models.CountCalls(models.CallsInTalkgroupCategory(db, tactical.ID)); count != 1 {
+		t.Errorf("Expected 1 call in Tactical, got %d", count)
+	}
+	if count := models.CountCalls(models.CallsInTalkgroupCategory(db, regional.ID)); count != 0 {
+		t.Errorf("Expected no calls in Regional, got %d", count)
+	}
+
+	if err := models.DeleteTalkgroupCategory(db, tactical.ID); err != nil {
+		t.Fatalf("Failed to delete category: %v", err)
+	}
+	talkgroup, _ = models.FindTalkgroupByID(db, 8951)
+	if len(talkgroup.Categories) != 0 {
+		t.Errorf("Expected deleting the category to untag the talkgroup, got %+v", talkgroup.Categories)
+	}
+}
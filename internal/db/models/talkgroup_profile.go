@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TalkgroupProfile is a user's default set of static talkgroups, applied to their hotspots when they connect
+type TalkgroupProfile struct {
+	ID                  uint           `json:"id" gorm:"primaryKey"`
+	UserID              uint           `json:"user_id" gorm:"uniqueIndex"`
+	TS1StaticTalkgroups []Talkgroup    `json:"ts1_static_talkgroups" gorm:"many2many:talkgroup_profile_ts1_talkgroups;"`
+	TS2StaticTalkgroups []Talkgroup    `json:"ts2_static_talkgroups" gorm:"many2many:talkgroup_profile_ts2_talkgroups;"`
+	CreatedAt           time.Time      `json:"created_at"`
+	UpdatedAt           time.Time      `json:"-"`
+	DeletedAt           gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// FindTalkgroupProfileForUser returns the user's talkgroup profile, if they have one
+func FindTalkgroupProfileForUser(db *gorm.DB, userID uint) (TalkgroupProfile, bool, error) {
+	var profiles []TalkgroupProfile
+	err := db.Preload("TS1StaticTalkgroups").Preload("TS2StaticTalkgroups").Where("user_id = ?", userID).Limit(1).Find(&profiles).Error
+	if err != nil || len(profiles) == 0 {
+		return TalkgroupProfile{}, false, err
+	}
+	return profiles[0], true, nil
+}
+
+func DeleteTalkgroupProfileForUser(db *gorm.DB, userID uint) error {
+	profile, ok, err := FindTalkgroupProfileForUser(db, userID)
+	if err != nil || !ok {
+		return err
+	}
+	return db.Unscoped().Select(clause.Associations).Delete(&profile).Error
+}
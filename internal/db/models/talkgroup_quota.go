@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const defaultQuotaWarnPercent = 80
+
+// TalkgroupQuota limits how much each user may talk on a talkgroup per day and per month.
+// A limit of zero means that period is unlimited.
+type TalkgroupQuota struct {
+	ID             uint           `json:"id" gorm:"primaryKey"`
+	TalkgroupID    uint           `json:"talkgroup_id" gorm:"uniqueIndex"`
+	DailySeconds   uint           `json:"daily_seconds"`
+	MonthlySeconds uint           `json:"monthly_seconds"`
+	WarnPercent    uint           `json:"warn_percent"`
+	Enforce        bool           `json:"enforce"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"-"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// TalkgroupQuotaUsage is a user's talk time against a talkgroup quota
+type TalkgroupQuotaUsage struct {
+	DailyUsed   time.Duration `json:"daily_used"`
+	MonthlyUsed time.Duration `json:"monthly_used"`
+	Warning     bool          `json:"warning"`
+	Exceeded    bool          `json:"exceeded"`
+}
+
+// FindTalkgroupQuota returns the quota set on a talkgroup, if any
+func FindTalkgroupQuota(db *gorm.DB, talkgroupID uint) (TalkgroupQuota, bool, error) {
+	var quotas []TalkgroupQuota
+	err := db.Where("talkgroup_id = ?", talkgroupID).Limit(1).Find(&quotas).Error
+	if err != nil || len(quotas) == 0 {
+		return TalkgroupQuota{}, false, err
+	}
+	return quotas[0], true, nil
+}
+
+func DeleteTalkgroupQuota(db *gorm.DB, talkgroupID uint) error {
+	return db.Unscoped().Where("talkgroup_id = ?", talkgroupID).Delete(&TalkgroupQuota{}).Error
+}
+
+// SumUserTalkgroupCallDuration totals the talk time of a user's completed calls to a talkgroup since the given time.
+// Calls blocked by a quota are never recorded, so they don't count against it.
+func SumUserTalkgroupCallDuration(db *gorm.DB, userID uint, talkgroupID uint, since time.Time) (time.Duration, error) {
+	var total int64
+	err := db.Model(&Call{}).Select("COALESCE(SUM(duration), 0)").
+		Where("user_id = ? AND is_to_talkgroup = ? AND to_talkgroup_id = ? AND start_time >= ?", userID, true, talkgroupID, since).
+		Scan(&total).Error
+	return time.Duration(total), err
+}
+
+// Usage calculates a user's current daily and monthly usage of the quota
+func (q *TalkgroupQuota) Usage(db *gorm.DB, userID uint, now time.Time) (TalkgroupQuotaUsage, error) {
+	var usage TalkgroupQuotaUsage
+	var err error
+
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	usage.DailyUsed, err = SumUserTalkgroupCallDuration(db, userID, q.TalkgroupID, startOfDay)
+	if err != nil {
+		return usage, err
+	}
+	usage.MonthlyUsed, err = SumUserTalkgroupCallDuration(db, userID, q.TalkgroupID, startOfMonth)
+	if err != nil {
+		return usage, err
+	}
+
+	warnPercent := q.WarnPercent
+	if warnPercent == 0 {
+		warnPercent = defaultQuotaWarnPercent
+	}
+
+	check := func(used time.Duration, limitSeconds uint) {
+		if limitSeconds == 0 {
+			return
+		}
+		limit := time.Duration(limitSeconds) * time.Second
+		if used >= limit {
+			usage.Exceeded = true
+		}
+		if used*100 >= limit*time.Duration(warnPercent) {
+			usage.Warning = true
+		}
+	}
+	check(usage.DailyUsed, q.DailySeconds)
+	check(usage.MonthlyUsed, q.MonthlySeconds)
+
+	return usage, nil
+}
@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func TestTalkgroupQuotaThresholds(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.TalkgroupQuota{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	now := time.Date(2024, time.June, 15, 12, 0, 0, 0, time.UTC)
+	tg := uint(91)
+	call := func(userID uint, start time.Time, duration time.Duration) {
+		t.Helper()
+		err := db.Create(&models.Call{UserID: userID, RepeaterID: 311001, IsToTalkgroup: true, ToTalkgroupID: &tg, StartTime: start, Duration: duration}).Error
+		if err != nil {
+			t.Fatalf("Failed to create call: %v", err)
+		}
+	}
+	// 70s today, plus 100s earlier in the month
+	call(3110001, now.Add(-time.Hour), 70*time.Second)
+	call(3110001, now.Add(-5*24*time.Hour), 100*time.Second)
+	// Other months don't count
+	call(3110001, now.Add(-30*24*time.Hour), time.Hour)
+
+	tests := []struct {
+		name     string
+		quota    models.TalkgroupQuota
+		warning  bool
+		exceeded bool
+	}{
+		{"unlimited", models.TalkgroupQuota{TalkgroupID: tg}, false, false},
+		{"under the default warning", models.TalkgroupQuota{TalkgroupID: tg, DailySeconds: 100}, false, false},
+		{"at the default warning", models.TalkgroupQuota{TalkgroupID: tg, DailySeconds: 87}, true, false},
+		{"custom warning", models.TalkgroupQuota{TalkgroupID: tg, DailySeconds: 100, WarnPercent: 50}, true, false},
+		{"daily limit reached", models.TalkgroupQuota{TalkgroupID: tg, DailySeconds: 70}, true, true},
+		{"monthly limit reached", models.TalkgroupQuota{TalkgroupID: tg, DailySeconds: 1000, MonthlySeconds: 170}, true, true},
+	}
+	for _, tt := range tests {
+		usage, err := tt.quota.Usage(db, 3110001, now)
+		if err != nil {
+			t.Fatalf("%s: failed to calculate usage: %v", tt.name, err)
+		}
+		if usage.DailyUsed != 70*time.Second || usage.MonthlyUsed != 170*time.Second {
+			t.Errorf("%s: unexpected usage %+v", tt.name, usage)
+		}
+		if usage.Warning != tt.warning || usage.Exceeded != tt.exceeded {
+			t.Errorf("%s: expected warning=%v exceeded=%v, got %+v", tt.name, tt.warning, tt.exceeded, usage)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func makeTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.AutoMigrate(&models.User{}, &models.Talkgroup{}, &models.Repeater{}, &models.Call{}, &models.CallTelemetry{}, &models.MissedCall{}, &models.AudioTest{})
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	return db
+}
+
+func TestAutoCreateTalkgroup(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+
+	exists, _, err := models.TalkgroupState(db, 31665)
+	if err != nil || exists {
+		t.Fatalf("Expected talkgroup not to exist, got exists=%v err=%v", exists, err)
+	}
+
+	created, err := models.AutoCreateTalkgroup(db, 31665, true)
+	if err != nil || !created {
+		t.Fatalf("Expected talkgroup to be created, got created=%v err=%v", created, err)
+	}
+	exists, pending, err := models.TalkgroupState(db, 31665)
+	if err != nil || !exists || !pending {
+		t.Errorf("Expected a pending talkgroup, got exists=%v pending=%v err=%v", exists, pending, err)
+	}
+
+	// A second key-up shouldn't recreate it
+	created, err = models.AutoCreateTalkgroup(db, 31665, false)
+	if err != nil || created {
+		t.Errorf("Expected existing talkgroup to be left alone, got created=%v err=%v", created, err)
+	}
+	_, pending, _ = models.TalkgroupState(db, 31665)
+	if !pending {
+		t.Error("Expected talkgroup to still be pending approval")
+	}
+
+	talkgroups, err := models.ListPendingTalkgroups(db)
+	if err != nil || len(talkgroups) != 1 || !talkgroups[0].AutoCreated {
+		t.Errorf("Unexpected pending talkgroups: %+v err=%v", talkgroups, err)
+	}
+}
+
+func TestTalkgroupMetadata(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+
+	db.Create(&models.Talkgroup{ID: 3100, Name: "USA", Language: "en", Region: "US", BridgeHint: models.BridgeHintShare})
+	db.Create(&models.Talkgroup{ID: 3148, Name: "Texas", Language: "en-US", Region: "US-TX", BridgeHint: models.BridgeHintLocal})
+	db.Create(&models.Talkgroup{ID: 214, Name: "Spain", Language: "es", Region: "ES", BridgeHint: models.BridgeHintShare})
+	db.Create(&models.Talkgroup{ID: 31665, Name: "Pending", Language: "en", BridgeHint: models.BridgeHintShare, PendingApproval: true})
+
+	talkgroups, err := models.ListTalkgroups(models.TalkgroupsWithMetadata(db, "en", ""))
+	if err != nil || len(talkgroups) != 3 {
+		t.Errorf("Expected 3 English talkgroups, got %+v err=%v", talkgroups, err)
+	}
+	talkgroups, err = models.ListTalkgroups(models.TalkgroupsWithMetadata(db, "en", "US-TX"))
+	if err != nil || len(talkgroups) != 1 || talkgroups[0].ID != 3148 {
+		t.Errorf("Expected only TG 3148, got %+v err=%v", talkgroups, err)
+	}
+	// "e" is not a prefix match for "en" or "es"
+	talkgroups, err = models.ListTalkgroups(models.TalkgroupsWithMetadata(db, "e", ""))
+	if err != nil || len(talkgroups) != 0 {
+		t.Errorf("Expected no talkgroups, got %+v err=%v", talkgroups, err)
+	}
+
+	shared, err := models.ListTalkgroupsByBridgeHint(db, models.BridgeHintShare)
+	if err != nil || len(shared) != 2 || shared[0].ID != 214 || shared[1].ID != 3100 {
+		t.Errorf("Expected TGs 214 and 3100 to be shared, got %+v err=%v", shared, err)
+	}
+}
+
+func TestFindTalkgroupCodecPolicy(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+
+	db.Create(&models.Talkgroup{ID: 3100, Name: "USA"})
+	db.Create(&models.Talkgroup{ID: 31700, Name: "M17", CodecPolicy: models.CodecPolicyTranscode})
+
+	policy, err := models.FindTalkgroupCodecPolicy(db, 3100)
+	if err != nil || policy != models.CodecPolicyBlock {
+		t.Errorf("Expected TG 3100 to block, got %q err=%v", policy, err)
+	}
+	policy, err = models.FindTalkgroupCodecPolicy(db, 31700)
+	if err != nil || policy != models.CodecPolicyTranscode {
+		t.Errorf("Expected TG 31700 to transcode, got %q err=%v", policy, err)
+	}
+	policy, err = models.FindTalkgroupCodecPolicy(db, 9)
+	if err != nil || policy != models.CodecPolicyBlock {
+		t.Errorf("Expected a missing talkgroup to block, got %q err=%v", policy, err)
+	}
+}
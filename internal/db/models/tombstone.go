@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of objects that leave a tombstone when deleted
+const (
+	TombstoneUser      = "user"
+	TombstoneRepeater  = "repeater"
+	TombstoneTalkgroup = "talkgroup"
+	TombstoneCall      = "call"
+)
+
+// TombstoneTTL is how long a deletion is remembered. A sync client that has been away longer
+// than this can't be told what it missed and has to start over.
+const TombstoneTTL = 30 * day
+
+// SyncCallWindow is how far back calls are synced. Clients drop calls older than this themselves,
+// so only calls deleted inside it, such as by a data deletion request, need a tombstone.
+const SyncCallWindow = day
+
+// Tombstone records that an object was deleted, so clients keeping a local copy
+// of it can be told to drop it.
+type Tombstone struct {
+	ID        uint      `json:"-" gorm:"primaryKey"`
+	Kind      string    `json:"kind" gorm:"index:idx_tombstone"`
+	ObjectID  uint      `json:"id"`
+	DeletedAt time.Time `json:"deleted_at" gorm:"index:idx_tombstone"`
+}
+
+func recordTombstones(db *gorm.DB, kind string, ids ...uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	now := time.Now()
+	tombstones := make([]Tombstone, 0, len(ids))
+	for _, id := range ids {
+		tombstones = append(tombstones, Tombstone{Kind: kind, ObjectID: id, DeletedAt: now})
+	}
+	return db.Create(&tombstones).Error
+}
+
+// ListTombstones lists the IDs of objects of a kind deleted at or after since
+func ListTombstones(db *gorm.DB, kind string, since time.Time) ([]uint, error) {
+	ids := []uint{}
+	err := db.Model(&Tombstone{}).Where("kind = ? AND deleted_at >= ?", kind, since).Order("id asc").Pluck("object_id", &ids).Error
+	return ids, err
+}
+
+// PurgeExpiredTombstones forgets deletions older than TombstoneTTL
+func PurgeExpiredTombstones(db *gorm.DB, now time.Time) (int64, error) {
+	result := db.Where("deleted_at < ?", now.Add(-TombstoneTTL)).Delete(&Tombstone{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func TestTombstones(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.Tombstone{}, &models.AirtimeRollup{}, &models.DeferredData{}, &models.ArchiveRecord{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	const dmrID = 3191868
+	now := time.Now()
+	recent := models.Call{UserID: dmrID, StartTime: now.Add(-time.Hour)}
+	old := models.Call{UserID: dmrID, StartTime: now.Add(-2 * models.SyncCallWindow)}
+	db.Create(&recent)
+	db.Create(&old)
+
+	before := now.Add(-time.Second)
+	if _, err := models.DeleteUserData(db, dmrID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Clients never held the old call, so only the recent one needs a tombstone
+	ids, err := models.ListTombstones(db, models.TombstoneCall, before)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != recent.ID {
+		t.Errorf("Expected a tombstone for call %d, got %v", recent.ID, ids)
+	}
+	if ids, _ := models.ListTombstones(db, models.TombstoneCall, time.Now().Add(time.Second)); len(ids) != 0 {
+		t.Errorf("Expected no tombstones after the deletion, got %v", ids)
+	}
+	if ids, _ := models.ListTombstones(db, models.TombstoneRepeater, before); len(ids) != 0 {
+		t.Errorf("Expected no repeater tombstones, got %v", ids)
+	}
+
+	purged, err := models.PurgeExpiredTombstones(db, now.Add(models.TombstoneTTL+time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("Expected 1 tombstone purged, got %d", purged)
+	}
+}
@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TXInhibit is an emergency stop on routing, either for a set of talkgroups or, when
+// Hub is set, for everything except the exception talkgroups. Inhibits are lifted
+// rather than deleted so the table doubles as the audit trail.
+type TXInhibit struct {
+	ID          uint        `json:"id" gorm:"primaryKey"`
+	Hub         bool        `json:"hub"`
+	Talkgroups  []Talkgroup `json:"talkgroups" gorm:"many2many:tx_inhibit_talkgroups;"`
+	Exceptions  []Talkgroup `json:"exceptions" gorm:"many2many:tx_inhibit_exceptions;"`
+	Reason      string      `json:"reason"`
+	CreatedByID uint        `json:"created_by_id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	LiftedByID  *uint       `json:"lifted_by_id"`
+	LiftedAt    *time.Time  `json:"lifted_at"`
+}
+
+// Active reports whether the inhibit hasn't been lifted
+func (i *TXInhibit) Active() bool {
+	return i.LiftedAt == nil
+}
+
+func preloadTXInhibits(db *gorm.DB) *gorm.DB {
+	return db.Preload("Talkgroups").Preload("Exceptions")
+}
+
+// ListActiveTXInhibits returns the inhibits in force, oldest first
+func ListActiveTXInhibits(db *gorm.DB) ([]TXInhibit, error) {
+	var inhibits []TXInhibit
+	err := preloadTXInhibits(db).Where("lifted_at IS NULL").Order("id asc").Find(&inhibits).Error
+	return inhibits, err
+}
+
+// ListTXInhibits returns every inhibit, lifted or not, newest first
+func ListTXInhibits(db *gorm.DB) ([]TXInhibit, error) {
+	var inhibits []TXInhibit
+	err := preloadTXInhibits(db).Order("id desc").Find(&inhibits).Error
+	return inhibits, err
+}
+
+func FindTXInhibitByID(db *gorm.DB, id uint) (TXInhibit, error) {
+	var inhibit TXInhibit
+	err := preloadTXInhibits(db).First(&inhibit, id).Error
+	return inhibit, err
+}
+
+// LiftTXInhibit records who lifted an inhibit and when. It returns
+// gorm.ErrRecordNotFound if the inhibit doesn't exist or was already lifted.
+func LiftTXInhibit(db *gorm.DB, id uint, userID uint, at time.Time) error {
+	result := db.Model(&TXInhibit{}).Where("id = ? AND lifted_at IS NULL", id).
+		Updates(map[string]any{"lifted_by_id": userID, "lifted_at": at})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"gorm.io/gorm"
+)
+
+func TestTXInhibitAuditTrail(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.TXInhibit{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	db.Create(&models.Talkgroup{ID: 3100})
+
+	first := models.TXInhibit{Talkgroups: []models.Talkgroup{{ID: 3100}}, Reason: "Jamming", CreatedByID: 1}
+	second := models.TXInhibit{Hub: true, Reason: "Takedown", CreatedByID: 1}
+	if err := db.Create(&first).Error; err != nil {
+		t.Fatalf("Failed to create inhibit: %v", err)
+	}
+	if err := db.Create(&second).Error; err != nil {
+		t.Fatalf("Failed to create inhibit: %v", err)
+	}
+
+	if err := models.LiftTXInhibit(db, first.ID, 2, time.Now()); err != nil {
+		t.Fatalf("Failed to lift inhibit: %v", err)
+	}
+	if err := models.LiftTXInhibit(db, first.ID, 2, time.Now()); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Expected lifting twice to fail with ErrRecordNotFound, got %v", err)
+	}
+
+	active, err := models.ListActiveTXInhibits(db)
+	if err != nil || len(active) != 1 || active[0].ID != second.ID {
+		t.Errorf("Expected only the hub-wide inhibit to be active, got %v (%v)", active, err)
+	}
+
+	all, err := models.ListTXInhibits(db)
+	if err != nil || len(all) != 2 {
+		t.Fatalf("Expected lifted inhibits to be kept, got %v (%v)", all, err)
+	}
+	lifted, err := models.FindTXInhibitByID(db, first.ID)
+	if err != nil {
+		t.Fatalf("Failed to find inhibit: %v", err)
+	}
+	if lifted.Active() || lifted.LiftedByID == nil || *lifted.LiftedByID != 2 {
+		t.Errorf("Expected the lift to be recorded, got %+v", lifted)
+	}
+	if len(lifted.Talkgroups) != 1 || lifted.Talkgroups[0].ID != 3100 {
+		t.Errorf("Expected the inhibited talkgroups to be kept, got %v", lifted.Talkgroups)
+	}
+}
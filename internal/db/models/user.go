@@ -21,6 +21,7 @@
 package models
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/USA-RedDragon/DMRHub/internal/config"
@@ -40,12 +41,61 @@ type User struct {
 	Admin     bool           `json:"admin"`
 	Approved  bool           `json:"approved" binding:"required"`
 	Suspended bool           `json:"suspended"`
+	Listener  bool           `json:"listener"`
+	Locale    string         `json:"locale"`
 	Repeaters []Repeater     `json:"repeaters" gorm:"foreignKey:OwnerID"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"-"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+// ListenerIDBase is the first ID given to listener accounts. DMR IDs are 24 bits,
+// so listeners can never collide with a radio or be the target of a packet.
+const ListenerIDBase = 1 << 24
+
+// NextListenerID finds an unused ID for a new listener account
+func NextListenerID(db *gorm.DB) (uint, error) {
+	var maxID *uint
+	err := db.Unscoped().Model(&User{}).Where("id >= ?", ListenerIDBase).Select("MAX(id)").Scan(&maxID).Error
+	if err != nil {
+		return 0, err
+	}
+	if maxID == nil {
+		return ListenerIDBase, nil
+	}
+	return *maxID + 1, nil
+}
+
+// listenerIDAttempts is how many times CreateListener tries another ID when it loses a race for one
+const listenerIDAttempts = 5
+
+// CreateListener creates a listener account with the next free listener ID, giving it a
+// placeholder callsign if it has none. Listeners registering at the same time can be handed
+// the same ID, so the insert is retried with a new one if another account took it first.
+func CreateListener(db *gorm.DB, user *User) error {
+	placeholder := user.Callsign == ""
+	for attempt := 1; ; attempt++ {
+		id, err := NextListenerID(db)
+		if err != nil {
+			return err
+		}
+		user.ID = id
+		if placeholder {
+			// Callsigns are unique, so give listeners without one a placeholder
+			user.Callsign = fmt.Sprintf("SWL-%d", id-ListenerIDBase+1)
+		}
+		err = db.Create(user).Error
+		if err == nil || attempt == listenerIDAttempts {
+			return err
+		}
+		// Only losing the race for the ID is worth another try
+		var taken int64
+		if db.Unscoped().Model(&User{}).Where("id = ?", user.ID).Count(&taken).Error != nil || taken == 0 {
+			return err
+		}
+	}
+}
+
 func (u User) TableName() string {
 	return "users"
 }
@@ -68,6 +118,13 @@ func FindUserByID(db *gorm.DB, id uint) (User, error) {
 	return user, err
 }
 
+// FindUserByCallsign finds the user registered with a callsign, which is unique
+func FindUserByCallsign(db *gorm.DB, callsign string) (User, error) {
+	var user User
+	err := db.Where("callsign = ?", callsign).First(&user).Error
+	return user, err
+}
+
 func ListUsers(db *gorm.DB) ([]User, error) {
 	var users []User
 	err := db.Preload("Repeaters").Find(&users).Error
@@ -155,14 +212,39 @@ func DeleteUser(db *gorm.DB, id uint) error {
 	err := db.Transaction(func(tx *gorm.DB) error {
 		var repeaters []Repeater
 		tx.Where("owner_id = ?", id).Find(&repeaters)
+		repeaterIDs := make([]uint, 0, len(repeaters))
 		for _, repeater := range repeaters {
+			repeaterIDs = append(repeaterIDs, repeater.ID)
 			tx.Unscoped().Where("(is_to_repeater = ? AND to_repeater_id = ?) OR repeater_id = ?", true, repeater.ID, repeater.ID).Delete(&Call{})
+			tx.Where("call_id NOT IN (?)", tx.Unscoped().Model(&Call{}).Select("id")).Delete(&CallTelemetry{})
+			tx.Unscoped().Table("repeater_group_repeaters").Where("repeater_id = ?", repeater.ID).Delete(&RepeaterGroup{})
+			tx.Unscoped().Where("repeater_id = ?", repeater.ID).Delete(&RepeaterPermission{})
+			tx.Where("repeater_id = ? OR linked_repeater_id = ?", repeater.ID, repeater.ID).Delete(&RepeaterLink{})
 			tx.Unscoped().Select(clause.Associations, "TS1StaticTalkgroups").Select(clause.Associations, "TS2StaticTalkgroups").Delete(repeater)
 			tx.Unscoped().Table("talkgroup_admins").Where("user_id = ?", id).Delete(&Talkgroup{})
 			tx.Unscoped().Table("talkgroup_ncos").Where("user_id = ?", id).Delete(&Talkgroup{})
 		}
+		tx.Unscoped().Where("user_id = ?", id).Delete(&RepeaterPermission{})
+		if err := DeleteTalkgroupProfileForUser(tx, id); err != nil {
+			return err
+		}
+		if err := DeleteMissedCallsForUser(tx, id); err != nil {
+			return err
+		}
+		if err := DeleteAudioTestsForUser(tx, id); err != nil {
+			return err
+		}
+		if err := DeleteDigestSubscription(tx, id); err != nil {
+			return err
+		}
+		if err := DeleteNotificationPreferences(tx, id); err != nil {
+			return err
+		}
 		tx.Unscoped().Select(clause.Associations, "Repeaters").Delete(&User{ID: id})
-		return nil
+		if err := recordTombstones(tx, TombstoneRepeater, repeaterIDs...); err != nil {
+			return err
+		}
+		return recordTombstones(tx, TombstoneUser, id)
 	})
 	if err != nil {
 		logging.Errorf("Error deleting user: %s", err)
@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+//nolint:golint,wrapcheck
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserFilter selects users for bulk administration. Zero fields match everyone.
+type UserFilter struct {
+	CallsignPrefix   string    `json:"callsign_prefix"`
+	MinID            uint      `json:"min_id"`
+	MaxID            uint      `json:"max_id"`
+	RegisteredAfter  time.Time `json:"registered_after"`
+	RegisteredBefore time.Time `json:"registered_before"`
+}
+
+func (f UserFilter) apply(db *gorm.DB) *gorm.DB {
+	if f.CallsignPrefix != "" {
+		db = db.Where("callsign LIKE ?", strings.ToUpper(f.CallsignPrefix)+"%")
+	}
+	if f.MinID != 0 {
+		db = db.Where("id >= ?", f.MinID)
+	}
+	if f.MaxID != 0 {
+		db = db.Where("id <= ?", f.MaxID)
+	}
+	if !f.RegisteredAfter.IsZero() {
+		db = db.Where("created_at >= ?", f.RegisteredAfter)
+	}
+	if !f.RegisteredBefore.IsZero() {
+		db = db.Where("created_at < ?", f.RegisteredBefore)
+	}
+	return db
+}
+
+// FindUnapprovedUsersMatching returns the users waiting for approval that match a filter
+func FindUnapprovedUsersMatching(db *gorm.DB, filter UserFilter) ([]User, error) {
+	var users []User
+	err := filter.apply(db.Where("approved = ?", false)).Order("id asc").Find(&users).Error
+	return users, err
+}
+
+// FindUsersByIDs returns the users with the given IDs, skipping IDs that don't exist
+func FindUsersByIDs(db *gorm.DB, ids []uint) ([]User, error) {
+	var users []User
+	if len(ids) == 0 {
+		return users, nil
+	}
+	err := db.Where("id IN ?", ids).Order("id asc").Find(&users).Error
+	return users, err
+}
+
+// UpdateUsers sets a column on every user in ids
+func UpdateUsers(db *gorm.DB, ids []uint, column string, value any) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result := db.Model(&User{}).Where("id IN ?", ids).Update(column, value)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+func TestFindUnapprovedUsersMatching(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	registered := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	users := []models.User{
+		{ID: 3110001, Callsign: "KI5VMF", Username: "a", CreatedAt: registered},
+		{ID: 3110002, Callsign: "N0CALL", Username: "b", CreatedAt: registered},
+		{ID: 3110003, Callsign: "KI5ABC", Username: "c", CreatedAt: registered.Add(48 * time.Hour)},
+		{ID: 2340001, Callsign: "KI5DEF", Username: "d", CreatedAt: registered},
+		{ID: 3110004, Callsign: "KI5GHI", Username: "e", CreatedAt: registered, Approved: true},
+	}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatalf("Failed to create users: %v", err)
+	}
+
+	matched, err := models.FindUnapprovedUsersMatching(db, models.UserFilter{
+		CallsignPrefix:   "ki5",
+		MinID:            3100000,
+		MaxID:            3199999,
+		RegisteredBefore: registered.Add(24 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Failed to find users: %v", err)
+	}
+	if len(matched) != 1 || matched[0].ID != 3110001 {
+		t.Errorf("Expected only the pending US KI5 user registered in time, got %+v", matched)
+	}
+
+	all, err := models.FindUnapprovedUsersMatching(db, models.UserFilter{})
+	if err != nil || len(all) != 4 {
+		t.Errorf("Expected an empty filter to match every pending user, got %d (%v)", len(all), err)
+	}
+
+	updated, err := models.UpdateUsers(db, []uint{3110001, 3110002}, "approved", true)
+	if err != nil || updated != 2 {
+		t.Errorf("Expected two users to be approved, got %d (%v)", updated, err)
+	}
+}
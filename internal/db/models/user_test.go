@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package models_test
+
+import (
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"gorm.io/gorm"
+)
+
+func TestNextListenerID(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	db.Create(&models.User{ID: 3113113, Callsign: "N0CALL", Username: "n0call"})
+
+	id, err := models.NextListenerID(db)
+	if err != nil {
+		t.Fatalf("Failed to get listener ID: %v", err)
+	}
+	if id != models.ListenerIDBase {
+		t.Errorf("Expected the first listener to get %d, got %d", models.ListenerIDBase, id)
+	}
+	// Listener IDs are above anything a 24-bit DMR ID can reach
+	if id <= 0xFFFFFF {
+		t.Errorf("Expected listener ID %d to be outside the DMR ID range", id)
+	}
+
+	db.Create(&models.User{ID: id, Callsign: "SWL-1", Username: "listener1", Listener: true})
+	if id, err = models.NextListenerID(db); err != nil || id != models.ListenerIDBase+1 {
+		t.Errorf("Expected the next listener to get %d, got %d (%v)", models.ListenerIDBase+1, id, err)
+	}
+
+	// Deleted listeners keep their IDs so they aren't handed out again
+	db.Create(&models.User{ID: models.ListenerIDBase + 1, Callsign: "SWL-2", Username: "listener2", Listener: true})
+	db.Delete(&models.User{}, models.ListenerIDBase+1)
+	if id, err = models.NextListenerID(db); err != nil || id != models.ListenerIDBase+2 {
+		t.Errorf("Expected a deleted listener's ID to stay reserved, got %d (%v)", id, err)
+	}
+}
+
+func TestCreateListenerRetriesTakenIDs(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("Failed to get database: %v", err)
+	}
+	// Every connection to an unnamed database gets its own, so the racing insert has to share it
+	sqlDB.SetMaxOpenConns(1)
+
+	// Another registration takes the next ID between the lookup and the insert
+	raced := false
+	err = db.Callback().Create().Before("gorm:begin_transaction").Register("test:race", func(tx *gorm.DB) {
+		if raced {
+			return
+		}
+		raced = true
+		tx.Session(&gorm.Session{NewDB: true}).Exec("INSERT INTO users (id, callsign, username) VALUES (?, ?, ?)", models.ListenerIDBase, "SWL-1", "racer")
+	})
+	if err != nil {
+		t.Fatalf("Failed to register callback: %v", err)
+	}
+
+	listener := models.User{Username: "listener", Listener: true}
+	if err := models.CreateListener(db, &listener); err != nil {
+		t.Fatalf("Expected the listener to be created with another ID, got %v", err)
+	}
+	if listener.ID != models.ListenerIDBase+1 || listener.Callsign != "SWL-2" {
+		t.Errorf("Expected the next ID and placeholder, got %d and %s", listener.ID, listener.Callsign)
+	}
+
+	// A conflict on something other than the ID isn't retried
+	duplicate := models.User{Username: "other", Callsign: "SWL-2", Listener: true}
+	if err := models.CreateListener(db, &duplicate); err == nil {
+		t.Error("Expected a taken callsign to fail")
+	}
+}
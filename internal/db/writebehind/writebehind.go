@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package writebehind batches non-critical database writes off of the packet path.
+package writebehind
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"gorm.io/gorm"
+)
+
+// Write is a deferred database operation.
+type Write func(db *gorm.DB) error
+
+// Writer queues writes and flushes them to the database on an interval.
+// Enqueueing never blocks: once the configured capacity is reached new
+// writes are shed and counted instead.
+type Writer struct {
+	db       *gorm.DB
+	interval time.Duration
+	capacity int
+
+	mu      sync.Mutex
+	pings   map[uint]time.Time
+	pending []Write
+
+	flushMu sync.Mutex
+	dropped atomic.Uint64
+}
+
+// NewWriter creates a Writer that flushes to db every interval and holds at most capacity pending writes.
+func NewWriter(db *gorm.DB, interval time.Duration, capacity int) *Writer {
+	return &Writer{
+		db:       db,
+		interval: interval,
+		capacity: capacity,
+		pings:    make(map[uint]time.Time),
+	}
+}
+
+// TouchRepeater records that a repeater was heard from at the given time.
+// Multiple pings from the same repeater between flushes coalesce into a single update.
+func (w *Writer) TouchRepeater(repeaterID uint, at time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.pings[repeaterID]; !ok && w.sizeLocked() >= w.capacity {
+		w.dropped.Add(1)
+		return false
+	}
+	w.pings[repeaterID] = at
+	return true
+}
+
+// Enqueue adds an arbitrary write to be run on the next flush.
+func (w *Writer) Enqueue(write Write) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.sizeLocked() >= w.capacity {
+		w.dropped.Add(1)
+		return false
+	}
+	w.pending = append(w.pending, write)
+	return true
+}
+
+// Pending returns the number of writes waiting to be flushed.
+func (w *Writer) Pending() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.sizeLocked()
+}
+
+// Dropped returns the number of writes shed because the queue was full.
+func (w *Writer) Dropped() uint64 {
+	return w.dropped.Load()
+}
+
+func (w *Writer) sizeLocked() int {
+	return len(w.pings) + len(w.pending)
+}
+
+// Run flushes the queue every interval until ctx is cancelled, then flushes once more.
+func (w *Writer) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			w.Flush()
+			return
+		case <-ticker.C:
+			w.Flush()
+		}
+	}
+}
+
+// Flush writes everything currently queued to the database.
+func (w *Writer) Flush() {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	pings := w.pings
+	pending := w.pending
+	w.pings = make(map[uint]time.Time)
+	w.pending = nil
+	w.mu.Unlock()
+
+	for repeaterID, at := range pings {
+		err := w.db.Model(&models.Repeater{}).Where("id = ?", repeaterID).Update("last_ping", at).Error
+		if err != nil {
+			logging.Errorf("Error saving ping for repeater %d: %v", repeaterID, err)
+		}
+	}
+	for _, write := range pending {
+		if err := write(w.db); err != nil {
+			logging.Errorf("Error flushing queued write: %v", err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package writebehind_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/db/writebehind"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+const slowQuery = 200 * time.Millisecond
+
+func makeSlowDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.AutoMigrate(&models.User{}, &models.Talkgroup{}, &models.Repeater{})
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	err = db.Create(&models.Repeater{RepeaterConfiguration: models.RepeaterConfiguration{ID: 311860}}).Error
+	if err != nil {
+		t.Fatalf("Failed to create repeater: %v", err)
+	}
+	err = db.Callback().Update().Before("gorm:update").Register("slow", func(*gorm.DB) {
+		time.Sleep(slowQuery)
+	})
+	if err != nil {
+		t.Fatalf("Failed to register callback: %v", err)
+	}
+	return db
+}
+
+func TestTouchDoesNotWaitOnDatabase(t *testing.T) {
+	t.Parallel()
+	db := makeSlowDB(t)
+	writer := writebehind.NewWriter(db, 10*time.Millisecond, 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go writer.Run(ctx)
+
+	start := time.Now()
+	for i := 0; i < 50; i++ {
+		writer.TouchRepeater(311860, time.Now())
+		time.Sleep(time.Millisecond)
+	}
+	// 50 synchronous saves would have taken 50 * slowQuery
+	if elapsed := time.Since(start); elapsed > slowQuery {
+		t.Errorf("Enqueueing took %s, expected it to be independent of database latency", elapsed)
+	}
+}
+
+func TestFlushCoalescesPings(t *testing.T) {
+	t.Parallel()
+	db := makeSlowDB(t)
+	writer := writebehind.NewWriter(db, time.Hour, 100)
+
+	last := time.Now().Truncate(time.Second)
+	writer.TouchRepeater(311860, last.Add(-time.Minute))
+	writer.TouchRepeater(311860, last)
+	if writer.Pending() != 1 {
+		t.Fatalf("Expected 1 pending write, got %d", writer.Pending())
+	}
+
+	writer.Flush()
+	if writer.Pending() != 0 {
+		t.Errorf("Expected queue to be empty after flush, got %d", writer.Pending())
+	}
+	repeater, err := models.FindRepeaterByID(db, 311860)
+	if err != nil {
+		t.Fatalf("Failed to find repeater: %v", err)
+	}
+	if !repeater.LastPing.Equal(last) {
+		t.Errorf("Expected last ping %s, got %s", last, repeater.LastPing)
+	}
+}
+
+func TestOverloadSheds(t *testing.T) {
+	t.Parallel()
+	writer := writebehind.NewWriter(nil, time.Hour, 2)
+
+	if !writer.TouchRepeater(1, time.Now()) || !writer.Enqueue(func(*gorm.DB) error { return nil }) {
+		t.Fatal("Expected writes under capacity to be accepted")
+	}
+	// Existing entries still coalesce when full
+	if !writer.TouchRepeater(1, time.Now()) {
+		t.Error("Expected an update to a queued repeater to be accepted")
+	}
+	if writer.TouchRepeater(2, time.Now()) {
+		t.Error("Expected a new repeater to be shed when full")
+	}
+	if writer.Enqueue(func(*gorm.DB) error { return nil }) {
+		t.Error("Expected a write to be shed when full")
+	}
+	if writer.Dropped() != 2 {
+		t.Errorf("Expected 2 dropped writes, got %d", writer.Dropped())
+	}
+}
@@ -0,0 +1,185 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package digest builds and sends the opt-in activity digest emails
+package digest
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/i18n"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/smtp"
+	"gorm.io/gorm"
+)
+
+//go:embed templates/*.html
+var templates embed.FS
+
+// RepeaterStatus is the state of one of the user's repeaters when the digest was built
+type RepeaterStatus struct {
+	ID       uint
+	Callsign string
+	Online   bool
+	LastSeen time.Time
+}
+
+// Digest is everything rendered into a single digest email
+type Digest struct {
+	Locale        string
+	NetworkName   string
+	Callsign      string
+	Frequency     models.DigestFrequency
+	Since         time.Time
+	Until         time.Time
+	CallsMade     int
+	TalkTime      time.Duration
+	Repeaters     []RepeaterStatus
+	MOTD          string
+	NewTalkgroups []models.Talkgroup
+}
+
+// Build gathers a user's activity, their repeaters' status and network news for the subscription's period
+func Build(db *gorm.DB, subscription models.DigestSubscription, now time.Time) (Digest, error) {
+	user, err := models.FindUserByID(db, subscription.UserID)
+	if err != nil {
+		return Digest{}, fmt.Errorf("failed to find user %d: %w", subscription.UserID, err)
+	}
+
+	digest := Digest{
+		Locale:    user.Locale,
+		Callsign:  user.Callsign,
+		Frequency: subscription.Frequency,
+		Since:     now.Add(-subscription.Frequency.Period()),
+		Until:     now,
+	}
+	if digest.Locale == "" {
+		digest.Locale = i18n.Default()
+	}
+
+	digest.CallsMade, digest.TalkTime, err = models.SumUserCalls(db, user.ID, digest.Since, digest.Until)
+	if err != nil {
+		return Digest{}, fmt.Errorf("failed to sum calls: %w", err)
+	}
+
+	for _, repeater := range user.Repeaters {
+		digest.Repeaters = append(digest.Repeaters, RepeaterStatus{
+			ID:       repeater.ID,
+			Callsign: repeater.Callsign,
+			Online:   !repeater.LastPing.IsZero() && now.Sub(repeater.LastPing) < repeater.PingTimeout(),
+			LastSeen: repeater.LastPing,
+		})
+	}
+
+	settings, err := models.GetInstanceSettings(db)
+	if err != nil {
+		return Digest{}, fmt.Errorf("failed to get instance settings: %w", err)
+	}
+	digest.NetworkName = settings.NetworkName
+	digest.MOTD = settings.MOTD
+
+	digest.NewTalkgroups, err = models.ListTalkgroupsCreatedSince(db, digest.Since, digest.Until)
+	if err != nil {
+		return Digest{}, fmt.Errorf("failed to list new talkgroups: %w", err)
+	}
+	return digest, nil
+}
+
+// Subject is the localized email subject line
+func (d Digest) Subject() string {
+	return i18n.T(d.Locale, "digest_subject", d.NetworkName, i18n.T(d.Locale, "digest_frequency_"+string(d.Frequency)))
+}
+
+// Render produces the HTML body of the digest
+func (d Digest) Render() (string, error) {
+	tmpl, err := template.New("digest.html").Funcs(template.FuncMap{
+		"t": func(key string, args ...any) string {
+			return i18n.T(d.Locale, key, args...)
+		},
+		"date": func(t time.Time) string {
+			return t.UTC().Format("2006-01-02 15:04 MST")
+		},
+		"duration": func(length time.Duration) string {
+			return length.Round(time.Second).String()
+		},
+	}).ParseFS(templates, "templates/digest.html")
+	if err != nil {
+		return "", fmt.Errorf("failed to parse digest template: %w", err)
+	}
+	var body bytes.Buffer
+	err = tmpl.Execute(&body, d)
+	if err != nil {
+		return "", fmt.Errorf("failed to render digest: %w", err)
+	}
+	return body.String(), nil
+}
+
+// SendDue sends every digest that is due and returns how many were sent
+func SendDue(db *gorm.DB, now time.Time) int {
+	subscriptions, err := models.ListDueDigestSubscriptions(db, now)
+	if err != nil {
+		logging.Errorf("Failed to list digest subscriptions: %s", err)
+		return 0
+	}
+	sent := 0
+	for _, subscription := range subscriptions {
+		claimed, err := models.ClaimDigest(db, subscription, now)
+		if err != nil {
+			logging.Errorf("Failed to claim digest for user %d: %s", subscription.UserID, err)
+			continue
+		}
+		if !claimed {
+			// Another replica got to it first
+			continue
+		}
+		err = sendDigest(db, subscription, now)
+		if err != nil {
+			logging.Errorf("Failed to send digest to user %d: %s", subscription.UserID, err)
+			err = models.UnclaimDigest(db, subscription)
+			if err != nil {
+				logging.Errorf("Failed to unclaim digest for user %d: %s", subscription.UserID, err)
+			}
+			continue
+		}
+		sent++
+	}
+	return sent
+}
+
+// sendDigest builds and emails one user's digest
+func sendDigest(db *gorm.DB, subscription models.DigestSubscription, now time.Time) error {
+	digest, err := Build(db, subscription, now)
+	if err != nil {
+		return err
+	}
+	body, err := digest.Render()
+	if err != nil {
+		return err
+	}
+	err = smtp.Send(subscription.Email, digest.Subject(), body)
+	if err != nil {
+		return fmt.Errorf("failed to send digest: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package digest_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/digest"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestBuildAndRender(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.AutoMigrate(&models.User{}, &models.Talkgroup{}, &models.Repeater{}, &models.Call{}, &models.InstanceSettings{}, &models.DigestSubscription{})
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	now := time.Now()
+
+	user := models.User{ID: 3191868, Callsign: "KI5VMF", Username: "test", Approved: true, Locale: "en"}
+	db.Create(&user)
+	repeater := models.Repeater{OwnerID: user.ID, LastPing: now.Add(-time.Minute)}
+	repeater.ID = 319186801
+	repeater.Callsign = "KI5VMF"
+	db.Create(&repeater)
+	db.Create(&models.Talkgroup{ID: 31665, Name: "TGIF", CreatedAt: now.Add(-time.Hour)})
+	db.Create(&models.Call{UserID: user.ID, RepeaterID: repeater.ID, StartTime: now.Add(-time.Hour), Duration: 90 * time.Second})
+	db.Create(&models.Call{UserID: user.ID, RepeaterID: repeater.ID, StartTime: now.Add(-48 * time.Hour), Duration: time.Minute})
+
+	subscription := models.DigestSubscription{UserID: user.ID, Email: "test@example.com", Frequency: models.DigestDaily}
+	if !subscription.Due(now) {
+		t.Error("Expected a new subscription to be due")
+	}
+
+	result, err := digest.Build(db, subscription, now)
+	if err != nil {
+		t.Fatalf("Failed to build digest: %v", err)
+	}
+	if result.CallsMade != 1 || result.TalkTime != 90*time.Second {
+		t.Errorf("Expected 1 call and 90s of talk time, got %d and %s", result.CallsMade, result.TalkTime)
+	}
+	if len(result.Repeaters) != 1 || !result.Repeaters[0].Online {
+		t.Errorf("Expected the repeater to be online, got %+v", result.Repeaters)
+	}
+	if len(result.NewTalkgroups) != 1 {
+		t.Errorf("Expected 1 new talkgroup, got %d", len(result.NewTalkgroups))
+	}
+
+	body, err := result.Render()
+	if err != nil {
+		t.Fatalf("Failed to render digest: %v", err)
+	}
+	for _, want := range []string{"Calls made: 1", "Talk time: 1m30s", "KI5VMF (319186801): online", "31665 - TGIF"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected digest to contain %q:\n%s", want, body)
+		}
+	}
+	if !strings.Contains(result.Subject(), "daily") {
+		t.Errorf("Unexpected subject %q", result.Subject())
+	}
+
+	sent := now
+	subscription.LastSentAt = &sent
+	if subscription.Due(now.Add(time.Hour)) {
+		t.Error("Expected the digest not to be due again so soon")
+	}
+	if !subscription.Due(now.Add(23 * time.Hour)) {
+		t.Error("Expected a daily digest to be due the next day")
+	}
+}
+
+func TestClaimDigest(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.DigestSubscription{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	now := time.Date(2024, time.June, 2, 6, 0, 0, 0, time.UTC)
+	lastSent := now.Add(-24 * time.Hour)
+	db.Create(&models.DigestSubscription{UserID: 1, Email: "new@example.com", Frequency: models.DigestDaily})
+	db.Create(&models.DigestSubscription{UserID: 2, Email: "daily@example.com", Frequency: models.DigestDaily, LastSentAt: &lastSent})
+	db.Create(&models.DigestSubscription{UserID: 3, Email: "weekly@example.com", Frequency: models.DigestWeekly, LastSentAt: &lastSent})
+
+	due, err := models.ListDueDigestSubscriptions(db, now)
+	if err != nil {
+		t.Fatalf("Failed to list due subscriptions: %v", err)
+	}
+	if len(due) != 2 {
+		t.Fatalf("Expected the new and daily subscriptions to be due, got %+v", due)
+	}
+
+	// Each replica lists the same due rows, but only the first claim on each wins
+	for _, subscription := range due {
+		for replica := range 2 {
+			claimed, err := models.ClaimDigest(db, subscription, now)
+			if err != nil {
+				t.Fatalf("Failed to claim digest: %v", err)
+			}
+			if claimed != (replica == 0) {
+				t.Errorf("User %d, replica %d: expected claimed to be %v", subscription.UserID, replica, replica == 0)
+			}
+		}
+	}
+	if due, _ := models.ListDueDigestSubscriptions(db, now); len(due) != 0 {
+		t.Errorf("Expected nothing due after claiming, got %+v", due)
+	}
+
+	// A digest that couldn't be sent is due again
+	if err := models.UnclaimDigest(db, models.DigestSubscription{UserID: 2, LastSentAt: &lastSent}); err != nil {
+		t.Fatalf("Failed to unclaim digest: %v", err)
+	}
+	due, _ = models.ListDueDigestSubscriptions(db, now)
+	if len(due) != 1 || due[0].UserID != 2 {
+		t.Errorf("Expected the unclaimed digest to be due again, got %+v", due)
+	}
+}
@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package bptc implements the BPTC(196,96) block product turbo code that
+// carries CSBKs, data headers, and link control in DMR data bursts.
+package bptc
+
+const (
+	// BurstLength is the length of a DMR burst in bytes
+	BurstLength = 33
+	// DataLength is the length of the payload carried by a BPTC(196,96) block in bytes
+	DataLength = 12
+
+	blockBits       = 196
+	interleaveStep  = 181
+	rowLength       = 15
+	rows            = 13
+	dataRows        = 9
+	firstHalfBits   = 98
+	secondHalfStart = 166
+)
+
+// Decode extracts the 96 payload bits from the info fields of a data burst.
+// Hamming parity is not used to correct errors; callers should validate the payload's CRC.
+func Decode(burst [BurstLength]byte) [DataLength]byte {
+	var raw [blockBits]bool
+	for i := 0; i < firstHalfBits; i++ {
+		raw[i] = bit(burst[:], i)
+	}
+	for i := 0; i < firstHalfBits; i++ {
+		raw[firstHalfBits+i] = bit(burst[:], secondHalfStart+i)
+	}
+
+	var deinterleaved [blockBits]bool
+	for i := 0; i < blockBits; i++ {
+		deinterleaved[i] = raw[(i*interleaveStep)%blockBits]
+	}
+
+	var data [DataLength]byte
+	for i, pos := range dataPositions() {
+		if deinterleaved[pos] {
+			data[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return data
+}
+
+// Encode writes the payload into the info fields of a data burst, leaving the
+// slot type and sync fields of the burst untouched.
+func Encode(burst [BurstLength]byte, data [DataLength]byte) [BurstLength]byte {
+	var block [blockBits]bool
+	for i, pos := range dataPositions() {
+		block[pos] = data[i/8]&(0x80>>(i%8)) != 0
+	}
+
+	// Row parity, Hamming (15,11,3)
+	for r := 0; r < dataRows; r++ {
+		row := block[1+r*rowLength : 1+(r+1)*rowLength]
+		row[11] = row[0] != row[1] != row[2] != row[3] != row[5] != row[7] != row[8]
+		row[12] = row[1] != row[2] != row[3] != row[4] != row[6] != row[8] != row[9]
+		row[13] = row[2] != row[3] != row[4] != row[5] != row[7] != row[9] != row[10]
+		row[14] = row[0] != row[1] != row[2] != row[4] != row[6] != row[7] != row[10]
+	}
+
+	// Column parity, Hamming (13,9,3)
+	for c := 0; c < rowLength; c++ {
+		var col [rows]bool
+		for r := 0; r < dataRows; r++ {
+			col[r] = block[1+c+r*rowLength]
+		}
+		col[9] = col[0] != col[1] != col[3] != col[5] != col[6]
+		col[10] = col[0] != col[1] != col[2] != col[4] != col[6] != col[7]
+		col[11] = col[0] != col[1] != col[2] != col[3] != col[5] != col[7] != col[8]
+		col[12] = col[0] != col[2] != col[4] != col[5] != col[8]
+		for r := dataRows; r < rows; r++ {
+			block[1+c+r*rowLength] = col[r]
+		}
+	}
+
+	var raw [blockBits]bool
+	for i := 0; i < blockBits; i++ {
+		raw[(i*interleaveStep)%blockBits] = block[i]
+	}
+
+	for i := 0; i < firstHalfBits; i++ {
+		setBit(burst[:], i, raw[i])
+	}
+	for i := 0; i < firstHalfBits; i++ {
+		setBit(burst[:], secondHalfStart+i, raw[firstHalfBits+i])
+	}
+	return burst
+}
+
+// dataPositions lists where each payload bit sits in the deinterleaved block.
+// The first three bits of the first row are reserved, and the last four
+// columns and rows hold parity.
+func dataPositions() []int {
+	positions := make([]int, 0, DataLength*8)
+	for r := 0; r < dataRows; r++ {
+		start := 1 + r*rowLength
+		if r == 0 {
+			start += 3
+		}
+		for i := start; i <= r*rowLength+11; i++ {
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}
+
+func bit(b []byte, i int) bool {
+	return b[i/8]&(0x80>>(i%8)) != 0
+}
+
+func setBit(b []byte, i int, v bool) {
+	if v {
+		b[i/8] |= 0x80 >> (i % 8)
+	} else {
+		b[i/8] &^= 0x80 >> (i % 8)
+	}
+}
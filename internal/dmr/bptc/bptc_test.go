@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package bptc_test
+
+import (
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/bptc"
+)
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+	var burst [bptc.BurstLength]byte
+	// Fill the slot type and sync so we can check they're untouched
+	for i := range burst {
+		burst[i] = 0x5A
+	}
+	data := [bptc.DataLength]byte{0xBD, 0x00, 0x80, 0x80, 0x00, 0x00, 0x01, 0x31, 0x22, 0x03, 0xAB, 0xCD}
+
+	encoded := bptc.Encode(burst, data)
+	if decoded := bptc.Decode(encoded); decoded != data {
+		t.Errorf("Expected %X, got %X", data, decoded)
+	}
+	// Sync lives in bytes 13 through 19
+	for i := 13; i <= 19; i++ {
+		if encoded[i] != 0x5A {
+			t.Errorf("Byte %d of the sync was modified", i)
+		}
+	}
+}
@@ -22,6 +22,8 @@ package calltracker
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/USA-RedDragon/DMRHub/internal/config"
@@ -29,6 +31,8 @@ import (
 	dmrconst "github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
 	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
 	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/notify"
+	"github.com/USA-RedDragon/DMRHub/internal/pubsub"
 	"github.com/mitchellh/hashstructure/v2"
 	"github.com/puzpuzpuz/xsync/v3"
 	"github.com/redis/go-redis/v9"
@@ -36,9 +40,6 @@ import (
 	"gorm.io/gorm"
 )
 
-// Assuming +/-7ms of jitter, we'll wait 2 seconds before we consider a call to be over
-// This equates out to about 30 lost voice packets.
-const timerDelay = 2 * time.Second
 const packetTimingMs = 60
 const pct = 100
 
@@ -92,6 +93,10 @@ type CallTracker struct {
 	redis         *redis.Client
 	callEndTimers *xsync.MapOf[uint64, *time.Timer]
 	inFlightCalls *xsync.MapOf[uint64, *models.Call]
+	telemetry     *xsync.MapOf[uint64, *telemetrySampler]
+
+	truncatedMu      sync.RWMutex
+	truncatedHandler func(context.Context, models.Packet)
 }
 
 // NewCallTracker creates a new CallTracker.
@@ -101,9 +106,18 @@ func NewCallTracker(db *gorm.DB, redis *redis.Client) *CallTracker {
 		redis:         redis,
 		callEndTimers: xsync.NewMapOf[uint64, *time.Timer](),
 		inFlightCalls: xsync.NewMapOf[uint64, *models.Call](),
+		telemetry:     xsync.NewMapOf[uint64, *telemetrySampler](),
 	}
 }
 
+// OnTruncated sets the function the watchdog hands a synthetic voice terminator to
+// when it force-ends a call, so the server that routed the call can close the stream downstream.
+func (c *CallTracker) OnTruncated(handler func(context.Context, models.Packet)) {
+	c.truncatedMu.Lock()
+	defer c.truncatedMu.Unlock()
+	c.truncatedHandler = handler
+}
+
 // StartCall starts tracking a new call.
 func (c *CallTracker) StartCall(ctx context.Context, packet models.Packet) {
 	ctx, span := otel.Tracer("DMRHub").Start(ctx, "CallTracker.StartCall")
@@ -250,6 +264,8 @@ func (c *CallTracker) StartCall(ctx context.Context, packet models.Packet) {
 		call.ToTalkgroup = destTalkgroup
 	}
 
+	call.ConversationID = c.continuedConversation(sourceUser.ID, packet.Dst, packet.GroupCall, config.GetConfig().CallGroupingWindow, time.Now())
+
 	// Create the call in the database
 	err = c.db.Create(&call).Error
 	if err != nil {
@@ -257,6 +273,14 @@ func (c *CallTracker) StartCall(ctx context.Context, packet models.Packet) {
 		return
 	}
 
+	if call.ConversationID == 0 {
+		call.ConversationID = call.ID
+		err = c.db.Model(&call).Update("conversation_id", call.ID).Error
+		if err != nil {
+			logging.Errorf("Error setting call conversation: %v", err)
+		}
+	}
+
 	callHash, err := getCallHash(call)
 	if err != nil {
 		return
@@ -264,13 +288,19 @@ func (c *CallTracker) StartCall(ctx context.Context, packet models.Packet) {
 
 	// Add the call to the active calls map
 	c.inFlightCalls.Store(callHash, &call)
+	c.telemetry.Store(callHash, newTelemetrySampler(call.ID, call.StartTime))
 
 	if config.GetConfig().Debug {
 		logging.Logf("Started call %d", call.StreamID)
 	}
 
-	// Add a timer that will end the call if we haven't seen a packet in 1 second.
-	c.callEndTimers.Store(callHash, time.AfterFunc(timerDelay, endCallHandler(ctx, c, packet)))
+	// The watchdog ends the call if it goes quiet without sending a voice terminator
+	c.callEndTimers.Store(callHash, time.AfterFunc(config.GetConfig().CallWatchdogTimeout, endCallHandler(ctx, c, packet)))
+}
+
+// InFlightCalls returns how many calls are currently being tracked.
+func (c *CallTracker) InFlightCalls() int {
+	return c.inFlightCalls.Size()
 }
 
 // IsCallActive checks if a call is active.
@@ -287,11 +317,108 @@ func (c *CallTracker) IsCallActive(ctx context.Context, packet models.Packet) bo
 	return ok
 }
 
+// QuotaBlocks checks whether a new call to a talkgroup is over the user's quota and should be
+// turned away. It is checked before a call is tracked, so blocked calls are never recorded.
+func (c *CallTracker) QuotaBlocks(ctx context.Context, packet models.Packet) bool {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "CallTracker.QuotaBlocks")
+	defer span.End()
+
+	var users []models.User
+	err := c.db.Where("id = ?", packet.Src).Limit(1).Find(&users).Error
+	if err != nil {
+		logging.Errorf("Error finding user %d: %s", packet.Src, err)
+		return false
+	}
+	var talkgroups []models.Talkgroup
+	err = c.db.Where("id = ?", packet.Dst).Limit(1).Find(&talkgroups).Error
+	if err != nil {
+		logging.Errorf("Error finding talkgroup %d: %s", packet.Dst, err)
+		return false
+	}
+	if len(users) == 0 || len(talkgroups) == 0 {
+		// Calls from unknown users or to unknown talkgroups aren't tracked, so have no quota
+		return false
+	}
+	return c.checkQuota(ctx, users[0], talkgroups[0])
+}
+
+// checkQuota reports whether a new call from the user to the talkgroup should be blocked.
+// The user is notified the first time each day they near, exceed or are blocked by the quota.
+func (c *CallTracker) checkQuota(ctx context.Context, user models.User, talkgroup models.Talkgroup) bool {
+	quota, ok, err := models.FindTalkgroupQuota(c.db, talkgroup.ID)
+	if err != nil {
+		logging.Errorf("Error finding quota for talkgroup %d: %v", talkgroup.ID, err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+
+	now := time.Now()
+	usage, err := quota.Usage(c.db, user.ID, now)
+	if err != nil {
+		logging.Errorf("Error calculating quota usage for user %d on talkgroup %d: %v", user.ID, talkgroup.ID, err)
+		return false
+	}
+
+	used := fmt.Sprintf("%v today, %v this month", usage.DailyUsed.Round(time.Second), usage.MonthlyUsed.Round(time.Second))
+	switch {
+	case usage.Exceeded && quota.Enforce:
+		logging.Logf("User %d (%s) has exceeded their quota on talkgroup %d, blocking call", user.ID, user.Callsign, talkgroup.ID)
+		c.notifyQuota(ctx, user, talkgroup, quotaBlocked, now, fmt.Sprintf("Calls to %s blocked", talkgroup.Name),
+			fmt.Sprintf("You've used your talk time on talkgroup %d (%s), so your calls to it aren't being routed. You've talked for %s.", talkgroup.ID, talkgroup.Name, used), usage)
+		return true
+	case usage.Exceeded:
+		logging.Logf("User %d (%s) has exceeded their quota on talkgroup %d", user.ID, user.Callsign, talkgroup.ID)
+		c.notifyQuota(ctx, user, talkgroup, quotaExceeded, now, fmt.Sprintf("Talk time exceeded on %s", talkgroup.Name),
+			fmt.Sprintf("You've gone over your talk time on talkgroup %d (%s). You've talked for %s.", talkgroup.ID, talkgroup.Name, used), usage)
+	case usage.Warning:
+		logging.Logf("User %d (%s) is nearing their quota on talkgroup %d (%s)", user.ID, user.Callsign, talkgroup.ID, used)
+		c.notifyQuota(ctx, user, talkgroup, quotaWarning, now, fmt.Sprintf("Talk time nearly used on %s", talkgroup.Name),
+			fmt.Sprintf("You're close to your talk time on talkgroup %d (%s). You've talked for %s.", talkgroup.ID, talkgroup.Name, used), usage)
+	}
+	return false
+}
+
+// Levels of quota notification, each sent at most once a day per user and talkgroup
+const (
+	quotaWarning  = "warning"
+	quotaExceeded = "exceeded"
+	quotaBlocked  = "blocked"
+)
+
+// notifyQuota tells the user about their quota, unless they've already been told at this level today.
+// The marker is kept in redis so every replica agrees on it.
+func (c *CallTracker) notifyQuota(ctx context.Context, user models.User, talkgroup models.Talkgroup, level string, now time.Time, subject, message string, usage models.TalkgroupQuotaUsage) {
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	key := fmt.Sprintf("quota:notified:%d:%d:%s", user.ID, talkgroup.ID, level)
+	first, err := c.redis.SetNX(ctx, key, now.Unix(), tomorrow.Sub(now)).Result()
+	if err != nil {
+		logging.Errorf("Error recording quota notification for user %d: %v", user.ID, err)
+		return
+	}
+	if !first {
+		return
+	}
+	notify.Send(ctx, c.db, c.redis, user.ID, notify.Notification{
+		Event:   models.NotificationQuota,
+		Time:    now,
+		Subject: subject,
+		Message: message,
+		Data: map[string]any{
+			"talkgroup_id": talkgroup.ID,
+			"level":        level,
+			"usage":        usage,
+		},
+	})
+}
+
 func (c *CallTracker) publishCall(ctx context.Context, call *models.Call) {
 	ctx, span := otel.Tracer("DMRHub").Start(ctx, "CallTracker.publishCall")
 	defer span.End()
 
-	if (call.IsToRepeater || call.IsToTalkgroup) && call.GroupCall {
+	// Calls on private talkgroups only go out on the per-user streams
+	if (call.IsToRepeater || call.IsToTalkgroup) && call.GroupCall && !(call.IsToTalkgroup && call.ToTalkgroup.Private) {
 		// copy call into a jsonCallResponse
 		var jsonCall apimodels.WSCallResponse
 		jsonCall.ID = call.ID
@@ -322,6 +449,7 @@ func (c *CallTracker) publishCall(ctx context.Context, call *models.Call) {
 		jsonCall.Jitter = call.Jitter
 		jsonCall.BER = call.BER
 		jsonCall.RSSI = call.RSSI
+		jsonCall.Truncated = call.Truncated
 		// Publish the call JSON to Redis
 		callJSON, err := json.Marshal(jsonCall)
 		if err != nil {
@@ -329,7 +457,7 @@ func (c *CallTracker) publishCall(ctx context.Context, call *models.Call) {
 			return
 		}
 
-		_, err = c.redis.Publish(ctx, "calls:public", callJSON).Result()
+		err = pubsub.Publish(ctx, c.redis, "calls:public", callJSON)
 		if err != nil {
 			logging.Errorf("Error publishing call JSON: %v", err)
 			return
@@ -341,7 +469,7 @@ func (c *CallTracker) publishCall(ctx context.Context, call *models.Call) {
 		logging.Errorf("Error marshalling call JSON: %v", err)
 		return
 	}
-	_, err = c.redis.Publish(ctx, "calls", origCallJSON).Result()
+	err = pubsub.Publish(ctx, c.redis, "calls", origCallJSON)
 	if err != nil {
 		logging.Errorf("Error publishing call JSON: %v", err)
 		return
@@ -363,7 +491,7 @@ func (c *CallTracker) updateCall(ctx context.Context, call *models.Call, packet
 	}
 
 	// Reset call end timer
-	timer.Reset(timerDelay)
+	timer.Reset(config.GetConfig().CallWatchdogTimeout)
 
 	if call.LastSeq == packet.Seq {
 		// This is a dup
@@ -394,7 +522,7 @@ func (c *CallTracker) updateCall(ctx context.Context, call *models.Call, packet
 		call.LostSequences = lastLostSequences
 	}
 
-	call.TotalBits += 141
+	call.TotalBits += bitsPerPacket
 	if packet.BER > 0 {
 		call.TotalErrors += packet.BER
 	}
@@ -406,6 +534,10 @@ func (c *CallTracker) updateCall(ctx context.Context, call *models.Call, packet
 		call.RSSI = (call.RSSI + float32(packet.RSSI)) / 2 //nolint:golint,gomnd
 	}
 
+	if sampler, ok := c.telemetry.Load(hash); ok {
+		sampler.add(packet, call.LastPacketTime)
+	}
+
 	call.CallData = append(call.CallData, packet.DMRData[:]...)
 
 	go c.publishCall(ctx, call)
@@ -505,10 +637,75 @@ func endCallHandler(ctx context.Context, c *CallTracker, packet models.Packet) f
 
 	return func() {
 		logging.Errorf("Call %d timed out", packet.StreamID)
-		c.EndCall(ctx, packet)
+		c.truncateCall(ctx, packet)
 	}
 }
 
+// truncateCall force-ends a call that never sent a voice terminator, records it as
+// truncated, and hands a synthetic terminator to the truncation handler
+func (c *CallTracker) truncateCall(ctx context.Context, packet models.Packet) {
+	hash, err := getCallHashFromPacket(packet)
+	if err != nil {
+		logging.Errorf("Error getting call hash from packet: %v", err)
+		return
+	}
+	call, ok := c.inFlightCalls.Load(hash)
+	if !ok {
+		return
+	}
+	call.Truncated = true
+	terminator := terminatorFor(packet, call.LastSeq)
+
+	c.EndCall(ctx, packet)
+
+	c.truncatedMu.RLock()
+	handler := c.truncatedHandler
+	c.truncatedMu.RUnlock()
+	if handler != nil {
+		handler(ctx, terminator)
+	}
+}
+
+// TerminateCalls force-ends every in-flight call that match accepts the same way
+// the watchdog does, so each one gets a synthetic terminator. It returns the
+// number of calls ended.
+func (c *CallTracker) TerminateCalls(ctx context.Context, match func(models.Packet) bool) int {
+	var packets []models.Packet
+	c.inFlightCalls.Range(func(_ uint64, call *models.Call) bool {
+		packet := models.Packet{
+			Signature: string(dmrconst.CommandDMRD),
+			Src:       call.UserID,
+			Dst:       call.DestinationID,
+			Repeater:  call.RepeaterID,
+			Slot:      call.TimeSlot,
+			GroupCall: call.GroupCall,
+			StreamID:  call.StreamID,
+		}
+		if match(packet) {
+			packets = append(packets, packet)
+		}
+		return true
+	})
+	for _, packet := range packets {
+		c.truncateCall(ctx, packet)
+	}
+	return len(packets)
+}
+
+// terminatorFor builds the voice terminator that should have followed lastSeq.
+// MMDVM-based repeaters regenerate the LC, slot type and sync of terminators
+// from the network, so only the HBRP header needs to be right.
+func terminatorFor(packet models.Packet, lastSeq uint) models.Packet {
+	terminator := packet
+	terminator.Seq = (lastSeq + 1) % 256 //nolint:golint,gomnd // sequence numbers are a single byte
+	terminator.FrameType = dmrconst.FrameDataSync
+	terminator.DTypeOrVSeq = uint(dmrconst.DTypeVoiceTerm)
+	terminator.DMRData = [33]byte{}
+	terminator.BER = -1
+	terminator.RSSI = -1
+	return terminator
+}
+
 // EndCall ends a call.
 func (c *CallTracker) EndCall(ctx context.Context, packet models.Packet) {
 	ctx, span := otel.Tracer("DMRHub").Start(ctx, "CallTracker.EndCall")
@@ -526,6 +723,8 @@ func (c *CallTracker) EndCall(ctx context.Context, packet models.Packet) {
 		return
 	}
 
+	sampler, hasTelemetry := c.telemetry.LoadAndDelete(hash)
+
 	if time.Since(call.StartTime) < 100*time.Millisecond {
 		// This is probably a key-up, so delete the call from the db
 		c.db.Unscoped().Delete(call)
@@ -549,7 +748,79 @@ func (c *CallTracker) EndCall(ctx context.Context, packet models.Packet) {
 		return
 	}
 
+	if hasTelemetry {
+		c.saveTelemetry(call, sampler)
+	}
+
 	c.publishCall(ctx, call)
 
+	if call.IsToUser && config.GetConfig().MissedCallWindow > 0 {
+		missed := *call
+		time.AfterFunc(config.GetConfig().MissedCallWindow, func() {
+			c.checkMissedCall(context.Background(), missed)
+		})
+	}
+
 	logging.Logf("Call %d from %d to %d via %d ended with duration %v, %f%% Loss, %f%% BER, %fdBm RSSI, and %fms Jitter", packet.StreamID, packet.Src, packet.Dst, packet.Repeater, call.Duration, call.Loss*pct, call.BER*pct, call.RSSI, call.Jitter)
 }
+
+// saveTelemetry stores the BER/RSSI samples collected during a call
+func (c *CallTracker) saveTelemetry(call *models.Call, sampler *telemetrySampler) {
+	points := sampler.finish()
+	if len(points) == 0 {
+		return
+	}
+	err := c.db.CreateInBatches(points, len(points)).Error
+	if err != nil {
+		logging.Errorf("Error saving telemetry for call %d: %v", call.ID, err)
+	}
+}
+
+// checkMissedCall records a missed call and notifies the callee if they never called back
+func (c *CallTracker) checkMissedCall(ctx context.Context, call models.Call) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "CallTracker.checkMissedCall")
+	defer span.End()
+
+	returned, err := models.CallReturned(c.db, call)
+	if err != nil {
+		logging.Errorf("Error checking if call %d was returned: %v", call.ID, err)
+		return
+	}
+	if returned {
+		return
+	}
+
+	missedCall := models.MissedCall{
+		UserID:   call.DestinationID,
+		CallerID: call.UserID,
+		CallID:   call.ID,
+		CallTime: call.StartTime,
+	}
+	err = c.db.Create(&missedCall).Error
+	if err != nil {
+		logging.Errorf("Error saving missed call: %v", err)
+		return
+	}
+	missedCall.Caller = call.User
+
+	notify.Send(ctx, c.db, c.redis, missedCall.UserID, notify.Notification{
+		Event:   models.NotificationMissedCall,
+		Time:    call.StartTime,
+		Subject: fmt.Sprintf("Missed call from %s", call.User.Callsign),
+		Message: fmt.Sprintf("%s (%d) called you at %s and hasn't heard back.", call.User.Callsign, call.UserID, call.StartTime.UTC().Format(time.RFC3339)),
+		Data:    missedCall,
+	})
+}
+
+// continuedConversation returns the conversation a new call continues, or 0 to start a new one.
+// Quick successive transmissions from the same user to the same destination are one conversation.
+func (c *CallTracker) continuedConversation(userID uint, dst uint, groupCall bool, window time.Duration, now time.Time) uint {
+	if window <= 0 {
+		return 0
+	}
+	lastCall, ok := models.FindLastCompletedCall(c.db, userID, dst, groupCall)
+	if !ok || now.Sub(lastCall.StartTime.Add(lastCall.Duration)) > window {
+		return 0
+	}
+	return lastCall.ConversationID
+}
@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package calltracker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestContinuedConversation(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Call{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	_, redis := fakeredis.New(t)
+	tracker := NewCallTracker(db, redis)
+
+	end := time.Now()
+	db.Create(&models.Call{ID: 7, ConversationID: 7, UserID: 1, DestinationID: 3100, GroupCall: true, StartTime: end.Add(-5 * time.Second), Duration: 5 * time.Second})
+	const window = 10 * time.Second
+
+	cases := []struct {
+		name      string
+		userID    uint
+		dst       uint
+		groupCall bool
+		window    time.Duration
+		now       time.Time
+		want      uint
+	}{
+		{"inside the window", 1, 3100, true, window, end.Add(3 * time.Second), 7},
+		{"after the window", 1, 3100, true, window, end.Add(window + time.Second), 0},
+		{"grouping disabled", 1, 3100, true, 0, end.Add(time.Second), 0},
+		{"another user", 2, 3100, true, window, end.Add(time.Second), 0},
+		{"another destination", 1, 3101, true, window, end.Add(time.Second), 0},
+		{"a private call", 1, 3100, false, window, end.Add(time.Second), 0},
+	}
+	for _, tc := range cases {
+		if got := tracker.continuedConversation(tc.userID, tc.dst, tc.groupCall, tc.window, tc.now); got != tc.want {
+			t.Errorf("%s: expected conversation %d, got %d", tc.name, tc.want, got)
+		}
+	}
+}
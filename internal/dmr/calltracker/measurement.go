@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package calltracker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+// Measurement works out a stream's link quality the same way call tracking does,
+// for streams that are answered by the hub rather than saved as calls
+type Measurement struct {
+	mu   sync.Mutex
+	call models.Call
+}
+
+func NewMeasurement(start time.Time) *Measurement {
+	return &Measurement{
+		call: models.Call{
+			StartTime:      start,
+			LastPacketTime: start,
+			LastSeq:        256, // no packet has this sequence number, so the first isn't a dup
+		},
+	}
+}
+
+// Add measures a packet received at the given time
+func (m *Measurement) Add(packet models.Packet, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	call := &m.call
+
+	if call.LastSeq == packet.Seq {
+		return
+	}
+	call.LastSeq = packet.Seq
+
+	elapsed := at.Sub(call.LastPacketTime)
+	call.LastPacketTime = at
+	call.Jitter = (call.Jitter + float32(elapsed.Milliseconds()-packetTimingMs)) / 2 //nolint:golint,gomnd
+	call.Duration = at.Sub(call.StartTime)
+
+	calcSequenceLoss(call, packet)
+	if call.TotalPackets > 0 && call.LostSequences <= call.TotalPackets {
+		call.Loss = float32(call.LostSequences) / float32(call.TotalPackets)
+	}
+
+	call.TotalBits += bitsPerPacket
+	if packet.BER > 0 {
+		call.TotalErrors += packet.BER
+	}
+	call.BER = float32(call.TotalErrors) / float32(call.TotalBits)
+
+	if packet.RSSI > 0 {
+		if call.RSSI == 0 {
+			call.RSSI = float32(packet.RSSI)
+		} else {
+			call.RSSI = (call.RSSI + float32(packet.RSSI)) / 2 //nolint:golint,gomnd
+		}
+	}
+}
+
+// Result fills in the measured quality of the stream so far
+func (m *Measurement) Result(test *models.AudioTest) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	test.StartedAt = m.call.StartTime
+	test.Duration = m.call.Duration
+	test.Packets = m.call.TotalPackets
+	test.Lost = m.call.LostSequences
+	test.Loss = m.call.Loss
+	test.BER = m.call.BER
+	test.Jitter = m.call.Jitter
+	test.RSSI = m.call.RSSI
+}
@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package calltracker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+)
+
+func TestMeasurement(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMeasurement(start)
+	at := start
+	send := func(seq uint, frameType dmrconst.FrameType, vseq uint, ber int) {
+		at = at.Add(60 * time.Millisecond)
+		m.Add(models.Packet{Seq: seq, FrameType: frameType, DTypeOrVSeq: vseq, BER: ber, RSSI: 80}, at)
+	}
+	send(0, dmrconst.FrameDataSync, uint(dmrconst.DTypeVoiceHead), 0)
+	send(1, dmrconst.FrameVoiceSync, dmrconst.VoiceA, 2)
+	send(1, dmrconst.FrameVoiceSync, dmrconst.VoiceA, 2) // dup
+	send(2, dmrconst.FrameVoice, dmrconst.VoiceB, 0)
+	// VoiceC is lost
+	send(4, dmrconst.FrameVoice, dmrconst.VoiceD, 0)
+
+	var test models.AudioTest
+	m.Result(&test)
+	if test.Lost != 1 || test.Packets != 5 {
+		t.Errorf("Expected 1 of 5 packets lost, got %d of %d", test.Lost, test.Packets)
+	}
+	if test.BER != float32(2)/float32(4*bitsPerPacket) {
+		t.Errorf("Unexpected BER %f", test.BER)
+	}
+	if test.RSSI != 80 || !test.StartedAt.Equal(start) || test.Duration != at.Sub(start) {
+		t.Errorf("Unexpected result %+v", test)
+	}
+}
@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package calltracker
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/notify"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestMissedCalls(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Call{}, &models.MissedCall{}, &models.NotificationPreferences{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	_, redis := fakeredis.New(t)
+	tracker := NewCallTracker(db, redis)
+	ctx := context.Background()
+
+	caller := models.User{ID: 3110001, Callsign: "N0CALL", Username: "n0call"}
+	callee := models.User{ID: 3110002, Callsign: "N0BACK", Username: "n0back"}
+	db.Create(&caller)
+	db.Create(&callee)
+	start := time.Now().Add(-5 * time.Minute)
+	call := models.Call{ID: 1, User: caller, UserID: caller.ID, IsToUser: true, DestinationID: callee.ID, StartTime: start}
+	db.Create(&call)
+
+	subscription := redis.Subscribe(ctx, notify.Channel(callee.ID))
+	defer func() {
+		_ = subscription.Close()
+	}()
+	if _, err := subscription.Receive(ctx); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	tracker.checkMissedCall(ctx, call)
+	select {
+	case msg := <-subscription.Channel():
+		var notification struct {
+			Event models.NotificationEvent `json:"event"`
+		}
+		if err := json.Unmarshal([]byte(msg.Payload), &notification); err != nil {
+			t.Fatalf("Failed to decode notification: %v", err)
+		}
+		if notification.Event != models.NotificationMissedCall {
+			t.Errorf("Expected a missed call notification, got %s", msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a missed call notification")
+	}
+	missed, err := models.FindMissedCalls(db, callee.ID)
+	if err != nil || len(missed) != 1 || missed[0].CallID != call.ID || missed[0].Caller.ID != caller.ID {
+		t.Fatalf("Expected call %d to be recorded as missed, got %+v, %v", call.ID, missed, err)
+	}
+
+	// Once the callee calls back, the call isn't missed
+	db.Create(&models.Call{ID: 2, UserID: callee.ID, IsToUser: true, DestinationID: caller.ID, StartTime: start.Add(time.Minute)})
+	tracker.checkMissedCall(ctx, call)
+	select {
+	case msg := <-subscription.Channel():
+		t.Errorf("Expected no notification for a returned call, got %s", msg.Payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if count, _ := models.CountUnseenMissedCalls(db, callee.ID); count != 1 {
+		t.Errorf("Expected the returned call not to be recorded, got %d unseen", count)
+	}
+}
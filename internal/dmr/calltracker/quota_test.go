@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package calltracker
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/notify"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestQuotaNotifications(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Call{}, &models.TalkgroupQuota{}, &models.NotificationPreferences{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	_, redis := fakeredis.New(t)
+	tracker := NewCallTracker(db, redis)
+	ctx := context.Background()
+
+	user := models.User{ID: 3110001, Callsign: "N0CALL"}
+	talkgroup := models.Talkgroup{ID: 91, Name: "World-wide"}
+	db.Create(&models.TalkgroupQuota{TalkgroupID: talkgroup.ID, DailySeconds: 100, Enforce: true})
+
+	subscription := redis.Subscribe(ctx, notify.Channel(user.ID))
+	defer func() {
+		_ = subscription.Close()
+	}()
+	if _, err := subscription.Receive(ctx); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	expect := func(level string) {
+		t.Helper()
+		select {
+		case msg := <-subscription.Channel():
+			var notification struct {
+				Event models.NotificationEvent `json:"event"`
+				Data  struct {
+					Level string `json:"level"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal([]byte(msg.Payload), &notification); err != nil {
+				t.Fatalf("Failed to decode notification: %v", err)
+			}
+			if notification.Event != models.NotificationQuota || notification.Data.Level != level {
+				t.Errorf("Expected a %s quota notification, got %s", level, msg.Payload)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected a %s quota notification", level)
+		}
+	}
+	expectNone := func() {
+		t.Helper()
+		select {
+		case msg := <-subscription.Channel():
+			t.Errorf("Expected no notification, got %s", msg.Payload)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	talk := func(duration time.Duration) {
+		t.Helper()
+		tg := talkgroup.ID
+		err := db.Create(&models.Call{UserID: user.ID, IsToTalkgroup: true, ToTalkgroupID: &tg, StartTime: time.Now(), Duration: duration}).Error
+		if err != nil {
+			t.Fatalf("Failed to create call: %v", err)
+		}
+	}
+
+	if tracker.checkQuota(ctx, user, talkgroup) {
+		t.Fatal("Expected a user without talk time not to be blocked")
+	}
+	expectNone()
+
+	talk(85 * time.Second)
+	if tracker.checkQuota(ctx, user, talkgroup) {
+		t.Fatal("Expected a user under their quota not to be blocked")
+	}
+	expect(quotaWarning)
+	// Only once a day
+	tracker.checkQuota(ctx, user, talkgroup)
+	expectNone()
+
+	talk(15 * time.Second)
+	if !tracker.checkQuota(ctx, user, talkgroup) {
+		t.Fatal("Expected a user over an enforced quota to be blocked")
+	}
+	expect(quotaBlocked)
+	tracker.checkQuota(ctx, user, talkgroup)
+	expectNone()
+}
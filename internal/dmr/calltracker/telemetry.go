@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package calltracker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+// TelemetryInterval is the width of a single BER/RSSI sample, one voice superframe
+const TelemetryInterval = 360 * time.Millisecond
+
+// maxTelemetryPoints bounds how many samples are stored for a single call
+const maxTelemetryPoints = 300
+
+const bitsPerPacket = 141
+
+// telemetrySampler buckets per-packet BER and RSSI into fixed intervals
+type telemetrySampler struct {
+	mu          sync.Mutex
+	callID      uint
+	start       time.Time
+	bucketStart time.Duration
+	bits        uint
+	errors      int
+	rssiSum     float32
+	rssiCount   int
+	points      []models.CallTelemetry
+}
+
+func newTelemetrySampler(callID uint, start time.Time) *telemetrySampler {
+	return &telemetrySampler{
+		callID: callID,
+		start:  start,
+	}
+}
+
+func (s *telemetrySampler) add(packet models.Packet, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	offset := at.Sub(s.start)
+	if offset-s.bucketStart >= TelemetryInterval {
+		s.flush()
+		s.bucketStart = offset - offset%TelemetryInterval
+	}
+
+	s.bits += bitsPerPacket
+	if packet.BER > 0 {
+		s.errors += packet.BER
+	}
+	if packet.RSSI > 0 {
+		s.rssiSum += float32(packet.RSSI)
+		s.rssiCount++
+	}
+}
+
+// flush closes the current bucket. The caller must hold the lock.
+func (s *telemetrySampler) flush() {
+	if s.bits == 0 {
+		return
+	}
+	point := models.CallTelemetry{
+		CallID:   s.callID,
+		OffsetMS: uint(s.bucketStart.Milliseconds()),
+		BER:      float32(s.errors) / float32(s.bits),
+	}
+	if s.rssiCount > 0 {
+		point.RSSI = s.rssiSum / float32(s.rssiCount)
+	}
+	s.points = append(s.points, point)
+	s.bits = 0
+	s.errors = 0
+	s.rssiSum = 0
+	s.rssiCount = 0
+}
+
+// finish closes the last bucket and returns the downsampled samples
+func (s *telemetrySampler) finish() []models.CallTelemetry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flush()
+	return models.DownsampleTelemetry(s.points, maxTelemetryPoints)
+}
@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package calltracker
+
+import (
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+)
+
+func TestTerminatorFor(t *testing.T) {
+	t.Parallel()
+	packet := models.Packet{
+		Src:         3191868,
+		Dst:         3100,
+		Repeater:    311860,
+		Slot:        true,
+		GroupCall:   true,
+		FrameType:   dmrconst.FrameVoice,
+		DTypeOrVSeq: 3,
+		StreamID:    1234,
+		DMRData:     [33]byte{1, 2, 3},
+	}
+	terminator := terminatorFor(packet, 255)
+	if terminator.Seq != 0 {
+		t.Errorf("Expected the sequence number to wrap to 0, got %d", terminator.Seq)
+	}
+	if terminator.FrameType != dmrconst.FrameDataSync || terminator.DTypeOrVSeq != uint(dmrconst.DTypeVoiceTerm) {
+		t.Errorf("Expected a voice terminator, got frame type %d data type %d", terminator.FrameType, terminator.DTypeOrVSeq)
+	}
+	if terminator.StreamID != packet.StreamID || terminator.Src != packet.Src || terminator.Dst != packet.Dst || terminator.Slot != packet.Slot {
+		t.Errorf("Expected the terminator to close the same stream, got %+v", terminator)
+	}
+	if terminator.DMRData != [33]byte{} {
+		t.Errorf("Expected an empty payload, got %v", terminator.DMRData)
+	}
+}
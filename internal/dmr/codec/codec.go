@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package codec decides how calls that aren't AMBE reach repeaters, following
+// each talkgroup's codec policy, and holds the transcoders between codecs.
+package codec
+
+import (
+	"sync"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/routing"
+)
+
+// Transcoder converts one stream to another codec. Codecs frame audio differently,
+// so a transcoder may buffer, and a packet can produce none or several packets.
+type Transcoder interface {
+	Transcode(packet models.Packet) []models.Packet
+}
+
+//nolint:golint,gochecknoglobals
+var (
+	transcoders      = map[pair]func() Transcoder{}
+	transcodersMutex sync.RWMutex
+)
+
+type pair struct {
+	from dmrconst.Codec
+	to   dmrconst.Codec
+}
+
+// RegisterTranscoder makes one codec transcodable to another, usually by a vocoder
+// backend. newTranscoder is called once for every stream that needs transcoding.
+func RegisterTranscoder(from dmrconst.Codec, to dmrconst.Codec, newTranscoder func() Transcoder) {
+	transcodersMutex.Lock()
+	defer transcodersMutex.Unlock()
+	transcoders[pair{from, to}] = newTranscoder
+}
+
+// UnregisterTranscoder removes a transcoder registered with RegisterTranscoder
+func UnregisterTranscoder(from dmrconst.Codec, to dmrconst.Codec) {
+	transcodersMutex.Lock()
+	defer transcodersMutex.Unlock()
+	delete(transcoders, pair{from, to})
+}
+
+// CanTranscode reports whether a transcoder is registered between two codecs
+func CanTranscode(from dmrconst.Codec, to dmrconst.Codec) bool {
+	transcodersMutex.RLock()
+	defer transcodersMutex.RUnlock()
+	_, ok := transcoders[pair{from, to}]
+	return ok
+}
+
+// NewTranscoder starts transcoding a stream between two codecs, if a transcoder is registered for them
+func NewTranscoder(from dmrconst.Codec, to dmrconst.Codec) (Transcoder, bool) {
+	transcodersMutex.RLock()
+	newTranscoder, ok := transcoders[pair{from, to}]
+	transcodersMutex.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return newTranscoder(), true
+}
+
+// Action is what to do with a packet for one repeater
+type Action int
+
+const (
+	// Deliver sends the packet as it is
+	Deliver Action = iota
+	// Transcode sends the packet through a transcoder first
+	Transcode
+	// Drop doesn't send the packet
+	Drop
+)
+
+// Route decides what to do with a packet in codec for a repeater that takes the codecs
+// in takes, on a talkgroup with policy. Dropped packets come with the reason.
+func Route(policy models.CodecPolicy, codec dmrconst.Codec, takes dmrconst.CodecSet) (Action, routing.Reason) {
+	switch {
+	case codec == dmrconst.CodecAMBE:
+		return Deliver, ""
+	case policy == models.CodecPolicyBlock:
+		return Drop, routing.ReasonCodecBlocked
+	case takes.Has(codec):
+		return Deliver, ""
+	case policy != models.CodecPolicyTranscode, !CanTranscode(codec, dmrconst.CodecAMBE):
+		return Drop, routing.ReasonCodecUnsupported
+	}
+	return Transcode, ""
+}
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package codec_test
+
+import (
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/codec"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/routing"
+)
+
+type silence struct{}
+
+func (silence) Transcode(packet models.Packet) []models.Packet {
+	packet.Codec = dmrconst.CodecAMBE
+	packet.DMRData = [33]byte{}
+	return []models.Packet{packet}
+}
+
+func TestRoute(t *testing.T) {
+	ambeOnly := dmrconst.CodecSet(0)
+	takesCodec2 := ambeOnly.With(dmrconst.CodecCodec2)
+	tests := []struct {
+		name   string
+		policy models.CodecPolicy
+		codec  dmrconst.Codec
+		takes  dmrconst.CodecSet
+		action codec.Action
+		reason routing.Reason
+	}{
+		{"AMBE ignores the policy", models.CodecPolicyBlock, dmrconst.CodecAMBE, ambeOnly, codec.Deliver, ""},
+		{"block", models.CodecPolicyBlock, dmrconst.CodecCodec2, takesCodec2, codec.Drop, routing.ReasonCodecBlocked},
+		{"passthrough to a capable repeater", models.CodecPolicyPassthrough, dmrconst.CodecCodec2, takesCodec2, codec.Deliver, ""},
+		{"passthrough to an AMBE repeater", models.CodecPolicyPassthrough, dmrconst.CodecCodec2, ambeOnly, codec.Drop, routing.ReasonCodecUnsupported},
+		{"transcode for a capable repeater", models.CodecPolicyTranscode, dmrconst.CodecCodec2, takesCodec2, codec.Deliver, ""},
+		{"transcode without a transcoder", models.CodecPolicyTranscode, dmrconst.CodecCodec2, ambeOnly, codec.Drop, routing.ReasonCodecUnsupported},
+	}
+	for _, tt := range tests {
+		action, reason := codec.Route(tt.policy, tt.codec, tt.takes)
+		if action != tt.action || reason != tt.reason {
+			t.Errorf("%s: got %v %q, expected %v %q", tt.name, action, reason, tt.action, tt.reason)
+		}
+	}
+
+	codec.RegisterTranscoder(dmrconst.CodecCodec2, dmrconst.CodecAMBE, func() codec.Transcoder { return silence{} })
+	defer codec.UnregisterTranscoder(dmrconst.CodecCodec2, dmrconst.CodecAMBE)
+
+	action, reason := codec.Route(models.CodecPolicyTranscode, dmrconst.CodecCodec2, ambeOnly)
+	if action != codec.Transcode || reason != "" {
+		t.Errorf("Expected a registered transcoder to be used, got %v %q", action, reason)
+	}
+	action, _ = codec.Route(models.CodecPolicyPassthrough, dmrconst.CodecCodec2, ambeOnly)
+	if action != codec.Drop {
+		t.Errorf("Expected passthrough not to transcode, got %v", action)
+	}
+
+	if codec.CanTranscode(dmrconst.CodecAMBE, dmrconst.CodecCodec2) {
+		t.Error("Expected transcoders to only work in the direction they were registered")
+	}
+
+	transcoder, ok := codec.NewTranscoder(dmrconst.CodecCodec2, dmrconst.CodecAMBE)
+	if !ok {
+		t.Fatal("Expected a transcoder")
+	}
+	packets := transcoder.Transcode(models.Packet{Codec: dmrconst.CodecCodec2})
+	if len(packets) != 1 || packets[0].Codec != dmrconst.CodecAMBE {
+		t.Errorf("Expected one AMBE packet, got %+v", packets)
+	}
+}
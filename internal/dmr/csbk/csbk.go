@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package csbk parses and builds DMR Control Signalling Blocks
+package csbk
+
+import (
+	"errors"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/bptc"
+)
+
+// Opcode is a CSBK opcode
+type Opcode byte
+
+const (
+	OpcodeCallAlert    Opcode = 0x1F
+	OpcodeCallAlertAck Opcode = 0x20
+	OpcodeRadioCheck   Opcode = 0x24
+)
+
+const (
+	opcodeMask      = 0x3F
+	lastBlock       = 0x80
+	radioCheckQuery = 0x80
+	crcMask         = 0xA5A5
+	crcPoly         = 0x1021
+)
+
+var ErrBadCRC = errors.New("CSBK CRC mismatch")
+
+// CSBK is a single control signalling block
+type CSBK struct {
+	Opcode      Opcode
+	FeatureID   byte
+	Data        [2]byte
+	Destination uint
+	Source      uint
+}
+
+// FromBurst decodes a CSBK from a DMR data burst
+func FromBurst(burst [bptc.BurstLength]byte) (CSBK, error) {
+	raw := bptc.Decode(burst)
+	if crc(raw[:10])^crcMask != uint16(raw[10])<<8|uint16(raw[11]) {
+		return CSBK{}, ErrBadCRC
+	}
+	return CSBK{
+		Opcode:      Opcode(raw[0] & opcodeMask),
+		FeatureID:   raw[1],
+		Data:        [2]byte{raw[2], raw[3]},
+		Destination: uint(raw[4])<<16 | uint(raw[5])<<8 | uint(raw[6]),
+		Source:      uint(raw[7])<<16 | uint(raw[8])<<8 | uint(raw[9]),
+	}, nil
+}
+
+// ToBurst encodes the CSBK into a copy of the given burst, keeping its slot type and sync
+func (c CSBK) ToBurst(burst [bptc.BurstLength]byte) [bptc.BurstLength]byte {
+	var raw [bptc.DataLength]byte
+	raw[0] = lastBlock | byte(c.Opcode)&opcodeMask
+	raw[1] = c.FeatureID
+	raw[2] = c.Data[0]
+	raw[3] = c.Data[1]
+	raw[4] = byte(c.Destination >> 16)
+	raw[5] = byte(c.Destination >> 8)
+	raw[6] = byte(c.Destination)
+	raw[7] = byte(c.Source >> 16)
+	raw[8] = byte(c.Source >> 8)
+	raw[9] = byte(c.Source)
+	sum := crc(raw[:10]) ^ crcMask
+	raw[10] = byte(sum >> 8)
+	raw[11] = byte(sum)
+	return bptc.Encode(burst, raw)
+}
+
+// IsRadioCheckQuery reports whether the CSBK is a radio check request rather than a response
+func (c CSBK) IsRadioCheckQuery() bool {
+	return c.Opcode == OpcodeRadioCheck && c.Data[1] == radioCheckQuery
+}
+
+// Ack builds the response the target of a radio check or call alert sends back to the source
+func (c CSBK) Ack() (CSBK, bool) {
+	switch {
+	case c.IsRadioCheckQuery():
+		return CSBK{
+			Opcode:      OpcodeRadioCheck,
+			FeatureID:   c.FeatureID,
+			Data:        [2]byte{c.Data[0], 0x00},
+			Destination: c.Source,
+			Source:      c.Destination,
+		}, true
+	case c.Opcode == OpcodeCallAlert:
+		return CSBK{
+			Opcode:      OpcodeCallAlertAck,
+			FeatureID:   c.FeatureID,
+			Destination: c.Source,
+			Source:      c.Destination,
+		}, true
+	default:
+		return CSBK{}, false
+	}
+}
+
+// crc is the CRC-CCITT used by DMR, before the data type mask is applied
+func crc(data []byte) uint16 {
+	var sum uint16
+	for _, b := range data {
+		sum ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if sum&0x8000 != 0 {
+				sum = sum<<1 ^ crcPoly
+			} else {
+				sum <<= 1
+			}
+		}
+	}
+	return ^sum
+}
@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package csbk_test
+
+import (
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/bptc"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/csbk"
+)
+
+func TestCallAlertAck(t *testing.T) {
+	t.Parallel()
+	var burst [bptc.BurstLength]byte
+	alert := csbk.CSBK{Opcode: csbk.OpcodeCallAlert, Destination: 9990, Source: 3191868}
+
+	decoded, err := csbk.FromBurst(alert.ToBurst(burst))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if decoded != alert {
+		t.Fatalf("Expected %+v, got %+v", alert, decoded)
+	}
+
+	ack, ok := decoded.Ack()
+	if !ok {
+		t.Fatal("Expected a call alert to be acknowledged")
+	}
+	if ack.Opcode != csbk.OpcodeCallAlertAck || ack.Destination != 3191868 || ack.Source != 9990 {
+		t.Errorf("Unexpected ack: %+v", ack)
+	}
+}
+
+func TestBadCRC(t *testing.T) {
+	t.Parallel()
+	var burst [bptc.BurstLength]byte
+	encoded := csbk.CSBK{Opcode: csbk.OpcodeRadioCheck, Data: [2]byte{0, 0x80}, Destination: 9990, Source: 3191868}.ToBurst(burst)
+	encoded[0] ^= 0xFF
+	if _, err := csbk.FromBurst(encoded); err == nil {
+		t.Error("Expected a corrupted CSBK to fail its CRC")
+	}
+}
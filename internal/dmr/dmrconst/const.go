@@ -21,6 +21,7 @@ package dmrconst
 
 import (
 	"regexp"
+	"strings"
 )
 
 // Command is a DMR command.
@@ -41,6 +42,43 @@ const (
 	CommandRPTC    Command = "RPTC"    // repeater wants to send config or disconnect
 	CommandRPTO    Command = "RPTO"    // Repeater options. https://github.com/g4klx/MMDVMHost/blob/master/DMRplus_startup_options.md
 	CommandRPTSBKN Command = "RPTSBKN" // Synchronous Site Beacon?
+
+	// DMRHub protocol extensions, only sent to hotspots that negotiated them
+	CommandDHTG Command = "DHTG" // master -> repeater talkgroup list
+	CommandDHTC Command = "DHTC" // master -> repeater talkgroup list continued, when a DHTG is split
+	CommandDHMS Command = "DHMS" // master -> repeater text status message
+	CommandDHRJ Command = "DHRJ" // master -> repeater stream rejected, with the reason
+	CommandDHFO Command = "DHFO" // master -> repeater masters to fail over to
+	CommandDHFL Command = "DHFL" // repeater -> master failover login, resuming a session from another master
+)
+
+// ExtensionMagic marks the extension block appended to RPTACK and RPTC by DMRHub-aware clients.
+const ExtensionMagic = "DMRHUB"
+
+// ExtensionVersion is the version of the extension block format. Version 2 added ExtensionTalkgroupContinuation.
+const ExtensionVersion = 2
+
+// MinExtensionVersion is the oldest extension block version still accepted.
+const MinExtensionVersion = 1
+
+// ExtensionBlockLength is the size of an extension block: ExtensionMagic, a version byte, and a uint32 of Extension bits.
+const ExtensionBlockLength = len(ExtensionMagic) + 1 + 4
+
+// Extension is a bitmask of DMRHub protocol extensions.
+type Extension uint32
+
+// Extensions a hotspot can negotiate.
+const (
+	ExtensionTalkgroupList Extension = 1 << iota // push static and dynamic talkgroups with DHTG
+	ExtensionStatusMessage                       // text messages from the hub with DHMS
+	ExtensionRejectReason                        // explain refused streams with DHRJ
+	ExtensionFailover                            // failover masters with DHFO, resumed with DHFL
+	// ExtensionTalkgroupContinuation lets the hub split a DHTG too large for the repeater's maximum
+	// datagram size on entry boundaries: the first part is sent as a DHTG, replacing the hotspot's
+	// list, and the rest as DHTCs that add to it. Hotspots without it get the whole list in one DHTG.
+	ExtensionTalkgroupContinuation
+
+	ExtensionsSupported = ExtensionTalkgroupList | ExtensionStatusMessage | ExtensionRejectReason | ExtensionFailover | ExtensionTalkgroupContinuation
 )
 
 // FrameType is a DMR frame type.
@@ -86,20 +124,90 @@ const (
 	FrameDataSync  FrameType = 0x2
 )
 
+// Codec is the voice codec a packet's payload is encoded with. DMR carries AMBE,
+// other codecs only reach the hub through bridges to other modes.
+type Codec uint
+
+const codecExtensionType = 96
+
+const (
+	CodecAMBE   Codec = 0x0
+	CodecCodec2 Codec = 0x1 // M17, one 40ms frame in the first 16 bytes of DMRData
+)
+
+// ExtensionType returns the extension type for the codec.
+func (c *Codec) ExtensionType() int8 { return codecExtensionType }
+
+// Len returns the length of the codec.
+func (c *Codec) Len() int { return 1 }
+
+// MarshalBinaryTo writes the codec to the byte slice.
+func (c *Codec) MarshalBinaryTo(b []byte) error {
+	b[0] = byte(*c)
+	return nil
+}
+
+// UnmarshalBinary reads the codec from the byte slice.
+func (c *Codec) UnmarshalBinary(b []byte) error {
+	*c = Codec(b[0])
+	return nil
+}
+
+// String returns the name of the codec, as used in the CODECS repeater option.
+func (c *Codec) String() string {
+	switch *c {
+	case CodecAMBE:
+		return "AMBE"
+	case CodecCodec2:
+		return "CODEC2"
+	default:
+		return "Unknown"
+	}
+}
+
+// ParseCodec looks up a codec by name, ignoring case
+func ParseCodec(name string) (Codec, bool) {
+	for _, codec := range []Codec{CodecAMBE, CodecCodec2} {
+		if strings.EqualFold(codec.String(), name) {
+			return codec, true
+		}
+	}
+	return 0, false
+}
+
+// CodecSet is a bitmask of codecs a repeater or peer can take. Every DMR
+// endpoint takes AMBE, so it is never stored in the set.
+type CodecSet uint32
+
+// Has reports whether the set includes a codec
+func (s CodecSet) Has(codec Codec) bool {
+	return codec == CodecAMBE || s&(1<<codec) != 0
+}
+
+// With returns the set with a codec added
+func (s CodecSet) With(codec Codec) CodecSet {
+	if codec == CodecAMBE {
+		return s
+	}
+	return s | 1<<codec
+}
+
 // DataType is a DMR data type.
 type DataType uint
 
 const (
 	DTypeVoiceHead DataType = 0x1
 	DTypeVoiceTerm DataType = 0x2
+	DTypeCSBK      DataType = 0x3
 )
 
 // CallsignRegex is a regex for validating callsigns.
 var CallsignRegex = regexp.MustCompile(`^([A-Z0-9]{0,8})$`)
 
 const (
-	ParrotUser     = uint(9990)
-	SuperAdminUser = uint(999999)
+	ParrotUser         = uint(9990)
+	AudioTestTalkgroup = uint(9991)
+	SuperAdminUser     = uint(999999)
 )
 
 const (
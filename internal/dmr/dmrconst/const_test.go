@@ -56,3 +56,30 @@ func TestFrameTypeStringVoice(t *testing.T) {
 		t.Errorf("Expected %s, got %s", expected, result)
 	}
 }
+
+func TestParseCodec(t *testing.T) {
+	codec, ok := dmrconst.ParseCodec("codec2")
+	if !ok || codec != dmrconst.CodecCodec2 {
+		t.Errorf("Expected Codec2, got %v %v", codec, ok)
+	}
+	if _, ok := dmrconst.ParseCodec("opus"); ok {
+		t.Error("Expected opus to be unknown")
+	}
+}
+
+func TestCodecSetAlwaysHasAMBE(t *testing.T) {
+	var set dmrconst.CodecSet
+	if !set.Has(dmrconst.CodecAMBE) {
+		t.Error("Expected an empty set to take AMBE")
+	}
+	if set.Has(dmrconst.CodecCodec2) {
+		t.Error("Expected an empty set not to take Codec2")
+	}
+	set = set.With(dmrconst.CodecCodec2).With(dmrconst.CodecAMBE)
+	if !set.Has(dmrconst.CodecCodec2) {
+		t.Error("Expected the set to take Codec2")
+	}
+	if set != 1<<dmrconst.CodecCodec2 {
+		t.Errorf("Expected AMBE not to be stored in the set, got %b", set)
+	}
+}
@@ -0,0 +1,164 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package ingress
+
+import (
+	"net"
+	"strings"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+)
+
+// Protocol is the DMR protocol spoken on a UDP socket
+type Protocol int
+
+const (
+	ProtocolHBRP Protocol = iota
+	ProtocolOpenBridge
+)
+
+func (p Protocol) String() string {
+	switch p {
+	case ProtocolHBRP:
+		return "hbrp"
+	case ProtocolOpenBridge:
+		return "openbridge"
+	default:
+		return "unknown"
+	}
+}
+
+// Filter decides whether a datagram read from a DMR UDP socket should be handed to the packet handlers.
+// Implementations must be safe to call from the socket read loop, and so must not block.
+type Filter interface {
+	Allow(remoteAddr *net.UDPAddr, data []byte) bool
+}
+
+// NewFilter creates the ingress filter for a protocol based on the configuration.
+// When ingress filtering is disabled, every datagram is allowed.
+func NewFilter(protocol Protocol) Filter {
+	if !config.GetConfig().IngressFilter {
+		return allowAll{}
+	}
+	return newUserspaceFilter(protocol, config.GetConfig().IngressBannedNetworks, config.GetConfig().IngressMinSourcePort)
+}
+
+type allowAll struct{}
+
+func (allowAll) Allow(_ *net.UDPAddr, _ []byte) bool {
+	return true
+}
+
+type lengthRule struct {
+	command dmrconst.Command
+	min     int
+	max     int
+}
+
+// Packet sizes accepted by the HBRP handlers. Longer commands come first so
+// RPTCL and RPTPING aren't matched as RPTC and RPT*.
+var hbrpRules = []lengthRule{ //nolint:golint,gochecknoglobals
+	{dmrconst.CommandRPTPING, 11, 11},
+	{dmrconst.CommandRPTCL, 8, 9},
+	{dmrconst.CommandDMRD, 53, 55},
+	{dmrconst.CommandDMRA, 15, 300},
+	{dmrconst.CommandRPTL, 8, 8},
+	{dmrconst.CommandRPTK, 40, 40},
+	{dmrconst.CommandRPTC, 302, 302 + dmrconst.ExtensionBlockLength},
+	{dmrconst.CommandRPTO, 8, 300},
+	{dmrconst.CommandDHFL, 40, 40},
+}
+
+// OpenBridge only carries DMRD packets with a trailing HMAC
+var openBridgeRules = []lengthRule{ //nolint:golint,gochecknoglobals
+	{dmrconst.CommandDMRD, 73, 73},
+}
+
+// userspaceFilter drops banned sources, implausible source ports, and malformed packets in Go
+type userspaceFilter struct {
+	rules         []lengthRule
+	bannedNets    []*net.IPNet
+	minSourcePort int
+}
+
+func newUserspaceFilter(protocol Protocol, bannedNetworks []string, minSourcePort int) *userspaceFilter {
+	f := &userspaceFilter{
+		rules:         rulesFor(protocol),
+		minSourcePort: minSourcePort,
+	}
+
+	for _, network := range bannedNetworks {
+		network = strings.TrimSpace(network)
+		if network == "" {
+			continue
+		}
+		if !strings.Contains(network, "/") {
+			if ip := net.ParseIP(network); ip != nil && ip.To4() != nil {
+				network += "/32"
+			} else {
+				network += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			logging.Errorf("Ignoring invalid banned network %s: %v", network, err)
+			continue
+		}
+		f.bannedNets = append(f.bannedNets, ipNet)
+	}
+
+	return f
+}
+
+func (f *userspaceFilter) Allow(remoteAddr *net.UDPAddr, data []byte) bool {
+	if remoteAddr == nil || remoteAddr.Port < f.minSourcePort || remoteAddr.Port == 0 {
+		return false
+	}
+	for _, ipNet := range f.bannedNets {
+		if ipNet.Contains(remoteAddr.IP) {
+			return false
+		}
+	}
+	return wellFormed(f.rules, data)
+}
+
+// wellFormed reports whether a datagram is a known command of a plausible length
+func wellFormed(rules []lengthRule, data []byte) bool {
+	for _, rule := range rules {
+		if len(data) < len(rule.command) || dmrconst.Command(data[:len(rule.command)]) != rule.command {
+			continue
+		}
+		return len(data) >= rule.min && len(data) <= rule.max
+	}
+	return false
+}
+
+func rulesFor(protocol Protocol) []lengthRule {
+	switch protocol {
+	case ProtocolHBRP:
+		return hbrpRules
+	case ProtocolOpenBridge:
+		return openBridgeRules
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package ingress
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+)
+
+func TestUserspaceFilterLengths(t *testing.T) {
+	t.Parallel()
+	f := newUserspaceFilter(ProtocolHBRP, nil, 0)
+	addr := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 62031}
+
+	if !f.Allow(addr, append([]byte("RPTL"), 0, 0, 0, 1)) {
+		t.Error("Expected a valid RPTL packet to be allowed")
+	}
+	if f.Allow(addr, append([]byte("RPTL"), 0, 0, 1)) {
+		t.Error("Expected a short RPTL packet to be dropped")
+	}
+	if !f.Allow(addr, append([]byte("RPTPING"), 0, 0, 0, 1)) {
+		t.Error("Expected a valid RPTPING packet to be allowed")
+	}
+	if f.Allow(addr, []byte("JUNKJUNK")) {
+		t.Error("Expected an unknown command to be dropped")
+	}
+}
+
+func TestUserspaceFilterBannedNetworks(t *testing.T) {
+	t.Parallel()
+	f := newUserspaceFilter(ProtocolHBRP, []string{"198.51.100.0/24", "203.0.113.7", "not-an-ip"}, 1024)
+	packet := append([]byte("RPTL"), 0, 0, 0, 1)
+
+	if f.Allow(&net.UDPAddr{IP: net.ParseIP("198.51.100.20"), Port: 62031}, packet) {
+		t.Error("Expected a banned network to be dropped")
+	}
+	if f.Allow(&net.UDPAddr{IP: net.ParseIP("203.0.113.7"), Port: 62031}, packet) {
+		t.Error("Expected a banned IP to be dropped")
+	}
+	if f.Allow(&net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53}, packet) {
+		t.Error("Expected a privileged source port to be dropped")
+	}
+	if !f.Allow(&net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 62031}, packet) {
+		t.Error("Expected an allowed source to pass")
+	}
+}
+
+func TestUserspaceFilterExtendedRPTC(t *testing.T) {
+	t.Parallel()
+	f := newUserspaceFilter(ProtocolHBRP, nil, 0)
+	addr := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 62031}
+	rptc := append([]byte("RPTC"), bytes.Repeat([]byte{' '}, 298)...)
+
+	if !f.Allow(addr, rptc) {
+		t.Error("Expected a standard RPTC to be allowed")
+	}
+	extended := append(bytes.Clone(rptc), dmrconst.ExtensionMagic...)
+	extended = append(extended, dmrconst.ExtensionVersion, 0, 0, 0, byte(dmrconst.ExtensionTalkgroupList))
+	if !f.Allow(addr, extended) {
+		t.Error("Expected an RPTC with an extension block to be allowed")
+	}
+	if f.Allow(addr, append(extended, 0)) {
+		t.Error("Expected an RPTC longer than an extension block to be dropped")
+	}
+}
@@ -0,0 +1,252 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package ingress
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	quarantineKeyPrefix    = "ingress:quarantine:"
+	quarantineReleaseTopic = "ingress:quarantine:release"
+
+	anomalyWindow      = time.Minute
+	baseQuarantine     = time.Minute
+	maxQuarantine      = 24 * time.Hour
+	quarantinePruneAge = 2 * maxQuarantine
+)
+
+var ErrNotQuarantined = errors.New("source is not quarantined")
+
+// QuarantineEntry describes a source that is being dropped for sending malformed packets
+type QuarantineEntry struct {
+	IP        string    `json:"ip"`
+	Protocol  string    `json:"protocol"`
+	Strikes   uint      `json:"strikes"`
+	Malformed uint      `json:"malformed"`
+	Since     time.Time `json:"since"`
+	Until     time.Time `json:"until"`
+}
+
+type sourceState struct {
+	windowStart time.Time
+	malformed   uint
+	strikes     uint
+	until       time.Time
+}
+
+// Quarantine tracks malformed packets per source address and drops every packet
+// from a source that sends too many, backing off exponentially for repeat offenders.
+type Quarantine struct {
+	protocol Protocol
+	enabled  bool
+	limit    uint
+	redis    *redis.Client
+	now      func() time.Time
+
+	mu      sync.Mutex
+	sources map[string]*sourceState
+}
+
+// NewQuarantine creates the anomaly quarantine for a protocol based on the configuration.
+// When quarantine is disabled, every datagram is allowed.
+func NewQuarantine(protocol Protocol, redis *redis.Client) *Quarantine {
+	return newQuarantine(protocol, redis, config.GetConfig().IngressQuarantine, uint(config.GetConfig().IngressQuarantineLimit))
+}
+
+func newQuarantine(protocol Protocol, redis *redis.Client, enabled bool, limit uint) *Quarantine {
+	return &Quarantine{
+		protocol: protocol,
+		enabled:  enabled,
+		limit:    limit,
+		redis:    redis,
+		now:      time.Now,
+		sources:  make(map[string]*sourceState),
+	}
+}
+
+func (q *Quarantine) Allow(remoteAddr *net.UDPAddr, data []byte) bool {
+	if !q.enabled || remoteAddr == nil {
+		return true
+	}
+	ip := remoteAddr.IP.String()
+	now := q.now()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	state, ok := q.sources[ip]
+	if ok && now.Before(state.until) {
+		return false
+	}
+	if wellFormed(rulesFor(q.protocol), data) {
+		return true
+	}
+
+	if !ok {
+		state = &sourceState{}
+		q.sources[ip] = state
+	}
+	if now.Sub(state.windowStart) > anomalyWindow {
+		state.windowStart = now
+		state.malformed = 0
+	}
+	state.malformed++
+	if state.malformed < q.limit {
+		return false
+	}
+
+	// Offenders that have behaved for a while start over at the shortest quarantine
+	if !state.until.IsZero() && now.Sub(state.until) > maxQuarantine {
+		state.strikes = 0
+	}
+	state.strikes++
+	backoff := baseQuarantine << (state.strikes - 1)
+	if backoff > maxQuarantine || backoff <= 0 {
+		backoff = maxQuarantine
+	}
+	state.until = now.Add(backoff)
+	entry := QuarantineEntry{
+		IP:        ip,
+		Protocol:  q.protocol.String(),
+		Strikes:   state.strikes,
+		Malformed: state.malformed,
+		Since:     now,
+		Until:     state.until,
+	}
+	state.malformed = 0
+
+	logging.Errorf("Quarantining %s on %s for %s after %d malformed packets", ip, entry.Protocol, backoff, entry.Malformed)
+	if q.redis != nil {
+		go q.publish(entry, backoff)
+	}
+	return false
+}
+
+func (q *Quarantine) publish(entry QuarantineEntry, backoff time.Duration) {
+	entryJSON, err := json.Marshal(entry)
+	if err != nil {
+		logging.Errorf("Error marshalling quarantine entry: %v", err)
+		return
+	}
+	err = q.redis.Set(context.Background(), quarantineKey(entry.Protocol, entry.IP), entryJSON, backoff).Err()
+	if err != nil {
+		logging.Errorf("Error storing quarantine entry: %v", err)
+	}
+}
+
+// Listen releases sources when an admin lifts their quarantine, and forgets
+// sources that haven't misbehaved in a long time.
+func (q *Quarantine) Listen(ctx context.Context) {
+	if !q.enabled || q.redis == nil {
+		return
+	}
+	pubsub := q.redis.Subscribe(ctx, quarantineReleaseTopic)
+	defer func() {
+		err := pubsub.Close()
+		if err != nil {
+			logging.Errorf("Error closing pubsub: %v", err)
+		}
+	}()
+	ticker := time.NewTicker(anomalyWindow)
+	defer ticker.Stop()
+	pubsubChannel := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			q.prune()
+		case msg := <-pubsubChannel:
+			q.release(msg.Payload)
+		}
+	}
+}
+
+func (q *Quarantine) release(ip string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.sources, ip)
+}
+
+func (q *Quarantine) prune() {
+	now := q.now()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for ip, state := range q.sources {
+		if now.Sub(state.windowStart) > quarantinePruneAge && now.Sub(state.until) > quarantinePruneAge {
+			delete(q.sources, ip)
+		}
+	}
+}
+
+func quarantineKey(protocol string, ip string) string {
+	return fmt.Sprintf("%s%s:%s", quarantineKeyPrefix, protocol, ip)
+}
+
+// ListQuarantined returns every source currently quarantined by either UDP server
+func ListQuarantined(ctx context.Context, redis *redis.Client) ([]QuarantineEntry, error) {
+	entries := []QuarantineEntry{}
+	iter := redis.Scan(ctx, 0, quarantineKeyPrefix+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		entryJSON, err := redis.Get(ctx, iter.Val()).Bytes()
+		if err != nil {
+			// The quarantine expired while we were scanning
+			continue
+		}
+		var entry QuarantineEntry
+		err = json.Unmarshal(entryJSON, &entry)
+		if err != nil {
+			logging.Errorf("Error unmarshalling quarantine entry: %v", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := iter.Err(); err != nil {
+		return entries, fmt.Errorf("error scanning quarantine: %w", err)
+	}
+	return entries, nil
+}
+
+// Release lifts the quarantine on a source address for every protocol
+func Release(ctx context.Context, redis *redis.Client, ip string) error {
+	deleted, err := redis.Del(ctx, quarantineKey(ProtocolHBRP.String(), ip), quarantineKey(ProtocolOpenBridge.String(), ip)).Result()
+	if err != nil {
+		return fmt.Errorf("error releasing quarantine: %w", err)
+	}
+	err = redis.Publish(ctx, quarantineReleaseTopic, ip).Err()
+	if err != nil {
+		return fmt.Errorf("error publishing quarantine release: %w", err)
+	}
+	if deleted == 0 {
+		return ErrNotQuarantined
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package ingress
+
+import (
+	"crypto/sha256"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestQuarantineBackoff(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	q := newQuarantine(ProtocolHBRP, nil, true, 3)
+	q.now = func() time.Time { return now }
+
+	offender := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 62031}
+	bystander := &net.UDPAddr{IP: net.ParseIP("192.0.2.2"), Port: 62031}
+	valid := append([]byte("RPTL"), 0, 0, 0, 1)
+	junk := []byte("JUNKJUNK")
+
+	offend := func() {
+		for i := 0; i < 3; i++ {
+			if q.Allow(offender, junk) {
+				t.Fatal("Expected a malformed packet to be dropped")
+			}
+		}
+	}
+
+	if !q.Allow(offender, valid) {
+		t.Error("Expected a valid packet to be allowed before quarantine")
+	}
+	offend()
+	if q.Allow(offender, valid) {
+		t.Error("Expected a quarantined source to be dropped")
+	}
+	if !q.Allow(bystander, valid) {
+		t.Error("Expected other sources to be unaffected")
+	}
+
+	now = now.Add(baseQuarantine + time.Second)
+	if !q.Allow(offender, valid) {
+		t.Error("Expected the source to be released after the first quarantine")
+	}
+
+	// A second offense doubles the quarantine
+	offend()
+	now = now.Add(baseQuarantine + time.Second)
+	if q.Allow(offender, valid) {
+		t.Error("Expected the second quarantine to last longer than the first")
+	}
+	now = now.Add(baseQuarantine)
+	if !q.Allow(offender, valid) {
+		t.Error("Expected the source to be released after the second quarantine")
+	}
+
+	q.release(offender.IP.String())
+	offend()
+	now = now.Add(baseQuarantine + time.Second)
+	if !q.Allow(offender, valid) {
+		t.Error("Expected a released source to start over at the shortest quarantine")
+	}
+}
+
+func TestQuarantineDisabled(t *testing.T) {
+	t.Parallel()
+	q := newQuarantine(ProtocolOpenBridge, nil, false, 1)
+	addr := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 62031}
+	for i := 0; i < 5; i++ {
+		if !q.Allow(addr, []byte("JUNK")) {
+			t.Fatal("Expected a disabled quarantine to allow everything")
+		}
+	}
+}
+
+func TestQuarantineAllowsDHFL(t *testing.T) {
+	t.Parallel()
+	q := newQuarantine(ProtocolHBRP, nil, true, 1)
+	addr := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 62031}
+	dhfl := append([]byte("DHFL"), 0, 0, 0, 1)
+	dhfl = append(dhfl, make([]byte, sha256.Size)...)
+
+	for i := 0; i < 3; i++ {
+		if !q.Allow(addr, dhfl) {
+			t.Fatal("Expected a failover login to be allowed")
+		}
+	}
+	if q.Allow(addr, dhfl[:len(dhfl)-1]) {
+		t.Error("Expected a truncated failover login to be dropped")
+	}
+}
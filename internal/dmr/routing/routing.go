@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package routing records why each stream was or wasn't delivered to each
+// destination, so admins can explain a call after the fact.
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+)
+
+// Routing decisions are kept for a day, long enough to investigate a report from a user
+const retention = 24 * time.Hour
+
+type Target string
+
+const (
+	TargetRepeater  Target = "repeater"
+	TargetPeer      Target = "peer"
+	TargetTalkgroup Target = "talkgroup"
+	TargetUser      Target = "user"
+	TargetParrot    Target = "parrot"
+	TargetCallout   Target = "callout_group"
+	TargetAudioTest Target = "audio_test"
+)
+
+type Reason string
+
+const (
+	ReasonStatic           Reason = "static_talkgroup"
+	ReasonDynamic          Reason = "dynamic_talkgroup"
+	ReasonPrivate          Reason = "private_call"
+	ReasonParrot           Reason = "parrot"
+	ReasonEchoSuppression  Reason = "echo_suppression"
+	ReasonOffline          Reason = "offline"
+	ReasonNotSubscribed    Reason = "not_subscribed"
+	ReasonPeerRules        Reason = "peer_rules"
+	ReasonQuota            Reason = "quota_exceeded"
+	ReasonUnknownTalkgroup Reason = "unknown_talkgroup"
+	ReasonPendingApproval  Reason = "talkgroup_pending_approval"
+	ReasonPrivateTalkgroup Reason = "private_talkgroup"
+	ReasonMuted            Reason = "muted"
+	ReasonBridge           Reason = "repeater_bridge"
+	ReasonUnknownUser      Reason = "unknown_user"
+	ReasonUnknownRepeater  Reason = "unknown_repeater"
+	ReasonInhibited        Reason = "tx_inhibited"
+	ReasonCallout          Reason = "callout"
+	ReasonAudioTest        Reason = "audio_test"
+	ReasonCodecBlocked     Reason = "codec_blocked"
+	ReasonCodecUnsupported Reason = "codec_unsupported"
+	ReasonTranscoded       Reason = "transcoded"
+	ReasonShuttingDown     Reason = "shutting_down"
+)
+
+// Decision is a single routing outcome for a stream
+type Decision struct {
+	Target    Target    `json:"target"`
+	TargetID  uint      `json:"target_id"`
+	Delivered bool      `json:"delivered"`
+	Reason    Reason    `json:"reason"`
+	Timeslot  uint      `json:"timeslot,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// Timeslot converts a packet's slot flag into a timeslot number
+func Timeslot(slot bool) uint {
+	if slot {
+		return 2 //nolint:golint,gomnd
+	}
+	return 1
+}
+
+// Sampled reports whether decisions for a stream should be recorded.
+// Sampling by stream ID keeps every component in agreement about a stream.
+func Sampled(streamID uint) bool {
+	return sampled(streamID, config.GetConfig().RoutingExplainPercent)
+}
+
+func sampled(streamID uint, percent int) bool {
+	const buckets = 100
+	return streamID%buckets < uint(percent)
+}
+
+func key(streamID uint) string {
+	return fmt.Sprintf("routing:stream:%d", streamID)
+}
+
+// Record stores routing decisions for a stream if it is sampled
+func Record(ctx context.Context, redis *redis.Client, streamID uint, decisions ...Decision) {
+	if len(decisions) == 0 || !Sampled(streamID) {
+		return
+	}
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "routing.Record")
+	defer span.End()
+
+	now := time.Now()
+	values := make([]any, 0, len(decisions))
+	for _, decision := range decisions {
+		if decision.Time.IsZero() {
+			decision.Time = now
+		}
+		decisionJSON, err := json.Marshal(decision)
+		if err != nil {
+			logging.Errorf("Error marshalling routing decision: %v", err)
+			continue
+		}
+		values = append(values, decisionJSON)
+	}
+
+	pipe := redis.Pipeline()
+	pipe.RPush(ctx, key(streamID), values...)
+	pipe.Expire(ctx, key(streamID), retention)
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		logging.Errorf("Error recording routing decisions: %v", err)
+	}
+}
+
+// Load returns the recorded routing decisions for a stream in the order they were made
+func Load(ctx context.Context, redis *redis.Client, streamID uint) ([]Decision, error) {
+	values, err := redis.LRange(ctx, key(streamID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error loading routing decisions: %w", err)
+	}
+	decisions := make([]Decision, 0, len(values))
+	for _, value := range values {
+		var decision Decision
+		err := json.Unmarshal([]byte(value), &decision)
+		if err != nil {
+			logging.Errorf("Error unmarshalling routing decision: %v", err)
+			continue
+		}
+		decisions = append(decisions, decision)
+	}
+	return decisions, nil
+}
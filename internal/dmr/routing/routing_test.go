@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package routing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+)
+
+func TestSampled(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		streamID uint
+		percent  int
+		want     bool
+	}{
+		{streamID: 1200, percent: 0, want: false},
+		{streamID: 1200, percent: 1, want: true},
+		{streamID: 1201, percent: 1, want: false},
+		{streamID: 1249, percent: 50, want: true},
+		{streamID: 1250, percent: 50, want: false},
+		{streamID: 1299, percent: 100, want: true},
+	}
+	for _, tt := range tests {
+		if got := sampled(tt.streamID, tt.percent); got != tt.want {
+			t.Errorf("sampled(%d, %d) = %v, want %v", tt.streamID, tt.percent, got, tt.want)
+		}
+	}
+}
+
+func TestRecordAndLoad(t *testing.T) {
+	t.Parallel()
+	_, redis := fakeredis.New(t)
+	ctx := context.Background()
+
+	// At the default rate, only streams ending in 00 are sampled
+	const sampledStream, unsampledStream = 4200, 4242
+	Record(ctx, redis, sampledStream,
+		Decision{Target: TargetRepeater, TargetID: 311001, Delivered: true, Reason: ReasonStatic, Timeslot: Timeslot(true)},
+		Decision{Target: TargetRepeater, TargetID: 311002, Reason: ReasonEchoSuppression},
+	)
+	Record(ctx, redis, sampledStream, Decision{Target: TargetRepeater, TargetID: 311003, Reason: ReasonOffline})
+	Record(ctx, redis, unsampledStream, Decision{Target: TargetRepeater, TargetID: 311001, Delivered: true, Reason: ReasonStatic})
+
+	decisions, err := Load(ctx, redis, sampledStream)
+	if err != nil {
+		t.Fatalf("Failed to load decisions: %v", err)
+	}
+	if len(decisions) != 3 {
+		t.Fatalf("Expected 3 decisions, got %+v", decisions)
+	}
+	if !decisions[0].Delivered || decisions[0].Timeslot != 2 || decisions[0].Time.IsZero() {
+		t.Errorf("Unexpected first decision %+v", decisions[0])
+	}
+	if decisions[1].Reason != ReasonEchoSuppression || decisions[2].TargetID != 311003 {
+		t.Errorf("Expected decisions in the order they were made, got %+v", decisions)
+	}
+
+	decisions, err = Load(ctx, redis, unsampledStream)
+	if err != nil || len(decisions) != 0 {
+		t.Errorf("Expected nothing recorded for an unsampled stream, got %+v err=%v", decisions, err)
+	}
+}
@@ -21,10 +21,18 @@ package rules
 
 import (
 	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
 	"gorm.io/gorm"
 )
 
 func PeerShouldEgress(db *gorm.DB, peer models.Peer, packet *models.Packet) bool {
+	// OpenBridge only carries AMBE
+	if packet.Codec != dmrconst.CodecAMBE {
+		return false
+	}
+	if privateGroupCall(db, packet) {
+		return false
+	}
 	if peer.Egress {
 		for _, rule := range models.ListEgressRulesForPeer(db, peer.ID) {
 			if rule.SubjectIDMin <= packet.Src && rule.SubjectIDMax >= packet.Src {
@@ -36,6 +44,9 @@ func PeerShouldEgress(db *gorm.DB, peer models.Peer, packet *models.Packet) bool
 }
 
 func PeerShouldIngress(db *gorm.DB, peer *models.Peer, packet *models.Packet) bool {
+	if privateGroupCall(db, packet) {
+		return false
+	}
 	if peer.Ingress {
 		for _, rule := range models.ListIngressRulesForPeer(db, peer.ID) {
 			if rule.SubjectIDMin <= packet.Dst && rule.SubjectIDMax >= packet.Dst {
@@ -45,3 +56,17 @@ func PeerShouldIngress(db *gorm.DB, peer *models.Peer, packet *models.Packet) bo
 	}
 	return false
 }
+
+// privateGroupCall reports whether a packet is for a private talkgroup.
+// Private talkgroups never cross OpenBridge, in either direction.
+func privateGroupCall(db *gorm.DB, packet *models.Packet) bool {
+	if !packet.GroupCall {
+		return false
+	}
+	private, err := models.TalkgroupIsPrivate(db, packet.Dst)
+	if err != nil {
+		// Fail closed, a private talkgroup must not leak because of a DB error
+		return true
+	}
+	return private
+}
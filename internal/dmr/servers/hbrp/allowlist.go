@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/puzpuzpuz/xsync/v3"
+	"gorm.io/gorm"
+)
+
+// allowlistIdle is how long a stream may go without packets before its decision is dropped
+const allowlistIdle = 10 * time.Second
+
+type allowlistKey struct {
+	repeaterID  uint
+	streamID    uint
+	talkgroupID uint
+}
+
+type allowlistDecision struct {
+	allowed  bool
+	lastSeen atomic.Int64
+}
+
+// streamAllowlist decides once per stream whether a repeater may transmit on a talkgroup,
+// so a private talkgroup's allowlist isn't looked up for every burst of a call
+type streamAllowlist struct {
+	db      *gorm.DB
+	streams *xsync.MapOf[allowlistKey, *allowlistDecision]
+}
+
+func newStreamAllowlist(db *gorm.DB) *streamAllowlist {
+	return &streamAllowlist{
+		db:      db,
+		streams: xsync.NewMapOf[allowlistKey, *allowlistDecision](),
+	}
+}
+
+// allows reports whether the repeater may carry the packet's talkgroup, looking it up on the
+// stream's first burst. Lookups that fail aren't remembered, so the next burst tries again.
+func (a *streamAllowlist) allows(repeaterID uint, packet models.Packet, now time.Time) (bool, error) {
+	key := allowlistKey{repeaterID: repeaterID, streamID: packet.StreamID, talkgroupID: packet.Dst}
+	if decision, ok := a.streams.Load(key); ok {
+		decision.lastSeen.Store(now.UnixNano())
+		return decision.allowed, nil
+	}
+
+	allowed, err := models.TalkgroupAllowsRepeater(a.db, packet.Dst, repeaterID)
+	if err != nil {
+		return false, err
+	}
+	decision := &allowlistDecision{allowed: allowed}
+	decision.lastSeen.Store(now.UnixNano())
+	a.streams.Store(key, decision)
+	a.sweep(now)
+	return allowed, nil
+}
+
+// sweep drops decisions for streams that have ended
+func (a *streamAllowlist) sweep(now time.Time) {
+	a.streams.Range(func(key allowlistKey, decision *allowlistDecision) bool {
+		if now.Sub(time.Unix(0, decision.lastSeen.Load())) > allowlistIdle {
+			a.streams.Delete(key)
+		}
+		return true
+	})
+}
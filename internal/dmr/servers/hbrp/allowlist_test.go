@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+// Not parallel, see makeTestDB
+func TestStreamAllowlistDecidesOncePerStream(t *testing.T) {
+	db := makeTestDB(t)
+	const repeaterID = 311860160
+	const talkgroupID = 31665
+	if err := db.Save(&models.Talkgroup{ID: talkgroupID, Private: true}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := models.SetTalkgroupAllowedRepeaters(db, talkgroupID, nil); err != nil {
+		t.Fatal(err)
+	}
+	allowlist := newStreamAllowlist(db)
+	now := time.Now()
+	packet := models.Packet{Dst: talkgroupID, GroupCall: true, StreamID: 1}
+
+	allowed, err := allowlist.allows(repeaterID, packet, now)
+	if err != nil || allowed {
+		t.Fatalf("Expected a repeater off the allowlist to be refused, got %v err=%v", allowed, err)
+	}
+
+	if err := models.SetTalkgroupAllowedRepeaters(db, talkgroupID, []uint{repeaterID}); err != nil {
+		t.Fatal(err)
+	}
+	allowed, err = allowlist.allows(repeaterID, packet, now.Add(time.Second))
+	if err != nil || allowed {
+		t.Errorf("Expected the decision to hold for the rest of the stream, got %v err=%v", allowed, err)
+	}
+	packet.StreamID = 2
+	allowed, err = allowlist.allows(repeaterID, packet, now.Add(2*time.Second))
+	if err != nil || !allowed {
+		t.Errorf("Expected the next stream to see the new allowlist, got %v err=%v", allowed, err)
+	}
+
+	allowlist.sweep(now.Add(2*time.Second + allowlistIdle + time.Second))
+	if allowlist.streams.Size() != 0 {
+		t.Errorf("Expected ended streams to be swept, %d left", allowlist.streams.Size())
+	}
+}
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/calltracker"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/puzpuzpuz/xsync/v3"
+)
+
+// minAudioTestDuration ignores key-ups, the same as call tracking
+const minAudioTestDuration = 100 * time.Millisecond
+
+// audioTestStream is a transmission to the audio test talkgroup being measured
+type audioTestStream struct {
+	measurement *calltracker.Measurement
+	test        models.AudioTest
+	timer       *time.Timer
+}
+
+// audioTester measures the link quality of transmissions to the audio test talkgroup as they arrive.
+// A test finishes at the voice terminator, or once the stream has been quiet for the timeout.
+type audioTester struct {
+	timeout time.Duration
+	streams *xsync.MapOf[uint, *audioTestStream]
+}
+
+func newAudioTester(timeout time.Duration) *audioTester {
+	return &audioTester{
+		timeout: timeout,
+		streams: xsync.NewMapOf[uint, *audioTestStream](),
+	}
+}
+
+// add measures a packet, calling finished with the result once the transmission ends
+func (a *audioTester) add(packet models.Packet, repeaterID uint, at time.Time, finished func(models.AudioTest)) {
+	stream, loaded := a.streams.LoadOrCompute(packet.StreamID, func() *audioTestStream {
+		return &audioTestStream{
+			measurement: calltracker.NewMeasurement(at),
+			test: models.AudioTest{
+				UserID:     packet.Src,
+				RepeaterID: repeaterID,
+				StreamID:   packet.StreamID,
+				TimeSlot:   packet.Slot,
+			},
+			timer: time.AfterFunc(a.timeout, func() {
+				a.finish(packet.StreamID, finished)
+			}),
+		}
+	})
+	if loaded {
+		stream.timer.Reset(a.timeout)
+	}
+	stream.measurement.Add(packet, at)
+	if packet.FrameType == dmrconst.FrameDataSync && dmrconst.DataType(packet.DTypeOrVSeq) == dmrconst.DTypeVoiceTerm {
+		a.finish(packet.StreamID, finished)
+	}
+}
+
+// active reports whether a stream is already being measured
+func (a *audioTester) active(streamID uint) bool {
+	_, ok := a.streams.Load(streamID)
+	return ok
+}
+
+func (a *audioTester) finish(streamID uint, finished func(models.AudioTest)) {
+	stream, ok := a.streams.LoadAndDelete(streamID)
+	if !ok {
+		return
+	}
+	stream.timer.Stop()
+	test := stream.test
+	stream.measurement.Result(&test)
+	if test.Duration < minAudioTestDuration {
+		return
+	}
+	finished(test)
+}
+
+// doAudioTest measures a transmission to the audio test talkgroup and reports the result when it ends
+func (s *Server) doAudioTest(ctx context.Context, packet models.Packet, repeaterID uint) {
+	s.audioTests.add(packet, repeaterID, time.Now(), func(test models.AudioTest) {
+		s.reportAudioTest(ctx, test)
+	})
+}
+
+// reportAudioTest saves a test result and shows it on the hotspot, if it negotiated ExtensionStatusMessage
+func (s *Server) reportAudioTest(ctx context.Context, test models.AudioTest) {
+	summary := test.Summary()
+	logging.Logf("Audio test from %d via %d: %s", test.UserID, test.RepeaterID, summary)
+	err := models.CreateAudioTest(s.DB, &test)
+	if err != nil {
+		logging.Errorf("Error saving audio test from %d: %v", test.UserID, err)
+	}
+	err = SendStatusMessage(ctx, s.Redis, test.RepeaterID, summary)
+	if err != nil && (config.GetConfig().Debug || !errors.Is(err, ErrExtensionNotNegotiated)) {
+		logging.Errorf("Error sending audio test result to %d: %v", test.RepeaterID, err)
+	}
+}
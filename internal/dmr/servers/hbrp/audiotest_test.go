@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/calltracker"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+)
+
+func TestAudioTesterFinishesAtTerminator(t *testing.T) {
+	t.Parallel()
+	tester := newAudioTester(time.Hour)
+	var results []models.AudioTest
+	finished := func(test models.AudioTest) { results = append(results, test) }
+
+	start := time.Now()
+	packet := models.Packet{Src: 3110001, Dst: dmrconst.AudioTestTalkgroup, StreamID: 42, Slot: true, FrameType: dmrconst.FrameDataSync, DTypeOrVSeq: uint(dmrconst.DTypeVoiceHead)}
+	tester.add(packet, 311860, start, finished)
+	packet.Seq, packet.FrameType, packet.DTypeOrVSeq = 1, dmrconst.FrameVoiceSync, dmrconst.VoiceA
+	tester.add(packet, 311860, start.Add(time.Second), finished)
+	if len(results) != 0 {
+		t.Fatal("Expected no result before the terminator")
+	}
+	packet.Seq, packet.FrameType, packet.DTypeOrVSeq = 2, dmrconst.FrameDataSync, uint(dmrconst.DTypeVoiceTerm)
+	tester.add(packet, 311860, start.Add(2*time.Second), finished)
+
+	if len(results) != 1 {
+		t.Fatalf("Expected one result, got %d", len(results))
+	}
+	if results[0].UserID != 3110001 || results[0].RepeaterID != 311860 || !results[0].TimeSlot || results[0].Duration != 2*time.Second {
+		t.Errorf("Unexpected result %+v", results[0])
+	}
+	if _, ok := tester.streams.Load(42); ok {
+		t.Error("Expected the stream to be forgotten")
+	}
+}
+
+func TestAudioTesterIgnoresKeyUps(t *testing.T) {
+	t.Parallel()
+	tester := newAudioTester(time.Hour)
+	called := false
+	start := time.Now()
+	packet := models.Packet{StreamID: 43, FrameType: dmrconst.FrameDataSync, DTypeOrVSeq: uint(dmrconst.DTypeVoiceHead)}
+	tester.add(packet, 311860, start, func(models.AudioTest) { called = true })
+	packet.Seq, packet.DTypeOrVSeq = 1, uint(dmrconst.DTypeVoiceTerm)
+	tester.add(packet, 311860, start.Add(50*time.Millisecond), func(models.AudioTest) { called = true })
+	if called {
+		t.Error("Expected a key-up not to be reported")
+	}
+}
+
+// Not parallel, see makeTestDB
+func TestAudioTestStreamActive(t *testing.T) {
+	db := makeTestDB(t)
+	_, redis := fakeredis.New(t)
+	server := MakeServer(db, redis, servers.MakeRedisClient(redis), calltracker.NewCallTracker(db, redis), "test", "test")
+	ctx := context.Background()
+
+	packet := models.Packet{Src: 3110001, Dst: dmrconst.AudioTestTalkgroup, GroupCall: true, StreamID: 44, FrameType: dmrconst.FrameDataSync, DTypeOrVSeq: uint(dmrconst.DTypeVoiceHead)}
+	if server.streamActive(ctx, packet) {
+		t.Fatal("Expected the voice header to start a new stream")
+	}
+	server.doAudioTest(ctx, packet, 311860)
+	// Audio tests are never call tracked, so later bursts must not look like new streams
+	packet.Seq, packet.FrameType, packet.DTypeOrVSeq = 1, dmrconst.FrameVoiceSync, dmrconst.VoiceA
+	if !server.streamActive(ctx, packet) {
+		t.Error("Expected later bursts to belong to the stream being measured")
+	}
+	server.doAudioTest(ctx, packet, 311860)
+	packet.Seq, packet.FrameType, packet.DTypeOrVSeq = 2, dmrconst.FrameDataSync, uint(dmrconst.DTypeVoiceTerm)
+	server.doAudioTest(ctx, packet, 311860)
+
+	packet.StreamID = 45
+	packet.Seq, packet.DTypeOrVSeq = 0, uint(dmrconst.DTypeVoiceHead)
+	if server.streamActive(ctx, packet) {
+		t.Error("Expected the next test to start a new stream")
+	}
+}
@@ -0,0 +1,282 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	// benchmarkTimeout bounds how long a benchmark waits for its packets to come back
+	benchmarkTimeout = 30 * time.Second
+	// benchmarkWindow is how many packets may be in flight at once. Bursts are matched up by
+	// stream and sequence number, so this must stay under the 256 bursts a stream can number.
+	benchmarkWindow = 128
+	// Synthetic IDs outside the ranges handed out to real repeaters, talkgroups and users.
+	// The user is never registered, so benchmark calls aren't tracked or recorded.
+	benchmarkSource    = 999999999
+	benchmarkSink      = 999999998
+	benchmarkTalkgroup = 16777214
+	benchmarkUser      = 16777213
+	// benchmarkCallsign and benchmarkName mark the rows the benchmark created
+	benchmarkCallsign = "BENCH"
+	benchmarkName     = "Routing benchmark"
+)
+
+var ErrBenchmarkTimeout = errors.New("benchmark timed out before all packets were routed")
+
+// BenchmarkResult summarizes how long synthetic packets took to cross the hub's routing path
+type BenchmarkResult struct {
+	Packets   int           `json:"packets"`
+	Delivered int           `json:"delivered"`
+	Elapsed   time.Duration `json:"elapsed_ns"`
+	P50       time.Duration `json:"p50_ns"`
+	P90       time.Duration `json:"p90_ns"`
+	P99       time.Duration `json:"p99_ns"`
+	Max       time.Duration `json:"max_ns"`
+}
+
+// benchmarkBurst identifies a burst by its stream and sequence number
+type benchmarkBurst struct {
+	streamID uint
+	seq      uint
+}
+
+// RunRoutingBenchmark measures the hub's routing path end to end. A synthetic source repeater
+// keys up on a synthetic talkgroup and its packets go through the incoming queue used for UDP
+// traffic, handleDMRDPacket, the talkgroup fan-out and a SubscriptionManager subscription for a
+// synthetic sink repeater linked to the talkgroup. The HBRP server then sends them to the sink
+// over UDP, to a socket on the loopback interface where the latency is measured.
+//
+// The repeaters and talkgroup are created for the run, owned by ownerID, and removed afterwards.
+// The HBRP server must be running in this process for packets to reach the loopback socket.
+// Nothing is sent over RF.
+func RunRoutingBenchmark(ctx context.Context, db *gorm.DB, redis *redis.Client, ownerID uint, packets int) (BenchmarkResult, error) {
+	result := BenchmarkResult{Packets: packets}
+	ctx, cancel := context.WithTimeout(ctx, benchmarkTimeout)
+	defer cancel()
+
+	var nonce [4]byte
+	_, err := rand.Read(nonce[:])
+	if err != nil {
+		return result, fmt.Errorf("failed to generate benchmark stream ID: %w", err)
+	}
+	firstStreamID := uint(binary.BigEndian.Uint32(nonce[:]))
+
+	sink, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}) //nolint:golint,mnd
+	if err != nil {
+		return result, fmt.Errorf("failed to open benchmark socket: %w", err)
+	}
+	defer sink.Close()
+	sinkAddr, ok := sink.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return result, fmt.Errorf("unexpected benchmark socket address %s", sink.LocalAddr())
+	}
+
+	redisClient := servers.MakeRedisClient(redis)
+	teardown, err := setupBenchmark(ctx, db, redisClient, ownerID, sinkAddr)
+	defer teardown()
+	if err != nil {
+		return result, err
+	}
+
+	var mu sync.Mutex
+	sent := make(map[benchmarkBurst]time.Time, benchmarkWindow)
+	window := make(chan struct{}, benchmarkWindow)
+	latencies := make([]time.Duration, 0, packets)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, dmrconst.HBRPPacketLength+2) //nolint:golint,mnd
+		for len(latencies) < packets {
+			n, _, err := sink.ReadFromUDP(buf)
+			if err != nil {
+				// The socket is closed once the benchmark times out
+				return
+			}
+			if n < len(dmrconst.CommandDMRD) || dmrconst.Command(buf[:len(dmrconst.CommandDMRD)]) != dmrconst.CommandDMRD {
+				continue
+			}
+			packet, ok := models.UnpackPacket(buf[:n])
+			if !ok || packet.Repeater != benchmarkSink {
+				continue
+			}
+			burst := benchmarkBurst{streamID: packet.StreamID, seq: packet.Seq}
+			mu.Lock()
+			at, pending := sent[burst]
+			delete(sent, burst)
+			mu.Unlock()
+			if !pending {
+				// Another replica routed it too
+				continue
+			}
+			latencies = append(latencies, time.Since(at))
+			<-window
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		_ = sink.SetReadDeadline(time.Now())
+	}()
+
+	start := time.Now()
+send:
+	for i := range packets {
+		select {
+		case window <- struct{}{}:
+		case <-ctx.Done():
+			break send
+		}
+		const burstsPerStream = 256
+		packet := models.Packet{
+			Signature:   string(dmrconst.CommandDMRD),
+			Seq:         uint(i % burstsPerStream),
+			Src:         benchmarkUser,
+			Dst:         benchmarkTalkgroup,
+			Repeater:    benchmarkSource,
+			Slot:        true,
+			GroupCall:   true,
+			FrameType:   dmrconst.FrameVoice,
+			DTypeOrVSeq: uint(i % 6), //nolint:golint,mnd
+			// Each stream numbers its bursts once, so the deduplicator never sees a sequence number twice
+			StreamID: firstStreamID + uint(i/burstsPerStream),
+			BER:      -1,
+			RSSI:     -1,
+		}
+		rawPacket := models.RawDMRPacket{Data: packet.Encode(), RemoteIP: sinkAddr.IP.String(), RemotePort: sinkAddr.Port}
+		packedBytes, err := rawPacket.MarshalMsg(nil)
+		if err != nil {
+			return result, fmt.Errorf("failed to marshal benchmark packet: %w", err)
+		}
+		mu.Lock()
+		sent[benchmarkBurst{streamID: packet.StreamID, seq: packet.Seq}] = time.Now()
+		mu.Unlock()
+		err = redis.Publish(ctx, "hbrp:incoming", packedBytes).Err()
+		if err != nil && ctx.Err() == nil {
+			return result, fmt.Errorf("failed to publish benchmark packet: %w", err)
+		}
+	}
+	<-done
+	result.Elapsed = time.Since(start)
+	result.Delivered = len(latencies)
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	result.P50 = percentile(latencies, 50) //nolint:golint,gomnd
+	result.P90 = percentile(latencies, 90) //nolint:golint,gomnd
+	result.P99 = percentile(latencies, 99) //nolint:golint,gomnd
+	if len(latencies) > 0 {
+		result.Max = latencies[len(latencies)-1]
+	}
+	if result.Delivered < packets {
+		return result, ErrBenchmarkTimeout
+	}
+	return result, nil
+}
+
+// setupBenchmark creates the benchmark talkgroup and repeaters, logs both repeaters in at the
+// loopback socket and subscribes the sink to the talkgroup. The returned teardown undoes
+// whatever was set up, even if setup failed partway.
+func setupBenchmark(ctx context.Context, db *gorm.DB, redis *servers.RedisClient, ownerID uint, addr *net.UDPAddr) (func(), error) {
+	manager := GetSubscriptionManager(db)
+	talkgroupID := uint(benchmarkTalkgroup)
+	var steps []func()
+	teardown := func() {
+		for i := len(steps) - 1; i >= 0; i-- {
+			steps[i]()
+		}
+	}
+
+	// Clear anything left behind by a run that didn't finish
+	removeBenchmarkRows(db)
+
+	err := db.Create(&models.Talkgroup{ID: benchmarkTalkgroup, Name: benchmarkName}).Error
+	if err != nil {
+		return teardown, fmt.Errorf("failed to create benchmark talkgroup: %w", err)
+	}
+	steps = append(steps, func() { removeBenchmarkRows(db) })
+
+	repeaters := make([]models.Repeater, 0, 2) //nolint:golint,mnd
+	for _, id := range []uint{benchmarkSource, benchmarkSink} {
+		repeater := models.Repeater{OwnerID: ownerID, TS2DynamicTalkgroupID: &talkgroupID}
+		repeater.ID = id
+		repeater.Callsign = benchmarkCallsign
+		err := db.Create(&repeater).Error
+		if err != nil {
+			return teardown, fmt.Errorf("failed to create benchmark repeater %d: %w", id, err)
+		}
+		repeaters = append(repeaters, repeater)
+	}
+
+	for _, repeater := range repeaters {
+		repeater.Connection = "YES"
+		repeater.IP = addr.IP.String()
+		repeater.Port = addr.Port
+		redis.StoreRepeater(ctx, repeater.ID, repeater)
+		repeaterID := repeater.ID
+		steps = append(steps, func() { redis.DeleteRepeater(context.Background(), repeaterID) })
+	}
+
+	var confirmed sync.WaitGroup
+	manager.listenForRepeater(redis.Redis, repeaters[1], &confirmed)
+	// The subscriptions look the sink up as they close, so they go before its row is removed
+	steps = append(steps, func() { manager.CancelAllRepeaterSubscriptions(benchmarkSink) })
+	confirmed.Wait()
+	return teardown, nil
+}
+
+// removeBenchmarkRows deletes the benchmark repeaters and talkgroup. Rows with the same IDs
+// that the benchmark didn't create are left alone, and the benchmark then fails to start.
+func removeBenchmarkRows(db *gorm.DB) {
+	err := db.Unscoped().Where("id IN ? AND callsign = ?", []uint{benchmarkSource, benchmarkSink}, benchmarkCallsign).Delete(&models.Repeater{}).Error
+	if err != nil {
+		logging.Errorf("Error removing benchmark repeaters: %v", err)
+	}
+	err = db.Unscoped().Where("id = ? AND name = ?", benchmarkTalkgroup, benchmarkName).Delete(&models.Talkgroup{}).Error
+	if err != nil {
+		logging.Errorf("Error removing benchmark talkgroup: %v", err)
+	}
+}
+
+// percentile picks the nearest-rank percentile from sorted durations
+func percentile(sorted []time.Duration, pct int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (pct*len(sorted) + 99) / 100 //nolint:golint,gomnd
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/calltracker"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+)
+
+// Not parallel, see makeTestDB
+func TestRoutingBenchmarkUsesThePacketPath(t *testing.T) {
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.Call{}, &models.CallTelemetry{}, &models.DeferredData{}, &models.RepeaterGroup{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	db.Save(&models.User{ID: 3118602, Callsign: "N0BNCH", Username: "n0bnch", Admin: true, Approved: true})
+	_, redis := fakeredis.New(t)
+	redisClient := servers.MakeRedisClient(redis)
+	server := MakeServer(db, redis, redisClient, calltracker.NewCallTracker(db, redis), "test", "test")
+
+	// Start without the UDP ingress, the benchmark feeds the incoming queue itself
+	listeners, err := servers.ListenUDP("hbrp", []string{"127.0.0.1:0"}, bufferSize)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listeners.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server.Listeners = listeners
+	server.simulcast.write = func(data []byte, addr *net.UDPAddr) {
+		server.send(ctx, data, addr)
+	}
+	server.Started = true
+	go server.listen(ctx)
+	go server.subscribeRawPackets(ctx)
+
+	result, err := RunRoutingBenchmark(ctx, db, redis, 3118602, 20)
+	if err != nil {
+		t.Fatalf("Benchmark failed: %v, %+v", err, result)
+	}
+	if result.Delivered != 20 || result.P50 <= 0 || result.Max < result.P99 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	// Everything the benchmark made is gone afterwards
+	var count int64
+	db.Unscoped().Model(&models.Repeater{}).Where("id IN ?", []uint{benchmarkSource, benchmarkSink}).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected the benchmark repeaters to be removed, %d remain", count)
+	}
+	db.Unscoped().Model(&models.Talkgroup{}).Where("id = ?", benchmarkTalkgroup).Count(&count)
+	if count != 0 {
+		t.Error("Expected the benchmark talkgroup to be removed")
+	}
+	if redisClient.RepeaterExists(ctx, benchmarkSink) {
+		t.Error("Expected the sink to be logged out")
+	}
+	db.Model(&models.Call{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected benchmark calls not to be recorded, got %d", count)
+	}
+}
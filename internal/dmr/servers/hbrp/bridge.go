@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/routing"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/pubsub"
+	"github.com/USA-RedDragon/DMRHub/internal/repeaterlinks"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+)
+
+// doBridge forwards a packet to every repeater directly linked to its source on the packet's slot
+func (s *Server) doBridge(ctx context.Context, packet models.Packet, remoteAddr net.UDPAddr, data []byte) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "Server.doBridge")
+	defer span.End()
+
+	linked := repeaterlinks.Linked(packet.Repeater, packet.Slot, time.Now())
+	if len(linked) == 0 {
+		return
+	}
+
+	var rawPacket models.RawDMRPacket
+	rawPacket.Data = data
+	rawPacket.RemoteIP = remoteAddr.IP.String()
+	rawPacket.RemotePort = remoteAddr.Port
+	packedBytes, err := rawPacket.MarshalMsg(nil)
+	if err != nil {
+		logging.Errorf("Error marshalling raw packet: %v", err)
+		return
+	}
+	for _, repeaterID := range linked {
+		if packet.GroupCall && !GetSubscriptionManager(s.DB).allowedOnTalkgroup(repeaterID, packet.Dst) {
+			// A direct link doesn't carry a private talkgroup to a repeater that isn't allowed on it
+			continue
+		}
+		s.Redis.Redis.Publish(ctx, fmt.Sprintf("hbrp:packets:bridge:%d", repeaterID), packedBytes)
+	}
+}
+
+// bridged reports whether a packet from another repeater already reaches this one over a direct link
+func (m *SubscriptionManager) bridged(repeaterID uint, packet models.Packet, slot bool) bool {
+	if slot != packet.Slot {
+		return false
+	}
+	return repeaterlinks.Bridged(repeaterID, packet.Repeater, slot, time.Now())
+}
+
+// subscribeBridge delivers traffic from directly linked repeaters, keeping the slot it was heard on
+func (m *SubscriptionManager) subscribeBridge(ctx context.Context, redis *redis.Client, repeaterID uint, ready func()) {
+	if config.GetConfig().Debug {
+		logging.Logf("Listening for bridged calls on repeater %d", repeaterID)
+	}
+	subscription := redis.Subscribe(ctx, fmt.Sprintf("hbrp:packets:bridge:%d", repeaterID))
+	defer func() {
+		err := subscription.Unsubscribe(ctx, fmt.Sprintf("hbrp:packets:bridge:%d", repeaterID))
+		if err != nil {
+			logging.Errorf("Error unsubscribing from hbrp:packets:bridge:%d: %s", repeaterID, err)
+		}
+		err = subscription.Close()
+		if err != nil {
+			logging.Errorf("Error closing pubsub connection: %s", err)
+		}
+	}()
+	confirmSubscription(ctx, subscription, ready)
+	pubsubChannel := pubsub.Receive(ctx, subscription, "bridge")
+	var lastStreamID uint
+	for {
+		select {
+		case <-ctx.Done():
+			if config.GetConfig().Debug {
+				logging.Logf("Context canceled, stopping subscription to hbrp:packets:bridge:%d", repeaterID)
+			}
+			m.bridges.Delete(repeaterID)
+			return
+		case msg, ok := <-pubsubChannel:
+			if !ok {
+				// Closed once ctx is done, the case above cleans up
+				pubsubChannel = nil
+				continue
+			}
+			rawPacket := models.RawDMRPacket{}
+			_, err := rawPacket.UnmarshalMsg([]byte(msg.Payload))
+			if err != nil {
+				logging.Errorf("Failed to unmarshal raw packet: %s", err)
+				continue
+			}
+			packet, ok := models.UnpackPacket(rawPacket.Data)
+			if !ok {
+				logging.Errorf("Failed to unpack packet")
+				continue
+			}
+			if packet.Repeater == repeaterID {
+				continue
+			}
+			packet.Repeater = repeaterID
+			redis.Publish(ctx, "hbrp:outgoing:noaddr", packet.Encode())
+			if packet.StreamID != lastStreamID {
+				lastStreamID = packet.StreamID
+				routing.Record(ctx, redis, packet.StreamID, routing.Decision{Target: routing.TargetRepeater, TargetID: repeaterID, Delivered: true, Reason: routing.ReasonBridge, Timeslot: routing.Timeslot(packet.Slot)})
+			}
+		}
+	}
+}
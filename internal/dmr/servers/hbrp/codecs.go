@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"strings"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/codec"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/routing"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/redis/go-redis/v9"
+)
+
+// codecsOption is the RPTO option a repeater uses to list the codecs it can take besides AMBE,
+// such as CODECS=AMBE,CODEC2. Unknown codecs are ignored.
+const codecsOption = "CODECS"
+
+// parseCodecsOption finds the codecs a repeater can take in its semicolon separated options
+func parseCodecsOption(options string) (dmrconst.CodecSet, bool) {
+	for _, option := range strings.Split(options, ";") {
+		key, value, found := strings.Cut(strings.TrimSpace(option), "=")
+		if !found || !strings.EqualFold(strings.TrimSpace(key), codecsOption) {
+			continue
+		}
+		var codecs dmrconst.CodecSet
+		for _, name := range strings.Split(value, ",") {
+			if codec, ok := dmrconst.ParseCodec(strings.TrimSpace(name)); ok {
+				codecs = codecs.With(codec)
+			}
+		}
+		return codecs, true
+	}
+	return 0, false
+}
+
+// negotiateCodecs records the codecs a repeater said it can take in its options.
+// It lasts until the repeater disconnects.
+func (s *Server) negotiateCodecs(ctx context.Context, repeaterID uint, options string) {
+	codecs, ok := parseCodecsOption(options)
+	if !ok || !s.Redis.RepeaterExists(ctx, repeaterID) {
+		return
+	}
+	repeater, err := s.Redis.GetRepeater(ctx, repeaterID)
+	if err != nil {
+		logging.Errorf("Error getting repeater %d from Redis: %v", repeaterID, err)
+		return
+	}
+	repeater.Codecs = uint32(codecs)
+	s.Redis.StoreRepeater(ctx, repeaterID, repeater)
+}
+
+// codecStream is how a talkgroup subscription delivers the stream it's currently receiving
+type codecStream struct {
+	action     codec.Action
+	reason     routing.Reason
+	transcoder codec.Transcoder
+}
+
+// routeCodec decides how a new stream that isn't AMBE reaches a repeater, following the talkgroup's codec policy
+func (m *SubscriptionManager) routeCodec(ctx context.Context, redis *redis.Client, repeaterID uint, packet models.Packet) codecStream {
+	if packet.Codec == dmrconst.CodecAMBE {
+		return codecStream{action: codec.Deliver}
+	}
+	policy, err := models.FindTalkgroupCodecPolicy(m.db, packet.Dst)
+	if err != nil {
+		logging.Errorf("Error finding talkgroup %d codec policy: %s", packet.Dst, err)
+		return codecStream{action: codec.Drop, reason: routing.ReasonCodecBlocked}
+	}
+	var takes dmrconst.CodecSet
+	redisClient := servers.MakeRedisClient(redis)
+	if redisClient.RepeaterExists(ctx, repeaterID) {
+		repeater, err := redisClient.GetRepeater(ctx, repeaterID)
+		if err != nil {
+			logging.Errorf("Error getting repeater %d from Redis: %v", repeaterID, err)
+		}
+		takes = dmrconst.CodecSet(repeater.Codecs)
+	}
+	action, reason := codec.Route(policy, packet.Codec, takes)
+	stream := codecStream{action: action, reason: reason}
+	if action == codec.Transcode {
+		transcoder, ok := codec.NewTranscoder(packet.Codec, dmrconst.CodecAMBE)
+		if !ok {
+			// The transcoder was unregistered since Route looked
+			return codecStream{action: codec.Drop, reason: routing.ReasonCodecUnsupported}
+		}
+		stream.transcoder = transcoder
+	}
+	return stream
+}
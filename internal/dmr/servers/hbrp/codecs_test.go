@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+)
+
+func TestParseCodecsOption(t *testing.T) {
+	t.Parallel()
+	codec2 := dmrconst.CodecSet(0).With(dmrconst.CodecCodec2)
+	tests := []struct {
+		options string
+		codecs  dmrconst.CodecSet
+		ok      bool
+	}{
+		{"CODECS=AMBE,CODEC2", codec2, true},
+		{"TS1=1,2;codecs = codec2 ;KEEPALIVE=15", codec2, true},
+		{"CODECS=AMBE", 0, true},
+		{"CODECS=OPUS,CODEC2", codec2, true},
+		{"KEEPALIVE=15", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		codecs, ok := parseCodecsOption(tt.options)
+		if codecs != tt.codecs || ok != tt.ok {
+			t.Errorf("parseCodecsOption(%q) = %b, %v; expected %b, %v", tt.options, codecs, ok, tt.codecs, tt.ok)
+		}
+	}
+}
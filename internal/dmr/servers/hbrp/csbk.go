@@ -0,0 +1,195 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/csbk"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/routing"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"go.opentelemetry.io/otel"
+)
+
+// users have 7 digit IDs, repeaters have 6 digit IDs or 9 digit IDs
+const (
+	rptIDMin     = 100000
+	rptIDMax     = 999999
+	hotspotIDMin = 100000000
+	hotspotIDMax = 999999999
+	userIDMin    = 1000000
+	userIDMax    = 9999999
+)
+
+func isCSBK(packet models.Packet) bool {
+	return packet.FrameType == dmrconst.FrameDataSync && dmrconst.DataType(packet.DTypeOrVSeq) == dmrconst.DTypeCSBK
+}
+
+// doPrivate routes a private packet to its destination.
+// packet.Dst is either a repeater or a user
+// If it's a repeater, we need to send it to the repeater
+// If it's a user, we need to send it to the repeater that the user is connected to
+// by looking up the user in the database and iterating through their repeaters
+func (s *Server) doPrivate(ctx context.Context, packet models.Packet, remoteAddr net.UDPAddr, data []byte, newStream bool) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "Server.doPrivate")
+	defer span.End()
+
+	var rawPacket models.RawDMRPacket
+	rawPacket.Data = data
+	rawPacket.RemoteIP = remoteAddr.IP.String()
+	rawPacket.RemotePort = remoteAddr.Port
+
+	packedBytes, err := rawPacket.MarshalMsg(nil)
+	if err != nil {
+		logging.Errorf("Error marshalling raw packet: %v", err)
+		return
+	}
+
+	isCallout, err := models.CalloutGroupIDExists(s.DB, packet.Dst)
+	if err != nil {
+		logging.Errorf("Error checking if callout group exists: %s", err)
+	}
+	if isCallout {
+		s.doCallout(ctx, packet, packedBytes, newStream)
+		return
+	}
+
+	if (packet.Dst >= rptIDMin && packet.Dst <= rptIDMax) || (packet.Dst >= hotspotIDMin && packet.Dst <= hotspotIDMax) {
+		// This is to a repeater
+		exists, err := models.RepeaterIDExists(s.DB, packet.Dst)
+		if err != nil {
+			logging.Errorf("Error checking if repeater exists: %s", err)
+		}
+		if !exists {
+			logging.Errorf("Repeater %d does not exist", packet.Dst)
+			if newStream {
+				routing.Record(ctx, s.Redis.Redis, packet.StreamID, routing.Decision{Target: routing.TargetRepeater, TargetID: packet.Dst, Reason: routing.ReasonUnknownRepeater})
+				s.rejectStream(ctx, packet.Repeater, packet.StreamID, routing.ReasonUnknownRepeater)
+			}
+			return
+		}
+		if newStream && !s.Redis.RepeaterExists(ctx, packet.Dst) {
+			routing.Record(ctx, s.Redis.Redis, packet.StreamID, routing.Decision{Target: routing.TargetRepeater, TargetID: packet.Dst, Reason: routing.ReasonOffline})
+		}
+		s.Redis.Redis.Publish(ctx, fmt.Sprintf("hbrp:packets:repeater:%d", packet.Dst), packedBytes)
+	} else if packet.Dst >= userIDMin && packet.Dst <= userIDMax {
+		exists, err := models.UserIDExists(s.DB, packet.Dst)
+		if err != nil {
+			logging.Errorf("Error checking if user exists: %s", err)
+			return
+		}
+		if !exists {
+			logging.Errorf("User %d does not exist", packet.Dst)
+			if newStream {
+				routing.Record(ctx, s.Redis.Redis, packet.StreamID, routing.Decision{Target: routing.TargetUser, TargetID: packet.Dst, Reason: routing.ReasonUnknownUser})
+				s.rejectStream(ctx, packet.Repeater, packet.StreamID, routing.ReasonUnknownUser)
+			}
+			return
+		}
+		if newStream {
+			routing.Record(ctx, s.Redis.Redis, packet.StreamID, routing.Decision{Target: routing.TargetUser, TargetID: packet.Dst, Delivered: true, Reason: routing.ReasonPrivate})
+		}
+		s.doUser(ctx, packet, packedBytes)
+	}
+}
+
+// doCallout fans a private call to a callout group out to the repeater each member was last heard on
+func (s *Server) doCallout(ctx context.Context, packet models.Packet, packedBytes []byte, newStream bool) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "Server.doCallout")
+	defer span.End()
+
+	repeaters, err := models.FindCalloutRepeaters(s.DB, packet.Dst)
+	if err != nil {
+		logging.Errorf("Error finding repeaters for callout group %d: %v", packet.Dst, err)
+		return
+	}
+
+	var decisions []routing.Decision
+	delivered := false
+	for _, repeaterID := range repeaters {
+		// The calling repeater already carries the call over the air
+		if repeaterID == packet.Repeater {
+			continue
+		}
+		online := s.Redis.RepeaterExists(ctx, repeaterID)
+		if newStream {
+			reason := routing.ReasonCallout
+			if !online {
+				reason = routing.ReasonOffline
+			}
+			decisions = append(decisions, routing.Decision{Target: routing.TargetRepeater, TargetID: repeaterID, Delivered: online, Reason: reason})
+		}
+		if online {
+			delivered = true
+			s.Redis.Redis.Publish(ctx, fmt.Sprintf("hbrp:packets:repeater:%d", repeaterID), packedBytes)
+		}
+	}
+	if newStream {
+		decisions = append(decisions, routing.Decision{Target: routing.TargetCallout, TargetID: packet.Dst, Delivered: delivered, Reason: routing.ReasonCallout})
+		routing.Record(ctx, s.Redis.Redis, packet.StreamID, decisions...)
+	}
+}
+
+// doServiceCSBK answers radio checks and call alerts sent to the hub itself
+// so that users can confirm their radio is reaching the network.
+func (s *Server) doServiceCSBK(ctx context.Context, packet models.Packet, repeaterID uint) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "Server.doServiceCSBK")
+	defer span.End()
+
+	request, err := csbk.FromBurst(packet.DMRData)
+	if err != nil {
+		logging.Errorf("Error decoding CSBK from %d: %v", packet.Src, err)
+		return
+	}
+
+	ack, ok := request.Ack()
+	if !ok {
+		if config.GetConfig().Debug {
+			logging.Logf("Ignoring CSBK opcode 0x%02X from %d", request.Opcode, packet.Src)
+		}
+		return
+	}
+
+	var streamID [4]byte
+	_, err = rand.Read(streamID[:])
+	if err != nil {
+		logging.Errorf("Error generating stream ID: %v", err)
+		return
+	}
+
+	response := packet
+	response.Src = packet.Dst
+	response.Dst = packet.Src
+	response.Repeater = repeaterID
+	response.Seq = 0
+	response.StreamID = uint(binary.BigEndian.Uint32(streamID[:]))
+	response.BER = -1
+	response.RSSI = -1
+	response.DMRData = ack.ToBurst(packet.DMRData)
+
+	s.sendPacket(ctx, repeaterID, response)
+}
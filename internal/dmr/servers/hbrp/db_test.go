@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+var (
+	testDBOnce sync.Once
+	testDB     *gorm.DB
+	testDBErr  error
+)
+
+// makeTestDB returns the package's shared test database. The subscription manager
+// is a singleton that keeps the database it was first made with, so every test
+// that reaches it has to use the same one. Tests that use it don't run in
+// parallel, so they get to the subscription manager before the parallel tests do.
+func makeTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	testDBOnce.Do(func() {
+		testDB, testDBErr = gorm.Open(sqlite.Open(""), &gorm.Config{})
+		if testDBErr != nil {
+			return
+		}
+		sqlDB, err := testDB.DB()
+		if err != nil {
+			testDBErr = err
+			return
+		}
+		// Every connection to an unnamed database gets its own, so the
+		// subscription manager's goroutines have to share the one connection
+		sqlDB.SetMaxOpenConns(1)
+		testDBErr = testDB.AutoMigrate(&models.User{}, &models.TalkgroupCategory{}, &models.Talkgroup{}, &models.TalkgroupAllowedRepeater{}, &models.Repeater{})
+	})
+	if testDBErr != nil {
+		t.Fatalf("Failed to make test database: %v", testDBErr)
+	}
+	if GetSubscriptionManager(testDB).db != testDB {
+		t.Fatal("The subscription manager was made without the test database")
+	}
+	return testDB
+}
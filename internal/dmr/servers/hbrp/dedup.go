@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/puzpuzpuz/xsync/v3"
+)
+
+// dedupWindow is how long a burst is remembered. The one byte sequence number wraps every
+// 256 bursts, about 15 seconds of voice, so the window must stay well under that.
+const dedupWindow = 5 * time.Second
+
+// dedupIdle is how long a stream may go without packets before its state is dropped
+const dedupIdle = 10 * time.Second
+
+//nolint:golint,gochecknoglobals
+var duplicatesDropped = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dmrhub_hbrp_duplicate_packets_total",
+	Help: "DMRD bursts dropped because the repeater already sent them, such as from behind a flapping NAT",
+})
+
+type dedupKey struct {
+	repeaterID uint
+	streamID   uint
+}
+
+// seenBurst is a burst's position in the superframe and its payload
+type seenBurst struct {
+	at        time.Time
+	frameType dmrconst.FrameType
+	position  uint
+	payload   [33]byte
+}
+
+func (b *seenBurst) matches(other seenBurst) bool {
+	return !b.at.IsZero() && other.at.Sub(b.at) < dedupWindow &&
+		b.frameType == other.frameType && b.position == other.position && b.payload == other.payload
+}
+
+type dedupStream struct {
+	mu       sync.Mutex
+	bursts   [256]seenBurst
+	last     seenBurst
+	lastSeq  uint
+	fixedSeq bool
+	lastSeen time.Time
+}
+
+// packetDeduper drops DMRD bursts a repeater delivers more than once. Hotspots behind NATs that
+// flap between source ports can send the same burst twice, and routing both would double syllables
+// on every repeater downstream. A burst is a duplicate if the same stream sent a burst with the same
+// sequence number, superframe position and payload within the window.
+//
+// Some clients never increment the sequence number. Once a stream sends a new burst under the
+// sequence number of the one before it, only an exact repeat of its previous burst is dropped, so
+// recurring bursts like silence aren't mistaken for duplicates.
+type packetDeduper struct {
+	streams *xsync.MapOf[dedupKey, *dedupStream]
+}
+
+func newPacketDeduper() *packetDeduper {
+	return &packetDeduper{
+		streams: xsync.NewMapOf[dedupKey, *dedupStream](),
+	}
+}
+
+// duplicate reports whether the packet was already seen from this repeater, counting it if so
+func (d *packetDeduper) duplicate(repeaterID uint, packet models.Packet, now time.Time) bool {
+	key := dedupKey{repeaterID: repeaterID, streamID: packet.StreamID}
+	stream, loaded := d.streams.LoadOrCompute(key, func() *dedupStream {
+		return &dedupStream{lastSeen: now}
+	})
+	if !loaded {
+		d.sweep(now)
+	}
+
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	first := stream.last.at.IsZero()
+	stream.lastSeen = now
+	burst := seenBurst{at: now, frameType: packet.FrameType, position: packet.DTypeOrVSeq, payload: packet.DMRData}
+
+	seen := &stream.last
+	if !stream.fixedSeq {
+		seen = &stream.bursts[packet.Seq&0xff]
+	}
+	if seen.matches(burst) {
+		duplicatesDropped.Inc()
+		return true
+	}
+	if !first && packet.Seq == stream.lastSeq {
+		stream.fixedSeq = true
+	}
+	*seen = burst
+	stream.last = burst
+	stream.lastSeq = packet.Seq
+	return false
+}
+
+// sweep drops streams that have ended
+func (d *packetDeduper) sweep(now time.Time) {
+	d.streams.Range(func(key dedupKey, stream *dedupStream) bool {
+		stream.mu.Lock()
+		idle := now.Sub(stream.lastSeen) > dedupIdle
+		stream.mu.Unlock()
+		if idle {
+			d.streams.Delete(key)
+		}
+		return true
+	})
+}
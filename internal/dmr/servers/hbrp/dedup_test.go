@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+)
+
+func TestDeduperDropsRepeatedBursts(t *testing.T) {
+	t.Parallel()
+	d := newPacketDeduper()
+	now := time.Now()
+	packet := models.Packet{StreamID: 1234, Seq: 5}
+	packet.DMRData[0] = 0xAA
+
+	if d.duplicate(1, packet, now) {
+		t.Fatal("Expected the first burst through")
+	}
+	if !d.duplicate(1, packet, now.Add(20*time.Millisecond)) {
+		t.Error("Expected the repeated burst to be dropped")
+	}
+	if d.duplicate(2, packet, now.Add(20*time.Millisecond)) {
+		t.Error("Expected the same burst from another repeater through")
+	}
+	packet.Seq = 6
+	if d.duplicate(1, packet, now.Add(60*time.Millisecond)) {
+		t.Error("Expected the next burst through")
+	}
+}
+
+func TestDeduperAllowsSequenceReuse(t *testing.T) {
+	t.Parallel()
+	d := newPacketDeduper()
+	now := time.Now()
+	packet := models.Packet{StreamID: 1234, Seq: 0}
+
+	if d.duplicate(1, packet, now) {
+		t.Fatal("Expected the first burst through")
+	}
+	// A client that never increments the sequence number still sends new audio
+	packet.DMRData[0] = 0x01
+	if d.duplicate(1, packet, now.Add(60*time.Millisecond)) {
+		t.Error("Expected a burst with new payload through")
+	}
+	// After the sequence number wraps, the same seq and payload is a new burst
+	if d.duplicate(1, packet, now.Add(dedupWindow+time.Second)) {
+		t.Error("Expected a burst outside the window through")
+	}
+}
+
+func TestDeduperFixedSequenceSilence(t *testing.T) {
+	t.Parallel()
+	d := newPacketDeduper()
+	now := time.Now()
+	// Two superframes of identical silence from a client that never increments the sequence number
+	for i := range 12 {
+		packet := models.Packet{StreamID: 1234, FrameType: dmrconst.FrameVoice, DTypeOrVSeq: uint(i % 6)}
+		if i%6 == 0 {
+			packet.FrameType = dmrconst.FrameVoiceSync
+		}
+		at := now.Add(time.Duration(i) * 60 * time.Millisecond)
+		if d.duplicate(1, packet, at) {
+			t.Fatalf("Expected silence burst %d through", i)
+		}
+		if i == 11 && !d.duplicate(1, packet, at.Add(time.Millisecond)) {
+			t.Error("Expected an immediate repeat of the last burst to be dropped")
+		}
+	}
+}
+
+func TestDeduperSweepsIdleStreams(t *testing.T) {
+	t.Parallel()
+	d := newPacketDeduper()
+	now := time.Now()
+	d.duplicate(1, models.Packet{StreamID: 1}, now)
+	d.duplicate(1, models.Packet{StreamID: 2}, now.Add(dedupIdle+time.Second))
+	if _, ok := d.streams.Load(dedupKey{repeaterID: 1, streamID: 1}); ok {
+		t.Error("Expected the idle stream to be swept")
+	}
+	if d.streams.Size() != 1 {
+		t.Errorf("Expected 1 tracked stream, got %d", d.streams.Size())
+	}
+}
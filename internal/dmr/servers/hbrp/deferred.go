@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"go.opentelemetry.io/otel"
+)
+
+// Held data is replayed at the pace bursts arrive over the air so hotspots aren't flooded
+const deferredBurstInterval = 60 * time.Millisecond
+
+func isRepeaterID(id uint) bool {
+	return (id >= rptIDMin && id <= rptIDMax) || (id >= hotspotIDMin && id <= hotspotIDMax)
+}
+
+// doPrivateData routes a private data call, such as an SMS. If the destination
+// is offline the call is held and delivered when it reconnects.
+func (s *Server) doPrivateData(ctx context.Context, packet models.Packet, remoteAddr net.UDPAddr, data []byte) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "Server.doPrivateData")
+	defer span.End()
+
+	limit := config.GetConfig().DeferredDataLimit
+	online, known := s.destinationOnline(ctx, packet.Dst)
+	if limit == 0 || online || !known {
+		// Unknown destinations are logged and recorded by doPrivate
+		s.doPrivate(ctx, packet, remoteAddr, data, false)
+		return
+	}
+
+	var rawPacket models.RawDMRPacket
+	rawPacket.Data = data
+	rawPacket.RemoteIP = remoteAddr.IP.String()
+	rawPacket.RemotePort = remoteAddr.Port
+	packedBytes, err := rawPacket.MarshalMsg(nil)
+	if err != nil {
+		logging.Errorf("Error marshalling raw packet: %v", err)
+		return
+	}
+	now := time.Now()
+	err = models.QueueDeferredData(s.DB, models.DeferredData{
+		StreamID:      packet.StreamID,
+		Source:        packet.Src,
+		DestinationID: packet.Dst,
+		ToRepeater:    isRepeaterID(packet.Dst),
+		Packet:        packedBytes,
+		QueuedAt:      now,
+		ExpiresAt:     now.Add(config.GetConfig().DeferredDataTTL),
+	}, limit)
+	switch {
+	case errors.Is(err, models.ErrDeferredDataFull):
+		logging.Errorf("Dropping data from %d, too much is already held for offline destination %d", packet.Src, packet.Dst)
+	case err != nil:
+		logging.Errorf("Error holding data for offline destination %d: %v", packet.Dst, err)
+	}
+}
+
+// destinationOnline reports whether a private call destination can be reached now,
+// and whether it's a known repeater or user at all
+func (s *Server) destinationOnline(ctx context.Context, destination uint) (online bool, known bool) {
+	if isRepeaterID(destination) {
+		exists, err := models.RepeaterIDExists(s.DB, destination)
+		if err != nil {
+			logging.Errorf("Error checking if repeater exists: %s", err)
+			return false, false
+		}
+		return exists && s.Redis.RepeaterExists(ctx, destination), exists
+	}
+	if destination < userIDMin || destination > userIDMax {
+		return false, false
+	}
+	exists, err := models.UserIDExists(s.DB, destination)
+	if err != nil || !exists {
+		return false, false
+	}
+	user, err := models.FindUserByID(s.DB, destination)
+	if err != nil {
+		logging.Errorf("Error finding user: %s", err)
+		return false, false
+	}
+	return len(s.userCandidates(ctx, user)) > 0, true
+}
+
+// deliverDeferred sends data held for a repeater, or for users now reachable through it
+func (s *Server) deliverDeferred(ctx context.Context, repeaterID uint) {
+	if config.GetConfig().DeferredDataLimit == 0 {
+		return
+	}
+	now := time.Now()
+	s.sendDeferred(ctx, repeaterID, repeaterID, true, now)
+
+	users, err := models.ListDeferredUsers(s.DB, now)
+	if err != nil {
+		logging.Errorf("Error listing users with held data: %v", err)
+		return
+	}
+	for _, userID := range users {
+		user, err := models.FindUserByID(s.DB, userID)
+		if err != nil {
+			logging.Errorf("Error finding user: %s", err)
+			continue
+		}
+		if slices.Contains(s.userCandidates(ctx, user), repeaterID) {
+			s.sendDeferred(ctx, repeaterID, userID, false, now)
+		}
+	}
+}
+
+// deliverDeferredToUser sends data held for a user to the repeater they were just heard on
+func (s *Server) deliverDeferredToUser(ctx context.Context, userID uint, repeaterID uint) {
+	if config.GetConfig().DeferredDataLimit == 0 {
+		return
+	}
+	now := time.Now()
+	waiting, err := models.HasDeferredData(s.DB, userID, false, now)
+	if err != nil {
+		logging.Errorf("Error checking for data held for user %d: %v", userID, err)
+		return
+	}
+	if waiting {
+		s.sendDeferred(ctx, repeaterID, userID, false, now)
+	}
+}
+
+func (s *Server) sendDeferred(ctx context.Context, repeaterID uint, destinationID uint, toRepeater bool, now time.Time) {
+	held, err := models.TakeDeferredData(s.DB, destinationID, toRepeater, now)
+	if err != nil {
+		logging.Errorf("Error taking data held for %d: %v", destinationID, err)
+		return
+	}
+	if len(held) == 0 {
+		return
+	}
+	logging.Logf("Delivering %d held data packets for %d to repeater %d", len(held), destinationID, repeaterID)
+	for i, data := range held {
+		if i > 0 {
+			time.Sleep(deferredBurstInterval)
+		}
+		s.Redis.Redis.Publish(ctx, fmt.Sprintf("hbrp:packets:repeater:%d", repeaterID), data.Packet)
+	}
+}
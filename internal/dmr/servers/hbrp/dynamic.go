@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/redis/go-redis/v9"
+)
+
+// LinkDynamicTalkgroup sets a slot's dynamic talkgroup and subscribes the repeater to it.
+// Keying up a talkgroup on RF and linking from the API both go through here.
+// It reports whether the slot changed, linking the talkgroup already on it is a no-op.
+func (m *SubscriptionManager) LinkDynamicTalkgroup(redis *redis.Client, repeater *models.Repeater, talkgroup models.Talkgroup, slot dmrconst.Timeslot) (bool, error) {
+	current := repeater.TS1DynamicTalkgroupID
+	if slot == dmrconst.TimeslotTwo {
+		current = repeater.TS2DynamicTalkgroupID
+	}
+	if current != nil && *current == talkgroup.ID {
+		return false, nil
+	}
+
+	logging.Logf("Dynamically Linking %d timeslot %d to %d", repeater.ID, slot, talkgroup.ID)
+	talkgroupID := talkgroup.ID
+	if slot == dmrconst.TimeslotTwo {
+		repeater.TS2DynamicTalkgroup = talkgroup
+		repeater.TS2DynamicTalkgroupID = &talkgroupID
+	} else {
+		repeater.TS1DynamicTalkgroup = talkgroup
+		repeater.TS1DynamicTalkgroupID = &talkgroupID
+	}
+	go m.ListenForCallsOn(redis, repeater.ID, talkgroupID)
+	err := m.db.Save(repeater).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to save repeater: %w", err)
+	}
+	go m.pushTalkgroups(context.Background(), redis, repeater.ID)
+	return true, nil
+}
+
+// UnlinkDynamicTalkgroup clears a slot's dynamic talkgroup and cancels its subscription.
+// It reports whether a talkgroup was linked.
+func (m *SubscriptionManager) UnlinkDynamicTalkgroup(redis *redis.Client, repeater *models.Repeater, slot dmrconst.Timeslot) (bool, error) {
+	column := "TS1DynamicTalkgroupID"
+	current := repeater.TS1DynamicTalkgroupID
+	if slot == dmrconst.TimeslotTwo {
+		column = "TS2DynamicTalkgroupID"
+		current = repeater.TS2DynamicTalkgroupID
+	}
+	logging.Logf("Unlinking timeslot %d from %d", slot, repeater.ID)
+	if current == nil {
+		return false, nil
+	}
+
+	oldTGID := *current
+	err := m.db.Model(repeater).Select(column).Updates(map[string]interface{}{column: nil}).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to clear %s: %w", column, err)
+	}
+	if slot == dmrconst.TimeslotTwo {
+		repeater.TS2DynamicTalkgroup = models.Talkgroup{}
+		repeater.TS2DynamicTalkgroupID = nil
+	} else {
+		repeater.TS1DynamicTalkgroup = models.Talkgroup{}
+		repeater.TS1DynamicTalkgroupID = nil
+	}
+	m.CancelSubscription(repeater.ID, oldTGID, slot)
+	go m.pushTalkgroups(context.Background(), redis, repeater.ID)
+	return true, nil
+}
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+	"github.com/puzpuzpuz/xsync/v3"
+)
+
+func subscribed(m *SubscriptionManager, repeaterID uint, talkgroupID uint) bool {
+	subs, ok := m.subscriptions.Load(repeaterID)
+	if !ok {
+		return false
+	}
+	_, ok = subs.Load(talkgroupID)
+	return ok
+}
+
+func waitSubscribed(t *testing.T, m *SubscriptionManager, repeaterID uint, talkgroupID uint, want bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for subscribed(m, repeaterID, talkgroupID) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected repeater %d subscribed to %d to be %v", repeaterID, talkgroupID, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Not parallel, see makeTestDB
+func TestDynamicLinkAndUnlink(t *testing.T) {
+	db := makeTestDB(t)
+	_, redis := fakeredis.New(t)
+	m := GetSubscriptionManager(db)
+
+	owner := models.User{ID: 3118606, Callsign: "N0DYN", Username: "n0dyn", Approved: true}
+	db.Save(&owner)
+	talkgroup := models.Talkgroup{ID: 3106, Name: "Dynamic"}
+	db.Save(&talkgroup)
+	repeater := models.Repeater{OwnerID: owner.ID}
+	repeater.ID = 311860601
+	if err := db.Create(&repeater).Error; err != nil {
+		t.Fatalf("Failed to create repeater: %v", err)
+	}
+	// The repeater is connected, so it has a set of subscriptions
+	m.subscriptions.LoadOrStore(repeater.ID, xsync.NewMapOf[uint, *context.CancelFunc]())
+	t.Cleanup(func() { m.CancelAllRepeaterSubscriptions(repeater.ID) })
+
+	changed, err := m.LinkDynamicTalkgroup(redis, &repeater, talkgroup, dmrconst.TimeslotTwo)
+	if err != nil || !changed {
+		t.Fatalf("Expected the link to change TS2, got %v, %v", changed, err)
+	}
+	found, _ := models.FindRepeaterByID(db, repeater.ID)
+	if found.TS2DynamicTalkgroupID == nil || *found.TS2DynamicTalkgroupID != talkgroup.ID {
+		t.Errorf("Expected TS2 to be linked to %d in the database, got %v", talkgroup.ID, found.TS2DynamicTalkgroupID)
+	}
+	waitSubscribed(t, m, repeater.ID, talkgroup.ID, true)
+
+	changed, err = m.LinkDynamicTalkgroup(redis, &repeater, talkgroup, dmrconst.TimeslotTwo)
+	if err != nil || changed {
+		t.Errorf("Expected linking the same talkgroup to be a no-op, got %v, %v", changed, err)
+	}
+
+	// With both slots on the talkgroup, unlinking one keeps the subscription
+	if _, err := m.LinkDynamicTalkgroup(redis, &repeater, talkgroup, dmrconst.TimeslotOne); err != nil {
+		t.Fatal(err)
+	}
+	changed, err = m.UnlinkDynamicTalkgroup(redis, &repeater, dmrconst.TimeslotTwo)
+	if err != nil || !changed {
+		t.Fatalf("Expected the unlink to change TS2, got %v, %v", changed, err)
+	}
+	if !subscribed(m, repeater.ID, talkgroup.ID) {
+		t.Error("Expected the subscription to stay while TS1 is linked")
+	}
+
+	changed, err = m.UnlinkDynamicTalkgroup(redis, &repeater, dmrconst.TimeslotOne)
+	if err != nil || !changed {
+		t.Fatalf("Expected the unlink to change TS1, got %v, %v", changed, err)
+	}
+	waitSubscribed(t, m, repeater.ID, talkgroup.ID, false)
+	found, _ = models.FindRepeaterByID(db, repeater.ID)
+	if found.TS1DynamicTalkgroupID != nil || found.TS2DynamicTalkgroupID != nil {
+		t.Errorf("Expected both slots to be unlinked in the database, got %v and %v", found.TS1DynamicTalkgroupID, found.TS2DynamicTalkgroupID)
+	}
+
+	changed, err = m.UnlinkDynamicTalkgroup(redis, &repeater, dmrconst.TimeslotOne)
+	if err != nil || changed {
+		t.Errorf("Expected unlinking an empty slot to be a no-op, got %v, %v", changed, err)
+	}
+}
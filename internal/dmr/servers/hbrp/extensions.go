@@ -0,0 +1,209 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"strings"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/routing"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/redis/go-redis/v9"
+)
+
+// DMRHub-aware hotspot firmware can negotiate extensions on top of the MMDVM protocol.
+//
+// The hub advertises the extensions it supports in an extension block after the salt in
+// its RPTACK to RPTL. Standard clients only read the salt and ignore the rest. A client that
+// wants extensions appends an extension block listing them to its 302 byte RPTC, and the hub
+// answers with the granted set in an extension block after the repeater ID in its RPTACK.
+// Clients that send a standard RPTC never receive any of the extension commands.
+//
+// An extension block is ExtensionMagic, a version byte, and a big endian uint32 of Extension bits.
+//
+// A hotspot that negotiated ExtensionFailover is sent a DHFO after connecting, listing the
+// HBRP_FAILOVER_MASTERS to try if this one stops answering. It can then resume its session
+// on one of them with a DHFL instead of logging in again, see handleDHFLPacket.
+const extensionBlockLength = dmrconst.ExtensionBlockLength
+
+// maxStatusMessageLength keeps a DHMS within what a hotspot display can show
+const maxStatusMessageLength = 80
+
+var (
+	ErrExtensionNotNegotiated = errors.New("repeater did not negotiate this extension")
+	ErrStatusMessageTooLong   = errors.New("status message is too long")
+)
+
+// extensionBlock encodes an extension block for the given extensions
+func extensionBlock(extensions dmrconst.Extension) []byte {
+	block := make([]byte, 0, extensionBlockLength)
+	block = append(block, dmrconst.ExtensionMagic...)
+	block = append(block, dmrconst.ExtensionVersion)
+	return binary.BigEndian.AppendUint32(block, uint32(extensions))
+}
+
+// parseExtensionBlock decodes an extension block, reporting false if it isn't one.
+// Blocks from older and newer versions are accepted, as the bits they share keep their meaning.
+func parseExtensionBlock(block []byte) (dmrconst.Extension, bool) {
+	if len(block) != extensionBlockLength || string(block[:len(dmrconst.ExtensionMagic)]) != dmrconst.ExtensionMagic {
+		return 0, false
+	}
+	if block[len(dmrconst.ExtensionMagic)] < dmrconst.MinExtensionVersion {
+		return 0, false
+	}
+	return dmrconst.Extension(binary.BigEndian.Uint32(block[len(dmrconst.ExtensionMagic)+1:])), true
+}
+
+// advertisedExtensions is what the hub offers in its RPTACK to RPTL
+func advertisedExtensions() dmrconst.Extension {
+	if config.GetConfig().HBRPDisableExtensions {
+		return 0
+	}
+	if len(config.GetConfig().HBRPFailoverMasters) == 0 {
+		// There's nowhere to send a hotspot, so don't offer it
+		return dmrconst.ExtensionsSupported &^ dmrconst.ExtensionFailover
+	}
+	return dmrconst.ExtensionsSupported
+}
+
+// negotiateExtensions grants the requested extensions that the hub supports
+func negotiateExtensions(requested dmrconst.Extension) dmrconst.Extension {
+	return requested & advertisedExtensions()
+}
+
+// publishCommand queues a command to a connected repeater
+func publishCommand(ctx context.Context, redis *redis.Client, repeater models.Repeater, command dmrconst.Command, data []byte) {
+	p := models.RawDMRPacket{
+		Data:       append([]byte(command), data...),
+		RemoteIP:   repeater.IP,
+		RemotePort: repeater.Port,
+	}
+	packedBytes, err := p.MarshalMsg(nil)
+	if err != nil {
+		logging.Errorf("Error marshalling packet: %v", err)
+		return
+	}
+	redis.Publish(ctx, "hbrp:outgoing", packedBytes)
+}
+
+// sendExtension sends an extension command if the repeater is connected and negotiated it
+func sendExtension(ctx context.Context, redis *servers.RedisClient, repeaterID uint, extension dmrconst.Extension, command dmrconst.Command, payload []byte) bool {
+	if !redis.RepeaterExists(ctx, repeaterID) {
+		return false
+	}
+	repeater, err := redis.GetRepeater(ctx, repeaterID)
+	if err != nil {
+		logging.Errorf("Error getting repeater %d from Redis: %v", repeaterID, err)
+		return false
+	}
+	if repeater.Connection != "YES" || dmrconst.Extension(repeater.Extensions)&extension == 0 {
+		return false
+	}
+	data := binary.BigEndian.AppendUint32(nil, uint32(repeaterID))
+	publishCommand(ctx, redis.Redis, repeater, command, append(data, payload...))
+	return true
+}
+
+// talkgroupListPayload lists a repeater's talkgroups for DHTG as 6 byte entries:
+// the timeslot, 1 if the talkgroup is dynamic or 0 if static, and the big endian talkgroup ID
+func talkgroupListPayload(repeater models.Repeater) []byte {
+	const entryLength = 6
+	entries := len(repeater.TS1StaticTalkgroups) + len(repeater.TS2StaticTalkgroups) + 2
+	payload := make([]byte, 0, entries*entryLength)
+	add := func(slot dmrconst.Timeslot, dynamic bool, talkgroupID uint) {
+		kind := byte(0)
+		if dynamic {
+			kind = 1
+		}
+		payload = append(payload, byte(slot), kind)
+		payload = binary.BigEndian.AppendUint32(payload, uint32(talkgroupID))
+	}
+	for _, tg := range repeater.TS1StaticTalkgroups {
+		add(dmrconst.TimeslotOne, false, tg.ID)
+	}
+	for _, tg := range repeater.TS2StaticTalkgroups {
+		add(dmrconst.TimeslotTwo, false, tg.ID)
+	}
+	if repeater.TS1DynamicTalkgroupID != nil {
+		add(dmrconst.TimeslotOne, true, *repeater.TS1DynamicTalkgroupID)
+	}
+	if repeater.TS2DynamicTalkgroupID != nil {
+		add(dmrconst.TimeslotTwo, true, *repeater.TS2DynamicTalkgroupID)
+	}
+	return payload
+}
+
+// pushTalkgroups sends a repeater its current talkgroups if it negotiated ExtensionTalkgroupList
+func (m *SubscriptionManager) pushTalkgroups(ctx context.Context, redis *redis.Client, repeaterID uint) {
+	redisClient := servers.MakeRedisClient(redis)
+	if !redisClient.RepeaterExists(ctx, repeaterID) {
+		return
+	}
+	repeater, err := models.FindRepeaterByID(m.db, repeaterID)
+	if err != nil {
+		logging.Errorf("Failed to find repeater %d: %s", repeaterID, err)
+		return
+	}
+	sendExtension(ctx, redisClient, repeaterID, dmrconst.ExtensionTalkgroupList, dmrconst.CommandDHTG, talkgroupListPayload(repeater))
+}
+
+// failoverPayload lists the failover masters for DHFO, one host:port per line
+func failoverPayload(masters []string) []byte {
+	return []byte(strings.Join(masters, "\n"))
+}
+
+// failoverProof is what a hotspot sends in a DHFL to show it holds the session it's resuming:
+// the full sha256 of the salt from its RPTL and its password, where RPTK only sends the first 4 bytes
+func failoverProof(salt uint32, password string) [sha256.Size]byte {
+	return sha256.Sum256(append(binary.BigEndian.AppendUint32(nil, salt), password...))
+}
+
+// sendFailoverMasters tells a hotspot that negotiated ExtensionFailover where to go if this master stops answering
+func (s *Server) sendFailoverMasters(ctx context.Context, repeaterID uint) {
+	masters := config.GetConfig().HBRPFailoverMasters
+	if len(masters) == 0 {
+		return
+	}
+	sendExtension(ctx, s.Redis, repeaterID, dmrconst.ExtensionFailover, dmrconst.CommandDHFO, failoverPayload(masters))
+}
+
+// SendStatusMessage shows a text message on a hotspot that negotiated ExtensionStatusMessage
+func SendStatusMessage(ctx context.Context, redis *servers.RedisClient, repeaterID uint, message string) error {
+	if len(message) > maxStatusMessageLength {
+		return ErrStatusMessageTooLong
+	}
+	if !sendExtension(ctx, redis, repeaterID, dmrconst.ExtensionStatusMessage, dmrconst.CommandDHMS, []byte(message)) {
+		return ErrExtensionNotNegotiated
+	}
+	return nil
+}
+
+// rejectStream tells a hotspot that negotiated ExtensionRejectReason why a stream wasn't routed
+func (s *Server) rejectStream(ctx context.Context, repeaterID uint, streamID uint, reason routing.Reason) {
+	payload := binary.BigEndian.AppendUint32(nil, uint32(streamID))
+	sendExtension(ctx, s.Redis, repeaterID, dmrconst.ExtensionRejectReason, dmrconst.CommandDHRJ, append(payload, reason...))
+}
@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+)
+
+func TestExtensionBlock(t *testing.T) {
+	t.Parallel()
+	block := extensionBlock(dmrconst.ExtensionTalkgroupList | dmrconst.ExtensionRejectReason)
+	if len(block) != extensionBlockLength {
+		t.Fatalf("Expected a %d byte block, got %d", extensionBlockLength, len(block))
+	}
+	extensions, ok := parseExtensionBlock(block)
+	if !ok || extensions != dmrconst.ExtensionTalkgroupList|dmrconst.ExtensionRejectReason {
+		t.Errorf("Expected the block to round trip, got %b %v", extensions, ok)
+	}
+
+	// A newer client still gets the extensions it shares with this hub
+	newer := bytes.Clone(block)
+	newer[len(dmrconst.ExtensionMagic)] = dmrconst.ExtensionVersion + 1
+	if _, ok := parseExtensionBlock(newer); !ok {
+		t.Error("Expected a newer block version to be accepted")
+	}
+
+	// Clients from before DHTC still negotiate the extensions they know
+	older := bytes.Clone(block)
+	older[len(dmrconst.ExtensionMagic)] = dmrconst.MinExtensionVersion
+	if _, ok := parseExtensionBlock(older); !ok {
+		t.Error("Expected an older block version to be accepted")
+	}
+	older[len(dmrconst.ExtensionMagic)] = 0
+	if _, ok := parseExtensionBlock(older); ok {
+		t.Error("Expected a block version below the minimum to be rejected")
+	}
+
+	// The tail of a standard RPTC is padding, not an extension block
+	if _, ok := parseExtensionBlock(bytes.Repeat([]byte(" "), extensionBlockLength)); ok {
+		t.Error("Expected padding to be rejected")
+	}
+	if _, ok := parseExtensionBlock(block[:extensionBlockLength-1]); ok {
+		t.Error("Expected a truncated block to be rejected")
+	}
+}
+
+func TestNegotiateExtensions(t *testing.T) {
+	t.Parallel()
+	const unknown = dmrconst.Extension(1 << 31)
+	granted := negotiateExtensions(dmrconst.ExtensionStatusMessage | unknown)
+	if granted != dmrconst.ExtensionStatusMessage {
+		t.Errorf("Expected only supported extensions to be granted, got %b", granted)
+	}
+}
+
+func TestTalkgroupListPayload(t *testing.T) {
+	t.Parallel()
+	dynamic := uint(3100)
+	repeater := models.Repeater{
+		TS1StaticTalkgroups:   []models.Talkgroup{{ID: 91}},
+		TS2DynamicTalkgroupID: &dynamic,
+	}
+	want := []byte{
+		1, 0, 0, 0, 0, 91,
+		2, 1, 0, 0, 0x0c, 0x1c,
+	}
+	if got := talkgroupListPayload(repeater); !bytes.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestFailoverProof(t *testing.T) {
+	t.Parallel()
+	proof := failoverProof(0x01020304, "password")
+	// RPTK sends the first 4 bytes of the same hash, so a hotspot can reuse its login code
+	want := sha256.Sum256(append([]byte{1, 2, 3, 4}, "password"...))
+	if proof != want {
+		t.Errorf("Expected %x, got %x", want, proof)
+	}
+	if failoverProof(0x01020305, "password") == proof {
+		t.Error("Expected a different salt to change the proof")
+	}
+}
+
+func TestFailoverPayload(t *testing.T) {
+	t.Parallel()
+	got := failoverPayload([]string{"hub2.example.com:62031", "[2001:db8::1]:62031"})
+	want := "hub2.example.com:62031\n[2001:db8::1]:62031"
+	if string(got) != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
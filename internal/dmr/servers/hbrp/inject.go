@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"go.opentelemetry.io/otel"
+)
+
+var ErrRepeaterNotConnected = errors.New("repeater is not connected")
+
+// InjectPacket hands a DMRD packet to the HBRP server as if the connected repeater had sent it.
+// It can be called from outside the server, such as from the API.
+func InjectPacket(ctx context.Context, redis *servers.RedisClient, repeaterID uint, packet models.Packet) error {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "hbrp.InjectPacket")
+	defer span.End()
+
+	if !redis.RepeaterExists(ctx, repeaterID) {
+		return ErrRepeaterNotConnected
+	}
+	repeater, err := redis.GetRepeater(ctx, repeaterID)
+	if err != nil {
+		return fmt.Errorf("failed to get repeater %d: %w", repeaterID, err)
+	}
+	packet.Signature = string(dmrconst.CommandDMRD)
+	packet.Repeater = repeaterID
+	p := models.RawDMRPacket{
+		Data:       packet.Encode(),
+		RemoteIP:   repeater.IP,
+		RemotePort: repeater.Port,
+	}
+	packedBytes, err := p.MarshalMsg(nil)
+	if err != nil {
+		return fmt.Errorf("failed to marshal packet: %w", err)
+	}
+	err = redis.Redis.Publish(ctx, "hbrp:incoming", packedBytes).Err()
+	if err != nil {
+		return fmt.Errorf("failed to publish packet: %w", err)
+	}
+	return nil
+}
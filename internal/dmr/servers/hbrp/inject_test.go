@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+)
+
+func TestInjectPacket(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	_, client := fakeredis.New(t)
+	redis := servers.MakeRedisClient(client)
+	const repeaterID = 311860401
+	packet := models.Packet{Src: 3118604, Dst: 3100, GroupCall: true, Slot: true, StreamID: 42, FrameType: dmrconst.FrameVoice}
+
+	err := InjectPacket(ctx, redis, repeaterID, packet)
+	if !errors.Is(err, ErrRepeaterNotConnected) {
+		t.Fatalf("Expected ErrRepeaterNotConnected, got %v", err)
+	}
+
+	repeater := models.Repeater{Connection: "YES", IP: "192.0.2.20", Port: 62031}
+	repeater.ID = repeaterID
+	redis.StoreRepeater(ctx, repeaterID, repeater)
+
+	sub := client.Subscribe(ctx, "hbrp:incoming")
+	t.Cleanup(func() { _ = sub.Close() })
+	if _, err := sub.Receive(ctx); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	if err := InjectPacket(ctx, redis, repeaterID, packet); err != nil {
+		t.Fatalf("Failed to inject: %v", err)
+	}
+
+	msg, err := sub.ReceiveMessage(ctx)
+	if err != nil {
+		t.Fatalf("Failed to receive the packet: %v", err)
+	}
+	var raw models.RawDMRPacket
+	if _, err := raw.UnmarshalMsg([]byte(msg.Payload)); err != nil {
+		t.Fatalf("Failed to unmarshal the packet: %v", err)
+	}
+	// It looks like it came from the repeater's address, so the UDP handling accepts it
+	if raw.RemoteIP != repeater.IP || raw.RemotePort != repeater.Port {
+		t.Errorf("Expected the repeater's address, got %s:%d", raw.RemoteIP, raw.RemotePort)
+	}
+	got, ok := models.UnpackPacket(raw.Data)
+	if !ok {
+		t.Fatal("Failed to unpack the injected packet")
+	}
+	if got.Signature != string(dmrconst.CommandDMRD) || got.Repeater != repeaterID {
+		t.Errorf("Expected a DMRD packet from repeater %d, got %s from %d", repeaterID, got.Signature, got.Repeater)
+	}
+	if got.Src != packet.Src || got.Dst != packet.Dst || got.StreamID != packet.StreamID || !got.GroupCall || !got.Slot {
+		t.Errorf("Unexpected packet: %s", got.String())
+	}
+}
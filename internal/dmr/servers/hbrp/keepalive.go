@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+)
+
+// keepaliveOption is the RPTO option a hotspot uses to say how often it pings, such as KEEPALIVE=15.
+// MMDVMHost sends whatever is in the Options setting of its [DMR Network] section.
+const keepaliveOption = "KEEPALIVE"
+
+// parseKeepaliveOption finds a keepalive interval in a repeater's semicolon separated options
+func parseKeepaliveOption(options string) (uint, bool) {
+	for _, option := range strings.Split(options, ";") {
+		key, value, found := strings.Cut(strings.TrimSpace(option), "=")
+		if !found || !strings.EqualFold(strings.TrimSpace(key), keepaliveOption) {
+			continue
+		}
+		interval, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32)
+		if err != nil || interval < models.MinKeepaliveInterval || interval > models.MaxKeepaliveInterval {
+			return 0, false
+		}
+		return uint(interval), true
+	}
+	return 0, false
+}
+
+// negotiateKeepalive applies the keepalive interval a repeater asked for in its options,
+// unless one has been set for it through the API. It lasts until the repeater disconnects.
+func (s *Server) negotiateKeepalive(ctx context.Context, dbRepeater models.Repeater, options string) {
+	interval, ok := parseKeepaliveOption(options)
+	if !ok || dbRepeater.KeepaliveInterval != 0 {
+		return
+	}
+	SetKeepaliveInterval(ctx, s.Redis, dbRepeater.ID, interval)
+}
+
+// SetKeepaliveInterval changes how often a connected repeater is expected to ping,
+// so its session times out after models.MissedPingLimit missed pings
+func SetKeepaliveInterval(ctx context.Context, redis *servers.RedisClient, repeaterID uint, interval uint) {
+	if !redis.RepeaterExists(ctx, repeaterID) {
+		return
+	}
+	repeater, err := redis.GetRepeater(ctx, repeaterID)
+	if err != nil {
+		logging.Errorf("Error getting repeater %d from Redis: %v", repeaterID, err)
+		return
+	}
+	repeater.KeepaliveInterval = interval
+	redis.StoreRepeater(ctx, repeaterID, repeater)
+}
@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import "testing"
+
+func TestParseKeepaliveOption(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		options  string
+		interval uint
+		ok       bool
+	}{
+		{"KEEPALIVE=15", 15, true},
+		{"TS1=1,2;keepalive = 20;TS2=3", 20, true},
+		{"TS1=1,2", 0, false},
+		{"KEEPALIVE=0", 0, false},
+		{"KEEPALIVE=61", 0, false},
+		{"KEEPALIVE=fast", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		interval, ok := parseKeepaliveOption(tt.options)
+		if interval != tt.interval || ok != tt.ok {
+			t.Errorf("parseKeepaliveOption(%q) = %d, %v; expected %d, %v", tt.options, interval, ok, tt.interval, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/puzpuzpuz/xsync/v3"
+)
+
+const (
+	// A DMRD packet carries one 60ms burst
+	voiceBurstInterval = 60 * time.Millisecond
+	// Gaps longer than these are an outage or a new over, not jitter
+	maxVoiceGap = time.Second
+	maxPingGap  = 5 * time.Minute
+	// How often link statistics are added to a repeater's history
+	linkSampleInterval = time.Minute
+	// RFC 3550 smooths jitter with a gain of 1/16
+	jitterGain = 16
+	// Ping intervals are averaged with a gain of 1/8 so occasional late pings don't move the baseline much
+	intervalGain = 8
+)
+
+//nolint:golint,gochecknoglobals
+var (
+	// Per-repeater values are in the health API; the metrics are network-wide so label cardinality stays bounded
+	latencyHistogram = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "dmrhub_repeater_latency_seconds",
+		Help:    "One-way network latency to repeaters, measured at login",
+		Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+	})
+	jitterHistogram = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dmrhub_repeater_jitter_seconds",
+		Help:    "Smoothed packet arrival jitter from repeaters, by packet kind",
+		Buckets: []float64{0.001, 0.005, 0.01, 0.02, 0.04, 0.06, 0.1, 0.25, 1},
+	}, []string{"kind"})
+)
+
+// jitter folds one arrival deviation into an RFC 3550 running jitter estimate
+func jitter(current, deviation time.Duration) time.Duration {
+	if deviation < 0 {
+		deviation = -deviation
+	}
+	return current + (deviation-current)/jitterGain
+}
+
+type linkState struct {
+	mu           sync.Mutex
+	lastPing     time.Time
+	pingInterval time.Duration
+	pingJitter   time.Duration
+	voiceStream  uint
+	lastVoice    time.Time
+	voiceJitter  time.Duration
+	lastSample   time.Time
+}
+
+// ping folds a keepalive arrival into the state. It returns the stats to store, and whether
+// they're due to be added to the history.
+func (l *linkState) ping(now time.Time) (servers.LinkStats, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.lastPing.IsZero() {
+		if interval := now.Sub(l.lastPing); interval < maxPingGap {
+			if l.pingInterval == 0 {
+				l.pingInterval = interval
+			} else {
+				l.pingJitter = jitter(l.pingJitter, interval-l.pingInterval)
+				l.pingInterval += (interval - l.pingInterval) / intervalGain
+			}
+		}
+	}
+	l.lastPing = now
+
+	sample := now.Sub(l.lastSample) >= linkSampleInterval
+	if sample {
+		l.lastSample = now
+	}
+	return servers.LinkStats{
+		PingIntervalMicros: l.pingInterval.Microseconds(),
+		PingJitterMicros:   l.pingJitter.Microseconds(),
+		VoiceJitterMicros:  l.voiceJitter.Microseconds(),
+		At:                 now,
+	}, sample
+}
+
+// voice folds a voice burst arrival into the state
+func (l *linkState) voice(streamID uint, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if streamID == l.voiceStream && !l.lastVoice.IsZero() {
+		if gap := now.Sub(l.lastVoice); gap < maxVoiceGap {
+			l.voiceJitter = jitter(l.voiceJitter, gap-voiceBurstInterval)
+		}
+	}
+	l.voiceStream = streamID
+	l.lastVoice = now
+}
+
+// linkMonitor measures the jitter of traffic from each repeater. Voice jitter is
+// what listeners hear as choppy audio; ping jitter shows the path when nobody is talking.
+type linkMonitor struct {
+	redis *servers.RedisClient
+	links *xsync.MapOf[uint, *linkState]
+}
+
+func newLinkMonitor(redis *servers.RedisClient) *linkMonitor {
+	return &linkMonitor{
+		redis: redis,
+		links: xsync.NewMapOf[uint, *linkState](),
+	}
+}
+
+func (m *linkMonitor) state(repeaterID uint) *linkState {
+	state, _ := m.links.LoadOrCompute(repeaterID, func() *linkState {
+		return &linkState{}
+	})
+	return state
+}
+
+// ping records a keepalive from a repeater and stores its latest statistics
+func (m *linkMonitor) ping(ctx context.Context, repeaterID uint, now time.Time) {
+	stats, sample := m.state(repeaterID).ping(now)
+	m.redis.StoreLinkStats(ctx, repeaterID, stats, sample)
+	if sample {
+		jitterHistogram.WithLabelValues("ping").Observe((time.Duration(stats.PingJitterMicros) * time.Microsecond).Seconds())
+		if stats.VoiceJitterMicros > 0 {
+			jitterHistogram.WithLabelValues("voice").Observe((time.Duration(stats.VoiceJitterMicros) * time.Microsecond).Seconds())
+		}
+	}
+}
+
+// voice records a voice burst from a repeater
+func (m *linkMonitor) voice(repeaterID uint, streamID uint, now time.Time) {
+	m.state(repeaterID).voice(streamID, now)
+}
+
+// forget drops a repeater's state when it disconnects, so the next login starts fresh
+func (m *linkMonitor) forget(repeaterID uint) {
+	m.links.Delete(repeaterID)
+}
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJitterConverges(t *testing.T) {
+	t.Parallel()
+	var current time.Duration
+	for i := 0; i < 200; i++ {
+		// Alternating 10ms early and late averages out to 10ms of jitter
+		deviation := 10 * time.Millisecond
+		if i%2 == 0 {
+			deviation = -deviation
+		}
+		current = jitter(current, deviation)
+	}
+	if current < 9*time.Millisecond || current > 10*time.Millisecond {
+		t.Errorf("Expected jitter to converge near 10ms, got %s", current)
+	}
+}
+
+func TestLinkStatePing(t *testing.T) {
+	t.Parallel()
+	var state linkState
+	start := time.Now()
+
+	_, sample := state.ping(start)
+	if !sample {
+		t.Error("Expected the first ping to be sampled")
+	}
+	stats, sample := state.ping(start.Add(5 * time.Second))
+	if sample {
+		t.Error("Expected pings within a minute of the last sample not to be sampled")
+	}
+	if stats.PingIntervalMicros != (5*time.Second).Microseconds() || stats.PingJitterMicros != 0 {
+		t.Errorf("Expected a 5s interval without jitter, got %+v", stats)
+	}
+	stats, _ = state.ping(start.Add(10*time.Second + 160*time.Millisecond))
+	if stats.PingJitterMicros != (10 * time.Millisecond).Microseconds() {
+		t.Errorf("Expected a 160ms late ping to add 10ms of jitter, got %dus", stats.PingJitterMicros)
+	}
+	// A repeater that went quiet for a long time shouldn't count as jitter
+	stats, sample = state.ping(start.Add(time.Hour))
+	if !sample || stats.PingJitterMicros != (10*time.Millisecond).Microseconds() {
+		t.Errorf("Expected a long gap to be ignored, got %+v", stats)
+	}
+}
+
+func TestLinkStateVoice(t *testing.T) {
+	t.Parallel()
+	var state linkState
+	start := time.Now()
+	state.voice(1, start)
+	state.voice(1, start.Add(60*time.Millisecond))
+	if state.voiceJitter != 0 {
+		t.Errorf("Expected on-time bursts not to add jitter, got %s", state.voiceJitter)
+	}
+	state.voice(1, start.Add(60*time.Millisecond+60*time.Millisecond+32*time.Millisecond))
+	if state.voiceJitter != 2*time.Millisecond {
+		t.Errorf("Expected a 32ms late burst to add 2ms of jitter, got %s", state.voiceJitter)
+	}
+	// A new stream right after isn't measured against the previous one
+	state.voice(2, start.Add(200*time.Millisecond))
+	if state.voiceJitter != 2*time.Millisecond {
+		t.Errorf("Expected a new stream not to add jitter, got %s", state.voiceJitter)
+	}
+}
@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+)
+
+const (
+	// commandHeaderLength is a command signature and the big endian repeater ID it's addressed to
+	commandHeaderLength = 8
+	// talkgroupEntryLength is the size of one DHTG entry
+	talkgroupEntryLength = 6
+)
+
+// fitDatagram makes an outgoing datagram fit within limit bytes where the protocol allows it.
+// DMRD packets lose their optional BER and RSSI bytes, and DHTG talkgroup lists are split
+// into a DHTG and DHTCs if the repeater can continue them. Anything else is returned as is,
+// along with an empty action.
+func fitDatagram(data []byte, limit int, continueTalkgroups bool) ([][]byte, string) {
+	if limit <= 0 || len(data) <= limit || len(data) < len(dmrconst.CommandDMRD) {
+		return [][]byte{data}, ""
+	}
+	switch dmrconst.Command(data[:len(dmrconst.CommandDMRD)]) {
+	case dmrconst.CommandDMRD:
+		if limit >= dmrconst.HBRPPacketLength && len(data) > dmrconst.HBRPPacketLength {
+			return [][]byte{data[:dmrconst.HBRPPacketLength]}, "trimmed"
+		}
+	case dmrconst.CommandDHTG:
+		if !continueTalkgroups {
+			break
+		}
+		perPart := (limit - commandHeaderLength) / talkgroupEntryLength
+		if perPart > 0 && len(data) >= commandHeaderLength {
+			return splitTalkgroupList(data, perPart), "split"
+		}
+	}
+	return [][]byte{data}, ""
+}
+
+// splitTalkgroupList splits a DHTG into parts of at most perPart entries each
+func splitTalkgroupList(data []byte, perPart int) [][]byte {
+	entries := data[commandHeaderLength:]
+	var parts [][]byte
+	for start := 0; start < len(entries); start += perPart * talkgroupEntryLength {
+		end := min(start+perPart*talkgroupEntryLength, len(entries))
+		command := dmrconst.CommandDHTC
+		if start == 0 {
+			command = dmrconst.CommandDHTG
+		}
+		part := make([]byte, 0, commandHeaderLength+end-start)
+		part = append(part, command...)
+		part = append(part, data[len(command):commandHeaderLength]...)
+		parts = append(parts, append(part, entries[start:end]...))
+	}
+	return parts
+}
+
+// send writes a datagram to addr, trimming or splitting it to the address's maximum datagram size
+func (s *Server) send(ctx context.Context, data []byte, addr *net.UDPAddr) {
+	limit := s.Listeners.MaxDatagram(addr)
+	continueTalkgroups := false
+	if limit > 0 && len(data) > limit {
+		continueTalkgroups = s.continuesTalkgroups(ctx, data)
+	}
+	parts, action := fitDatagram(data, limit, continueTalkgroups)
+	if action != "" {
+		s.Listeners.Downgraded(action)
+	}
+	for _, part := range parts {
+		_, err := s.Listeners.WriteToUDP(part, addr)
+		if err != nil {
+			logging.Errorf("Error sending packet: %v", err)
+		}
+	}
+}
+
+// continuesTalkgroups reports whether data is a DHTG to a repeater that negotiated ExtensionTalkgroupContinuation
+func (s *Server) continuesTalkgroups(ctx context.Context, data []byte) bool {
+	if len(data) < commandHeaderLength || dmrconst.Command(data[:len(dmrconst.CommandDHTG)]) != dmrconst.CommandDHTG {
+		return false
+	}
+	repeaterID := uint(binary.BigEndian.Uint32(data[len(dmrconst.CommandDHTG):commandHeaderLength]))
+	repeater, err := s.Redis.GetRepeater(ctx, repeaterID)
+	if err != nil {
+		logging.Errorf("Error getting repeater %d from Redis: %v", repeaterID, err)
+		return false
+	}
+	return dmrconst.Extension(repeater.Extensions)&dmrconst.ExtensionTalkgroupContinuation != 0
+}
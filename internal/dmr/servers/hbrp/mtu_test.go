@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+)
+
+func TestFitDatagramTrimsDMRD(t *testing.T) {
+	t.Parallel()
+	data := append([]byte(dmrconst.CommandDMRD), make([]byte, dmrconst.HBRPPacketLength-4+2)...)
+	parts, action := fitDatagram(data, dmrconst.HBRPPacketLength, false)
+	if action != "trimmed" || len(parts) != 1 || len(parts[0]) != dmrconst.HBRPPacketLength {
+		t.Fatalf("Expected one trimmed packet, got %d parts %q", len(parts), action)
+	}
+
+	parts, action = fitDatagram(data, 0, false)
+	if action != "" || len(parts[0]) != len(data) {
+		t.Errorf("Expected no change without a limit, got %q", action)
+	}
+}
+
+func TestFitDatagramSplitsTalkgroupList(t *testing.T) {
+	t.Parallel()
+	repeater := models.Repeater{
+		TS1StaticTalkgroups: []models.Talkgroup{{ID: 1}, {ID: 2}, {ID: 3}},
+		TS2StaticTalkgroups: []models.Talkgroup{{ID: 4}, {ID: 5}},
+	}
+	payload := talkgroupListPayload(repeater)
+	data := append([]byte(dmrconst.CommandDHTG), 0, 0, 0x30, 0x39)
+	data = append(data, payload...)
+
+	// Room for two entries per datagram
+	limit := commandHeaderLength + 2*talkgroupEntryLength + 1
+
+	// Hotspots that can't continue a list get it whole
+	parts, action := fitDatagram(data, limit, false)
+	if action != "" || len(parts) != 1 || !bytes.Equal(parts[0], data) {
+		t.Fatalf("Expected the DHTG to be sent unsplit, got %d parts %q", len(parts), action)
+	}
+
+	parts, action = fitDatagram(data, limit, true)
+	if action != "split" || len(parts) != 3 {
+		t.Fatalf("Expected 3 parts, got %d %q", len(parts), action)
+	}
+	var entries []byte
+	for i, part := range parts {
+		command := dmrconst.CommandDHTC
+		if i == 0 {
+			command = dmrconst.CommandDHTG
+		}
+		if string(part[:4]) != string(command) {
+			t.Errorf("Expected part %d to be a %s, got %s", i, command, part[:4])
+		}
+		if !bytes.Equal(part[4:commandHeaderLength], data[4:commandHeaderLength]) {
+			t.Errorf("Expected part %d to keep the repeater ID", i)
+		}
+		entries = append(entries, part[commandHeaderLength:]...)
+	}
+	if !bytes.Equal(entries, payload) {
+		t.Error("Expected the parts to carry every entry in order")
+	}
+}
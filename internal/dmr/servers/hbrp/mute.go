@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+)
+
+type muteKey struct {
+	repeaterID uint
+	slot       bool
+	talkgroup  uint
+}
+
+// Mute is a static talkgroup temporarily silenced on one of a repeater's slots
+type Mute struct {
+	Talkgroup uint      `json:"talkgroup_id"`
+	Slot      uint      `json:"slot"`
+	Until     time.Time `json:"until"`
+}
+
+// ToggleMute mutes a talkgroup on a repeater's slot for duration, or unmutes it
+// if it's already muted. It reports whether the talkgroup is now muted.
+func (m *SubscriptionManager) ToggleMute(repeaterID uint, slot bool, talkgroupID uint, duration time.Duration) bool {
+	key := muteKey{repeaterID: repeaterID, slot: slot, talkgroup: talkgroupID}
+	if m.IsMuted(repeaterID, slot, talkgroupID) {
+		m.mutes.Delete(key)
+		return false
+	}
+	m.mutes.Store(key, time.Now().Add(duration))
+	return true
+}
+
+// IsMuted reports whether a talkgroup is muted on a repeater's slot. Expired mutes are restored automatically.
+func (m *SubscriptionManager) IsMuted(repeaterID uint, slot bool, talkgroupID uint) bool {
+	key := muteKey{repeaterID: repeaterID, slot: slot, talkgroup: talkgroupID}
+	until, ok := m.mutes.Load(key)
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		m.mutes.Delete(key)
+		return false
+	}
+	return true
+}
+
+// ListMutes returns the talkgroups currently muted on a repeater
+func (m *SubscriptionManager) ListMutes(repeaterID uint) []Mute {
+	mutes := []Mute{}
+	m.mutes.Range(func(key muteKey, until time.Time) bool {
+		if key.repeaterID == repeaterID && time.Now().Before(until) {
+			mutes = append(mutes, Mute{Talkgroup: key.talkgroup, Slot: slotNumber(key.slot), Until: until})
+		}
+		return true
+	})
+	return mutes
+}
+
+// ClearMutes unmutes every talkgroup on a repeater
+func (m *SubscriptionManager) ClearMutes(repeaterID uint) {
+	m.mutes.Range(func(key muteKey, _ time.Time) bool {
+		if key.repeaterID == repeaterID {
+			m.mutes.Delete(key)
+		}
+		return true
+	})
+}
+
+// muteCommandTalkgroup returns the talkgroup a private call is asking to mute, if
+// the destination is the configured prefix digit followed by a talkgroup ID.
+func muteCommandTalkgroup(dst uint) (uint, bool) {
+	prefix := config.GetConfig().TalkgroupMutePrefix
+	if prefix == "" {
+		return 0, false
+	}
+	tg, ok := strings.CutPrefix(strconv.FormatUint(uint64(dst), 10), prefix)
+	if !ok || tg == "" || strings.HasPrefix(tg, "0") {
+		return 0, false
+	}
+	talkgroupID, err := strconv.ParseUint(tg, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint(talkgroupID), true
+}
+
+// doMuteCommand handles a private call to the mute prefix plus one of the slot's
+// static talkgroups, toggling the mute when the call starts. It reports whether
+// the packet was a mute command, in which case it shouldn't be routed.
+func (s *Server) doMuteCommand(packet models.Packet, repeaterID uint, newStream bool) bool {
+	talkgroupID, ok := muteCommandTalkgroup(packet.Dst)
+	if !ok {
+		return false
+	}
+	// Only mute commands need the repeater's static talkgroups, so it isn't loaded for every burst
+	dbRepeater, err := models.FindRepeaterByID(s.DB, repeaterID)
+	if err != nil {
+		logging.Errorf("Error finding repeater: %s", err)
+		return false
+	}
+	if packet.Slot && !dbRepeater.InTS2StaticTalkgroups(talkgroupID) || !packet.Slot && !dbRepeater.InTS1StaticTalkgroups(talkgroupID) {
+		return false
+	}
+	// A real radio or repeater with this ID takes precedence over the command
+	userExists, err := models.UserIDExists(s.DB, packet.Dst)
+	if err != nil {
+		logging.Errorf("Error checking if user %d exists: %s", packet.Dst, err)
+		return false
+	}
+	repeaterExists, err := models.RepeaterIDExists(s.DB, packet.Dst)
+	if err != nil {
+		logging.Errorf("Error checking if repeater %d exists: %s", packet.Dst, err)
+		return false
+	}
+	if userExists || repeaterExists {
+		return false
+	}
+
+	if newStream {
+		muted := GetSubscriptionManager(s.DB).ToggleMute(dbRepeater.ID, packet.Slot, talkgroupID, config.GetConfig().TalkgroupMuteDuration)
+		if muted {
+			logging.Logf("Muted talkgroup %d on repeater %d slot %d", talkgroupID, dbRepeater.ID, slotNumber(packet.Slot))
+		} else {
+			logging.Logf("Unmuted talkgroup %d on repeater %d slot %d", talkgroupID, dbRepeater.ID, slotNumber(packet.Slot))
+		}
+	}
+	return true
+}
+
+func slotNumber(slot bool) uint {
+	if slot {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers/hbrp"
+)
+
+func TestToggleMute(t *testing.T) {
+	t.Parallel()
+	manager := hbrp.GetSubscriptionManager(nil)
+	const repeaterID = 311999
+
+	if !manager.ToggleMute(repeaterID, true, 31665, time.Hour) {
+		t.Fatal("Expected the first toggle to mute")
+	}
+	if !manager.IsMuted(repeaterID, true, 31665) {
+		t.Error("Expected talkgroup to be muted on TS2")
+	}
+	if manager.IsMuted(repeaterID, false, 31665) {
+		t.Error("Expected talkgroup not to be muted on TS1")
+	}
+	mutes := manager.ListMutes(repeaterID)
+	if len(mutes) != 1 || mutes[0].Talkgroup != 31665 || mutes[0].Slot != 2 {
+		t.Errorf("Unexpected mutes: %+v", mutes)
+	}
+
+	if manager.ToggleMute(repeaterID, true, 31665, time.Hour) {
+		t.Error("Expected the second toggle to unmute")
+	}
+	if manager.IsMuted(repeaterID, true, 31665) {
+		t.Error("Expected talkgroup to be unmuted")
+	}
+}
+
+func TestMuteExpires(t *testing.T) {
+	t.Parallel()
+	manager := hbrp.GetSubscriptionManager(nil)
+	const repeaterID = 311998
+
+	manager.ToggleMute(repeaterID, false, 91, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if manager.IsMuted(repeaterID, false, 91) {
+		t.Error("Expected mute to be restored after it expired")
+	}
+
+	manager.ToggleMute(repeaterID, false, 91, time.Hour)
+	manager.ClearMutes(repeaterID)
+	if len(manager.ListMutes(repeaterID)) != 0 {
+		t.Error("Expected all mutes to be cleared")
+	}
+}
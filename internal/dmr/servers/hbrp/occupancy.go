@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/puzpuzpuz/xsync/v3"
+)
+
+type occupancyKey struct {
+	repeaterID uint
+	slot       bool
+}
+
+type occupancyState struct {
+	mu         sync.Mutex
+	minute     time.Time
+	minuteBusy time.Duration
+	hour       time.Time
+	hourBusy   time.Duration
+}
+
+// roll closes out the minute and hour buckets that end before now, returning the samples to store
+func (o *occupancyState) roll(now time.Time) (minute *servers.OccupancySample, hour *servers.OccupancySample) {
+	if currentMinute := now.Truncate(time.Minute); !o.minute.Equal(currentMinute) {
+		if o.minuteBusy > 0 {
+			busy := min(o.minuteBusy, time.Minute)
+			minute = &servers.OccupancySample{At: o.minute, BusySeconds: busy.Seconds()}
+			o.hourBusy += busy
+		}
+		o.minute = currentMinute
+		o.minuteBusy = 0
+	}
+	if currentHour := now.Truncate(time.Hour); !o.hour.Equal(currentHour) {
+		if o.hourBusy > 0 {
+			// Hourly samples are the average busy seconds per minute, so both series share a scale
+			hour = &servers.OccupancySample{At: o.hour, BusySeconds: o.hourBusy.Seconds() / time.Hour.Minutes()}
+		}
+		o.hour = currentHour
+		o.hourBusy = 0
+	}
+	return minute, hour
+}
+
+// occupancyMonitor measures how much of each minute a repeater's time slots are busy.
+// Every burst received from or routed to a repeater holds its slot for 60ms.
+type occupancyMonitor struct {
+	redis  *servers.RedisClient
+	states *xsync.MapOf[occupancyKey, *occupancyState]
+}
+
+func newOccupancyMonitor(redis *servers.RedisClient) *occupancyMonitor {
+	return &occupancyMonitor{
+		redis:  redis,
+		states: xsync.NewMapOf[occupancyKey, *occupancyState](),
+	}
+}
+
+// burst records one burst on a repeater's slot
+func (m *occupancyMonitor) burst(ctx context.Context, repeaterID uint, slot bool, now time.Time) {
+	key := occupancyKey{repeaterID: repeaterID, slot: slot}
+	state, _ := m.states.LoadOrCompute(key, func() *occupancyState {
+		return &occupancyState{minute: now.Truncate(time.Minute), hour: now.Truncate(time.Hour)}
+	})
+	state.mu.Lock()
+	minute, hour := state.roll(now)
+	state.minuteBusy += voiceBurstInterval
+	state.mu.Unlock()
+	m.store(ctx, key, minute, hour)
+}
+
+// flush stores the buckets that have ended, and forgets slots that have been idle for a full hour
+func (m *occupancyMonitor) flush(ctx context.Context, now time.Time) {
+	m.states.Range(func(key occupancyKey, state *occupancyState) bool {
+		state.mu.Lock()
+		minute, hour := state.roll(now)
+		idle := state.minuteBusy == 0 && state.hourBusy == 0
+		state.mu.Unlock()
+		m.store(ctx, key, minute, hour)
+		if idle && hour == nil && minute == nil {
+			// A burst racing this delete can lose 60ms, which doesn't register at a minute's resolution
+			m.states.Delete(key)
+		}
+		return true
+	})
+}
+
+func (m *occupancyMonitor) store(ctx context.Context, key occupancyKey, minute, hour *servers.OccupancySample) {
+	if minute != nil {
+		m.redis.StoreOccupancy(ctx, key.repeaterID, key.slot, servers.OccupancyMinute, *minute)
+	}
+	if hour != nil {
+		m.redis.StoreOccupancy(ctx, key.repeaterID, key.slot, servers.OccupancyHour, *hour)
+	}
+}
+
+// run flushes finished buckets every minute, so a slot's last busy minute is stored even if it then goes quiet
+func (m *occupancyMonitor) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.flush(ctx, now)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOccupancyRoll(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	state := occupancyState{minute: start, hour: start}
+
+	// 500 bursts is 30 seconds of a one-minute bucket
+	for i := 0; i < 500; i++ {
+		state.roll(start.Add(time.Duration(i) * 100 * time.Millisecond))
+		state.minuteBusy += voiceBurstInterval
+	}
+	minute, hour := state.roll(start.Add(90 * time.Second))
+	if minute == nil || !minute.At.Equal(start) || minute.BusySeconds != 30 {
+		t.Fatalf("Expected 30 busy seconds in the first minute, got %+v", minute)
+	}
+	if hour != nil {
+		t.Errorf("Expected no hourly sample before the hour ends, got %+v", hour)
+	}
+
+	// Overlapping streams can't make a slot more than fully busy
+	state.minuteBusy = 2 * time.Minute
+	minute, hour = state.roll(start.Add(time.Hour))
+	if minute == nil || minute.BusySeconds != 60 {
+		t.Errorf("Expected the minute to be capped at 60 seconds, got %+v", minute)
+	}
+	if hour == nil || !hour.At.Equal(start) || hour.BusySeconds != 1.5 {
+		t.Errorf("Expected 1.5 busy seconds per minute over the hour, got %+v", hour)
+	}
+
+	minute, hour = state.roll(start.Add(2 * time.Hour))
+	if minute != nil || hour != nil {
+		t.Errorf("Expected no samples for an idle hour, got %+v %+v", minute, hour)
+	}
+}
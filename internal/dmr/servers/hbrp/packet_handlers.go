@@ -23,19 +23,29 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math/big"
 	"net"
 	"time"
 
+	"github.com/USA-RedDragon/DMRHub/internal/archive"
+	"github.com/USA-RedDragon/DMRHub/internal/bandplan"
 	"github.com/USA-RedDragon/DMRHub/internal/config"
 	"github.com/USA-RedDragon/DMRHub/internal/db/models"
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/routing"
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/rules"
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/utils"
+	"github.com/USA-RedDragon/DMRHub/internal/events"
+	"github.com/USA-RedDragon/DMRHub/internal/hubevents"
+	"github.com/USA-RedDragon/DMRHub/internal/inhibit"
 	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/pubsub"
 	"go.opentelemetry.io/otel"
+	"gorm.io/gorm"
 )
 
 const parrotDelay = 3 * time.Second
@@ -108,28 +118,13 @@ func (s *Server) switchDynamicTalkgroup(ctx context.Context, packet models.Packe
 		logging.Errorf("Error finding talkgroup %d: %s", packet.Dst, err.Error())
 		return
 	}
+	slot := dmrconst.TimeslotOne
 	if packet.Slot {
-		if repeater.TS2DynamicTalkgroupID == nil || *repeater.TS2DynamicTalkgroupID != packet.Dst {
-			logging.Logf("Dynamically Linking %d timeslot 2 to %d", packet.Repeater, packet.Dst)
-			repeater.TS2DynamicTalkgroup = talkgroup
-			repeater.TS2DynamicTalkgroupID = &packet.Dst
-			go GetSubscriptionManager(s.DB).ListenForCallsOn(s.Redis.Redis, repeater.ID, packet.Dst) //nolint:golint,contextcheck
-			err := s.DB.Save(&repeater).Error
-			if err != nil {
-				logging.Errorf("Error saving repeater: %s", err.Error())
-			}
-		}
-	} else {
-		if repeater.TS1DynamicTalkgroupID == nil || *repeater.TS1DynamicTalkgroupID != packet.Dst {
-			logging.Logf("Dynamically Linking %d timeslot 1 to %d", packet.Repeater, packet.Dst)
-			repeater.TS1DynamicTalkgroup = talkgroup
-			repeater.TS1DynamicTalkgroupID = &packet.Dst
-			go GetSubscriptionManager(s.DB).ListenForCallsOn(s.Redis.Redis, repeater.ID, packet.Dst) //nolint:golint,contextcheck
-			err := s.DB.Save(&repeater).Error
-			if err != nil {
-				logging.Errorf("Error saving repeater: %s", err.Error())
-			}
-		}
+		slot = dmrconst.TimeslotTwo
+	}
+	_, err = GetSubscriptionManager(s.DB).LinkDynamicTalkgroup(s.Redis.Redis, &repeater, talkgroup, slot) //nolint:golint,contextcheck
+	if err != nil {
+		logging.Errorf("Error linking repeater %d to talkgroup %d: %s", repeater.ID, talkgroup.ID, err)
 	}
 }
 
@@ -148,18 +143,7 @@ func (s *Server) handleDMRAPacket(ctx context.Context, remoteAddr net.UDPAddr, d
 	logging.Logf("DMR talk alias from Repeater ID: %d", repeaterIDBytes)
 	if s.validRepeater(ctx, repeaterID, "YES", remoteAddr) {
 		s.Redis.UpdateRepeaterPing(ctx, repeaterID)
-		dbRepeater, err := models.FindRepeaterByID(s.DB, repeaterID)
-		if err != nil {
-			// Repeater not found, drop
-			logging.Errorf("Repeater %d not found in DB", repeaterID)
-			return
-		}
-		dbRepeater.LastPing = time.Now()
-		err = s.DB.Save(&dbRepeater).Error
-		if err != nil {
-			logging.Errorf("Error saving repeater: %s", err.Error())
-			return
-		}
+		s.Writes.TouchRepeater(repeaterID, time.Now())
 
 		typeBytes := data[8:9]
 		// Type can be 0 for a full talk alias, or 1,2,3 for talk alias blocks
@@ -175,11 +159,11 @@ func (s *Server) handleDMRAPacket(ctx context.Context, remoteAddr net.UDPAddr, d
 }
 
 func (s *Server) TrackCall(ctx context.Context, packet models.Packet, isVoice bool) {
-	// Don't call track unlink
+	// Don't call track unlink, or audio tests, which are measured separately
 	ctx, span := otel.Tracer("DMRHub").Start(ctx, "Server.TrackCall")
 	defer span.End()
 
-	if packet.Dst != 4000 && isVoice {
+	if packet.Dst != 4000 && packet.Dst != dmrconst.AudioTestTalkgroup && isVoice {
 		if !s.CallTracker.IsCallActive(ctx, packet) {
 			s.CallTracker.StartCall(ctx, packet)
 		}
@@ -192,6 +176,15 @@ func (s *Server) TrackCall(ctx context.Context, packet models.Packet, isVoice bo
 	}
 }
 
+// streamActive reports whether a voice stream has been seen before. Audio tests and streams
+// blocked by a quota aren't call tracked, so they are checked where they are remembered.
+func (s *Server) streamActive(ctx context.Context, packet models.Packet) bool {
+	if packet.Dst == dmrconst.AudioTestTalkgroup {
+		return s.audioTests.active(packet.StreamID)
+	}
+	return s.CallTracker.IsCallActive(ctx, packet) || s.quotaBlocked.blocked(packet.StreamID, time.Now())
+}
+
 func (s *Server) doParrot(ctx context.Context, packet models.Packet, repeaterID uint) {
 	ctx, span := otel.Tracer("DMRHub").Start(ctx, "Server.doParrot")
 	defer span.End()
@@ -204,62 +197,28 @@ func (s *Server) doParrot(ctx context.Context, packet models.Packet, repeaterID
 	s.Parrot.RecordPacket(ctx, packet.StreamID, packet)
 	if packet.FrameType == dmrconst.FrameDataSync && dmrconst.DataType(packet.DTypeOrVSeq) == dmrconst.DTypeVoiceTerm {
 		s.Parrot.StopStream(ctx, packet.StreamID)
-		go func() {
-			packets := s.Parrot.GetStream(ctx, packet.StreamID)
-			time.Sleep(parrotDelay)
-			// Track the duration of the call to ensure that we send out packets right on the 60ms boundary
-			// This is to ensure that the DMR repeater doesn't drop the packet
-			startedTime := time.Now()
-			for _, pkt := range packets {
-				s.sendPacket(ctx, repeaterID, pkt)
-				s.TrackCall(ctx, pkt, true)
-				// Calculate the time since the call started
-				elapsed := time.Since(startedTime)
-				const packetTiming = 60 * time.Millisecond
-				// If elapsed is greater than 60ms, we're behind and need to catch up
-				if elapsed > packetTiming {
-					logging.Errorf("Parrot call took too long to send, elapsed: %s", elapsed)
-					// Sleep for 60ms minus the difference between the elapsed time and 60ms
-					time.Sleep(packetTiming - (elapsed - packetTiming))
-				} else {
-					// Now subtract the elapsed time from 60ms to get the true delay
-					delay := packetTiming - elapsed
-					time.Sleep(delay)
-				}
-				startedTime = time.Now()
-			}
-		}()
+		s.scheduleParrotPlayback(ctx, packet.StreamID, repeaterID)
 	}
 }
 
-func (s *Server) doUnlink(ctx context.Context, packet models.Packet, dbRepeater models.Repeater) {
+func (s *Server) doUnlink(ctx context.Context, packet models.Packet, repeaterID uint) {
 	_, span := otel.Tracer("DMRHub").Start(ctx, "Server.doUnlink")
 	defer span.End()
 
+	dbRepeater, err := models.FindRepeaterByID(s.DB, repeaterID)
+	if err != nil {
+		logging.Errorf("Error finding repeater: %s", err)
+		return
+	}
+	slot := dmrconst.TimeslotOne
 	if packet.Slot {
-		logging.Logf("Unlinking timeslot 2 from %d", packet.Repeater)
-		if dbRepeater.TS2DynamicTalkgroupID != nil {
-			oldTGID := *dbRepeater.TS2DynamicTalkgroupID
-			s.DB.Model(&dbRepeater).Select("TS2DynamicTalkgroupID").Updates(map[string]interface{}{"TS2DynamicTalkgroupID": nil})
-			err := s.DB.Model(&dbRepeater).Association("TS2DynamicTalkgroup").Delete(&dbRepeater.TS2DynamicTalkgroup)
-			if err != nil {
-				logging.Errorf("Error deleting TS2DynamicTalkgroup: %s", err)
-			}
-			GetSubscriptionManager(s.DB).CancelSubscription(dbRepeater.ID, oldTGID, dmrconst.TimeslotTwo)
-		}
-	} else {
-		logging.Logf("Unlinking timeslot 1 from %d", packet.Repeater)
-		if dbRepeater.TS1DynamicTalkgroupID != nil {
-			oldTGID := *dbRepeater.TS1DynamicTalkgroupID
-			s.DB.Model(&dbRepeater).Select("TS1DynamicTalkgroupID").Updates(map[string]interface{}{"TS1DynamicTalkgroupID": nil})
-			err := s.DB.Model(&dbRepeater).Association("TS1DynamicTalkgroup").Delete(&dbRepeater.TS1DynamicTalkgroup)
-			if err != nil {
-				logging.Errorf("Error deleting TS1DynamicTalkgroup: %s", err)
-			}
-			GetSubscriptionManager(s.DB).CancelSubscription(dbRepeater.ID, oldTGID, dmrconst.TimeslotOne)
-		}
+		slot = dmrconst.TimeslotTwo
+	}
+	_, err = GetSubscriptionManager(s.DB).UnlinkDynamicTalkgroup(s.Redis.Redis, &dbRepeater, slot)
+	if err != nil {
+		logging.Errorf("Error unlinking repeater %d: %s", dbRepeater.ID, err)
 	}
-	err := s.DB.Save(&dbRepeater).Error
+	err = s.DB.Save(&dbRepeater).Error
 	if err != nil {
 		logging.Errorf("Error saving repeater: %s", err)
 	}
@@ -286,25 +245,46 @@ func (s *Server) doUser(ctx context.Context, packet models.Packet, packedBytes [
 		return
 	}
 
+	policy := config.GetConfig().PrivateCallFanout
+	candidates := func() []uint {
+		return s.userCandidates(ctx, user)
+	}
+
+	var targets []uint
+	if policy == config.PrivateCallFanoutRing {
+		now := time.Now()
+		// The caller is on the air here, so a reply to them doesn't need to hunt
+		s.ringer.heard(packet.Src, packet.Dst, packet.Repeater, now)
+		if target, ok := s.ringer.target(packet.Src, packet.Dst, now, candidates); ok {
+			targets = []uint{target}
+		}
+	} else {
+		targets = candidates()
+	}
+
+	for _, repeaterID := range targets {
+		s.Redis.Redis.Publish(ctx, fmt.Sprintf("hbrp:packets:repeater:%d", repeaterID), packedBytes)
+	}
+}
+
+// userCandidates returns the online repeaters a private call to a user can be sent to under the fanout policy
+func (s *Server) userCandidates(ctx context.Context, user models.User) []uint {
 	// Query lastheard where UserID == user.ID LIMIT 1
 	var lastCall models.Call
-	err = s.DB.Where("user_id = ?", user.ID).Order("created_at DESC").First(&lastCall).Error
-	if err != nil {
+	err := s.DB.Where("user_id = ?", user.ID).Order("created_at DESC").First(&lastCall).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		logging.Errorf("Error querying last call for user %d: %v", user.ID, err)
-	} else if lastCall.ID != 0 && s.Redis.RepeaterExists(ctx, lastCall.RepeaterID) {
-		// If the last call exists and that repeater is online
-		// Send the packet to the last user call's repeater
-		s.Redis.Redis.Publish(ctx, fmt.Sprintf("hbrp:packets:repeater:%d", lastCall.RepeaterID), packedBytes)
 	}
 
-	// For each user repeaters
-	for _, repeater := range user.Repeaters {
-		// If the repeater is online and the last user call was not to this repeater
-		if repeater.ID != lastCall.RepeaterID && s.Redis.RepeaterExists(ctx, lastCall.RepeaterID) {
-			// Send the packet to the repeater
-			s.Redis.Redis.Publish(ctx, fmt.Sprintf("hbrp:packets:repeater:%d", repeater.ID), packedBytes)
+	var owned []uint
+	if config.GetConfig().PrivateCallFanout != config.PrivateCallFanoutLastHeard {
+		for _, repeater := range user.Repeaters {
+			owned = append(owned, repeater.ID)
 		}
 	}
+	return privateCallCandidates(lastCall.RepeaterID, owned, func(repeaterID uint) bool {
+		return s.Redis.RepeaterExists(ctx, repeaterID)
+	})
 }
 
 //nolint:golint,gocyclo
@@ -322,18 +302,7 @@ func (s *Server) handleDMRDPacket(ctx context.Context, remoteAddr net.UDPAddr, d
 	logging.Logf("DMR Data from Repeater ID: %d", repeaterID)
 	if s.validRepeater(ctx, repeaterID, "YES", remoteAddr) {
 		s.Redis.UpdateRepeaterPing(ctx, repeaterID)
-
-		dbRepeater, err := models.FindRepeaterByID(s.DB, repeaterID)
-		if err != nil {
-			logging.Errorf("Error finding repeater: %s", err)
-			return
-		}
-		dbRepeater.LastPing = time.Now()
-		err = s.DB.Save(&dbRepeater).Error
-		if err != nil {
-			logging.Errorf("Error saving repeater: %s", err)
-			return
-		}
+		s.Writes.TouchRepeater(repeaterID, time.Now())
 
 		packet, ok := models.UnpackPacket(data)
 		if !ok {
@@ -345,49 +314,136 @@ func (s *Server) handleDMRDPacket(ctx context.Context, remoteAddr net.UDPAddr, d
 			return
 		}
 
+		if s.dedup.duplicate(repeaterID, packet, time.Now()) {
+			if config.GetConfig().Debug {
+				logging.Logf("Dropping duplicate burst %d of stream %d from repeater %d", packet.Seq, packet.StreamID, repeaterID)
+			}
+			return
+		}
+		s.occupancy.burst(ctx, repeaterID, packet.Slot, time.Now())
+
 		if config.GetConfig().Debug {
 			logging.Logf("DMRD packet: %s", packet.String())
 		}
 
 		isVoice, isData := utils.CheckPacketType(packet)
+		if isVoice {
+			s.links.voice(repeaterID, packet.StreamID, time.Now())
+		}
+
+		if inhibit.Blocks(packet) {
+			// An emergency TX inhibit covers this destination. The stream was never
+			// tracked, so record the decision on its voice header rather than every burst.
+			if isVoice && packet.FrameType == dmrconst.FrameDataSync && packet.DTypeOrVSeq == uint(dmrconst.DTypeVoiceHead) {
+				target := routing.TargetUser
+				if packet.GroupCall {
+					target = routing.TargetTalkgroup
+				}
+				routing.Record(ctx, s.Redis.Redis, packet.StreamID, routing.Decision{Target: target, TargetID: packet.Dst, Reason: routing.ReasonInhibited})
+				s.rejectStream(ctx, repeaterID, packet.StreamID, routing.ReasonInhibited)
+			}
+			return
+		}
+
+		// Routing decisions are only recorded once per stream
+		newStream := isVoice && packet.Dst != 4000 && !s.streamActive(ctx, packet)
+
+		if newStream && s.draining.Load() {
+			// The hub is shutting down, only calls already on the air are carried.
+			// The stream is never tracked, so reject it on its voice header.
+			if packet.FrameType == dmrconst.FrameDataSync && packet.DTypeOrVSeq == uint(dmrconst.DTypeVoiceHead) {
+				target := routing.TargetUser
+				if packet.GroupCall {
+					target = routing.TargetTalkgroup
+				}
+				routing.Record(ctx, s.Redis.Redis, packet.StreamID, routing.Decision{Target: target, TargetID: packet.Dst, Reason: routing.ReasonShuttingDown})
+				s.rejectStream(ctx, repeaterID, packet.StreamID, routing.ReasonShuttingDown)
+			}
+			return
+		}
+
+		if newStream && packet.GroupCall && config.GetConfig().AutoCreateTalkgroups {
+			// Create the talkgroup before the call is tracked so the call is recorded against it
+			s.autoCreateTalkgroup(ctx, packet.Dst)
+		}
+
+		if packet.GroupCall && isVoice && s.quotaBlocks(ctx, packet, repeaterID, newStream) {
+			// The user is over their talkgroup quota, don't track or route the call
+			return
+		}
 
 		s.TrackCall(ctx, packet, isVoice)
+		if newStream {
+			// The user is on the air, so anything held for them can be delivered here
+			go s.deliverDeferredToUser(ctx, packet.Src, repeaterID)
+		}
+
+		if packet.Dst == dmrconst.AudioTestTalkgroup && isVoice {
+			if newStream {
+				routing.Record(ctx, s.Redis.Redis, packet.StreamID, routing.Decision{Target: routing.TargetAudioTest, TargetID: packet.Dst, Delivered: true, Reason: routing.ReasonAudioTest})
+			}
+			s.doAudioTest(ctx, packet, repeaterID)
+			// Audio tests are answered by the hub, not routed
+			return
+		}
 
 		if packet.Dst == dmrconst.ParrotUser && isVoice {
+			if newStream {
+				routing.Record(ctx, s.Redis.Redis, packet.StreamID, routing.Decision{Target: routing.TargetParrot, TargetID: packet.Dst, Delivered: true, Reason: routing.ReasonParrot})
+			}
 			s.doParrot(ctx, packet, repeaterID)
 			// Don't route parrot calls
 			return
 		}
 
+		if packet.Dst == dmrconst.ParrotUser && !packet.GroupCall && isCSBK(packet) {
+			s.doServiceCSBK(ctx, packet, repeaterID)
+			return
+		}
+
 		if packet.Dst == 4000 && isVoice {
-			s.doUnlink(ctx, packet, dbRepeater)
+			s.doUnlink(ctx, packet, repeaterID)
 			return
 		}
 
-		if config.GetConfig().OpenBridgePort != 0 {
-			go func() {
-				// We need to send this packet to all peers except the one that sent it
-				peers := models.ListPeers(s.DB)
-				for _, p := range peers {
-					if rules.PeerShouldEgress(s.DB, p, &packet) {
-						s.sendOpenBridgePacket(ctx, p.ID, packet)
-					}
-				}
-			}()
+		if packet.GroupCall && !s.allowedOnTalkgroup(ctx, packet, repeaterID, newStream) {
+			return
+		}
+
+		// Directly linked repeaters hear everything on the slot, whatever the destination
+		s.doBridge(ctx, packet, remoteAddr, data)
+
+		if len(config.GetConfig().OpenBridgeListen) > 0 {
+			go s.egressPeers(ctx, packet, newStream)
 		}
 
 		switch {
 		case packet.GroupCall && isVoice:
-			exists, err := models.TalkgroupIDExists(s.DB, packet.Dst)
+			exists, pending, err := models.TalkgroupState(s.DB, packet.Dst)
 			if err != nil {
 				logging.Errorf("Error checking if talkgroup exists: %s", err)
 				return
 			}
 			if !exists {
 				logging.Errorf("Talkgroup %d does not exist", packet.Dst)
+				if newStream {
+					routing.Record(ctx, s.Redis.Redis, packet.StreamID, routing.Decision{Target: routing.TargetTalkgroup, TargetID: packet.Dst, Reason: routing.ReasonUnknownTalkgroup})
+					s.rejectStream(ctx, repeaterID, packet.StreamID, routing.ReasonUnknownTalkgroup)
+				}
+				return
+			}
+			if pending {
+				if newStream {
+					routing.Record(ctx, s.Redis.Redis, packet.StreamID, routing.Decision{Target: routing.TargetTalkgroup, TargetID: packet.Dst, Reason: routing.ReasonPendingApproval})
+					s.rejectStream(ctx, repeaterID, packet.StreamID, routing.ReasonPendingApproval)
+				}
 				return
 			}
+			archive.Record(packet, time.Now())
 			go s.switchDynamicTalkgroup(ctx, packet)
+			if newStream && routing.Sampled(packet.StreamID) {
+				go s.recordOfflineRepeaters(ctx, packet)
+			}
 
 			// We can just use redis to publish to "hbrp:packets:talkgroup:<id>"
 			var rawPacket models.RawDMRPacket
@@ -399,56 +455,18 @@ func (s *Server) handleDMRDPacket(ctx context.Context, remoteAddr net.UDPAddr, d
 				logging.Errorf("Error marshalling raw packet: %v", err)
 				return
 			}
-			s.Redis.Redis.Publish(ctx, fmt.Sprintf("hbrp:packets:talkgroup:%d", packet.Dst), packedBytes)
+			// Voice isn't buffered during an outage, but the failure still marks pubsub degraded
+			pubsub.Observe(s.Redis.Redis.Publish(ctx, fmt.Sprintf("hbrp:packets:talkgroup:%d", packet.Dst), packedBytes).Err())
 		case !packet.GroupCall && isVoice:
-			// packet.Dst is either a repeater or a user
-			// If it's a repeater, we need to send it to the repeater
-			// If it's a user, we need to send it to the repeater that the user is connected to
-			// by looking up the user in the database and iterating through their repeaters
-
-			var rawPacket models.RawDMRPacket
-			rawPacket.Data = data
-			rawPacket.RemoteIP = remoteAddr.IP.String()
-			rawPacket.RemotePort = remoteAddr.Port
-
-			packedBytes, err := rawPacket.MarshalMsg(nil)
-			if err != nil {
-				logging.Errorf("Error marshalling raw packet: %v", err)
+			if s.doMuteCommand(packet, repeaterID, newStream) {
 				return
 			}
-
-			// users have 7 digit IDs, repeaters have 6 digit IDs or 9 digit IDs
-			const (
-				rptIDMin     = 100000
-				rptIDMax     = 999999
-				hotspotIDMin = 100000000
-				hotspotIDMax = 999999999
-				userIDMin    = 1000000
-				userIDMax    = 9999999
-			)
-			if (packet.Dst >= rptIDMin && packet.Dst <= rptIDMax) || (packet.Dst >= hotspotIDMin && packet.Dst <= hotspotIDMax) {
-				// This is to a repeater
-				exists, err := models.RepeaterIDExists(s.DB, packet.Dst)
-				if err != nil {
-					logging.Errorf("Error checking if repeater exists: %s", err)
-				}
-				if !exists {
-					logging.Errorf("Repeater %d does not exist", packet.Dst)
-					return
-				}
-				s.Redis.Redis.Publish(ctx, fmt.Sprintf("hbrp:packets:repeater:%d", packet.Dst), packedBytes)
-			} else if packet.Dst >= userIDMin && packet.Dst <= userIDMax {
-				exists, err := models.UserIDExists(s.DB, packet.Dst)
-				if err != nil {
-					logging.Errorf("Error checking if user exists: %s", err)
-					return
-				}
-				if !exists {
-					logging.Errorf("User %d does not exist", packet.Dst)
-					return
-				}
-				s.doUser(ctx, packet, packedBytes)
-			}
+			s.doPrivate(ctx, packet, remoteAddr, data, newStream)
+		case !packet.GroupCall && isCSBK(packet):
+			// Call alerts and radio checks between users are routed the same as private calls
+			s.doPrivate(ctx, packet, remoteAddr, data, false)
+		case !packet.GroupCall && isData:
+			s.doPrivateData(ctx, packet, remoteAddr, data)
 		case isData:
 			logging.Error("Unhandled data packet type")
 		default:
@@ -457,6 +475,37 @@ func (s *Server) handleDMRDPacket(ctx context.Context, remoteAddr net.UDPAddr, d
 	}
 }
 
+// allowedOnTalkgroup keeps repeaters that aren't on a private talkgroup's allowlist from
+// transmitting on it, before the call can reach bridges, peers, or subscribers
+func (s *Server) allowedOnTalkgroup(ctx context.Context, packet models.Packet, repeaterID uint, newStream bool) bool {
+	allowed, err := s.allowlist.allows(repeaterID, packet, time.Now())
+	if err != nil {
+		logging.Errorf("Error checking talkgroup %d allowlist: %s", packet.Dst, err)
+		return false
+	}
+	if !allowed && newStream {
+		routing.Record(ctx, s.Redis.Redis, packet.StreamID, routing.Decision{Target: routing.TargetTalkgroup, TargetID: packet.Dst, Reason: routing.ReasonPrivateTalkgroup})
+		s.rejectStream(ctx, repeaterID, packet.StreamID, routing.ReasonPrivateTalkgroup)
+	}
+	return allowed
+}
+
+// egressPeers sends a packet to every OpenBridge peer whose rules allow it
+func (s *Server) egressPeers(ctx context.Context, packet models.Packet, newStream bool) {
+	peers := models.ListPeers(s.DB)
+	var decisions []routing.Decision
+	for _, p := range peers {
+		egress := rules.PeerShouldEgress(s.DB, p, &packet)
+		if egress {
+			s.sendOpenBridgePacket(ctx, p.ID, packet)
+		}
+		if newStream {
+			decisions = append(decisions, routing.Decision{Target: routing.TargetPeer, TargetID: p.ID, Delivered: egress, Reason: routing.ReasonPeerRules})
+		}
+	}
+	routing.Record(ctx, s.Redis.Redis, packet.StreamID, decisions...)
+}
+
 func (s *Server) handleRPTOPacket(ctx context.Context, remoteAddr net.UDPAddr, data []byte) {
 	ctx, span := otel.Tracer("DMRHub").Start(ctx, "Server.handleRPTOPacket")
 	defer span.End()
@@ -480,35 +529,25 @@ func (s *Server) handleRPTOPacket(ctx context.Context, remoteAddr net.UDPAddr, d
 	if s.validRepeater(ctx, repeaterID, "YES", remoteAddr) {
 		s.Redis.UpdateRepeaterPing(ctx, repeaterID)
 
-		repeaterExists, err := models.RepeaterIDExists(s.DB, repeaterID)
-		if err != nil {
-			logging.Errorf("Error finding repeater: %s", err)
-			return
-		}
-
-		if !repeaterExists {
+		dbRepeater, err := models.FindRepeaterByID(s.DB, repeaterID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
 			logging.Error("Repeater does not exist")
 			return
-		}
-
-		dbRepeater, err := models.FindRepeaterByID(s.DB, repeaterID)
-		if err != nil {
+		} else if err != nil {
 			logging.Errorf("Error finding repeater: %s", err)
 			return
 		}
-		dbRepeater.LastPing = time.Now()
-		err = s.DB.Save(&dbRepeater).Error
-		if err != nil {
-			logging.Errorf("Error saving repeater: %s", err)
-			return
-		}
+
+		s.Writes.TouchRepeater(repeaterID, time.Now())
 
 		// Options is a string from data[8:]
 		options := string(data[8:])
 		logging.Logf("Received Options from repeater %d: %s", repeaterID, options)
 
 		// https://github.com/g4klx/MMDVMHost/blob/master/DMRplus_startup_options.md
-		// Options are not yet supported
+		// Only the DMRHub KEEPALIVE and CODECS options are supported
+		s.negotiateKeepalive(ctx, dbRepeater, options)
+		s.negotiateCodecs(ctx, repeaterID, options)
 	}
 }
 
@@ -550,6 +589,12 @@ func (s *Server) handleRPTLPacket(ctx context.Context, remoteAddr net.UDPAddr, d
 			logging.Errorf("Error finding repeater: %s", err)
 			return
 		}
+		if repeater.Network != "" && s.Listeners.NetworkOf(&remoteAddr) != repeater.Network {
+			// Don't answer over a path the repeater isn't meant to use
+			logging.Errorf("Repeater ID %d must log in over network %s, ignoring login from %s", repeaterID, repeater.Network, remoteAddr.String())
+			return
+		}
+		s.Listeners.Pin(&remoteAddr, repeater.Network)
 
 		bigSalt, err := rand.Int(rand.Reader, big.NewInt(max32Bit))
 		if err != nil {
@@ -569,7 +614,14 @@ func (s *Server) handleRPTLPacket(ctx context.Context, remoteAddr net.UDPAddr, d
 		} else {
 			copy(saltBytes[:], bigSalt.Bytes())
 		}
-		s.sendCommand(ctx, repeaterID, dmrconst.CommandRPTACK, saltBytes[:])
+		s.simulcast.challengeSent(repeaterID)
+		s.links.forget(repeaterID)
+		ack := saltBytes[:]
+		if advertised := advertisedExtensions(); advertised != 0 {
+			// Standard clients only read the salt, so this is safe to send to everyone
+			ack = append(ack, extensionBlock(advertised)...)
+		}
+		s.sendCommand(ctx, repeaterID, dmrconst.CommandRPTACK, ack)
 		s.Redis.UpdateRepeaterConnection(ctx, repeaterID, "CHALLENGE_SENT")
 	}
 }
@@ -646,6 +698,7 @@ func (s *Server) handleRPTKPacket(ctx context.Context, remoteAddr net.UDPAddr, d
 		hash := sha256.Sum256(append(saltBytes, []byte(password)...))
 		calcedSalt := binary.BigEndian.Uint32(hash[:])
 		if calcedSalt == rxSalt {
+			s.simulcast.challengeAnswered(ctx, repeaterID)
 			logging.Logf("Repeater ID %d authed, sending ACK", repeaterID)
 			s.Redis.UpdateRepeaterConnection(ctx, repeaterID, "WAITING_CONFIG")
 			s.sendCommand(ctx, repeaterID, dmrconst.CommandRPTACK, repeaterIDBytes)
@@ -655,6 +708,7 @@ func (s *Server) handleRPTKPacket(ctx context.Context, remoteAddr net.UDPAddr, d
 			}()
 		} else {
 			s.sendCommand(ctx, repeaterID, dmrconst.CommandMSTNAK, repeaterIDBytes)
+			events.Publish(ctx, s.Redis.Redis, events.RepeaterAuthFailed, fmt.Sprintf("Repeater %d failed authentication", repeaterID), map[string]any{"repeater_id": repeaterID, "ip": remoteAddr.IP.String()})
 		}
 	} else {
 		s.sendCommand(ctx, repeaterID, dmrconst.CommandMSTNAK, repeaterIDBytes)
@@ -680,15 +734,34 @@ func (s *Server) handleRPTCLPacket(ctx context.Context, remoteAddr net.UDPAddr,
 	if !s.Redis.DeleteRepeater(ctx, repeaterID) {
 		logging.Errorf("Repeater ID %d not deleted", repeaterID)
 	}
+	s.links.forget(repeaterID)
+	err := models.CloseRepeaterSessions(s.DB, repeaterID, time.Now())
+	if err != nil {
+		logging.Errorf("Error closing uptime session for repeater %d: %v", repeaterID, err)
+	}
+	hubevents.Record(models.HubEvent{Kind: models.HubEventRepeaterDeactivated, RepeaterID: repeaterID})
+	events.Publish(ctx, s.Redis.Redis, events.RepeaterDisconnected, fmt.Sprintf("Repeater %d disconnected", repeaterID), map[string]any{"repeater_id": repeaterID})
 }
 
 func (s *Server) handleRPTCPacket(ctx context.Context, remoteAddr net.UDPAddr, data []byte) {
 	ctx, span := otel.Tracer("DMRHub").Start(ctx, "Server.handleRPTCPacket")
 	defer span.End()
 
-	// RPTC packets are 302 bytes long
+	// RPTC packets are 302 bytes long, plus an extension block from DMRHub-aware clients
 	const rptcLen = 302
-	if len(data) != rptcLen {
+	var extensions dmrconst.Extension
+	extended := false
+	switch len(data) {
+	case rptcLen:
+	case rptcLen + extensionBlockLength:
+		requested, ok := parseExtensionBlock(data[rptcLen:])
+		if !ok {
+			logging.Error("Invalid RPTC extension block")
+			return
+		}
+		extensions = negotiateExtensions(requested)
+		extended = true
+	default:
 		logging.Errorf("Invalid RPTC packet length: %d", len(data))
 		return
 	}
@@ -713,18 +786,30 @@ func (s *Server) handleRPTCPacket(ctx context.Context, remoteAddr net.UDPAddr, d
 			return
 		}
 
+		dbRepeater, err := models.FindRepeaterByID(s.DB, repeaterID)
+		if err != nil {
+			logging.Errorf("Error finding repeater: %v", err)
+			s.sendCommand(ctx, repeaterID, dmrconst.CommandMSTNAK, repeaterIDBytes)
+			return
+		}
+		dbRepeater.UpdateFromRedis(repeater)
+		if !s.checkBandPlan(ctx, dbRepeater) {
+			s.sendCommand(ctx, repeaterID, dmrconst.CommandMSTNAK, repeaterIDBytes)
+			return
+		}
+
 		repeater.Connected = time.Now()
 		repeater.LastPing = time.Now()
 		repeater.Connection = "YES"
+		repeater.Extensions = uint32(extensions)
+		s.Listeners.SetMaxDatagram(&remoteAddr, int(dbRepeater.MaxDatagram))
 
 		s.Redis.StoreRepeater(ctx, repeaterID, repeater)
 		logging.Logf("Repeater ID %d (%s) connected\n", repeaterID, repeater.Callsign)
-		s.sendCommand(ctx, repeaterID, dmrconst.CommandRPTACK, repeaterIDBytes)
-		dbRepeater, err := models.FindRepeaterByID(s.DB, repeaterID)
-		if err != nil {
-			logging.Errorf("Error finding repeater: %v", err)
-			s.sendCommand(ctx, repeaterID, dmrconst.CommandMSTNAK, repeaterIDBytes)
-			return
+		if extended {
+			s.sendCommand(ctx, repeaterID, dmrconst.CommandRPTACK, append(repeaterIDBytes[:len(repeaterIDBytes):len(repeaterIDBytes)], extensionBlock(extensions)...))
+		} else {
+			s.sendCommand(ctx, repeaterID, dmrconst.CommandRPTACK, repeaterIDBytes)
 		}
 		dbRepeater.UpdateFromRedis(repeater)
 		err = s.DB.Save(&dbRepeater).Error
@@ -733,11 +818,150 @@ func (s *Server) handleRPTCPacket(ctx context.Context, remoteAddr net.UDPAddr, d
 			s.sendCommand(ctx, repeaterID, dmrconst.CommandMSTNAK, repeaterIDBytes)
 			return
 		}
+		err = models.OpenRepeaterSession(s.DB, repeaterID, repeater.Connected)
+		if err != nil {
+			logging.Errorf("Error opening uptime session for repeater %d: %v", repeaterID, err)
+		}
+		if dbRepeater.Hotspot && !dbRepeater.SkipTalkgroupProfile {
+			// The profile is written off the UDP goroutine, and pushes the talkgroup list itself once applied
+			go s.applyTalkgroupProfile(ctx, dbRepeater)
+		} else if extensions&dmrconst.ExtensionTalkgroupList != 0 {
+			GetSubscriptionManager(s.DB).pushTalkgroups(ctx, s.Redis.Redis, repeaterID)
+		}
+		go s.deliverDeferred(ctx, repeaterID)
+		s.sendFailoverMasters(ctx, repeaterID)
+		hubevents.Record(models.HubEvent{Kind: models.HubEventRepeaterActivated, RepeaterID: repeaterID})
+		events.Publish(ctx, s.Redis.Redis, events.RepeaterConnected, fmt.Sprintf("Repeater %d (%s) connected", repeaterID, repeater.Callsign), map[string]any{"repeater_id": repeaterID, "callsign": repeater.Callsign})
 	} else {
 		s.sendCommand(ctx, repeaterID, dmrconst.CommandMSTNAK, repeaterIDBytes)
 	}
 }
 
+// handleDHFLPacket resumes a session another master started, for a hotspot that negotiated
+// ExtensionFailover and was sent here by a DHFO. The session lives in the shared Redis, so the
+// hotspot skips the RPTL/RPTK/RPTC exchange and keeps its salt, config, and negotiated extensions.
+// A hotspot that gets a MSTNAK back logs in from scratch.
+func (s *Server) handleDHFLPacket(ctx context.Context, remoteAddr net.UDPAddr, data []byte) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "Server.handleDHFLPacket")
+	defer span.End()
+
+	// DHFL packets are 8 bytes long + a 32 byte sha256 hash
+	const dhflLen = 8 + sha256.Size
+	if len(data) != dhflLen {
+		logging.Errorf("Invalid DHFL packet length: %d", len(data))
+		return
+	}
+	repeaterIDBytes := data[4:8]
+	repeaterID := uint(binary.BigEndian.Uint32(repeaterIDBytes))
+	logging.Logf("Failover login from Repeater ID: %d", repeaterID)
+
+	// Until the session is resumed, Redis still points at the old address
+	nak := func() {
+		publishCommand(ctx, s.Redis.Redis, models.Repeater{IP: remoteAddr.IP.String(), Port: remoteAddr.Port}, dmrconst.CommandMSTNAK, repeaterIDBytes)
+	}
+
+	if !s.Redis.RepeaterExists(ctx, repeaterID) {
+		logging.Errorf("Repeater ID %d has no session to resume", repeaterID)
+		nak()
+		return
+	}
+	repeater, err := s.Redis.GetRepeater(ctx, repeaterID)
+	if err != nil {
+		logging.Errorf("Error getting repeater from Redis: %v", err)
+		nak()
+		return
+	}
+	if repeater.Connection != "YES" || dmrconst.Extension(repeater.Extensions)&dmrconst.ExtensionFailover == 0 {
+		logging.Errorf("Repeater ID %d session can't be resumed", repeaterID)
+		nak()
+		return
+	}
+
+	dbRepeater, err := models.FindRepeaterByID(s.DB, repeaterID)
+	if err != nil {
+		logging.Errorf("Error finding repeater: %v", err)
+		nak()
+		return
+	}
+	proof := failoverProof(repeater.Salt, dbRepeater.Password)
+	if dbRepeater.Password == "" || subtle.ConstantTimeCompare(proof[:], data[8:]) != 1 {
+		nak()
+		events.Publish(ctx, s.Redis.Redis, events.RepeaterAuthFailed, fmt.Sprintf("Repeater %d failed failover authentication", repeaterID), map[string]any{"repeater_id": repeaterID, "ip": remoteAddr.IP.String()})
+		return
+	}
+	if dbRepeater.Network != "" && s.Listeners.NetworkOf(&remoteAddr) != dbRepeater.Network {
+		// Don't answer over a path the repeater isn't meant to use
+		logging.Errorf("Repeater ID %d must log in over network %s, ignoring failover from %s", repeaterID, dbRepeater.Network, remoteAddr.String())
+		return
+	}
+	s.Listeners.Pin(&remoteAddr, dbRepeater.Network)
+	s.Listeners.SetMaxDatagram(&remoteAddr, int(dbRepeater.MaxDatagram))
+
+	repeater.IP = remoteAddr.IP.String()
+	repeater.Port = remoteAddr.Port
+	repeater.LastPing = time.Now()
+	s.Redis.StoreRepeater(ctx, repeaterID, repeater)
+	s.links.forget(repeaterID)
+	logging.Logf("Repeater ID %d (%s) resumed its session", repeaterID, repeater.Callsign)
+	s.sendCommand(ctx, repeaterID, dmrconst.CommandRPTACK, repeaterIDBytes)
+
+	if dmrconst.Extension(repeater.Extensions)&dmrconst.ExtensionTalkgroupList != 0 {
+		GetSubscriptionManager(s.DB).pushTalkgroups(ctx, s.Redis.Redis, repeaterID)
+	}
+	s.sendFailoverMasters(ctx, repeaterID)
+	events.Publish(ctx, s.Redis.Redis, events.RepeaterConnected, fmt.Sprintf("Repeater %d (%s) failed over", repeaterID, repeater.Callsign), map[string]any{"repeater_id": repeaterID, "callsign": repeater.Callsign, "failover": true})
+}
+
+// checkBandPlan validates a repeater's reported configuration, logging any problems.
+// It returns false if the repeater should be refused because BAND_PLAN_ENFORCE is set.
+func (s *Server) checkBandPlan(ctx context.Context, repeater models.Repeater) bool {
+	result := bandplan.Validate(repeater)
+	if result.Valid {
+		return true
+	}
+	for _, issue := range result.Issues {
+		logging.Errorf("Repeater %d (%s) configuration: %s", repeater.ID, repeater.Callsign, issue.Message)
+	}
+	if !config.GetConfig().BandPlanEnforce {
+		return true
+	}
+	events.Publish(ctx, s.Redis.Redis, events.RepeaterRejected, fmt.Sprintf("Repeater %d (%s) refused: %s", repeater.ID, repeater.Callsign, result.Issues[0].Message), map[string]any{"repeater_id": repeater.ID, "issues": result.Issues})
+	return false
+}
+
+// applyTalkgroupProfile sets a hotspot's static talkgroups from its owner's talkgroup profile,
+// then pushes the resulting talkgroup list to hotspots that negotiated ExtensionTalkgroupList
+func (s *Server) applyTalkgroupProfile(ctx context.Context, dbRepeater models.Repeater) {
+	defer GetSubscriptionManager(s.DB).pushTalkgroups(ctx, s.Redis.Redis, dbRepeater.ID)
+
+	profile, ok, err := models.FindTalkgroupProfileForUser(s.DB, dbRepeater.OwnerID)
+	if err != nil {
+		logging.Errorf("Error finding talkgroup profile for user %d: %v", dbRepeater.OwnerID, err)
+		return
+	}
+	if !ok {
+		return
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&dbRepeater).Association("TS1StaticTalkgroups").Replace(profile.TS1StaticTalkgroups); err != nil {
+			return fmt.Errorf("TS1: %w", err)
+		}
+		if err := tx.Model(&dbRepeater).Association("TS2StaticTalkgroups").Replace(profile.TS2StaticTalkgroups); err != nil {
+			return fmt.Errorf("TS2: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		logging.Errorf("Error applying talkgroup profile to repeater %d: %v", dbRepeater.ID, err)
+		return
+	}
+
+	logging.Logf("Applied talkgroup profile of user %d to hotspot %d", dbRepeater.OwnerID, dbRepeater.ID)
+	GetSubscriptionManager(s.DB).CancelAllRepeaterSubscriptions(dbRepeater.ID)
+	go GetSubscriptionManager(s.DB).ListenForCalls(s.Redis.Redis, dbRepeater.ID)
+}
+
 func (s *Server) handleRPTPINGPacket(ctx context.Context, remoteAddr net.UDPAddr, data []byte) {
 	ctx, span := otel.Tracer("DMRHub").Start(ctx, "Server.handleRPTPINGPacket")
 	defer span.End()
@@ -756,17 +980,7 @@ func (s *Server) handleRPTPINGPacket(ctx context.Context, remoteAddr net.UDPAddr
 
 	if s.validRepeater(ctx, repeaterID, "YES", remoteAddr) {
 		s.Redis.UpdateRepeaterPing(ctx, repeaterID)
-		dbRepeater, err := models.FindRepeaterByID(s.DB, repeaterID)
-		if err != nil {
-			// No repeater found, drop
-			logging.Errorf("No repeater found for ID %d", repeaterID)
-			return
-		}
-		dbRepeater.LastPing = time.Now()
-		err = s.DB.Save(&dbRepeater).Error
-		if err != nil {
-			logging.Errorf("Error saving repeater to database: %s", err)
-		}
+		s.Writes.TouchRepeater(repeaterID, time.Now())
 
 		repeater, err := s.Redis.GetRepeater(ctx, repeaterID)
 		if err != nil {
@@ -775,8 +989,58 @@ func (s *Server) handleRPTPINGPacket(ctx context.Context, remoteAddr net.UDPAddr
 		}
 		repeater.PingsReceived++
 		s.Redis.StoreRepeater(ctx, repeaterID, repeater)
+		s.links.ping(ctx, repeaterID, time.Now())
 		s.sendCommand(ctx, repeaterID, dmrconst.CommandMSTPONG, repeaterIDBytes)
 	} else {
 		s.sendCommand(ctx, repeaterID, dmrconst.CommandMSTNAK, repeaterIDBytes)
 	}
 }
+
+// recordOfflineRepeaters explains why repeaters carrying a talkgroup didn't get a stream because they were offline.
+// Online repeaters record their own decisions as the stream reaches their subscriptions.
+func (s *Server) recordOfflineRepeaters(ctx context.Context, packet models.Packet) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "Server.recordOfflineRepeaters")
+	defer span.End()
+
+	repeaterIDs, err := models.ListRepeaterIDsWantingTalkgroup(s.DB, packet.Dst)
+	if err != nil {
+		logging.Errorf("Error listing repeaters for talkgroup %d: %v", packet.Dst, err)
+		return
+	}
+	var decisions []routing.Decision
+	for _, repeaterID := range repeaterIDs {
+		if !s.Redis.RepeaterExists(ctx, repeaterID) {
+			decisions = append(decisions, routing.Decision{Target: routing.TargetRepeater, TargetID: repeaterID, Reason: routing.ReasonOffline})
+		}
+	}
+	routing.Record(ctx, s.Redis.Redis, packet.StreamID, decisions...)
+}
+
+// autoCreateTalkgroup creates a talkgroup the first time an unknown ID is keyed.
+// Group calls to repeater IDs are left alone.
+func (s *Server) autoCreateTalkgroup(ctx context.Context, talkgroupID uint) {
+	repeaterExists, err := models.RepeaterIDExists(s.DB, talkgroupID)
+	if err != nil {
+		logging.Errorf("Error checking if repeater %d exists: %s", talkgroupID, err)
+		return
+	}
+	if repeaterExists {
+		return
+	}
+
+	pending := config.GetConfig().AutoCreateNeedsApproval
+	created, err := models.AutoCreateTalkgroup(s.DB, talkgroupID, pending)
+	if err != nil {
+		logging.Errorf("Error auto-creating talkgroup %d: %s", talkgroupID, err)
+		return
+	}
+	if !created {
+		return
+	}
+	logging.Logf("Auto-created talkgroup %d", talkgroupID)
+	message := fmt.Sprintf("Talkgroup %d was created on first use", talkgroupID)
+	if pending {
+		message = fmt.Sprintf("Talkgroup %d was created on first use and is awaiting approval", talkgroupID)
+	}
+	events.Publish(ctx, s.Redis.Redis, events.TalkgroupAutoCreated, message, map[string]any{"talkgroup_id": talkgroupID, "pending_approval": pending})
+}
@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"go.opentelemetry.io/otel"
+)
+
+// scheduleParrotPlayback plays a finished parrot call back after parrotDelay. Playback stays
+// in-process rather than on the job queue: it's only worth hearing right after the call, so
+// it shouldn't wait behind other jobs or be replayed after a restart.
+func (s *Server) scheduleParrotPlayback(ctx context.Context, streamID uint, repeaterID uint) {
+	go func() {
+		time.Sleep(parrotDelay)
+		s.playParrot(ctx, streamID, repeaterID)
+	}()
+}
+
+func (s *Server) playParrot(ctx context.Context, streamID uint, repeaterID uint) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "Server.playParrot")
+	defer span.End()
+
+	packets := s.Parrot.GetStream(ctx, streamID)
+	// Track the duration of the call to ensure that we send out packets right on the 60ms boundary
+	// This is to ensure that the DMR repeater doesn't drop the packet
+	startedTime := time.Now()
+	for _, pkt := range packets {
+		s.sendPacket(ctx, repeaterID, pkt)
+		s.TrackCall(ctx, pkt, true)
+		// Calculate the time since the call started
+		elapsed := time.Since(startedTime)
+		const packetTiming = 60 * time.Millisecond
+		// If elapsed is greater than 60ms, we're behind and need to catch up
+		if elapsed > packetTiming {
+			logging.Errorf("Parrot call took too long to send, elapsed: %s", elapsed)
+			// Sleep for 60ms minus the difference between the elapsed time and 60ms
+			time.Sleep(packetTiming - (elapsed - packetTiming))
+		} else {
+			// Now subtract the elapsed time from 60ms to get the true delay
+			delay := packetTiming - elapsed
+			time.Sleep(delay)
+		}
+		startedTime = time.Now()
+	}
+}
@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"slices"
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v3"
+)
+
+// privateHuntIdle is how long a conversation may go quiet before the next call starts a new hunt
+const privateHuntIdle = 30 * time.Second
+
+// huntKey identifies a hunt by who is calling whom
+type huntKey struct {
+	caller uint
+	callee uint
+}
+
+type privateHunt struct {
+	candidates []uint
+	started    time.Time
+	lastSeen   time.Time
+	// answeredOn is the repeater the callee keyed up on, 0 while still hunting
+	answeredOn uint
+}
+
+// privateCallRinger hunts for a user across their repeaters, one at a time, until they answer.
+// A hunt spans every over between the two users, so a caller keying up again continues where
+// the last over left off, and once the callee answers their repeater gets the rest of the conversation.
+type privateCallRinger struct {
+	timeout time.Duration
+	hunts   *xsync.MapOf[huntKey, privateHunt]
+}
+
+func newPrivateCallRinger(timeout time.Duration) *privateCallRinger {
+	return &privateCallRinger{
+		timeout: timeout,
+		hunts:   xsync.NewMapOf[huntKey, privateHunt](),
+	}
+}
+
+// privateCallCandidates orders the repeaters a private call may be delivered to: the last-heard
+// repeater first, then the owned repeaters by ID. Offline repeaters and duplicates are dropped.
+func privateCallCandidates(lastHeard uint, owned []uint, online func(uint) bool) []uint {
+	candidates := make([]uint, 0, len(owned)+1)
+	if lastHeard != 0 && online(lastHeard) {
+		candidates = append(candidates, lastHeard)
+	}
+	sorted := slices.Clone(owned)
+	slices.Sort(sorted)
+	for _, id := range slices.Compact(sorted) {
+		if id != lastHeard && online(id) {
+			candidates = append(candidates, id)
+		}
+	}
+	return candidates
+}
+
+// ringTarget is the candidate that should be ringing after elapsed, wrapping back to the first
+// once every repeater has had its turn
+func ringTarget(candidates []uint, elapsed, timeout time.Duration) (uint, bool) {
+	if len(candidates) == 0 {
+		return 0, false
+	}
+	if timeout <= 0 || elapsed < 0 {
+		return candidates[0], true
+	}
+	return candidates[int(elapsed/timeout)%len(candidates)], true
+}
+
+// target returns the repeater a packet from caller to callee should go to. The candidates are only
+// computed when a hunt starts so the order stays stable for the whole conversation.
+func (r *privateCallRinger) target(caller, callee uint, now time.Time, candidates func() []uint) (uint, bool) {
+	key := huntKey{caller: caller, callee: callee}
+	hunt, loaded := r.hunts.Load(key)
+	if !loaded || now.Sub(hunt.lastSeen) > privateHuntIdle {
+		r.sweep(now)
+		hunt = privateHunt{candidates: candidates(), started: now}
+	}
+	hunt.lastSeen = now
+	r.hunts.Store(key, hunt)
+	if hunt.answeredOn != 0 {
+		return hunt.answeredOn, true
+	}
+	return ringTarget(hunt.candidates, now.Sub(hunt.started), r.timeout)
+}
+
+// heard records a private call from src to dst on repeaterID, which answers dst's hunt for src
+func (r *privateCallRinger) heard(src, dst, repeaterID uint, now time.Time) {
+	key := huntKey{caller: dst, callee: src}
+	hunt, loaded := r.hunts.Load(key)
+	if loaded && now.Sub(hunt.lastSeen) > privateHuntIdle {
+		loaded = false
+	}
+	if !loaded {
+		hunt = privateHunt{started: now}
+	}
+	hunt.answeredOn = repeaterID
+	hunt.lastSeen = now
+	r.hunts.Store(key, hunt)
+}
+
+// sweep drops hunts for conversations that have gone quiet
+func (r *privateCallRinger) sweep(now time.Time) {
+	r.hunts.Range(func(key huntKey, hunt privateHunt) bool {
+		if now.Sub(hunt.lastSeen) > privateHuntIdle {
+			r.hunts.Delete(key)
+		}
+		return true
+	})
+}
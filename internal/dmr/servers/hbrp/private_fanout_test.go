@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPrivateCallCandidates(t *testing.T) {
+	t.Parallel()
+	online := func(id uint) bool { return id != 3 }
+	got := privateCallCandidates(5, []uint{4, 3, 5, 1, 4}, online)
+	if !slices.Equal(got, []uint{5, 1, 4}) {
+		t.Errorf("Expected last-heard first then online owned repeaters, got %v", got)
+	}
+	got = privateCallCandidates(3, []uint{1}, online)
+	if !slices.Equal(got, []uint{1}) {
+		t.Errorf("Expected an offline last-heard repeater to be skipped, got %v", got)
+	}
+	if got := privateCallCandidates(0, nil, online); len(got) != 0 {
+		t.Errorf("Expected no candidates, got %v", got)
+	}
+}
+
+func TestRingTarget(t *testing.T) {
+	t.Parallel()
+	candidates := []uint{7, 8, 9}
+	for elapsed, want := range map[time.Duration]uint{
+		0:                7,
+		4 * time.Second:  8,
+		9 * time.Second:  9,
+		12 * time.Second: 7,
+	} {
+		got, ok := ringTarget(candidates, elapsed, 4*time.Second)
+		if !ok || got != want {
+			t.Errorf("After %s expected %d, got %d", elapsed, want, got)
+		}
+	}
+	if _, ok := ringTarget(nil, 0, time.Second); ok {
+		t.Error("Expected no target without candidates")
+	}
+}
+
+func TestPrivateCallRingerHuntsUntilAnswered(t *testing.T) {
+	t.Parallel()
+	ringer := newPrivateCallRinger(time.Second)
+	const caller, callee = 100, 200
+	calls := 0
+	candidates := func() []uint {
+		calls++
+		return []uint{1, 2, 3}
+	}
+	start := time.Now()
+	if target, _ := ringer.target(caller, callee, start, candidates); target != 1 {
+		t.Errorf("Expected first repeater to ring, got %d", target)
+	}
+	// The caller unkeys and tries again, the hunt carries on instead of starting over
+	if target, _ := ringer.target(caller, callee, start.Add(1500*time.Millisecond), candidates); target != 2 {
+		t.Errorf("Expected second repeater after the timeout, got %d", target)
+	}
+	if calls != 1 {
+		t.Errorf("Expected candidates to be computed once per hunt, got %d", calls)
+	}
+
+	// The callee answers on a repeater, and the conversation stays there
+	ringer.heard(callee, caller, 2, start.Add(2*time.Second))
+	if target, _ := ringer.target(caller, callee, start.Add(5*time.Second), candidates); target != 2 {
+		t.Errorf("Expected the repeater the callee answered on, got %d", target)
+	}
+	// The caller was heard too, so the reply goes straight back to them
+	ringer.heard(caller, callee, 9, start.Add(5*time.Second))
+	if target, _ := ringer.target(callee, caller, start.Add(6*time.Second), candidates); target != 9 {
+		t.Errorf("Expected the reply to go to the caller's repeater, got %d", target)
+	}
+	if calls != 1 {
+		t.Errorf("Expected answered hunts not to look up candidates, got %d", calls)
+	}
+
+	// A conversation that went quiet starts a new hunt
+	later := start.Add(6*time.Second + privateHuntIdle + time.Second)
+	if target, _ := ringer.target(caller, callee, later, candidates); target != 1 {
+		t.Errorf("Expected a new hunt to start at the first repeater, got %d", target)
+	}
+	ringer.sweep(later)
+	if _, ok := ringer.hunts.Load(huntKey{caller: callee, callee: caller}); ok {
+		t.Error("Expected idle hunts to be swept")
+	}
+}
@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"go.opentelemetry.io/otel"
+)
+
+// ProbeResult is the outcome of a repeater connection test
+type ProbeResult string
+
+const (
+	// ProbeAlive means the repeater sent a keepalive during the test
+	ProbeAlive ProbeResult = "alive"
+	// ProbeSilent means the repeater didn't send a keepalive before the test timed out
+	ProbeSilent ProbeResult = "silent"
+	// ProbeOffline means the repeater isn't logged in
+	ProbeOffline ProbeResult = "offline"
+)
+
+// Probe is the report of a repeater connection test
+type Probe struct {
+	Result     ProbeResult `json:"result"`
+	WaitMicros int64       `json:"wait_us"`
+}
+
+const probePollInterval = 250 * time.Millisecond
+
+// ProbeRepeater checks that a logged in repeater is still alive by waiting for its next keepalive.
+// This only shows that traffic from the repeater reaches the hub. HBRP has nothing a repeater
+// echoes back, so whether the hub's own traffic reaches the repeater can't be tested from here.
+// It can be called from outside the server, such as from the API.
+func ProbeRepeater(ctx context.Context, redis *servers.RedisClient, repeaterID uint, timeout time.Duration) Probe {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "hbrp.ProbeRepeater")
+	defer span.End()
+
+	if !redis.RepeaterExists(ctx, repeaterID) {
+		return Probe{Result: ProbeOffline}
+	}
+	repeater, err := redis.GetRepeater(ctx, repeaterID)
+	if err != nil || repeater.Connection != "YES" {
+		return Probe{Result: ProbeOffline}
+	}
+
+	start := time.Now()
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	alive := waitForPing(waitCtx, repeater.PingsReceived, probePollInterval, func() (uint, bool) {
+		current, err := redis.GetRepeater(ctx, repeaterID)
+		if err != nil {
+			return 0, false
+		}
+		return current.PingsReceived, true
+	})
+	if !alive {
+		return Probe{Result: ProbeSilent}
+	}
+	return Probe{Result: ProbeAlive, WaitMicros: time.Since(start).Microseconds()}
+}
+
+// waitForPing polls the repeater's keepalive count until it moves past baseline, reporting
+// false if the context ends first or the repeater goes away.
+func waitForPing(ctx context.Context, baseline uint, interval time.Duration, pings func() (uint, bool)) bool {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+			count, ok := pings()
+			if !ok {
+				return false
+			}
+			if count != baseline {
+				return true
+			}
+		}
+	}
+}
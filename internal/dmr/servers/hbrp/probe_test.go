@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWaitForPingSeesNewKeepalive(t *testing.T) {
+	t.Parallel()
+	polls := 0
+	alive := waitForPing(context.Background(), 7, time.Millisecond, func() (uint, bool) {
+		polls++
+		if polls < 3 {
+			return 7, true
+		}
+		return 8, true
+	})
+	if !alive || polls != 3 {
+		t.Errorf("Expected a keepalive on the third poll, got alive=%v polls=%d", alive, polls)
+	}
+}
+
+func TestWaitForPingTimesOut(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	alive := waitForPing(ctx, 7, time.Millisecond, func() (uint, bool) {
+		return 7, true
+	})
+	if alive {
+		t.Error("Expected no keepalive from a repeater that never pings")
+	}
+}
+
+func TestWaitForPingStopsWhenRepeaterLeaves(t *testing.T) {
+	t.Parallel()
+	alive := waitForPing(context.Background(), 7, time.Millisecond, func() (uint, bool) {
+		return 0, false
+	})
+	if alive {
+		t.Error("Expected no keepalive from a repeater that went away")
+	}
+}
@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/routing"
+	"github.com/puzpuzpuz/xsync/v3"
+)
+
+// quotaIdle is how long a blocked stream may go without packets before it is forgotten
+const quotaIdle = 10 * time.Second
+
+// blockedStreams remembers streams turned away by a talkgroup quota. They are never call
+// tracked, so this is what keeps their later bursts from being checked as new streams.
+type blockedStreams struct {
+	streams *xsync.MapOf[uint, *atomic.Int64]
+}
+
+func newBlockedStreams() *blockedStreams {
+	return &blockedStreams{
+		streams: xsync.NewMapOf[uint, *atomic.Int64](),
+	}
+}
+
+func (b *blockedStreams) block(streamID uint, now time.Time) {
+	lastSeen := &atomic.Int64{}
+	lastSeen.Store(now.UnixNano())
+	b.streams.Store(streamID, lastSeen)
+	b.sweep(now)
+}
+
+// blocked reports whether a stream was blocked, keeping it remembered while it is on the air
+func (b *blockedStreams) blocked(streamID uint, now time.Time) bool {
+	lastSeen, ok := b.streams.Load(streamID)
+	if ok {
+		lastSeen.Store(now.UnixNano())
+	}
+	return ok
+}
+
+// sweep forgets streams that have ended
+func (b *blockedStreams) sweep(now time.Time) {
+	b.streams.Range(func(streamID uint, lastSeen *atomic.Int64) bool {
+		if now.Sub(time.Unix(0, lastSeen.Load())) > quotaIdle {
+			b.streams.Delete(streamID)
+		}
+		return true
+	})
+}
+
+// quotaBlocks checks a new stream to a talkgroup against the user's quota before it is tracked,
+// so a user over their quota doesn't have the blocked call recorded or counted against them
+func (s *Server) quotaBlocks(ctx context.Context, packet models.Packet, repeaterID uint, newStream bool) bool {
+	if !newStream {
+		return s.quotaBlocked.blocked(packet.StreamID, time.Now())
+	}
+	if !s.CallTracker.QuotaBlocks(ctx, packet) {
+		return false
+	}
+	s.quotaBlocked.block(packet.StreamID, time.Now())
+	routing.Record(ctx, s.Redis.Redis, packet.StreamID, routing.Decision{Target: routing.TargetTalkgroup, TargetID: packet.Dst, Reason: routing.ReasonQuota})
+	s.rejectStream(ctx, repeaterID, packet.StreamID, routing.ReasonQuota)
+	return true
+}
@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/calltracker"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+)
+
+// Not parallel, see makeTestDB
+func TestQuotaBlocksBeforeTracking(t *testing.T) {
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.Call{}, &models.TalkgroupQuota{}, &models.NotificationPreferences{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	_, redis := fakeredis.New(t)
+	server := MakeServer(db, redis, servers.MakeRedisClient(redis), calltracker.NewCallTracker(db, redis), "test", "test")
+	ctx := context.Background()
+
+	over := models.User{ID: 3118661, Callsign: "N0OVER", Username: "n0over", Approved: true}
+	under := models.User{ID: 3118662, Callsign: "N0UNDR", Username: "n0undr", Approved: true}
+	db.Save(&over)
+	db.Save(&under)
+	talkgroup := models.Talkgroup{ID: 3866, Name: "Quota"}
+	db.Save(&talkgroup)
+	db.Create(&models.TalkgroupQuota{TalkgroupID: talkgroup.ID, DailySeconds: 60, Enforce: true})
+	tg := talkgroup.ID
+	db.Create(&models.Call{UserID: over.ID, IsToTalkgroup: true, ToTalkgroupID: &tg, StartTime: time.Now(), Duration: time.Minute})
+	var before int64
+	db.Model(&models.Call{}).Count(&before)
+
+	packet := models.Packet{Src: over.ID, Dst: talkgroup.ID, GroupCall: true, StreamID: 3866, Repeater: 311001, FrameType: dmrconst.FrameDataSync, DTypeOrVSeq: uint(dmrconst.DTypeVoiceHead)}
+	if !server.quotaBlocks(ctx, packet, 311001, !server.streamActive(ctx, packet)) {
+		t.Fatal("Expected a user over an enforced quota to be blocked")
+	}
+	// Later bursts are remembered as blocked rather than checked as new streams
+	packet.Seq, packet.FrameType, packet.DTypeOrVSeq = 1, dmrconst.FrameVoiceSync, dmrconst.VoiceA
+	if !server.streamActive(ctx, packet) {
+		t.Error("Expected later bursts of a blocked stream not to be new")
+	}
+	if !server.quotaBlocks(ctx, packet, 311001, false) {
+		t.Error("Expected later bursts of a blocked stream to stay blocked")
+	}
+	if server.CallTracker.IsCallActive(ctx, packet) {
+		t.Error("Expected a blocked stream not to be tracked")
+	}
+	var after int64
+	db.Model(&models.Call{}).Count(&after)
+	if after != before {
+		t.Errorf("Expected no call to be recorded for a blocked stream, got %d new", after-before)
+	}
+
+	packet = models.Packet{Src: under.ID, Dst: talkgroup.ID, GroupCall: true, StreamID: 3867, Repeater: 311001, FrameType: dmrconst.FrameDataSync, DTypeOrVSeq: uint(dmrconst.DTypeVoiceHead)}
+	if server.quotaBlocks(ctx, packet, 311001, true) {
+		t.Error("Expected a user under the quota not to be blocked")
+	}
+}
+
+func TestBlockedStreamsForgetEndedStreams(t *testing.T) {
+	t.Parallel()
+	streams := newBlockedStreams()
+	now := time.Now()
+	streams.block(1, now)
+	if !streams.blocked(1, now.Add(quotaIdle/2)) {
+		t.Fatal("Expected the stream to be blocked")
+	}
+	streams.block(2, now.Add(quotaIdle*2))
+	if streams.blocked(1, now.Add(quotaIdle*2)) {
+		t.Error("Expected an idle stream to be forgotten")
+	}
+}
@@ -23,15 +23,24 @@ import (
 	"context"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"net"
+	"sync/atomic"
+	"time"
 
 	"github.com/USA-RedDragon/DMRHub/internal/config"
 	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/db/writebehind"
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/calltracker"
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/ingress"
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/parrot"
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/events"
+	"github.com/USA-RedDragon/DMRHub/internal/hubevents"
+	"github.com/USA-RedDragon/DMRHub/internal/inhibit"
 	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/pubsub"
 	"github.com/redis/go-redis/v9"
 	"go.opentelemetry.io/otel"
 	"gorm.io/gorm"
@@ -39,42 +48,59 @@ import (
 
 // Server is the DMR server.
 type Server struct {
-	Buffer        []byte
-	SocketAddress net.UDPAddr
-	Server        *net.UDPConn
+	Listeners     *servers.UDPListeners
 	Started       bool
 	Parrot        *parrot.Parrot
 	DB            *gorm.DB
 	Redis         *servers.RedisClient
 	CallTracker   *calltracker.CallTracker
+	IngressFilter ingress.Filter
+	Quarantine    *ingress.Quarantine
+	Writes        *writebehind.Writer
 	Version       string
 	Commit        string
+	simulcast     *simulcastScheduler
+	ringer        *privateCallRinger
+	links         *linkMonitor
+	dedup         *packetDeduper
+	allowlist     *streamAllowlist
+	occupancy     *occupancyMonitor
+	audioTests    *audioTester
+	quotaBlocked  *blockedStreams
+	draining      *atomic.Bool
 }
 
 var (
-	ErrOpenSocket   = errors.New("Error opening socket")
-	ErrSocketBuffer = errors.New("Error setting socket buffer size")
+	ErrOpenSocket = errors.New("Error opening socket")
 )
 
-const largestMessageSize = 302
+// An RPTC with an extension block is the largest packet a repeater sends
+const largestMessageSize = 302 + extensionBlockLength
 const repeaterIDLength = 4
 const bufferSize = 1000000 // 1MB
 
 // MakeServer creates a new DMR server.
 func MakeServer(db *gorm.DB, redis *redis.Client, redisClient *servers.RedisClient, callTracker *calltracker.CallTracker, version, commit string) Server {
 	return Server{
-		Buffer: make([]byte, largestMessageSize),
-		SocketAddress: net.UDPAddr{
-			IP:   net.ParseIP(config.GetConfig().ListenAddr),
-			Port: config.GetConfig().DMRPort,
-		},
-		Started:     false,
-		Parrot:      parrot.NewParrot(redis),
-		DB:          db,
-		Redis:       redisClient,
-		CallTracker: callTracker,
-		Version:     version,
-		Commit:      commit,
+		Started:       false,
+		Parrot:        parrot.NewParrot(redis),
+		DB:            db,
+		Redis:         redisClient,
+		CallTracker:   callTracker,
+		IngressFilter: ingress.NewFilter(ingress.ProtocolHBRP),
+		Quarantine:    ingress.NewQuarantine(ingress.ProtocolHBRP, redis),
+		Writes:        writebehind.NewWriter(db, config.GetConfig().WriteBehindInterval, config.GetConfig().WriteBehindQueueSize),
+		Version:       version,
+		Commit:        commit,
+		simulcast:     newSimulcastScheduler(db, redisClient),
+		ringer:        newPrivateCallRinger(config.GetConfig().PrivateCallRingTimeout),
+		links:         newLinkMonitor(redisClient),
+		dedup:         newPacketDeduper(),
+		allowlist:     newStreamAllowlist(db),
+		occupancy:     newOccupancyMonitor(redisClient),
+		audioTests:    newAudioTester(config.GetConfig().CallWatchdogTimeout),
+		quotaBlocked:  newBlockedStreams(),
+		draining:      &atomic.Bool{},
 	}
 }
 
@@ -97,24 +123,30 @@ func (s *Server) Stop(ctx context.Context) {
 		binary.BigEndian.PutUint32(repeaterBinary, uint32(repeater))
 		s.sendCommand(ctx, repeater, dmrconst.CommandMSTCL, repeaterBinary)
 	}
+	s.Writes.Flush()
 	s.Started = false
 }
 
 func (s *Server) listen(ctx context.Context) {
-	pubsub := s.Redis.Redis.Subscribe(ctx, "hbrp:incoming")
+	subscription := s.Redis.Redis.Subscribe(ctx, "hbrp:incoming")
 	defer func() {
-		err := pubsub.Close()
+		err := subscription.Close()
 		if err != nil {
 			logging.Errorf("Error closing pubsub: %v", err)
 		}
 	}()
-	pubsubChannel := pubsub.Channel()
+	pubsubChannel := pubsub.Receive(ctx, subscription, "hbrp")
 	for {
 		select {
 		case <-ctx.Done():
 			logging.Log("Stopping HBRP server")
 			return
-		case msg := <-pubsubChannel:
+		case msg, ok := <-pubsubChannel:
+			if !ok {
+				// Closed once ctx is done, the case above cleans up
+				pubsubChannel = nil
+				continue
+			}
 			var packet models.RawDMRPacket
 			_, err := packet.UnmarshalMsg([]byte(msg.Payload))
 			if err != nil {
@@ -130,39 +162,36 @@ func (s *Server) listen(ctx context.Context) {
 }
 
 func (s *Server) subscribePackets(ctx context.Context) {
-	pubsub := s.Redis.Redis.Subscribe(ctx, "hbrp:outgoing")
+	subscription := s.Redis.Redis.Subscribe(ctx, "hbrp:outgoing")
 	defer func() {
-		err := pubsub.Close()
+		err := subscription.Close()
 		if err != nil {
 			logging.Errorf("Error closing pubsub: %v", err)
 		}
 	}()
-	for msg := range pubsub.Channel() {
+	for msg := range pubsub.Receive(ctx, subscription, "hbrp") {
 		var packet models.RawDMRPacket
 		_, err := packet.UnmarshalMsg([]byte(msg.Payload))
 		if err != nil {
 			logging.Errorf("Error unmarshalling packet: %v", err)
 			continue
 		}
-		_, err = s.Server.WriteToUDP(packet.Data, &net.UDPAddr{
+		s.send(ctx, packet.Data, &net.UDPAddr{
 			IP:   net.ParseIP(packet.RemoteIP),
 			Port: packet.RemotePort,
 		})
-		if err != nil {
-			logging.Errorf("Error sending packet: %v", err)
-		}
 	}
 }
 
 func (s *Server) subscribeRawPackets(ctx context.Context) {
-	pubsub := s.Redis.Redis.Subscribe(ctx, "hbrp:outgoing:noaddr")
+	subscription := s.Redis.Redis.Subscribe(ctx, "hbrp:outgoing:noaddr")
 	defer func() {
-		err := pubsub.Close()
+		err := subscription.Close()
 		if err != nil {
 			logging.Errorf("Error closing pubsub: %v", err)
 		}
 	}()
-	for msg := range pubsub.Channel() {
+	for msg := range pubsub.Receive(ctx, subscription, "hbrp") {
 		packet, ok := models.UnpackPacket([]byte(msg.Payload))
 		if !ok {
 			logging.Error("Error unpacking packet")
@@ -173,13 +202,12 @@ func (s *Server) subscribeRawPackets(ctx context.Context) {
 			logging.Errorf("Error getting repeater %d from redis", packet.Repeater)
 			continue
 		}
-		_, err = s.Server.WriteToUDP(packet.Encode(), &net.UDPAddr{
+		s.occupancy.burst(ctx, packet.Repeater, packet.Slot, time.Now())
+		watermarkVoice(&packet, packet.Repeater)
+		s.simulcast.send(ctx, packet.Repeater, packet.Encode(), &net.UDPAddr{
 			IP:   net.ParseIP(repeater.IP),
 			Port: repeater.Port,
 		})
-		if err != nil {
-			logging.Errorf("Error sending packet: %v", err)
-		}
 	}
 }
 
@@ -187,55 +215,51 @@ func (s *Server) subscribeRawPackets(ctx context.Context) {
 func (s *Server) Start(ctx context.Context) error {
 	ctx, span := otel.Tracer("DMRHub").Start(ctx, "Server.Start")
 	defer span.End()
-	server, err := net.ListenUDP("udp", &s.SocketAddress)
+	listeners, err := servers.ListenUDP("hbrp", config.GetConfig().HBRPListen, bufferSize)
 	if err != nil {
 		logging.Errorf("Error opening UDP Socket: %v", err)
 		return ErrOpenSocket
 	}
 
-	err = server.SetReadBuffer(bufferSize)
-	if err != nil {
-		logging.Errorf("Error setting read buffer on UDP Socket: %v", err)
-		return ErrSocketBuffer
+	s.Listeners = listeners
+	s.simulcast.write = func(data []byte, addr *net.UDPAddr) {
+		s.send(ctx, data, addr)
 	}
-	err = server.SetWriteBuffer(bufferSize)
-	if err != nil {
-		logging.Errorf("Error setting write buffer on UDP Socket: %v", err)
-		return ErrSocketBuffer
+	s.CallTracker.OnTruncated(s.routeTerminator)
+	if inhibitor := inhibit.Default(); inhibitor != nil {
+		inhibitor.OnChange(s.enforceInhibits)
 	}
-
-	s.Server = server
 	s.Started = true
 
-	logging.Errorf("HBRP Server listening at %s on port %d", s.SocketAddress.IP.String(), s.SocketAddress.Port)
+	for _, addr := range s.Listeners.Addrs() {
+		logging.Errorf("HBRP Server listening at %s", addr)
+	}
 
 	go s.listen(ctx)
 	go s.subscribePackets(ctx)
 	go s.subscribeRawPackets(ctx)
+	go s.Quarantine.Listen(ctx)
+	go s.Writes.Run(ctx)
+	go s.occupancy.run(ctx)
 
-	go func() {
-		for {
-			length, remoteaddr, err := s.Server.ReadFromUDP(s.Buffer)
-			if err != nil {
-				logging.Errorf("Error reading from UDP Socket, Swallowing Error: %v", err)
-				continue
-			}
-			if config.GetConfig().Debug {
-				logging.Logf("Read a message from %v\n", remoteaddr)
-			}
-			p := models.RawDMRPacket{
-				Data:       s.Buffer[:length],
-				RemoteIP:   remoteaddr.IP.String(),
-				RemotePort: remoteaddr.Port,
-			}
-			packedBytes, err := p.MarshalMsg(nil)
-			if err != nil {
-				logging.Errorf("Error marshalling packet: %v", err)
-				return
-			}
-			s.Redis.Redis.Publish(ctx, "hbrp:incoming", packedBytes)
+	s.Listeners.Serve(largestMessageSize, func(data []byte, remoteaddr *net.UDPAddr) bool {
+		return s.Quarantine.Allow(remoteaddr, data) && s.IngressFilter.Allow(remoteaddr, data)
+	}, func(data []byte, remoteaddr *net.UDPAddr) {
+		if config.GetConfig().Debug {
+			logging.Logf("Read a message from %v\n", remoteaddr)
 		}
-	}()
+		p := models.RawDMRPacket{
+			Data:       data,
+			RemoteIP:   remoteaddr.IP.String(),
+			RemotePort: remoteaddr.Port,
+		}
+		packedBytes, err := p.MarshalMsg(nil)
+		if err != nil {
+			logging.Errorf("Error marshalling packet: %v", err)
+			return
+		}
+		s.Redis.Redis.Publish(ctx, "hbrp:incoming", packedBytes)
+	})
 
 	return nil
 }
@@ -248,23 +272,44 @@ func (s *Server) sendCommand(ctx context.Context, repeaterIDBytes uint, command
 	if config.GetConfig().Debug {
 		logging.Logf("Sending Command %s to Repeater ID: %d", command, repeaterIDBytes)
 	}
-	commandPrefixedData := append([]byte(command), data...)
 	repeater, err := s.Redis.GetRepeater(ctx, repeaterIDBytes)
 	if err != nil {
 		logging.Errorf("Error getting repeater from Redis: %v", err)
 		return
 	}
+	publishCommand(ctx, s.Redis.Redis, repeater, command, data)
+}
+
+// DisconnectRepeater sends a MSTCL to a connected repeater and removes its session.
+// It can be called from outside the server, such as from the API.
+func DisconnectRepeater(ctx context.Context, redis *servers.RedisClient, repeaterID uint) bool {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "hbrp.DisconnectRepeater")
+	defer span.End()
+
+	if !redis.RepeaterExists(ctx, repeaterID) {
+		return false
+	}
+	repeater, err := redis.GetRepeater(ctx, repeaterID)
+	if err != nil {
+		logging.Errorf("Error getting repeater from Redis: %v", err)
+		return false
+	}
+	repeaterBinary := make([]byte, repeaterIDLength)
+	binary.BigEndian.PutUint32(repeaterBinary, uint32(repeaterID))
 	p := models.RawDMRPacket{
-		Data:       commandPrefixedData,
+		Data:       append([]byte(dmrconst.CommandMSTCL), repeaterBinary...),
 		RemoteIP:   repeater.IP,
 		RemotePort: repeater.Port,
 	}
 	packedBytes, err := p.MarshalMsg(nil)
 	if err != nil {
 		logging.Errorf("Error marshalling packet: %v", err)
-		return
+		return false
 	}
-	s.Redis.Redis.Publish(ctx, "hbrp:outgoing", packedBytes)
+	redis.Redis.Publish(ctx, "hbrp:outgoing", packedBytes)
+	hubevents.Record(models.HubEvent{Kind: models.HubEventRepeaterDeactivated, RepeaterID: repeaterID})
+	events.Publish(ctx, redis.Redis, events.RepeaterDisconnected, fmt.Sprintf("Repeater %d was disconnected by an admin", repeaterID), map[string]any{"repeater_id": repeaterID})
+	return redis.DeleteRepeater(ctx, repeaterID)
 }
 
 func (s *Server) sendOpenBridgePacket(ctx context.Context, repeaterIDBytes uint, packet models.Packet) {
@@ -308,6 +353,7 @@ func (s *Server) sendPacket(ctx context.Context, repeaterIDBytes uint, packet mo
 		logging.Errorf("Error getting repeater from Redis: %v", err)
 		return
 	}
+	watermarkVoice(&packet, repeaterIDBytes)
 	p := models.RawDMRPacket{
 		Data:       packet.Encode(),
 		RemoteIP:   repeater.IP,
@@ -350,6 +396,8 @@ func (s *Server) handlePacket(ctx context.Context, remoteAddr net.UDPAddr, data
 		}
 	case dmrconst.CommandRPTPING[:4]:
 		s.handleRPTPINGPacket(ctx, remoteAddr, data)
+	case dmrconst.CommandDHFL:
+		s.handleDHFLPacket(ctx, remoteAddr, data)
 	// I don't think we ever receive these
 	case dmrconst.CommandRPTACK[:4]:
 		logging.Error("TODO: RPTACK")
@@ -365,3 +413,24 @@ func (s *Server) handlePacket(ctx context.Context, remoteAddr net.UDPAddr, data
 		logging.Errorf("Unknown command: %s", dmrconst.Command(data[:4]))
 	}
 }
+
+// Drain stops the server from accepting new streams, calls already on the air carry on
+func (s *Server) Drain() {
+	if !s.draining.Swap(true) {
+		logging.Logf("Rejecting new streams, waiting on %d active calls", s.CallTracker.InFlightCalls())
+	}
+}
+
+// ActiveStreams returns how many calls are still on the air
+func (s *Server) ActiveStreams() int {
+	return s.CallTracker.InFlightCalls()
+}
+
+// QueueDepths reports the work buffered by the Homebrew server
+func (s *Server) QueueDepths() map[string]int {
+	return map[string]int{
+		"in_flight_calls": s.CallTracker.InFlightCalls(),
+		"subscriptions":   GetSubscriptionManager(s.DB).Count(),
+		"write_behind":    s.Writes.Pending(),
+	}
+}
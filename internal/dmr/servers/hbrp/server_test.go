@@ -52,6 +52,9 @@ func TestMakeServerInitialization(t *testing.T) {
 	if server.Commit != commit {
 		t.Errorf("Expected Commit to be %s, got %s", commit, server.Commit)
 	}
+	if server.Writes == nil {
+		t.Error("Expected Writes to be initialized")
+	}
 	if server.Started {
 		t.Error("Expected Started to be false")
 	}
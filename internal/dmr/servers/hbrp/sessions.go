@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"gorm.io/gorm"
+)
+
+// ExportSessions snapshots the login state of every connected repeater along
+// with its dynamic talkgroups, for ImportSessions on a replacement instance
+func ExportSessions(ctx context.Context, db *gorm.DB, redis *servers.RedisClient, now time.Time) (apimodels.RepeaterSessionSnapshot, error) {
+	snapshot := apimodels.RepeaterSessionSnapshot{TakenAt: now, Sessions: []apimodels.RepeaterSessionExport{}}
+	ids, err := redis.ListRepeaters(ctx)
+	if err != nil {
+		return snapshot, fmt.Errorf("failed to list connected repeaters: %w", err)
+	}
+	repeaters, err := models.ListRepeatersForSubscriptions(db)
+	if err != nil {
+		return snapshot, fmt.Errorf("failed to list repeaters: %w", err)
+	}
+	dynamic := make(map[uint]models.Repeater, len(repeaters))
+	for _, repeater := range repeaters {
+		dynamic[repeater.ID] = repeater
+	}
+
+	for _, id := range ids {
+		session, err := redis.GetRepeater(ctx, id)
+		if err != nil {
+			// Logged out since it was listed
+			continue
+		}
+		state, err := session.MarshalMsg(nil)
+		if err != nil {
+			return snapshot, fmt.Errorf("failed to encode repeater %d: %w", id, err)
+		}
+		snapshot.Sessions = append(snapshot.Sessions, apimodels.RepeaterSessionExport{
+			RepeaterID:            id,
+			State:                 state,
+			TS1DynamicTalkgroupID: dynamic[id].TS1DynamicTalkgroupID,
+			TS2DynamicTalkgroupID: dynamic[id].TS2DynamicTalkgroupID,
+		})
+	}
+	return snapshot, nil
+}
+
+// ImportSessions restores the sessions in a snapshot, so repeaters that were logged
+// in to a failed instance keep working against this one without logging in again.
+// Sessions for repeaters that aren't in the database are skipped. It returns how many
+// sessions were restored.
+func ImportSessions(ctx context.Context, db *gorm.DB, redis *servers.RedisClient, snapshot apimodels.RepeaterSessionSnapshot) (int, error) {
+	restored := 0
+	var errs []error
+	for _, export := range snapshot.Sessions {
+		var session models.Repeater
+		_, err := session.UnmarshalMsg(export.State)
+		if err != nil || session.ID != export.RepeaterID {
+			errs = append(errs, fmt.Errorf("session for repeater %d is corrupt", export.RepeaterID))
+			continue
+		}
+		repeater, err := models.FindRepeaterByID(db, export.RepeaterID)
+		if err != nil {
+			logging.Logf("Not importing session for repeater %d, it isn't in the database", export.RepeaterID)
+			continue
+		}
+
+		redis.StoreRepeater(ctx, repeater.ID, session)
+		errs = append(errs,
+			restoreDynamicTalkgroup(db, redis, &repeater, export.TS1DynamicTalkgroupID, dmrconst.TimeslotOne),
+			restoreDynamicTalkgroup(db, redis, &repeater, export.TS2DynamicTalkgroupID, dmrconst.TimeslotTwo))
+		go GetSubscriptionManager(db).ListenForCalls(redis.Redis, repeater.ID) //nolint:golint,contextcheck
+		restored++
+	}
+	logging.Logf("Imported %d of %d repeater sessions taken at %s", restored, len(snapshot.Sessions), snapshot.TakenAt)
+	return restored, errors.Join(errs...)
+}
+
+func restoreDynamicTalkgroup(db *gorm.DB, redis *servers.RedisClient, repeater *models.Repeater, talkgroupID *uint, slot dmrconst.Timeslot) error {
+	if talkgroupID == nil {
+		return nil
+	}
+	talkgroup, err := models.FindTalkgroupByID(db, *talkgroupID)
+	if err != nil {
+		// Deleted since the snapshot was taken
+		return nil
+	}
+	_, err = GetSubscriptionManager(db).LinkDynamicTalkgroup(redis.Redis, repeater, talkgroup, slot)
+	if err != nil {
+		return fmt.Errorf("failed to link repeater %d to talkgroup %d: %w", repeater.ID, talkgroup.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+)
+
+// Not parallel, see makeTestDB
+func TestSessionsRoundTrip(t *testing.T) {
+	db := makeTestDB(t)
+	ctx := context.Background()
+	const repeaterID = 311860150
+	talkgroupID := uint(3100)
+
+	owner := models.User{ID: 3118601, Callsign: "N0CALL", Username: "n0call", Approved: true}
+	if err := db.Save(&owner).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Save(&models.Talkgroup{ID: talkgroupID, Name: "Texas"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	repeater := models.Repeater{OwnerID: owner.ID, TS2DynamicTalkgroupID: &talkgroupID}
+	repeater.ID = repeaterID
+	if err := db.Save(&repeater).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	_, failedClient := fakeredis.New(t)
+	failed := servers.MakeRedisClient(failedClient)
+	session := models.Repeater{Connection: "YES", IP: "192.0.2.10", Port: 62031, Salt: 0xdeadbeef, Extensions: 3}
+	session.ID = repeaterID
+	failed.StoreRepeater(ctx, repeaterID, session)
+
+	snapshot, err := ExportSessions(ctx, db, failed, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Sessions) != 1 {
+		t.Fatalf("Expected one session, got %d", len(snapshot.Sessions))
+	}
+	export := snapshot.Sessions[0]
+	if export.RepeaterID != repeaterID || export.TS2DynamicTalkgroupID == nil || *export.TS2DynamicTalkgroupID != talkgroupID {
+		t.Errorf("Unexpected export: %+v", export)
+	}
+
+	// The replacement instance lost the link along with the failed one
+	if err := db.Model(&models.Repeater{}).Where("id = ?", repeaterID).Update("ts2_dynamic_talkgroup_id", nil).Error; err != nil {
+		t.Fatal(err)
+	}
+	_, replacementClient := fakeredis.New(t)
+	replacement := servers.MakeRedisClient(replacementClient)
+	restored, err := ImportSessions(ctx, db, replacement, snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored != 1 {
+		t.Errorf("Expected one session restored, got %d", restored)
+	}
+
+	imported, err := replacement.GetRepeater(ctx, repeaterID)
+	if err != nil {
+		t.Fatalf("Expected the session in Redis: %v", err)
+	}
+	if imported.Connection != "YES" || imported.IP != session.IP || imported.Port != session.Port || imported.Salt != session.Salt || imported.Extensions != session.Extensions {
+		t.Errorf("Imported session doesn't match the exported one: %+v", imported)
+	}
+	relinked, err := models.FindRepeaterByID(db, repeaterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if relinked.TS2DynamicTalkgroupID == nil || *relinked.TS2DynamicTalkgroupID != talkgroupID {
+		t.Errorf("Expected TS2 relinked to %d, got %v", talkgroupID, relinked.TS2DynamicTalkgroupID)
+	}
+}
+
+// Not parallel, see makeTestDB
+func TestImportSessionsSkipsBadSessions(t *testing.T) {
+	db := makeTestDB(t)
+	ctx := context.Background()
+	_, client := fakeredis.New(t)
+	redis := servers.MakeRedisClient(client)
+
+	unknown := models.Repeater{Connection: "YES"}
+	unknown.ID = 311860199
+	state, err := unknown.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := apimodels.RepeaterSessionSnapshot{TakenAt: time.Now(), Sessions: []apimodels.RepeaterSessionExport{
+		{RepeaterID: 311860198, State: []byte("not a session")},
+		{RepeaterID: unknown.ID, State: state},
+	}}
+
+	restored, err := ImportSessions(ctx, db, redis, snapshot)
+	if err == nil {
+		t.Error("Expected an error for the corrupt session")
+	}
+	if restored != 0 {
+		t.Errorf("Expected nothing restored, got %d", restored)
+	}
+	if redis.RepeaterExists(ctx, unknown.ID) {
+		t.Error("Expected no session for a repeater that isn't in the database")
+	}
+}
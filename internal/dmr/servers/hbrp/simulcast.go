@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/puzpuzpuz/xsync/v3"
+	"gorm.io/gorm"
+)
+
+const simulcastQueueSize = 500
+const simulcastCacheTime = 10 * time.Second
+
+type scheduledPacket struct {
+	deadline time.Time
+	data     []byte
+	addr     *net.UDPAddr
+}
+
+type simulcastTiming struct {
+	enabled bool
+	delay   time.Duration
+	expires time.Time
+}
+
+// simulcastScheduler holds egress to repeaters in simulcast groups. Each packet waits for the
+// group's window less the repeater's measured latency, so every member transmits the same burst together.
+type simulcastScheduler struct {
+	db         *gorm.DB
+	redis      *servers.RedisClient
+	write      func(data []byte, addr *net.UDPAddr)
+	queues     *xsync.MapOf[uint, chan scheduledPacket]
+	timings    *xsync.MapOf[uint, simulcastTiming]
+	challenges *xsync.MapOf[uint, time.Time]
+}
+
+// newSimulcastScheduler creates a scheduler, write must be set before packets are sent
+func newSimulcastScheduler(db *gorm.DB, redis *servers.RedisClient) *simulcastScheduler {
+	return &simulcastScheduler{
+		db:         db,
+		redis:      redis,
+		queues:     xsync.NewMapOf[uint, chan scheduledPacket](),
+		timings:    xsync.NewMapOf[uint, simulcastTiming](),
+		challenges: xsync.NewMapOf[uint, time.Time](),
+	}
+}
+
+// simulcastDelay is how long to hold a packet so it reaches the repeater at the end of the window
+func simulcastDelay(window, latency time.Duration) time.Duration {
+	if latency >= window {
+		return 0
+	}
+	return window - latency
+}
+
+// challengeSent notes when a login challenge went out so the answer can be timed
+func (s *simulcastScheduler) challengeSent(repeaterID uint) {
+	s.challenges.Store(repeaterID, time.Now())
+}
+
+// challengeAnswered measures the repeater's latency as half the challenge round trip
+func (s *simulcastScheduler) challengeAnswered(ctx context.Context, repeaterID uint) {
+	sent, ok := s.challenges.LoadAndDelete(repeaterID)
+	if !ok {
+		return
+	}
+	latency := time.Since(sent) / 2 //nolint:golint,gomnd
+	s.redis.StoreRepeaterLatency(ctx, repeaterID, latency)
+	latencyHistogram.Observe(latency.Seconds())
+	s.timings.Delete(repeaterID)
+	if config.GetConfig().Debug {
+		logging.Logf("Measured %s latency to repeater %d", latency, repeaterID)
+	}
+}
+
+func (s *simulcastScheduler) timing(ctx context.Context, repeaterID uint) simulcastTiming {
+	if timing, ok := s.timings.Load(repeaterID); ok && time.Now().Before(timing.expires) {
+		return timing
+	}
+	timing := simulcastTiming{expires: time.Now().Add(simulcastCacheTime)}
+	window, enabled, err := models.FindSimulcastWindow(s.db, repeaterID, config.GetConfig().SimulcastWindow)
+	if err != nil {
+		logging.Errorf("Error finding simulcast window for repeater %d: %v", repeaterID, err)
+	} else if enabled {
+		latency, _ := s.redis.GetRepeaterLatency(ctx, repeaterID)
+		timing.enabled = true
+		timing.delay = simulcastDelay(window, latency)
+	}
+	s.timings.Store(repeaterID, timing)
+	return timing
+}
+
+// send writes a packet to a repeater, holding it first if the repeater is part of a simulcast group
+func (s *simulcastScheduler) send(ctx context.Context, repeaterID uint, data []byte, addr *net.UDPAddr) {
+	timing := s.timing(ctx, repeaterID)
+	if !timing.enabled {
+		s.write(data, addr)
+		return
+	}
+	queue, loaded := s.queues.LoadOrCompute(repeaterID, func() chan scheduledPacket {
+		return make(chan scheduledPacket, simulcastQueueSize)
+	})
+	if !loaded {
+		go s.drain(ctx, repeaterID, queue)
+	}
+	select {
+	case queue <- scheduledPacket{deadline: time.Now().Add(timing.delay), data: data, addr: addr}:
+	default:
+		logging.Errorf("Simulcast queue for repeater %d is full, sending without delay", repeaterID)
+		s.write(data, addr)
+	}
+}
+
+// drain sends a repeater's held packets in order as each one's time comes
+func (s *simulcastScheduler) drain(ctx context.Context, repeaterID uint, queue chan scheduledPacket) {
+	defer s.queues.Delete(repeaterID)
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case packet := <-queue:
+			if wait := time.Until(packet.deadline); wait > 0 {
+				timer.Reset(wait)
+				select {
+				case <-ctx.Done():
+					return
+				case <-timer.C:
+				}
+			}
+			s.write(packet.data, packet.addr)
+		}
+	}
+}
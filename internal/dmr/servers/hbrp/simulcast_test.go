@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSimulcastDelay(t *testing.T) {
+	t.Parallel()
+	if delay := simulcastDelay(250*time.Millisecond, 40*time.Millisecond); delay != 210*time.Millisecond {
+		t.Errorf("Expected 210ms, got %s", delay)
+	}
+	if delay := simulcastDelay(250*time.Millisecond, 300*time.Millisecond); delay != 0 {
+		t.Errorf("Expected repeaters slower than the window not to be held, got %s", delay)
+	}
+}
+
+func TestSimulcastSchedulerHoldsInOrder(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var sent []byte
+	var sentAt []time.Time
+	scheduler := newSimulcastScheduler(nil, nil)
+	scheduler.write = func(data []byte, _ *net.UDPAddr) {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, data...)
+		sentAt = append(sentAt, time.Now())
+	}
+
+	const repeaterID = 311001
+	const delay = 20 * time.Millisecond
+	scheduler.timings.Store(repeaterID, simulcastTiming{enabled: true, delay: delay, expires: time.Now().Add(time.Hour)})
+	scheduler.timings.Store(311002, simulcastTiming{expires: time.Now().Add(time.Hour)})
+
+	start := time.Now()
+	for i := byte(1); i <= 3; i++ {
+		scheduler.send(ctx, repeaterID, []byte{i}, nil)
+	}
+	scheduler.send(ctx, 311002, []byte{9}, nil)
+
+	time.Sleep(5 * delay)
+	mu.Lock()
+	defer mu.Unlock()
+	if string(sent) != string([]byte{9, 1, 2, 3}) {
+		t.Fatalf("Expected the unheld packet first and the rest in order, got %v", sent)
+	}
+	if held := sentAt[1].Sub(start); held < delay {
+		t.Errorf("Expected packets to be held for %s, sent after %s", delay, held)
+	}
+}
@@ -23,12 +23,18 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/USA-RedDragon/DMRHub/internal/config"
 	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/codec"
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/routing"
 	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/hubevents"
 	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/pubsub"
 	"github.com/puzpuzpuz/xsync/v3"
 	"github.com/redis/go-redis/v9"
 	"go.opentelemetry.io/otel"
@@ -40,6 +46,8 @@ var subscriptionManager *SubscriptionManager //nolint:golint,gochecknoglobals
 type SubscriptionManager struct {
 	// stores map[uint]context.CancelFunc indexed by strconv.Itoa(int(radioID))
 	subscriptions *xsync.MapOf[uint, *xsync.MapOf[uint, *context.CancelFunc]]
+	mutes         *xsync.MapOf[muteKey, time.Time]
+	bridges       *xsync.MapOf[uint, *context.CancelFunc]
 	db            *gorm.DB
 }
 
@@ -47,6 +55,8 @@ func GetSubscriptionManager(db *gorm.DB) *SubscriptionManager {
 	if subscriptionManager == nil {
 		subscriptionManager = &SubscriptionManager{
 			subscriptions: xsync.NewMapOf[uint, *xsync.MapOf[uint, *context.CancelFunc]](),
+			mutes:         xsync.NewMapOf[muteKey, time.Time](),
+			bridges:       xsync.NewMapOf[uint, *context.CancelFunc](),
 			db:            db,
 		}
 	}
@@ -110,6 +120,9 @@ func (m *SubscriptionManager) CancelAllRepeaterSubscriptions(repeaterID uint) {
 	if config.GetConfig().Debug {
 		logging.Errorf("Cancelling all subscriptions for repeater %d", repeaterID)
 	}
+	if cancel, ok := m.bridges.LoadAndDelete(repeaterID); ok {
+		(*cancel)()
+	}
 	radioSubs, ok := m.subscriptions.Load(repeaterID)
 	if !ok {
 		return
@@ -121,6 +134,16 @@ func (m *SubscriptionManager) CancelAllRepeaterSubscriptions(repeaterID uint) {
 	})
 }
 
+// Count returns how many pubsub subscriptions are open for repeaters
+func (m *SubscriptionManager) Count() int {
+	count := m.bridges.Size()
+	m.subscriptions.Range(func(_ uint, radioSubs *xsync.MapOf[uint, *context.CancelFunc]) bool {
+		count += radioSubs.Size()
+		return true
+	})
+	return count
+}
+
 func (m *SubscriptionManager) ListenForCallsOn(redis *redis.Client, repeaterID uint, talkgroupID uint) {
 	_, span := otel.Tracer("DMRHub").Start(context.Background(), "SubscriptionManager.ListenForCallsOn")
 	defer span.End()
@@ -132,7 +155,7 @@ func (m *SubscriptionManager) ListenForCallsOn(redis *redis.Client, repeaterID u
 	if !ok {
 		newCtx, cancel := context.WithCancel(context.Background())
 		radioSubs.Store(talkgroupID, &cancel)
-		go m.subscribeTG(newCtx, redis, repeaterID, talkgroupID) //nolint:golint,contextcheck
+		go m.subscribeTG(newCtx, redis, repeaterID, talkgroupID, nil) //nolint:golint,contextcheck
 	}
 }
 
@@ -144,63 +167,114 @@ func (m *SubscriptionManager) ListenForCalls(redis *redis.Client, repeaterID uin
 	_, span := otel.Tracer("DMRHub").Start(context.Background(), "SubscriptionManager.ListenForCalls")
 	defer span.End()
 
-	_, ok := m.subscriptions.Load(repeaterID)
-	if !ok {
-		m.subscriptions.Store(repeaterID, xsync.NewMapOf[uint, *context.CancelFunc]())
-	}
-
-	radioSubs, ok := m.subscriptions.Load(repeaterID)
-	if !ok {
-		logging.Error("Failed to load radio subscriptions")
-		return
-	}
-
 	p, err := models.FindRepeaterByID(m.db, repeaterID)
 	if err != nil {
 		logging.Errorf("Failed to find repeater %d: %s", repeaterID, err)
 		return
 	}
+	m.listenForRepeater(redis, p, nil)
+	m.pushTalkgroups(context.Background(), redis, repeaterID)
+}
+
+// listenForRepeater opens the subscriptions a repeater needs that aren't open yet.
+// If confirmed is set, it's marked done as Redis acknowledges each new subscription.
+func (m *SubscriptionManager) listenForRepeater(redis *redis.Client, p models.Repeater, confirmed *sync.WaitGroup) {
+	repeaterID := p.ID
+	radioSubs, _ := m.subscriptions.LoadOrStore(repeaterID, xsync.NewMapOf[uint, *context.CancelFunc]())
 
-	_, ok = radioSubs.Load(repeaterID)
+	var ready func()
+	if confirmed != nil {
+		ready = confirmed.Done
+	}
+	start := func(subscribe func(ready func())) {
+		if confirmed != nil {
+			confirmed.Add(1)
+		}
+		go subscribe(ready)
+	}
+
+	_, ok := radioSubs.Load(repeaterID)
 	if !ok {
 		newCtx, cancel := context.WithCancel(context.Background())
 		radioSubs.Store(repeaterID, &cancel)
-		go m.subscribeRepeater(newCtx, redis, repeaterID) //nolint:golint,contextcheck
+		start(func(ready func()) { m.subscribeRepeater(newCtx, redis, repeaterID, ready) }) //nolint:golint,contextcheck
+	}
+
+	_, ok = m.bridges.Load(repeaterID)
+	if !ok {
+		newCtx, cancel := context.WithCancel(context.Background())
+		m.bridges.Store(repeaterID, &cancel)
+		start(func(ready func()) { m.subscribeBridge(newCtx, redis, repeaterID, ready) }) //nolint:golint,contextcheck
 	}
 
 	// Subscribe to Redis "packets:talkgroup:<id>" channel for each talkgroup
-	for _, tg := range p.TS1StaticTalkgroups {
-		_, ok := radioSubs.Load(tg.ID)
-		if !ok {
+	for tgID := range wantedSubscriptions(p) {
+		_, ok := radioSubs.Load(tgID)
+		if !ok && tgID != repeaterID {
 			newCtx, cancel := context.WithCancel(context.Background())
-			radioSubs.Store(tg.ID, &cancel)
-			go m.subscribeTG(newCtx, redis, repeaterID, tg.ID) //nolint:golint,contextcheck
+			radioSubs.Store(tgID, &cancel)
+			start(func(ready func()) { m.subscribeTG(newCtx, redis, repeaterID, tgID, ready) }) //nolint:golint,contextcheck
 		}
 	}
+}
+
+// Talkgroups lists the talkgroups each repeater is subscribed to on this replica
+func (m *SubscriptionManager) Talkgroups() map[uint][]uint {
+	talkgroups := make(map[uint][]uint)
+	m.subscriptions.Range(func(repeaterID uint, radioSubs *xsync.MapOf[uint, *context.CancelFunc]) bool {
+		ids := []uint{}
+		radioSubs.Range(func(id uint, _ *context.CancelFunc) bool {
+			// The repeater's own ID is its private call subscription
+			if id != repeaterID && id != 0 {
+				ids = append(ids, id)
+			}
+			return true
+		})
+		talkgroups[repeaterID] = ids
+		return true
+	})
+	return talkgroups
+}
+
+// ReloadRepeater brings a repeater's subscriptions in line with its saved configuration.
+// Only talkgroups the repeater no longer carries are cancelled and only new ones are
+// subscribed, so calls on unchanged talkgroups aren't interrupted.
+func (m *SubscriptionManager) ReloadRepeater(redis *redis.Client, repeaterID uint) {
+	p, err := models.FindRepeaterByID(m.db, repeaterID)
+	if err != nil {
+		logging.Errorf("Failed to find repeater %d: %s", repeaterID, err)
+		return
+	}
+	if radioSubs, ok := m.subscriptions.Load(repeaterID); ok {
+		wanted := wantedSubscriptions(p)
+		radioSubs.Range(func(tgID uint, cancel *context.CancelFunc) bool {
+			if !wanted[tgID] {
+				radioSubs.Delete(tgID)
+				(*cancel)()
+			}
+			return true
+		})
+	}
+	m.ListenForCalls(redis, repeaterID)
+}
+
+// wantedSubscriptions is the set of subscription keys a repeater should have: its own ID
+// for private calls plus every static and dynamic talkgroup on either slot
+func wantedSubscriptions(p models.Repeater) map[uint]bool {
+	wanted := map[uint]bool{p.ID: true}
+	for _, tg := range p.TS1StaticTalkgroups {
+		wanted[tg.ID] = true
+	}
 	for _, tg := range p.TS2StaticTalkgroups {
-		_, ok := radioSubs.Load(tg.ID)
-		if !ok {
-			newCtx, cancel := context.WithCancel(context.Background())
-			radioSubs.Store(tg.ID, &cancel)
-			go m.subscribeTG(newCtx, redis, repeaterID, tg.ID) //nolint:golint,contextcheck
-		}
+		wanted[tg.ID] = true
 	}
 	if p.TS1DynamicTalkgroupID != nil {
-		_, ok := radioSubs.Load(*p.TS1DynamicTalkgroupID)
-		if !ok {
-			newCtx, cancel := context.WithCancel(context.Background())
-			radioSubs.Store(*p.TS1DynamicTalkgroupID, &cancel)
-			go m.subscribeTG(newCtx, redis, repeaterID, *p.TS1DynamicTalkgroupID) //nolint:golint,contextcheck
-		}
+		wanted[*p.TS1DynamicTalkgroupID] = true
 	}
 	if p.TS2DynamicTalkgroupID != nil {
-		_, ok := radioSubs.Load(*p.TS2DynamicTalkgroupID)
-		if !ok {
-			newCtx, cancel := context.WithCancel(context.Background())
-			radioSubs.Store(*p.TS2DynamicTalkgroupID, &cancel)
-			go m.subscribeTG(newCtx, redis, repeaterID, *p.TS2DynamicTalkgroupID) //nolint:golint,contextcheck
-		}
+		wanted[*p.TS2DynamicTalkgroupID] = true
 	}
+	return wanted
 }
 
 func (m *SubscriptionManager) ListenForWebsocket(ctx context.Context, redis *redis.Client, userID uint) {
@@ -247,6 +321,17 @@ func (m *SubscriptionManager) ListenForWebsocket(ctx context.Context, redis *red
 				continue
 			}
 
+			if call.IsToTalkgroup && call.ToTalkgroup.Private {
+				visible, err := models.TalkgroupVisibleTo(m.db, call.ToTalkgroup.ID, user)
+				if err != nil {
+					logging.Errorf("Error checking talkgroup visibility: %s", err)
+					continue
+				}
+				if !visible {
+					continue
+				}
+			}
+
 			for _, p := range user.Repeaters {
 				want, _ := p.WantRXCall(call)
 				if want || call.User.ID == userID || call.DestinationID == p.OwnerID {
@@ -294,22 +379,37 @@ func (m *SubscriptionManager) ListenForWebsocket(ctx context.Context, redis *red
 	}
 }
 
-func (m *SubscriptionManager) subscribeRepeater(ctx context.Context, redis *redis.Client, repeaterID uint) {
+// confirmSubscription waits for Redis to acknowledge a subscription before calling
+// ready, so packets published after a warm-up finishes aren't missed
+func confirmSubscription(ctx context.Context, subscription *redis.PubSub, ready func()) {
+	if ready == nil {
+		return
+	}
+	defer ready()
+	_, err := subscription.Receive(ctx)
+	if err != nil {
+		logging.Errorf("Error confirming subscription: %s", err)
+	}
+}
+
+func (m *SubscriptionManager) subscribeRepeater(ctx context.Context, redis *redis.Client, repeaterID uint, ready func()) {
 	if config.GetConfig().Debug {
 		logging.Errorf("Listening for calls on repeater %d", repeaterID)
 	}
-	pubsub := redis.Subscribe(ctx, fmt.Sprintf("hbrp:packets:repeater:%d", repeaterID))
+	subscription := redis.Subscribe(ctx, fmt.Sprintf("hbrp:packets:repeater:%d", repeaterID))
 	defer func() {
-		err := pubsub.Unsubscribe(ctx, fmt.Sprintf("hbrp:packets:repeater:%d", repeaterID))
+		err := subscription.Unsubscribe(ctx, fmt.Sprintf("hbrp:packets:repeater:%d", repeaterID))
 		if err != nil {
 			logging.Errorf("Error unsubscribing from hbrp:packets:repeater:%d: %s", repeaterID, err)
 		}
-		err = pubsub.Close()
+		err = subscription.Close()
 		if err != nil {
 			logging.Errorf("Error closing pubsub connection: %s", err)
 		}
 	}()
-	pubsubChannel := pubsub.Channel()
+	confirmSubscription(ctx, subscription, ready)
+	pubsubChannel := pubsub.Receive(ctx, subscription, "repeater")
+	var lastStreamID uint
 	for {
 		select {
 		case <-ctx.Done():
@@ -321,7 +421,12 @@ func (m *SubscriptionManager) subscribeRepeater(ctx context.Context, redis *redi
 				radioSubs.Delete(repeaterID)
 			}
 			return
-		case msg := <-pubsubChannel:
+		case msg, ok := <-pubsubChannel:
+			if !ok {
+				// Closed once ctx is done, the case above cleans up
+				pubsubChannel = nil
+				continue
+			}
 			rawPacket := models.RawDMRPacket{}
 			_, err := rawPacket.UnmarshalMsg([]byte(msg.Payload))
 			if err != nil {
@@ -336,29 +441,44 @@ func (m *SubscriptionManager) subscribeRepeater(ctx context.Context, redis *redi
 			}
 			packet.Repeater = repeaterID
 			redis.Publish(ctx, "hbrp:outgoing:noaddr", packet.Encode())
+			if packet.StreamID != lastStreamID {
+				lastStreamID = packet.StreamID
+				routing.Record(ctx, redis, packet.StreamID, routing.Decision{Target: routing.TargetRepeater, TargetID: repeaterID, Delivered: true, Reason: routing.ReasonPrivate, Timeslot: routing.Timeslot(packet.Slot)})
+			}
 		}
 	}
 }
 
-func (m *SubscriptionManager) subscribeTG(ctx context.Context, redis *redis.Client, repeaterID uint, tg uint) {
+func (m *SubscriptionManager) subscribeTG(ctx context.Context, redis *redis.Client, repeaterID uint, tg uint, ready func()) {
 	if tg == 0 {
+		if ready != nil {
+			ready()
+		}
 		return
 	}
 	if config.GetConfig().Debug {
 		logging.Logf("Listening for calls on repeater %d, talkgroup %d", repeaterID, tg)
 	}
-	pubsub := redis.Subscribe(ctx, fmt.Sprintf("hbrp:packets:talkgroup:%d", tg))
+	hubevents.Record(models.HubEvent{Kind: models.HubEventTalkgroupLinked, RepeaterID: repeaterID, TalkgroupID: tg})
+	defer hubevents.Record(models.HubEvent{Kind: models.HubEventTalkgroupUnlinked, RepeaterID: repeaterID, TalkgroupID: tg})
+	subscription := redis.Subscribe(ctx, fmt.Sprintf("hbrp:packets:talkgroup:%d", tg))
 	defer func() {
-		err := pubsub.Unsubscribe(ctx, fmt.Sprintf("hbrp:packets:talkgroup:%d", tg))
+		err := subscription.Unsubscribe(ctx, fmt.Sprintf("hbrp:packets:talkgroup:%d", tg))
 		if err != nil {
 			logging.Errorf("Error unsubscribing from hbrp:packets:talkgroup:%d: %s", tg, err)
 		}
-		err = pubsub.Close()
+		err = subscription.Close()
 		if err != nil {
 			logging.Errorf("Error closing pubsub connection: %s", err)
 		}
 	}()
-	pubsubChannel := pubsub.Channel()
+	confirmSubscription(ctx, subscription, ready)
+	pubsubChannel := pubsub.Receive(ctx, subscription, "talkgroup")
+	var lastStreamID uint
+	var stream codecStream
+	// Whether the repeater may receive a stream's talkgroup is decided once per stream
+	var allowedStreamID uint
+	var allowed bool
 
 	for {
 		select {
@@ -371,7 +491,12 @@ func (m *SubscriptionManager) subscribeTG(ctx context.Context, redis *redis.Clie
 				radioSubs.Delete(tg)
 			}
 			return
-		case msg := <-pubsubChannel:
+		case msg, ok := <-pubsubChannel:
+			if !ok {
+				// Closed once ctx is done, the case above cleans up
+				pubsubChannel = nil
+				continue
+			}
 			rawPacket := models.RawDMRPacket{}
 			_, err := rawPacket.UnmarshalMsg([]byte(msg.Payload))
 			if err != nil {
@@ -383,8 +508,15 @@ func (m *SubscriptionManager) subscribeTG(ctx context.Context, redis *redis.Clie
 				logging.Errorf("Failed to unpack packet")
 				continue
 			}
+			packet.Codec = rawPacket.Codec
+
+			newStream := packet.StreamID != lastStreamID
+			lastStreamID = packet.StreamID
 
 			if packet.Repeater == repeaterID {
+				if newStream {
+					routing.Record(ctx, redis, packet.StreamID, routing.Decision{Target: routing.TargetRepeater, TargetID: repeaterID, Reason: routing.ReasonEchoSuppression})
+				}
 				continue
 			}
 
@@ -394,19 +526,71 @@ func (m *SubscriptionManager) subscribeTG(ctx context.Context, redis *redis.Clie
 				continue
 			}
 			want, slot := p.WantRX(packet)
+			if want && newStream {
+				stream = m.routeCodec(ctx, redis, p.ID, packet)
+			}
+			if want && packet.GroupCall && allowedStreamID != packet.StreamID {
+				allowedStreamID = packet.StreamID
+				allowed = m.allowedOnTalkgroup(p.ID, packet.Dst)
+			}
+			if want && packet.GroupCall && !allowed {
+				// The talkgroup went private after the repeater was linked to it
+				if newStream {
+					routing.Record(ctx, redis, packet.StreamID, routing.Decision{Target: routing.TargetRepeater, TargetID: p.ID, Reason: routing.ReasonPrivateTalkgroup, Timeslot: routing.Timeslot(slot)})
+				}
+				continue
+			}
+			if want && m.staticMuted(p, slot, packet.Dst) {
+				if newStream {
+					routing.Record(ctx, redis, packet.StreamID, routing.Decision{Target: routing.TargetRepeater, TargetID: p.ID, Reason: routing.ReasonMuted, Timeslot: routing.Timeslot(slot)})
+				}
+				continue
+			}
+			if want && m.bridged(p.ID, packet, slot) {
+				// The linked repeater already hears this call on the same slot
+				if newStream {
+					routing.Record(ctx, redis, packet.StreamID, routing.Decision{Target: routing.TargetRepeater, TargetID: p.ID, Delivered: true, Reason: routing.ReasonBridge, Timeslot: routing.Timeslot(slot)})
+				}
+				continue
+			}
+			if want && stream.action == codec.Drop {
+				if newStream {
+					routing.Record(ctx, redis, packet.StreamID, routing.Decision{Target: routing.TargetRepeater, TargetID: p.ID, Reason: stream.reason, Timeslot: routing.Timeslot(slot)})
+				}
+				continue
+			}
 			if want {
 				// This packet is for the repeater's dynamic talkgroup
 				// We need to send it to the repeater
-				packet.Repeater = p.ID
-				packet.Slot = slot
-				redis.Publish(ctx, "hbrp:outgoing:noaddr", packet.Encode())
+				packets := []models.Packet{packet}
+				if stream.action == codec.Transcode {
+					packets = stream.transcoder.Transcode(packet)
+				}
+				for _, out := range packets {
+					out.Repeater = p.ID
+					out.Slot = slot
+					redis.Publish(ctx, "hbrp:outgoing:noaddr", out.Encode())
+				}
+				if newStream {
+					reason := routing.ReasonStatic
+					if (p.TS1DynamicTalkgroupID != nil && *p.TS1DynamicTalkgroupID == packet.Dst) || (p.TS2DynamicTalkgroupID != nil && *p.TS2DynamicTalkgroupID == packet.Dst) {
+						reason = routing.ReasonDynamic
+					}
+					if stream.action == codec.Transcode {
+						reason = routing.ReasonTranscoded
+					}
+					routing.Record(ctx, redis, packet.StreamID, routing.Decision{Target: routing.TargetRepeater, TargetID: p.ID, Delivered: true, Reason: reason, Timeslot: routing.Timeslot(slot)})
+				}
 			} else {
 				// We're subscribed but don't want this packet? With a talkgroup that can only mean we're unlinked, so we should unsubscribe
-				err := pubsub.Unsubscribe(ctx, fmt.Sprintf("hbrp:packets:talkgroup:%d", tg))
+				if newStream {
+					routing.Record(ctx, redis, packet.StreamID, routing.Decision{Target: routing.TargetRepeater, TargetID: p.ID, Reason: routing.ReasonNotSubscribed})
+				}
+				err := subscription.Unsubscribe(ctx, fmt.Sprintf("hbrp:packets:talkgroup:%d", tg))
 				if err != nil {
 					logging.Errorf("Error unsubscribing from hbrp:packets:talkgroup:%d: %s", tg, err)
 				}
-				err = pubsub.Close()
+				err = subscription.Close()
 				if err != nil {
 					logging.Errorf("Error closing pubsub connection: %s", err)
 				}
@@ -415,3 +599,25 @@ func (m *SubscriptionManager) subscribeTG(ctx context.Context, redis *redis.Clie
 		}
 	}
 }
+
+// allowedOnTalkgroup reports whether a repeater is allowed to receive a talkgroup
+func (m *SubscriptionManager) allowedOnTalkgroup(repeaterID uint, talkgroupID uint) bool {
+	allowed, err := models.TalkgroupAllowsRepeater(m.db, talkgroupID, repeaterID)
+	if err != nil {
+		logging.Errorf("Error checking talkgroup %d allowlist: %s", talkgroupID, err)
+		return false
+	}
+	return allowed
+}
+
+// staticMuted reports whether a talkgroup is muted on the slot it would be delivered to.
+// Mutes only apply to static talkgroups, so linking the talkgroup dynamically still works.
+func (m *SubscriptionManager) staticMuted(p models.Repeater, slot bool, talkgroupID uint) bool {
+	if slot && p.TS2DynamicTalkgroupID != nil && *p.TS2DynamicTalkgroupID == talkgroupID {
+		return false
+	}
+	if !slot && p.TS1DynamicTalkgroupID != nil && *p.TS1DynamicTalkgroupID == talkgroupID {
+		return false
+	}
+	return m.IsMuted(p.ID, slot, talkgroupID)
+}
@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"go.opentelemetry.io/otel"
+	"gorm.io/gorm"
+)
+
+// CountTalkgroupListeners counts the connected repeaters carrying a talkgroup, statically or
+// linked dynamically, and the web clients listening to it across every replica
+func CountTalkgroupListeners(ctx context.Context, db *gorm.DB, redis *servers.RedisClient, talkgroupID uint) (apimodels.TalkgroupListeners, error) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "hbrp.CountTalkgroupListeners")
+	defer span.End()
+
+	listeners := apimodels.TalkgroupListeners{TalkgroupID: talkgroupID}
+	repeaterIDs, err := models.ListRepeaterIDsWantingTalkgroup(db, talkgroupID)
+	if err != nil {
+		return listeners, err
+	}
+	for _, repeaterID := range repeaterIDs {
+		if !redis.RepeaterExists(ctx, repeaterID) {
+			continue
+		}
+		repeater, err := redis.GetRepeater(ctx, repeaterID)
+		if err != nil || repeater.Connection != "YES" {
+			continue
+		}
+		listeners.Repeaters++
+	}
+	listeners.WebListeners, err = redis.CountWebListeners(ctx, talkgroupID)
+	return listeners, err
+}
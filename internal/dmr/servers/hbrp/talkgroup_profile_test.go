@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/calltracker"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+)
+
+// Not parallel, see makeTestDB
+func TestApplyTalkgroupProfile(t *testing.T) {
+	db := makeTestDB(t)
+	if err := db.AutoMigrate(&models.TalkgroupProfile{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	_, redis := fakeredis.New(t)
+	server := MakeServer(db, redis, servers.MakeRedisClient(redis), calltracker.NewCallTracker(db, redis), "test", "test")
+
+	owner := models.User{ID: 3118603, Callsign: "N0PRFL", Username: "n0prfl", Approved: true}
+	db.Save(&owner)
+	for _, tg := range []models.Talkgroup{{ID: 3101, Name: "Profile 1"}, {ID: 3102, Name: "Profile 2"}, {ID: 3103, Name: "Old"}} {
+		db.Save(&tg)
+	}
+	hotspot := models.Repeater{OwnerID: owner.ID, Hotspot: true, TS2StaticTalkgroups: []models.Talkgroup{{ID: 3103}}}
+	hotspot.ID = 311860301
+	if err := db.Create(&hotspot).Error; err != nil {
+		t.Fatalf("Failed to create hotspot: %v", err)
+	}
+
+	// Without a profile the hotspot keeps what it has
+	server.applyTalkgroupProfile(context.Background(), hotspot)
+	found, err := models.FindRepeaterByID(db, hotspot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found.TS2StaticTalkgroups) != 1 || found.TS2StaticTalkgroups[0].ID != 3103 {
+		t.Errorf("Expected the hotspot's talkgroups to be kept, got %+v", found.TS2StaticTalkgroups)
+	}
+
+	profile := models.TalkgroupProfile{
+		UserID:              owner.ID,
+		TS1StaticTalkgroups: []models.Talkgroup{{ID: 3101}},
+		TS2StaticTalkgroups: []models.Talkgroup{{ID: 3102}},
+	}
+	if err := db.Create(&profile).Error; err != nil {
+		t.Fatalf("Failed to create profile: %v", err)
+	}
+	server.applyTalkgroupProfile(context.Background(), hotspot)
+	found, err = models.FindRepeaterByID(db, hotspot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found.TS1StaticTalkgroups) != 1 || found.TS1StaticTalkgroups[0].ID != 3101 {
+		t.Errorf("Expected TS1 to be set from the profile, got %+v", found.TS1StaticTalkgroups)
+	}
+	if len(found.TS2StaticTalkgroups) != 1 || found.TS2StaticTalkgroups[0].ID != 3102 {
+		t.Errorf("Expected TS2 to be replaced by the profile, got %+v", found.TS2StaticTalkgroups)
+	}
+	GetSubscriptionManager(db).CancelAllRepeaterSubscriptions(hotspot.ID)
+}
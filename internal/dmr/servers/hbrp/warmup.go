@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/redis/go-redis/v9"
+)
+
+// How many repeaters are subscribed at once during a warm-up
+const warmUpConcurrency = 32
+
+//nolint:golint,gochecknoglobals
+var warmingUp atomic.Bool
+
+// WarmingUp reports whether repeater subscriptions are still being created after a start.
+// The hub shouldn't be marked ready until they're done, or calls to idle repeaters are lost.
+func WarmingUp() bool {
+	return warmingUp.Load()
+}
+
+// WarmUp subscribes every repeater to its private calls, bridges and talkgroups.
+// All repeaters are loaded with one batch of queries and subscribed in parallel,
+// and WarmUp returns once Redis has acknowledged every subscription.
+func (m *SubscriptionManager) WarmUp(ctx context.Context, redis *redis.Client) error {
+	warmingUp.Store(true)
+	defer warmingUp.Store(false)
+	start := time.Now()
+
+	repeaters, err := models.ListRepeatersForSubscriptions(m.db.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to list repeaters: %w", err)
+	}
+
+	queue := make(chan models.Repeater)
+	var confirmed sync.WaitGroup
+	var workers sync.WaitGroup
+	for range min(warmUpConcurrency, len(repeaters)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for repeater := range queue {
+				m.listenForRepeater(redis, repeater, &confirmed)
+			}
+		}()
+	}
+	for _, repeater := range repeaters {
+		queue <- repeater
+	}
+	close(queue)
+	workers.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		confirmed.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err() //nolint:golint,wrapcheck
+	}
+	logging.Logf("Subscribed %d repeaters in %s", len(repeaters), time.Since(start).Round(time.Millisecond))
+	return nil
+}
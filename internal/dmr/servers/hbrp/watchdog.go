@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/inhibit"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/pubsub"
+	"go.opentelemetry.io/otel"
+)
+
+// enforceInhibits cuts off the streams in progress on this replica that a new
+// TX inhibit covers, sending each a clean terminator rather than leaving
+// repeaters keyed up until their own timeouts.
+func (s *Server) enforceInhibits(ctx context.Context) {
+	ended := s.CallTracker.TerminateCalls(ctx, inhibit.Blocks)
+	if ended > 0 {
+		logging.Logf("Ended %d calls covered by a TX inhibit", ended)
+	}
+}
+
+// routeTerminator sends the synthetic voice terminator for a call the watchdog
+// force-ended everywhere the call itself was routed, so downstream repeaters
+// and peers release the slot instead of waiting out their own timeouts.
+func (s *Server) routeTerminator(ctx context.Context, packet models.Packet) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "Server.routeTerminator")
+	defer span.End()
+
+	exists, err := models.RepeaterIDExists(s.DB, packet.Repeater)
+	if err != nil {
+		logging.Errorf("Error checking if repeater %d exists: %v", packet.Repeater, err)
+		return
+	}
+	if !exists {
+		// Not a call from one of our repeaters
+		return
+	}
+	packet.Signature = string(dmrconst.CommandDMRD)
+
+	// The source may have gone away, which is often why the terminator was lost
+	var remoteAddr net.UDPAddr
+	if repeater, err := s.Redis.GetRepeater(ctx, packet.Repeater); err == nil {
+		remoteAddr = net.UDPAddr{IP: net.ParseIP(repeater.IP), Port: repeater.Port}
+	}
+	data := packet.Encode()
+
+	if config.GetConfig().Debug {
+		logging.Logf("Sending a synthetic terminator for stream %d from %d to %d", packet.StreamID, packet.Src, packet.Dst)
+	}
+
+	s.doBridge(ctx, packet, remoteAddr, data)
+	if len(config.GetConfig().OpenBridgeListen) > 0 {
+		go s.egressPeers(ctx, packet, false)
+	}
+
+	if !packet.GroupCall {
+		s.doPrivate(ctx, packet, remoteAddr, data, false)
+		return
+	}
+	rawPacket := models.RawDMRPacket{
+		Data:       data,
+		RemoteIP:   remoteAddr.IP.String(),
+		RemotePort: remoteAddr.Port,
+	}
+	packedBytes, err := rawPacket.MarshalMsg(nil)
+	if err != nil {
+		logging.Errorf("Error marshalling raw packet: %v", err)
+		return
+	}
+	pubsub.Observe(s.Redis.Redis.Publish(ctx, fmt.Sprintf("hbrp:packets:talkgroup:%d", packet.Dst), packedBytes).Err())
+}
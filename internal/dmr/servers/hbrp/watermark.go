@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hbrp
+
+import (
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/watermark"
+	"github.com/USA-RedDragon/DMRHub/internal/featureflags"
+)
+
+// watermarkVoice marks a voice burst for the repeater it's being sent to, if the voice_watermark flag is on.
+// Without WATERMARK_SECRET there's no key to mark with, and the burst goes out unchanged.
+func watermarkVoice(packet *models.Packet, repeaterID uint) {
+	if packet.FrameType != dmrconst.FrameVoice && packet.FrameType != dmrconst.FrameVoiceSync {
+		return
+	}
+	secret := config.GetConfig().WatermarkSecret
+	if secret == "" || !featureflags.GetFeatureFlags().IsEnabled(featureflags.FeatureFlagWatermark) {
+		return
+	}
+	watermark.Apply(&packet.DMRData, []byte(secret), repeaterID)
+}
@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package servers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/puzpuzpuz/xsync/v3"
+)
+
+var ErrNoListeners = errors.New("no listen addresses configured")
+
+// UDPListeners is the set of UDP sockets a protocol is bound to.
+// Replies to a peer leave through the socket that peer last reached us on,
+// so a repeater talking to one interface never hears back from another.
+type UDPListeners struct {
+	protocol string
+	conns    []*net.UDPConn
+	routes   *xsync.MapOf[string, *net.UDPConn]
+	limits   *xsync.MapOf[string, int]
+	observed *xsync.MapOf[string, int]
+	networks map[string]*net.UDPConn
+	pins     *xsync.MapOf[string, string]
+}
+
+// ListenUDP binds a UDP socket to each of the given host:port addresses.
+// If any address fails to bind, the sockets already opened are closed.
+// The protocol names the sockets in metrics.
+func ListenUDP(protocol string, addrs []string, bufferSize int) (*UDPListeners, error) {
+	if len(addrs) == 0 {
+		return nil, ErrNoListeners
+	}
+	l := &UDPListeners{
+		protocol: protocol,
+		routes:   xsync.NewMapOf[string, *net.UDPConn](),
+		limits:   xsync.NewMapOf[string, int](),
+		observed: xsync.NewMapOf[string, int](),
+		networks: map[string]*net.UDPConn{},
+		pins:     xsync.NewMapOf[string, string](),
+	}
+	for _, addr := range addrs {
+		conn, err := listenUDP(addr, bufferSize)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l.conns = append(l.conns, conn)
+	}
+	l.nameNetworks()
+	return l, nil
+}
+
+func listenUDP(addr string, bufferSize int) (*net.UDPConn, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving %s: %w", addr, err)
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, fmt.Errorf("error opening UDP socket on %s: %w", addr, err)
+	}
+	err = conn.SetReadBuffer(bufferSize)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("error setting read buffer on %s: %w", addr, err)
+	}
+	err = conn.SetWriteBuffer(bufferSize)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("error setting write buffer on %s: %w", addr, err)
+	}
+	return conn, nil
+}
+
+// Addrs returns the local addresses of the bound sockets.
+func (l *UDPListeners) Addrs() []net.Addr {
+	addrs := make([]net.Addr, 0, len(l.conns))
+	for _, conn := range l.conns {
+		addrs = append(addrs, conn.LocalAddr())
+	}
+	return addrs
+}
+
+// Serve starts a read loop on each socket. Packets that accept rejects are dropped;
+// the rest are passed to handle, and their sender is remembered for routing replies.
+// Both callbacks get a slice of the socket's read buffer, which is only valid until they return.
+func (l *UDPListeners) Serve(bufferSize int, accept func(data []byte, remoteAddr *net.UDPAddr) bool, handle func(data []byte, remoteAddr *net.UDPAddr)) {
+	for _, conn := range l.conns {
+		go l.serve(conn, make([]byte, bufferSize), accept, handle)
+	}
+}
+
+func (l *UDPListeners) serve(conn *net.UDPConn, buffer []byte, accept func(data []byte, remoteAddr *net.UDPAddr) bool, handle func(data []byte, remoteAddr *net.UDPAddr)) {
+	for {
+		length, remoteAddr, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			logging.Errorf("Error reading from UDP Socket, Swallowing Error: %v", err)
+			continue
+		}
+		if !accept(buffer[:length], remoteAddr) {
+			continue
+		}
+		if !l.onPinnedNetwork(conn, remoteAddr) {
+			continue
+		}
+		key := remoteAddr.String()
+		if known, ok := l.routes.Load(key); !ok || known != conn {
+			l.routes.Store(key, conn)
+		}
+		handle(buffer[:length], remoteAddr)
+	}
+}
+
+// WriteToUDP sends data to addr through the socket of the network addr is pinned to, or else
+// the socket addr last reached us on, falling back to the first socket for peers we haven't heard from.
+// Datagrams larger than MaxDatagram(addr) are dropped with ErrDatagramTooLarge.
+func (l *UDPListeners) WriteToUDP(data []byte, addr *net.UDPAddr) (int, error) {
+	if limit := l.MaxDatagram(addr); limit > 0 && len(data) > limit {
+		oversizedDropped.WithLabelValues(l.protocol).Inc()
+		return 0, fmt.Errorf("%w: %d bytes to %s, limit %d", ErrDatagramTooLarge, len(data), addr, limit)
+	}
+	conn, err := l.egress(addr)
+	if err != nil {
+		return 0, err
+	}
+	n, err := conn.WriteToUDP(data, addr)
+	if err != nil {
+		if errors.Is(err, syscall.EMSGSIZE) {
+			l.observeTooLarge(addr, len(data))
+		}
+		return n, fmt.Errorf("error writing to %s: %w", addr, err)
+	}
+	return n, nil
+}
+
+// Close closes every bound socket.
+func (l *UDPListeners) Close() {
+	for _, conn := range l.conns {
+		if err := conn.Close(); err != nil {
+			logging.Errorf("Error closing UDP socket: %v", err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package servers_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+)
+
+func TestListenUDPRequiresAddrs(t *testing.T) {
+	t.Parallel()
+	_, err := servers.ListenUDP("test", nil, 1024)
+	if !errors.Is(err, servers.ErrNoListeners) {
+		t.Fatalf("Expected ErrNoListeners, got %v", err)
+	}
+}
+
+func TestRepliesLeaveThroughReceivingSocket(t *testing.T) {
+	t.Parallel()
+	listeners, err := servers.ListenUDP("test", []string{"127.0.0.1:0", "127.0.0.1:0"}, 65536)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listeners.Close()
+
+	addrs := listeners.Addrs()
+	if len(addrs) != 2 {
+		t.Fatalf("Expected 2 listeners, got %d", len(addrs))
+	}
+
+	received := make(chan *net.UDPAddr, 1)
+	listeners.Serve(64, func(_ []byte, _ *net.UDPAddr) bool {
+		return true
+	}, func(_ []byte, remoteAddr *net.UDPAddr) {
+		received <- remoteAddr
+	})
+
+	client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to open client socket: %v", err)
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	second, ok := addrs[1].(*net.UDPAddr)
+	if !ok {
+		t.Fatalf("Expected a UDP address, got %T", addrs[1])
+	}
+	if _, err := client.WriteToUDP([]byte("RPTPING"), second); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	var remote *net.UDPAddr
+	select {
+	case remote = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the packet")
+	}
+
+	if _, err := listeners.WriteToUDP([]byte("MSTPONG"), remote); err != nil {
+		t.Fatalf("Failed to reply: %v", err)
+	}
+
+	if err := client.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("Failed to set deadline: %v", err)
+	}
+	buf := make([]byte, 64)
+	_, from, err := client.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("Failed to read reply: %v", err)
+	}
+	if from.Port != second.Port {
+		t.Errorf("Expected reply from port %d, got %d", second.Port, from.Port)
+	}
+}
+
+func TestWriteToUDPDropsOversizedDatagrams(t *testing.T) {
+	t.Parallel()
+	listeners, err := servers.ListenUDP("test", []string{"127.0.0.1:0"}, 65536)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listeners.Close()
+
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9}
+	listeners.SetMaxDatagram(addr, 53)
+	if limit := listeners.MaxDatagram(addr); limit != 53 {
+		t.Fatalf("Expected a limit of 53, got %d", limit)
+	}
+	if _, err := listeners.WriteToUDP(make([]byte, 55), addr); !errors.Is(err, servers.ErrDatagramTooLarge) {
+		t.Errorf("Expected ErrDatagramTooLarge, got %v", err)
+	}
+	if _, err := listeners.WriteToUDP(make([]byte, 53), addr); err != nil {
+		t.Errorf("Expected a datagram within the limit to send, got %v", err)
+	}
+
+	listeners.SetMaxDatagram(addr, 0)
+	if _, err := listeners.WriteToUDP(make([]byte, 55), addr); err != nil {
+		t.Errorf("Expected no limit once cleared, got %v", err)
+	}
+}
@@ -0,0 +1,482 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package m17
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/codec"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/utils"
+	"github.com/USA-RedDragon/DMRHub/internal/events"
+	"github.com/USA-RedDragon/DMRHub/internal/inhibit"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/pubsub"
+	"github.com/USA-RedDragon/DMRHub/internal/userdb"
+	"github.com/puzpuzpuz/xsync/v3"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	// How long to wait for the reflector to answer a CONN
+	connectTimeout = 5 * time.Second
+	// mrefd pings every few seconds, a reflector that stays quiet this long is gone
+	pingTimeout = 30 * time.Second
+	// How long to wait before connecting again after losing the reflector
+	retryDelay = 30 * time.Second
+	// Streams the bridge published are remembered this long so they aren't sent back
+	ownStreamTTL = time.Minute
+)
+
+var (
+	ErrRefused      = errors.New("reflector refused the connection")
+	ErrDisconnected = errors.New("reflector disconnected")
+	ErrPingTimeout  = errors.New("reflector stopped pinging")
+)
+
+// Bridge links a talkgroup to a module on an M17 reflector. Codec2 audio from the
+// reflector is published to the talkgroup, where its codec policy decides who hears it.
+// DMR calls are sent to the reflector transcoded when a vocoder backend has registered
+// an AMBE to Codec2 transcoder, and otherwise as data frames that only carry who's talking.
+type Bridge struct {
+	config   config.M17Bridge
+	callsign uint64
+	db       *gorm.DB
+	redis    *redis.Client
+
+	connMutex sync.Mutex
+	conn      *net.UDPConn
+	connected atomic.Bool
+	// Set while shutting down, new streams from the reflector are ignored
+	draining atomic.Bool
+	// Set while a stream from the reflector is being published
+	receiving atomic.Bool
+
+	// DMR stream IDs of calls that came from the reflector
+	ownStreams *xsync.MapOf[uint, time.Time]
+	inbound    inboundStream
+}
+
+// inboundStream is the M17 stream currently being published to the talkgroup
+type inboundStream struct {
+	active   bool
+	ignored  bool
+	m17ID    uint16
+	streamID uint
+	src      uint
+	seq      uint
+	frames   uint
+}
+
+// outboundStream is the DMR call currently being sent to the reflector
+type outboundStream struct {
+	streamID   uint
+	private    bool
+	m17ID      uint16
+	source     uint64
+	number     uint16
+	transcoder codec.Transcoder
+}
+
+func newBridge(db *gorm.DB, redis *redis.Client, callsign uint64, bridge config.M17Bridge) *Bridge {
+	return &Bridge{
+		config:     bridge,
+		callsign:   callsign,
+		db:         db,
+		redis:      redis,
+		ownStreams: xsync.NewMapOf[uint, time.Time](),
+	}
+}
+
+func (b *Bridge) String() string {
+	return fmt.Sprintf("TG %d <-> %s module %c", b.config.Talkgroup, b.config.Reflector, b.config.Module)
+}
+
+// Run keeps the bridge connected until ctx is done
+func (b *Bridge) Run(ctx context.Context) {
+	for {
+		err := b.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		logging.Errorf("M17 bridge %s lost: %v, reconnecting in %s", b, err, retryDelay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// session connects to the reflector and relays traffic until the connection is lost
+func (b *Bridge) session(ctx context.Context) error {
+	addr, err := net.ResolveUDPAddr("udp", b.config.Reflector)
+	if err != nil {
+		return fmt.Errorf("error resolving reflector: %w", err)
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return fmt.Errorf("error connecting to reflector: %w", err)
+	}
+	b.connMutex.Lock()
+	b.conn = conn
+	b.connMutex.Unlock()
+	defer func() {
+		// A stream cut off with the connection isn't coming back
+		b.inbound = inboundStream{}
+		b.receiving.Store(false)
+		b.connected.Store(false)
+		b.connMutex.Lock()
+		b.conn = nil
+		b.connMutex.Unlock()
+		_ = conn.Close()
+	}()
+
+	buf := make([]byte, frameLength)
+	b.write(connect(b.callsign, b.config.Module))
+	_ = conn.SetReadDeadline(time.Now().Add(connectTimeout))
+	n, err := conn.Read(buf)
+	if err != nil {
+		return fmt.Errorf("error waiting for the reflector to answer: %w", err)
+	}
+	if n < magicLength || string(buf[:magicLength]) != magicAckn {
+		return ErrRefused
+	}
+	b.connected.Store(true)
+	logging.Logf("M17 bridge %s connected", b)
+	events.Publish(ctx, b.redis, events.M17BridgeConnected, fmt.Sprintf("M17 bridge %s connected", b), b.eventData())
+	defer events.Publish(context.WithoutCancel(ctx), b.redis, events.M17BridgeDisconnected, fmt.Sprintf("M17 bridge %s disconnected", b), b.eventData())
+
+	sessionCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go b.forward(sessionCtx)
+	go func() {
+		// Unblock the read below when the hub shuts down
+		<-sessionCtx.Done()
+		if ctx.Err() != nil {
+			b.write(command(magicDisc, b.callsign))
+		}
+		_ = conn.SetReadDeadline(time.Now())
+	}()
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(pingTimeout))
+		n, err := conn.Read(buf)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return ErrPingTimeout
+		} else if err != nil {
+			return fmt.Errorf("error reading from reflector: %w", err)
+		}
+		if n < magicLength {
+			continue
+		}
+		switch string(buf[:magicLength]) {
+		case magicPing:
+			b.write(command(magicPong, b.callsign))
+		case magicDisc:
+			return ErrDisconnected
+		case magicStream:
+			frame, err := UnmarshalFrame(buf[:n])
+			if err != nil {
+				logging.Errorf("M17 bridge %s: %v", b, err)
+				continue
+			}
+			b.receive(ctx, frame, addr)
+		}
+	}
+}
+
+func (b *Bridge) eventData() map[string]any {
+	return map[string]any{
+		"talkgroup_id": b.config.Talkgroup,
+		"reflector":    b.config.Reflector,
+		"module":       string(b.config.Module),
+	}
+}
+
+func (b *Bridge) write(data []byte) {
+	b.connMutex.Lock()
+	defer b.connMutex.Unlock()
+	if b.conn == nil {
+		return
+	}
+	if _, err := b.conn.Write(data); err != nil {
+		logging.Errorf("M17 bridge %s: error writing to reflector: %v", b, err)
+	}
+}
+
+// private reports whether the bridged talkgroup is private. Private talkgroups never
+// cross the bridge, in either direction, the same as OpenBridge.
+func (b *Bridge) private() bool {
+	private, err := models.TalkgroupIsPrivate(b.db, b.config.Talkgroup)
+	if err != nil {
+		// Fail closed, a private talkgroup must not leak because of a DB error
+		logging.Errorf("M17 bridge %s: error checking if the talkgroup is private: %v", b, err)
+		return true
+	}
+	return private
+}
+
+// dmrStreamID gives an M17 stream a DMR stream ID, keeping the talkgroup in the
+// upper bits so bridges on different talkgroups don't collide
+func (b *Bridge) dmrStreamID(m17ID uint16) uint {
+	return uint(b.config.Talkgroup&0xFFFF)<<16 | uint(m17ID)
+}
+
+// dmrUser finds the DMR ID of the user registered with an M17 station's callsign
+func (b *Bridge) dmrUser(address uint64) (uint, bool) {
+	user, err := models.FindUserByCallsign(b.db, BaseCallsign(DecodeCallsign(address)))
+	if err != nil || !user.Approved || user.Suspended {
+		return 0, false
+	}
+	return user.ID, true
+}
+
+// m17Address finds the callsign to send a DMR user's calls from. Users the hub
+// and the DMR ID database don't know are sent from the hub's own callsign.
+func (b *Bridge) m17Address(dmrID uint) uint64 {
+	callsign := ""
+	if user, err := models.FindUserByID(b.db, dmrID); err == nil {
+		callsign = user.Callsign
+	} else if user, ok := userdb.Get(dmrID); ok {
+		callsign = user.Callsign
+	}
+	address, err := EncodeCallsign(callsign)
+	if err != nil {
+		return b.callsign
+	}
+	return address
+}
+
+// receive publishes a frame from the reflector to the talkgroup as a Codec2 packet
+func (b *Bridge) receive(ctx context.Context, frame Frame, addr *net.UDPAddr) {
+	if !b.inbound.active || frame.StreamID != b.inbound.m17ID {
+		b.inbound = inboundStream{active: true, m17ID: frame.StreamID, streamID: b.dmrStreamID(frame.StreamID)}
+		src, ok := b.dmrUser(frame.Source)
+		exists, pending, err := models.TalkgroupState(b.db, b.config.Talkgroup)
+		switch {
+		case b.draining.Load():
+			logging.Logf("M17 bridge %s: shutting down, ignoring stream from %s", b, DecodeCallsign(frame.Source))
+			b.inbound.ignored = true
+		case !ok:
+			logging.Logf("M17 bridge %s: %s isn't a registered user, ignoring their stream", b, DecodeCallsign(frame.Source))
+			b.inbound.ignored = true
+		case err != nil || !exists || pending:
+			logging.Errorf("M17 bridge %s: talkgroup isn't available, ignoring stream from %s", b, DecodeCallsign(frame.Source))
+			b.inbound.ignored = true
+		case b.private():
+			logging.Logf("M17 bridge %s: talkgroup is private, ignoring stream from %s", b, DecodeCallsign(frame.Source))
+			b.inbound.ignored = true
+		default:
+			b.inbound.src = src
+			now := time.Now()
+			b.ownStreams.Store(b.inbound.streamID, now)
+			b.ownStreams.Range(func(streamID uint, seen time.Time) bool {
+				if now.Sub(seen) > ownStreamTTL {
+					b.ownStreams.Delete(streamID)
+				}
+				return true
+			})
+			b.publish(ctx, b.inboundPacket(dmrconst.FrameDataSync, uint(dmrconst.DTypeVoiceHead)), addr)
+		}
+		b.receiving.Store(!b.inbound.ignored)
+	}
+	if b.inbound.ignored {
+		if frame.Last() {
+			b.inbound = inboundStream{}
+		}
+		return
+	}
+
+	if frame.Voice() {
+		vseq := b.inbound.frames % (dmrconst.VoiceF + 1)
+		frameType := dmrconst.FrameVoice
+		if vseq == dmrconst.VoiceA {
+			frameType = dmrconst.FrameVoiceSync
+		}
+		packet := b.inboundPacket(frameType, vseq)
+		copy(packet.DMRData[:payloadLength], frame.Payload[:])
+		b.publish(ctx, packet, addr)
+		b.inbound.frames++
+	}
+	if frame.Last() {
+		b.publish(ctx, b.inboundPacket(dmrconst.FrameDataSync, uint(dmrconst.DTypeVoiceTerm)), addr)
+		b.inbound = inboundStream{}
+		b.receiving.Store(false)
+	}
+}
+
+func (b *Bridge) inboundPacket(frameType dmrconst.FrameType, dtypeOrVSeq uint) models.Packet {
+	packet := models.Packet{
+		Signature:   string(dmrconst.CommandDMRD),
+		Seq:         b.inbound.seq % 256, //nolint:golint,gomnd
+		Src:         b.inbound.src,
+		Dst:         b.config.Talkgroup,
+		GroupCall:   true,
+		FrameType:   frameType,
+		DTypeOrVSeq: dtypeOrVSeq,
+		StreamID:    b.inbound.streamID,
+		BER:         -1,
+		RSSI:        -1,
+		Codec:       dmrconst.CodecCodec2,
+	}
+	b.inbound.seq++
+	return packet
+}
+
+func (b *Bridge) publish(ctx context.Context, packet models.Packet, addr *net.UDPAddr) {
+	if inhibit.Blocks(packet) {
+		return
+	}
+	rawPacket := models.RawDMRPacket{
+		Data:       packet.Encode(),
+		RemoteIP:   addr.IP.String(),
+		RemotePort: addr.Port,
+		Codec:      packet.Codec,
+	}
+	packedBytes, err := rawPacket.MarshalMsg(nil)
+	if err != nil {
+		logging.Errorf("Error marshalling raw packet: %v", err)
+		return
+	}
+	pubsub.Observe(b.redis.Publish(ctx, fmt.Sprintf("hbrp:packets:talkgroup:%d", packet.Dst), packedBytes).Err())
+}
+
+// forward sends calls on the talkgroup to the reflector
+func (b *Bridge) forward(ctx context.Context) {
+	channel := fmt.Sprintf("hbrp:packets:talkgroup:%d", b.config.Talkgroup)
+	subscription := b.redis.Subscribe(ctx, channel)
+	defer func() {
+		err := subscription.Close()
+		if err != nil {
+			logging.Errorf("Error closing pubsub connection: %s", err)
+		}
+	}()
+	var stream outboundStream
+	for msg := range pubsub.Receive(ctx, subscription, "m17") {
+		rawPacket := models.RawDMRPacket{}
+		_, err := rawPacket.UnmarshalMsg([]byte(msg.Payload))
+		if err != nil {
+			logging.Errorf("Failed to unmarshal raw packet: %s", err)
+			continue
+		}
+		packet, ok := models.UnpackPacket(rawPacket.Data)
+		if !ok {
+			logging.Errorf("Failed to unpack packet")
+			continue
+		}
+		packet.Codec = rawPacket.Codec
+		if _, own := b.ownStreams.Load(packet.StreamID); own {
+			continue
+		}
+		if isVoice, _ := utils.CheckPacketType(packet); !isVoice {
+			continue
+		}
+		if packet.StreamID != stream.streamID {
+			stream = b.startOutbound(packet)
+		}
+		if stream.private {
+			continue
+		}
+		b.send(&stream, packet)
+	}
+}
+
+func (b *Bridge) startOutbound(packet models.Packet) outboundStream {
+	stream := outboundStream{
+		streamID: packet.StreamID,
+		m17ID:    uint16(packet.StreamID ^ packet.StreamID>>16), //nolint:golint,gosec
+		source:   b.m17Address(packet.Src),
+		private:  b.private(),
+	}
+	if stream.private {
+		logging.Logf("M17 bridge %s: talkgroup is private, not sending the call from %d", b, packet.Src)
+		return stream
+	}
+	if packet.Codec != dmrconst.CodecAMBE {
+		return stream
+	}
+	policy, err := models.FindTalkgroupCodecPolicy(b.db, b.config.Talkgroup)
+	if err != nil {
+		logging.Errorf("Error finding talkgroup %d codec policy: %s", b.config.Talkgroup, err)
+	}
+	if policy == models.CodecPolicyTranscode {
+		stream.transcoder, _ = codec.NewTranscoder(dmrconst.CodecAMBE, dmrconst.CodecCodec2)
+	}
+	return stream
+}
+
+// send relays one DMR packet to the reflector. Codec2 passes straight through,
+// AMBE is transcoded if it can be, and otherwise each burst becomes a data frame.
+func (b *Bridge) send(stream *outboundStream, packet models.Packet) {
+	if packet.FrameType == dmrconst.FrameDataSync && dmrconst.DataType(packet.DTypeOrVSeq) == dmrconst.DTypeVoiceTerm {
+		frameType := uint16(typeStream | typeData)
+		if packet.Codec == dmrconst.CodecCodec2 || stream.transcoder != nil {
+			frameType = typeStream | typeVoice3200
+		}
+		b.sendFrame(stream, frameType, [payloadLength]byte{}, true)
+		stream.streamID = 0
+		return
+	}
+
+	switch {
+	case packet.Codec == dmrconst.CodecCodec2:
+		if packet.FrameType != dmrconst.FrameDataSync {
+			b.sendFrame(stream, typeStream|typeVoice3200, [payloadLength]byte(packet.DMRData[:payloadLength]), false)
+		}
+	case packet.Codec != dmrconst.CodecAMBE:
+		// Nothing on a reflector could play it
+	case stream.transcoder != nil:
+		for _, out := range stream.transcoder.Transcode(packet) {
+			b.sendFrame(stream, typeStream|typeVoice3200, [payloadLength]byte(out.DMRData[:payloadLength]), false)
+		}
+	default:
+		b.sendFrame(stream, typeStream|typeData, [payloadLength]byte{}, false)
+	}
+}
+
+func (b *Bridge) sendFrame(stream *outboundStream, frameType uint16, payload [payloadLength]byte, last bool) {
+	frame := Frame{
+		StreamID:    stream.m17ID,
+		Destination: broadcast,
+		Source:      stream.source,
+		Type:        frameType,
+		Number:      stream.number &^ lastFrame,
+		Payload:     payload,
+	}
+	if last {
+		frame.Number |= lastFrame
+	}
+	stream.number++
+	b.write(frame.Marshal())
+}
@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package m17
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+	"github.com/glebarez/sqlite"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	publicTalkgroup  = 1
+	privateTalkgroup = 2
+)
+
+func makeTestBridge(t *testing.T, talkgroup uint) (*Bridge, *redis.Client) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Repeater{}, &models.Talkgroup{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	db.Create(&models.User{ID: 3110001, Callsign: "N0CALL", Approved: true})
+	db.Create(&models.Talkgroup{ID: publicTalkgroup, Name: "Public"})
+	db.Create(&models.Talkgroup{ID: privateTalkgroup, Name: "Private", Private: true})
+	_, client := fakeredis.New(t)
+	callsign, err := EncodeCallsign("DMRHUB")
+	if err != nil {
+		t.Fatalf("Failed to encode callsign: %v", err)
+	}
+	return newBridge(db, client, callsign, config.M17Bridge{Talkgroup: talkgroup, Reflector: "M17-TST", Module: 'A'}), client
+}
+
+func TestBridgeReceiveSkipsPrivateTalkgroups(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		talkgroup uint
+		published bool
+	}{
+		{publicTalkgroup, true},
+		{privateTalkgroup, false},
+	} {
+		b, client := makeTestBridge(t, tc.talkgroup)
+		ctx := context.Background()
+		sub := client.Subscribe(ctx, fmt.Sprintf("hbrp:packets:talkgroup:%d", tc.talkgroup))
+		t.Cleanup(func() { _ = sub.Close() })
+		if _, err := sub.Receive(ctx); err != nil {
+			t.Fatalf("Failed to subscribe: %v", err)
+		}
+
+		source, err := EncodeCallsign("N0CALL")
+		if err != nil {
+			t.Fatalf("Failed to encode callsign: %v", err)
+		}
+		b.receive(ctx, Frame{StreamID: 1, Source: source, Destination: broadcast, Type: typeStream | typeVoice3200}, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 17000})
+
+		published := false
+		select {
+		case <-sub.Channel():
+			published = true
+		case <-time.After(200 * time.Millisecond):
+		}
+		if published != tc.published {
+			t.Errorf("Expected a stream on talkgroup %d to be published: %v, got %v", tc.talkgroup, tc.published, published)
+		}
+	}
+}
+
+func TestBridgeForwardSkipsPrivateTalkgroups(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		talkgroup uint
+		sent      bool
+	}{
+		{publicTalkgroup, true},
+		{privateTalkgroup, false},
+	} {
+		b, client := makeTestBridge(t, tc.talkgroup)
+		reflector, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		t.Cleanup(func() { _ = reflector.Close() })
+		conn, err := net.DialUDP("udp", nil, reflector.LocalAddr().(*net.UDPAddr))
+		if err != nil {
+			t.Fatalf("Failed to dial: %v", err)
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+		b.conn = conn
+
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		go b.forward(ctx)
+
+		packet := models.Packet{
+			Signature:   string(dmrconst.CommandDMRD),
+			Src:         3110001,
+			Dst:         tc.talkgroup,
+			GroupCall:   true,
+			FrameType:   dmrconst.FrameVoice,
+			DTypeOrVSeq: 1,
+			StreamID:    1,
+			Codec:       dmrconst.CodecCodec2,
+		}
+		rawPacket := models.RawDMRPacket{Data: packet.Encode(), Codec: packet.Codec}
+		packedBytes, err := rawPacket.MarshalMsg(nil)
+		if err != nil {
+			t.Fatalf("Failed to marshal packet: %v", err)
+		}
+		channel := fmt.Sprintf("hbrp:packets:talkgroup:%d", tc.talkgroup)
+		// Publish until the bridge is subscribed and has seen the packet
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			receivers, err := client.Publish(ctx, channel, packedBytes).Result()
+			if err != nil {
+				t.Fatalf("Failed to publish: %v", err)
+			}
+			if receivers > 0 || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		buf := make([]byte, 1024)
+		_ = reflector.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		_, _, err = reflector.ReadFromUDP(buf)
+		if sent := err == nil; sent != tc.sent {
+			t.Errorf("Expected a call on talkgroup %d to be sent to the reflector: %v, got %v", tc.talkgroup, tc.sent, sent)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package m17
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// Commands of the M17 reflector protocol, as spoken by mrefd
+const (
+	magicConn   = "CONN" // client -> reflector, connect to a module
+	magicAckn   = "ACKN" // reflector -> client, connected
+	magicNack   = "NACK" // reflector -> client, refused
+	magicPing   = "PING" // reflector -> client keepalive
+	magicPong   = "PONG" // client -> reflector keepalive reply
+	magicDisc   = "DISC" // either way, disconnect
+	magicStream = "M17 " // a stream frame
+)
+
+const (
+	magicLength    = 4
+	callsignLength = 6
+	connLength     = magicLength + callsignLength + 1
+	pingLength     = magicLength + callsignLength
+	frameLength    = 54
+	payloadLength  = 16
+	metaLength     = 14
+)
+
+// Stream types, from the TYPE field of the link setup frame
+const (
+	typeStream    = 0x0001
+	typeData      = 0x0002 // data only, nothing to play
+	typeVoice3200 = 0x0004 // Codec2 3200 voice
+	typeDataMask  = 0x0006
+)
+
+// lastFrame marks the final frame of a stream in its frame number
+const lastFrame = 0x8000
+
+// callsignAlphabet is the base-40 alphabet M17 addresses are encoded in, a space is 0
+const callsignAlphabet = " ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-/."
+
+// broadcast is the destination address of a stream to everyone on a module
+const broadcast = 0xFFFFFFFFFFFF
+
+// maxCallsignLength is how many characters fit in 48 bits of base-40
+const maxCallsignLength = 9
+
+var (
+	ErrCallsign = errors.New("not an M17 callsign")
+	ErrFrame    = errors.New("not an M17 stream frame")
+	ErrCRC      = errors.New("M17 stream frame CRC mismatch")
+)
+
+// EncodeCallsign packs a callsign into an M17 address
+func EncodeCallsign(callsign string) (uint64, error) {
+	callsign = strings.ToUpper(callsign)
+	if callsign == "" || len(callsign) > maxCallsignLength {
+		return 0, ErrCallsign
+	}
+	var address uint64
+	for i := len(callsign) - 1; i >= 0; i-- {
+		index := strings.IndexByte(callsignAlphabet, callsign[i])
+		if index < 0 {
+			return 0, ErrCallsign
+		}
+		address = address*uint64(len(callsignAlphabet)) + uint64(index)
+	}
+	return address, nil
+}
+
+// DecodeCallsign unpacks an M17 address. The broadcast address is @ALL.
+func DecodeCallsign(address uint64) string {
+	if address == broadcast {
+		return "@ALL"
+	}
+	var callsign strings.Builder
+	for address > 0 {
+		callsign.WriteByte(callsignAlphabet[address%uint64(len(callsignAlphabet))])
+		address /= uint64(len(callsignAlphabet))
+	}
+	return strings.TrimSpace(callsign.String())
+}
+
+// BaseCallsign strips the suffix M17 stations add to their callsign, such as the
+// module in "KI5VMF H" or the SSID in "KI5VMF-7", leaving what a DMR user registers with
+func BaseCallsign(callsign string) string {
+	base, _, _ := strings.Cut(strings.TrimSpace(callsign), " ")
+	base, _, _ = strings.Cut(base, "-")
+	base, _, _ = strings.Cut(base, "/")
+	return base
+}
+
+func putAddress(b []byte, address uint64) {
+	const addressLength = 6
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], address)
+	copy(b[:addressLength], buf[8-addressLength:])
+}
+
+func getAddress(b []byte) uint64 {
+	var buf [8]byte
+	copy(buf[2:], b[:callsignLength])
+	return binary.BigEndian.Uint64(buf[:])
+}
+
+// Frame is one 40ms M17 stream frame with its link setup information
+type Frame struct {
+	StreamID    uint16
+	Destination uint64
+	Source      uint64
+	Type        uint16
+	Meta        [metaLength]byte
+	Number      uint16
+	Payload     [payloadLength]byte
+}
+
+// Last reports whether the frame ends its stream
+func (f Frame) Last() bool {
+	return f.Number&lastFrame != 0
+}
+
+// Voice reports whether the frame carries Codec2 3200 audio
+func (f Frame) Voice() bool {
+	return f.Type&typeDataMask == typeVoice3200
+}
+
+// Marshal encodes the frame as the reflector protocol sends it
+func (f Frame) Marshal() []byte {
+	b := make([]byte, frameLength)
+	copy(b, magicStream)
+	binary.BigEndian.PutUint16(b[4:], f.StreamID)
+	putAddress(b[6:], f.Destination)
+	putAddress(b[12:], f.Source)
+	binary.BigEndian.PutUint16(b[18:], f.Type)
+	copy(b[20:34], f.Meta[:])
+	binary.BigEndian.PutUint16(b[34:], f.Number)
+	copy(b[36:52], f.Payload[:])
+	binary.BigEndian.PutUint16(b[52:], crc(b[:52]))
+	return b
+}
+
+// UnmarshalFrame decodes a stream frame and checks its CRC
+func UnmarshalFrame(b []byte) (Frame, error) {
+	if len(b) != frameLength || string(b[:magicLength]) != magicStream {
+		return Frame{}, ErrFrame
+	}
+	if crc(b[:52]) != binary.BigEndian.Uint16(b[52:]) {
+		return Frame{}, ErrCRC
+	}
+	f := Frame{
+		StreamID:    binary.BigEndian.Uint16(b[4:]),
+		Destination: getAddress(b[6:]),
+		Source:      getAddress(b[12:]),
+		Type:        binary.BigEndian.Uint16(b[18:]),
+		Number:      binary.BigEndian.Uint16(b[34:]),
+	}
+	copy(f.Meta[:], b[20:34])
+	copy(f.Payload[:], b[36:52])
+	return f, nil
+}
+
+// command builds a control packet, a magic followed by the client's callsign
+func command(magic string, address uint64) []byte {
+	b := make([]byte, pingLength)
+	copy(b, magic)
+	putAddress(b[magicLength:], address)
+	return b
+}
+
+// connect builds the CONN a client sends to link to a module
+func connect(address uint64, module byte) []byte {
+	b := make([]byte, connLength)
+	copy(b, magicConn)
+	putAddress(b[magicLength:], address)
+	b[connLength-1] = module
+	return b
+}
+
+// crc is the CRC-16 from the M17 specification, polynomial 0x5935 with an initial value of 0xFFFF
+func crc(data []byte) uint16 {
+	const poly = 0x5935
+	sum := uint16(0xFFFF)
+	for _, b := range data {
+		sum ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if sum&0x8000 != 0 {
+				sum = sum<<1 ^ poly
+			} else {
+				sum <<= 1
+			}
+		}
+	}
+	return sum
+}
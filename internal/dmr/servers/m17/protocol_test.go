@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package m17
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCRC(t *testing.T) {
+	t.Parallel()
+	// Check values from the M17 specification
+	if sum := crc(nil); sum != 0xFFFF {
+		t.Errorf("Expected an empty CRC of FFFF, got %04X", sum)
+	}
+	if sum := crc([]byte("123456789")); sum != 0x772B {
+		t.Errorf("Expected a CRC of 772B, got %04X", sum)
+	}
+}
+
+func TestCallsignRoundTrip(t *testing.T) {
+	t.Parallel()
+	address, err := EncodeCallsign("AB")
+	if err != nil || address != 1+2*40 {
+		t.Errorf("Expected AB to encode to 81, got %d err=%v", address, err)
+	}
+	for _, callsign := range []string{"KI5VMF", "KI5VMF H", "N0CALL-7", "W1AW/P", "M17-USA A"} {
+		address, err := EncodeCallsign(callsign)
+		if err != nil {
+			t.Errorf("Unexpected error encoding %s: %v", callsign, err)
+			continue
+		}
+		if decoded := DecodeCallsign(address); decoded != callsign {
+			t.Errorf("Expected %s to round trip, got %s", callsign, decoded)
+		}
+	}
+	for _, callsign := range []string{"", "KI5VMF-ABC", "KI5VMF_1"} {
+		if _, err := EncodeCallsign(callsign); !errors.Is(err, ErrCallsign) {
+			t.Errorf("Expected %q to be rejected, got %v", callsign, err)
+		}
+	}
+	if DecodeCallsign(broadcast) != "@ALL" {
+		t.Errorf("Expected the broadcast address to decode to @ALL")
+	}
+}
+
+func TestBaseCallsign(t *testing.T) {
+	t.Parallel()
+	for callsign, want := range map[string]string{"KI5VMF": "KI5VMF", "KI5VMF H": "KI5VMF", "KI5VMF-7": "KI5VMF", "KI5VMF/M": "KI5VMF"} {
+		if base := BaseCallsign(callsign); base != want {
+			t.Errorf("BaseCallsign(%q) = %q, expected %q", callsign, base, want)
+		}
+	}
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	t.Parallel()
+	source, _ := EncodeCallsign("KI5VMF")
+	frame := Frame{
+		StreamID:    0xBEEF,
+		Destination: broadcast,
+		Source:      source,
+		Type:        typeStream | typeVoice3200,
+		Number:      3 | lastFrame,
+		Payload:     [payloadLength]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+	}
+	data := frame.Marshal()
+	if len(data) != frameLength {
+		t.Fatalf("Expected a %d byte frame, got %d", frameLength, len(data))
+	}
+	decoded, err := UnmarshalFrame(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if decoded != frame {
+		t.Errorf("Expected %+v, got %+v", frame, decoded)
+	}
+	if !decoded.Last() || !decoded.Voice() {
+		t.Errorf("Expected the last frame of a voice stream")
+	}
+
+	data[40] ^= 0xFF
+	if _, err := UnmarshalFrame(data); !errors.Is(err, ErrCRC) {
+		t.Errorf("Expected a CRC error for a corrupted frame, got %v", err)
+	}
+	if _, err := UnmarshalFrame(data[:20]); !errors.Is(err, ErrFrame) {
+		t.Errorf("Expected a short frame to be rejected, got %v", err)
+	}
+}
+
+func TestConnect(t *testing.T) {
+	t.Parallel()
+	address, _ := EncodeCallsign("KI5VMF")
+	data := connect(address, 'A')
+	if len(data) != connLength || string(data[:magicLength]) != magicConn || data[connLength-1] != 'A' {
+		t.Errorf("Unexpected CONN packet %q", data)
+	}
+	if getAddress(data[magicLength:]) != address {
+		t.Errorf("Expected the callsign to follow the magic")
+	}
+}
@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package m17 bridges talkgroups to modules on M17 reflectors
+package m17
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"gorm.io/gorm"
+)
+
+// Server runs the M17 bridges configured with M17_BRIDGES
+type Server struct {
+	DB    *gorm.DB
+	Redis *servers.RedisClient
+
+	bridges []*Bridge
+	cancel  context.CancelFunc
+	wg      *sync.WaitGroup
+}
+
+// MakeServer creates a new M17 bridge server.
+func MakeServer(db *gorm.DB, redisClient *servers.RedisClient) Server {
+	return Server{
+		DB:    db,
+		Redis: redisClient,
+		wg:    &sync.WaitGroup{},
+	}
+}
+
+// Start connects every bridge to its reflector
+func (s *Server) Start(ctx context.Context) error {
+	callsign, err := EncodeCallsign(config.GetConfig().M17Callsign)
+	if err != nil {
+		return fmt.Errorf("M17_CALLSIGN %q: %w", config.GetConfig().M17Callsign, err)
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	for _, bridgeConfig := range config.GetConfig().M17Bridges {
+		bridge := newBridge(s.DB, s.Redis.Redis, callsign, bridgeConfig)
+		s.bridges = append(s.bridges, bridge)
+		logging.Logf("Starting M17 bridge %s", bridge)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			bridge.Run(ctx)
+		}()
+	}
+	return nil
+}
+
+// Stop disconnects from the reflectors
+func (s *Server) Stop(_ context.Context) {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	s.wg.Wait()
+}
+
+// Drain stops the bridges from taking new streams from their reflectors
+func (s *Server) Drain() {
+	for _, bridge := range s.bridges {
+		bridge.draining.Store(true)
+	}
+}
+
+// ActiveStreams returns how many bridges are publishing a stream from their reflector
+func (s *Server) ActiveStreams() int {
+	active := 0
+	for _, bridge := range s.bridges {
+		if bridge.receiving.Load() {
+			active++
+		}
+	}
+	return active
+}
+
+// QueueDepths reports how many bridges are configured and connected
+func (s *Server) QueueDepths() map[string]int {
+	connected := 0
+	for _, bridge := range s.bridges {
+		if bridge.connected.Load() {
+			connected++
+		}
+	}
+	return map[string]int{
+		"bridges":   len(s.bridges),
+		"connected": connected,
+	}
+}
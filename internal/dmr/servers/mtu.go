@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package servers
+
+import (
+	"errors"
+	"net"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var ErrDatagramTooLarge = errors.New("datagram is larger than the peer accepts")
+
+var (
+	oversizedDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dmrhub_oversized_datagrams_dropped_total",
+		Help: "Datagrams dropped because they were larger than the peer accepts",
+	}, []string{"protocol"})
+	datagramsDowngraded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dmrhub_datagrams_downgraded_total",
+		Help: "Datagrams trimmed or split to fit within the peer's maximum datagram size",
+	}, []string{"protocol", "action"})
+)
+
+// SetMaxDatagram sets the largest datagram addr accepts, 0 meaning the hub's MAX_DATAGRAM_SIZE
+func (l *UDPListeners) SetMaxDatagram(addr *net.UDPAddr, size int) {
+	if size <= 0 {
+		l.limits.Delete(addr.String())
+		return
+	}
+	l.limits.Store(addr.String(), size)
+}
+
+// MaxDatagram is the largest datagram to send addr: its own size or the hub's,
+// lowered to what the path has been seen to carry. 0 means there is no limit.
+func (l *UDPListeners) MaxDatagram(addr *net.UDPAddr) int {
+	key := addr.String()
+	limit, ok := l.limits.Load(key)
+	if !ok {
+		limit = config.GetConfig().MaxDatagramSize
+	}
+	if observed, ok := l.observed.Load(key); ok && (limit == 0 || observed < limit) {
+		limit = observed
+	}
+	return limit
+}
+
+// Downgraded counts a datagram the protocol trimmed or split to fit MaxDatagram
+func (l *UDPListeners) Downgraded(action string) {
+	datagramsDowngraded.WithLabelValues(l.protocol, action).Inc()
+}
+
+// observeTooLarge lowers the path limit to addr after the kernel refused a datagram
+// of the given size, which it does once path MTU discovery learns of a smaller link
+func (l *UDPListeners) observeTooLarge(addr *net.UDPAddr, size int) {
+	oversizedDropped.WithLabelValues(l.protocol).Inc()
+	limit := size - 1
+	l.observed.Compute(addr.String(), func(observed int, loaded bool) (int, bool) {
+		if loaded && observed <= limit {
+			return observed, false
+		}
+		logging.Errorf("Path to %s won't carry %d byte datagrams, limiting to %d", addr, size, limit)
+		return limit, false
+	})
+}
@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package servers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var ErrNoNetworkSocket = errors.New("no socket is listening on the network")
+
+var wrongNetworkDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "dmrhub_wrong_network_datagrams_dropped_total",
+	Help: "Datagrams dropped because they arrived from a peer pinned to a different network",
+}, []string{"protocol"})
+
+// nameNetworks finds the sockets listening on the addresses in NETWORKS
+func (l *UDPListeners) nameNetworks() {
+	for name, ip := range config.GetConfig().Networks {
+		for _, conn := range l.conns {
+			local, ok := conn.LocalAddr().(*net.UDPAddr)
+			if ok && local.IP.Equal(ip) {
+				l.networks[name] = conn
+			}
+		}
+	}
+}
+
+// NetworkOf names the network whose socket addr last reached us on, or "" if it isn't a named network
+func (l *UDPListeners) NetworkOf(addr *net.UDPAddr) string {
+	conn, ok := l.routes.Load(addr.String())
+	if !ok {
+		return ""
+	}
+	for name, networkConn := range l.networks {
+		if networkConn == conn {
+			return name
+		}
+	}
+	return ""
+}
+
+// Pin restricts addr to a named network: its traffic is only sent through that network's socket,
+// and anything it sends through another socket is dropped. An empty network removes the pin.
+func (l *UDPListeners) Pin(addr *net.UDPAddr, network string) {
+	if network == "" {
+		l.pins.Delete(addr.String())
+		return
+	}
+	l.pins.Store(addr.String(), network)
+}
+
+// onPinnedNetwork reports whether a datagram from addr arrived on the socket of the network it's pinned to
+func (l *UDPListeners) onPinnedNetwork(conn *net.UDPConn, addr *net.UDPAddr) bool {
+	network, ok := l.pins.Load(addr.String())
+	if !ok || l.networks[network] == conn {
+		return true
+	}
+	wrongNetworkDropped.WithLabelValues(l.protocol).Inc()
+	if config.GetConfig().Debug {
+		logging.Errorf("Dropping datagram from %s, which is pinned to network %s", addr, network)
+	}
+	return false
+}
+
+// egress picks the socket to send to addr through
+func (l *UDPListeners) egress(addr *net.UDPAddr) (*net.UDPConn, error) {
+	key := addr.String()
+	if network, ok := l.pins.Load(key); ok {
+		conn, ok := l.networks[network]
+		if !ok {
+			return nil, fmt.Errorf("%w %s, not sending to %s", ErrNoNetworkSocket, network, addr)
+		}
+		return conn, nil
+	}
+	conn, ok := l.routes.Load(key)
+	if !ok {
+		conn = l.conns[0]
+	}
+	return conn, nil
+}
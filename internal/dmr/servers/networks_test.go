@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package servers
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestPinnedNetwork(t *testing.T) {
+	t.Parallel()
+	listeners, err := ListenUDP("test", []string{"127.0.0.1:0", "127.0.0.1:0"}, 65536)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listeners.Close()
+	public, vpn := listeners.conns[0], listeners.conns[1]
+	listeners.networks["wg0"] = vpn
+
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9}
+	listeners.routes.Store(peer.String(), public)
+	if network := listeners.NetworkOf(peer); network != "" {
+		t.Errorf("Expected the public socket to have no network, got %q", network)
+	}
+	listeners.routes.Store(peer.String(), vpn)
+	if network := listeners.NetworkOf(peer); network != "wg0" {
+		t.Errorf("Expected wg0, got %q", network)
+	}
+
+	listeners.routes.Store(peer.String(), public)
+	listeners.Pin(peer, "wg0")
+	if conn, err := listeners.egress(peer); err != nil || conn != vpn {
+		t.Errorf("Expected a pinned peer to be sent to over its network, got %v", err)
+	}
+	if listeners.onPinnedNetwork(public, peer) {
+		t.Error("Expected traffic from a pinned peer on another socket to be dropped")
+	}
+	if !listeners.onPinnedNetwork(vpn, peer) {
+		t.Error("Expected traffic from a pinned peer on its network to be accepted")
+	}
+
+	listeners.Pin(peer, "lan")
+	if _, err := listeners.egress(peer); !errors.Is(err, ErrNoNetworkSocket) {
+		t.Errorf("Expected ErrNoNetworkSocket, got %v", err)
+	}
+
+	listeners.Pin(peer, "")
+	if conn, err := listeners.egress(peer); err != nil || conn != public {
+		t.Errorf("Expected an unpinned peer to use its route, got %v", err)
+	}
+}
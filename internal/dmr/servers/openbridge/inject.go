@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package openbridge
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1" //#nosec G505 -- False positive, used for a protocol
+	"errors"
+	"fmt"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"go.opentelemetry.io/otel"
+	"gorm.io/gorm"
+)
+
+var ErrUnknownPeer = errors.New("unknown peer")
+
+// InjectPacket hands a DMRD packet to the OpenBridge server as if the peer had sent it,
+// signed with the peer's password so it passes the HMAC check.
+// It can be called from outside the server, such as from the API.
+func InjectPacket(ctx context.Context, db *gorm.DB, redis *servers.RedisClient, peerID uint, packet models.Packet) error {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "openbridge.InjectPacket")
+	defer span.End()
+
+	if !models.PeerIDExists(db, peerID) {
+		return ErrUnknownPeer
+	}
+	peer := models.FindPeerByID(db, peerID)
+
+	packet.Signature = string(dmrconst.CommandDMRD)
+	packet.Repeater = peerID
+	// OpenBridge packets don't carry BER and RSSI
+	data := packet.Encode()[:dmrconst.HBRPPacketLength]
+	h := hmac.New(sha1.New, []byte(peer.Password))
+	_, err := h.Write(data)
+	if err != nil {
+		return fmt.Errorf("failed to sign packet: %w", err)
+	}
+	p := models.RawDMRPacket{
+		Data: h.Sum(data),
+	}
+	packedBytes, err := p.MarshalMsg(nil)
+	if err != nil {
+		return fmt.Errorf("failed to marshal packet: %w", err)
+	}
+	err = redis.Redis.Publish(ctx, "openbridge:incoming", packedBytes).Err()
+	if err != nil {
+		return fmt.Errorf("failed to publish packet: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package openbridge
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestInjectPacketIsSigned(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Peer{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	_, client := fakeredis.New(t)
+	redis := servers.MakeRedisClient(client)
+	packet := models.Packet{Src: 3118605, Dst: 3100, GroupCall: true, StreamID: 43, FrameType: dmrconst.FrameVoice}
+
+	err = InjectPacket(ctx, db, redis, 1001, packet)
+	if !errors.Is(err, ErrUnknownPeer) {
+		t.Fatalf("Expected ErrUnknownPeer, got %v", err)
+	}
+
+	peer := models.Peer{ID: 1001, Password: "s3cret", OwnerID: 1}
+	db.Create(&models.User{ID: 1, Callsign: "N0CALL", Username: "n0call"})
+	if err := db.Create(&peer).Error; err != nil {
+		t.Fatalf("Failed to create peer: %v", err)
+	}
+
+	sub := client.Subscribe(ctx, "openbridge:incoming")
+	t.Cleanup(func() { _ = sub.Close() })
+	if _, err := sub.Receive(ctx); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	if err := InjectPacket(ctx, db, redis, peer.ID, packet); err != nil {
+		t.Fatalf("Failed to inject: %v", err)
+	}
+
+	msg, err := sub.ReceiveMessage(ctx)
+	if err != nil {
+		t.Fatalf("Failed to receive the packet: %v", err)
+	}
+	var raw models.RawDMRPacket
+	if _, err := raw.UnmarshalMsg([]byte(msg.Payload)); err != nil {
+		t.Fatalf("Failed to unmarshal the packet: %v", err)
+	}
+	if len(raw.Data) != packetLength {
+		t.Fatalf("Expected a %d byte OpenBridge packet, got %d", packetLength, len(raw.Data))
+	}
+	packetBytes := raw.Data[:dmrconst.HBRPPacketLength]
+	hmacBytes := raw.Data[dmrconst.HBRPPacketLength:]
+	s := &Server{}
+	if !s.validateHMAC(ctx, packetBytes, hmacBytes, peer) {
+		t.Error("Expected the packet to be signed with the peer's password")
+	}
+	if s.validateHMAC(ctx, packetBytes, hmacBytes, models.Peer{Password: "wrong"}) {
+		t.Error("Expected the signature to fail with another password")
+	}
+	got, ok := models.UnpackPacket(packetBytes)
+	if !ok {
+		t.Fatal("Failed to unpack the injected packet")
+	}
+	if got.Repeater != peer.ID || got.Src != packet.Src || got.Dst != packet.Dst {
+		t.Errorf("Unexpected packet: %s", got.String())
+	}
+}
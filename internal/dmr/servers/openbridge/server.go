@@ -31,9 +31,12 @@ import (
 	"github.com/USA-RedDragon/DMRHub/internal/db/models"
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/calltracker"
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/ingress"
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/rules"
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/inhibit"
 	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/pubsub"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
@@ -45,29 +48,26 @@ const bufferSize = 1000000 // 1MB
 
 // OpenBridge is the same as HBRP, but with a single packet type.
 type Server struct {
-	Buffer        []byte
-	SocketAddress net.UDPAddr
-	Server        *net.UDPConn
-	Tracer        trace.Tracer
+	Listeners *servers.UDPListeners
+	Tracer    trace.Tracer
 
 	DB    *gorm.DB
 	Redis *servers.RedisClient
 
-	CallTracker *calltracker.CallTracker
+	CallTracker   *calltracker.CallTracker
+	IngressFilter ingress.Filter
+	Quarantine    *ingress.Quarantine
 }
 
 // MakeServer creates a new DMR server.
 func MakeServer(db *gorm.DB, redisClient *servers.RedisClient, callTracker *calltracker.CallTracker) Server {
 	return Server{
-		Buffer: make([]byte, largestMessageSize),
-		SocketAddress: net.UDPAddr{
-			IP:   net.ParseIP(config.GetConfig().ListenAddr),
-			Port: config.GetConfig().OpenBridgePort,
-		},
-		DB:          db,
-		Redis:       redisClient,
-		CallTracker: callTracker,
-		Tracer:      otel.Tracer("dmr-openbridge-server"),
+		DB:            db,
+		Redis:         redisClient,
+		CallTracker:   callTracker,
+		Tracer:        otel.Tracer("dmr-openbridge-server"),
+		IngressFilter: ingress.NewFilter(ingress.ProtocolOpenBridge),
+		Quarantine:    ingress.NewQuarantine(ingress.ProtocolOpenBridge, redisClient.Redis),
 	}
 }
 
@@ -76,52 +76,39 @@ func (s *Server) Start(ctx context.Context) error {
 	ctx, span := otel.Tracer("DMRHub").Start(ctx, "Server.Start")
 	defer span.End()
 
-	server, err := net.ListenUDP("udp", &s.SocketAddress)
+	listeners, err := servers.ListenUDP("openbridge", config.GetConfig().OpenBridgeListen, bufferSize)
 	if err != nil {
 		return fmt.Errorf("error opening UDP Socket: %w", err)
 	}
 
-	err = server.SetReadBuffer(bufferSize)
-	if err != nil {
-		return fmt.Errorf("error setting UDP Socket read buffer: %w", err)
-	}
-	err = server.SetWriteBuffer(bufferSize)
-	if err != nil {
-		return fmt.Errorf("error setting UDP Socket write buffer: %w", err)
-	}
-
-	s.Server = server
+	s.Listeners = listeners
 
-	logging.Logf("OpenBridge Server listening at %s on port %d", s.SocketAddress.IP.String(), s.SocketAddress.Port)
+	for _, addr := range s.Listeners.Addrs() {
+		logging.Logf("OpenBridge Server listening at %s", addr)
+	}
 
 	go s.listen(ctx)
 	go s.subcribeOutgoing(ctx)
+	go s.Quarantine.Listen(ctx)
 
-	go func() {
-		for {
-			length, remoteaddr, err := s.Server.ReadFromUDP(s.Buffer)
-			if config.GetConfig().Debug {
-				logging.Logf("Read a message from %v\n", remoteaddr)
-			}
-			if err != nil {
-				logging.Errorf("Error reading from UDP Socket, Swallowing Error: %v", err)
-				continue
-			}
-			go func() {
-				p := models.RawDMRPacket{
-					Data:       s.Buffer[:length],
-					RemoteIP:   remoteaddr.IP.String(),
-					RemotePort: remoteaddr.Port,
-				}
-				packedBytes, err := p.MarshalMsg(nil)
-				if err != nil {
-					logging.Errorf("Error marshalling packet: %v", err)
-					return
-				}
-				s.Redis.Redis.Publish(ctx, "openbridge:incoming", packedBytes)
-			}()
+	s.Listeners.Serve(largestMessageSize, func(data []byte, remoteaddr *net.UDPAddr) bool {
+		if config.GetConfig().Debug {
+			logging.Logf("Read a message from %v\n", remoteaddr)
 		}
-	}()
+		return s.Quarantine.Allow(remoteaddr, data) && s.IngressFilter.Allow(remoteaddr, data)
+	}, func(data []byte, remoteaddr *net.UDPAddr) {
+		p := models.RawDMRPacket{
+			Data:       data,
+			RemoteIP:   remoteaddr.IP.String(),
+			RemotePort: remoteaddr.Port,
+		}
+		packedBytes, err := p.MarshalMsg(nil)
+		if err != nil {
+			logging.Errorf("Error marshalling packet: %v", err)
+			return
+		}
+		go s.Redis.Redis.Publish(ctx, "openbridge:incoming", packedBytes)
+	})
 
 	return nil
 }
@@ -134,14 +121,14 @@ func (s *Server) listen(ctx context.Context) {
 	ctx, span := otel.Tracer("DMRHub").Start(ctx, "Server.listen")
 	defer span.End()
 
-	pubsub := s.Redis.Redis.Subscribe(ctx, "openbridge:incoming")
+	subscription := s.Redis.Redis.Subscribe(ctx, "openbridge:incoming")
 	defer func() {
-		err := pubsub.Close()
+		err := subscription.Close()
 		if err != nil {
 			logging.Errorf("Error closing pubsub: %v", err)
 		}
 	}()
-	for msg := range pubsub.Channel() {
+	for msg := range pubsub.Receive(ctx, subscription, "openbridge") {
 		var packet models.RawDMRPacket
 		_, err := packet.UnmarshalMsg([]byte(msg.Payload))
 		if err != nil {
@@ -156,14 +143,14 @@ func (s *Server) listen(ctx context.Context) {
 }
 
 func (s *Server) subcribeOutgoing(ctx context.Context) {
-	pubsub := s.Redis.Redis.Subscribe(ctx, "openbridge:outgoing")
+	subscription := s.Redis.Redis.Subscribe(ctx, "openbridge:outgoing")
 	defer func() {
-		err := pubsub.Close()
+		err := subscription.Close()
 		if err != nil {
 			logging.Errorf("Error closing pubsub: %v", err)
 		}
 	}()
-	for msg := range pubsub.Channel() {
+	for msg := range pubsub.Receive(ctx, subscription, "openbridge") {
 		packet, ok := models.UnpackPacket([]byte(msg.Payload))
 		if !ok {
 			logging.Errorf("Error unpacking packet")
@@ -176,10 +163,19 @@ func (s *Server) subcribeOutgoing(ctx context.Context) {
 		}
 		// OpenBridge is always TS1
 		packet.Slot = false
-		_, err = s.Server.WriteToUDP(packet.Encode(), &net.UDPAddr{
+		addr := &net.UDPAddr{
 			IP:   net.ParseIP(peer.IP),
 			Port: peer.Port,
-		})
+		}
+		s.Listeners.SetMaxDatagram(addr, int(peer.MaxDatagram))
+		s.Listeners.Pin(addr, peer.Network)
+		data := packet.Encode()
+		if limit := s.Listeners.MaxDatagram(addr); limit > 0 && len(data) > limit && limit >= dmrconst.HBRPPacketLength {
+			// BER and RSSI are optional, drop them before dropping the packet
+			data = data[:dmrconst.HBRPPacketLength]
+			s.Listeners.Downgraded("trimmed")
+		}
+		_, err = s.Listeners.WriteToUDP(data, addr)
 		if err != nil {
 			logging.Errorf("Error sending packet: %v", err)
 		}
@@ -231,7 +227,7 @@ func (s *Server) validateHMAC(ctx context.Context, packetBytes []byte, hmacBytes
 	return true
 }
 
-func (s *Server) handlePacket(ctx context.Context, _ *net.UDPAddr, data []byte) {
+func (s *Server) handlePacket(ctx context.Context, remoteAddr *net.UDPAddr, data []byte) {
 	ctx, span := otel.Tracer("DMRHub").Start(ctx, "Server.handlePacket")
 	defer span.End()
 
@@ -279,6 +275,11 @@ func (s *Server) handlePacket(ctx context.Context, _ *net.UDPAddr, data []byte)
 
 	peer := models.FindPeerByID(s.DB, peerID)
 
+	if peer.Network != "" && s.Listeners.NetworkOf(remoteAddr) != peer.Network {
+		logging.Errorf("Peer %d must connect over network %s, ignoring packet from %s", peerID, peer.Network, remoteAddr.String())
+		return
+	}
+
 	if !s.validateHMAC(ctx, packetBytes, hmacBytes, peer) {
 		logging.Error("Invalid OpenBridge HMAC")
 		return
@@ -288,6 +289,10 @@ func (s *Server) handlePacket(ctx context.Context, _ *net.UDPAddr, data []byte)
 		return
 	}
 
+	if inhibit.Blocks(packet) {
+		return
+	}
+
 	// We need to send this packet to all peers except the one that sent it
 	peers := models.ListPeers(s.DB)
 	for _, p := range peers {
@@ -320,3 +325,11 @@ func (s *Server) TrackCall(ctx context.Context, packet models.Packet, isVoice bo
 		}
 	}
 }
+
+// QueueDepths reports the work buffered by the OpenBridge server
+func (s *Server) QueueDepths() map[string]int {
+	return map[string]int{
+		"in_flight_calls": s.CallTracker.InFlightCalls(),
+		"subscriptions":   GetSubscriptionManager().Count(),
+	}
+}
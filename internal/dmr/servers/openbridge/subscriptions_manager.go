@@ -26,6 +26,7 @@ import (
 	"github.com/USA-RedDragon/DMRHub/internal/config"
 	"github.com/USA-RedDragon/DMRHub/internal/db/models"
 	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/pubsub"
 	"github.com/redis/go-redis/v9"
 	"go.opentelemetry.io/otel"
 )
@@ -49,6 +50,13 @@ func GetSubscriptionManager() *SubscriptionManager {
 	return subscriptionManager
 }
 
+// Count returns how many peers have an open subscription
+func (m *SubscriptionManager) Count() int {
+	m.subscriptionsMutex.RLock()
+	defer m.subscriptionsMutex.RUnlock()
+	return len(m.subscriptions)
+}
+
 func (m *SubscriptionManager) CancelSubscription(p models.Peer) {
 	m.subscriptionsMutex.RLock()
 	m.subscriptionCancelMutex[p.ID].RLock()
@@ -95,18 +103,18 @@ func (m *SubscriptionManager) subscribe(ctx context.Context, redis *redis.Client
 	if config.GetConfig().Debug {
 		logging.Logf("Listening for calls on peer %d", p.ID)
 	}
-	pubsub := redis.Subscribe(ctx, "openbridge:packets")
+	subscription := redis.Subscribe(ctx, "openbridge:packets")
 	defer func() {
-		err := pubsub.Unsubscribe(ctx, "openbridge:packets")
+		err := subscription.Unsubscribe(ctx, "openbridge:packets")
 		if err != nil {
 			logging.Errorf("Error unsubscribing from openbridge:packets: %s", err)
 		}
-		err = pubsub.Close()
+		err = subscription.Close()
 		if err != nil {
 			logging.Errorf("Error closing pubsub connection: %s", err)
 		}
 	}()
-	pubsubChannel := pubsub.Channel()
+	pubsubChannel := pubsub.Receive(ctx, subscription, "openbridge")
 
 	for {
 		select {
@@ -126,7 +134,12 @@ func (m *SubscriptionManager) subscribe(ctx context.Context, redis *redis.Client
 			}
 			m.subscriptionsMutex.Unlock()
 			return
-		case msg := <-pubsubChannel:
+		case msg, ok := <-pubsubChannel:
+			if !ok {
+				// Closed once ctx is done, the case above cleans up
+				pubsubChannel = nil
+				continue
+			}
 			rawPacket := models.RawDMRPacket{}
 			_, err := rawPacket.UnmarshalMsg([]byte(msg.Payload))
 			if err != nil {
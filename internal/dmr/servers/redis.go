@@ -21,6 +21,7 @@ package servers
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
@@ -45,7 +46,8 @@ var (
 	ErrUnmarshalPeer     = errors.New("unmarshal peer")
 )
 
-const repeaterExpireTime = 5 * time.Minute
+// RepeaterExpireTime is how long a repeater without a keepalive interval can go without pinging before it is considered disconnected
+const RepeaterExpireTime = models.DefaultPingTimeout
 
 func MakeRedisClient(redis *redis.Client) *RedisClient {
 	return &RedisClient{
@@ -64,7 +66,6 @@ func (s *RedisClient) UpdateRepeaterPing(ctx context.Context, repeaterID uint) {
 	}
 	repeater.LastPing = time.Now()
 	s.StoreRepeater(ctx, repeaterID, repeater)
-	s.Redis.Expire(ctx, fmt.Sprintf("hbrp:repeater:%d", repeaterID), repeaterExpireTime)
 }
 
 func (s *RedisClient) UpdateRepeaterConnection(ctx context.Context, repeaterID uint, connection string) {
@@ -96,8 +97,8 @@ func (s *RedisClient) StoreRepeater(ctx context.Context, repeaterID uint, repeat
 		logging.Errorf("Error marshalling repeater: %v", err)
 		return
 	}
-	// Expire repeaters after 5 minutes, this function called often enough to keep them alive
-	s.Redis.Set(ctx, fmt.Sprintf("hbrp:repeater:%d", repeaterID), repeaterBytes, repeaterExpireTime)
+	// Expire repeaters that stop pinging, this function is called often enough to keep them alive
+	s.Redis.Set(ctx, fmt.Sprintf("hbrp:repeater:%d", repeaterID), repeaterBytes, repeater.PingTimeout())
 }
 
 func (s *RedisClient) GetRepeater(ctx context.Context, repeaterID uint) (models.Repeater, error) {
@@ -132,7 +133,9 @@ func (s *RedisClient) ListRepeaters(ctx context.Context) ([]uint, error) {
 	var cursor uint64
 	var repeaters []uint
 	for {
-		keys, _, err := s.Redis.Scan(ctx, cursor, "hbrp:repeater:*", 0).Result()
+		var keys []string
+		var err error
+		keys, cursor, err = s.Redis.Scan(ctx, cursor, "hbrp:repeater:*", 0).Result()
 		if err != nil {
 			return nil, ErrNoSuchRepeater
 		}
@@ -151,6 +154,230 @@ func (s *RedisClient) ListRepeaters(ctx context.Context) ([]uint, error) {
 	return repeaters, nil
 }
 
+// repeaterLatencyExpireTime keeps a latency measurement until well after the repeater would log in again
+const repeaterLatencyExpireTime = 24 * time.Hour
+
+// StoreRepeaterLatency records the one-way network latency measured to a repeater
+func (s *RedisClient) StoreRepeaterLatency(ctx context.Context, repeaterID uint, latency time.Duration) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "redisClient.storeRepeaterLatency")
+	defer span.End()
+
+	s.Redis.Set(ctx, fmt.Sprintf("hbrp:latency:%d", repeaterID), latency.Microseconds(), repeaterLatencyExpireTime)
+}
+
+// GetRepeaterLatency returns the last latency measured to a repeater, or false if there isn't one
+func (s *RedisClient) GetRepeaterLatency(ctx context.Context, repeaterID uint) (time.Duration, bool) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "redisClient.getRepeaterLatency")
+	defer span.End()
+
+	micros, err := s.Redis.Get(ctx, fmt.Sprintf("hbrp:latency:%d", repeaterID)).Int64()
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(micros) * time.Microsecond, true
+}
+
+// LinkStats describes the network path to a repeater, as seen from the hub.
+// Jitter is the smoothed deviation from the expected arrival time, per RFC 3550.
+type LinkStats struct {
+	PingIntervalMicros int64     `json:"ping_interval_us"`
+	PingJitterMicros   int64     `json:"ping_jitter_us"`
+	VoiceJitterMicros  int64     `json:"voice_jitter_us"`
+	At                 time.Time `json:"at"`
+}
+
+// repeaterLinkHistoryLength keeps a day of one-minute samples
+const repeaterLinkHistoryLength = 1440
+
+// StoreLinkStats records the current link statistics for a repeater, and appends them to its history if sample is set
+func (s *RedisClient) StoreLinkStats(ctx context.Context, repeaterID uint, stats LinkStats, sample bool) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "redisClient.storeLinkStats")
+	defer span.End()
+
+	statsBytes, err := json.Marshal(stats)
+	if err != nil {
+		logging.Errorf("Error marshalling link stats: %v", err)
+		return
+	}
+	_, err = s.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, fmt.Sprintf("hbrp:link:%d", repeaterID), statsBytes, repeaterLatencyExpireTime)
+		if sample {
+			historyKey := fmt.Sprintf("hbrp:link:history:%d", repeaterID)
+			pipe.LPush(ctx, historyKey, statsBytes)
+			pipe.LTrim(ctx, historyKey, 0, repeaterLinkHistoryLength-1)
+			pipe.Expire(ctx, historyKey, repeaterLatencyExpireTime)
+		}
+		return nil
+	})
+	if err != nil {
+		logging.Errorf("Error storing link stats for repeater %d: %v", repeaterID, err)
+	}
+}
+
+// GetLinkStats returns the current link statistics for a repeater, or false if there aren't any
+func (s *RedisClient) GetLinkStats(ctx context.Context, repeaterID uint) (LinkStats, bool) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "redisClient.getLinkStats")
+	defer span.End()
+
+	var stats LinkStats
+	statsBytes, err := s.Redis.Get(ctx, fmt.Sprintf("hbrp:link:%d", repeaterID)).Bytes()
+	if err != nil || json.Unmarshal(statsBytes, &stats) != nil {
+		return LinkStats{}, false
+	}
+	return stats, true
+}
+
+// GetLinkHistory returns up to a day of per-minute link statistics for a repeater, newest first
+func (s *RedisClient) GetLinkHistory(ctx context.Context, repeaterID uint) ([]LinkStats, error) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "redisClient.getLinkHistory")
+	defer span.End()
+
+	samples, err := s.Redis.LRange(ctx, fmt.Sprintf("hbrp:link:history:%d", repeaterID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read link history: %w", err)
+	}
+	history := make([]LinkStats, 0, len(samples))
+	for _, sample := range samples {
+		var stats LinkStats
+		if err := json.Unmarshal([]byte(sample), &stats); err != nil {
+			continue
+		}
+		history = append(history, stats)
+	}
+	return history, nil
+}
+
+// OccupancySample is how many seconds per minute a time slot was busy
+type OccupancySample struct {
+	At          time.Time `json:"at"`
+	BusySeconds float64   `json:"busy_seconds"`
+}
+
+// OccupancyResolution selects one of the stored occupancy series
+type OccupancyResolution string
+
+const (
+	// OccupancyMinute keeps a day of one-minute samples
+	OccupancyMinute OccupancyResolution = "minute"
+	// OccupancyHour keeps 30 days of hourly averages
+	OccupancyHour OccupancyResolution = "hour"
+)
+
+const (
+	occupancyMinuteHistoryLength = 1440
+	occupancyHourHistoryLength   = 720
+	occupancyExpireTime          = 30 * 24 * time.Hour
+)
+
+func occupancyKey(repeaterID uint, slot bool, resolution OccupancyResolution) string {
+	ts := 1
+	if slot {
+		ts = 2
+	}
+	return fmt.Sprintf("hbrp:occupancy:%s:%d:%d", resolution, repeaterID, ts)
+}
+
+// StoreOccupancy appends a sample to a repeater slot's occupancy series
+func (s *RedisClient) StoreOccupancy(ctx context.Context, repeaterID uint, slot bool, resolution OccupancyResolution, sample OccupancySample) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "redisClient.storeOccupancy")
+	defer span.End()
+
+	sampleBytes, err := json.Marshal(sample)
+	if err != nil {
+		logging.Errorf("Error marshalling occupancy sample: %v", err)
+		return
+	}
+	length := int64(occupancyMinuteHistoryLength)
+	if resolution == OccupancyHour {
+		length = occupancyHourHistoryLength
+	}
+	key := occupancyKey(repeaterID, slot, resolution)
+	_, err = s.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, key, sampleBytes)
+		pipe.LTrim(ctx, key, 0, length-1)
+		pipe.Expire(ctx, key, occupancyExpireTime)
+		return nil
+	})
+	if err != nil {
+		logging.Errorf("Error storing occupancy for repeater %d: %v", repeaterID, err)
+	}
+}
+
+// GetOccupancy returns a repeater slot's occupancy series, newest first.
+// Minutes in which the slot was idle have no sample.
+func (s *RedisClient) GetOccupancy(ctx context.Context, repeaterID uint, slot bool, resolution OccupancyResolution) ([]OccupancySample, error) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "redisClient.getOccupancy")
+	defer span.End()
+
+	samples, err := s.Redis.LRange(ctx, occupancyKey(repeaterID, slot, resolution), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read occupancy: %w", err)
+	}
+	series := make([]OccupancySample, 0, len(samples))
+	for _, sample := range samples {
+		var occupancy OccupancySample
+		if err := json.Unmarshal([]byte(sample), &occupancy); err != nil {
+			continue
+		}
+		series = append(series, occupancy)
+	}
+	return series, nil
+}
+
+// WebListenerTTL is how long a web listener is counted without being refreshed,
+// so listeners held by a replica that went away don't linger
+const WebListenerTTL = time.Minute
+
+func webListenersKey(talkgroupID uint) string {
+	return fmt.Sprintf("listeners:web:%d", talkgroupID)
+}
+
+// AddWebListener counts a web client as listening to a talkgroup. It has to be added
+// again within WebListenerTTL to keep being counted.
+func (s *RedisClient) AddWebListener(ctx context.Context, talkgroupID uint, listenerID string) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "redisClient.addWebListener")
+	defer span.End()
+
+	key := webListenersKey(talkgroupID)
+	_, err := s.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(time.Now().Add(WebListenerTTL).Unix()), Member: listenerID})
+		pipe.Expire(ctx, key, WebListenerTTL)
+		return nil
+	})
+	if err != nil {
+		logging.Errorf("Error adding web listener to talkgroup %d: %v", talkgroupID, err)
+	}
+}
+
+// RemoveWebListener stops counting a web client as listening to a talkgroup
+func (s *RedisClient) RemoveWebListener(ctx context.Context, talkgroupID uint, listenerID string) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "redisClient.removeWebListener")
+	defer span.End()
+
+	err := s.Redis.ZRem(ctx, webListenersKey(talkgroupID), listenerID).Err()
+	if err != nil {
+		logging.Errorf("Error removing web listener from talkgroup %d: %v", talkgroupID, err)
+	}
+}
+
+// CountWebListeners returns how many web clients are listening to a talkgroup across all replicas
+func (s *RedisClient) CountWebListeners(ctx context.Context, talkgroupID uint) (int, error) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "redisClient.countWebListeners")
+	defer span.End()
+
+	key := webListenersKey(talkgroupID)
+	var count *redis.IntCmd
+	_, err := s.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(time.Now().Unix(), 10))
+		count = pipe.ZCard(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count web listeners: %w", err)
+	}
+	return int(count.Val()), nil
+}
+
 func (s *RedisClient) GetPeer(ctx context.Context, peerID uint) (models.Peer, error) {
 	ctx, span := otel.Tracer("DMRHub").Start(ctx, "Server.handlePacket")
 	defer span.End()
@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package servers_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+)
+
+func TestListRepeatersFollowsCursor(t *testing.T) {
+	t.Parallel()
+	fake, client := fakeredis.New(t)
+	fake.ScanCount = 3
+	ctx := context.Background()
+
+	var want []uint
+	for id := uint(311860100); id < 311860110; id++ {
+		client.Set(ctx, fmt.Sprintf("hbrp:repeater:%d", id), "session", 0)
+		// Unrelated keys make some pages come back without a match
+		client.Set(ctx, fmt.Sprintf("hbrp:latency:%d", id), 1, 0)
+		want = append(want, id)
+	}
+
+	repeaters, err := servers.MakeRedisClient(client).ListRepeaters(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(repeaters)
+	if !slices.Equal(repeaters, want) {
+		t.Errorf("Expected every repeater across all SCAN pages, got %v", repeaters)
+	}
+}
@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package servers
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/hubevents"
+)
+
+// QueueReporter is implemented by servers that can report how much work they have buffered
+type QueueReporter interface {
+	QueueDepths() map[string]int
+}
+
+// Drainer is implemented by servers that can stop taking new streams while their active ones finish
+type Drainer interface {
+	Drain()
+	ActiveStreams() int
+}
+
+// How often Drain checks whether the active streams have finished
+const drainPollInterval = 100 * time.Millisecond
+
+//nolint:golint,gochecknoglobals
+var (
+	registry      = map[string]QueueReporter{}
+	registryMutex sync.RWMutex
+)
+
+// Register makes a running server's queue depths available to the admin runtime endpoint
+func Register(name string, server QueueReporter) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	registry[name] = server
+	hubevents.Record(models.HubEvent{Kind: models.HubEventServerRegistered, Server: name})
+}
+
+// Unregister removes a server registered with Register
+func Unregister(name string) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	delete(registry, name)
+	hubevents.Record(models.HubEvent{Kind: models.HubEventServerUnregistered, Server: name})
+}
+
+// QueueDepths returns the queue depths of every registered server, keyed by server name
+func QueueDepths() map[string]map[string]int {
+	registryMutex.RLock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	registryMutex.RUnlock()
+	sort.Strings(names)
+
+	depths := make(map[string]map[string]int, len(names))
+	for _, name := range names {
+		registryMutex.RLock()
+		server, ok := registry[name]
+		registryMutex.RUnlock()
+		if ok {
+			depths[name] = server.QueueDepths()
+		}
+	}
+	return depths
+}
+
+// Drain stops every registered server that can drain from accepting new streams, then waits for
+// their active streams to finish. It gives up when ctx is done and returns how many were left.
+func Drain(ctx context.Context) int {
+	registryMutex.RLock()
+	drainers := make([]Drainer, 0, len(registry))
+	for _, server := range registry {
+		if drainer, ok := server.(Drainer); ok {
+			drainers = append(drainers, drainer)
+		}
+	}
+	registryMutex.RUnlock()
+
+	for _, drainer := range drainers {
+		drainer.Drain()
+	}
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		active := 0
+		for _, drainer := range drainers {
+			active += drainer.ActiveStreams()
+		}
+		if active == 0 {
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			return active
+		case <-ticker.C:
+		}
+	}
+}
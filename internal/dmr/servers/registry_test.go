@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package servers_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+)
+
+type fakeServer struct {
+	depth int
+}
+
+func (f *fakeServer) QueueDepths() map[string]int {
+	return map[string]int{"queue": f.depth}
+}
+
+func TestQueueDepths(t *testing.T) {
+	t.Parallel()
+	server := &fakeServer{depth: 3}
+	servers.Register("fake", server)
+
+	depths := servers.QueueDepths()
+	if depths["fake"]["queue"] != 3 {
+		t.Errorf("Expected a queue depth of 3, got %v", depths["fake"])
+	}
+
+	server.depth = 5
+	if depth := servers.QueueDepths()["fake"]["queue"]; depth != 5 {
+		t.Errorf("Expected depths to be read live, got %d", depth)
+	}
+
+	servers.Unregister("fake")
+	if _, ok := servers.QueueDepths()["fake"]; ok {
+		t.Error("Expected the server to be unregistered")
+	}
+}
+
+type fakeDrainer struct {
+	fakeServer
+	draining atomic.Bool
+	active   atomic.Int32
+}
+
+func (f *fakeDrainer) Drain() {
+	f.draining.Store(true)
+}
+
+func (f *fakeDrainer) ActiveStreams() int {
+	return int(f.active.Load())
+}
+
+// Not parallel, Drain sees every registered server
+func TestDrain(t *testing.T) {
+	server := &fakeDrainer{}
+	server.active.Store(2)
+	servers.Register("drainer", server)
+	defer servers.Unregister("drainer")
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		server.active.Store(0)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if left := servers.Drain(ctx); left != 0 {
+		t.Errorf("Expected every stream to finish, %d left", left)
+	}
+	if !server.draining.Load() {
+		t.Error("Expected the server to stop taking new streams")
+	}
+}
+
+// Not parallel, Drain sees every registered server
+func TestDrainTimeout(t *testing.T) {
+	server := &fakeDrainer{}
+	server.active.Store(1)
+	servers.Register("stuck", server)
+	defer servers.Unregister("stuck")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if left := servers.Drain(ctx); left != 1 {
+		t.Errorf("Expected the stuck stream to be reported, got %d", left)
+	}
+}
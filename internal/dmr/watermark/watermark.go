@@ -0,0 +1,151 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package watermark hides a per-repeater mark in the AMBE voice a hub sends out,
+// so audio re-broadcast from a leaked stream can be traced to the repeater it was sent to.
+//
+// Each of the three AMBE frames in a voice burst has 25 bits with no error correction,
+// the last of which is the least significant bit of the least important vocoder parameter.
+// That bit is replaced with a keyed hash of the repeater ID and the frame's
+// Golay protected C0 bits, so about half the frames are changed by one bit.
+// Because the hash only depends on the frame itself, the mark survives the audio
+// being relayed digitally through other networks, and a capture can be checked
+// against each candidate repeater without the original stream. Around half the
+// frames match for the wrong repeater and all of them for the right one.
+package watermark
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+)
+
+// FramesPerBurst is the number of AMBE frames in a voice burst
+const FramesPerBurst = 3
+
+const (
+	frameBits = 72
+	// The payload is split around 48 bits of sync or embedded signalling in the middle of the burst
+	halfPayloadBits = 108
+	syncBits        = 48
+	// markBit is the last unprotected bit of a frame
+	markBit = 71
+
+	// MinFrames is how many frames Likely needs before it will name a repeater,
+	// about two seconds of audio
+	MinFrames = 100
+	// likelyRatio is 5 standard deviations above the half of frames a wrong repeater matches at MinFrames
+	likelyRatio = 0.75
+)
+
+// cZeroBits are the positions of the 24 C0 bits within a frame
+//
+//nolint:golint,gochecknoglobals
+var cZeroBits = [24]uint{
+	0, 4, 8, 12, 16, 20, 24, 28, 32, 36, 40, 44,
+	48, 52, 56, 60, 64, 68, 1, 5, 9, 13, 17, 21,
+}
+
+// burstBit maps a bit of a frame to its position in the 264 bit burst
+func burstBit(frame int, bit uint) uint {
+	position := uint(frame)*frameBits + bit
+	if position >= halfPayloadBits {
+		position += syncBits
+	}
+	return position
+}
+
+func readBit(data *[33]byte, position uint) byte {
+	return (data[position/8] >> (7 - position%8)) & 1
+}
+
+func writeBit(data *[33]byte, position uint, value byte) {
+	mask := byte(1) << (7 - position%8)
+	if value == 0 {
+		data[position/8] &^= mask
+	} else {
+		data[position/8] |= mask
+	}
+}
+
+// cZero reads a frame's C0 bits as sent, without decoding the Golay code
+func cZero(data *[33]byte, frame int) uint32 {
+	var c0 uint32
+	for _, bit := range cZeroBits {
+		c0 = c0<<1 | uint32(readBit(data, burstBit(frame, bit)))
+	}
+	return c0
+}
+
+// Bit is the mark a repeater gets on a frame with the given C0 bits
+func Bit(key []byte, repeaterID uint, c0 uint32) byte {
+	mac := hmac.New(sha256.New, key)
+	var input [8]byte
+	binary.BigEndian.PutUint32(input[:4], uint32(repeaterID))
+	binary.BigEndian.PutUint32(input[4:], c0)
+	mac.Write(input[:])
+	return mac.Sum(nil)[0] & 1
+}
+
+// Apply marks the three AMBE frames of a voice burst for a repeater
+func Apply(data *[33]byte, key []byte, repeaterID uint) {
+	for frame := 0; frame < FramesPerBurst; frame++ {
+		writeBit(data, burstBit(frame, markBit), Bit(key, repeaterID, cZero(data, frame)))
+	}
+}
+
+// Score is how well captured audio matches a repeater's mark
+type Score struct {
+	RepeaterID uint `json:"repeater_id"`
+	Frames     int  `json:"frames"`
+	Matches    int  `json:"matches"`
+}
+
+// Ratio is the share of frames carrying the repeater's mark
+func (s Score) Ratio() float64 {
+	if s.Frames == 0 {
+		return 0
+	}
+	return float64(s.Matches) / float64(s.Frames)
+}
+
+// Likely reports whether there's enough audio, matching closely enough, to say it was sent to the repeater
+func (s Score) Likely() bool {
+	return s.Frames >= MinFrames && s.Ratio() >= likelyRatio
+}
+
+// Detect scores each candidate repeater against captured voice bursts, best match first
+func Detect(bursts [][33]byte, key []byte, candidates []uint) []Score {
+	scores := make([]Score, 0, len(candidates))
+	for _, repeaterID := range candidates {
+		score := Score{RepeaterID: repeaterID}
+		for i := range bursts {
+			for frame := 0; frame < FramesPerBurst; frame++ {
+				score.Frames++
+				if readBit(&bursts[i], burstBit(frame, markBit)) == Bit(key, repeaterID, cZero(&bursts[i], frame)) {
+					score.Matches++
+				}
+			}
+		}
+		scores = append(scores, score)
+	}
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].Matches > scores[j].Matches })
+	return scores
+}
@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package watermark_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/watermark"
+)
+
+func randomBursts(count int) [][33]byte {
+	rng := rand.New(rand.NewSource(1)) //nolint:gosec
+	bursts := make([][33]byte, count)
+	for i := range bursts {
+		rng.Read(bursts[i][:])
+	}
+	return bursts
+}
+
+func TestApplyOnlyTouchesMarkBits(t *testing.T) {
+	t.Parallel()
+	key := []byte("secret")
+	for _, burst := range randomBursts(50) {
+		marked := burst
+		watermark.Apply(&marked, key, 311001)
+		changed := 0
+		for i := range burst {
+			diff := burst[i] ^ marked[i]
+			for ; diff != 0; diff &= diff - 1 {
+				changed++
+			}
+		}
+		if changed > 3 {
+			t.Fatalf("Expected at most one bit changed per frame, got %d", changed)
+		}
+		// The sync or embedded signalling in the middle of the burst is never touched
+		if burst[13]&0x0F != marked[13]&0x0F || burst[19]&0xF0 != marked[19]&0xF0 || string(burst[14:19]) != string(marked[14:19]) {
+			t.Fatal("Expected the sync bits to be left alone")
+		}
+		again := marked
+		watermark.Apply(&again, key, 311001)
+		if again != marked {
+			t.Fatal("Expected marking twice to change nothing")
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+	key := []byte("secret")
+	bursts := randomBursts(watermark.MinFrames)
+	for i := range bursts {
+		watermark.Apply(&bursts[i], key, 311002)
+	}
+	scores := watermark.Detect(bursts, key, []uint{311001, 311002, 311003})
+	if scores[0].RepeaterID != 311002 || scores[0].Ratio() != 1 || !scores[0].Likely() {
+		t.Fatalf("Expected repeater 311002 to match every frame, got %+v", scores[0])
+	}
+	for _, score := range scores[1:] {
+		if score.Likely() {
+			t.Errorf("Expected repeater %d not to match, got %.2f", score.RepeaterID, score.Ratio())
+		}
+	}
+
+	// A different key can't find the mark
+	for _, score := range watermark.Detect(bursts, []byte("other"), []uint{311002}) {
+		if score.Likely() {
+			t.Errorf("Expected the wrong key not to match, got %.2f", score.Ratio())
+		}
+	}
+
+	// Too little audio never names a repeater
+	if watermark.Detect(bursts[:3], key, []uint{311002})[0].Likely() {
+		t.Error("Expected a short capture not to be conclusive")
+	}
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/pubsub"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+)
+
+// AdminChannel is the redis pubsub channel admin events are published on
+const AdminChannel = "events:admin"
+
+type Type string
+
+const (
+	RepeaterConnected     Type = "repeater_connected"
+	RepeaterDisconnected  Type = "repeater_disconnected"
+	RepeaterAuthFailed    Type = "repeater_auth_failed"
+	RepeaterRejected      Type = "repeater_rejected"
+	UserRegistered        Type = "user_registered"
+	ConfigurationChanged  Type = "configuration_changed"
+	UserDataDeleted       Type = "user_data_deleted"
+	TalkgroupAutoCreated  Type = "talkgroup_auto_created"
+	TXInhibited           Type = "tx_inhibited"
+	TXInhibitLifted       Type = "tx_inhibit_lifted"
+	M17BridgeConnected    Type = "m17_bridge_connected"
+	M17BridgeDisconnected Type = "m17_bridge_disconnected"
+)
+
+// Event is a structured notification for the admin UI
+type Event struct {
+	Type    Type      `json:"type"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+	Data    any       `json:"data,omitempty"`
+}
+
+// Publish sends an event to every connected admin events websocket
+func Publish(ctx context.Context, redis *redis.Client, eventType Type, message string, data any) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "events.Publish")
+	defer span.End()
+
+	eventJSON, err := json.Marshal(Event{
+		Type:    eventType,
+		Time:    time.Now(),
+		Message: message,
+		Data:    data,
+	})
+	if err != nil {
+		logging.Errorf("Error marshalling event: %v", err)
+		return
+	}
+
+	err = pubsub.Publish(ctx, redis, AdminChannel, eventJSON)
+	if err != nil {
+		logging.Errorf("Error publishing event: %v", err)
+	}
+}
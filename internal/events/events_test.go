@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package events_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/events"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+)
+
+func TestPublish(t *testing.T) {
+	t.Parallel()
+	_, redis := fakeredis.New(t)
+	ctx := context.Background()
+
+	subscription := redis.Subscribe(ctx, events.AdminChannel)
+	defer subscription.Close()
+	if _, err := subscription.Receive(ctx); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	before := time.Now()
+	events.Publish(ctx, redis, events.RepeaterConnected, "Repeater 311001 connected", map[string]uint{"repeater_id": 311001})
+
+	select {
+	case msg := <-subscription.Channel():
+		var event struct {
+			events.Event
+			Data map[string]uint `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+			t.Fatalf("Failed to decode event %q: %v", msg.Payload, err)
+		}
+		if event.Type != events.RepeaterConnected || event.Message != "Repeater 311001 connected" {
+			t.Errorf("Unexpected event: %+v", event)
+		}
+		if event.Data["repeater_id"] != 311001 {
+			t.Errorf("Expected the event data to be passed through, got %v", event.Data)
+		}
+		if event.Time.Before(before) {
+			t.Errorf("Expected the event to be timestamped when published, got %v", event.Time)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the event")
+	}
+}
+
+func TestPublishOmitsEmptyData(t *testing.T) {
+	t.Parallel()
+	_, redis := fakeredis.New(t)
+	ctx := context.Background()
+
+	subscription := redis.Subscribe(ctx, events.AdminChannel)
+	defer subscription.Close()
+	if _, err := subscription.Receive(ctx); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	events.Publish(ctx, redis, events.ConfigurationChanged, "Settings updated", nil)
+
+	select {
+	case msg := <-subscription.Channel():
+		var raw map[string]any
+		if err := json.Unmarshal([]byte(msg.Payload), &raw); err != nil {
+			t.Fatalf("Failed to decode event %q: %v", msg.Payload, err)
+		}
+		if _, ok := raw["data"]; ok {
+			t.Errorf("Expected no data field, got %q", msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the event")
+	}
+}
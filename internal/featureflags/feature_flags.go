@@ -16,46 +16,188 @@
 // along with this program. If not, see <https://www.gnu.org/licenses/>.
 //
 // The source code is available at <https://github.com/USA-RedDragon/DMRHub>
-
 package featureflags
 
 import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
 	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
 	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"gorm.io/gorm"
 )
 
 type FeatureFlag string
 
 const (
-	FeatureFlagOpenBridge FeatureFlag = "openbridge"
+	FeatureFlagOpenBridge     FeatureFlag = "openbridge"
+	FeatureFlagResearchExport FeatureFlag = "research_export"
+	FeatureFlagWatermark      FeatureFlag = "voice_watermark"
 )
 
+// Known lists the flags that can be toggled at runtime along with what they gate.
+// Experimental features register their flag here.
+//
+//nolint:golint,gochecknoglobals
+var Known = map[FeatureFlag]string{
+	FeatureFlagOpenBridge:     "OpenBridge peering and the peer management pages",
+	FeatureFlagResearchExport: "Anonymized call metadata export for logged in users",
+	FeatureFlagWatermark:      "Per-repeater watermark in egress voice, needs WATERMARK_SECRET",
+}
+
 var (
+	ErrUnknownFlag = errors.New("unknown feature flag")
+
 	//nolint:golint,gochecknoglobals
 	featureFlagManager *FeatureFlags
 )
 
+// Status is the effective state of a flag
+type Status struct {
+	Name        FeatureFlag `json:"name"`
+	Description string      `json:"description"`
+	Enabled     bool        `json:"enabled"`
+	// Overridden is true when the state comes from the database rather than FEATURE_FLAGS
+	Overridden bool `json:"overridden"`
+}
+
+// FeatureFlags resolves flags from database overrides, falling back to the FEATURE_FLAGS config
 type FeatureFlags struct {
-	config *config.Config
+	config    *config.Config
+	mu        sync.RWMutex
+	overrides map[FeatureFlag]bool
 }
 
-func Init(config *config.Config) *FeatureFlags {
+func Init(config *config.Config, db *gorm.DB) *FeatureFlags {
 	ff := &FeatureFlags{
-		config: config,
+		config:    config,
+		overrides: make(map[FeatureFlag]bool),
+	}
+	if db != nil {
+		if err := ff.Reload(db); err != nil {
+			logging.Errorf("Failed to load feature flags: %v", err)
+		}
 	}
 	featureFlagManager = ff
 	return ff
 }
 
-func IsEnabled(flag FeatureFlag) bool {
+// GetFeatureFlags returns the manager created by Init, creating one
+// without database overrides if Init hasn't run
+func GetFeatureFlags() *FeatureFlags {
 	if featureFlagManager == nil {
-		logging.Error("FeatureFlagManager not initialized")
-		return false
+		return Init(config.GetConfig(), nil)
+	}
+	return featureFlagManager
+}
+
+// Reload refreshes the cached overrides from the database.
+// It runs periodically so toggles made on another replica are picked up.
+func (ff *FeatureFlags) Reload(db *gorm.DB) error {
+	flags, err := models.ListFeatureFlags(db)
+	if err != nil {
+		return fmt.Errorf("failed to list feature flags: %w", err)
+	}
+	overrides := make(map[FeatureFlag]bool, len(flags))
+	for _, flag := range flags {
+		overrides[FeatureFlag(flag.Name)] = flag.Enabled
 	}
-	for _, v := range featureFlagManager.config.FeatureFlags {
+	ff.mu.Lock()
+	ff.overrides = overrides
+	ff.mu.Unlock()
+	return nil
+}
+
+// Set stores an override for a known flag
+func (ff *FeatureFlags) Set(db *gorm.DB, flag FeatureFlag, enabled bool) error {
+	if _, ok := Known[flag]; !ok {
+		return ErrUnknownFlag
+	}
+	if err := models.SetFeatureFlag(db, string(flag), enabled); err != nil {
+		return fmt.Errorf("failed to save feature flag: %w", err)
+	}
+	ff.mu.Lock()
+	ff.overrides[flag] = enabled
+	ff.mu.Unlock()
+	return nil
+}
+
+// Reset removes the override for a flag so FEATURE_FLAGS decides its state again
+func (ff *FeatureFlags) Reset(db *gorm.DB, flag FeatureFlag) error {
+	if _, ok := Known[flag]; !ok {
+		return ErrUnknownFlag
+	}
+	if err := models.DeleteFeatureFlag(db, string(flag)); err != nil {
+		return fmt.Errorf("failed to delete feature flag: %w", err)
+	}
+	ff.mu.Lock()
+	delete(ff.overrides, flag)
+	ff.mu.Unlock()
+	return nil
+}
+
+func (ff *FeatureFlags) IsEnabled(flag FeatureFlag) bool {
+	ff.mu.RLock()
+	enabled, ok := ff.overrides[flag]
+	ff.mu.RUnlock()
+	if ok {
+		return enabled
+	}
+	for _, v := range ff.config.FeatureFlags {
 		if v == string(flag) {
 			return true
 		}
 	}
 	return false
 }
+
+// Enabled returns the names of all enabled flags, including ones only set in FEATURE_FLAGS
+func (ff *FeatureFlags) Enabled() []string {
+	names := make(map[FeatureFlag]bool)
+	for _, v := range ff.config.FeatureFlags {
+		names[FeatureFlag(v)] = true
+	}
+	ff.mu.RLock()
+	for flag := range ff.overrides {
+		names[flag] = true
+	}
+	ff.mu.RUnlock()
+
+	enabled := []string{}
+	for flag := range names {
+		if ff.IsEnabled(flag) {
+			enabled = append(enabled, string(flag))
+		}
+	}
+	sort.Strings(enabled)
+	return enabled
+}
+
+// List returns the status of every known flag
+func (ff *FeatureFlags) List() []Status {
+	statuses := make([]Status, 0, len(Known))
+	for flag, description := range Known {
+		ff.mu.RLock()
+		_, overridden := ff.overrides[flag]
+		ff.mu.RUnlock()
+		statuses = append(statuses, Status{
+			Name:        flag,
+			Description: description,
+			Enabled:     ff.IsEnabled(flag),
+			Overridden:  overridden,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+func IsEnabled(flag FeatureFlag) bool {
+	if featureFlagManager == nil {
+		logging.Error("FeatureFlagManager not initialized")
+		return false
+	}
+	return featureFlagManager.IsEnabled(flag)
+}
@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package featureflags_test
+
+import (
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/featureflags"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func makeTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.FeatureFlag{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	return db
+}
+
+func TestOverridesFallBackToConfig(t *testing.T) {
+	db := makeTestDB(t)
+	ff := featureflags.Init(&config.Config{FeatureFlags: []string{"openbridge", "legacy"}}, db)
+
+	if !ff.IsEnabled(featureflags.FeatureFlagOpenBridge) {
+		t.Error("Expected FEATURE_FLAGS to enable openbridge")
+	}
+	if err := ff.Set(db, featureflags.FeatureFlagOpenBridge, false); err != nil {
+		t.Fatalf("Failed to set flag: %v", err)
+	}
+	if ff.IsEnabled(featureflags.FeatureFlagOpenBridge) {
+		t.Error("Expected the database override to disable openbridge")
+	}
+	if enabled := ff.Enabled(); len(enabled) != 1 || enabled[0] != "legacy" {
+		t.Errorf("Expected only legacy enabled, got %v", enabled)
+	}
+
+	// A fresh manager loads the override from the database
+	other := featureflags.Init(&config.Config{FeatureFlags: []string{"openbridge"}}, db)
+	if other.IsEnabled(featureflags.FeatureFlagOpenBridge) {
+		t.Error("Expected the override to be loaded from the database")
+	}
+	statuses := other.List()
+	if len(statuses) != len(featureflags.Known) || !statuses[0].Overridden {
+		t.Errorf("Unexpected statuses: %+v", statuses)
+	}
+
+	if err := ff.Reset(db, featureflags.FeatureFlagOpenBridge); err != nil {
+		t.Fatalf("Failed to reset flag: %v", err)
+	}
+	if !ff.IsEnabled(featureflags.FeatureFlagOpenBridge) {
+		t.Error("Expected reset to fall back to FEATURE_FLAGS")
+	}
+}
+
+func TestUnknownFlag(t *testing.T) {
+	db := makeTestDB(t)
+	ff := featureflags.Init(&config.Config{}, db)
+	if err := ff.Set(db, "nope", true); err == nil {
+		t.Error("Expected an error setting an unknown flag")
+	}
+}
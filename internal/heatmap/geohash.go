@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package heatmap
+
+import "strings"
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Encode returns the geohash of a position with precision characters.
+// Bits alternate between longitude and latitude, starting with longitude.
+func Encode(lat, lng float64, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lngRange := [2]float64{-180, 180}
+	var hash strings.Builder
+	even := true
+	bit, ch := 0, 0
+	for hash.Len() < precision {
+		rng, value := &latRange, lat
+		if even {
+			rng, value = &lngRange, lng
+		}
+		mid := (rng[0] + rng[1]) / 2 //nolint:golint,gomnd
+		ch <<= 1
+		if value >= mid {
+			ch |= 1
+			rng[0] = mid
+		} else {
+			rng[1] = mid
+		}
+		even = !even
+		bit++
+		if bit == 5 { //nolint:golint,gomnd // each character holds 5 bits
+			hash.WriteByte(geohashAlphabet[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return hash.String()
+}
+
+// Decode returns the center of a geohash cell. Invalid characters are skipped.
+func Decode(hash string) (float64, float64) {
+	latRange := [2]float64{-90, 90}
+	lngRange := [2]float64{-180, 180}
+	even := true
+	for _, r := range hash {
+		ch := strings.IndexRune(geohashAlphabet, r)
+		if ch < 0 {
+			continue
+		}
+		for mask := 16; mask > 0; mask >>= 1 {
+			rng := &latRange
+			if even {
+				rng = &lngRange
+			}
+			mid := (rng[0] + rng[1]) / 2 //nolint:golint,gomnd
+			if ch&mask != 0 {
+				rng[0] = mid
+			} else {
+				rng[1] = mid
+			}
+			even = !even
+		}
+	}
+	return (latRange[0] + latRange[1]) / 2, (lngRange[0] + lngRange[1]) / 2 //nolint:golint,gomnd
+}
@@ -0,0 +1,221 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package heatmap aggregates call activity into geohash cells by the position
+// of the repeater each call came through. Counts are computed in the background
+// at the finest precision and coarsened per request by truncating geohashes.
+package heatmap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxPrecision cells are roughly 1.2km by 0.6km, finer than repeater coverage
+	MaxPrecision = 6
+	// DefaultPrecision cells are roughly 39km by 20km
+	DefaultPrecision = 4
+	DefaultWindow    = "24h"
+
+	// ProtocolHBRP is the only protocol calls are tracked for. OpenBridge traffic
+	// isn't tracked and has no position.
+	ProtocolHBRP = "hbrp"
+
+	// Long enough to ride out a few missed refreshes, short enough that a stopped hub's map goes stale
+	cacheTTL = 10 * time.Minute
+)
+
+// Windows are the time ranges heatmaps are computed for
+//
+//nolint:golint,gochecknoglobals
+var Windows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+var ErrUnknownWindow = errors.New("unknown heatmap window")
+
+// Count is the number of calls in a cell at MaxPrecision to one talkgroup
+type Count struct {
+	Cell        string `json:"cell"`
+	TalkgroupID uint   `json:"talkgroup_id,omitempty"`
+	Protocol    string `json:"protocol"`
+	Calls       int64  `json:"calls"`
+}
+
+// Snapshot is a computed heatmap for one window
+type Snapshot struct {
+	Window     string    `json:"window"`
+	ComputedAt time.Time `json:"computed_at"`
+	Counts     []Count   `json:"counts"`
+}
+
+// Cell is the call count for one geohash cell, positioned at its center
+type Cell struct {
+	Geohash   string  `json:"geohash"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Calls     int64   `json:"calls"`
+}
+
+func key(window string) string {
+	return "heatmap:" + window
+}
+
+// Compute counts the calls in a window by cell and talkgroup
+func Compute(db *gorm.DB, window string, now time.Time) (Snapshot, error) {
+	duration, ok := Windows[window]
+	if !ok {
+		return Snapshot{}, ErrUnknownWindow
+	}
+	rows, err := models.CountCallsByRepeaterPosition(db, now.Add(-duration))
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to count calls: %w", err)
+	}
+
+	type countKey struct {
+		cell        string
+		talkgroupID uint
+	}
+	merged := make(map[countKey]int64)
+	for _, row := range rows {
+		k := countKey{cell: Encode(row.Latitude, row.Longitude, MaxPrecision)}
+		if row.TalkgroupID != nil {
+			k.talkgroupID = *row.TalkgroupID
+		}
+		merged[k] += row.Calls
+	}
+
+	snapshot := Snapshot{Window: window, ComputedAt: now, Counts: make([]Count, 0, len(merged))}
+	for k, calls := range merged {
+		snapshot.Counts = append(snapshot.Counts, Count{Cell: k.cell, TalkgroupID: k.talkgroupID, Protocol: ProtocolHBRP, Calls: calls})
+	}
+	sort.Slice(snapshot.Counts, func(i, j int) bool {
+		if snapshot.Counts[i].Cell != snapshot.Counts[j].Cell {
+			return snapshot.Counts[i].Cell < snapshot.Counts[j].Cell
+		}
+		return snapshot.Counts[i].TalkgroupID < snapshot.Counts[j].TalkgroupID
+	})
+	return snapshot, nil
+}
+
+func store(ctx context.Context, redis *redis.Client, snapshot Snapshot) error {
+	snapshotJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal heatmap: %w", err)
+	}
+	err = redis.Set(ctx, key(snapshot.Window), snapshotJSON, cacheTTL).Err()
+	if err != nil {
+		return fmt.Errorf("failed to cache heatmap: %w", err)
+	}
+	return nil
+}
+
+// Refresh recomputes and caches every window. It is meant to be run every minute.
+func Refresh(ctx context.Context, db *gorm.DB, redis *redis.Client, now time.Time) error {
+	var errs []error
+	for window := range Windows {
+		snapshot, err := Compute(db, window, now)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		errs = append(errs, store(ctx, redis, snapshot))
+	}
+	return errors.Join(errs...)
+}
+
+// Load returns the cached heatmap for a window, computing it if the cache is empty
+func Load(ctx context.Context, db *gorm.DB, redis *redis.Client, window string, now time.Time) (Snapshot, error) {
+	if _, ok := Windows[window]; !ok {
+		return Snapshot{}, ErrUnknownWindow
+	}
+	cached, err := redis.Get(ctx, key(window)).Bytes()
+	if err == nil {
+		var snapshot Snapshot
+		if err := json.Unmarshal(cached, &snapshot); err == nil {
+			return snapshot, nil
+		}
+	}
+
+	snapshot, err := Compute(db, window, now)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	// The refresh job will fill the cache soon enough if this fails
+	_ = store(ctx, redis, snapshot)
+	return snapshot, nil
+}
+
+// Without drops the counts for talkgroups, so private talkgroups can be left
+// off the map for users who can't see them
+func (s Snapshot) Without(talkgroupIDs []uint) Snapshot {
+	if len(talkgroupIDs) == 0 {
+		return s
+	}
+	counts := make([]Count, 0, len(s.Counts))
+	for _, count := range s.Counts {
+		if !slices.Contains(talkgroupIDs, count.TalkgroupID) {
+			counts = append(counts, count)
+		}
+	}
+	s.Counts = counts
+	return s
+}
+
+// Cells sums the snapshot into cells of the given precision. A zero talkgroupID
+// counts every call, including private calls, and an empty protocol matches all.
+func (s Snapshot) Cells(precision int, talkgroupID uint, protocol string) []Cell {
+	precision = max(1, min(precision, MaxPrecision))
+	sums := make(map[string]int64)
+	for _, count := range s.Counts {
+		if talkgroupID != 0 && count.TalkgroupID != talkgroupID {
+			continue
+		}
+		if protocol != "" && count.Protocol != protocol {
+			continue
+		}
+		sums[count.Cell[:precision]] += count.Calls
+	}
+
+	cells := make([]Cell, 0, len(sums))
+	for hash, calls := range sums {
+		lat, lng := Decode(hash)
+		cells = append(cells, Cell{Geohash: hash, Latitude: lat, Longitude: lng, Calls: calls})
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		if cells[i].Calls != cells[j].Calls {
+			return cells[i].Calls > cells[j].Calls
+		}
+		return cells[i].Geohash < cells[j].Geohash
+	})
+	return cells
+}
@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package heatmap_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/heatmap"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+	// The example from the original geohash.org announcement
+	if got := heatmap.Encode(57.64911, 10.40744, 11); got != "u4pruydqqvj" {
+		t.Errorf("Expected u4pruydqqvj, got %s", got)
+	}
+	if got := heatmap.Encode(-33.8688, 151.2093, 5); got != "r3gx2" {
+		t.Errorf("Expected r3gx2 for Sydney, got %s", got)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	t.Parallel()
+	lat, lng := heatmap.Decode("u4pruydqqvj")
+	if math.Abs(lat-57.64911) > 0.0001 || math.Abs(lng-10.40744) > 0.0001 {
+		t.Errorf("Expected the cell center to be close to the encoded position, got %f, %f", lat, lng)
+	}
+}
+
+func TestComputeAndCells(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.AutoMigrate(&models.User{}, &models.Talkgroup{}, &models.Repeater{}, &models.Call{})
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	now := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	// Two repeaters in the same 4 character cell around Atlanta, one far away, one without a position
+	repeaters := []models.Repeater{
+		{RepeaterConfiguration: models.RepeaterConfiguration{ID: 311001, Latitude: 33.7000, Longitude: -84.3880}},
+		{RepeaterConfiguration: models.RepeaterConfiguration{ID: 311002, Latitude: 33.7200, Longitude: -84.3900}},
+		{RepeaterConfiguration: models.RepeaterConfiguration{ID: 311003, Latitude: 47.6062, Longitude: -122.3321}},
+		{RepeaterConfiguration: models.RepeaterConfiguration{ID: 311004}},
+	}
+	if err := db.Create(&repeaters).Error; err != nil {
+		t.Fatalf("Failed to create repeaters: %v", err)
+	}
+	tg := uint(3100)
+	other := uint(91)
+	calls := []models.Call{
+		{RepeaterID: 311001, IsToTalkgroup: true, ToTalkgroupID: &tg, StartTime: now.Add(-time.Minute)},
+		{RepeaterID: 311002, IsToTalkgroup: true, ToTalkgroupID: &tg, StartTime: now.Add(-time.Minute)},
+		{RepeaterID: 311002, IsToTalkgroup: true, ToTalkgroupID: &other, StartTime: now.Add(-time.Minute)},
+		{RepeaterID: 311003, IsToUser: true, StartTime: now.Add(-time.Minute)},
+		{RepeaterID: 311004, IsToTalkgroup: true, ToTalkgroupID: &tg, StartTime: now.Add(-time.Minute)},
+		// Outside the 1h window
+		{RepeaterID: 311001, IsToTalkgroup: true, ToTalkgroupID: &tg, StartTime: now.Add(-2 * time.Hour)},
+	}
+	if err := db.Create(&calls).Error; err != nil {
+		t.Fatalf("Failed to create calls: %v", err)
+	}
+
+	snapshot, err := heatmap.Compute(db, "1h", now)
+	if err != nil {
+		t.Fatalf("Failed to compute heatmap: %v", err)
+	}
+
+	cells := snapshot.Cells(4, 0, "")
+	if len(cells) != 2 {
+		t.Fatalf("Expected two cells, got %+v", cells)
+	}
+	if cells[0].Geohash != heatmap.Encode(33.7000, -84.3880, 4) || cells[0].Calls != 3 {
+		t.Errorf("Expected the busiest cell first with 3 calls, got %+v", cells[0])
+	}
+	if cells[1].Calls != 1 {
+		t.Errorf("Expected the private call to be counted, got %+v", cells[1])
+	}
+
+	cells = snapshot.Cells(4, 3100, heatmap.ProtocolHBRP)
+	if len(cells) != 1 || cells[0].Calls != 2 {
+		t.Errorf("Expected only the talkgroup's calls, got %+v", cells)
+	}
+	if cells := snapshot.Cells(heatmap.MaxPrecision, 3100, ""); len(cells) != 2 {
+		t.Errorf("Expected the repeaters to separate at full precision, got %+v", cells)
+	}
+
+	cells = snapshot.Without([]uint{3100}).Cells(4, 0, "")
+	if len(cells) != 2 || cells[0].Calls != 1 || cells[1].Calls != 1 {
+		t.Errorf("Expected the hidden talkgroup's calls to be dropped, got %+v", cells)
+	}
+
+	if _, err := heatmap.Compute(db, "forever", now); err == nil {
+		t.Error("Expected an unknown window to be rejected")
+	}
+}
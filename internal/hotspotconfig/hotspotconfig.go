@@ -0,0 +1,168 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package hotspotconfig renders the settings a hotspot needs to connect to
+// the hub in the formats Pi-Star and WPSD expect, so they can be pasted in
+// instead of typed field by field.
+package hotspotconfig
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
+
+const (
+	// FormatMMDVMHost is the [General] and [DMR Network] sections of MMDVMHost.ini
+	FormatMMDVMHost = "mmdvmhost"
+	// FormatDMRGateway is a [DMR Network] section for DMRGateway.ini
+	FormatDMRGateway = "dmrgateway"
+	// FormatDMRHosts is a line for Pi-Star's and WPSD's custom DMR_Hosts.txt
+	FormatDMRHosts = "dmr_hosts"
+
+	// Simplex hotspots only use timeslot 2
+	hotspotSlot = 2
+	// jitter is the MMDVMHost default network jitter buffer in milliseconds
+	jitter = 360
+)
+
+var ErrUnknownFormat = errors.New("unknown hotspot configuration format")
+
+// Formats lists every format Render supports
+//
+//nolint:golint,gochecknoglobals
+var Formats = []string{FormatMMDVMHost, FormatDMRGateway, FormatDMRHosts}
+
+// Talkgroup is a talkgroup recommended for a hotspot's code plug
+type Talkgroup struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+	Slot uint   `json:"slot"`
+}
+
+// Config is everything a hotspot needs to connect to the hub
+type Config struct {
+	NetworkName string      `json:"network_name"`
+	Host        string      `json:"host"`
+	Port        int         `json:"port"`
+	RadioID     uint        `json:"radio_id"`
+	Callsign    string      `json:"callsign"`
+	Password    string      `json:"password"`
+	Hotspot     bool        `json:"hotspot"`
+	Talkgroups  []Talkgroup `json:"recommended_talkgroups"`
+}
+
+// PublicAddress returns the host and port hotspots should connect to.
+// HBRP_PUBLIC_ADDRESS wins if set, otherwise the hostname of CANONICAL_HOST
+// and the DMR port are used.
+func PublicAddress(cfg *config.Config) (string, int) {
+	port := cfg.DMRPort
+	if cfg.HBRPPublicAddress != "" {
+		host, portStr, err := net.SplitHostPort(cfg.HBRPPublicAddress)
+		if err != nil {
+			return cfg.HBRPPublicAddress, port
+		}
+		if parsed, err := strconv.Atoi(portStr); err == nil {
+			port = parsed
+		}
+		return host, port
+	}
+	host := cfg.CanonicalHost
+	if parsed, err := url.Parse(host); err == nil && parsed.Hostname() != "" {
+		host = parsed.Hostname()
+	}
+	return host, port
+}
+
+// New builds the configuration for a repeater. The repeater's static talkgroups
+// are recommended, falling back to shared when it has none.
+func New(cfg *config.Config, repeater models.Repeater, shared []models.Talkgroup) Config {
+	host, port := PublicAddress(cfg)
+	talkgroups := []Talkgroup{}
+	for _, tg := range repeater.TS1StaticTalkgroups {
+		talkgroups = append(talkgroups, Talkgroup{ID: tg.ID, Name: tg.Name, Slot: 1})
+	}
+	for _, tg := range repeater.TS2StaticTalkgroups {
+		talkgroups = append(talkgroups, Talkgroup{ID: tg.ID, Name: tg.Name, Slot: 2})
+	}
+	if len(talkgroups) == 0 {
+		for _, tg := range shared {
+			talkgroups = append(talkgroups, Talkgroup{ID: tg.ID, Name: tg.Name, Slot: hotspotSlot})
+		}
+	}
+	// A hotspot that has never connected hasn't sent its callsign yet
+	callsign := repeater.Callsign
+	if callsign == "" {
+		callsign = repeater.Owner.Callsign
+	}
+	return Config{
+		NetworkName: cfg.NetworkName,
+		Host:        host,
+		Port:        port,
+		RadioID:     repeater.ID,
+		Callsign:    callsign,
+		Password:    repeater.Password,
+		Hotspot:     repeater.Hotspot,
+		Talkgroups:  talkgroups,
+	}
+}
+
+// Render returns the configuration as a snippet in the given format
+func (c Config) Render(format string) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s configuration for %d\n", c.NetworkName, c.RadioID)
+	switch format {
+	case FormatMMDVMHost:
+		fmt.Fprintf(&b, "[General]\nCallsign=%s\nId=%d\n\n", c.Callsign, c.RadioID)
+		fmt.Fprintf(&b, "[DMR Network]\nEnable=1\nType=Direct\nRemoteAddress=%s\nRemotePort=%d\nPassword=%s\nJitter=%d\nSlot1=%d\nSlot2=1\n",
+			c.Host, c.Port, c.Password, jitter, c.slot1())
+	case FormatDMRGateway:
+		fmt.Fprintf(&b, "[DMR Network 1]\nEnabled=1\nName=%s\nAddress=%s\nPort=%d\nPassword=%s\nId=%d\nLocation=0\nDebug=0\n",
+			c.hostName(), c.Host, c.Port, c.Password, c.RadioID)
+	case FormatDMRHosts:
+		fmt.Fprintf(&b, "%s\t%s\t%s\t%d\n", c.hostName(), c.Host, c.Password, c.Port)
+	default:
+		return "", ErrUnknownFormat
+	}
+	return b.String(), nil
+}
+
+// slot1 enables timeslot 1 unless this is a simplex hotspot with nothing on it
+func (c Config) slot1() int {
+	if !c.Hotspot {
+		return 1
+	}
+	for _, tg := range c.Talkgroups {
+		if tg.Slot == 1 {
+			return 1
+		}
+	}
+	return 0
+}
+
+// hostName is the network name in the whitespace-free form host lists use
+func (c Config) hostName() string {
+	return strings.Join(strings.Fields(c.NetworkName), "_")
+}
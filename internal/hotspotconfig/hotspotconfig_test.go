@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hotspotconfig_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/hotspotconfig"
+)
+
+func TestPublicAddress(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		cfg  config.Config
+		host string
+		port int
+	}{
+		{config.Config{CanonicalHost: "https://dmr.example.com", DMRPort: 62031}, "dmr.example.com", 62031},
+		{config.Config{CanonicalHost: "dmr.example.com", DMRPort: 62031}, "dmr.example.com", 62031},
+		{config.Config{CanonicalHost: "https://dmr.example.com", HBRPPublicAddress: "hbrp.example.com:62035", DMRPort: 62031}, "hbrp.example.com", 62035},
+		{config.Config{HBRPPublicAddress: "hbrp.example.com", DMRPort: 62031}, "hbrp.example.com", 62031},
+	}
+	for _, test := range tests {
+		host, port := hotspotconfig.PublicAddress(&test.cfg)
+		if host != test.host || port != test.port {
+			t.Errorf("Expected %s:%d, got %s:%d", test.host, test.port, host, port)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+	cfg := &config.Config{NetworkName: "Test Hub", CanonicalHost: "https://dmr.example.com", DMRPort: 62031}
+	repeater := models.Repeater{
+		Password: "s3cret",
+		Hotspot:  true,
+		Owner:    models.User{Callsign: "KI5VMF"},
+	}
+	repeater.ID = 319186801
+	shared := []models.Talkgroup{{ID: 3100, Name: "USA"}}
+
+	hotspot := hotspotconfig.New(cfg, repeater, shared)
+	if hotspot.Callsign != "KI5VMF" {
+		t.Errorf("Expected the owner's callsign, got %q", hotspot.Callsign)
+	}
+	if len(hotspot.Talkgroups) != 1 || hotspot.Talkgroups[0].Slot != 2 {
+		t.Errorf("Expected TG 3100 on slot 2, got %+v", hotspot.Talkgroups)
+	}
+
+	mmdvm, err := hotspot.Render(hotspotconfig.FormatMMDVMHost)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, want := range []string{"Id=319186801", "RemoteAddress=dmr.example.com", "RemotePort=62031", "Password=s3cret", "Slot1=0"} {
+		if !strings.Contains(mmdvm, want) {
+			t.Errorf("Expected %q in:\n%s", want, mmdvm)
+		}
+	}
+
+	hosts, err := hotspot.Render(hotspotconfig.FormatDMRHosts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasSuffix(hosts, "Test_Hub\tdmr.example.com\ts3cret\t62031\n") {
+		t.Errorf("Unexpected DMR_Hosts line:\n%s", hosts)
+	}
+
+	// Static talkgroups replace the shared recommendations
+	repeater.TS1StaticTalkgroups = []models.Talkgroup{{ID: 9, Name: "Local"}}
+	hotspot = hotspotconfig.New(cfg, repeater, shared)
+	if len(hotspot.Talkgroups) != 1 || hotspot.Talkgroups[0].ID != 9 {
+		t.Errorf("Expected only TG 9, got %+v", hotspot.Talkgroups)
+	}
+	gateway, _ := hotspot.Render(hotspotconfig.FormatDMRGateway)
+	if !strings.Contains(gateway, "Name=Test_Hub") {
+		t.Errorf("Expected the network name in:\n%s", gateway)
+	}
+
+	if _, err := hotspot.Render("bogus"); !errors.Is(err, hotspotconfig.ErrUnknownFormat) {
+		t.Errorf("Expected ErrUnknownFormat, got %v", err)
+	}
+}
@@ -54,4 +54,5 @@ type WSCallResponse struct {
 	Jitter        float32                 `json:"jitter"`
 	BER           float32                 `json:"ber"`
 	RSSI          float32                 `json:"rssi"`
+	Truncated     bool                    `json:"truncated"`
 }
@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package apimodels
+
+import "github.com/USA-RedDragon/DMRHub/internal/db/models"
+
+type InstanceSettingsPatch struct {
+	NetworkName  *string `json:"network_name"`
+	LogoURL      *string `json:"logo_url"`
+	ContactEmail *string `json:"contact_email"`
+	TermsOfUse   *string `json:"terms_of_use"`
+	MOTD         *string `json:"motd"`
+}
+
+type BenchmarkPost struct {
+	Packets uint `json:"packets"`
+}
+
+// InjectPost injects a packet as if it was received from a repeater or OpenBridge peer
+type InjectPost struct {
+	Protocol   string        `json:"protocol" binding:"required,oneof=hbrp openbridge"`
+	RepeaterID uint          `json:"repeater_id" binding:"required"`
+	Packet     models.Packet `json:"packet"`
+}
+
+type FeatureFlagPut struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
@@ -20,8 +20,9 @@
 package apimodels
 
 type PeerPost struct {
-	ID      uint `json:"id" binding:"required"`
-	OwnerID uint `json:"owner" binding:"required"`
-	Ingress bool `json:"ingress"`
-	Egress  bool `json:"egress"`
+	ID          uint `json:"id" binding:"required"`
+	OwnerID     uint `json:"owner" binding:"required"`
+	Ingress     bool `json:"ingress"`
+	Egress      bool `json:"egress"`
+	MaxDatagram uint `json:"max_datagram" binding:"omitempty,min=53,max=65507"`
 }
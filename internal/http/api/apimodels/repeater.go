@@ -19,10 +19,14 @@
 
 package apimodels
 
-import "github.com/USA-RedDragon/DMRHub/internal/db/models"
+import (
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
 
 type RepeaterPost struct {
-	RadioID uint `json:"id" binding:"required"`
+	RadioID uint `json:"id" binding:"required,repeaterid"`
 }
 
 type RepeaterTalkgroupsPost struct {
@@ -31,3 +35,71 @@ type RepeaterTalkgroupsPost struct {
 	TS1DynamicTalkgroup models.Talkgroup   `json:"ts1_dynamic_talkgroup"`
 	TS2DynamicTalkgroup models.Talkgroup   `json:"ts2_dynamic_talkgroup"`
 }
+
+type RepeaterPermissionPost struct {
+	UserID         uint `json:"user_id" binding:"required"`
+	EditTalkgroups bool `json:"edit_talkgroups"`
+	ViewStats      bool `json:"view_stats"`
+	RotatePassword bool `json:"rotate_password"`
+}
+
+type RepeaterTalkgroupProfilePost struct {
+	SkipTalkgroupProfile bool `json:"skip_talkgroup_profile"`
+}
+
+// RepeaterColorCodePost sets the color code a repeater is expected to report. A null color code clears it
+type RepeaterColorCodePost struct {
+	ColorCode *uint8 `json:"color_code" binding:"omitempty,colorcode"`
+}
+
+// MaxDatagramPost sets the largest datagram sent to a repeater or peer. 0 uses the hub's MAX_DATAGRAM_SIZE
+type MaxDatagramPost struct {
+	MaxDatagram uint `json:"max_datagram" binding:"omitempty,min=53,max=65507"`
+}
+
+// KeepalivePost sets how often a repeater is expected to ping, in seconds. 0 uses the hub's default timeout
+type KeepalivePost struct {
+	KeepaliveInterval uint `json:"keepalive_interval" binding:"omitempty,min=1,max=60"`
+}
+
+// NetworkPost binds a repeater or peer to one of the networks named in NETWORKS. An empty network unbinds it
+type NetworkPost struct {
+	Network string `json:"network"`
+}
+
+type RepeaterLinkPost struct {
+	LinkedRepeaterID uint `json:"linked_repeater_id" binding:"required,repeaterid"`
+	Slot             uint `json:"slot" binding:"required,slot"`
+	DurationMinutes  uint `json:"duration_minutes"`
+}
+
+// RepeaterDynamicLinkPost links a slot to a dynamic talkgroup, the same as keying it up on RF
+type RepeaterDynamicLinkPost struct {
+	Talkgroup uint `json:"talkgroup" binding:"required"`
+	Slot      uint `json:"slot" binding:"required,slot"`
+}
+
+// RepeaterDynamicUnlinkPost clears a slot's dynamic talkgroup, the same as keying up 4000 on RF
+type RepeaterDynamicUnlinkPost struct {
+	Slot uint `json:"slot" binding:"required,slot"`
+}
+
+// RepeaterMessagePost is a text status message for a hotspot that supports DMRHub protocol extensions
+type RepeaterMessagePost struct {
+	Message string `json:"message" binding:"required,max=80" sanitize:"trim"`
+}
+
+// RepeaterSessionSnapshot is the login state of every connected repeater, exported
+// from one instance and imported on a replacement so repeaters don't have to log in again
+type RepeaterSessionSnapshot struct {
+	TakenAt  time.Time               `json:"taken_at"`
+	Sessions []RepeaterSessionExport `json:"sessions" binding:"dive"`
+}
+
+// RepeaterSessionExport is one repeater's session. State is the session as stored in Redis.
+type RepeaterSessionExport struct {
+	RepeaterID            uint   `json:"repeater_id" binding:"required"`
+	State                 []byte `json:"state" binding:"required"`
+	TS1DynamicTalkgroupID *uint  `json:"ts1_dynamic_talkgroup_id"`
+	TS2DynamicTalkgroupID *uint  `json:"ts2_dynamic_talkgroup_id"`
+}
@@ -20,16 +20,74 @@
 package apimodels
 
 type TalkgroupPost struct {
-	ID          uint   `json:"id" binding:"required"`
-	Name        string `json:"name" binding:"required"`
-	Description string `json:"description" binding:"required"`
+	ID          uint   `json:"id" binding:"required,talkgroupid"`
+	Name        string `json:"name" binding:"required,max=20" sanitize:"trim"`
+	Description string `json:"description" binding:"required,max=240" sanitize:"trim"`
+	Language    string `json:"language" binding:"omitempty,language" sanitize:"trim"`
+	Region      string `json:"region" binding:"omitempty,region" sanitize:"trim,upper"`
+	BridgeHint  string `json:"bridge_hint" binding:"omitempty,bridgehint"`
+	Private     bool   `json:"private"`
+	CodecPolicy string `json:"codec_policy" binding:"omitempty,codecpolicy"`
 }
 
 type TalkgroupPatch struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	Name          string `json:"name" binding:"max=20" sanitize:"trim"`
+	Description   string `json:"description" binding:"max=240" sanitize:"trim"`
+	RetentionDays *uint  `json:"retention_days"`
+	// Language, Region and BridgeHint are cleared by sending an empty string,
+	// and an empty CodecPolicy goes back to blocking
+	Language    *string `json:"language" binding:"omitempty,language" sanitize:"trim"`
+	Region      *string `json:"region" binding:"omitempty,region" sanitize:"trim,upper"`
+	BridgeHint  *string `json:"bridge_hint" binding:"omitempty,bridgehint"`
+	Private     *bool   `json:"private"`
+	CodecPolicy *string `json:"codec_policy" binding:"omitempty,codecpolicy"`
 }
 
 type TalkgroupAdminAction struct {
 	UserIDs []uint `json:"user_ids"`
 }
+
+// TalkgroupAllowedRepeatersPost replaces the repeaters allowed on a private talkgroup
+type TalkgroupAllowedRepeatersPost struct {
+	RepeaterIDs []uint `json:"repeater_ids"`
+}
+
+type TalkgroupQuotaPost struct {
+	DailySeconds   uint `json:"daily_seconds"`
+	MonthlySeconds uint `json:"monthly_seconds"`
+	WarnPercent    uint `json:"warn_percent" binding:"max=100"`
+	Enforce        bool `json:"enforce"`
+}
+
+type TalkgroupImportPost struct {
+	URL    string `json:"url"`
+	Data   string `json:"data"`
+	Format string `json:"format" binding:"required"`
+	Apply  bool   `json:"apply"`
+}
+
+type TalkgroupArchivePost struct {
+	Enabled        bool `json:"enabled"`
+	IncludePayload bool `json:"include_payload"`
+}
+
+type TalkgroupCategoryPost struct {
+	Name        string `json:"name" binding:"required,max=20" sanitize:"trim"`
+	Description string `json:"description" binding:"max=240" sanitize:"trim"`
+}
+
+type TalkgroupCategoryPatch struct {
+	Name        string `json:"name" binding:"max=20" sanitize:"trim"`
+	Description string `json:"description" binding:"max=240" sanitize:"trim"`
+}
+
+type TalkgroupCategoriesPost struct {
+	CategoryIDs []uint `json:"category_ids"`
+}
+
+// TalkgroupListeners is who would hear a call on a talkgroup right now
+type TalkgroupListeners struct {
+	TalkgroupID  uint `json:"talkgroup_id"`
+	Repeaters    int  `json:"repeaters"`
+	WebListeners int  `json:"web_listeners"`
+}
@@ -19,33 +19,97 @@
 
 package apimodels
 
-import "regexp"
+import (
+	"regexp"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+)
 
 const minUsernameLength = 3
 const maxUsernameLength = 20
 
 type UserRegistration struct {
-	DMRId    uint   `json:"id" binding:"required"`
-	Callsign string `json:"callsign" binding:"required"`
-	Username string `json:"username" binding:"required"`
+	DMRId    uint   `json:"id" binding:"required,dmrid"`
+	Callsign string `json:"callsign" binding:"required,callsign" sanitize:"trim,upper"`
+	Username string `json:"username" binding:"required" sanitize:"trim"`
 	Password string `json:"password" binding:"required"`
+	// Only checked when a CAPTCHA provider is configured
+	CaptchaToken string `json:"captcha_token"`
 }
 
 func (r *UserRegistration) IsValidUsername() (bool, string) {
-	if len(r.Username) < minUsernameLength {
-		return false, "Username must be at least 3 characters"
+	return isValidUsername(r.Username)
+}
+
+// ListenerRegistration registers a listen-only account that has no DMR ID
+type ListenerRegistration struct {
+	Callsign string `json:"callsign" binding:"omitempty,callsign" sanitize:"trim,upper"`
+	Username string `json:"username" binding:"required" sanitize:"trim"`
+	Password string `json:"password" binding:"required"`
+	// Only checked when a CAPTCHA provider is configured
+	CaptchaToken string `json:"captcha_token"`
+}
+
+func (r *ListenerRegistration) IsValidUsername() (bool, string) {
+	return isValidUsername(r.Username)
+}
+
+// isValidUsername returns an i18n message key describing why the username is invalid
+func isValidUsername(username string) (bool, string) {
+	if len(username) < minUsernameLength {
+		return false, "username_too_short"
 	}
-	if len(r.Username) > maxUsernameLength {
-		return false, "Username must be less than 20 characters"
+	if len(username) > maxUsernameLength {
+		return false, "username_too_long"
 	}
-	if !regexp.MustCompile(`^[a-zA-Z0-9_\-\.]+$`).MatchString(r.Username) {
-		return false, "Username must be alphanumeric, _, -, or ."
+	if !regexp.MustCompile(`^[a-zA-Z0-9_\-\.]+$`).MatchString(username) {
+		return false, "username_invalid_characters"
 	}
 	return true, ""
 }
 
 type UserPatch struct {
-	Callsign string `json:"callsign"`
-	Username string `json:"username"`
+	Callsign string `json:"callsign" binding:"omitempty,callsign" sanitize:"trim,upper"`
+	Username string `json:"username" sanitize:"trim"`
 	Password string `json:"password"`
+	Locale   string `json:"locale"`
+}
+
+type UserTalkgroupProfilePost struct {
+	TS1StaticTalkgroups []models.Talkgroup `json:"ts1_static_talkgroups"`
+	TS2StaticTalkgroups []models.Talkgroup `json:"ts2_static_talkgroups"`
+}
+
+// UserDigestPut opts the user into the activity digest email
+type UserDigestPut struct {
+	Email     string `json:"email" binding:"required,email"`
+	Frequency string `json:"frequency" binding:"required,oneof=daily weekly"`
+}
+
+// UserPreferencesPut sets which channels a user is notified on for each event
+type UserPreferencesPut struct {
+	Email           string                      `json:"email" binding:"omitempty,email"`
+	WebhookURL      string                      `json:"webhook_url"`
+	MissedCall      models.NotificationChannels `json:"missed_call"`
+	RepeaterOffline models.NotificationChannels `json:"repeater_offline"`
+	Quota           models.NotificationChannels `json:"quota"`
+}
+
+// UserBulkApprovePost approves every pending user matching a filter
+type UserBulkApprovePost struct {
+	Filter models.UserFilter `json:"filter"`
+	DryRun bool              `json:"dry_run"`
+}
+
+// UserBulkSuspendPost suspends a list of users
+type UserBulkSuspendPost struct {
+	IDs    []uint `json:"ids" binding:"required,min=1,max=5000"`
+	DryRun bool   `json:"dry_run"`
+}
+
+// UserBulkRolePost promotes or demotes a list of users
+type UserBulkRolePost struct {
+	IDs    []uint `json:"ids" binding:"required,min=1,max=5000"`
+	Admin  *bool  `json:"admin" binding:"required"`
+	DryRun bool   `json:"dry_run"`
 }
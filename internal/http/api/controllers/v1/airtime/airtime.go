@@ -0,0 +1,224 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package airtime
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultWindow           = 30 * 24 * time.Hour
+	defaultLeaderboardLimit = 10
+	maxLeaderboardLimit     = 100
+)
+
+// Total is an airtime total with the callsign or name of what it belongs to
+type Total struct {
+	models.AirtimeTotal
+	Name    string `json:"name"`
+	Seconds int64  `json:"seconds"`
+}
+
+// GETAirtime reports transmit time per user, talkgroup, or repeater for cost allocation.
+// Pass ?format=csv to download the report as a spreadsheet.
+func GETAirtime(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	group, from, to, ok := parseReport(c)
+	if !ok {
+		return
+	}
+	report, ok := listTotals(c, db, db, group, from, to, 0)
+	if !ok {
+		return
+	}
+
+	if c.Query("format") != "csv" {
+		c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "by": group, "totals": report, "total": len(report)})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=airtime-%s-%s-%s.csv", group, from.Format(time.DateOnly), to.Format(time.DateOnly)))
+	c.Header("Content-Type", "text/csv")
+	c.Status(http.StatusOK)
+	writer := csv.NewWriter(c.Writer)
+	rows := [][]string{{string(group) + "_id", "name", "from", "to", "calls", "seconds"}}
+	for _, total := range report {
+		rows = append(rows, []string{
+			strconv.FormatUint(uint64(total.ID), 10),
+			total.Name,
+			from.Format(time.RFC3339),
+			to.Format(time.RFC3339),
+			strconv.FormatUint(uint64(total.Calls), 10),
+			strconv.FormatInt(total.Seconds, 10),
+		})
+	}
+	err := writer.WriteAll(rows)
+	if err != nil {
+		logging.Errorf("Error writing airtime report: %v", err)
+	}
+}
+
+// GETAirtimeLeaderboard lists the users, talkgroups, or repeaters with the most talk time.
+// Private talkgroups the user can't see are left off the talkgroup leaderboard.
+func GETAirtimeLeaderboard(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	group, from, to, ok := parseReport(c)
+	if !ok {
+		return
+	}
+	limit := defaultLeaderboardLimit
+	if limitQuery := c.Query("limit"); limitQuery != "" {
+		var err error
+		limit, err = strconv.Atoi(limitQuery)
+		if err != nil || limit < 1 || limit > maxLeaderboardLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid limit, expected 1 to %d", maxLeaderboardLimit)})
+			return
+		}
+	}
+	rollups := db
+	if group == models.AirtimeByTalkgroup {
+		uid, ok := sessions.Default(c).Get("user_id").(uint)
+		if !ok {
+			logging.Error("userID cast failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+			return
+		}
+		user, err := models.FindUserByID(db, uid)
+		if err != nil {
+			logging.Errorf("Error finding user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+			return
+		}
+		rollups = models.VisibleAirtime(db, user)
+	}
+	leaders, ok := listTotals(c, db, rollups, group, from, to, limit)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "by": group, "leaders": leaders})
+}
+
+// listTotals totals the rollups in the rollups query, which may be scoped to what the user can see
+func listTotals(c *gin.Context, db *gorm.DB, rollups *gorm.DB, group models.AirtimeGroup, from, to time.Time, limit int) ([]Total, bool) {
+	totals, err := models.ListAirtimeTotals(rollups, group, from, to, limit)
+	if err != nil {
+		logging.Errorf("Error listing airtime totals: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing airtime totals"})
+		return nil, false
+	}
+	report := make([]Total, 0, len(totals))
+	for _, total := range totals {
+		report = append(report, Total{AirtimeTotal: total, Name: totalName(db, group, total.ID), Seconds: total.Seconds()})
+	}
+	return report, true
+}
+
+// totalName looks up a display name for a total, which may be missing if the
+// user, talkgroup, or repeater has since been deleted
+func totalName(db *gorm.DB, group models.AirtimeGroup, id uint) string {
+	var name string
+	var err error
+	switch group {
+	case models.AirtimeByUser:
+		var users []models.User
+		err = db.Select("callsign").Where("id = ?", id).Limit(1).Find(&users).Error
+		if len(users) > 0 {
+			name = users[0].Callsign
+		}
+	case models.AirtimeByTalkgroup:
+		var talkgroups []models.Talkgroup
+		err = db.Select("name").Where("id = ?", id).Limit(1).Find(&talkgroups).Error
+		if len(talkgroups) > 0 {
+			name = talkgroups[0].Name
+		}
+	case models.AirtimeByRepeater:
+		var repeaters []models.Repeater
+		err = db.Select("callsign").Where("id = ?", id).Limit(1).Find(&repeaters).Error
+		if len(repeaters) > 0 {
+			name = repeaters[0].Callsign
+		}
+	}
+	if err != nil {
+		logging.Errorf("Error finding name for airtime total %d: %v", id, err)
+	}
+	return name
+}
+
+func parseReport(c *gin.Context) (models.AirtimeGroup, time.Time, time.Time, bool) {
+	group := models.AirtimeGroup(c.DefaultQuery("by", string(models.AirtimeByUser)))
+	switch group {
+	case models.AirtimeByUser, models.AirtimeByTalkgroup, models.AirtimeByRepeater:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid grouping, expected user, talkgroup, or repeater"})
+		return "", time.Time{}, time.Time{}, false
+	}
+
+	to := time.Now()
+	from := to.Add(-defaultWindow)
+	if month := c.Query("month"); month != "" {
+		start, err := time.Parse("2006-01", month)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid month, expected YYYY-MM"})
+			return "", time.Time{}, time.Time{}, false
+		}
+		return group, start, start.AddDate(0, 1, 0), true
+	}
+
+	var err error
+	if fromQuery := c.Query("from"); fromQuery != "" {
+		from, err = time.Parse(time.DateOnly, fromQuery)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, expected YYYY-MM-DD"})
+			return "", time.Time{}, time.Time{}, false
+		}
+	}
+	if toQuery := c.Query("to"); toQuery != "" {
+		to, err = time.Parse(time.DateOnly, toQuery)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, expected YYYY-MM-DD"})
+			return "", time.Time{}, time.Time{}, false
+		}
+	}
+	if !to.After(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The end of the window must be after the start"})
+		return "", time.Time{}, time.Time{}, false
+	}
+	return group, from, to, true
+}
@@ -26,9 +26,13 @@ import (
 	"github.com/USA-RedDragon/DMRHub/internal/db/models"
 	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
 	"github.com/USA-RedDragon/DMRHub/internal/http/api/utils"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	redisSessions "github.com/USA-RedDragon/DMRHub/internal/http/sessions"
+	"github.com/USA-RedDragon/DMRHub/internal/i18n"
 	"github.com/USA-RedDragon/DMRHub/internal/logging"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
 
@@ -40,12 +44,18 @@ func POSTLogin(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
 		return
 	}
+	redis, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Errorf("POSTLogin: Unable to get Redis from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
 
 	var json apimodels.AuthLogin
-	err := c.ShouldBindJSON(&json)
+	err := validation.BindJSON(c, &json)
 	if err != nil {
 		logging.Errorf("POSTLogin: JSON data is invalid: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		validation.Respond(c, err)
 	} else {
 		// Check that one of username or callsign is not blank
 		if json.Username == "" && json.Callsign == "" {
@@ -72,7 +82,15 @@ func POSTLogin(c *gin.Context) {
 				return
 			}
 			if user.Approved {
+				sessionID, err := redisSessions.RegisterUserSession(c, redis, user.ID, c.ClientIP(), c.Request.UserAgent())
+				if err != nil {
+					logging.Errorf("POSTLogin: %v", err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving session"})
+					return
+				}
 				session.Set("user_id", user.ID)
+				session.Set(redisSessions.UserSessionKey, sessionID)
+				session.Set(i18n.SessionKey, user.Locale)
 				err = session.Save()
 				if err != nil {
 					logging.Errorf("POSTLogin: %v", err)
@@ -93,6 +111,16 @@ func POSTLogin(c *gin.Context) {
 
 func GETLogout(c *gin.Context) {
 	session := sessions.Default(c)
+	if uid, ok := session.Get("user_id").(uint); ok {
+		if id, ok := session.Get(redisSessions.UserSessionKey).(string); ok {
+			if redis, ok := c.MustGet("Redis").(*redis.Client); ok {
+				_, err := redisSessions.RevokeUserSession(c, redis, uid, id)
+				if err != nil {
+					logging.Errorf("GETLogout: %v", err)
+				}
+			}
+		}
+	}
 	session.Clear()
 	err := session.Save()
 	if err != nil {
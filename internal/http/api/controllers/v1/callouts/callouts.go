@@ -0,0 +1,252 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package callouts
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func GETCalloutGroups(c *gin.Context) {
+	db, ok := c.MustGet("PaginatedDB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	cDb, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	groups, err := models.ListCalloutGroups(db)
+	if err != nil {
+		logging.Errorf("Error listing callout groups: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing callout groups"})
+		return
+	}
+
+	total, err := models.CountCalloutGroups(cDb)
+	if err != nil {
+		logging.Errorf("Error counting callout groups: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting callout groups"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"total": total, "groups": groups})
+}
+
+func GETCalloutGroup(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	group, ok := findGroup(c, db)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, group)
+}
+
+func POSTCalloutGroup(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	var json apimodels.CalloutGroupPost
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTCalloutGroup: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+
+	// Private calls to the group's ID must not be claimed by anything else on the network
+	for _, check := range []struct {
+		exists func(*gorm.DB, uint) (bool, error)
+		name   string
+	}{
+		{models.CalloutGroupIDExists, "callout group"},
+		{models.UserIDExists, "user"},
+		{models.RepeaterIDExists, "repeater"},
+		{models.TalkgroupIDExists, "talkgroup"},
+	} {
+		exists, err := check.exists(db, json.ID)
+		if err != nil {
+			logging.Errorf("Error checking if %s exists: %s", check.name, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking if " + check.name + " exists"})
+			return
+		}
+		if exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ID is already in use by a " + check.name})
+			return
+		}
+	}
+
+	group := models.CalloutGroup{
+		ID:          json.ID,
+		Name:        json.Name,
+		Description: json.Description,
+	}
+	err = db.Create(&group).Error
+	if err != nil {
+		logging.Errorf("Error creating callout group: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating callout group"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Callout group created", "id": group.ID})
+}
+
+func PATCHCalloutGroup(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	var json apimodels.CalloutGroupPatch
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("PATCHCalloutGroup: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	group, ok := findGroup(c, db)
+	if !ok {
+		return
+	}
+
+	if json.Name != "" {
+		group.Name = json.Name
+	}
+	if json.Description != "" {
+		group.Description = json.Description
+	}
+
+	err = db.Omit("Members").Save(&group).Error
+	if err != nil {
+		logging.Errorf("Error saving callout group: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving callout group"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Callout group updated"})
+}
+
+func DELETECalloutGroup(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid callout group ID"})
+		return
+	}
+	err = models.DeleteCalloutGroup(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error deleting callout group: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting callout group"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Callout group deleted"})
+}
+
+// POSTCalloutGroupMembers replaces the membership of a callout group
+func POSTCalloutGroupMembers(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	var json apimodels.CalloutGroupMembersPost
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTCalloutGroupMembers: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	group, ok := findGroup(c, db)
+	if !ok {
+		return
+	}
+
+	members := make([]models.User, 0, len(json.UserIDs))
+	for _, userID := range json.UserIDs {
+		exists, err := models.UserIDExists(db, userID)
+		if err != nil {
+			logging.Errorf("Error checking if user exists: %s", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking if user exists"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "User " + strconv.FormatUint(uint64(userID), 10) + " does not exist"})
+			return
+		}
+		members = append(members, models.User{ID: userID})
+	}
+
+	err = db.Model(&group).Association("Members").Replace(members)
+	if err != nil {
+		logging.Errorf("Error updating callout group membership: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating callout group membership"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Callout group membership updated"})
+}
+
+func findGroup(c *gin.Context, db *gorm.DB) (models.CalloutGroup, bool) {
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid callout group ID"})
+		return models.CalloutGroup{}, false
+	}
+	exists, err := models.CalloutGroupIDExists(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error checking if callout group exists: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking if callout group exists"})
+		return models.CalloutGroup{}, false
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Callout group does not exist"})
+		return models.CalloutGroup{}, false
+	}
+	group, err := models.FindCalloutGroupByID(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error finding callout group: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding callout group"})
+		return models.CalloutGroup{}, false
+	}
+	return group, true
+}
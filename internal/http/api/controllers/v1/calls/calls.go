@@ -0,0 +1,163 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package calls
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/calltracker"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/routing"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// GETCallRouting explains where a call was delivered and why it skipped other destinations
+func GETCallRouting(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Errorf("Unable to get DB from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	redis, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	callID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid call ID"})
+		return
+	}
+
+	var calls []models.Call
+	err = db.Where("id = ?", callID).Limit(1).Find(&calls).Error
+	if err != nil {
+		logging.Errorf("Error finding call: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding call"})
+		return
+	}
+	if len(calls) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Call does not exist"})
+		return
+	}
+	call := calls[0]
+
+	decisions, err := routing.Load(c, redis, call.StreamID)
+	if err != nil {
+		logging.Errorf("Error loading routing decisions for call %d: %v", call.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading routing decisions"})
+		return
+	}
+	delivered := []routing.Decision{}
+	skipped := []routing.Decision{}
+	for _, decision := range decisions {
+		if decision.Delivered {
+			delivered = append(delivered, decision)
+		} else {
+			skipped = append(skipped, decision)
+		}
+	}
+
+	// Decisions expire after a day and not every stream is sampled, so say whether any were found
+	c.JSON(http.StatusOK, gin.H{
+		"call_id":        call.ID,
+		"destination_id": call.DestinationID,
+		"group_call":     call.GroupCall,
+		"sampled":        routing.Sampled(call.StreamID),
+		"recorded":       len(decisions) > 0,
+		"delivered":      delivered,
+		"skipped":        skipped,
+	})
+}
+
+// GETCallTelemetry returns the BER/RSSI samples taken during a call, ordered by offset
+func GETCallTelemetry(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Errorf("Unable to get DB from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	callID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid call ID"})
+		return
+	}
+	uid, ok := sessions.Default(c).Get("user_id").(uint)
+	if !ok {
+		logging.Error("userID cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	user, err := models.FindUserByID(db, uid)
+	if err != nil {
+		logging.Errorf("Error finding user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	var calls []models.Call
+	err = models.VisibleCalls(db, user).Where("calls.id = ?", callID).Limit(1).Find(&calls).Error
+	if err != nil {
+		logging.Errorf("Error finding call: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding call"})
+		return
+	}
+	// Calls the user can't see look the same as missing ones
+	if len(calls) == 0 || !privateCallVisible(calls[0], user) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Call does not exist"})
+		return
+	}
+	call := calls[0]
+
+	points, err := models.FindCallTelemetry(db, call.ID)
+	if err != nil {
+		logging.Errorf("Error finding telemetry for call %d: %v", call.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding telemetry"})
+		return
+	}
+
+	// Samples are written when the call ends, so an active call has none yet
+	c.JSON(http.StatusOK, gin.H{
+		"call_id":     call.ID,
+		"active":      call.Active,
+		"duration":    call.Duration,
+		"interval_ms": calltracker.TelemetryInterval.Milliseconds(),
+		"ber":         call.BER,
+		"rssi":        call.RSSI,
+		"points":      points,
+	})
+}
+
+// privateCallVisible reports whether a user may see a call, which for a private call
+// means being on one end of it
+func privateCallVisible(call models.Call, user models.User) bool {
+	if call.GroupCall || user.Admin || call.UserID == user.ID {
+		return true
+	}
+	return call.ToUserID != nil && *call.ToUserID == user.ID
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package calls_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/routing"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/calls"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestCallRouting(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Call{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	_, redis := fakeredis.New(t)
+	router := testutils.ControllerRouter(db, redis, 1)
+	router.GET("/calls/:id/routing", calls.GETCallRouting)
+
+	// At the default rate, only streams ending in 00 are sampled
+	sampledCall := models.Call{StreamID: 8800, DestinationID: 91, GroupCall: true}
+	unsampledCall := models.Call{StreamID: 8801, DestinationID: 91, GroupCall: true}
+	db.Create(&sampledCall)
+	db.Create(&unsampledCall)
+	routing.Record(context.Background(), redis, sampledCall.StreamID,
+		routing.Decision{Target: routing.TargetRepeater, TargetID: 311001, Delivered: true, Reason: routing.ReasonStatic},
+		routing.Decision{Target: routing.TargetRepeater, TargetID: 311002, Reason: routing.ReasonOffline},
+	)
+
+	type explanation struct {
+		Sampled   bool               `json:"sampled"`
+		Recorded  bool               `json:"recorded"`
+		Delivered []routing.Decision `json:"delivered"`
+		Skipped   []routing.Decision `json:"skipped"`
+	}
+	w := testutils.Do(t, router, http.MethodGet, "/calls/1/routing", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	got := testutils.Decode[explanation](t, w)
+	if !got.Sampled || !got.Recorded || len(got.Delivered) != 1 || len(got.Skipped) != 1 {
+		t.Fatalf("Unexpected explanation %+v", got)
+	}
+	if got.Delivered[0].TargetID != 311001 || got.Skipped[0].Reason != routing.ReasonOffline {
+		t.Errorf("Expected decisions split by delivery, got %+v", got)
+	}
+
+	got = testutils.Decode[explanation](t, testutils.Do(t, router, http.MethodGet, "/calls/2/routing", nil))
+	if got.Sampled || got.Recorded || len(got.Delivered) != 0 || len(got.Skipped) != 0 {
+		t.Errorf("Expected an unsampled call to say so, got %+v", got)
+	}
+
+	if w := testutils.Do(t, router, http.MethodGet, "/calls/3/routing", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing call, got %d", w.Code)
+	}
+	if w := testutils.Do(t, router, http.MethodGet, "/calls/x/routing", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid call ID, got %d", w.Code)
+	}
+}
+
+func TestCallTelemetryVisibility(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Talkgroup{}, &models.TalkgroupAllowedRepeater{}, &models.Repeater{}, &models.Call{}, &models.CallTelemetry{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	db.Create(&models.User{ID: 1, Callsign: "N0ADM", Username: "n0adm", Approved: true, Admin: true})
+	db.Create(&models.User{ID: 2, Callsign: "N0SRC", Username: "n0src", Approved: true})
+	db.Create(&models.User{ID: 3, Callsign: "N0DST", Username: "n0dst", Approved: true})
+	db.Create(&models.User{ID: 4, Callsign: "N0STR", Username: "n0str", Approved: true})
+	db.Create(&models.Talkgroup{ID: 3100, Name: "Public"})
+	db.Create(&models.Talkgroup{ID: 3101, Name: "Private", Private: true})
+	repeater := models.Repeater{OwnerID: 2}
+	repeater.ID = 311002
+	db.Create(&repeater)
+	db.Create(&models.TalkgroupAllowedRepeater{TalkgroupID: 3101, RepeaterID: repeater.ID})
+
+	public, private := uint(3100), uint(3101)
+	dst := uint(3)
+	db.Create(&models.Call{ID: 1, UserID: 2, RepeaterID: repeater.ID, GroupCall: true, IsToTalkgroup: true, ToTalkgroupID: &public, DestinationID: public})
+	db.Create(&models.Call{ID: 2, UserID: 2, RepeaterID: repeater.ID, GroupCall: true, IsToTalkgroup: true, ToTalkgroupID: &private, DestinationID: private})
+	db.Create(&models.Call{ID: 3, UserID: 2, RepeaterID: repeater.ID, IsToUser: true, ToUserID: &dst, DestinationID: dst})
+
+	cases := []struct {
+		name   string
+		userID uint
+		callID string
+		want   int
+	}{
+		{"public talkgroup", 4, "1", http.StatusOK},
+		{"private talkgroup non-member", 4, "2", http.StatusNotFound},
+		{"private talkgroup member", 2, "2", http.StatusOK},
+		{"private talkgroup admin", 1, "2", http.StatusOK},
+		{"private call source", 2, "3", http.StatusOK},
+		{"private call destination", 3, "3", http.StatusOK},
+		{"private call admin", 1, "3", http.StatusOK},
+		{"private call stranger", 4, "3", http.StatusNotFound},
+		{"missing call", 1, "4", http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		router := testutils.ControllerRouter(db, nil, tc.userID)
+		router.GET("/calls/:id/telemetry", calls.GETCallTelemetry)
+		if w := testutils.Do(t, router, http.MethodGet, "/calls/"+tc.callID+"/telemetry", nil); w.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d: %s", tc.name, tc.want, w.Code, w.Body.String())
+		}
+	}
+}
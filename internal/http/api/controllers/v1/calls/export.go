@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package calls
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/featureflags"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/research"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GETCallsExport streams anonymized metadata for the calls that started between the
+// from and to RFC 3339 times as gzipped newline-delimited JSON. The export is off
+// unless the research_export feature flag is enabled.
+func GETCallsExport(c *gin.Context) {
+	if !featureflags.GetFeatureFlags().IsEnabled(featureflags.FeatureFlagResearchExport) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Call export is not enabled on this network"})
+		return
+	}
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	from, err := time.Parse(time.RFC3339, c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 time"})
+		return
+	}
+	to, err := time.Parse(time.RFC3339, c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC 3339 time"})
+		return
+	}
+	if err := research.CheckWindow(from, to); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"calls-%s-%s.ndjson.gz\"", from.UTC().Format("20060102T150405Z"), to.UTC().Format("20060102T150405Z")))
+	c.Status(http.StatusOK)
+	err = research.Export(db, c.Writer, from, to)
+	if err != nil {
+		// The status is already sent, so a truncated export is all that can be signalled
+		logging.Errorf("Error exporting calls: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package calls
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/heatmap"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// GETCallsHeatmap counts calls by geohash cell of the repeater they came through.
+// ?window= is one of heatmap.Windows, ?precision= 1-6 geohash characters, and
+// ?talkgroup= and ?protocol= narrow the calls counted. Private talkgroups are left off
+// the map for anyone who can't see them, and asking for one is a 404.
+func GETCallsHeatmap(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	redis, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	window := c.DefaultQuery("window", heatmap.DefaultWindow)
+	precision, err := strconv.Atoi(c.DefaultQuery("precision", strconv.Itoa(heatmap.DefaultPrecision)))
+	if err != nil || precision < 1 || precision > heatmap.MaxPrecision {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Precision must be between 1 and " + strconv.Itoa(heatmap.MaxPrecision)})
+		return
+	}
+	var talkgroupID uint64
+	if talkgroup := c.Query("talkgroup"); talkgroup != "" {
+		talkgroupID, err = strconv.ParseUint(talkgroup, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid talkgroup ID"})
+			return
+		}
+	}
+	protocol := c.Query("protocol")
+	if protocol != "" && protocol != heatmap.ProtocolHBRP {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown protocol"})
+		return
+	}
+
+	user, ok := viewer(c, db)
+	if !ok {
+		return
+	}
+	var hidden []uint
+	if talkgroupID != 0 {
+		visible, err := models.TalkgroupVisibleTo(db, uint(talkgroupID), user)
+		if err != nil {
+			logging.Errorf("Error checking talkgroup visibility: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+			return
+		}
+		if !visible {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Talkgroup does not exist"})
+			return
+		}
+	} else {
+		hidden, err = models.HiddenTalkgroupIDs(db, user)
+		if err != nil {
+			logging.Errorf("Error listing hidden talkgroups: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+			return
+		}
+	}
+
+	snapshot, err := heatmap.Load(c, db, redis, window, time.Now())
+	if errors.Is(err, heatmap.ErrUnknownWindow) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown window"})
+		return
+	}
+	if err != nil {
+		logging.Errorf("Error loading call heatmap: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading call heatmap"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"window":      snapshot.Window,
+		"precision":   precision,
+		"computed_at": snapshot.ComputedAt,
+		"cells":       snapshot.Without(hidden).Cells(precision, uint(talkgroupID), protocol),
+	})
+}
+
+// viewer loads the logged in user. Anonymous visitors are the zero User.
+func viewer(c *gin.Context, db *gorm.DB) (models.User, bool) {
+	uid, ok := sessions.Default(c).Get("user_id").(uint)
+	if !ok {
+		return models.User{}, true
+	}
+	user, err := models.FindUserByID(db, uid)
+	if err != nil {
+		logging.Errorf("Error finding user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return models.User{}, false
+	}
+	return user, true
+}
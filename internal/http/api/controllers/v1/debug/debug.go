@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package debug
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers/hbrp"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers/openbridge"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/metrics"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultBenchmarkPackets = 1000
+	maxBenchmarkPackets     = 50000
+)
+
+// GETRuntime reports goroutine, GC and per-server queue stats
+func GETRuntime(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"runtime": metrics.ReadRuntimeStats(),
+		"servers": servers.QueueDepths(),
+	})
+}
+
+// POSTBenchmark runs the routing benchmark with synthetic packets. The synthetic repeaters it
+// creates for the run are owned by the admin running it.
+func POSTBenchmark(c *gin.Context) {
+	session := sessions.Default(c)
+	userID, ok := session.Get("user_id").(uint)
+	if !ok {
+		logging.Error("userID cast failed")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	redis, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	var json apimodels.BenchmarkPost
+	// An empty body runs the default benchmark
+	if c.Request.ContentLength > 0 {
+		err := validation.BindJSON(c, &json)
+		if err != nil {
+			logging.Errorf("POSTBenchmark: JSON data is invalid: %v", err)
+			validation.Respond(c, err)
+			return
+		}
+	}
+	packets := json.Packets
+	if packets == 0 {
+		packets = defaultBenchmarkPackets
+	}
+	if packets > maxBenchmarkPackets {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many packets requested"})
+		return
+	}
+
+	result, err := hbrp.RunRoutingBenchmark(c, db, redis, userID, int(packets))
+	if errors.Is(err, hbrp.ErrBenchmarkTimeout) {
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error(), "result": result})
+		return
+	}
+	if err != nil {
+		logging.Errorf("Routing benchmark failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Routing benchmark failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": result})
+}
+
+// POSTInject hands a packet to the HBRP or OpenBridge server as if a repeater or peer had sent it,
+// so integration tests and demos don't need to speak the UDP protocols
+func POSTInject(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	redis, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	var json apimodels.InjectPost
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTInject: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+
+	redisClient := servers.MakeRedisClient(redis)
+	switch json.Protocol {
+	case "openbridge":
+		err = openbridge.InjectPacket(c, db, redisClient, json.RepeaterID, json.Packet)
+	default:
+		err = hbrp.InjectPacket(c, redisClient, json.RepeaterID, json.Packet)
+	}
+	switch {
+	case errors.Is(err, hbrp.ErrRepeaterNotConnected):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Repeater is not connected"})
+	case errors.Is(err, openbridge.ErrUnknownPeer):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Peer does not exist"})
+	case err != nil:
+		logging.Errorf("Error injecting packet: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error injecting packet"})
+	default:
+		logging.Logf("Admin injected a packet from %s %d: %s", json.Protocol, json.RepeaterID, json.Packet.String())
+		c.JSON(http.StatusOK, gin.H{"message": "Packet injected"})
+	}
+}
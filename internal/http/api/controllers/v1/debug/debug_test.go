@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package debug_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/debug"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestInject(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Peer{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	db.Create(&models.User{ID: 1, Callsign: "N0CALL", Username: "n0call", Admin: true, Approved: true})
+	db.Create(&models.Peer{ID: 1001, Password: "s3cret", OwnerID: 1})
+	_, redis := fakeredis.New(t)
+	repeater := models.Repeater{Connection: "YES", IP: "192.0.2.20", Port: 62031}
+	repeater.ID = 311860501
+	servers.MakeRedisClient(redis).StoreRepeater(ctx, repeater.ID, repeater)
+
+	router := testutils.ControllerRouter(db, redis, 1)
+	router.POST("/debug/inject", debug.POSTInject)
+
+	sub := redis.Subscribe(ctx, "hbrp:incoming", "openbridge:incoming")
+	t.Cleanup(func() { _ = sub.Close() })
+	for range 2 {
+		if _, err := sub.Receive(ctx); err != nil {
+			t.Fatalf("Failed to subscribe: %v", err)
+		}
+	}
+
+	packet := models.Packet{Src: 3118605, Dst: 3100, GroupCall: true, StreamID: 44}
+	tests := []struct {
+		name    string
+		body    apimodels.InjectPost
+		status  int
+		channel string
+	}{
+		{"unknown protocol", apimodels.InjectPost{Protocol: "m17", RepeaterID: repeater.ID, Packet: packet}, http.StatusBadRequest, ""},
+		{"disconnected repeater", apimodels.InjectPost{Protocol: "hbrp", RepeaterID: 311860502, Packet: packet}, http.StatusBadRequest, ""},
+		{"unknown peer", apimodels.InjectPost{Protocol: "openbridge", RepeaterID: 1002, Packet: packet}, http.StatusBadRequest, ""},
+		{"repeater", apimodels.InjectPost{Protocol: "hbrp", RepeaterID: repeater.ID, Packet: packet}, http.StatusOK, "hbrp:incoming"},
+		{"peer", apimodels.InjectPost{Protocol: "openbridge", RepeaterID: 1001, Packet: packet}, http.StatusOK, "openbridge:incoming"},
+	}
+	for _, tt := range tests {
+		w := testutils.Do(t, router, http.MethodPost, "/debug/inject", tt.body)
+		if w.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.status, w.Code, w.Body.String())
+			continue
+		}
+		if tt.channel == "" {
+			continue
+		}
+		// Failed injections publish nothing, so the next message is this one's
+		msg, err := sub.ReceiveMessage(ctx)
+		if err != nil {
+			t.Fatalf("%s: failed to receive the packet: %v", tt.name, err)
+		}
+		if msg.Channel != tt.channel {
+			t.Errorf("%s: expected the packet on %s, got %s", tt.name, tt.channel, msg.Channel)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package deferred
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GETDeferredData lists the data packets held for offline repeaters and users
+func GETDeferredData(c *gin.Context) {
+	db, ok := c.MustGet("PaginatedDB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	cDb, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	queued, err := models.ListDeferredData(db)
+	if err != nil {
+		logging.Errorf("Error listing deferred data: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing deferred data"})
+		return
+	}
+	total, err := models.CountDeferredData(cDb)
+	if err != nil {
+		logging.Errorf("Error counting deferred data: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting deferred data"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"total": total, "queued": queued})
+}
+
+// DELETEDeferredData purges held data, only for one destination if ?destination= is set
+func DELETEDeferredData(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	var destinationID uint64
+	if destination := c.Query("destination"); destination != "" {
+		var err error
+		destinationID, err = strconv.ParseUint(destination, 10, 32)
+		if err != nil || destinationID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid destination ID"})
+			return
+		}
+	}
+	purged, err := models.PurgeDeferredData(db, uint(destinationID))
+	if err != nil {
+		logging.Errorf("Error purging deferred data: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error purging deferred data"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Deferred data purged", "purged": purged})
+}
+
+// DELETEDeferredDataPacket drops a single held packet
+func DELETEDeferredDataPacket(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deferred data ID"})
+		return
+	}
+	deleted, err := models.DeleteDeferredData(db, uint(id))
+	if err != nil {
+		logging.Errorf("Error deleting deferred data: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting deferred data"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deferred data does not exist"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Deferred data deleted"})
+}
@@ -20,12 +20,73 @@
 package v1
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/featureflags"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 func GETFeatures(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"features": config.GetConfig().FeatureFlags})
+	captcha := gin.H{}
+	if config.GetConfig().CaptchaProvider != "" {
+		// The site key is public, the registration form needs it to render the widget
+		captcha = gin.H{"provider": config.GetConfig().CaptchaProvider, "site_key": config.GetConfig().CaptchaSiteKey}
+	}
+	c.JSON(http.StatusOK, gin.H{"features": featureflags.GetFeatureFlags().Enabled(), "captcha": captcha})
+}
+
+func GETFeatureFlags(c *gin.Context) {
+	c.JSON(http.StatusOK, featureflags.GetFeatureFlags().List())
+}
+
+func PUTFeatureFlag(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Errorf("Unable to get DB from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	var json apimodels.FeatureFlagPut
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("PUTFeatureFlag: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+
+	err = featureflags.GetFeatureFlags().Set(db, featureflags.FeatureFlag(c.Param("name")), *json.Enabled)
+	if errors.Is(err, featureflags.ErrUnknownFlag) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Feature flag does not exist"})
+		return
+	} else if err != nil {
+		logging.Errorf("Error setting feature flag: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Feature flag updated"})
+}
+
+func DELETEFeatureFlag(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Errorf("Unable to get DB from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	err := featureflags.GetFeatureFlags().Reset(db, featureflags.FeatureFlag(c.Param("name")))
+	if errors.Is(err, featureflags.ErrUnknownFlag) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Feature flag does not exist"})
+		return
+	} else if err != nil {
+		logging.Errorf("Error resetting feature flag: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Feature flag reset to its default"})
 }
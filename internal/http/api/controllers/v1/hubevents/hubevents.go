@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hubevents
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers/hbrp"
+	"github.com/USA-RedDragon/DMRHub/internal/hubevents"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+// GETHubEvents lists the newest hub state transitions, optionally for one instance or repeater
+func GETHubEvents(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	filter, ok := parseFilter(c)
+	if !ok {
+		return
+	}
+	limit := defaultLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = min(parsed, maxLimit)
+	}
+
+	events, err := models.ListHubEvents(db, filter, limit)
+	if err != nil {
+		logging.Errorf("Error listing hub events: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing hub events"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
+
+// GETHubState replays the hub event log to rebuild each replica's state, as of now
+// or as of the at parameter. Without at, the replica serving the request also
+// reports where its live subscriptions have drifted from the log.
+func GETHubState(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	filter, ok := parseFilter(c)
+	if !ok {
+		return
+	}
+
+	state, err := hubevents.Replay(db, filter)
+	if err != nil {
+		logging.Errorf("Error replaying hub events: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error replaying hub events"})
+		return
+	}
+	response := gin.H{"state": state}
+	recorder := hubevents.Default()
+	if filter.Until.IsZero() && filter.RepeaterID == 0 && recorder != nil {
+		response["instance"] = recorder.Instance()
+		response["drift"] = state[recorder.Instance()].Compare(hbrp.GetSubscriptionManager(db).Talkgroups())
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func parseFilter(c *gin.Context) (models.HubEventFilter, bool) {
+	filter := models.HubEventFilter{Instance: c.Query("instance")}
+	if repeaterStr := c.Query("repeater_id"); repeaterStr != "" {
+		repeaterID, err := strconv.ParseUint(repeaterStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater ID"})
+			return filter, false
+		}
+		filter.RepeaterID = uint(repeaterID)
+	}
+	if atStr := c.Query("at"); atStr != "" {
+		at, err := time.Parse(time.RFC3339, atStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "at must be an RFC 3339 time"})
+			return filter, false
+		}
+		filter.Until = at
+	}
+	return filter, true
+}
@@ -0,0 +1,199 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package inhibits
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/events"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	"github.com/USA-RedDragon/DMRHub/internal/inhibit"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// GETInhibits lists every TX inhibit, lifted or not, as an audit trail
+func GETInhibits(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	inhibits, err := models.ListTXInhibits(db)
+	if err != nil {
+		logging.Errorf("Error listing TX inhibits: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing TX inhibits"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"inhibits": inhibits, "total": len(inhibits)})
+}
+
+// POSTInhibit stops routing on talkgroups, or the whole hub, on every replica.
+// Calls already in progress that the inhibit covers are ended with a terminator.
+func POSTInhibit(c *gin.Context) {
+	session := sessions.Default(c)
+	userID, ok := session.Get("user_id").(uint)
+	if !ok {
+		logging.Error("userID cast failed")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	redis, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	var json apimodels.TXInhibitPost
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTInhibit: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	if !json.Hub && len(json.Talkgroups) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Choose talkgroups to inhibit or inhibit the whole hub"})
+		return
+	}
+	if !json.Hub && len(json.Exceptions) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Exceptions only apply to a hub-wide inhibit"})
+		return
+	}
+
+	txInhibit := models.TXInhibit{
+		Hub:         json.Hub,
+		Reason:      json.Reason,
+		CreatedByID: userID,
+	}
+	txInhibit.Talkgroups, ok = checkTalkgroups(c, db, json.Talkgroups)
+	if !ok {
+		return
+	}
+	txInhibit.Exceptions, ok = checkTalkgroups(c, db, json.Exceptions)
+	if !ok {
+		return
+	}
+	err = db.Create(&txInhibit).Error
+	if err != nil {
+		logging.Errorf("Error creating TX inhibit: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating TX inhibit"})
+		return
+	}
+	// The inhibit is saved, so replicas that miss this announcement still pick it up when they restart
+	err = inhibit.Notify(c, redis, txInhibit.ID)
+	if err != nil {
+		logging.Errorf("Error announcing TX inhibit %d: %v", txInhibit.ID, err)
+	}
+	logging.Logf("TX inhibit %d started by user %d: %s", txInhibit.ID, userID, txInhibit.Reason)
+
+	c.JSON(http.StatusOK, gin.H{"message": "TX inhibit started", "inhibit": txInhibit})
+	events.Publish(c, redis, events.TXInhibited, describe(txInhibit), gin.H{"inhibit_id": txInhibit.ID, "user_id": userID, "reason": txInhibit.Reason})
+}
+
+// DELETEInhibit lifts a TX inhibit. The record is kept for the audit trail.
+func DELETEInhibit(c *gin.Context) {
+	session := sessions.Default(c)
+	userID, ok := session.Get("user_id").(uint)
+	if !ok {
+		logging.Error("userID cast failed")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	redis, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid TX inhibit ID"})
+		return
+	}
+	id := uint(idUint64)
+
+	err = models.LiftTXInhibit(db, id, userID, time.Now())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "TX inhibit does not exist or was already lifted"})
+		return
+	}
+	if err != nil {
+		logging.Errorf("Error lifting TX inhibit: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error lifting TX inhibit"})
+		return
+	}
+	err = inhibit.Notify(c, redis, id)
+	if err != nil {
+		logging.Errorf("Error announcing TX inhibit %d: %v", id, err)
+	}
+	logging.Logf("TX inhibit %d lifted by user %d", id, userID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "TX inhibit lifted"})
+	events.Publish(c, redis, events.TXInhibitLifted, fmt.Sprintf("TX inhibit %d lifted", id), gin.H{"inhibit_id": id, "user_id": userID})
+}
+
+func describe(txInhibit models.TXInhibit) string {
+	if txInhibit.Hub {
+		return fmt.Sprintf("Hub-wide TX inhibit %d started with %d exceptions: %s", txInhibit.ID, len(txInhibit.Exceptions), txInhibit.Reason)
+	}
+	return fmt.Sprintf("TX inhibit %d started on %d talkgroups: %s", txInhibit.ID, len(txInhibit.Talkgroups), txInhibit.Reason)
+}
+
+// checkTalkgroups makes sure every talkgroup exists, so an inhibit can't create placeholder talkgroups
+func checkTalkgroups(c *gin.Context, db *gorm.DB, talkgroups []models.Talkgroup) ([]models.Talkgroup, bool) {
+	checked := make([]models.Talkgroup, 0, len(talkgroups))
+	for _, tg := range talkgroups {
+		exists, err := models.TalkgroupIDExists(db, tg.ID)
+		if err != nil {
+			logging.Errorf("Error checking if talkgroup exists: %s", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking if talkgroup exists"})
+			return nil, false
+		}
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Talkgroup " + strconv.FormatUint(uint64(tg.ID), 10) + " does not exist"})
+			return nil, false
+		}
+		checked = append(checked, models.Talkgroup{ID: tg.ID})
+	}
+	return checked, true
+}
@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package v1
+
+import (
+	"net/http"
+	"net/mail"
+	"net/url"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/events"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+func GETInstance(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Errorf("Unable to get DB from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	settings, err := models.GetInstanceSettings(db)
+	if err != nil {
+		logging.Errorf("Error getting instance settings: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting instance settings"})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+func PATCHInstance(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Errorf("Unable to get DB from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	var json apimodels.InstanceSettingsPatch
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("PATCHInstance: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+
+	if json.LogoURL != nil && *json.LogoURL != "" {
+		logoURL, err := url.Parse(*json.LogoURL)
+		if err != nil || (logoURL.Scheme != "http" && logoURL.Scheme != "https") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Logo URL must be an http or https URL"})
+			return
+		}
+	}
+	if json.ContactEmail != nil && *json.ContactEmail != "" {
+		_, err := mail.ParseAddress(*json.ContactEmail)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contact email"})
+			return
+		}
+	}
+
+	var settings models.InstanceSettings
+	err = db.FirstOrCreate(&settings).Error
+	if err != nil {
+		logging.Errorf("Error getting instance settings: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting instance settings"})
+		return
+	}
+	if json.NetworkName != nil {
+		settings.NetworkName = *json.NetworkName
+	}
+	if json.LogoURL != nil {
+		settings.LogoURL = *json.LogoURL
+	}
+	if json.ContactEmail != nil {
+		settings.ContactEmail = *json.ContactEmail
+	}
+	if json.TermsOfUse != nil {
+		settings.TermsOfUse = *json.TermsOfUse
+	}
+	if json.MOTD != nil {
+		settings.MOTD = *json.MOTD
+	}
+	err = db.Save(&settings).Error
+	if err != nil {
+		logging.Errorf("Error saving instance settings: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving instance settings"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Instance settings updated"})
+	if redis, ok := c.MustGet("Redis").(*redis.Client); ok {
+		events.Publish(c, redis, events.ConfigurationChanged, "Instance settings updated", nil)
+	}
+}
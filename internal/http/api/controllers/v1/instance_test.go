@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package v1_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	v1 "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestInstanceSettings(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.InstanceSettings{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	_, redis := fakeredis.New(t)
+	router := testutils.ControllerRouter(db, redis, 1)
+	router.GET("/instance", v1.GETInstance)
+	router.PATCH("/instance", v1.PATCHInstance)
+	router.GET("/network/name", v1.GETNetworkName)
+
+	// Until an admin sets anything, the configured network name is used
+	settings := testutils.Decode[models.InstanceSettings](t, testutils.Do(t, router, http.MethodGet, "/instance", nil))
+	if settings.NetworkName != config.GetConfig().NetworkName || settings.MOTD != "" {
+		t.Errorf("Expected the configured defaults, got %+v", settings)
+	}
+
+	invalid := []map[string]string{
+		{"logo_url": "javascript:alert(1)"},
+		{"logo_url": "ftp://example.com/logo.png"},
+		{"contact_email": "not an email"},
+	}
+	for _, body := range invalid {
+		if w := testutils.Do(t, router, http.MethodPatch, "/instance", body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected %v to be rejected, got %d", body, w.Code)
+		}
+	}
+
+	w := testutils.Do(t, router, http.MethodPatch, "/instance", map[string]string{
+		"network_name":  "Test Net",
+		"logo_url":      "https://example.com/logo.png",
+		"contact_email": "admin@example.com",
+		"motd":          "Net tonight at 8",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the update to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	// Fields left out of a patch are kept
+	if w := testutils.Do(t, router, http.MethodPatch, "/instance", map[string]string{"terms_of_use": "Be nice"}); w.Code != http.StatusOK {
+		t.Fatalf("Expected the update to succeed, got %d", w.Code)
+	}
+
+	settings = testutils.Decode[models.InstanceSettings](t, testutils.Do(t, router, http.MethodGet, "/instance", nil))
+	if settings.NetworkName != "Test Net" || settings.LogoURL != "https://example.com/logo.png" ||
+		settings.ContactEmail != "admin@example.com" || settings.MOTD != "Net tonight at 8" || settings.TermsOfUse != "Be nice" {
+		t.Errorf("Unexpected settings: %+v", settings)
+	}
+	var count int64
+	db.Model(&models.InstanceSettings{}).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected a single settings row, got %d", count)
+	}
+	if w := testutils.Do(t, router, http.MethodGet, "/network/name", nil); w.Body.String() != "Test Net" {
+		t.Errorf("Expected the network name endpoint to use the setting, got %q", w.Body.String())
+	}
+}
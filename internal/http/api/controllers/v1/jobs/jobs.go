@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/jobs"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GETJobs lists background jobs, newest first, filtered by ?state= and ?kind=
+func GETJobs(c *gin.Context) {
+	db, ok := c.MustGet("PaginatedDB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	cDb, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	state := models.JobState(c.Query("state"))
+	switch state {
+	case "", models.JobPending, models.JobRunning, models.JobSucceeded, models.JobDead:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job state"})
+		return
+	}
+	kind := c.Query("kind")
+	list, err := models.ListJobs(models.JobsMatching(db, state, kind))
+	if err != nil {
+		logging.Errorf("Error listing jobs: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing jobs"})
+		return
+	}
+	total, err := models.CountJobs(models.JobsMatching(cDb, state, kind))
+	if err != nil {
+		logging.Errorf("Error counting jobs: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting jobs"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"total": total, "jobs": list})
+}
+
+// GETJob shows a single background job, including why it last failed
+func GETJob(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	id, ok := jobID(c)
+	if !ok {
+		return
+	}
+	job, err := models.FindJobByID(db, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job does not exist"})
+		return
+	} else if err != nil {
+		logging.Errorf("Error finding job: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding job"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// POSTJobRetry runs a dead or waiting job again right away, with a fresh set of attempts
+func POSTJobRetry(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	id, ok := jobID(c)
+	if !ok {
+		return
+	}
+	retried, err := models.RetryJob(db, id, time.Now())
+	if err != nil {
+		logging.Errorf("Error retrying job: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrying job"})
+		return
+	}
+	if !retried {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job does not exist or is not dead or pending"})
+		return
+	}
+	if q := jobs.Default(); q != nil {
+		q.Wake()
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Job queued to run again"})
+}
+
+// POSTJobDeadLetter stops a pending job from running. It can still be retried later.
+func POSTJobDeadLetter(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	id, ok := jobID(c)
+	if !ok {
+		return
+	}
+	userID, _ := sessions.Default(c).Get("user_id").(uint)
+	deadLettered, err := models.DeadLetterJob(db, id, fmt.Sprintf("Dead-lettered by user %d", userID), time.Now())
+	if err != nil {
+		logging.Errorf("Error dead-lettering job: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error dead-lettering job"})
+		return
+	}
+	if !deadLettered {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job does not exist or is not pending"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Job dead-lettered"})
+}
+
+func jobID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
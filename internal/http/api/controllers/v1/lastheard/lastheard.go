@@ -43,14 +43,27 @@ func GETLastheard(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
 		return
 	}
+	grouped := c.Query("grouped") == "true"
+	if grouped {
+		db = models.ConversationHeads(db)
+		cDb = models.ConversationHeads(cDb)
+	}
+	category, ok := categoryFilter(c)
+	if !ok {
+		return
+	}
+	if category != 0 {
+		db = models.CallsInTalkgroupCategory(db, category)
+		cDb = models.CallsInTalkgroupCategory(cDb, category)
+	}
 	session := sessions.Default(c)
 	userID := session.Get("user_id")
 	var calls []models.Call
 	var count int
 	if userID == nil {
 		// This is okay, we just query the latest public calls
-		calls = models.FindCalls(db)
-		count = models.CountCalls(cDb)
+		calls = models.FindCalls(models.PublicCalls(db))
+		count = models.CountCalls(models.PublicCalls(cDb))
 	} else {
 		// Get the last calls for the user
 		uid, ok := userID.(uint)
@@ -62,6 +75,9 @@ func GETLastheard(c *gin.Context) {
 		calls = models.FindUserCalls(db, uid)
 		count = models.CountUserCalls(cDb, uid)
 	}
+	if grouped && !aggregateConversations(c, calls) {
+		return
+	}
 	if len(calls) == 0 {
 		c.JSON(http.StatusOK, make([]string, 0))
 	} else {
@@ -89,8 +105,24 @@ func GETLastheardUser(c *gin.Context) {
 		return
 	}
 	userID := uint(userID64)
+	grouped := c.Query("grouped") == "true"
+	if grouped {
+		db = models.ConversationHeads(db)
+		cDb = models.ConversationHeads(cDb)
+	}
+	category, ok := categoryFilter(c)
+	if !ok {
+		return
+	}
+	if category != 0 {
+		db = models.CallsInTalkgroupCategory(db, category)
+		cDb = models.CallsInTalkgroupCategory(cDb, category)
+	}
 	calls := models.FindUserCalls(db, userID)
 	count := models.CountUserCalls(cDb, userID)
+	if grouped && !aggregateConversations(c, calls) {
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"calls": calls, "total": count})
 }
 
@@ -114,8 +146,24 @@ func GETLastheardRepeater(c *gin.Context) {
 		return
 	}
 	repeaterID := uint(repeaterID64)
+	grouped := c.Query("grouped") == "true"
+	if grouped {
+		db = models.ConversationHeads(db)
+		cDb = models.ConversationHeads(cDb)
+	}
+	category, ok := categoryFilter(c)
+	if !ok {
+		return
+	}
+	if category != 0 {
+		db = models.CallsInTalkgroupCategory(db, category)
+		cDb = models.CallsInTalkgroupCategory(cDb, category)
+	}
 	calls := models.FindRepeaterCalls(db, repeaterID)
 	count := models.CountRepeaterCalls(cDb, repeaterID)
+	if grouped && !aggregateConversations(c, calls) {
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"calls": calls, "total": count})
 }
 
@@ -133,7 +181,82 @@ func GETLastheardTalkgroup(c *gin.Context) {
 		return
 	}
 	talkgroupID := uint(talkgroupID64)
+	if !talkgroupVisible(c, talkgroupID) {
+		return
+	}
+	grouped := c.Query("grouped") == "true"
+	if grouped {
+		db = models.ConversationHeads(db)
+	}
 	calls := models.FindTalkgroupCalls(db, talkgroupID)
 	count := models.CountTalkgroupCalls(db, talkgroupID)
+	if grouped && !aggregateConversations(c, calls) {
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"calls": calls, "total": count})
 }
+
+// talkgroupVisible checks that the session user may see a talkgroup, responding with a 404 if not.
+// Private talkgroups look the same as missing ones to users outside them.
+func talkgroupVisible(c *gin.Context, talkgroupID uint) bool {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Errorf("Unable to get DB from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return false
+	}
+	uid, ok := sessions.Default(c).Get("user_id").(uint)
+	if !ok {
+		logging.Errorf("Unable to convert user_id to uint")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return false
+	}
+	user, err := models.FindUserByID(db, uid)
+	if err != nil {
+		logging.Errorf("Error finding user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return false
+	}
+	visible, err := models.TalkgroupVisibleTo(db, talkgroupID, user)
+	if err != nil {
+		logging.Errorf("Error checking talkgroup visibility: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return false
+	}
+	if !visible {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Talkgroup does not exist"})
+		return false
+	}
+	return true
+}
+
+// categoryFilter reads the optional category query parameter, responding with an error if it is invalid
+func categoryFilter(c *gin.Context) (uint, bool) {
+	category := c.Query("category")
+	if category == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseUint(category, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// aggregateConversations totals up each conversation in a grouped view, responding with an error on failure
+func aggregateConversations(c *gin.Context, calls []models.Call) bool {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Errorf("Unable to get DB from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return false
+	}
+	_, err := models.AggregateConversations(db, calls)
+	if err != nil {
+		logging.Errorf("Error grouping calls into conversations: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error grouping calls"})
+		return false
+	}
+	return true
+}
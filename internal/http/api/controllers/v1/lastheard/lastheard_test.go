@@ -20,10 +20,65 @@
 package lastheard_test
 
 import (
+	"net/http"
 	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/lastheard"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
 )
 
-func TestNoop(t *testing.T) {
+type callsResponse struct {
+	Calls []models.Call `json:"calls"`
+	Total int           `json:"total"`
+}
+
+func TestGroupedLastheard(t *testing.T) {
 	t.Parallel()
-	t.Log("Noop")
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Talkgroup{}, &models.Repeater{}, &models.Call{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	db.Create(&models.User{ID: 1, Callsign: "N0CALL", Username: "n0call", Approved: true})
+	db.Create(&models.User{ID: 2, Callsign: "N0TWO", Username: "n0two", Approved: true})
+	start := time.Now().Add(-time.Hour)
+	db.Create(&[]models.Call{
+		{ID: 1, ConversationID: 1, UserID: 1, StartTime: start, Duration: 4 * time.Second},
+		{ID: 2, ConversationID: 1, UserID: 1, StartTime: start.Add(10 * time.Second), Duration: 6 * time.Second},
+		{ID: 3, ConversationID: 3, UserID: 1, StartTime: start.Add(time.Minute), Duration: 2 * time.Second},
+		// Another user's conversation doesn't leak into user 1's
+		{ID: 4, ConversationID: 4, UserID: 2, StartTime: start.Add(2 * time.Minute), Duration: time.Second},
+	})
+
+	_, redis := fakeredis.New(t)
+	router := testutils.ControllerRouter(db, redis, 1)
+	router.GET("/lastheard/user/:id", lastheard.GETLastheardUser)
+
+	w := testutils.Do(t, router, http.MethodGet, "/lastheard/user/1", nil)
+	if resp := testutils.Decode[callsResponse](t, w); resp.Total != 3 || len(resp.Calls) != 3 {
+		t.Errorf("Expected every transmission without grouping, got %d of %d", len(resp.Calls), resp.Total)
+	}
+
+	w = testutils.Do(t, router, http.MethodGet, "/lastheard/user/1?grouped=true", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	resp := testutils.Decode[callsResponse](t, w)
+	if resp.Total != 2 || len(resp.Calls) != 2 {
+		t.Fatalf("Expected 2 conversations, got %d of %d", len(resp.Calls), resp.Total)
+	}
+	// Newest first
+	if resp.Calls[0].ID != 3 || resp.Calls[0].Transmissions != 1 {
+		t.Errorf("Expected call 3 on its own first, got %d with %d transmissions", resp.Calls[0].ID, resp.Calls[0].Transmissions)
+	}
+	if resp.Calls[1].ID != 1 || resp.Calls[1].Transmissions != 2 || resp.Calls[1].Duration != 10*time.Second {
+		t.Errorf("Expected call 1 heading 2 transmissions over 10s, got %d with %d over %s", resp.Calls[1].ID, resp.Calls[1].Transmissions, resp.Calls[1].Duration)
+	}
 }
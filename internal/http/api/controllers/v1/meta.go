@@ -25,13 +25,25 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/i18n"
 	"github.com/USA-RedDragon/DMRHub/internal/logging"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 func GETNetworkName(c *gin.Context) {
-	_, err := io.WriteString(c.Writer, config.GetConfig().NetworkName)
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Errorf("Unable to get DB from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	settings, err := models.GetInstanceSettings(db)
+	if err != nil {
+		logging.Errorf("Error getting instance settings: %v", err)
+	}
+	_, err = io.WriteString(c.Writer, settings.NetworkName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting network name"})
 	}
@@ -58,6 +70,11 @@ func GETVersion(c *gin.Context) {
 	}
 }
 
+// GETLocales lists the languages server messages can be returned in
+func GETLocales(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"default": i18n.Default(), "current": c.GetString(i18n.ContextKey), "locales": i18n.Supported()})
+}
+
 func GETPing(c *gin.Context) {
 	_, err := io.WriteString(c.Writer, fmt.Sprintf("%d", time.Now().Unix()))
 	if err != nil {
@@ -28,6 +28,7 @@ import (
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers/openbridge"
 	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
 	"github.com/USA-RedDragon/DMRHub/internal/http/api/utils"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
 	"github.com/USA-RedDragon/DMRHub/internal/logging"
 	"github.com/USA-RedDragon/DMRHub/internal/smtp"
 	"github.com/gin-contrib/sessions"
@@ -169,10 +170,10 @@ func POSTPeer(c *gin.Context) {
 	}
 
 	var json apimodels.PeerPost
-	err := c.ShouldBindJSON(&json)
+	err := validation.BindJSON(c, &json)
 	if err != nil {
 		logging.Errorf("POSTPeer: JSON data is invalid: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		validation.Respond(c, err)
 	} else {
 		if models.PeerIDExists(db, json.ID) {
 			logging.Errorf("POSTPeer: Peer ID already exists: %v", json.ID)
@@ -184,6 +185,7 @@ func POSTPeer(c *gin.Context) {
 
 		peer.Egress = json.Egress
 		peer.Ingress = json.Ingress
+		peer.MaxDatagram = json.MaxDatagram
 
 		// Peer validated to fit within a 4 byte integer
 		if json.ID <= 0 || json.ID > 4294967295 {
@@ -236,3 +238,77 @@ func POSTPeer(c *gin.Context) {
 		}
 	}
 }
+
+// POSTPeerMaxDatagram sets the largest datagram sent to a peer
+func POSTPeerMaxDatagram(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid peer ID"})
+		return
+	}
+
+	var json apimodels.MaxDatagramPost
+	err = validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTPeerMaxDatagram: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+
+	if !models.PeerIDExists(db, uint(idUint64)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Peer does not exist"})
+		return
+	}
+	err = db.Model(&models.Peer{ID: uint(idUint64)}).Update("max_datagram", json.MaxDatagram).Error
+	if err != nil {
+		logging.Errorf("Error saving peer: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving peer"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Peer maximum datagram size updated"})
+}
+
+// POSTPeerNetwork binds a peer to a named network
+func POSTPeerNetwork(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid peer ID"})
+		return
+	}
+
+	var json apimodels.NetworkPost
+	err = validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTPeerNetwork: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	if _, ok := config.GetConfig().Networks[json.Network]; json.Network != "" && !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown network"})
+		return
+	}
+
+	if !models.PeerIDExists(db, uint(idUint64)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Peer does not exist"})
+		return
+	}
+	err = db.Model(&models.Peer{ID: uint(idUint64)}).Update("network", json.Network).Error
+	if err != nil {
+		logging.Errorf("Error saving peer: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving peer"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Peer network updated"})
+}
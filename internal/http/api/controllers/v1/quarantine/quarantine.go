@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package quarantine
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/ingress"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// GETQuarantine lists the sources the UDP servers are dropping for sending malformed packets
+func GETQuarantine(c *gin.Context) {
+	redis, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	entries, err := ingress.ListQuarantined(c, redis)
+	if err != nil {
+		logging.Errorf("Error listing quarantined sources: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing quarantined sources"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"quarantine": entries, "total": len(entries)})
+}
+
+// DELETEQuarantine lifts the quarantine on a source address
+func DELETEQuarantine(c *gin.Context) {
+	redis, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	ip := net.ParseIP(c.Param("ip"))
+	if ip == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid IP address"})
+		return
+	}
+	err := ingress.Release(c, redis, ip.String())
+	if errors.Is(err, ingress.ErrNotQuarantined) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Source is not quarantined"})
+		return
+	}
+	if err != nil {
+		logging.Errorf("Error releasing quarantined source: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error releasing quarantined source"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Source released"})
+}
@@ -0,0 +1,378 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package repeatergroups
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers/hbrp"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+func GETRepeaterGroups(c *gin.Context) {
+	db, ok := c.MustGet("PaginatedDB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	cDb, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	groups, err := models.ListRepeaterGroups(db)
+	if err != nil {
+		logging.Errorf("Error listing repeater groups: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing repeater groups"})
+		return
+	}
+
+	total, err := models.CountRepeaterGroups(cDb)
+	if err != nil {
+		logging.Errorf("Error counting repeater groups: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting repeater groups"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"total": total, "groups": groups})
+}
+
+func GETRepeaterGroup(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	group, ok := findGroup(c, db)
+	if !ok {
+		return
+	}
+	if group.Simulcast {
+		// Show the latency each member's simulcast delay is based on
+		if redis, ok := c.MustGet("Redis").(*redis.Client); ok {
+			redisClient := servers.MakeRedisClient(redis)
+			group.LatencyMS = make(map[uint]int64, len(group.Repeaters))
+			for _, repeater := range group.Repeaters {
+				if latency, ok := redisClient.GetRepeaterLatency(c, repeater.ID); ok {
+					group.LatencyMS[repeater.ID] = latency.Milliseconds()
+				}
+			}
+		}
+	}
+	c.JSON(http.StatusOK, group)
+}
+
+func POSTRepeaterGroup(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	var json apimodels.RepeaterGroupPost
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTRepeaterGroup: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+
+	group := models.RepeaterGroup{
+		Name:              json.Name,
+		Description:       json.Description,
+		Simulcast:         json.Simulcast,
+		SimulcastWindowMS: json.SimulcastWindowMS,
+	}
+	err = db.Create(&group).Error
+	if err != nil {
+		logging.Errorf("Error creating repeater group: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating repeater group"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Repeater group created", "id": group.ID})
+}
+
+func PATCHRepeaterGroup(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	var json apimodels.RepeaterGroupPatch
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("PATCHRepeaterGroup: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	group, ok := findGroup(c, db)
+	if !ok {
+		return
+	}
+
+	if json.Name != "" {
+		group.Name = json.Name
+	}
+	if json.Description != "" {
+		group.Description = json.Description
+	}
+	if json.Simulcast != nil {
+		group.Simulcast = *json.Simulcast
+	}
+	if json.SimulcastWindowMS != nil {
+		group.SimulcastWindowMS = *json.SimulcastWindowMS
+	}
+
+	err = db.Omit("Repeaters").Save(&group).Error
+	if err != nil {
+		logging.Errorf("Error saving repeater group: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving repeater group"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Repeater group updated"})
+}
+
+func DELETERepeaterGroup(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	group, ok := findGroup(c, db)
+	if !ok {
+		return
+	}
+	err := models.DeleteRepeaterGroup(db, group.ID)
+	if err != nil {
+		logging.Errorf("Error deleting repeater group: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting repeater group"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Repeater group deleted"})
+}
+
+// POSTRepeaterGroupRepeaters replaces the membership of a repeater group
+func POSTRepeaterGroupRepeaters(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	var json apimodels.RepeaterGroupRepeatersPost
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTRepeaterGroupRepeaters: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	group, ok := findGroup(c, db)
+	if !ok {
+		return
+	}
+
+	repeaters := make([]models.Repeater, 0, len(json.RepeaterIDs))
+	for _, repeaterID := range json.RepeaterIDs {
+		exists, err := models.RepeaterIDExists(db, repeaterID)
+		if err != nil {
+			logging.Errorf("Error checking if repeater exists: %s", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking if repeater exists"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Repeater " + strconv.FormatUint(uint64(repeaterID), 10) + " does not exist"})
+			return
+		}
+		var repeater models.Repeater
+		repeater.ID = repeaterID
+		repeaters = append(repeaters, repeater)
+	}
+
+	err = db.Model(&group).Association("Repeaters").Replace(repeaters)
+	if err != nil {
+		logging.Errorf("Error updating repeater group membership: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating repeater group membership"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Repeater group membership updated"})
+}
+
+// POSTRepeaterGroupTalkgroups assigns the same static talkgroup set to every repeater in a group
+func POSTRepeaterGroupTalkgroups(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	redis, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	var json apimodels.RepeaterGroupTalkgroupsPost
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTRepeaterGroupTalkgroups: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	group, ok := findGroup(c, db)
+	if !ok {
+		return
+	}
+	for _, talkgroup := range append(append([]models.Talkgroup{}, json.TS1StaticTalkgroups...), json.TS2StaticTalkgroups...) {
+		if !talkgroupAllowed(c, db, talkgroup.ID, group.Repeaters) {
+			return
+		}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, repeater := range group.Repeaters {
+			repeater := repeater
+			err := tx.Model(&repeater).Association("TS1StaticTalkgroups").Replace(json.TS1StaticTalkgroups)
+			if err != nil {
+				return err //nolint:golint,wrapcheck
+			}
+			err = tx.Model(&repeater).Association("TS2StaticTalkgroups").Replace(json.TS2StaticTalkgroups)
+			if err != nil {
+				return err //nolint:golint,wrapcheck
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logging.Errorf("POSTRepeaterGroupTalkgroups: Error updating static talkgroups: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating static talkgroups"})
+		return
+	}
+
+	userID, _ := sessions.Default(c).Get("user_id").(uint)
+	for _, repeater := range group.Repeaters {
+		_, _, err = models.RecordRepeaterVersion(db, repeater.ID, userID)
+		if err != nil {
+			logging.Errorf("Error recording configuration version of repeater %d: %v", repeater.ID, err)
+		}
+		hbrp.GetSubscriptionManager(db).CancelAllRepeaterSubscriptions(repeater.ID)
+		go hbrp.GetSubscriptionManager(db).ListenForCalls(redis, repeater.ID)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Repeater group talkgroups updated", "repeaters": len(group.Repeaters)})
+}
+
+// POSTRepeaterGroupDisconnect disconnects every connected repeater in a group
+func POSTRepeaterGroupDisconnect(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	redis, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	group, ok := findGroup(c, db)
+	if !ok {
+		return
+	}
+
+	redisClient := servers.MakeRedisClient(redis)
+	disconnected := 0
+	for _, repeater := range group.Repeaters {
+		if hbrp.DisconnectRepeater(c.Request.Context(), redisClient, repeater.ID) {
+			disconnected++
+			err := models.CloseRepeaterSessions(db, repeater.ID, time.Now())
+			if err != nil {
+				logging.Errorf("Error closing uptime session for repeater %d: %v", repeater.ID, err)
+			}
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Repeater group disconnected", "disconnected": disconnected})
+}
+
+func findGroup(c *gin.Context, db *gorm.DB) (models.RepeaterGroup, bool) {
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater group ID"})
+		return models.RepeaterGroup{}, false
+	}
+	exists, err := models.RepeaterGroupIDExists(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error checking if repeater group exists: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking if repeater group exists"})
+		return models.RepeaterGroup{}, false
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repeater group does not exist"})
+		return models.RepeaterGroup{}, false
+	}
+	group, err := models.FindRepeaterGroupByID(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error finding repeater group: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding repeater group"})
+		return models.RepeaterGroup{}, false
+	}
+	return group, true
+}
+
+// talkgroupAllowed checks that a talkgroup exists and may be used by every repeater in the group
+func talkgroupAllowed(c *gin.Context, db *gorm.DB, talkgroupID uint, repeaters []models.Repeater) bool {
+	exists, err := models.TalkgroupIDExists(db, talkgroupID)
+	if err != nil {
+		logging.Errorf("Error checking if talkgroup %d exists: %v", talkgroupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding talkgroup"})
+		return false
+	}
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Talkgroup " + strconv.FormatUint(uint64(talkgroupID), 10) + " does not exist"})
+		return false
+	}
+	for _, repeater := range repeaters {
+		allowed, err := models.TalkgroupAllowsRepeater(db, talkgroupID, repeater.ID)
+		if err != nil {
+			logging.Errorf("Error checking talkgroup %d allowlist: %v", talkgroupID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding talkgroup"})
+			return false
+		}
+		if !allowed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Talkgroup " + strconv.FormatUint(uint64(talkgroupID), 10) + " is private"})
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package repeatergroups_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/repeatergroups"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/repeaters"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func makeRouter(t *testing.T) (*gin.Engine, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.AutoMigrate(&models.User{}, &models.Talkgroup{}, &models.TalkgroupAllowedRepeater{}, &models.Repeater{}, &models.RepeaterGroup{}, &models.ConfigVersion{})
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	_, redis := fakeredis.New(t)
+	router := testutils.ControllerRouter(db, redis, 1)
+	router.GET("/repeaters", repeaters.GETRepeaters)
+	router.DELETE("/repeatergroups/:id", repeatergroups.DELETERepeaterGroup)
+	router.POST("/repeatergroups/:id/repeaters", repeatergroups.POSTRepeaterGroupRepeaters)
+	router.POST("/repeatergroups/:id/talkgroups", repeatergroups.POSTRepeaterGroupTalkgroups)
+
+	db.Create(&models.User{ID: 1, Callsign: "N0CALL", Username: "n0call", Admin: true, Approved: true})
+	for _, id := range []uint{311001, 311002, 311003} {
+		repeater := models.Repeater{OwnerID: 1}
+		repeater.ID = id
+		if err := db.Create(&repeater).Error; err != nil {
+			t.Fatalf("Failed to create repeater: %v", err)
+		}
+	}
+	return router, db
+}
+
+func TestDeleteRepeaterGroup(t *testing.T) {
+	t.Parallel()
+	router, db := makeRouter(t)
+
+	if w := testutils.Do(t, router, http.MethodDelete, "/repeatergroups/42", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing group, got %d", w.Code)
+	}
+	if w := testutils.Do(t, router, http.MethodDelete, "/repeatergroups/abc", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid ID, got %d", w.Code)
+	}
+
+	group := models.RepeaterGroup{Name: "North"}
+	db.Create(&group)
+	path := fmt.Sprintf("/repeatergroups/%d", group.ID)
+	if w := testutils.Do(t, router, http.MethodDelete, path, nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected the group to be deleted, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := testutils.Do(t, router, http.MethodDelete, path, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 once the group is gone, got %d", w.Code)
+	}
+}
+
+func TestRepeaterGroupTalkgroupsValidated(t *testing.T) {
+	t.Parallel()
+	router, db := makeRouter(t)
+	db.Create(&models.Talkgroup{ID: 91, Name: "World-wide"})
+	db.Create(&models.Talkgroup{ID: 777, Name: "Club", Private: true})
+	db.Create(&models.TalkgroupAllowedRepeater{TalkgroupID: 777, RepeaterID: 311001})
+	group := models.RepeaterGroup{Name: "North"}
+	db.Create(&group)
+	path := fmt.Sprintf("/repeatergroups/%d", group.ID)
+	w := testutils.Do(t, router, http.MethodPost, path+"/repeaters", apimodels.RepeaterGroupRepeatersPost{RepeaterIDs: []uint{311001, 311002}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to set members: %d %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		name       string
+		talkgroups []models.Talkgroup
+		code       int
+	}{
+		{"missing talkgroup", []models.Talkgroup{{ID: 91}, {ID: 1234}}, http.StatusBadRequest},
+		{"zero talkgroup", []models.Talkgroup{{ID: 0}}, http.StatusBadRequest},
+		{"private to one member", []models.Talkgroup{{ID: 777}}, http.StatusBadRequest},
+		{"valid", []models.Talkgroup{{ID: 91}}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := testutils.Do(t, router, http.MethodPost, path+"/talkgroups", apimodels.RepeaterGroupTalkgroupsPost{TS2StaticTalkgroups: tt.talkgroups})
+		if w.Code != tt.code {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.code, w.Code, w.Body.String())
+		}
+	}
+
+	for _, id := range []uint{311001, 311002} {
+		repeater, err := models.FindRepeaterByID(db, id)
+		if err != nil {
+			t.Fatalf("Failed to find repeater: %v", err)
+		}
+		if len(repeater.TS2StaticTalkgroups) != 1 || repeater.TS2StaticTalkgroups[0].ID != 91 {
+			t.Errorf("Expected repeater %d to only have TG 91, got %+v", id, repeater.TS2StaticTalkgroups)
+		}
+	}
+	outside, _ := models.FindRepeaterByID(db, 311003)
+	if len(outside.TS2StaticTalkgroups) != 0 {
+		t.Error("Expected repeaters outside the group to be left alone")
+	}
+}
+
+func TestRepeatersFilteredByGroup(t *testing.T) {
+	t.Parallel()
+	router, db := makeRouter(t)
+	group := models.RepeaterGroup{Name: "North"}
+	db.Create(&group)
+	w := testutils.Do(t, router, http.MethodPost, fmt.Sprintf("/repeatergroups/%d/repeaters", group.ID), apimodels.RepeaterGroupRepeatersPost{RepeaterIDs: []uint{311002, 311003}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to set members: %d %s", w.Code, w.Body.String())
+	}
+
+	type list struct {
+		Total     int               `json:"total"`
+		Repeaters []models.Repeater `json:"repeaters"`
+	}
+	all := testutils.Decode[list](t, testutils.Do(t, router, http.MethodGet, "/repeaters", nil))
+	if all.Total != 3 || len(all.Repeaters) != 3 {
+		t.Errorf("Expected every repeater without a filter, got %+v", all)
+	}
+	filtered := testutils.Decode[list](t, testutils.Do(t, router, http.MethodGet, fmt.Sprintf("/repeaters?group=%d", group.ID), nil))
+	if filtered.Total != 2 || len(filtered.Repeaters) != 2 || filtered.Repeaters[0].ID != 311002 || filtered.Repeaters[1].ID != 311003 {
+		t.Errorf("Expected only the group's repeaters, got %+v", filtered)
+	}
+	if w := testutils.Do(t, router, http.MethodGet, "/repeaters?group=north", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid group, got %d", w.Code)
+	}
+}
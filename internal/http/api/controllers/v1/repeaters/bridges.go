@@ -0,0 +1,218 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package repeaters
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/events"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/repeaterlinks"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// GETRepeaterBridges lists the repeaters directly linked to a repeater
+func GETRepeaterBridges(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater ID"})
+		return
+	}
+
+	links, err := models.ListRepeaterLinks(db, uint(idUint64), time.Now())
+	if err != nil {
+		logging.Errorf("Error listing repeater links: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing repeater links"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"bridges": links})
+}
+
+// POSTRepeaterBridge bridges every call on a slot between this repeater and another.
+// The caller needs to be able to edit talkgroups on both repeaters.
+func POSTRepeaterBridge(c *gin.Context) {
+	session := sessions.Default(c)
+	userID, ok := session.Get("user_id").(uint)
+	if !ok {
+		logging.Error("userID cast failed")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	redis, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater ID"})
+		return
+	}
+	repeaterID := uint(idUint64)
+
+	var json apimodels.RepeaterLinkPost
+	err = validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTRepeaterBridge: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	if json.LinkedRepeaterID == repeaterID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A repeater can't be linked to itself"})
+		return
+	}
+
+	exists, err := models.RepeaterIDExists(db, json.LinkedRepeaterID)
+	if err != nil {
+		logging.Errorf("Error checking if repeater exists: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking if repeater exists"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Linked repeater does not exist"})
+		return
+	}
+
+	user, err := models.FindUserByID(db, userID)
+	if err != nil {
+		logging.Errorf("Error getting user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting user"})
+		return
+	}
+	allowed, err := models.UserCanManageRepeater(db, user, json.LinkedRepeaterID, models.RepeaterPermissionEditTalkgroups)
+	if err != nil {
+		logging.Errorf("Error checking permissions on repeater %d: %v", json.LinkedRepeaterID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking permissions"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to link the other repeater"})
+		return
+	}
+
+	slot := json.Slot == 2
+	now := time.Now()
+	linked, err := models.RepeatersLinked(db, repeaterID, json.LinkedRepeaterID, slot, now)
+	if err != nil {
+		logging.Errorf("Error checking repeater links: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking repeater links"})
+		return
+	}
+	if linked {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Repeaters are already linked on this slot"})
+		return
+	}
+
+	link := models.RepeaterLink{
+		RepeaterID:       repeaterID,
+		LinkedRepeaterID: json.LinkedRepeaterID,
+		TimeSlot:         slot,
+		CreatedByID:      userID,
+	}
+	if json.DurationMinutes > 0 {
+		expires := now.Add(time.Duration(json.DurationMinutes) * time.Minute)
+		link.ExpiresAt = &expires
+	}
+	err = db.Create(&link).Error
+	if err != nil {
+		logging.Errorf("Error creating repeater link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating repeater link"})
+		return
+	}
+	// The link is saved, so replicas that miss this announcement still pick it up when they restart
+	err = repeaterlinks.Notify(c, redis)
+	if err != nil {
+		logging.Errorf("Error announcing repeater link %d: %v", link.ID, err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Repeaters linked", "bridge": link})
+	events.Publish(c, redis, events.ConfigurationChanged, fmt.Sprintf("Repeater %d linked to repeater %d on TS%d", repeaterID, json.LinkedRepeaterID, json.Slot), gin.H{"repeater_id": repeaterID, "linked_repeater_id": json.LinkedRepeaterID, "slot": json.Slot})
+}
+
+// DELETERepeaterBridge tears down a direct link from either end
+func DELETERepeaterBridge(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	redis, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater ID"})
+		return
+	}
+	repeaterID := uint(idUint64)
+	linkID, err := strconv.ParseUint(c.Param("bridge_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bridge ID"})
+		return
+	}
+
+	link, found, err := models.FindRepeaterLink(db, repeaterID, uint(linkID))
+	if err != nil {
+		logging.Errorf("Error finding repeater link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding repeater link"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bridge does not exist"})
+		return
+	}
+	err = models.DeleteRepeaterLink(db, link.ID)
+	if err != nil {
+		logging.Errorf("Error deleting repeater link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting repeater link"})
+		return
+	}
+	err = repeaterlinks.Notify(c, redis)
+	if err != nil {
+		logging.Errorf("Error announcing repeater link %d removal: %v", link.ID, err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Repeaters unlinked"})
+	events.Publish(c, redis, events.ConfigurationChanged, fmt.Sprintf("Repeater %d unlinked from repeater %d", link.RepeaterID, link.LinkedRepeaterID), gin.H{"repeater_id": link.RepeaterID, "linked_repeater_id": link.LinkedRepeaterID})
+}
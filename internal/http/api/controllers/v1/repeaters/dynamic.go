@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package repeaters
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers/hbrp"
+	"github.com/USA-RedDragon/DMRHub/internal/events"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// POSTRepeaterDynamicLink changes a slot's dynamic talkgroup remotely, so a hotspot
+// can be moved to a talkgroup from the web UI instead of keying it up on RF
+func POSTRepeaterDynamicLink(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	redis, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	repeater, ok := findDynamicLinkRepeater(c, db)
+	if !ok {
+		return
+	}
+
+	var json apimodels.RepeaterDynamicLinkPost
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTRepeaterDynamicLink: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	talkgroup, err := models.FindTalkgroupByID(db, json.Talkgroup)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Talkgroup does not exist"})
+		return
+	}
+	if !talkgroupAllowed(c, db, talkgroup.ID, repeater.ID) {
+		return
+	}
+
+	changed, err := hbrp.GetSubscriptionManager(db).LinkDynamicTalkgroup(redis, &repeater, talkgroup, dmrconst.Timeslot(json.Slot))
+	if err != nil {
+		logging.Errorf("Error linking repeater %d to talkgroup %d: %v", repeater.ID, talkgroup.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error linking talkgroup"})
+		return
+	}
+	if !changed {
+		c.JSON(http.StatusOK, gin.H{"message": "Talkgroup already linked"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Talkgroup linked"})
+	events.Publish(c, redis, events.ConfigurationChanged, fmt.Sprintf("Repeater %d dynamically linked to talkgroup %d on TS%d", repeater.ID, talkgroup.ID, json.Slot), gin.H{"repeater_id": repeater.ID, "talkgroup_id": talkgroup.ID, "slot": json.Slot})
+}
+
+// POSTRepeaterDynamicUnlink clears a slot's dynamic talkgroup remotely
+func POSTRepeaterDynamicUnlink(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	redis, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	repeater, ok := findDynamicLinkRepeater(c, db)
+	if !ok {
+		return
+	}
+
+	var json apimodels.RepeaterDynamicUnlinkPost
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTRepeaterDynamicUnlink: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+
+	changed, err := hbrp.GetSubscriptionManager(db).UnlinkDynamicTalkgroup(redis, &repeater, dmrconst.Timeslot(json.Slot))
+	if err != nil {
+		logging.Errorf("Error unlinking repeater %d: %v", repeater.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unlinking talkgroup"})
+		return
+	}
+	if !changed {
+		c.JSON(http.StatusOK, gin.H{"message": "No talkgroup linked"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Talkgroup unlinked"})
+	events.Publish(c, redis, events.ConfigurationChanged, fmt.Sprintf("Repeater %d dynamically unlinked on TS%d", repeater.ID, json.Slot), gin.H{"repeater_id": repeater.ID, "slot": json.Slot})
+}
+
+func findDynamicLinkRepeater(c *gin.Context, db *gorm.DB) (models.Repeater, bool) {
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater ID"})
+		return models.Repeater{}, false
+	}
+	repeater, err := models.FindRepeaterByID(db, uint(idUint64))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repeater does not exist"})
+		return models.Repeater{}, false
+	}
+	return repeater, true
+}
@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package repeaters
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+type repeaterHealth struct {
+	Connected     bool                `json:"connected"`
+	LatencyMicros *int64              `json:"latency_us"`
+	Link          *servers.LinkStats  `json:"link"`
+	History       []servers.LinkStats `json:"history"`
+}
+
+// GETRepeaterHealth reports the network path to a repeater: its latency, measured when it
+// logged in, and the jitter of its keepalives and voice traffic, with a day of per-minute history
+func GETRepeaterHealth(c *gin.Context) {
+	redisClient, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater ID"})
+		return
+	}
+	repeaterID := uint(idUint64)
+	client := servers.MakeRedisClient(redisClient)
+
+	health := repeaterHealth{
+		Connected: client.RepeaterExists(c, repeaterID),
+		History:   []servers.LinkStats{},
+	}
+	if latency, ok := client.GetRepeaterLatency(c, repeaterID); ok {
+		micros := latency.Microseconds()
+		health.LatencyMicros = &micros
+	}
+	if link, ok := client.GetLinkStats(c, repeaterID); ok {
+		health.Link = &link
+	}
+	history, err := client.GetLinkHistory(c, repeaterID)
+	if err != nil {
+		logging.Errorf("Error getting link history for repeater %d: %v", repeaterID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting link history"})
+		return
+	}
+	health.History = append(health.History, history...)
+	c.JSON(http.StatusOK, health)
+}
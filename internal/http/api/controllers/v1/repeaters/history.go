@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package repeaters
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers/hbrp"
+	"github.com/USA-RedDragon/DMRHub/internal/events"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// GETRepeaterHistory lists the saved versions of a repeater's configuration, newest first
+func GETRepeaterHistory(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater ID"})
+		return
+	}
+	versions, err := models.ListConfigVersions(db, models.ConfigVersionRepeater, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error listing repeater configuration versions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing repeater configuration versions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"versions": versions, "total": len(versions)})
+}
+
+// POSTRepeaterHistoryRestore puts a repeater's configuration back to a saved version.
+// The restore is itself recorded as a new version, so it can be undone the same way.
+func POSTRepeaterHistoryRestore(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	redis, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater ID"})
+		return
+	}
+	versionUint64, err := strconv.ParseUint(c.Param("version"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+
+	repeater, err := models.FindRepeaterByID(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error finding repeater: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Repeater does not exist"})
+		return
+	}
+	version, err := models.FindConfigVersion(db, models.ConfigVersionRepeater, repeater.ID, uint(versionUint64))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version does not exist"})
+		return
+	} else if err != nil {
+		logging.Errorf("Error finding repeater configuration version: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding repeater configuration version"})
+		return
+	}
+	var snapshot models.RepeaterSnapshot
+	err = json.Unmarshal(version.Snapshot, &snapshot)
+	if err != nil {
+		logging.Errorf("Error decoding repeater configuration version: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error decoding repeater configuration version"})
+		return
+	}
+	// A repeater bound to a network that no longer exists could never log in again
+	if _, ok := config.GetConfig().Networks[snapshot.Network]; snapshot.Network != "" && !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The version's network is no longer configured"})
+		return
+	}
+
+	err = models.RestoreRepeaterVersion(db, &repeater, version)
+	if err != nil {
+		logging.Errorf("Error restoring repeater configuration version: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error restoring repeater configuration version"})
+		return
+	}
+	recordVersion(c, db, repeater.ID)
+	go hbrp.GetSubscriptionManager(db).ReloadRepeater(redis, repeater.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Repeater configuration restored"})
+	events.Publish(c, redis, events.ConfigurationChanged, fmt.Sprintf("Repeater %d restored to version %d", repeater.ID, version.Version), gin.H{"repeater_id": repeater.ID, "version": version.Version})
+}
+
+// recordVersion saves the repeater's configuration after a change made through the API.
+// The change has already been made by then, so a failure is logged rather than returned.
+func recordVersion(c *gin.Context, db *gorm.DB, repeaterID uint) {
+	userID, _ := sessions.Default(c).Get("user_id").(uint)
+	_, _, err := models.RecordRepeaterVersion(db, repeaterID, userID)
+	if err != nil {
+		logging.Errorf("Error recording configuration version of repeater %d: %v", repeaterID, err)
+	}
+}
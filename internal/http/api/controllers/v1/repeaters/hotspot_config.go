@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package repeaters
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/hotspotconfig"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxRecommendedTalkgroups caps the shared talkgroups suggested to a hotspot with no static talkgroups
+const maxRecommendedTalkgroups = 10
+
+// GETRepeaterHotspotConfig returns the settings for connecting a hotspot to the hub.
+// With ?format= it returns a single Pi-Star/WPSD configuration snippet as plain text.
+func GETRepeaterHotspotConfig(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater ID"})
+		return
+	}
+	repeater, err := models.FindRepeaterByID(db, uint(idUint64))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Repeater does not exist"})
+			return
+		}
+		logging.Errorf("Error finding repeater: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding repeater"})
+		return
+	}
+	shared, err := models.ListTalkgroupsByBridgeHint(db.Limit(maxRecommendedTalkgroups), models.BridgeHintShare)
+	if err != nil {
+		logging.Errorf("Error listing shared talkgroups: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing talkgroups"})
+		return
+	}
+	hotspot := hotspotconfig.New(config.GetConfig(), repeater, shared)
+
+	if format := c.Query("format"); format != "" {
+		snippet, err := hotspot.Render(format)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown format", "formats": hotspotconfig.Formats})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%d-%s.txt"`, repeater.ID, format))
+		c.String(http.StatusOK, snippet)
+		return
+	}
+
+	snippets := make(map[string]string, len(hotspotconfig.Formats))
+	for _, format := range hotspotconfig.Formats {
+		snippets[format], _ = hotspot.Render(format)
+	}
+	c.JSON(http.StatusOK, gin.H{"config": hotspot, "snippets": snippets})
+}
@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package repeaters
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+type repeaterOccupancy struct {
+	Resolution servers.OccupancyResolution `json:"resolution"`
+	TS1        []servers.OccupancySample   `json:"ts1"`
+	TS2        []servers.OccupancySample   `json:"ts2"`
+}
+
+// GETRepeaterOccupancy returns how many seconds per minute each of a repeater's time slots was busy,
+// newest first. ?resolution=hour returns 30 days of hourly averages instead of a day of minutes.
+func GETRepeaterOccupancy(c *gin.Context) {
+	redisClient, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater ID"})
+		return
+	}
+	repeaterID := uint(idUint64)
+
+	resolution := servers.OccupancyResolution(c.DefaultQuery("resolution", string(servers.OccupancyMinute)))
+	if resolution != servers.OccupancyMinute && resolution != servers.OccupancyHour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Resolution must be minute or hour"})
+		return
+	}
+
+	client := servers.MakeRedisClient(redisClient)
+	occupancy := repeaterOccupancy{Resolution: resolution}
+	occupancy.TS1, err = client.GetOccupancy(c, repeaterID, false, resolution)
+	if err == nil {
+		occupancy.TS2, err = client.GetOccupancy(c, repeaterID, true, resolution)
+	}
+	if err != nil {
+		logging.Errorf("Error getting occupancy for repeater %d: %v", repeaterID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting occupancy"})
+		return
+	}
+	c.JSON(http.StatusOK, occupancy)
+}
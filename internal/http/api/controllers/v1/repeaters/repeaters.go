@@ -29,10 +29,13 @@ import (
 	"github.com/USA-RedDragon/DMRHub/internal/db/models"
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers/hbrp"
+	"github.com/USA-RedDragon/DMRHub/internal/events"
 	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
 	"github.com/USA-RedDragon/DMRHub/internal/http/api/utils"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
 	"github.com/USA-RedDragon/DMRHub/internal/logging"
 	"github.com/USA-RedDragon/DMRHub/internal/repeaterdb"
+	"github.com/USA-RedDragon/DMRHub/internal/repeaterlinks"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
@@ -57,6 +60,15 @@ func GETRepeaters(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
 		return
 	}
+	if group := c.Query("group"); group != "" {
+		groupID, err := strconv.ParseUint(group, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater group ID"})
+			return
+		}
+		db = models.RepeatersInGroup(db, uint(groupID))
+		cDb = models.RepeatersInGroup(cDb, uint(groupID))
+	}
 	repeaters, err := models.ListRepeaters(db)
 	if err != nil {
 		logging.Errorf("Error getting repeaters: %v", err)
@@ -176,6 +188,14 @@ func DELETERepeater(c *gin.Context) {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Repeater deleted"})
+	if redis, ok := c.MustGet("Redis").(*redis.Client); ok {
+		// Deleting the repeater removed its links
+		err = repeaterlinks.Notify(c, redis)
+		if err != nil {
+			logging.Errorf("Error announcing repeater link changes: %v", err)
+		}
+		events.Publish(c, redis, events.ConfigurationChanged, fmt.Sprintf("Repeater %d deleted", idUint64), gin.H{"repeater_id": idUint64})
+	}
 }
 
 func POSTRepeaterTalkgroups(c *gin.Context) {
@@ -201,10 +221,10 @@ func POSTRepeaterTalkgroups(c *gin.Context) {
 	repeaterID := uint(rid)
 
 	var json apimodels.RepeaterTalkgroupsPost
-	err = c.ShouldBindJSON(&json)
+	err = validation.BindJSON(c, &json)
 	if err != nil {
 		logging.Errorf("POSTRepeaterTalkgroups: JSON data is invalid: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		validation.Respond(c, err)
 		return
 	}
 	repeaterExists, err := models.RepeaterIDExists(db, repeaterID)
@@ -226,6 +246,14 @@ func POSTRepeaterTalkgroups(c *gin.Context) {
 		return
 	}
 
+	talkgroups := append(append([]models.Talkgroup{}, json.TS1StaticTalkgroups...), json.TS2StaticTalkgroups...)
+	talkgroups = append(talkgroups, json.TS1DynamicTalkgroup, json.TS2DynamicTalkgroup)
+	for _, talkgroup := range talkgroups {
+		if talkgroup.ID != 0 && !talkgroupAllowed(c, db, talkgroup.ID, repeater.ID) {
+			return
+		}
+	}
+
 	err = db.Model(&repeater).Association("TS1StaticTalkgroups").Replace(json.TS1StaticTalkgroups)
 	if err != nil {
 		logging.Errorf("POSTRepeaterTalkgroups: Error updating TS1StaticTalkgroups: %v", err)
@@ -285,9 +313,11 @@ func POSTRepeaterTalkgroups(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving repeater"})
 		return
 	}
+	recordVersion(c, db, repeater.ID)
 	hbrp.GetSubscriptionManager(db).CancelAllRepeaterSubscriptions(repeater.ID)
 	go hbrp.GetSubscriptionManager(db).ListenForCalls(redis, repeater.ID)
 	c.JSON(http.StatusOK, gin.H{"message": "Repeater talkgroups updated"})
+	events.Publish(c, redis, events.ConfigurationChanged, fmt.Sprintf("Talkgroups on repeater %d updated", repeater.ID), gin.H{"repeater_id": repeater.ID})
 }
 
 func POSTRepeater(c *gin.Context) {
@@ -323,10 +353,10 @@ func POSTRepeater(c *gin.Context) {
 	}
 
 	var json apimodels.RepeaterPost
-	err = c.ShouldBindJSON(&json)
+	err = validation.BindJSON(c, &json)
 	if err != nil {
 		logging.Errorf("POSTRepeater: JSON data is invalid: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		validation.Respond(c, err)
 	} else {
 		var repeater models.Repeater
 
@@ -419,8 +449,19 @@ func POSTRepeater(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating repeater"})
 			return
 		}
+		template, ok, err := models.FindDefaultRepeaterTemplate(db)
+		if err != nil {
+			logging.Errorf("Error finding default repeater template: %v", err)
+		} else if ok {
+			_, err = models.ApplyRepeaterTemplate(db, &repeater, template)
+			if err != nil {
+				logging.Errorf("Error applying default template to repeater %d: %v", repeater.ID, err)
+			}
+		}
+		recordVersion(c, db, repeater.ID)
 		go hbrp.GetSubscriptionManager(db).ListenForCalls(redis, repeater.ID)
 		c.JSON(http.StatusOK, gin.H{"message": "Repeater created", "password": repeater.Password})
+		events.Publish(c, redis, events.ConfigurationChanged, fmt.Sprintf("Repeater %d created by %s", repeater.ID, user.Callsign), gin.H{"repeater_id": repeater.ID})
 	}
 }
 
@@ -487,6 +528,9 @@ func POSTRepeaterLink(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding talkgroup"})
 		return
 	}
+	if !talkgroupAllowed(c, db, talkgroup.ID, repeater.ID) {
+		return
+	}
 
 	switch linkType {
 	case LinkTypeDynamic:
@@ -527,6 +571,7 @@ func POSTRepeaterLink(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving repeater"})
 		return
 	}
+	recordVersion(c, db, repeater.ID)
 }
 
 //nolint:golint,gocyclo
@@ -706,5 +751,208 @@ func POSTRepeaterUnlink(c *gin.Context) {
 			}
 		}
 	}
+	recordVersion(c, db, repeater.ID)
 	c.JSON(http.StatusOK, gin.H{"message": "Timeslot unlinked"})
 }
+
+func GETRepeaterPermissions(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater ID"})
+		return
+	}
+	permissions, err := models.ListRepeaterPermissions(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error listing repeater permissions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing repeater permissions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"total": len(permissions), "permissions": permissions})
+}
+
+// POSTRepeaterPermission creates or replaces the permissions delegated to a user on a repeater
+func POSTRepeaterPermission(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater ID"})
+		return
+	}
+	repeaterID := uint(idUint64)
+
+	var json apimodels.RepeaterPermissionPost
+	err = validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTRepeaterPermission: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+
+	repeater, err := models.FindRepeaterByID(db, repeaterID)
+	if err != nil {
+		logging.Errorf("Error finding repeater: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Repeater does not exist"})
+		return
+	}
+	if repeater.OwnerID == json.UserID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User already owns this repeater"})
+		return
+	}
+	userExists, err := models.UserIDExists(db, json.UserID)
+	if err != nil {
+		logging.Errorf("Error checking if user exists: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking if user exists"})
+		return
+	}
+	if !userExists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User does not exist"})
+		return
+	}
+
+	permission, _, err := models.FindRepeaterPermission(db, repeaterID, json.UserID)
+	if err != nil {
+		logging.Errorf("Error finding repeater permission: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding repeater permission"})
+		return
+	}
+	permission.RepeaterID = repeaterID
+	permission.UserID = json.UserID
+	permission.EditTalkgroups = json.EditTalkgroups
+	permission.ViewStats = json.ViewStats
+	permission.RotatePassword = json.RotatePassword
+	err = db.Save(&permission).Error
+	if err != nil {
+		logging.Errorf("Error saving repeater permission: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving repeater permission"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Repeater permissions updated"})
+}
+
+func DELETERepeaterPermission(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater ID"})
+		return
+	}
+	userIDUint64, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	err = models.DeleteRepeaterPermission(db, uint(idUint64), uint(userIDUint64))
+	if err != nil {
+		logging.Errorf("Error deleting repeater permission: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting repeater permission"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Repeater permissions revoked"})
+}
+
+// POSTRepeaterPassword generates a new password for the repeater
+func POSTRepeaterPassword(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater ID"})
+		return
+	}
+	repeater, err := models.FindRepeaterByID(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error finding repeater: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Repeater does not exist"})
+		return
+	}
+
+	const randLen = 8
+	const randNum = 1
+	const randSpecial = 2
+	password, err := utils.RandomPassword(randLen, randNum, randSpecial)
+	if err != nil {
+		logging.Errorf("Failed to generate a repeater password %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate a repeater password"})
+		return
+	}
+	err = db.Model(&repeater).Update("password", password).Error
+	if err != nil {
+		logging.Errorf("Error saving repeater password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving repeater password"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Repeater password rotated", "password": password})
+}
+
+// POSTRepeaterTalkgroupProfile opts a hotspot in or out of the owner's talkgroup profile
+func POSTRepeaterTalkgroupProfile(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Errorf("Unable to get DB from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater ID"})
+		return
+	}
+
+	var json apimodels.RepeaterTalkgroupProfilePost
+	err = validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTRepeaterTalkgroupProfile: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+
+	repeater, err := models.FindRepeaterByID(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error finding repeater: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Repeater does not exist"})
+		return
+	}
+	err = db.Model(&repeater).Update("skip_talkgroup_profile", json.SkipTalkgroupProfile).Error
+	if err != nil {
+		logging.Errorf("Error saving repeater: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving repeater"})
+		return
+	}
+	recordVersion(c, db, repeater.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Repeater talkgroup profile setting updated"})
+}
+
+// talkgroupAllowed checks that a repeater is on a private talkgroup's allowlist, responding with an error if not
+func talkgroupAllowed(c *gin.Context, db *gorm.DB, talkgroupID uint, repeaterID uint) bool {
+	allowed, err := models.TalkgroupAllowsRepeater(db, talkgroupID, repeaterID)
+	if err != nil {
+		logging.Errorf("Error checking talkgroup %d allowlist: %v", talkgroupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding talkgroup"})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Talkgroup is private"})
+		return false
+	}
+	return true
+}
@@ -20,10 +20,90 @@
 package repeaters_test
 
 import (
+	"net/http"
 	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/repeaters"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
 )
 
-func TestNoop(t *testing.T) {
+// The hbrp subscription manager keeps the first database it sees, so this is the
+// only test in the package that links talkgroups
+func TestDynamicLink(t *testing.T) {
 	t.Parallel()
-	t.Log("Noop")
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The subscription manager's goroutines have to share the unnamed database's one connection
+	sqlDB.SetMaxOpenConns(1)
+	err = db.AutoMigrate(&models.User{}, &models.Talkgroup{}, &models.TalkgroupAllowedRepeater{}, &models.Repeater{})
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	db.Create(&models.User{ID: 1, Callsign: "N0CALL", Username: "n0call", Approved: true})
+	db.Create(&models.Talkgroup{ID: 3100, Name: "Public"})
+	db.Create(&models.Talkgroup{ID: 3101, Name: "Private", Private: true})
+	db.Create(&models.Talkgroup{ID: 3102, Name: "Allowed", Private: true})
+	for _, id := range []uint{311001, 311002} {
+		repeater := models.Repeater{OwnerID: 1}
+		repeater.ID = id
+		if err := db.Create(&repeater).Error; err != nil {
+			t.Fatalf("Failed to create repeater: %v", err)
+		}
+	}
+	db.Create(&models.TalkgroupAllowedRepeater{TalkgroupID: 3102, RepeaterID: 311001})
+
+	_, redis := fakeredis.New(t)
+	router := testutils.ControllerRouter(db, redis, 1)
+	router.POST("/repeaters/:id/link", repeaters.POSTRepeaterDynamicLink)
+	router.POST("/repeaters/:id/unlink", repeaters.POSTRepeaterDynamicUnlink)
+
+	tests := []struct {
+		name   string
+		path   string
+		body   any
+		status int
+		ts2    *uint
+	}{
+		{"missing repeater", "/repeaters/311099/link", apimodels.RepeaterDynamicLinkPost{Talkgroup: 3100, Slot: 2}, http.StatusNotFound, nil},
+		{"missing talkgroup", "/repeaters/311001/link", apimodels.RepeaterDynamicLinkPost{Talkgroup: 3199, Slot: 2}, http.StatusBadRequest, nil},
+		{"invalid slot", "/repeaters/311001/link", apimodels.RepeaterDynamicLinkPost{Talkgroup: 3100, Slot: 3}, http.StatusBadRequest, nil},
+		{"private talkgroup", "/repeaters/311002/link", apimodels.RepeaterDynamicLinkPost{Talkgroup: 3101, Slot: 2}, http.StatusBadRequest, nil},
+		{"not on the allowlist", "/repeaters/311002/link", apimodels.RepeaterDynamicLinkPost{Talkgroup: 3102, Slot: 2}, http.StatusBadRequest, nil},
+		{"public talkgroup", "/repeaters/311001/link", apimodels.RepeaterDynamicLinkPost{Talkgroup: 3100, Slot: 2}, http.StatusOK, ptr(3100)},
+		{"on the allowlist", "/repeaters/311001/link", apimodels.RepeaterDynamicLinkPost{Talkgroup: 3102, Slot: 2}, http.StatusOK, ptr(3102)},
+		{"unlink", "/repeaters/311001/unlink", apimodels.RepeaterDynamicUnlinkPost{Slot: 2}, http.StatusOK, nil},
+	}
+	for _, tt := range tests {
+		w := testutils.Do(t, router, http.MethodPost, tt.path, tt.body)
+		if w.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.status, w.Code, w.Body.String())
+			continue
+		}
+		var repeater models.Repeater
+		db.First(&repeater, 311001)
+		if (tt.ts2 == nil) != (repeater.TS2DynamicTalkgroupID == nil) ||
+			(tt.ts2 != nil && *tt.ts2 != *repeater.TS2DynamicTalkgroupID) {
+			t.Errorf("%s: expected TS2 linked to %v, got %v", tt.name, tt.ts2, repeater.TS2DynamicTalkgroupID)
+		}
+	}
+	var other models.Repeater
+	db.First(&other, 311002)
+	if other.TS2DynamicTalkgroupID != nil {
+		t.Errorf("Expected the rejected links to leave repeater 311002 alone, got %d", *other.TS2DynamicTalkgroupID)
+	}
+}
+
+func ptr(id uint) *uint {
+	return &id
 }
@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package repeaters
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers/hbrp"
+	"github.com/USA-RedDragon/DMRHub/internal/events"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// GETRepeaterSessions exports the login state of every connected repeater for disaster recovery.
+// The snapshot holds each repeater's address and login salt, so treat it like a secret.
+func GETRepeaterSessions(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	redisClient, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	snapshot, err := hbrp.ExportSessions(c, db, servers.MakeRedisClient(redisClient), time.Now())
+	if err != nil {
+		logging.Errorf("Error exporting repeater sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error exporting repeater sessions"})
+		return
+	}
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// POSTRepeaterSessions imports a snapshot from GETRepeaterSessions on a replacement instance,
+// so repeaters don't all have to notice the failure and log in again
+func POSTRepeaterSessions(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	redisClient, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	var json apimodels.RepeaterSessionSnapshot
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTRepeaterSessions: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+
+	restored, err := hbrp.ImportSessions(c, db, servers.MakeRedisClient(redisClient), json)
+	if err != nil {
+		// Sessions that could be restored were, report the rest
+		logging.Errorf("Error importing repeater sessions: %v", err)
+		c.JSON(http.StatusOK, gin.H{"message": "Repeater sessions partially imported", "restored": restored, "error": err.Error()})
+	} else {
+		c.JSON(http.StatusOK, gin.H{"message": "Repeater sessions imported", "restored": restored})
+	}
+	events.Publish(c, redisClient, events.ConfigurationChanged, fmt.Sprintf("Imported %d repeater sessions", restored), gin.H{"restored": restored, "taken_at": json.TakenAt})
+}
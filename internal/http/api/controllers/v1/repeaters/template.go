@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package repeaters
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers/hbrp"
+	"github.com/USA-RedDragon/DMRHub/internal/events"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// POSTRepeaterTemplate replaces a repeater's static talkgroups with a template's.
+// Only the talkgroups that changed are resubscribed, so calls on the rest carry on.
+func POSTRepeaterTemplate(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	redis, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater ID"})
+		return
+	}
+
+	var json apimodels.RepeaterTemplateApplyPost
+	err = validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTRepeaterTemplate: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	exists, err := models.RepeaterTemplateIDExists(db, json.TemplateID)
+	if err != nil {
+		logging.Errorf("Error checking if repeater template exists: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking if repeater template exists"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Repeater template does not exist"})
+		return
+	}
+	template, err := models.FindRepeaterTemplateByID(db, json.TemplateID)
+	if err != nil {
+		logging.Errorf("Error finding repeater template: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding repeater template"})
+		return
+	}
+	repeater, err := models.FindRepeaterByID(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error finding repeater: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Repeater does not exist"})
+		return
+	}
+
+	changes, err := models.ApplyRepeaterTemplate(db, &repeater, template)
+	if err != nil {
+		logging.Errorf("POSTRepeaterTemplate: Error updating static talkgroups: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating static talkgroups"})
+		return
+	}
+	recordVersion(c, db, repeater.ID)
+	go hbrp.GetSubscriptionManager(db).ReloadRepeater(redis, repeater.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Repeater template applied", "changes": changes})
+	events.Publish(c, redis, events.ConfigurationChanged, fmt.Sprintf("Template %s applied to repeater %d", template.Name, repeater.ID), gin.H{"repeater_id": repeater.ID, "template_id": template.ID})
+}
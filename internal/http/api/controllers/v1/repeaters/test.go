@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package repeaters
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers/hbrp"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// probeTimeout stays under the HTTP write timeout while covering a default 5 second keepalive interval
+const probeTimeout = 8 * time.Second
+
+// probeCooldown keeps owners from hammering a repeater with tests
+const probeCooldown = 30 * time.Second
+
+// POSTRepeaterTest checks that a repeater is still connected to the hub by waiting for its next keepalive
+func POSTRepeaterTest(c *gin.Context) {
+	redisClient, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater ID"})
+		return
+	}
+	repeaterID := uint(idUint64)
+
+	started, err := redisClient.SetNX(c, fmt.Sprintf("repeater:test:%d", repeaterID), time.Now().Unix(), probeCooldown).Result()
+	if err != nil {
+		logging.Errorf("Error starting connection test for repeater %d: %v", repeaterID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	if !started {
+		c.Header("Retry-After", strconv.Itoa(int(probeCooldown.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "A connection test was run recently, try again shortly"})
+		return
+	}
+
+	probe := hbrp.ProbeRepeater(c, servers.MakeRedisClient(redisClient), repeaterID, probeTimeout)
+	c.JSON(http.StatusOK, probe)
+}
@@ -0,0 +1,176 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package repeaters
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const defaultUptimeWindow = 30 * 24 * time.Hour
+
+// GETRepeaterUptime reports a repeater's availability and downtime incidents over a window
+func GETRepeaterUptime(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Errorf("Unable to get DB from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	repeaterID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Repeater ID"})
+		return
+	}
+	from, to, ok := parseUptimeWindow(c)
+	if !ok {
+		return
+	}
+	repeaterExists, err := models.RepeaterIDExists(db, uint(repeaterID))
+	if err != nil {
+		logging.Errorf("Error checking if repeater exists: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking if repeater exists"})
+		return
+	}
+	if !repeaterExists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Repeater does not exist"})
+		return
+	}
+	repeater, err := models.FindRepeaterByID(db, uint(repeaterID))
+	if err != nil {
+		logging.Errorf("Error getting repeater: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting repeater"})
+		return
+	}
+
+	uptime, err := models.GetRepeaterUptime(db, repeater, from, to, time.Now())
+	if err != nil {
+		logging.Errorf("Error computing uptime for repeater %d: %v", repeater.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error computing uptime"})
+		return
+	}
+	c.JSON(http.StatusOK, uptime)
+}
+
+// GETRepeatersUptime reports the availability of every repeater on the network.
+// Pass ?format=csv to download the report as a spreadsheet.
+func GETRepeatersUptime(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Errorf("Unable to get DB from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	from, to, ok := parseUptimeWindow(c)
+	if !ok {
+		return
+	}
+	repeaters, err := models.ListRepeaters(db)
+	if err != nil {
+		logging.Errorf("Error getting repeaters: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting repeaters"})
+		return
+	}
+
+	now := time.Now()
+	report := make([]models.RepeaterUptime, 0, len(repeaters))
+	for _, repeater := range repeaters {
+		uptime, err := models.GetRepeaterUptime(db, repeater, from, to, now)
+		if err != nil {
+			logging.Errorf("Error computing uptime for repeater %d: %v", repeater.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error computing uptime"})
+			return
+		}
+		report = append(report, uptime)
+	}
+
+	if c.Query("format") != "csv" {
+		c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "repeaters": report, "total": len(report)})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=uptime-%s-%s.csv", from.Format(time.DateOnly), to.Format(time.DateOnly)))
+	c.Header("Content-Type", "text/csv")
+	c.Status(http.StatusOK)
+	writer := csv.NewWriter(c.Writer)
+	const percentPrecision = 3
+	rows := [][]string{{"repeater_id", "callsign", "from", "to", "uptime_seconds", "downtime_seconds", "uptime_percent", "incidents"}}
+	for _, uptime := range report {
+		rows = append(rows, []string{
+			strconv.FormatUint(uint64(uptime.RepeaterID), 10),
+			uptime.Callsign,
+			uptime.From.Format(time.RFC3339),
+			uptime.To.Format(time.RFC3339),
+			strconv.FormatInt(int64(uptime.Uptime.Seconds()), 10),
+			strconv.FormatInt(int64(uptime.Downtime.Seconds()), 10),
+			strconv.FormatFloat(uptime.Percent, 'f', percentPrecision, 64),
+			strconv.Itoa(len(uptime.Incidents)),
+		})
+	}
+	err = writer.WriteAll(rows)
+	if err != nil {
+		logging.Errorf("Error writing uptime report: %v", err)
+	}
+}
+
+// parseUptimeWindow reads the report window from ?month=YYYY-MM or ?from= and ?to= as RFC3339.
+// The window defaults to the last 30 days.
+func parseUptimeWindow(c *gin.Context) (time.Time, time.Time, bool) {
+	to := time.Now()
+	from := to.Add(-defaultUptimeWindow)
+
+	if month := c.Query("month"); month != "" {
+		start, err := time.Parse("2006-01", month)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid month, expected YYYY-MM"})
+			return time.Time{}, time.Time{}, false
+		}
+		return start, start.AddDate(0, 1, 0), true
+	}
+
+	var err error
+	if fromQuery := c.Query("from"); fromQuery != "" {
+		from, err = time.Parse(time.RFC3339, fromQuery)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from time, expected RFC3339"})
+			return time.Time{}, time.Time{}, false
+		}
+	}
+	if toQuery := c.Query("to"); toQuery != "" {
+		to, err = time.Parse(time.RFC3339, toQuery)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to time, expected RFC3339"})
+			return time.Time{}, time.Time{}, false
+		}
+	}
+	if !to.After(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The end of the window must be after the start"})
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
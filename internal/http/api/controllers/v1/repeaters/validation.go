@@ -0,0 +1,254 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package repeaters
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/DMRHub/internal/bandplan"
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers/hbrp"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// GETRepeaterValidation checks a repeater's reported frequencies against the band plan and its expected color code
+func GETRepeaterValidation(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater ID"})
+		return
+	}
+	repeater, err := models.FindRepeaterByID(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error finding repeater: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Repeater does not exist"})
+		return
+	}
+	c.JSON(http.StatusOK, bandplan.Validate(repeater))
+}
+
+// GETRepeatersValidation lists every repeater whose configuration has problems, for coordinators
+func GETRepeatersValidation(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	var repeaters []models.Repeater
+	err := db.Order("id asc").Find(&repeaters).Error
+	if err != nil {
+		logging.Errorf("Error listing repeaters: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing repeaters"})
+		return
+	}
+
+	type repeaterValidation struct {
+		ID       uint   `json:"id"`
+		Callsign string `json:"callsign"`
+		bandplan.Result
+	}
+	invalid := []repeaterValidation{}
+	for _, repeater := range repeaters {
+		result := bandplan.Validate(repeater)
+		if !result.Valid {
+			invalid = append(invalid, repeaterValidation{ID: repeater.ID, Callsign: repeater.Callsign, Result: result})
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"repeaters": invalid, "total": len(invalid)})
+}
+
+// POSTRepeaterColorCode sets the color code a repeater is expected to report
+func POSTRepeaterColorCode(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater ID"})
+		return
+	}
+
+	var json apimodels.RepeaterColorCodePost
+	err = validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTRepeaterColorCode: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+
+	repeater, err := models.FindRepeaterByID(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error finding repeater: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Repeater does not exist"})
+		return
+	}
+	err = db.Model(&repeater).Select("expected_color_code").Updates(map[string]any{"expected_color_code": json.ColorCode}).Error
+	if err != nil {
+		logging.Errorf("Error saving repeater: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving repeater"})
+		return
+	}
+	recordVersion(c, db, repeater.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Repeater color code updated"})
+}
+
+// POSTRepeaterMaxDatagram sets the largest datagram sent to a repeater, taking effect when it next connects
+func POSTRepeaterMaxDatagram(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater ID"})
+		return
+	}
+
+	var json apimodels.MaxDatagramPost
+	err = validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTRepeaterMaxDatagram: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+
+	repeater, err := models.FindRepeaterByID(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error finding repeater: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Repeater does not exist"})
+		return
+	}
+	err = db.Model(&repeater).Update("max_datagram", json.MaxDatagram).Error
+	if err != nil {
+		logging.Errorf("Error saving repeater: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving repeater"})
+		return
+	}
+	recordVersion(c, db, repeater.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Repeater maximum datagram size updated"})
+}
+
+// POSTRepeaterKeepalive sets how often a repeater is expected to ping. A connected
+// repeater's ping timeout changes right away, without waiting for it to log in again.
+func POSTRepeaterKeepalive(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	redis, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater ID"})
+		return
+	}
+
+	var json apimodels.KeepalivePost
+	err = validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTRepeaterKeepalive: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+
+	repeater, err := models.FindRepeaterByID(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error finding repeater: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Repeater does not exist"})
+		return
+	}
+	err = db.Model(&repeater).Update("keepalive_interval", json.KeepaliveInterval).Error
+	if err != nil {
+		logging.Errorf("Error saving repeater: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving repeater"})
+		return
+	}
+	hbrp.SetKeepaliveInterval(c, servers.MakeRedisClient(redis), repeater.ID, json.KeepaliveInterval)
+	recordVersion(c, db, repeater.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Repeater keepalive interval updated"})
+}
+
+// POSTRepeaterNetwork binds a repeater to a named network, taking effect when it next logs in
+func POSTRepeaterNetwork(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater ID"})
+		return
+	}
+
+	var json apimodels.NetworkPost
+	err = validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTRepeaterNetwork: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	if _, ok := config.GetConfig().Networks[json.Network]; json.Network != "" && !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown network"})
+		return
+	}
+
+	repeater, err := models.FindRepeaterByID(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error finding repeater: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Repeater does not exist"})
+		return
+	}
+	err = db.Model(&repeater).Update("network", json.Network).Error
+	if err != nil {
+		logging.Errorf("Error saving repeater: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving repeater"})
+		return
+	}
+	recordVersion(c, db, repeater.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Repeater network updated"})
+}
@@ -0,0 +1,273 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package repeatertemplates
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func GETRepeaterTemplates(c *gin.Context) {
+	db, ok := c.MustGet("PaginatedDB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	cDb, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	templates, err := models.ListRepeaterTemplates(db)
+	if err != nil {
+		logging.Errorf("Error listing repeater templates: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing repeater templates"})
+		return
+	}
+
+	total, err := models.CountRepeaterTemplates(cDb)
+	if err != nil {
+		logging.Errorf("Error counting repeater templates: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting repeater templates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"total": total, "templates": templates})
+}
+
+// GETRepeaterTemplate returns a template in the same shape POSTRepeaterTemplate accepts, so it doubles as an export
+func GETRepeaterTemplate(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	template, ok := findTemplate(c, db)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, template)
+}
+
+func POSTRepeaterTemplate(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	var json apimodels.RepeaterTemplatePost
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTRepeaterTemplate: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+
+	ts1, ts2 := json.TS1StaticTalkgroups, json.TS2StaticTalkgroups
+	if json.RepeaterID != 0 {
+		exists, err := models.RepeaterIDExists(db, json.RepeaterID)
+		if err != nil {
+			logging.Errorf("Error checking if repeater exists: %s", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking if repeater exists"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Repeater does not exist"})
+			return
+		}
+		repeater, err := models.FindRepeaterByID(db, json.RepeaterID)
+		if err != nil {
+			logging.Errorf("Error finding repeater: %s", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding repeater"})
+			return
+		}
+		ts1, ts2 = repeater.TS1StaticTalkgroups, repeater.TS2StaticTalkgroups
+	}
+
+	template := models.RepeaterTemplate{
+		Name:        json.Name,
+		Description: json.Description,
+	}
+	template.TS1StaticTalkgroups, ok = checkTalkgroups(c, db, ts1)
+	if !ok {
+		return
+	}
+	template.TS2StaticTalkgroups, ok = checkTalkgroups(c, db, ts2)
+	if !ok {
+		return
+	}
+	err = db.Create(&template).Error
+	if err != nil {
+		logging.Errorf("Error creating repeater template: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating repeater template"})
+		return
+	}
+	if json.Default {
+		err = models.SetDefaultRepeaterTemplate(db, template.ID)
+		if err != nil {
+			logging.Errorf("Error setting default repeater template: %s", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error setting default repeater template"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Repeater template created", "id": template.ID})
+}
+
+func PATCHRepeaterTemplate(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	var json apimodels.RepeaterTemplatePatch
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("PATCHRepeaterTemplate: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	template, ok := findTemplate(c, db)
+	if !ok {
+		return
+	}
+
+	if json.Name != "" {
+		template.Name = json.Name
+	}
+	if json.Description != "" {
+		template.Description = json.Description
+	}
+	if json.TS1StaticTalkgroups != nil {
+		template.TS1StaticTalkgroups, ok = checkTalkgroups(c, db, *json.TS1StaticTalkgroups)
+		if !ok {
+			return
+		}
+	}
+	if json.TS2StaticTalkgroups != nil {
+		template.TS2StaticTalkgroups, ok = checkTalkgroups(c, db, *json.TS2StaticTalkgroups)
+		if !ok {
+			return
+		}
+	}
+	if json.Default != nil && !*json.Default {
+		template.IsDefault = false
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Omit("TS1StaticTalkgroups", "TS2StaticTalkgroups").Save(&template).Error
+		if err != nil {
+			return err //nolint:golint,wrapcheck
+		}
+		err = tx.Model(&template).Association("TS1StaticTalkgroups").Replace(template.TS1StaticTalkgroups)
+		if err != nil {
+			return err //nolint:golint,wrapcheck
+		}
+		err = tx.Model(&template).Association("TS2StaticTalkgroups").Replace(template.TS2StaticTalkgroups)
+		if err != nil {
+			return err //nolint:golint,wrapcheck
+		}
+		if json.Default != nil && *json.Default {
+			return models.SetDefaultRepeaterTemplate(tx, template.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		logging.Errorf("Error saving repeater template: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving repeater template"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Repeater template updated"})
+}
+
+func DELETERepeaterTemplate(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	template, ok := findTemplate(c, db)
+	if !ok {
+		return
+	}
+	err := models.DeleteRepeaterTemplate(db, template.ID)
+	if err != nil {
+		logging.Errorf("Error deleting repeater template: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting repeater template"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Repeater template deleted"})
+}
+
+func findTemplate(c *gin.Context, db *gorm.DB) (models.RepeaterTemplate, bool) {
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repeater template ID"})
+		return models.RepeaterTemplate{}, false
+	}
+	exists, err := models.RepeaterTemplateIDExists(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error checking if repeater template exists: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking if repeater template exists"})
+		return models.RepeaterTemplate{}, false
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repeater template does not exist"})
+		return models.RepeaterTemplate{}, false
+	}
+	template, err := models.FindRepeaterTemplateByID(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error finding repeater template: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding repeater template"})
+		return models.RepeaterTemplate{}, false
+	}
+	return template, true
+}
+
+// checkTalkgroups makes sure every talkgroup exists, so importing a template can't create placeholder talkgroups
+func checkTalkgroups(c *gin.Context, db *gorm.DB, talkgroups []models.Talkgroup) ([]models.Talkgroup, bool) {
+	checked := make([]models.Talkgroup, 0, len(talkgroups))
+	for _, tg := range talkgroups {
+		exists, err := models.TalkgroupIDExists(db, tg.ID)
+		if err != nil {
+			logging.Errorf("Error checking if talkgroup exists: %s", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking if talkgroup exists"})
+			return nil, false
+		}
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Talkgroup " + strconv.FormatUint(uint64(tg.ID), 10) + " does not exist"})
+			return nil, false
+		}
+		checked = append(checked, models.Talkgroup{ID: tg.ID})
+	}
+	return checked, true
+}
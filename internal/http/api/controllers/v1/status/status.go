@@ -0,0 +1,318 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package status
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/pubsub"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Component states reported on the status page
+const (
+	Operational = "operational"
+	Degraded    = "degraded"
+	Down        = "down"
+)
+
+// Resolved incidents older than this drop off the status page
+const incidentHistory = 90 * 24 * time.Hour
+const maxIncidents = 50
+
+// The status page is public and cheap to cache, so CDNs in front of it can absorb the load
+const statusCacheControl = "public, max-age=30, stale-while-revalidate=30"
+const healthCheckTimeout = 2 * time.Second
+
+// statusCacheTTL is how long a computed status is served before the health checks run again
+const statusCacheTTL = 5 * time.Second
+
+type component struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+type statusResponse struct {
+	Status             string            `json:"status"`
+	Components         []component       `json:"components"`
+	ConnectedRepeaters int               `json:"connected_repeaters"`
+	ActiveCalls        int64             `json:"active_calls"`
+	Incidents          []models.Incident `json:"incidents"`
+	GeneratedAt        time.Time         `json:"generated_at"`
+}
+
+// statusCache holds the last computed status. The lock is held while a new one is computed,
+// so a burst of requests runs the health checks once between them.
+var statusCache struct {
+	sync.Mutex
+	response *statusResponse
+	expires  time.Time
+}
+
+// invalidateStatus drops the cached status so incident changes show up on the next request
+func invalidateStatus() {
+	statusCache.Lock()
+	defer statusCache.Unlock()
+	statusCache.response = nil
+}
+
+// GETStatus summarizes the network's health for the public status page
+func GETStatus(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	redisClient, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	statusCache.Lock()
+	if statusCache.response == nil || time.Now().After(statusCache.expires) {
+		// Not tied to this request, the result is shared with everyone waiting on the lock
+		statusCache.response = buildStatus(context.WithoutCancel(c.Request.Context()), db, redisClient)
+		statusCache.expires = time.Now().Add(statusCacheTTL)
+	}
+	response := statusCache.response
+	statusCache.Unlock()
+
+	c.Header("Cache-Control", statusCacheControl)
+	c.JSON(http.StatusOK, response)
+}
+
+// buildStatus runs the health checks and gathers the figures shown on the status page
+func buildStatus(ctx context.Context, db *gorm.DB, redisClient *redis.Client) *statusResponse {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	response := &statusResponse{
+		Components:  []component{},
+		Incidents:   []models.Incident{},
+		GeneratedAt: time.Now(),
+	}
+
+	databaseStatus := Operational
+	sqlDB, err := db.DB()
+	if err != nil || sqlDB.PingContext(ctx) != nil {
+		databaseStatus = Down
+	}
+	response.Components = append(response.Components, component{Name: "database", Status: databaseStatus})
+
+	redisStatus := Operational
+	if redisClient.Ping(ctx).Err() != nil {
+		redisStatus = Down
+	} else if monitor := pubsub.Default(); monitor != nil && !monitor.Status().Healthy {
+		// Redis answered but messages are still being buffered from an outage
+		redisStatus = Degraded
+	}
+	response.Components = append(response.Components, component{Name: "redis", Status: redisStatus})
+
+	if redisStatus != Down {
+		repeaters, err := servers.MakeRedisClient(redisClient).ListRepeaters(ctx)
+		if err != nil {
+			logging.Errorf("Error listing connected repeaters: %v", err)
+		}
+		response.ConnectedRepeaters = len(repeaters)
+	}
+
+	if databaseStatus != Down {
+		err = db.WithContext(ctx).Model(&models.Call{}).Where("active = ?", true).Count(&response.ActiveCalls).Error
+		if err != nil {
+			logging.Errorf("Error counting active calls: %v", err)
+		}
+		incidents, err := models.ListRecentIncidents(db.WithContext(ctx), time.Now().Add(-incidentHistory), maxIncidents)
+		if err != nil {
+			logging.Errorf("Error listing incidents: %v", err)
+		} else {
+			response.Incidents = incidents
+		}
+	}
+
+	response.Status = overallStatus(response.Components, response.Incidents)
+	return response
+}
+
+// overallStatus is the worst component state, raised to degraded while an incident is open
+func overallStatus(components []component, incidents []models.Incident) string {
+	status := Operational
+	for _, component := range components {
+		switch component.Status {
+		case Down:
+			return Down
+		case Degraded:
+			status = Degraded
+		}
+	}
+	for _, incident := range incidents {
+		if incident.Status != models.IncidentResolved {
+			status = Degraded
+		}
+	}
+	return status
+}
+
+func POSTIncident(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	var json apimodels.IncidentPost
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTIncident: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	json.Title = strings.TrimSpace(json.Title)
+	if len(json.Title) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Title is required"})
+		return
+	}
+
+	incident := models.Incident{
+		Title:       json.Title,
+		Description: strings.TrimSpace(json.Description),
+		Status:      json.Status,
+	}
+	if incident.Status == "" {
+		incident.Status = models.IncidentInvestigating
+	}
+	if incident.Status == models.IncidentResolved {
+		now := time.Now()
+		incident.ResolvedAt = &now
+	}
+	err = db.Create(&incident).Error
+	if err != nil {
+		logging.Errorf("Error creating incident: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating incident"})
+		return
+	}
+	invalidateStatus()
+	c.JSON(http.StatusOK, gin.H{"message": "Incident created", "id": incident.ID})
+}
+
+func PATCHIncident(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	var json apimodels.IncidentPatch
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("PATCHIncident: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	incident, ok := findIncident(c, db)
+	if !ok {
+		return
+	}
+
+	if json.Title != nil {
+		title := strings.TrimSpace(*json.Title)
+		if len(title) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Title must be defined"})
+			return
+		}
+		incident.Title = title
+	}
+	if json.Description != nil {
+		incident.Description = strings.TrimSpace(*json.Description)
+	}
+	if json.Status != nil && *json.Status != incident.Status {
+		incident.Status = *json.Status
+		if incident.Status == models.IncidentResolved {
+			now := time.Now()
+			incident.ResolvedAt = &now
+		} else {
+			incident.ResolvedAt = nil
+		}
+	}
+
+	err = db.Save(&incident).Error
+	if err != nil {
+		logging.Errorf("Error saving incident: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving incident"})
+		return
+	}
+	invalidateStatus()
+	c.JSON(http.StatusOK, gin.H{"message": "Incident updated"})
+}
+
+func DELETEIncident(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	incident, ok := findIncident(c, db)
+	if !ok {
+		return
+	}
+	err := db.Delete(&incident).Error
+	if err != nil {
+		logging.Errorf("Error deleting incident: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting incident"})
+		return
+	}
+	invalidateStatus()
+	c.JSON(http.StatusOK, gin.H{"message": "Incident deleted"})
+}
+
+func findIncident(c *gin.Context, db *gorm.DB) (models.Incident, bool) {
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid incident ID"})
+		return models.Incident{}, false
+	}
+	incident, err := models.FindIncidentByID(db, uint(idUint64))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Incident does not exist"})
+		return models.Incident{}, false
+	}
+	if err != nil {
+		logging.Errorf("Error finding incident: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding incident"})
+		return models.Incident{}, false
+	}
+	return incident, true
+}
@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestOverallStatus(t *testing.T) {
+	t.Parallel()
+	healthy := []component{{Name: "database", Status: Operational}, {Name: "redis", Status: Operational}}
+	if status := overallStatus(healthy, nil); status != Operational {
+		t.Errorf("Expected operational, got %s", status)
+	}
+	resolved := []models.Incident{{Status: models.IncidentResolved}}
+	if status := overallStatus(healthy, resolved); status != Operational {
+		t.Errorf("Expected resolved incidents not to affect the status, got %s", status)
+	}
+	open := []models.Incident{{Status: models.IncidentMonitoring}}
+	if status := overallStatus(healthy, open); status != Degraded {
+		t.Errorf("Expected an open incident to degrade the status, got %s", status)
+	}
+	down := []component{{Name: "database", Status: Down}, {Name: "redis", Status: Degraded}}
+	if status := overallStatus(down, open); status != Down {
+		t.Errorf("Expected down, got %s", status)
+	}
+}
+
+// Not parallel, the status is cached for the whole package
+func TestStatusIsCached(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Call{}, &models.Incident{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	_, redis := fakeredis.New(t)
+	invalidateStatus()
+
+	get := func() statusResponse {
+		t.Helper()
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/status", nil)
+		c.Set("DB", db)
+		c.Set("Redis", redis)
+		GETStatus(c)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", w.Code)
+		}
+		var response statusResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return response
+	}
+
+	first := get()
+	if first.Status != Operational || len(first.Incidents) != 0 {
+		t.Fatalf("Expected an operational status without incidents, got %+v", first)
+	}
+
+	// Written behind the controller's back, so only the cache can explain it not showing up
+	db.Create(&models.Incident{Title: "Outage", Status: models.IncidentInvestigating})
+	second := get()
+	if !second.GeneratedAt.Equal(first.GeneratedAt) || len(second.Incidents) != 0 {
+		t.Errorf("Expected the cached status to be served, got %+v", second)
+	}
+
+	invalidateStatus()
+	third := get()
+	if len(third.Incidents) != 1 || third.Status != Degraded {
+		t.Errorf("Expected the open incident once the cache was dropped, got %+v", third)
+	}
+}
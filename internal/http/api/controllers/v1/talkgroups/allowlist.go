@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package talkgroups
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GETTalkgroupAllowedRepeaters lists the repeaters allowed on a private talkgroup
+func GETTalkgroupAllowedRepeaters(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid talkgroup ID"})
+		return
+	}
+	talkgroup, err := models.FindTalkgroupByID(db, uint(idUint64))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Talkgroup does not exist"})
+		return
+	}
+	ids, err := models.ListTalkgroupAllowedRepeaterIDs(db, talkgroup.ID)
+	if err != nil {
+		logging.Errorf("Error listing talkgroup allowed repeaters: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing allowed repeaters"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"private": talkgroup.Private, "repeater_ids": ids})
+}
+
+// POSTTalkgroupAllowedRepeaters replaces the repeaters allowed on a private talkgroup.
+// The allowlist is kept when a talkgroup is made public, so it can be made private again.
+func POSTTalkgroupAllowedRepeaters(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid talkgroup ID"})
+		return
+	}
+	var json apimodels.TalkgroupAllowedRepeatersPost
+	err = validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTTalkgroupAllowedRepeaters: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	exists, err := models.TalkgroupIDExists(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error finding talkgroup: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding talkgroup"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Talkgroup does not exist"})
+		return
+	}
+	seen := make(map[uint]bool, len(json.RepeaterIDs))
+	repeaterIDs := make([]uint, 0, len(json.RepeaterIDs))
+	for _, repeaterID := range json.RepeaterIDs {
+		if seen[repeaterID] {
+			continue
+		}
+		seen[repeaterID] = true
+		exists, err := models.RepeaterIDExists(db, repeaterID)
+		if err != nil {
+			logging.Errorf("Error finding repeater: %s", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding repeater"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Repeater %d does not exist", repeaterID)})
+			return
+		}
+		repeaterIDs = append(repeaterIDs, repeaterID)
+	}
+	err = models.SetTalkgroupAllowedRepeaters(db, uint(idUint64), repeaterIDs)
+	if err != nil {
+		logging.Errorf("Error saving talkgroup allowed repeaters: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving allowed repeaters"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Allowed repeaters updated"})
+}
+
+// sessionUser loads the logged in user, responding with an error if that fails
+func sessionUser(c *gin.Context, db *gorm.DB) (models.User, bool) {
+	uid, ok := sessions.Default(c).Get("user_id").(uint)
+	if !ok {
+		logging.Error("userID cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return models.User{}, false
+	}
+	user, err := models.FindUserByID(db, uid)
+	if err != nil {
+		logging.Errorf("Error finding user: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return models.User{}, false
+	}
+	return user, true
+}
+
+// talkgroupVisible checks that the logged in user may see a talkgroup, responding with a 404 if not.
+// Private talkgroups look the same as missing ones to users outside them.
+func talkgroupVisible(c *gin.Context, db *gorm.DB, talkgroupID uint) bool {
+	user, ok := sessionUser(c, db)
+	if !ok {
+		return false
+	}
+	visible, err := models.TalkgroupVisibleTo(db, talkgroupID, user)
+	if err != nil {
+		logging.Errorf("Error finding talkgroup: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding talkgroup"})
+		return false
+	}
+	if !visible {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Talkgroup does not exist"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package talkgroups
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/archive"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/events"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const archiveExportBatch = 1000
+
+// POSTTalkgroupArchive turns archival of a talkgroup's traffic on or off
+func POSTTalkgroupArchive(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid talkgroup ID"})
+		return
+	}
+	talkgroupID := uint(idUint64)
+
+	var req apimodels.TalkgroupArchivePost
+	err = validation.BindJSON(c, &req)
+	if err != nil {
+		logging.Errorf("POSTTalkgroupArchive: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	exists, err := models.TalkgroupIDExists(db, talkgroupID)
+	if err != nil {
+		logging.Errorf("Error checking if talkgroup exists: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking if talkgroup exists"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Talkgroup does not exist"})
+		return
+	}
+
+	err = db.Model(&models.Talkgroup{ID: talkgroupID}).Updates(map[string]interface{}{
+		"archive":         req.Enabled,
+		"archive_payload": req.Enabled && req.IncludePayload,
+	}).Error
+	if err != nil {
+		logging.Errorf("Error updating talkgroup archive: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating talkgroup archive"})
+		return
+	}
+	if archiver := archive.Default(); archiver != nil {
+		archiver.Forget(talkgroupID)
+	}
+
+	recordVersion(c, db, talkgroupID)
+	c.JSON(http.StatusOK, gin.H{"message": "Talkgroup archive updated"})
+	if redis, ok := c.MustGet("Redis").(*redis.Client); ok {
+		events.Publish(c, redis, events.ConfigurationChanged, fmt.Sprintf("Archive for talkgroup %d set to %t", talkgroupID, req.Enabled), nil)
+	}
+}
+
+// GETTalkgroupArchiveExport streams a talkgroup's archive as newline-delimited JSON, oldest first.
+// from and to are optional RFC 3339 times bounding when the bursts were received.
+func GETTalkgroupArchiveExport(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid talkgroup ID"})
+		return
+	}
+	from := time.Unix(0, 0)
+	to := time.Now()
+	if param := c.Query("from"); param != "" {
+		from, err = time.Parse(time.RFC3339, param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 time"})
+			return
+		}
+	}
+	if param := c.Query("to"); param != "" {
+		to, err = time.Parse(time.RFC3339, param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC 3339 time"})
+			return
+		}
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"talkgroup-%d-archive.ndjson\"", idUint64))
+	c.Status(http.StatusOK)
+	encoder := json.NewEncoder(c.Writer)
+	var batch []models.ArchiveRecord
+	err = models.ArchiveRecordsBetween(db, uint(idUint64), from, to).FindInBatches(&batch, archiveExportBatch, func(_ *gorm.DB, _ int) error {
+		for i := range batch {
+			if err := encoder.Encode(batch[i]); err != nil {
+				return err //nolint:golint,wrapcheck
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	}).Error
+	if err != nil {
+		// The status is already sent, so a truncated export is all that can be signalled
+		logging.Errorf("Error exporting archive for talkgroup %d: %v", idUint64, err)
+	}
+}
+
+// GETTalkgroupArchiveVerify checks a talkgroup's archive chain from its first record
+func GETTalkgroupArchiveVerify(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid talkgroup ID"})
+		return
+	}
+	result, err := models.VerifyArchive(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error verifying archive for talkgroup %d: %v", idUint64, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error verifying archive"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
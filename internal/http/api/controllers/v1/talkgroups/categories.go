@@ -0,0 +1,220 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package talkgroups
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// categoryFilter reads the optional category query parameter, responding with an error if it is invalid
+func categoryFilter(c *gin.Context) (uint, bool) {
+	category := c.Query("category")
+	if category == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseUint(category, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func GETTalkgroupCategories(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	categories, err := models.ListTalkgroupCategories(db)
+	if err != nil {
+		logging.Errorf("Error listing talkgroup categories: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing talkgroup categories"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"total": len(categories), "categories": categories})
+}
+
+func POSTTalkgroupCategory(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	var req apimodels.TalkgroupCategoryPost
+	err := validation.BindJSON(c, &req)
+	if err != nil {
+		logging.Errorf("POSTTalkgroupCategory: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	category := models.TalkgroupCategory{}
+	if !applyCategory(c, db, &category, req.Name, req.Description) {
+		return
+	}
+	c.JSON(http.StatusOK, category)
+}
+
+func PATCHTalkgroupCategory(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	category, ok := findCategory(c, db)
+	if !ok {
+		return
+	}
+	var req apimodels.TalkgroupCategoryPatch
+	err := validation.BindJSON(c, &req)
+	if err != nil {
+		logging.Errorf("PATCHTalkgroupCategory: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	name := category.Name
+	if req.Name != "" {
+		name = req.Name
+	}
+	description := category.Description
+	if req.Description != "" {
+		description = req.Description
+	}
+	if !applyCategory(c, db, &category, name, description) {
+		return
+	}
+	c.JSON(http.StatusOK, category)
+}
+
+func DELETETalkgroupCategory(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	category, ok := findCategory(c, db)
+	if !ok {
+		return
+	}
+	err := models.DeleteTalkgroupCategory(db, category.ID)
+	if err != nil {
+		logging.Errorf("Error deleting talkgroup category: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting talkgroup category"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Talkgroup category deleted"})
+}
+
+// POSTTalkgroupCategories replaces the categories a talkgroup is tagged with
+func POSTTalkgroupCategories(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid talkgroup ID"})
+		return
+	}
+	var req apimodels.TalkgroupCategoriesPost
+	err = validation.BindJSON(c, &req)
+	if err != nil {
+		logging.Errorf("POSTTalkgroupCategories: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	talkgroup, err := models.FindTalkgroupByID(db, uint(idUint64))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Talkgroup does not exist"})
+		return
+	} else if err != nil {
+		logging.Errorf("Error finding talkgroup: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding talkgroup"})
+		return
+	}
+	err = models.SetTalkgroupCategories(db, &talkgroup, req.CategoryIDs)
+	if errors.Is(err, models.ErrUnknownTalkgroupCategory) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Talkgroup category does not exist"})
+		return
+	} else if err != nil {
+		logging.Errorf("Error setting talkgroup categories: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error setting talkgroup categories"})
+		return
+	}
+	recordVersion(c, db, talkgroup.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Talkgroup categories updated"})
+}
+
+func findCategory(c *gin.Context, db *gorm.DB) (models.TalkgroupCategory, bool) {
+	idUint64, err := strconv.ParseUint(c.Param("category_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return models.TalkgroupCategory{}, false
+	}
+	category, err := models.FindTalkgroupCategoryByID(db, uint(idUint64))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Talkgroup category does not exist"})
+		return category, false
+	} else if err != nil {
+		logging.Errorf("Error finding talkgroup category: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding talkgroup category"})
+		return category, false
+	}
+	return category, true
+}
+
+// applyCategory validates and saves a category's name and description, responding with an error on failure
+func applyCategory(c *gin.Context, db *gorm.DB, category *models.TalkgroupCategory, name, description string) bool {
+	var count int64
+	err := db.Model(&models.TalkgroupCategory{}).Where("name = ? AND id != ?", name, category.ID).Count(&count).Error
+	if err != nil {
+		logging.Errorf("Error checking talkgroup category name: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving talkgroup category"})
+		return false
+	}
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Talkgroup category already exists"})
+		return false
+	}
+	category.Name = name
+	category.Description = description
+	err = db.Save(category).Error
+	if err != nil {
+		logging.Errorf("Error saving talkgroup category: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving talkgroup category"})
+		return false
+	}
+	return true
+}
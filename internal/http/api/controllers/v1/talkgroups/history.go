@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package talkgroups
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/DMRHub/internal/archive"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/events"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// GETTalkgroupHistory lists the saved versions of a talkgroup's configuration, newest first
+func GETTalkgroupHistory(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid talkgroup ID"})
+		return
+	}
+	versions, err := models.ListConfigVersions(db, models.ConfigVersionTalkgroup, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error listing talkgroup configuration versions: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing talkgroup configuration versions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"versions": versions, "total": len(versions)})
+}
+
+// POSTTalkgroupHistoryRestore puts a talkgroup's configuration back to a saved version.
+// The restore is itself recorded as a new version, so it can be undone the same way.
+func POSTTalkgroupHistoryRestore(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid talkgroup ID"})
+		return
+	}
+	versionUint64, err := strconv.ParseUint(c.Param("version"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+
+	talkgroup, err := models.FindTalkgroupByID(db, uint(idUint64))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Talkgroup does not exist"})
+		return
+	} else if err != nil {
+		logging.Errorf("Error finding talkgroup: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding talkgroup"})
+		return
+	}
+	version, err := models.FindConfigVersion(db, models.ConfigVersionTalkgroup, talkgroup.ID, uint(versionUint64))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version does not exist"})
+		return
+	} else if err != nil {
+		logging.Errorf("Error finding talkgroup configuration version: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding talkgroup configuration version"})
+		return
+	}
+
+	err = models.RestoreTalkgroupVersion(db, &talkgroup, version)
+	if err != nil {
+		logging.Errorf("Error restoring talkgroup configuration version: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error restoring talkgroup configuration version"})
+		return
+	}
+	if archiver := archive.Default(); archiver != nil {
+		archiver.Forget(talkgroup.ID)
+	}
+	recordVersion(c, db, talkgroup.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Talkgroup configuration restored"})
+	if redis, ok := c.MustGet("Redis").(*redis.Client); ok {
+		events.Publish(c, redis, events.ConfigurationChanged, fmt.Sprintf("Talkgroup %d restored to version %d", talkgroup.ID, version.Version), gin.H{"talkgroup_id": talkgroup.ID, "version": version.Version})
+	}
+}
+
+// recordVersion saves the talkgroup's configuration after a change made through the API.
+// The change has already been made by then, so a failure is logged rather than returned.
+func recordVersion(c *gin.Context, db *gorm.DB, talkgroupID uint) {
+	userID, _ := sessions.Default(c).Get("user_id").(uint)
+	_, _, err := models.RecordTalkgroupVersion(db, talkgroupID, userID)
+	if err != nil {
+		logging.Errorf("Error recording configuration version of talkgroup %d: %s", talkgroupID, err)
+	}
+}
@@ -20,21 +20,28 @@
 package talkgroups
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers/hbrp"
+	"github.com/USA-RedDragon/DMRHub/internal/events"
 	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	"github.com/USA-RedDragon/DMRHub/internal/jobs"
 	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/tgimport"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
 
-const maxNameLength = 20
-const maxDescriptionLength = 240
-
 func GETTalkgroups(c *gin.Context) {
 	db, ok := c.MustGet("PaginatedDB").(*gorm.DB)
 	if !ok {
@@ -48,6 +55,24 @@ func GETTalkgroups(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
 		return
 	}
+	category, ok := categoryFilter(c)
+	if !ok {
+		return
+	}
+	if category != 0 {
+		db = models.TalkgroupsInCategory(db, category)
+		cDb = models.TalkgroupsInCategory(cDb, category)
+	}
+	language := strings.TrimSpace(c.Query("language"))
+	region := strings.ToUpper(strings.TrimSpace(c.Query("region")))
+	db = models.TalkgroupsWithMetadata(db, language, region)
+	cDb = models.TalkgroupsWithMetadata(cDb, language, region)
+	user, ok := sessionUser(c, cDb)
+	if !ok {
+		return
+	}
+	db = models.VisibleTalkgroups(db, user)
+	cDb = models.VisibleTalkgroups(cDb, user)
 	talkgroups, err := models.ListTalkgroups(db)
 	if err != nil {
 		logging.Errorf("Error listing talkgroups: %s", err)
@@ -123,6 +148,9 @@ func GETTalkgroup(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid talkgroup ID"})
 		return
 	}
+	if !talkgroupVisible(c, db, uint(idInt)) {
+		return
+	}
 	talkgroup, err := models.FindTalkgroupByID(db, uint(idInt))
 	db.Preload("Admins").Preload("NCOs").Find(&talkgroup, "id = ?", id)
 	if err != nil {
@@ -133,6 +161,37 @@ func GETTalkgroup(c *gin.Context) {
 	c.JSON(http.StatusOK, talkgroup)
 }
 
+// GETTalkgroupListeners reports how many repeaters and web clients would hear a call on the talkgroup
+func GETTalkgroupListeners(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	redis, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid talkgroup ID"})
+		return
+	}
+	if !talkgroupVisible(c, db, uint(idUint64)) {
+		return
+	}
+	listeners, err := hbrp.CountTalkgroupListeners(c, db, servers.MakeRedisClient(redis), uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error counting talkgroup listeners: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting listeners"})
+		return
+	}
+	c.JSON(http.StatusOK, listeners)
+}
+
 func DELETETalkgroup(c *gin.Context) {
 	db, ok := c.MustGet("DB").(*gorm.DB)
 	if !ok {
@@ -152,6 +211,55 @@ func DELETETalkgroup(c *gin.Context) {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Talkgroup deleted"})
+	if redis, ok := c.MustGet("Redis").(*redis.Client); ok {
+		events.Publish(c, redis, events.ConfigurationChanged, fmt.Sprintf("Talkgroup %d deleted", idUint64), gin.H{"talkgroup_id": idUint64})
+	}
+}
+
+// GETPendingTalkgroups lists auto-created talkgroups waiting on admin approval
+func GETPendingTalkgroups(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	talkgroups, err := models.ListPendingTalkgroups(db)
+	if err != nil {
+		logging.Errorf("Error listing pending talkgroups: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing pending talkgroups"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"total": len(talkgroups), "talkgroups": talkgroups})
+}
+
+// POSTTalkgroupApprove lets calls be routed to an auto-created talkgroup
+func POSTTalkgroupApprove(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid talkgroup ID"})
+		return
+	}
+	result := db.Model(&models.Talkgroup{}).Where("id = ? AND pending_approval = ?", idUint64, true).Update("pending_approval", false)
+	if result.Error != nil {
+		logging.Errorf("Error approving talkgroup: %s", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error approving talkgroup"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Talkgroup is not pending approval"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Talkgroup approved"})
+	if redis, ok := c.MustGet("Redis").(*redis.Client); ok {
+		events.Publish(c, redis, events.ConfigurationChanged, fmt.Sprintf("Talkgroup %d approved", idUint64), gin.H{"talkgroup_id": idUint64})
+	}
 }
 
 func POSTTalkgroupNCOs(c *gin.Context) {
@@ -176,10 +284,10 @@ func POSTTalkgroupNCOs(c *gin.Context) {
 	}
 
 	var json apimodels.TalkgroupAdminAction
-	err = c.ShouldBindJSON(&json)
+	err = validation.BindJSON(c, &json)
 	if err != nil {
 		logging.Errorf("POSTTalkgroupNCOs: JSON data is invalid: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		validation.Respond(c, err)
 	} else {
 		if len(json.UserIDs) == 0 {
 			// remove all NCOs
@@ -195,6 +303,7 @@ func POSTTalkgroupNCOs(c *gin.Context) {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving talkgroup"})
 				return
 			}
+			recordVersion(c, db, talkgroup.ID)
 			c.JSON(http.StatusOK, gin.H{"message": "Talkgroup admins cleared"})
 			return
 		}
@@ -225,6 +334,7 @@ func POSTTalkgroupNCOs(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving talkgroup"})
 			return
 		}
+		recordVersion(c, db, talkgroup.ID)
 		c.JSON(http.StatusOK, gin.H{"message": "User appointed as net control operator"})
 	}
 }
@@ -251,10 +361,10 @@ func POSTTalkgroupAdmins(c *gin.Context) {
 	}
 
 	var json apimodels.TalkgroupAdminAction
-	err = c.ShouldBindJSON(&json)
+	err = validation.BindJSON(c, &json)
 	if err != nil {
 		logging.Errorf("POSTTalkgroupAdmins: JSON data is invalid: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		validation.Respond(c, err)
 	} else {
 		if len(json.UserIDs) == 0 {
 			// remove all Admins
@@ -270,6 +380,7 @@ func POSTTalkgroupAdmins(c *gin.Context) {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving talkgroup"})
 				return
 			}
+			recordVersion(c, db, talkgroup.ID)
 			c.JSON(http.StatusOK, gin.H{"message": "Talkgroup admins cleared"})
 			return
 		}
@@ -300,6 +411,7 @@ func POSTTalkgroupAdmins(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving talkgroup"})
 			return
 		}
+		recordVersion(c, db, talkgroup.ID)
 		c.JSON(http.StatusOK, gin.H{"message": "User appointed as admin"})
 	}
 }
@@ -318,10 +430,10 @@ func PATCHTalkgroup(c *gin.Context) {
 		return
 	}
 	var json apimodels.TalkgroupPatch
-	err = c.ShouldBindJSON(&json)
+	err = validation.BindJSON(c, &json)
 	if err != nil {
 		logging.Errorf("PATCHTalkgroup: JSON data is invalid: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		validation.Respond(c, err)
 	} else {
 		talkgroup, err := models.FindTalkgroupByID(db, uint(idInt))
 		if err != nil {
@@ -331,34 +443,29 @@ func PATCHTalkgroup(c *gin.Context) {
 		}
 
 		if json.Name != "" {
-			// Validate length less than 20 characters
-			if len(json.Name) > maxNameLength {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Name must be less than 20 characters"})
-				return
-			}
-			// Trim any whitespace
-			json.Name = strings.TrimSpace(json.Name)
-			// Check that length isn't 0
-			if len(json.Name) == 0 {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Name must be defined"})
-				return
-			}
 			talkgroup.Name = json.Name
 		}
 		if json.Description != "" {
-			// Validate length less than 240 characters
-			if len(json.Description) > maxDescriptionLength {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Description must be less than 240 characters"})
-				return
-			}
-			json.Description = strings.TrimSpace(json.Description)
-			// Check that length isn't 0
-			if len(json.Description) == 0 {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Description must be defined"})
-				return
-			}
 			talkgroup.Description = json.Description
 		}
+		if json.RetentionDays != nil {
+			talkgroup.RetentionDays = *json.RetentionDays
+		}
+		if json.Language != nil {
+			talkgroup.Language = *json.Language
+		}
+		if json.Region != nil {
+			talkgroup.Region = *json.Region
+		}
+		if json.BridgeHint != nil {
+			talkgroup.BridgeHint = models.BridgeHint(*json.BridgeHint)
+		}
+		if json.Private != nil {
+			talkgroup.Private = *json.Private
+		}
+		if json.CodecPolicy != nil {
+			talkgroup.CodecPolicy = models.CodecPolicy(*json.CodecPolicy)
+		}
 
 		err = db.Save(&talkgroup).Error
 		if err != nil {
@@ -366,6 +473,7 @@ func PATCHTalkgroup(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving talkgroup"})
 			return
 		}
+		recordVersion(c, db, talkgroup.ID)
 	}
 }
 
@@ -377,27 +485,11 @@ func POSTTalkgroup(c *gin.Context) {
 		return
 	}
 	var json apimodels.TalkgroupPost
-	err := c.ShouldBindJSON(&json)
+	err := validation.BindJSON(c, &json)
 	if err != nil {
 		logging.Errorf("POSTTalkgroup: JSON data is invalid: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		validation.Respond(c, err)
 	} else {
-		if json.Name == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
-			return
-		}
-		// Validate length less than 20 characters
-		if len(json.Name) > maxNameLength {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Name must be less than 20 characters"})
-			return
-		}
-		if json.Description != "" {
-			// Validate length less than 240 characters
-			if len(json.Description) > maxDescriptionLength {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Description must be less than 240 characters"})
-				return
-			}
-		}
 		// Validate json.ID is not already in use
 		exists, err := models.TalkgroupIDExists(db, json.ID)
 		if err != nil {
@@ -414,6 +506,11 @@ func POSTTalkgroup(c *gin.Context) {
 			ID:          json.ID,
 			Name:        json.Name,
 			Description: json.Description,
+			Language:    json.Language,
+			Region:      json.Region,
+			BridgeHint:  models.BridgeHint(json.BridgeHint),
+			Private:     json.Private,
+			CodecPolicy: models.CodecPolicy(json.CodecPolicy),
 		}
 
 		err = db.Create(&talkgroup).Error
@@ -422,6 +519,250 @@ func POSTTalkgroup(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating talkgroup"})
 			return
 		}
+		recordVersion(c, db, talkgroup.ID)
 		c.JSON(http.StatusOK, gin.H{"message": "Talkgroup created"})
 	}
 }
+
+func GETTalkgroupQuota(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid talkgroup ID"})
+		return
+	}
+	quota, ok, err := models.FindTalkgroupQuota(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error finding talkgroup quota: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding talkgroup quota"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Talkgroup has no quota"})
+		return
+	}
+	c.JSON(http.StatusOK, quota)
+}
+
+// POSTTalkgroupQuota creates or replaces the talk time quota on a talkgroup
+func POSTTalkgroupQuota(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid talkgroup ID"})
+		return
+	}
+	talkgroupID := uint(idUint64)
+
+	var json apimodels.TalkgroupQuotaPost
+	err = validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTTalkgroupQuota: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	if json.DailySeconds == 0 && json.MonthlySeconds == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A daily or monthly limit must be set"})
+		return
+	}
+
+	exists, err := models.TalkgroupIDExists(db, talkgroupID)
+	if err != nil {
+		logging.Errorf("Error checking if talkgroup exists: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking if talkgroup exists"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Talkgroup does not exist"})
+		return
+	}
+
+	quota, _, err := models.FindTalkgroupQuota(db, talkgroupID)
+	if err != nil {
+		logging.Errorf("Error finding talkgroup quota: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding talkgroup quota"})
+		return
+	}
+	quota.TalkgroupID = talkgroupID
+	quota.DailySeconds = json.DailySeconds
+	quota.MonthlySeconds = json.MonthlySeconds
+	quota.WarnPercent = json.WarnPercent
+	quota.Enforce = json.Enforce
+	err = db.Save(&quota).Error
+	if err != nil {
+		logging.Errorf("Error saving talkgroup quota: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving talkgroup quota"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Talkgroup quota saved"})
+	if redis, ok := c.MustGet("Redis").(*redis.Client); ok {
+		events.Publish(c, redis, events.ConfigurationChanged, fmt.Sprintf("Quota on talkgroup %d updated", talkgroupID), gin.H{"talkgroup_id": talkgroupID})
+	}
+}
+
+func DELETETalkgroupQuota(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid talkgroup ID"})
+		return
+	}
+	err = models.DeleteTalkgroupQuota(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error deleting talkgroup quota: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting talkgroup quota"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Talkgroup quota deleted"})
+}
+
+// GETTalkgroupQuotaUsage returns a user's usage of a talkgroup quota.
+// Without a user_id parameter, the logged in user's usage is returned.
+func GETTalkgroupQuotaUsage(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid talkgroup ID"})
+		return
+	}
+
+	var userID uint
+	if c.Param("user_id") != "" {
+		userIDUint64, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		userID = uint(userIDUint64)
+	} else {
+		session := sessions.Default(c)
+		uid, ok := session.Get("user_id").(uint)
+		if !ok {
+			logging.Error("userID cast failed")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			return
+		}
+		userID = uid
+	}
+
+	quota, ok, err := models.FindTalkgroupQuota(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error finding talkgroup quota: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding talkgroup quota"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Talkgroup has no quota"})
+		return
+	}
+
+	usage, err := quota.Usage(db, userID, time.Now())
+	if err != nil {
+		logging.Errorf("Error calculating talkgroup quota usage: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error calculating talkgroup quota usage"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"quota": quota, "usage": usage})
+}
+
+// POSTTalkgroupImport previews an import of talkgroups from an upstream network's
+// published list, or queues a job to apply it
+func POSTTalkgroupImport(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	var json apimodels.TalkgroupImportPost
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTTalkgroupImport: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+
+	switch {
+	case json.URL != "" && json.Data != "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only one of url or data may be provided"})
+		return
+	case json.URL != "":
+		if err := tgimport.ValidateURL(json.URL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	case json.Data == "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A url or data must be provided"})
+		return
+	}
+	if json.Format != tgimport.FormatJSON && json.Format != tgimport.FormatCSV {
+		c.JSON(http.StatusBadRequest, gin.H{"error": tgimport.ErrUnknownFormat.Error()})
+		return
+	}
+
+	if json.Apply {
+		// Applying runs as a job, so a slow upstream or a restart doesn't lose the import
+		userID, _ := sessions.Default(c).Get("user_id").(uint)
+		job, err := jobs.Enqueue(tgimport.ImportJob, tgimport.ImportRequest{
+			URL:    json.URL,
+			Data:   json.Data,
+			Format: json.Format,
+			UserID: userID,
+		})
+		if err != nil {
+			logging.Errorf("Error queueing talkgroup import: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error queueing talkgroup import"})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"message": "Talkgroup import queued", "job": job})
+		return
+	}
+
+	data := []byte(json.Data)
+	if json.URL != "" {
+		data, err = tgimport.Fetch(c, json.URL)
+		if errors.Is(err, tgimport.ErrForbiddenAddress) || errors.Is(err, tgimport.ErrListTooLarge) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			logging.Errorf("Error fetching talkgroup list from %s: %v", json.URL, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Error fetching talkgroup list"})
+			return
+		}
+	}
+
+	entries, err := tgimport.Parse(data, json.Format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	diff, err := tgimport.Preview(db, entries)
+	if err != nil {
+		logging.Errorf("Error previewing talkgroup import: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error previewing talkgroup import"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"diff": diff})
+}
@@ -0,0 +1,243 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package users
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// bulkSkip is a user a bulk action left alone, and why
+type bulkSkip struct {
+	ID     uint   `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// bulkResult describes the users a bulk action changed, or would change on a dry run
+type bulkResult struct {
+	DryRun   bool       `json:"dry_run"`
+	Affected []uint     `json:"affected"`
+	Count    int        `json:"count"`
+	Skipped  []bulkSkip `json:"skipped"`
+}
+
+// POSTUsersBulkApprove approves every pending user matching a filter
+func POSTUsersBulkApprove(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	var json apimodels.UserBulkApprovePost
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTUsersBulkApprove: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	users, err := models.FindUnapprovedUsersMatching(db, json.Filter)
+	if err != nil {
+		logging.Errorf("POSTUsersBulkApprove: Error finding users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding users"})
+		return
+	}
+	result := bulkResult{DryRun: json.DryRun, Affected: []uint{}, Skipped: []bulkSkip{}}
+	for _, user := range users {
+		result.Affected = append(result.Affected, user.ID)
+	}
+	applyBulk(c, db, result, "approved", true)
+}
+
+// POSTUsersBulkSuspend suspends a list of users, leaving admins and the Parrot user alone
+func POSTUsersBulkSuspend(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	fromUserID, ok := sessions.Default(c).Get("user_id").(uint)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not logged in"})
+		return
+	}
+	var json apimodels.UserBulkSuspendPost
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTUsersBulkSuspend: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	result, users, ok := bulkTargets(c, db, json.IDs, json.DryRun)
+	if !ok {
+		return
+	}
+	for _, user := range users {
+		switch {
+		case user.ID == fromUserID:
+			result.Skipped = append(result.Skipped, bulkSkip{ID: user.ID, Reason: "You cannot suspend yourself"})
+		case user.Admin || user.ID == dmrconst.SuperAdminUser:
+			result.Skipped = append(result.Skipped, bulkSkip{ID: user.ID, Reason: "You cannot suspend an admin"})
+		case user.ID == dmrconst.ParrotUser:
+			result.Skipped = append(result.Skipped, bulkSkip{ID: user.ID, Reason: "You cannot suspend the Parrot user"})
+		case user.Suspended:
+			result.Skipped = append(result.Skipped, bulkSkip{ID: user.ID, Reason: "Already suspended"})
+		default:
+			result.Affected = append(result.Affected, user.ID)
+		}
+	}
+	applyBulk(c, db, result, "suspended", true)
+}
+
+// POSTUsersBulkRole promotes or demotes a list of users
+func POSTUsersBulkRole(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	fromUserID, ok := sessions.Default(c).Get("user_id").(uint)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not logged in"})
+		return
+	}
+	var json apimodels.UserBulkRolePost
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTUsersBulkRole: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	admin := *json.Admin
+	result, users, ok := bulkTargets(c, db, json.IDs, json.DryRun)
+	if !ok {
+		return
+	}
+	for _, user := range users {
+		switch {
+		case user.ID == dmrconst.ParrotUser:
+			result.Skipped = append(result.Skipped, bulkSkip{ID: user.ID, Reason: "You cannot change the Parrot user's role"})
+		case !admin && (user.ID == fromUserID || user.ID == dmrconst.SuperAdminUser):
+			result.Skipped = append(result.Skipped, bulkSkip{ID: user.ID, Reason: "You cannot demote yourself or the super admin"})
+		case admin && !user.Approved:
+			result.Skipped = append(result.Skipped, bulkSkip{ID: user.ID, Reason: "You cannot promote an unapproved user"})
+		case user.Admin == admin:
+			result.Skipped = append(result.Skipped, bulkSkip{ID: user.ID, Reason: "Already has this role"})
+		default:
+			result.Affected = append(result.Affected, user.ID)
+		}
+	}
+	applyBulk(c, db, result, "admin", admin)
+}
+
+// GETUsersExport downloads every user as a CSV file
+func GETUsersExport(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=users-%s.csv", time.Now().Format(time.DateOnly)))
+	c.Header("Content-Type", "text/csv")
+	c.Status(http.StatusOK)
+	writer := csv.NewWriter(c.Writer)
+	err := writer.Write([]string{"id", "callsign", "username", "admin", "approved", "suspended", "listener", "created_at"})
+	if err != nil {
+		logging.Errorf("Error writing user export: %v", err)
+		return
+	}
+	const batchSize = 500
+	var users []models.User
+	err = db.Order("id asc").FindInBatches(&users, batchSize, func(_ *gorm.DB, _ int) error {
+		for _, user := range users {
+			err := writer.Write([]string{
+				strconv.FormatUint(uint64(user.ID), 10),
+				user.Callsign,
+				user.Username,
+				strconv.FormatBool(user.Admin),
+				strconv.FormatBool(user.Approved),
+				strconv.FormatBool(user.Suspended),
+				strconv.FormatBool(user.Listener),
+				user.CreatedAt.Format(time.RFC3339),
+			})
+			if err != nil {
+				return err //nolint:golint,wrapcheck
+			}
+		}
+		writer.Flush()
+		return writer.Error() //nolint:golint,wrapcheck
+	}).Error
+	if err != nil {
+		logging.Errorf("Error writing user export: %v", err)
+	}
+	writer.Flush()
+}
+
+// bulkTargets loads the users a bulk action names, reporting IDs that don't exist as skipped
+func bulkTargets(c *gin.Context, db *gorm.DB, ids []uint, dryRun bool) (bulkResult, []models.User, bool) {
+	result := bulkResult{DryRun: dryRun, Affected: []uint{}, Skipped: []bulkSkip{}}
+	users, err := models.FindUsersByIDs(db, ids)
+	if err != nil {
+		logging.Errorf("Error finding users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding users"})
+		return result, nil, false
+	}
+	found := make(map[uint]bool, len(users))
+	for _, user := range users {
+		found[user.ID] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			result.Skipped = append(result.Skipped, bulkSkip{ID: id, Reason: "User does not exist"})
+			found[id] = true
+		}
+	}
+	return result, users, true
+}
+
+// applyBulk sets a column on the affected users unless this is a dry run, then responds with the result
+func applyBulk(c *gin.Context, db *gorm.DB, result bulkResult, column string, value bool) {
+	result.Count = len(result.Affected)
+	if !result.DryRun {
+		_, err := models.UpdateUsers(db, result.Affected, column, value)
+		if err != nil {
+			logging.Errorf("Error updating users: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating users"})
+			return
+		}
+		logging.Logf("Bulk set %s=%t on %d users", column, value, result.Count)
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package users
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/events"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// DELETEUserData erases all call history and recordings for a DMR ID and
+// returns a report of what was removed, and of the archive records that were kept.
+// The DMR ID doesn't need an account, so data for unregistered callers can be erased too.
+func DELETEUserData(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	report, err := models.DeleteUserData(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("DELETEUserData: Error deleting data for %d: %v", idUint64, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting user data"})
+		return
+	}
+	logging.Logf("Deleted data for DMR ID %d: %d calls, %d missed calls, %d archive records retained", report.DMRID, report.CallsDeleted, report.MissedCallsDeleted, report.ArchiveRetained)
+	if redis, ok := c.MustGet("Redis").(*redis.Client); ok {
+		events.Publish(c, redis, events.UserDataDeleted, fmt.Sprintf("Call history for DMR ID %d was erased", report.DMRID), report)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User data deleted", "report": report})
+}
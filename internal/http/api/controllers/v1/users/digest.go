@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package users
+
+import (
+	"net/http"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GETUserDigest returns the user's activity digest subscription
+func GETUserDigest(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	session := sessions.Default(c)
+	uid, ok := session.Get("user_id").(uint)
+	if !ok {
+		logging.Error("userID cast failed")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+
+	subscription, found, err := models.FindDigestSubscription(db, uid)
+	if err != nil {
+		logging.Errorf("Error finding digest subscription: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding digest subscription"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusOK, gin.H{"subscribed": false, "available": config.GetConfig().EnableEmail})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"subscribed": true, "available": config.GetConfig().EnableEmail, "digest": subscription})
+}
+
+// PUTUserDigest subscribes the user to the activity digest or changes their subscription
+func PUTUserDigest(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	session := sessions.Default(c)
+	uid, ok := session.Get("user_id").(uint)
+	if !ok {
+		logging.Error("userID cast failed")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+	if !config.GetConfig().EnableEmail {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is not enabled on this network"})
+		return
+	}
+
+	var json apimodels.UserDigestPut
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("PUTUserDigest: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+
+	subscription, _, err := models.FindDigestSubscription(db, uid)
+	if err != nil {
+		logging.Errorf("Error finding digest subscription: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding digest subscription"})
+		return
+	}
+	subscription.UserID = uid
+	subscription.Email = json.Email
+	subscription.Frequency = models.DigestFrequency(json.Frequency)
+	err = db.Save(&subscription).Error
+	if err != nil {
+		logging.Errorf("Error saving digest subscription: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving digest subscription"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Digest subscription saved"})
+}
+
+// DELETEUserDigest unsubscribes the user from the activity digest
+func DELETEUserDigest(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	session := sessions.Default(c)
+	uid, ok := session.Get("user_id").(uint)
+	if !ok {
+		logging.Error("userID cast failed")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+
+	err := models.DeleteDigestSubscription(db, uid)
+	if err != nil {
+		logging.Errorf("Error deleting digest subscription: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting digest subscription"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Unsubscribed from digest"})
+}
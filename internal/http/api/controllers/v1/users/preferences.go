@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package users
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/notify"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GETUserPreferences returns which channels the user is notified on for each event
+func GETUserPreferences(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	preferences, err := models.FindNotificationPreferences(db, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error finding notification preferences: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding notification preferences"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"preferences": preferences, "email_available": config.GetConfig().EnableEmail})
+}
+
+// PUTUserPreferences replaces the user's notification preferences
+func PUTUserPreferences(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var json apimodels.UserPreferencesPut
+	err = validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("PUTUserPreferences: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	wantsEmail := json.MissedCall.Email || json.RepeaterOffline.Email || json.Quota.Email
+	wantsWebhook := json.MissedCall.Webhook || json.RepeaterOffline.Webhook || json.Quota.Webhook
+	if wantsEmail && !config.GetConfig().EnableEmail {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is not enabled on this network"})
+		return
+	}
+	if wantsEmail && json.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An email address is required for email notifications"})
+		return
+	}
+	if wantsWebhook && json.WebhookURL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A webhook URL is required for webhook notifications"})
+		return
+	}
+	if json.WebhookURL != "" && notify.ValidateWebhookURL(json.WebhookURL) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook URL must be an http or https URL"})
+		return
+	}
+
+	preferences := models.NotificationPreferences{
+		UserID:          uint(idUint64),
+		Email:           json.Email,
+		WebhookURL:      json.WebhookURL,
+		MissedCall:      json.MissedCall,
+		RepeaterOffline: json.RepeaterOffline,
+		Quota:           json.Quota,
+	}
+	err = db.Save(&preferences).Error
+	if err != nil {
+		logging.Errorf("Error saving notification preferences: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving notification preferences"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Notification preferences saved"})
+}
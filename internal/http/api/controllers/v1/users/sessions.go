@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package users
+
+import (
+	"net/http"
+	"strconv"
+
+	redisSessions "github.com/USA-RedDragon/DMRHub/internal/http/sessions"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// GETUserSessions lists a user's logged in web sessions
+func GETUserSessions(c *gin.Context) {
+	redis, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	userSessions, err := redisSessions.ListUserSessions(c, redis, uint(idUint64))
+	if err != nil {
+		logging.Errorf("Error listing sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing sessions"})
+		return
+	}
+	current, _ := sessions.Default(c).Get(redisSessions.UserSessionKey).(string)
+	c.JSON(http.StatusOK, gin.H{"sessions": userSessions, "current": current})
+}
+
+// DELETEUserSessions logs out all of a user's sessions. Users revoking their
+// own sessions stay logged in on the browser that asked.
+func DELETEUserSessions(c *gin.Context) {
+	redis, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	revoked, err := redisSessions.RevokeUserSessions(c, redis, uint(idUint64), keepSession(c, uint(idUint64)))
+	if err != nil {
+		logging.Errorf("Error revoking sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking sessions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked", "revoked": revoked})
+}
+
+// DELETEUserSession logs out one of a user's sessions
+func DELETEUserSession(c *gin.Context) {
+	redis, ok := c.MustGet("Redis").(*redis.Client)
+	if !ok {
+		logging.Error("Redis cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	found, err := redisSessions.RevokeUserSession(c, redis, uint(idUint64), c.Param("session_id"))
+	if err != nil {
+		logging.Errorf("Error revoking session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking session"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// keepSession returns the caller's session ID when they're acting on their own account
+func keepSession(c *gin.Context, userID uint) string {
+	session := sessions.Default(c)
+	if uid, ok := session.Get("user_id").(uint); !ok || uid != userID {
+		return ""
+	}
+	id, _ := session.Get(redisSessions.UserSessionKey).(string)
+	return id
+}
@@ -26,17 +26,24 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/USA-RedDragon/DMRHub/internal/captcha"
 	"github.com/USA-RedDragon/DMRHub/internal/config"
 	"github.com/USA-RedDragon/DMRHub/internal/db/models"
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/events"
 	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
 	"github.com/USA-RedDragon/DMRHub/internal/http/api/utils"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	redisSessions "github.com/USA-RedDragon/DMRHub/internal/http/sessions"
+	"github.com/USA-RedDragon/DMRHub/internal/i18n"
 	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/repeaterlinks"
 	"github.com/USA-RedDragon/DMRHub/internal/smtp"
 	"github.com/USA-RedDragon/DMRHub/internal/userdb"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	gopwned "github.com/mavjs/goPwned"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
 
@@ -78,28 +85,27 @@ func POSTUser(c *gin.Context) {
 		return
 	}
 	var json apimodels.UserRegistration
-	err := c.ShouldBindJSON(&json)
+	err := validation.BindJSON(c, &json)
 	if err != nil {
 		logging.Errorf("POSTUser: JSON data is invalid: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		validation.Respond(c, err)
 	} else {
-		if !userdb.IsValidUserID(json.DMRId) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "DMR ID is not valid"})
+		if !checkCaptcha(c, json.CaptchaToken) {
 			return
 		}
 		if !userdb.ValidUserCallsign(json.DMRId, json.Callsign) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Callsign does not match DMR ID"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Translate(c, "callsign_does_not_match")})
 			return
 		}
 		isValid, errString := json.IsValidUsername()
 		if !isValid {
-			c.JSON(http.StatusBadRequest, gin.H{"error": errString})
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Translate(c, errString)})
 			return
 		}
 
 		// Check that password isn't a zero string
 		if json.Password == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Password cannot be blank"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Translate(c, "password_blank")})
 			return
 		}
 
@@ -111,7 +117,7 @@ func POSTUser(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting user"})
 			return
 		} else if user.ID != 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Username is already taken"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Translate(c, "username_taken")})
 			return
 		}
 
@@ -123,50 +129,12 @@ func POSTUser(c *gin.Context) {
 			return
 		}
 		if exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "DMR ID is already registered"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Translate(c, "dmr_id_taken")})
 			return
 		}
 
-		if config.GetConfig().HIBPAPIKey != "" {
-			goPwned := gopwned.NewClient(nil, config.GetConfig().HIBPAPIKey)
-			h := sha1.New() //#nosec G401 -- False positive, we are not using this for crypto, just HIBP
-			h.Write([]byte(json.Password))
-			sha1HashedPW := fmt.Sprintf("%X", h.Sum(nil))
-			frange := sha1HashedPW[0:5]
-			lrange := sha1HashedPW[5:40]
-			karray, err := goPwned.GetPwnedPasswords(frange, false)
-			if err != nil {
-				// If the error message starts with "Too many requests", then tell the user to retry in one minute
-				if strings.HasPrefix(err.Error(), "Too many requests") {
-					c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests. Please try again in one minute"})
-					return
-				}
-				logging.Errorf("POSTUser: Error getting pwned passwords: %v", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting pwned passwords"})
-				return
-			}
-			strKArray := string(karray)
-			respArray := strings.Split(strKArray, "\r\n")
-
-			var result int64
-			for _, resp := range respArray {
-				strArray := strings.Split(resp, ":")
-				test := strArray[0]
-
-				count, err := strconv.ParseInt(strArray[1], 0, 32)
-				if err != nil {
-					logging.Errorf("POSTUser: Error parsing pwned password count: %v", err)
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Error parsing pwned password count"})
-					return
-				}
-				if test == lrange {
-					result = count
-				}
-			}
-			if result > 0 {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Password has been reported in a data breach. Please use another one"})
-				return
-			}
+		if !checkPasswordNotPwned(c, json.Password) {
+			return
 		}
 
 		// argon2 the password
@@ -187,12 +155,15 @@ func POSTUser(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating user"})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "User created, please wait for admin approval"})
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Translate(c, "user_created")})
+		if redis, ok := c.MustGet("Redis").(*redis.Client); ok {
+			events.Publish(c, redis, events.UserRegistered, fmt.Sprintf("%s (%d) registered and is awaiting approval", user.Callsign, user.ID), gin.H{"user_id": user.ID, "callsign": user.Callsign})
+		}
 		if config.GetConfig().EnableEmail {
 			err := smtp.Send(
 				config.GetConfig().AdminEmail,
-				"New user registration",
-				fmt.Sprintf("A new user has registered.<br><br>Username: %s<br>Callsign: %s<br>DMR ID: %d<br><br><a href=\"%s/admin/users/approval\">Click here</a> to see the approval dashboard", json.Username, strings.ToUpper(json.Callsign), json.DMRId, config.GetConfig().CanonicalHost),
+				i18n.T(i18n.Default(), "email_user_registered_subject"),
+				i18n.T(i18n.Default(), "email_user_registered_body", json.Username, strings.ToUpper(json.Callsign), json.DMRId, config.GetConfig().CanonicalHost),
 			)
 			if err != nil {
 				logging.Errorf("POSTUser: Error sending email: %v", err)
@@ -201,6 +172,94 @@ func POSTUser(c *gin.Context) {
 	}
 }
 
+// POSTListener registers a listener account. Listeners can use the dashboard
+// but have no DMR ID, so they can't own repeaters or be routed to.
+func POSTListener(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	var json apimodels.ListenerRegistration
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTListener: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+	if !checkCaptcha(c, json.CaptchaToken) {
+		return
+	}
+	isValid, errString := json.IsValidUsername()
+	if !isValid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Translate(c, errString)})
+		return
+	}
+	if json.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Translate(c, "password_blank")})
+		return
+	}
+	callsign := json.Callsign
+
+	var existing []models.User
+	err = db.Where("username = ?", json.Username).Limit(1).Find(&existing).Error
+	if err != nil {
+		logging.Errorf("POSTListener: Error getting user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting user"})
+		return
+	}
+	if len(existing) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Translate(c, "username_taken")})
+		return
+	}
+	if callsign != "" {
+		err = db.Where("callsign = ?", callsign).Limit(1).Find(&existing).Error
+		if err != nil {
+			logging.Errorf("POSTListener: Error getting user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting user"})
+			return
+		}
+		if len(existing) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Translate(c, "callsign_taken")})
+			return
+		}
+	}
+
+	if !checkPasswordNotPwned(c, json.Password) {
+		return
+	}
+
+	user := models.User{
+		Username: json.Username,
+		Password: utils.HashPassword(json.Password, config.GetConfig().PasswordSalt),
+		Callsign: callsign,
+		Listener: true,
+		Approved: false,
+		Admin:    false,
+	}
+	err = models.CreateListener(db, &user)
+	if err != nil {
+		logging.Errorf("POSTListener: Error creating user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating user"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": i18n.Translate(c, "listener_created")})
+	if redis, ok := c.MustGet("Redis").(*redis.Client); ok {
+		events.Publish(c, redis, events.UserRegistered, fmt.Sprintf("Listener %s registered and is awaiting approval", user.Username), gin.H{"user_id": user.ID, "callsign": user.Callsign, "listener": true})
+	}
+	if config.GetConfig().EnableEmail {
+		err := smtp.Send(
+			config.GetConfig().AdminEmail,
+			i18n.T(i18n.Default(), "email_listener_registered_subject"),
+			i18n.T(i18n.Default(), "email_listener_registered_body", user.Username, user.Callsign, config.GetConfig().CanonicalHost),
+		)
+		if err != nil {
+			logging.Errorf("POSTListener: Error sending email: %v", err)
+		}
+	}
+}
+
 func POSTUserDemote(c *gin.Context) {
 	db, ok := c.MustGet("DB").(*gorm.DB)
 	if !ok {
@@ -246,8 +305,8 @@ func POSTUserDemote(c *gin.Context) {
 	if config.GetConfig().EnableEmail {
 		err := smtp.Send(
 			config.GetConfig().AdminEmail,
-			"Admin user demotion",
-			fmt.Sprintf("An admin has been demoted.<br><br>Username: %s<br>Callsign: %s<br>DMR ID: %d", user.Username, strings.ToUpper(user.Callsign), user.ID),
+			i18n.T(i18n.Default(), "email_admin_demoted_subject"),
+			i18n.T(i18n.Default(), "email_admin_demoted_body", user.Username, strings.ToUpper(user.Callsign), user.ID),
 		)
 		if err != nil {
 			logging.Errorf("POSTUserDemote: Error sending email: %v", err)
@@ -298,8 +357,8 @@ func POSTUserPromote(c *gin.Context) {
 	if config.GetConfig().EnableEmail {
 		err := smtp.Send(
 			config.GetConfig().AdminEmail,
-			"Admin user promotion",
-			fmt.Sprintf("An admin has been promoted.<br><br>Username: %s<br>Callsign: %s<br>DMR ID: %d", user.Username, strings.ToUpper(user.Callsign), user.ID),
+			i18n.T(i18n.Default(), "email_admin_promoted_subject"),
+			i18n.T(i18n.Default(), "email_admin_promoted_body", user.Username, strings.ToUpper(user.Callsign), user.ID),
 		)
 		if err != nil {
 			logging.Errorf("POSTUserPromote: Error sending email: %v", err)
@@ -523,10 +582,10 @@ func PATCHUser(c *gin.Context) {
 		return
 	}
 	var json apimodels.UserPatch
-	err = c.ShouldBindJSON(&json)
+	err = validation.BindJSON(c, &json)
 	if err != nil {
 		logging.Errorf("PATCHUser: JSON data is invalid: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		validation.Respond(c, err)
 	} else {
 		user, err := models.FindUserByID(db, uint(idInt))
 		if err != nil {
@@ -536,11 +595,16 @@ func PATCHUser(c *gin.Context) {
 		}
 
 		if json.Callsign != "" {
+			if user.Listener {
+				// Listeners have no DMR ID to check a callsign against
+				c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Translate(c, "listener_callsign_locked")})
+				return
+			}
 			// Check DMR ID is in the database
 			if userdb.ValidUserCallsign(user.ID, json.Callsign) {
 				user.Callsign = strings.ToUpper(json.Callsign)
 			} else {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Callsign does not match DMR ID"})
+				c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Translate(c, "callsign_does_not_match")})
 				return
 			}
 		}
@@ -554,7 +618,7 @@ func PATCHUser(c *gin.Context) {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding user"})
 				return
 			} else if existingUser.ID != 0 {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Username is already taken"})
+				c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Translate(c, "username_taken")})
 				return
 			}
 			user.Username = json.Username
@@ -564,13 +628,44 @@ func PATCHUser(c *gin.Context) {
 			user.Password = utils.HashPassword(json.Password, config.GetConfig().PasswordSalt)
 		}
 
+		if json.Locale != "" {
+			if !i18n.IsSupported(json.Locale) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Translate(c, "locale_unsupported")})
+				return
+			}
+			user.Locale = json.Locale
+		}
+
 		err = db.Save(&user).Error
 		if err != nil {
 			logging.Errorf("Error updating user: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "User updated"})
+
+		if json.Locale != "" {
+			// Keep the locale in the user's own session current, see middleware.LocaleProvider
+			session := sessions.Default(c)
+			if uid, ok := session.Get("user_id").(uint); ok && uid == user.ID {
+				session.Set(i18n.SessionKey, user.Locale)
+				err = session.Save()
+				if err != nil {
+					logging.Errorf("Error saving locale to session: %v", err)
+				}
+				c.Set(i18n.ContextKey, user.Locale)
+			}
+		}
+
+		if json.Password != "" {
+			// A new password logs out everywhere else
+			if redis, ok := c.MustGet("Redis").(*redis.Client); ok {
+				_, err := redisSessions.RevokeUserSessions(c, redis, user.ID, keepSession(c, user.ID))
+				if err != nil {
+					logging.Errorf("Error revoking sessions after password change: %v", err)
+				}
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Translate(c, "user_updated")})
 	}
 }
 
@@ -605,6 +700,13 @@ func DELETEUser(c *gin.Context) {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+	if redis, ok := c.MustGet("Redis").(*redis.Client); ok {
+		// Deleting the user's repeaters removed their links
+		err = repeaterlinks.Notify(c, redis)
+		if err != nil {
+			logging.Errorf("Error announcing repeater link changes: %v", err)
+		}
+	}
 }
 
 func POSTUserSuspend(c *gin.Context) {
@@ -692,3 +794,256 @@ func GETUserSelf(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, user)
 }
+
+func GETUserTalkgroupProfile(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	session := sessions.Default(c)
+	uid, ok := session.Get("user_id").(uint)
+	if !ok {
+		logging.Error("userID cast failed")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+
+	profile, ok, err := models.FindTalkgroupProfileForUser(db, uid)
+	if err != nil {
+		logging.Errorf("Error finding talkgroup profile: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding talkgroup profile"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No talkgroup profile set"})
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// POSTUserTalkgroupProfile sets the static talkgroups applied to the user's hotspots when they connect
+func POSTUserTalkgroupProfile(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	session := sessions.Default(c)
+	uid, ok := session.Get("user_id").(uint)
+	if !ok {
+		logging.Error("userID cast failed")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+
+	var json apimodels.UserTalkgroupProfilePost
+	err := validation.BindJSON(c, &json)
+	if err != nil {
+		logging.Errorf("POSTUserTalkgroupProfile: JSON data is invalid: %v", err)
+		validation.Respond(c, err)
+		return
+	}
+
+	profile, _, err := models.FindTalkgroupProfileForUser(db, uid)
+	if err != nil {
+		logging.Errorf("Error finding talkgroup profile: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding talkgroup profile"})
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		profile.UserID = uid
+		if err := tx.Omit("TS1StaticTalkgroups", "TS2StaticTalkgroups").Save(&profile).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&profile).Association("TS1StaticTalkgroups").Replace(json.TS1StaticTalkgroups); err != nil {
+			return err
+		}
+		return tx.Model(&profile).Association("TS2StaticTalkgroups").Replace(json.TS2StaticTalkgroups)
+	})
+	if err != nil {
+		logging.Errorf("Error saving talkgroup profile: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving talkgroup profile"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Talkgroup profile saved"})
+}
+
+func DELETEUserTalkgroupProfile(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	session := sessions.Default(c)
+	uid, ok := session.Get("user_id").(uint)
+	if !ok {
+		logging.Error("userID cast failed")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+
+	err := models.DeleteTalkgroupProfileForUser(db, uid)
+	if err != nil {
+		logging.Errorf("Error deleting talkgroup profile: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting talkgroup profile"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Talkgroup profile deleted"})
+}
+
+// GETUserMissedCalls lists the private calls the user didn't return
+func GETUserMissedCalls(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	session := sessions.Default(c)
+	uid, ok := session.Get("user_id").(uint)
+	if !ok {
+		logging.Error("userID cast failed")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+
+	missedCalls, err := models.FindMissedCalls(db, uid)
+	if err != nil {
+		logging.Errorf("Error finding missed calls: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding missed calls"})
+		return
+	}
+	unseen, err := models.CountUnseenMissedCalls(db, uid)
+	if err != nil {
+		logging.Errorf("Error counting missed calls: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding missed calls"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"missed_calls": missedCalls, "total": len(missedCalls), "unseen": unseen})
+}
+
+// POSTUserMissedCallsSeen clears the user's unseen missed call badge
+func POSTUserMissedCallsSeen(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	session := sessions.Default(c)
+	uid, ok := session.Get("user_id").(uint)
+	if !ok {
+		logging.Error("userID cast failed")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+
+	err := models.MarkMissedCallsSeen(db, uid)
+	if err != nil {
+		logging.Errorf("Error marking missed calls seen: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating missed calls"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Missed calls marked as seen"})
+}
+
+// checkPasswordNotPwned rejects passwords that have appeared in a data breach, writing the error response if so
+// checkCaptcha verifies a registration's CAPTCHA when a provider is configured. Registration
+// fails closed if the provider can't be reached, since the CAPTCHA is there to stop bots.
+func checkCaptcha(c *gin.Context, token string) bool {
+	if config.GetConfig().CaptchaProvider == "" {
+		return true
+	}
+	verifier, err := captcha.NewVerifier(config.GetConfig().CaptchaProvider, config.GetConfig().CaptchaSecret)
+	if err != nil {
+		logging.Errorf("Error creating CAPTCHA verifier: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return false
+	}
+	ok, err := verifier.Verify(c.Request.Context(), token, c.ClientIP())
+	if err != nil {
+		logging.Errorf("Error verifying CAPTCHA: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Try again later"})
+		return false
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Translate(c, "captcha_failed")})
+		return false
+	}
+	return true
+}
+
+func checkPasswordNotPwned(c *gin.Context, password string) bool {
+	if config.GetConfig().HIBPAPIKey != "" {
+		goPwned := gopwned.NewClient(nil, config.GetConfig().HIBPAPIKey)
+		h := sha1.New() //#nosec G401 -- False positive, we are not using this for crypto, just HIBP
+		h.Write([]byte(password))
+		sha1HashedPW := fmt.Sprintf("%X", h.Sum(nil))
+		frange := sha1HashedPW[0:5]
+		lrange := sha1HashedPW[5:40]
+		karray, err := goPwned.GetPwnedPasswords(frange, false)
+		if err != nil {
+			// If the error message starts with "Too many requests", then tell the user to retry in one minute
+			if strings.HasPrefix(err.Error(), "Too many requests") {
+				c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests. Please try again in one minute"})
+				return false
+			}
+			logging.Errorf("Error getting pwned passwords: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting pwned passwords"})
+			return false
+		}
+		strKArray := string(karray)
+		respArray := strings.Split(strKArray, "\r\n")
+
+		var result int64
+		for _, resp := range respArray {
+			strArray := strings.Split(resp, ":")
+			test := strArray[0]
+
+			count, err := strconv.ParseInt(strArray[1], 0, 32)
+			if err != nil {
+				logging.Errorf("Error parsing pwned password count: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error parsing pwned password count"})
+				return false
+			}
+			if test == lrange {
+				result = count
+			}
+		}
+		if result > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Translate(c, "password_pwned")})
+			return false
+		}
+	}
+	return true
+}
+
+// GETUserAudioTests lists the results of the user's recent calls to the audio test talkgroup
+func GETUserAudioTests(c *gin.Context) {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("DB cast failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	session := sessions.Default(c)
+	uid, ok := session.Get("user_id").(uint)
+	if !ok {
+		logging.Error("userID cast failed")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+
+	tests, err := models.ListAudioTests(db, uid)
+	if err != nil {
+		logging.Errorf("Error finding audio tests: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding audio tests"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"audio_tests": tests, "total": len(tests), "talkgroup": dmrconst.AudioTestTalkgroup})
+}
@@ -23,15 +23,21 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
 	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/users"
 	"github.com/USA-RedDragon/DMRHub/internal/testutils"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+	"github.com/glebarez/sqlite"
 	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
 )
 
 const testTimeout = 1 * time.Minute
@@ -620,3 +626,111 @@ func TestDemoteUser(t *testing.T) {
 	assert.Equal(t, user.Username, userResp.Username)
 	assert.Equal(t, false, userResp.Admin)
 }
+
+func TestRegisterListener(t *testing.T) {
+	t.Parallel()
+
+	router, tdb := testutils.CreateTestDBRouter()
+	defer tdb.CloseRedis()
+	defer tdb.CloseDB()
+
+	// Listeners without a callsign get distinct placeholders
+	for _, username := range []string{"listener1", "listener2"} {
+		resp, w := testutils.RegisterListener(t, router, apimodels.ListenerRegistration{
+			Username: username,
+			Password: "password",
+		})
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, resp.Error)
+		assert.Equal(t, "Listener created, please wait for admin approval", resp.Message)
+	}
+
+	resp, w := testutils.RegisterListener(t, router, apimodels.ListenerRegistration{
+		Username: "listener1",
+		Password: "password",
+	})
+
+	assert.Equal(t, 400, w.Code)
+	assert.Empty(t, resp.Message)
+	assert.Equal(t, "Username is already taken", resp.Error)
+}
+
+func TestRevokeSessions(t *testing.T) {
+	t.Parallel()
+
+	router, tdb := testutils.CreateTestDBRouter()
+	defer tdb.CloseRedis()
+	defer tdb.CloseDB()
+
+	_, w, firstJar := testutils.LoginAdmin(t, router)
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, w, secondJar := testutils.LoginAdmin(t, router)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	admin, w := testutils.GetUserMe(t, router, firstJar)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	w = httptest.NewRecorder()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, fmt.Sprintf("/api/v1/users/%d/sessions", admin.ID), nil)
+	assert.NoError(t, err)
+	for _, cookie := range firstJar.Cookies() {
+		req.Header.Add("Cookie", cookie.String())
+	}
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The session that asked stays logged in, the other is logged out
+	_, w = testutils.GetUserMe(t, router, firstJar)
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, w = testutils.GetUserMe(t, router, secondJar)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestListenerAccounts(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&models.User{}))
+	db.Create(&models.User{ID: 3113113, Callsign: "N0CALL", Username: "n0call", Approved: true})
+	_, redis := fakeredis.New(t)
+	router := testutils.ControllerRouter(db, redis, 0)
+	router.POST("/users/listener", users.POSTListener)
+
+	w := testutils.Do(t, router, http.MethodPost, "/users/listener", apimodels.ListenerRegistration{
+		Username: "listener1",
+		Password: "password",
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = testutils.Do(t, router, http.MethodPost, "/users/listener", apimodels.ListenerRegistration{
+		Username: "listener2",
+		Password: "password",
+		Callsign: "KD0SWL",
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Callsigns belonging to another account are refused
+	w = testutils.Do(t, router, http.MethodPost, "/users/listener", apimodels.ListenerRegistration{
+		Username: "listener3",
+		Password: "password",
+		Callsign: "N0CALL",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var listeners []models.User
+	assert.NoError(t, db.Where("listener = ?", true).Order("id asc").Find(&listeners).Error)
+	if assert.Len(t, listeners, 2) {
+		assert.Equal(t, uint(models.ListenerIDBase), listeners[0].ID)
+		assert.Equal(t, "SWL-1", listeners[0].Callsign)
+		assert.Equal(t, uint(models.ListenerIDBase+1), listeners[1].ID)
+		assert.Equal(t, "KD0SWL", listeners[1].Callsign)
+		for _, listener := range listeners {
+			assert.False(t, listener.Approved)
+			assert.False(t, listener.Admin)
+			assert.NotEqual(t, "password", listener.Password)
+		}
+	}
+}
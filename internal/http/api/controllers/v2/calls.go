@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package v2
+
+import (
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/gin-gonic/gin"
+)
+
+// GETCalls lists the most recent calls on the network
+func GETCalls(c *gin.Context) {
+	db, ok := getDB(c, "PaginatedDB")
+	if !ok {
+		return
+	}
+	cDb, ok := getDB(c, "DB")
+	if !ok {
+		return
+	}
+	category, ok := categoryFilter(c)
+	if !ok {
+		return
+	}
+	if category != 0 {
+		db = models.CallsInTalkgroupCategory(db, category)
+		cDb = models.CallsInTalkgroupCategory(cDb, category)
+	}
+	respondPage(c, models.FindCalls(models.PublicCalls(db)), models.CountCalls(models.PublicCalls(cDb)))
+}
@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package v2
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/envelope"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func GETRepeaters(c *gin.Context) {
+	db, ok := getDB(c, "PaginatedDB")
+	if !ok {
+		return
+	}
+	cDb, ok := getDB(c, "DB")
+	if !ok {
+		return
+	}
+	repeaters, err := models.ListRepeaters(db)
+	if err != nil {
+		logging.Errorf("Error listing repeaters: %s", err)
+		fail(c, http.StatusInternalServerError, envelope.ErrorInternal, "Error listing repeaters")
+		return
+	}
+	total, err := models.CountRepeaters(cDb)
+	if err != nil {
+		logging.Errorf("Error counting repeaters: %s", err)
+		fail(c, http.StatusInternalServerError, envelope.ErrorInternal, "Error counting repeaters")
+		return
+	}
+	respondPage(c, repeaters, total)
+}
+
+func GETRepeater(c *gin.Context) {
+	db, ok := getDB(c, "DB")
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		fail(c, http.StatusBadRequest, envelope.ErrorBadRequest, "Invalid repeater ID")
+		return
+	}
+	repeater, err := models.FindRepeaterByID(db, uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		fail(c, http.StatusNotFound, envelope.ErrorNotFound, "Repeater not found")
+		return
+	} else if err != nil {
+		logging.Errorf("Error finding repeater: %s", err)
+		fail(c, http.StatusInternalServerError, envelope.ErrorInternal, "Error finding repeater")
+		return
+	}
+	respond(c, repeater)
+}
@@ -0,0 +1,182 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package v2
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/envelope"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// syncOverlap is subtracted from the next cursor so a write that committed while a sync was
+// running is picked up by the next one. Clients see those changes twice and apply them again.
+const syncOverlap = 5 * time.Second
+
+// SyncDeleted lists the IDs of objects deleted since the cursor
+type SyncDeleted struct {
+	Users      []uint `json:"users"`
+	Repeaters  []uint `json:"repeaters"`
+	Talkgroups []uint `json:"talkgroups"`
+	Calls      []uint `json:"calls"`
+}
+
+// SyncChanges is what changed since a client's cursor. When Reset is set the lists hold
+// everything the client can see and it should replace its cache instead of merging.
+type SyncChanges struct {
+	Cursor     string             `json:"cursor"`
+	Reset      bool               `json:"reset"`
+	Users      []models.User      `json:"users"`
+	Repeaters  []models.Repeater  `json:"repeaters"`
+	Talkgroups []models.Talkgroup `json:"talkgroups"`
+	Calls      []models.Call      `json:"calls"`
+	Deleted    SyncDeleted        `json:"deleted"`
+}
+
+// syncSince reads the cursor query parameter, reporting whether the client has to start over.
+// Cursors are opaque to clients, who only pass back the one from their last sync.
+func syncSince(c *gin.Context, now time.Time) (time.Time, bool, bool) {
+	cursor := c.Query("cursor")
+	if cursor == "" {
+		return time.Time{}, true, true
+	}
+	nanos, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil {
+		fail(c, http.StatusBadRequest, envelope.ErrorBadRequest, "Invalid cursor")
+		return time.Time{}, false, false
+	}
+	since := time.Unix(0, nanos)
+	if since.After(now) {
+		fail(c, http.StatusBadRequest, envelope.ErrorBadRequest, "Invalid cursor")
+		return time.Time{}, false, false
+	}
+	if since.Before(now.Add(-models.TombstoneTTL)) {
+		// Deletions this old have been forgotten
+		return time.Time{}, true, true
+	}
+	return since, false, true
+}
+
+// GETSync returns the users, repeaters, talkgroups, and recent calls the logged in user can see
+// that changed since the cursor from their last sync, along with what was deleted, so a client
+// can keep a local cache up to date. Admins sync every user and repeater, everyone else just
+// their own account and repeaters. Calls older than models.SyncCallWindow aren't synced, and
+// clients drop them along with any calls referring to a deleted user, repeater, or talkgroup.
+func GETSync(c *gin.Context) {
+	db, ok := getDB(c, "DB")
+	if !ok {
+		return
+	}
+	uid, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+	user, err := models.FindUserByID(db, uid)
+	if err != nil {
+		logging.Errorf("Error finding user: %v", err)
+		fail(c, http.StatusInternalServerError, envelope.ErrorInternal, "Error finding user")
+		return
+	}
+	now := time.Now()
+	since, reset, ok := syncSince(c, now)
+	if !ok {
+		return
+	}
+
+	changes, err := syncChanges(db, user, since, reset, now)
+	if err != nil {
+		logging.Errorf("Error syncing changes for user %d: %v", uid, err)
+		fail(c, http.StatusInternalServerError, envelope.ErrorInternal, "Error syncing changes")
+		return
+	}
+	changes.Cursor = strconv.FormatInt(now.Add(-syncOverlap).UnixNano(), 10)
+	respond(c, changes)
+}
+
+// emptyIfNil keeps lists in the response arrays, never null
+func emptyIfNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
+
+func syncChanges(db *gorm.DB, user models.User, since time.Time, reset bool, now time.Time) (SyncChanges, error) {
+	changes := SyncChanges{Reset: reset}
+	changed := func() *gorm.DB { return db.Where("updated_at >= ?", since) }
+	var err error
+
+	if user.Admin {
+		changes.Users, err = models.ListUsers(changed().Order("id asc"))
+		if err == nil {
+			changes.Repeaters, err = models.ListRepeaters(changed())
+		}
+	} else {
+		changes.Users, err = models.ListUsers(changed().Where("id = ?", user.ID))
+		if err == nil {
+			changes.Repeaters, err = models.GetUserRepeaters(changed(), user.ID)
+		}
+	}
+	if err != nil {
+		return changes, err
+	}
+	changes.Talkgroups, err = models.ListTalkgroups(models.VisibleTalkgroups(changed(), user))
+	if err != nil {
+		return changes, err
+	}
+	changes.Calls = models.FindCalls(models.VisibleCalls(changed(), user).Where("start_time >= ?", now.Add(-models.SyncCallWindow)))
+
+	// A client starting over has nothing to delete
+	if !reset {
+		if user.Admin {
+			changes.Deleted.Users, err = models.ListTombstones(db, models.TombstoneUser, since)
+			if err != nil {
+				return changes, err
+			}
+		}
+		changes.Deleted.Repeaters, err = models.ListTombstones(db, models.TombstoneRepeater, since)
+		if err != nil {
+			return changes, err
+		}
+		changes.Deleted.Talkgroups, err = models.ListTombstones(db, models.TombstoneTalkgroup, since)
+		if err != nil {
+			return changes, err
+		}
+		changes.Deleted.Calls, err = models.ListTombstones(db, models.TombstoneCall, since)
+		if err != nil {
+			return changes, err
+		}
+	}
+
+	changes.Users = emptyIfNil(changes.Users)
+	changes.Repeaters = emptyIfNil(changes.Repeaters)
+	changes.Talkgroups = emptyIfNil(changes.Talkgroups)
+	changes.Calls = emptyIfNil(changes.Calls)
+	changes.Deleted.Users = emptyIfNil(changes.Deleted.Users)
+	changes.Deleted.Repeaters = emptyIfNil(changes.Deleted.Repeaters)
+	changes.Deleted.Talkgroups = emptyIfNil(changes.Deleted.Talkgroups)
+	changes.Deleted.Calls = emptyIfNil(changes.Deleted.Calls)
+	return changes, nil
+}
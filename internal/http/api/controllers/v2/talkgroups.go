@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package v2
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/envelope"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func GETTalkgroups(c *gin.Context) {
+	db, ok := getDB(c, "PaginatedDB")
+	if !ok {
+		return
+	}
+	cDb, ok := getDB(c, "DB")
+	if !ok {
+		return
+	}
+	category, ok := categoryFilter(c)
+	if !ok {
+		return
+	}
+	if category != 0 {
+		db = models.TalkgroupsInCategory(db, category)
+		cDb = models.TalkgroupsInCategory(cDb, category)
+	}
+	language := strings.TrimSpace(c.Query("language"))
+	region := strings.ToUpper(strings.TrimSpace(c.Query("region")))
+	db = models.TalkgroupsWithMetadata(db, language, region)
+	cDb = models.TalkgroupsWithMetadata(cDb, language, region)
+	user, ok := sessionUser(c, cDb)
+	if !ok {
+		return
+	}
+	db = models.VisibleTalkgroups(db, user)
+	cDb = models.VisibleTalkgroups(cDb, user)
+	talkgroups, err := models.ListTalkgroups(db)
+	if err != nil {
+		logging.Errorf("Error listing talkgroups: %s", err)
+		fail(c, http.StatusInternalServerError, envelope.ErrorInternal, "Error listing talkgroups")
+		return
+	}
+	total, err := models.CountTalkgroups(cDb)
+	if err != nil {
+		logging.Errorf("Error counting talkgroups: %s", err)
+		fail(c, http.StatusInternalServerError, envelope.ErrorInternal, "Error counting talkgroups")
+		return
+	}
+	respondPage(c, talkgroups, total)
+}
+
+func GETTalkgroup(c *gin.Context) {
+	db, ok := getDB(c, "DB")
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		fail(c, http.StatusBadRequest, envelope.ErrorBadRequest, "Invalid talkgroup ID")
+		return
+	}
+	user, ok := sessionUser(c, db)
+	if !ok {
+		return
+	}
+	talkgroup, err := models.FindTalkgroupByID(models.VisibleTalkgroups(db, user), uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		fail(c, http.StatusNotFound, envelope.ErrorNotFound, "Talkgroup not found")
+		return
+	} else if err != nil {
+		logging.Errorf("Error finding talkgroup: %s", err)
+		fail(c, http.StatusInternalServerError, envelope.ErrorInternal, "Error finding talkgroup")
+		return
+	}
+	respond(c, talkgroup)
+}
@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package v2
+
+import (
+	"net/http"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/envelope"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+)
+
+func GETMe(c *gin.Context) {
+	db, ok := getDB(c, "DB")
+	if !ok {
+		return
+	}
+	uid, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+	user, err := models.FindUserByID(db, uid)
+	if err != nil {
+		logging.Errorf("Error finding user: %v", err)
+		fail(c, http.StatusInternalServerError, envelope.ErrorInternal, "Error finding user")
+		return
+	}
+	respond(c, user)
+}
+
+func GETMyRepeaters(c *gin.Context) {
+	db, ok := getDB(c, "PaginatedDB")
+	if !ok {
+		return
+	}
+	cDb, ok := getDB(c, "DB")
+	if !ok {
+		return
+	}
+	uid, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+	repeaters, err := models.GetUserRepeaters(db, uid)
+	if err != nil {
+		logging.Errorf("Error getting repeaters owned by user %d: %v", uid, err)
+		fail(c, http.StatusInternalServerError, envelope.ErrorInternal, "Error getting repeaters")
+		return
+	}
+	total, err := models.CountUserRepeaters(cDb, uid)
+	if err != nil {
+		logging.Errorf("Error counting repeaters owned by user %d: %v", uid, err)
+		fail(c, http.StatusInternalServerError, envelope.ErrorInternal, "Error getting repeaters")
+		return
+	}
+	respondPage(c, repeaters, total)
+}
+
+// GETMyCalls lists calls made by or to the logged in user
+func GETMyCalls(c *gin.Context) {
+	db, ok := getDB(c, "PaginatedDB")
+	if !ok {
+		return
+	}
+	cDb, ok := getDB(c, "DB")
+	if !ok {
+		return
+	}
+	uid, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+	respondPage(c, models.FindUserCalls(db, uid), models.CountUserCalls(cDb, uid))
+}
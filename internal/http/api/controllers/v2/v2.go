@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package v2 implements the second version of the HTTP API. Every response,
+// including failures from shared middleware, uses the envelope package's shape.
+package v2
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/envelope"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/pagination"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func respond(c *gin.Context, data any) {
+	c.JSON(http.StatusOK, envelope.Envelope{Data: data})
+}
+
+// respondPage writes a list response. Lists are always arrays, never null.
+func respondPage[T any](c *gin.Context, items []T, total int) {
+	if items == nil {
+		items = []T{}
+	}
+	info := &envelope.PageInfo{Page: 1, Limit: len(items), Total: total}
+	if p, ok := c.Get("Pagination"); ok {
+		if paginate, ok := p.(*pagination.Paginate); ok {
+			info.Page = paginate.Page()
+			info.Limit = paginate.Limit()
+		}
+	}
+	c.JSON(http.StatusOK, envelope.Envelope{Data: items, Pagination: info})
+}
+
+func fail(c *gin.Context, status int, code envelope.ErrorCode, message string) {
+	envelope.Fail(c, status, code, message)
+}
+
+func getDB(c *gin.Context, key string) (*gorm.DB, bool) {
+	db, ok := c.MustGet(key).(*gorm.DB)
+	if !ok {
+		logging.Errorf("Unable to get %s from context", key)
+		fail(c, http.StatusInternalServerError, envelope.ErrorInternal, "Try again later")
+	}
+	return db, ok
+}
+
+func sessionUserID(c *gin.Context) (uint, bool) {
+	uid, ok := sessions.Default(c).Get("user_id").(uint)
+	if !ok {
+		fail(c, http.StatusUnauthorized, envelope.ErrorUnauthorized, "Authentication required")
+	}
+	return uid, ok
+}
+
+func sessionUser(c *gin.Context, db *gorm.DB) (models.User, bool) {
+	uid, ok := sessionUserID(c)
+	if !ok {
+		return models.User{}, false
+	}
+	user, err := models.FindUserByID(db, uid)
+	if err != nil {
+		logging.Errorf("Error finding user: %v", err)
+		fail(c, http.StatusInternalServerError, envelope.ErrorInternal, "Error finding user")
+		return models.User{}, false
+	}
+	return user, true
+}
+
+// categoryFilter reads the optional category query parameter, failing the request if it is invalid
+func categoryFilter(c *gin.Context) (uint, bool) {
+	category := c.Query("category")
+	if category == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseUint(category, 10, 32)
+	if err != nil {
+		fail(c, http.StatusBadRequest, envelope.ErrorBadRequest, "Invalid category ID")
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package v2_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	v2 "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v2"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/envelope"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+type repeaterPage struct {
+	Data       []models.Repeater  `json:"data"`
+	Pagination *envelope.PageInfo `json:"pagination"`
+	Error      *envelope.Error    `json:"error"`
+}
+
+func makeRouter(t *testing.T, userID uint) *gin.Engine {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Talkgroup{}, &models.Repeater{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	db.Create(&models.User{ID: 1, Callsign: "N0CALL", Username: "n0call", Approved: true})
+	for _, id := range []uint{311001, 311002} {
+		repeater := models.Repeater{OwnerID: 1}
+		repeater.ID = id
+		if err := db.Create(&repeater).Error; err != nil {
+			t.Fatalf("Failed to create repeater: %v", err)
+		}
+	}
+	_, redis := fakeredis.New(t)
+	router := testutils.ControllerRouter(db, redis, userID)
+	router.GET("/api/v2/me", v2.GETMe)
+	router.GET("/api/v2/repeaters", v2.GETRepeaters)
+	router.GET("/api/v2/repeaters/:id", v2.GETRepeater)
+	return router
+}
+
+func TestRepeaterListEnvelope(t *testing.T) {
+	t.Parallel()
+	router := makeRouter(t, 1)
+
+	w := testutils.Do(t, router, http.MethodGet, "/api/v2/repeaters", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	page := testutils.Decode[repeaterPage](t, w)
+	if len(page.Data) != 2 {
+		t.Errorf("Expected 2 repeaters, got %d", len(page.Data))
+	}
+	if page.Pagination == nil || page.Pagination.Total != 2 || page.Pagination.Page != 1 {
+		t.Errorf("Expected pagination with a total of 2 on page 1, got %+v", page.Pagination)
+	}
+	if page.Error != nil {
+		t.Errorf("Expected no error, got %+v", page.Error)
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	t.Parallel()
+	router := makeRouter(t, 1)
+
+	tests := []struct {
+		path   string
+		status int
+		code   envelope.ErrorCode
+	}{
+		{"/api/v2/repeaters/42", http.StatusNotFound, envelope.ErrorNotFound},
+		{"/api/v2/repeaters/abc", http.StatusBadRequest, envelope.ErrorBadRequest},
+	}
+	for _, tt := range tests {
+		w := testutils.Do(t, router, http.MethodGet, tt.path, nil)
+		if w.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d", tt.path, tt.status, w.Code)
+			continue
+		}
+		resp := testutils.Decode[envelope.Envelope](t, w)
+		if resp.Error == nil || resp.Error.Code != tt.code || resp.Error.Message == "" {
+			t.Errorf("%s: expected a %q error, got %s", tt.path, tt.code, w.Body.String())
+		}
+		if resp.Data != nil {
+			t.Errorf("%s: expected no data alongside the error, got %v", tt.path, resp.Data)
+		}
+	}
+}
+
+func TestMeRequiresSession(t *testing.T) {
+	t.Parallel()
+
+	w := testutils.Do(t, makeRouter(t, 0), http.MethodGet, "/api/v2/me", nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 without a session, got %d", w.Code)
+	}
+	if resp := testutils.Decode[envelope.Envelope](t, w); resp.Error == nil || resp.Error.Code != envelope.ErrorUnauthorized {
+		t.Errorf("Expected an unauthorized error envelope, got %s", w.Body.String())
+	}
+
+	w = testutils.Do(t, makeRouter(t, 1), http.MethodGet, "/api/v2/me", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 with a session, got %d: %s", w.Code, w.Body.String())
+	}
+	resp := testutils.Decode[struct {
+		Data models.User `json:"data"`
+	}](t, w)
+	if resp.Data.ID != 1 {
+		t.Errorf("Expected user 1, got %d", resp.Data.ID)
+	}
+}
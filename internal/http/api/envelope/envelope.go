@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package envelope is the response shape of the v2 API. Successful responses
+// put the resource in "data", with "pagination" alongside for lists, and
+// failures return an "error" object with a machine-readable code.
+package envelope
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Prefix is where the API versions that answer with an envelope are served
+const Prefix = "/api/v2/"
+
+type ErrorCode string
+
+const (
+	ErrorInternal        ErrorCode = "internal_error"
+	ErrorBadRequest      ErrorCode = "bad_request"
+	ErrorUnauthorized    ErrorCode = "unauthorized"
+	ErrorForbidden       ErrorCode = "forbidden"
+	ErrorNotFound        ErrorCode = "not_found"
+	ErrorTooManyRequests ErrorCode = "too_many_requests"
+)
+
+type Error struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+type PageInfo struct {
+	Page  int `json:"page"`
+	Limit int `json:"limit"`
+	Total int `json:"total"`
+}
+
+type Envelope struct {
+	Data       any       `json:"data,omitempty"`
+	Pagination *PageInfo `json:"pagination,omitempty"`
+	Error      *Error    `json:"error,omitempty"`
+}
+
+// Fail aborts the request with an error envelope
+func Fail(c *gin.Context, status int, code ErrorCode, message string) {
+	c.AbortWithStatusJSON(status, Envelope{Error: &Error{Code: code, Message: message}})
+}
+
+// Abort fails a request from middleware shared between API versions. Requests under
+// Prefix get an error envelope, and the others get the v1 {"error": message} body.
+func Abort(c *gin.Context, status int, message string) {
+	if !strings.HasPrefix(c.Request.URL.Path, Prefix) {
+		c.AbortWithStatusJSON(status, gin.H{"error": message})
+		return
+	}
+	Fail(c, status, codeFor(status), message)
+}
+
+func codeFor(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrorBadRequest
+	case http.StatusUnauthorized:
+		return ErrorUnauthorized
+	case http.StatusForbidden:
+		return ErrorForbidden
+	case http.StatusNotFound:
+		return ErrorNotFound
+	case http.StatusTooManyRequests:
+		return ErrorTooManyRequests
+	}
+	return ErrorInternal
+}
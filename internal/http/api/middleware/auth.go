@@ -26,6 +26,7 @@ import (
 	"github.com/USA-RedDragon/DMRHub/internal/config"
 	"github.com/USA-RedDragon/DMRHub/internal/db/models"
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/envelope"
 	"github.com/USA-RedDragon/DMRHub/internal/logging"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -43,7 +44,7 @@ func RequireAdminOrTGOwner() gin.HandlerFunc {
 				logging.Error("RequireLogin: Recovered from panic")
 				// Delete the session cookie
 				c.SetCookie("sessions", "", -1, "/", "", false, true)
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+				envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			}
 		}()
 		userID := session.Get("user_id")
@@ -51,13 +52,13 @@ func RequireAdminOrTGOwner() gin.HandlerFunc {
 			if config.GetConfig().Debug {
 				logging.Error("RequireAdminOrTGOwner: Failed to get user_id from session")
 			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		uid, ok := userID.(uint)
 		if !ok {
 			logging.Error("RequireAdminOrTGOwner: Unable to convert user_id to uint")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		ctx := c.Request.Context()
@@ -74,7 +75,7 @@ func RequireAdminOrTGOwner() gin.HandlerFunc {
 		db, ok := c.MustGet("DB").(*gorm.DB)
 		if !ok {
 			logging.Error("RequireAdminOrTGOwner: Unable to get DB from context")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		db = db.WithContext(ctx)
@@ -92,7 +93,7 @@ func RequireAdminOrTGOwner() gin.HandlerFunc {
 			talkgroups, err := models.FindTalkgroupsByOwnerID(db, uid)
 			if err != nil {
 				logging.Errorf("Failed to find talkgroups for owner %d: %v", uid, err)
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+				envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 				return
 			}
 			if len(talkgroups) > 0 && user.Approved && !user.Suspended {
@@ -101,13 +102,17 @@ func RequireAdminOrTGOwner() gin.HandlerFunc {
 		}
 
 		if !valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 		}
 	}
 }
 
 func RequireAdmin() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if !OnAdminListener(c) {
+			envelope.Abort(c, http.StatusNotFound, "Not found")
+			return
+		}
 		session := sessions.Default(c)
 
 		defer func() {
@@ -115,7 +120,7 @@ func RequireAdmin() gin.HandlerFunc {
 				logging.Error("RequireLogin: Recovered from panic")
 				// Delete the session cookie
 				c.SetCookie("sessions", "", -1, "/", "", false, true)
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+				envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			}
 		}()
 		userID := session.Get("user_id")
@@ -123,13 +128,13 @@ func RequireAdmin() gin.HandlerFunc {
 			if config.GetConfig().Debug {
 				logging.Error("RequireAdmin: Failed to get user_id from session")
 			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		uid, ok := userID.(uint)
 		if !ok {
 			logging.Error("RequireAdmin: Unable to convert user_id to uint")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		ctx := c.Request.Context()
@@ -146,7 +151,7 @@ func RequireAdmin() gin.HandlerFunc {
 		db, ok := c.MustGet("DB").(*gorm.DB)
 		if !ok {
 			logging.Error("RequireAdmin: Unable to get DB from context")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		db = db.WithContext(ctx)
@@ -162,13 +167,17 @@ func RequireAdmin() gin.HandlerFunc {
 		}
 
 		if !valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 		}
 	}
 }
 
 func RequireSuperAdmin() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if !OnAdminListener(c) {
+			envelope.Abort(c, http.StatusNotFound, "Not found")
+			return
+		}
 		ctx := c.Request.Context()
 		session := sessions.Default(c)
 
@@ -176,7 +185,7 @@ func RequireSuperAdmin() gin.HandlerFunc {
 			if recover() != nil {
 				// Delete the session cookie
 				c.SetCookie("sessions", "", -1, "/", "", false, true)
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+				envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			}
 		}()
 		userID := session.Get("user_id")
@@ -184,13 +193,13 @@ func RequireSuperAdmin() gin.HandlerFunc {
 			if config.GetConfig().Debug {
 				logging.Error("RequireSuperAdmin: Failed to get user_id from session")
 			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		uid, ok := userID.(uint)
 		if !ok {
 			logging.Error("RequireSuperAdmin: Unable to convert user_id to uint")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		span := trace.SpanFromContext(ctx)
@@ -202,7 +211,7 @@ func RequireSuperAdmin() gin.HandlerFunc {
 		}
 		if uid != dmrconst.SuperAdminUser {
 			logging.Error("User is not a super admin")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 		}
 	}
 }
@@ -216,7 +225,7 @@ func RequireLogin() gin.HandlerFunc {
 				logging.Error("RequireLogin: Recovered from panic")
 				// Delete the session cookie
 				c.SetCookie("sessions", "", -1, "/", "", false, true)
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+				envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			}
 		}()
 		userID := session.Get("user_id")
@@ -225,13 +234,13 @@ func RequireLogin() gin.HandlerFunc {
 			if config.GetConfig().Debug {
 				logging.Error("RequireLogin: Failed to get user_id from session")
 			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		uid, ok := userID.(uint)
 		if !ok {
 			logging.Error("RequireLogin: Unable to convert user_id to uint")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		ctx := c.Request.Context()
@@ -248,7 +257,7 @@ func RequireLogin() gin.HandlerFunc {
 		db, ok := c.MustGet("DB").(*gorm.DB)
 		if !ok {
 			logging.Error("RequireLogin: Unable to get DB from context")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		db = db.WithContext(ctx)
@@ -264,7 +273,70 @@ func RequireLogin() gin.HandlerFunc {
 		}
 
 		if !valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
+		}
+	}
+}
+
+// RequireOperator requires a logged in user with a DMR ID, turning away listener accounts
+func RequireOperator() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := sessions.Default(c)
+
+		defer func() {
+			if recover() != nil {
+				logging.Error("RequireOperator: Recovered from panic")
+				// Delete the session cookie
+				c.SetCookie("sessions", "", -1, "/", "", false, true)
+				envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
+			}
+		}()
+		userID := session.Get("user_id")
+
+		if userID == nil {
+			if config.GetConfig().Debug {
+				logging.Error("RequireOperator: Failed to get user_id from session")
+			}
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
+			return
+		}
+		uid, ok := userID.(uint)
+		if !ok {
+			logging.Error("RequireOperator: Unable to convert user_id to uint")
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
+			return
+		}
+		ctx := c.Request.Context()
+		span := trace.SpanFromContext(ctx)
+		if span.IsRecording() {
+			span.SetAttributes(
+				attribute.String("http.auth", "RequireOperator"),
+				attribute.Int("user.id", int(uid)),
+			)
+		}
+
+		valid := false
+		// Open up the DB and check if the user exists
+		db, ok := c.MustGet("DB").(*gorm.DB)
+		if !ok {
+			logging.Error("RequireOperator: Unable to get DB from context")
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
+			return
+		}
+		db = db.WithContext(ctx)
+		var user models.User
+		db.Find(&user, "id = ?", uid)
+		if span.IsRecording() {
+			span.SetAttributes(
+				attribute.Bool("user.admin", user.Admin),
+			)
+		}
+		if user.Approved && !user.Suspended && !user.Listener {
+			valid = true
+		}
+
+		if !valid {
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 		}
 	}
 }
@@ -278,13 +350,13 @@ func RequirePeerOwnerOrAdmin() gin.HandlerFunc {
 			if config.GetConfig().Debug {
 				logging.Error("RequirePeerOwnerOrAdmin: Failed to get user_id from session")
 			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		uid, ok := userID.(uint)
 		if !ok {
 			logging.Error("RequirePeerOwnerOrAdmin: Unable to convert user_id to uint")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		ctx := c.Request.Context()
@@ -300,7 +372,7 @@ func RequirePeerOwnerOrAdmin() gin.HandlerFunc {
 		db, ok := c.MustGet("DB").(*gorm.DB)
 		if !ok {
 			logging.Error("RequirePeerOwnerOrAdmin: Unable to get DB from context")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		db = db.WithContext(ctx)
@@ -323,7 +395,7 @@ func RequirePeerOwnerOrAdmin() gin.HandlerFunc {
 		}
 
 		if !valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 		}
 	}
 }
@@ -338,7 +410,7 @@ func RequireRepeaterOwnerOrAdmin() gin.HandlerFunc {
 				logging.Error("RequireLogin: Recovered from panic")
 				// Delete the session cookie
 				c.SetCookie("sessions", "", -1, "/", "", false, true)
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+				envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			}
 		}()
 		userID := session.Get("user_id")
@@ -346,13 +418,13 @@ func RequireRepeaterOwnerOrAdmin() gin.HandlerFunc {
 			if config.GetConfig().Debug {
 				logging.Error("RequireRepeaterOwnerOrAdmin: Failed to get user_id from session")
 			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		uid, ok := userID.(uint)
 		if !ok {
 			logging.Error("RequireRepeaterOwnerOrAdmin: Unable to convert user_id to uint")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		ctx := c.Request.Context()
@@ -368,7 +440,7 @@ func RequireRepeaterOwnerOrAdmin() gin.HandlerFunc {
 		db, ok := c.MustGet("DB").(*gorm.DB)
 		if !ok {
 			logging.Error("RequireRepeaterOwnerOrAdmin: Unable to get DB from context")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		db = db.WithContext(ctx)
@@ -391,7 +463,90 @@ func RequireRepeaterOwnerOrAdmin() gin.HandlerFunc {
 		}
 
 		if !valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
+		}
+	}
+}
+
+// RequireRepeaterPermission allows admins, the repeater owner, or a user the owner
+// has delegated the given permission to.
+func RequireRepeaterPermission(permission models.RepeaterPermissionType) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := sessions.Default(c)
+		id := c.Param("id")
+
+		defer func() {
+			if recover() != nil {
+				logging.Error("RequireRepeaterPermission: Recovered from panic")
+				// Delete the session cookie
+				c.SetCookie("sessions", "", -1, "/", "", false, true)
+				envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
+			}
+		}()
+		userID := session.Get("user_id")
+		if userID == nil {
+			if config.GetConfig().Debug {
+				logging.Error("RequireRepeaterPermission: Failed to get user_id from session")
+			}
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
+			return
+		}
+		uid, ok := userID.(uint)
+		if !ok {
+			logging.Error("RequireRepeaterPermission: Unable to convert user_id to uint")
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
+			return
+		}
+		ctx := c.Request.Context()
+		span := trace.SpanFromContext(ctx)
+		if span.IsRecording() {
+			span.SetAttributes(
+				attribute.String("http.auth", "RequireRepeaterPermission"),
+				attribute.String("http.auth.permission", string(permission)),
+				attribute.Int("user.id", int(uid)),
+			)
+		}
+
+		valid := false
+		db, ok := c.MustGet("DB").(*gorm.DB)
+		if !ok {
+			logging.Error("RequireRepeaterPermission: Unable to get DB from context")
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
+			return
+		}
+		db = db.WithContext(ctx)
+		// Open up the DB and check if the user is an admin, owns repeater with id = id,
+		// or has been delegated the permission on it
+		var user models.User
+		db.Find(&user, "id = ?", uid)
+		if span.IsRecording() {
+			span.SetAttributes(
+				attribute.Bool("user.admin", user.Admin),
+			)
+		}
+		if user.Approved && !user.Suspended {
+			if user.Admin {
+				valid = true
+			} else {
+				var repeater models.Repeater
+				db.Find(&repeater, "id = ?", id)
+				if repeater.ID != 0 {
+					if repeater.OwnerID == user.ID {
+						valid = true
+					} else {
+						perm, found, err := models.FindRepeaterPermission(db, repeater.ID, user.ID)
+						if err != nil {
+							logging.Errorf("RequireRepeaterPermission: Failed to find permission: %v", err)
+						} else if found && perm.Has(permission) {
+							valid = true
+						}
+					}
+				}
+			}
+		}
+
+		if !valid {
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 		}
 	}
 }
@@ -406,7 +561,7 @@ func RequireTalkgroupOwnerOrAdmin() gin.HandlerFunc {
 				logging.Error("RequireLogin: Recovered from panic")
 				// Delete the session cookie
 				c.SetCookie("sessions", "", -1, "/", "", false, true)
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+				envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			}
 		}()
 		userID := session.Get("user_id")
@@ -414,13 +569,13 @@ func RequireTalkgroupOwnerOrAdmin() gin.HandlerFunc {
 			if config.GetConfig().Debug {
 				logging.Error("RequireTalkgroupOwnerOrAdmin: Failed to get user_id from session")
 			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		uid, ok := userID.(uint)
 		if !ok {
 			logging.Error("RequireTalkgroupOwnerOrAdmin: Unable to convert user_id to uint")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		ctx := c.Request.Context()
@@ -436,7 +591,7 @@ func RequireTalkgroupOwnerOrAdmin() gin.HandlerFunc {
 		db, ok := c.MustGet("DB").(*gorm.DB)
 		if !ok {
 			logging.Error("RequireTalkgroupOwnerOrAdmin: Unable to get DB from context")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		db = db.WithContext(ctx)
@@ -462,7 +617,7 @@ func RequireTalkgroupOwnerOrAdmin() gin.HandlerFunc {
 		}
 
 		if !valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 		}
 	}
 }
@@ -477,7 +632,7 @@ func RequireSelfOrAdmin() gin.HandlerFunc {
 				logging.Error("RequireLogin: Recovered from panic")
 				// Delete the session cookie
 				c.SetCookie("sessions", "", -1, "/", "", false, true)
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+				envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			}
 		}()
 		userID := session.Get("user_id")
@@ -485,13 +640,13 @@ func RequireSelfOrAdmin() gin.HandlerFunc {
 			if config.GetConfig().Debug {
 				logging.Error("RequireSelfOrAdmin: Failed to get user_id from session")
 			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		uid, ok := userID.(uint)
 		if !ok {
 			logging.Error("RequireSelfOrAdmin: Unable to convert user_id to uint")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		ctx := c.Request.Context()
@@ -508,7 +663,7 @@ func RequireSelfOrAdmin() gin.HandlerFunc {
 		db, ok := c.MustGet("DB").(*gorm.DB)
 		if !ok {
 			logging.Error("RequireSelfOrAdmin: Unable to get DB from context")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		db = db.WithContext(ctx)
@@ -527,7 +682,7 @@ func RequireSelfOrAdmin() gin.HandlerFunc {
 		}
 
 		if !valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 		}
 	}
 }
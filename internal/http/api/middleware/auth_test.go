@@ -20,10 +20,202 @@
 package middleware_test
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/envelope"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/middleware"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
 )
 
-func TestNoop(t *testing.T) {
+func makeAuthRouter(t *testing.T, userID uint) *gin.Engine {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	db.Create(&models.User{ID: 1, Callsign: "N0CALL", Username: "n0call", Approved: true})
+	db.Create(&models.User{ID: 2, Callsign: "N0ADM", Username: "n0adm", Approved: true, Admin: true})
+
+	router := testutils.ControllerRouter(db, nil, userID)
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	for _, prefix := range []string{"/api/v1", "/api/v2"} {
+		router.GET(prefix+"/login", middleware.RequireLogin(), ok)
+		router.GET(prefix+"/admin", middleware.RequireAdmin(), ok)
+	}
+	return router
+}
+
+func adminRequest(path string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	return req.WithContext(middleware.AdminListenerContext(context.Background()))
+}
+
+func serve(router *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthFailuresUseEnvelopeOnV2(t *testing.T) {
 	t.Parallel()
-	t.Log("Noop")
+	router := makeAuthRouter(t, 0)
+
+	tests := []struct {
+		req    *http.Request
+		status int
+		code   envelope.ErrorCode
+	}{
+		{httptest.NewRequest(http.MethodGet, "/api/v2/login", nil), http.StatusUnauthorized, envelope.ErrorUnauthorized},
+		{adminRequest("/api/v2/admin"), http.StatusUnauthorized, envelope.ErrorUnauthorized},
+		// A separate admin listener is configured, so the public one can't see admin routes
+		{httptest.NewRequest(http.MethodGet, "/api/v2/admin", nil), http.StatusNotFound, envelope.ErrorNotFound},
+	}
+	for _, tt := range tests {
+		w := serve(router, tt.req)
+		if w.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d", tt.req.URL.Path, tt.status, w.Code)
+			continue
+		}
+		var resp envelope.Envelope
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Error == nil {
+			t.Errorf("%s: expected an error envelope, got %s", tt.req.URL.Path, w.Body.String())
+			continue
+		}
+		if resp.Error.Code != tt.code {
+			t.Errorf("%s: expected code %q, got %q", tt.req.URL.Path, tt.code, resp.Error.Code)
+		}
+	}
+}
+
+func TestAuthFailuresKeepV1Shape(t *testing.T) {
+	t.Parallel()
+	router := makeAuthRouter(t, 0)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/api/v1/login", nil),
+		adminRequest("/api/v1/admin"),
+	} {
+		w := serve(router, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", req.URL.Path, w.Code)
+			continue
+		}
+		var resp map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp["error"] != "Authentication failed" {
+			t.Errorf("%s: expected a plain error message, got %s", req.URL.Path, w.Body.String())
+		}
+	}
+}
+
+func TestAuthAllowsUsers(t *testing.T) {
+	t.Parallel()
+
+	user := makeAuthRouter(t, 1)
+	if w := serve(user, httptest.NewRequest(http.MethodGet, "/api/v2/login", nil)); w.Code != http.StatusOK {
+		t.Errorf("Expected a user to pass RequireLogin, got %d", w.Code)
+	}
+	if w := serve(user, adminRequest("/api/v2/admin")); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a user to fail RequireAdmin, got %d", w.Code)
+	}
+
+	admin := makeAuthRouter(t, 2)
+	if w := serve(admin, adminRequest("/api/v2/admin")); w.Code != http.StatusOK {
+		t.Errorf("Expected an admin to pass RequireAdmin, got %d", w.Code)
+	}
+}
+
+func TestRequireRepeaterPermission(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Talkgroup{}, &models.Repeater{}, &models.RepeaterPermission{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	db.Create(&models.User{ID: 1, Callsign: "N0OWN", Username: "n0own", Approved: true})
+	db.Create(&models.User{ID: 2, Callsign: "N0DEL", Username: "n0del", Approved: true})
+	db.Create(&models.User{ID: 3, Callsign: "N0STR", Username: "n0str", Approved: true})
+	db.Create(&models.User{ID: 4, Callsign: "N0SUS", Username: "n0sus", Approved: true, Suspended: true})
+	repeater := models.Repeater{OwnerID: 1}
+	repeater.ID = 311001
+	db.Create(&repeater)
+	db.Create(&models.RepeaterPermission{RepeaterID: repeater.ID, UserID: 2, ViewStats: true})
+	db.Create(&models.RepeaterPermission{RepeaterID: repeater.ID, UserID: 4, ViewStats: true})
+
+	cases := []struct {
+		userID     uint
+		permission models.RepeaterPermissionType
+		want       int
+	}{
+		{1, models.RepeaterPermissionEditTalkgroups, http.StatusOK},
+		{2, models.RepeaterPermissionViewStats, http.StatusOK},
+		{2, models.RepeaterPermissionEditTalkgroups, http.StatusUnauthorized},
+		{3, models.RepeaterPermissionViewStats, http.StatusUnauthorized},
+		{4, models.RepeaterPermissionViewStats, http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		router := testutils.ControllerRouter(db, nil, tc.userID)
+		router.GET("/repeaters/:id", middleware.RequireRepeaterPermission(tc.permission), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		w := serve(router, httptest.NewRequest(http.MethodGet, "/repeaters/311001", nil))
+		if w.Code != tc.want {
+			t.Errorf("User %d with %s: expected %d, got %d", tc.userID, tc.permission, tc.want, w.Code)
+		}
+	}
+}
+
+func TestRequireOperator(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	db.Create(&models.User{ID: 1, Callsign: "N0CALL", Username: "n0call", Approved: true})
+	db.Create(&models.User{ID: 2, Callsign: "N0SUS", Username: "n0sus", Approved: true, Suspended: true})
+	db.Create(&models.User{ID: 3, Callsign: "N0NEW", Username: "n0new"})
+	db.Create(&models.User{ID: models.ListenerIDBase, Callsign: "SWL-1", Username: "listener", Approved: true, Listener: true})
+
+	cases := []struct {
+		name   string
+		userID uint
+		want   int
+	}{
+		{"operator", 1, http.StatusOK},
+		{"suspended", 2, http.StatusUnauthorized},
+		{"unapproved", 3, http.StatusUnauthorized},
+		{"listener", models.ListenerIDBase, http.StatusUnauthorized},
+		{"logged out", 0, http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		router := testutils.ControllerRouter(db, nil, tc.userID)
+		router.POST("/repeaters", middleware.RequireOperator(), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		if w := serve(router, httptest.NewRequest(http.MethodPost, "/repeaters", nil)); w.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, w.Code)
+		}
+	}
+
+	// Listeners can still use everything that only needs a login
+	router := testutils.ControllerRouter(db, nil, models.ListenerIDBase)
+	router.GET("/me", middleware.RequireLogin(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	if w := serve(router, httptest.NewRequest(http.MethodGet, "/me", nil)); w.Code != http.StatusOK {
+		t.Errorf("Expected a listener to pass RequireLogin, got %d", w.Code)
+	}
 }
@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/envelope"
+	"github.com/USA-RedDragon/DMRHub/internal/i18n"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-contrib/cors"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	csrfSessionKey = "csrf_token"
+	csrfTokenBytes = 32
+)
+
+// CORS applies the CORS policy of the listener a request came in on
+func CORS() gin.HandlerFunc {
+	public := cors.New(corsConfig(config.GetConfig().CORS))
+	admin := public
+	if len(config.GetConfig().AdminHTTPListen) > 0 {
+		admin = cors.New(corsConfig(config.GetConfig().AdminCORS))
+	}
+	return func(c *gin.Context) {
+		if onAdminListenerConn(c) {
+			admin(c)
+			return
+		}
+		public(c)
+	}
+}
+
+func corsConfig(policy config.CORSPolicy) cors.Config {
+	corsConfig := cors.Config{
+		AllowOrigins:     policy.Origins,
+		AllowMethods:     policy.Methods,
+		AllowHeaders:     policy.Headers,
+		AllowCredentials: policy.AllowCredentials,
+		ExposeHeaders:    []string{config.CSRFHeader, "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
+		MaxAge:           policy.MaxAge,
+	}
+	// cors.New panics on a bad policy, which would take the whole hub down over a typo
+	if err := corsConfig.Validate(); err != nil {
+		logging.Errorf("Invalid CORS policy, only allowing same-origin requests: %v", err)
+		corsConfig.AllowOrigins = nil
+		corsConfig.AllowOriginFunc = func(string) bool { return false }
+	}
+	return corsConfig
+}
+
+func corsPolicy(c *gin.Context) config.CORSPolicy {
+	return CORSPolicyFor(c.Request)
+}
+
+// CORSPolicyFor returns the CORS policy of the listener a request came in on
+func CORSPolicyFor(r *http.Request) config.CORSPolicy {
+	if admin, _ := r.Context().Value(adminListenerKey{}).(bool); admin {
+		return config.GetConfig().AdminCORS
+	}
+	return config.GetConfig().CORS
+}
+
+// CSRF requires state-changing requests from logged in sessions to send the session's
+// token in the X-CSRF-Token header, on listeners with CSRF protection on. The token is
+// sent on every response, since a frontend on another origin can't read our cookies.
+func CSRF() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !corsPolicy(c).CSRF {
+			c.Next()
+			return
+		}
+		session := sessions.Default(c)
+		if _, ok := session.Get("user_id").(uint); !ok {
+			// Without a session cookie there's nothing to forge
+			c.Next()
+			return
+		}
+		token, _ := session.Get(csrfSessionKey).(string)
+		if token == "" {
+			raw := make([]byte, csrfTokenBytes)
+			if _, err := rand.Read(raw); err != nil {
+				logging.Errorf("CSRF: Error generating token: %v", err)
+				envelope.Abort(c, http.StatusInternalServerError, "Try again later")
+				return
+			}
+			token = base64.RawURLEncoding.EncodeToString(raw)
+			session.Set(csrfSessionKey, token)
+			if err := session.Save(); err != nil {
+				logging.Errorf("CSRF: Error saving token: %v", err)
+			}
+		}
+		c.Header(config.CSRFHeader, token)
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader(config.CSRFHeader)), []byte(token)) != 1 {
+			envelope.Abort(c, http.StatusForbidden, i18n.Translate(c, "csrf_invalid"))
+			return
+		}
+		c.Next()
+	}
+}
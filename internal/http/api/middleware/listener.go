@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/envelope"
+	"github.com/gin-gonic/gin"
+)
+
+type adminListenerKey struct{}
+
+// AdminListenerContext marks a context as belonging to a connection on the admin listener.
+// It is used as the admin HTTP server's BaseContext.
+func AdminListenerContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, adminListenerKey{}, true)
+}
+
+// OnAdminListener reports whether a request may reach admin endpoints. Without
+// ADMIN_HTTP_LISTEN every listener serves them.
+func OnAdminListener(c *gin.Context) bool {
+	if len(config.GetConfig().AdminHTTPListen) == 0 {
+		return true
+	}
+	return onAdminListenerConn(c)
+}
+
+// onAdminListenerConn reports whether a request came in on the admin listener itself
+func onAdminListenerConn(c *gin.Context) bool {
+	admin, _ := c.Request.Context().Value(adminListenerKey{}).(bool)
+	return admin
+}
+
+// RequireAdminListener hides a route from the public listener when a separate admin listener is configured
+func RequireAdminListener() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !OnAdminListener(c) {
+			envelope.Abort(c, http.StatusNotFound, "Not found")
+		}
+	}
+}
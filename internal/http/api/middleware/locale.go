@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package middleware
+
+import (
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/i18n"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// LocaleProvider picks the language for server-generated strings: the logged-in
+// user's setting, then the Accept-Language header, then the network default.
+// The user's setting is read from their session, which login and PATCH /users/:id keep current.
+func LocaleProvider() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(i18n.ContextKey, detectLocale(c))
+		c.Next()
+	}
+}
+
+func detectLocale(c *gin.Context) string {
+	session := sessions.Default(c)
+	if uid, ok := session.Get("user_id").(uint); ok {
+		locale, ok := session.Get(i18n.SessionKey).(string)
+		if !ok {
+			// Sessions from before the locale was kept in them look it up once
+			locale = loadLocale(c, session, uid)
+		}
+		if i18n.IsSupported(locale) {
+			return locale
+		}
+	}
+	if locale, ok := i18n.Negotiate(c.GetHeader("Accept-Language")); ok {
+		return locale
+	}
+	return i18n.Default()
+}
+
+func loadLocale(c *gin.Context, session sessions.Session, uid uint) string {
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		return ""
+	}
+	var locales []string
+	err := db.WithContext(c.Request.Context()).Model(&models.User{}).Where("id = ?", uid).Limit(1).Pluck("locale", &locales).Error
+	if err != nil {
+		logging.Errorf("LocaleProvider: Error getting user locale: %v", err)
+		return ""
+	}
+	locale := ""
+	if len(locales) > 0 {
+		locale = locales[0]
+	}
+	session.Set(i18n.SessionKey, locale)
+	err = session.Save()
+	if err != nil {
+		logging.Errorf("LocaleProvider: Error saving user locale: %v", err)
+	}
+	return locale
+}
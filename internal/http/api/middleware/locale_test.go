@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/middleware"
+	"github.com/USA-RedDragon/DMRHub/internal/i18n"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestLocaleFromSession(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	db.Create(&models.User{ID: 3110001, Callsign: "N0CALL", Username: "n0call", Locale: "fr"})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(sessions.Sessions("sessions", cookie.NewStore([]byte("test"))))
+	router.Use(func(c *gin.Context) {
+		c.Set("DB", db)
+		c.Next()
+	})
+	// Logs in without a locale in the session, like sessions from before it was stored there
+	router.GET("/login/:id", func(c *gin.Context) {
+		id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+		session := sessions.Default(c)
+		session.Set("user_id", uint(id))
+		_ = session.Save()
+		c.Status(http.StatusOK)
+	})
+	router.GET("/locale", middleware.LocaleProvider(), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(i18n.ContextKey))
+	})
+
+	get := func(path string, cookies []*http.Cookie, acceptLanguage string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		if acceptLanguage != "" {
+			req.Header.Set("Accept-Language", acceptLanguage)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get("/locale", nil, "de-DE,de;q=0.9"); w.Body.String() != "de" {
+		t.Errorf("Expected Accept-Language without a session, got %q", w.Body.String())
+	}
+
+	cookies := get("/login/3110001", nil, "").Result().Cookies()
+	w := get("/locale", cookies, "de")
+	if w.Body.String() != "fr" {
+		t.Fatalf("Expected the user's setting, got %q", w.Body.String())
+	}
+	if saved := w.Result().Cookies(); len(saved) > 0 {
+		cookies = saved
+	}
+
+	// Later requests use the session, not the database
+	db.Model(&models.User{}).Where("id = ?", 3110001).Update("locale", "es")
+	if w := get("/locale", cookies, "de"); w.Body.String() != "fr" {
+		t.Errorf("Expected the locale from the session, got %q", w.Body.String())
+	}
+
+	// A user without a setting gets Accept-Language
+	db.Create(&models.User{ID: 3110002, Callsign: "N0CALM", Username: "n0calm"})
+	cookies = get("/login/3110002", nil, "").Result().Cookies()
+	if w := get("/locale", cookies, "es"); w.Body.String() != "es" {
+		t.Errorf("Expected Accept-Language for a user without a setting, got %q", w.Body.String())
+	}
+}
@@ -82,8 +82,10 @@ func PaginatedDatabaseProvider(db *gorm.DB, config PaginationConfig) gin.Handler
 			page = 1
 		}
 
+		paginate := pagination.NewPaginate(limit, page)
+		c.Set("Pagination", paginate)
 		c.Set("PaginatedDB",
-			db.WithContext(c.Request.Context()).Scopes(pagination.NewPaginate(limit, page).Paginate),
+			db.WithContext(c.Request.Context()).Scopes(paginate.Paginate),
 		)
 		c.Next()
 	}
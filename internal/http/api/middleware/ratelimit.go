@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/envelope"
+	"github.com/USA-RedDragon/DMRHub/internal/i18n"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Rate limit tiers, from least to most trusted
+const (
+	RateLimitTierAnonymous = "anonymous"
+	RateLimitTierUser      = "user"
+	RateLimitTierAdmin     = "admin"
+)
+
+// rateLimitScript is GCRA, a token bucket that only stores when the bucket will
+// next be full. It returns whether the request is allowed, the requests left in
+// the burst, and the milliseconds until the bucket is full again, or until the
+// next request is allowed when it isn't.
+//
+//nolint:golint,gochecknoglobals
+var rateLimitScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local tat = tonumber(redis.call("GET", KEYS[1]) or now)
+if tat < now then
+  tat = now
+end
+local allowAt = tat + interval - interval * burst
+if allowAt > now then
+  return {0, 0, math.ceil(allowAt - now)}
+end
+tat = tat + interval
+redis.call("SET", KEYS[1], tostring(tat), "PX", math.ceil(tat - now))
+return {1, math.floor((now - allowAt) / interval), math.ceil(tat - now)}
+`)
+
+// RateLimit limits API requests with a token bucket per client. Anonymous clients
+// are limited by IP, logged in users by account with a higher limit for admins.
+// Routes in RATE_LIMIT_OVERRIDES get their own bucket with their own limit.
+func RateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		redisClient, ok := c.MustGet("Redis").(*redis.Client)
+		if !ok {
+			logging.Error("RateLimit: Unable to get Redis from context")
+			c.Next()
+			return
+		}
+
+		tier, client := rateLimitClient(c)
+		limit := rateLimitFor(tier)
+		bucket := fmt.Sprintf("ratelimit:%s:%s", tier, client)
+		if override, ok := config.GetConfig().RateLimitOverrides[c.FullPath()]; ok {
+			limit = override
+			bucket += ":" + c.FullPath()
+		}
+		if limit.PerSecond <= 0 {
+			c.Next()
+			return
+		}
+
+		interval := float64(time.Second.Milliseconds()) / float64(limit.PerSecond)
+		now := time.Now().UnixMilli()
+		result, err := rateLimitScript.Run(c.Request.Context(), redisClient, []string{bucket}, now, interval, limit.Burst).Int64Slice()
+		if err != nil || len(result) != 3 { //nolint:golint,gomnd
+			// Don't lock everyone out of the API because Redis hiccupped
+			logging.Errorf("RateLimit: Error checking rate limit: %v", err)
+			c.Next()
+			return
+		}
+		allowed, remaining, waitMilliseconds := result[0] == 1, result[1], result[2]
+		waitSeconds := int(math.Ceil(float64(waitMilliseconds) / float64(time.Second.Milliseconds())))
+
+		// https://datatracker.ietf.org/doc/draft-ietf-httpapi-ratelimit-headers/
+		window := int(math.Ceil(float64(limit.Burst) / float64(limit.PerSecond)))
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Burst, window))
+		c.Header("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		c.Header("RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+		c.Header("RateLimit-Reset", strconv.Itoa(waitSeconds))
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(waitSeconds))
+			envelope.Abort(c, http.StatusTooManyRequests, i18n.Translate(c, "rate_limited"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateLimitClient returns the tier a request is limited under and who it's from
+func rateLimitClient(c *gin.Context) (string, string) {
+	uid, ok := sessions.Default(c).Get("user_id").(uint)
+	if !ok {
+		return RateLimitTierAnonymous, c.ClientIP()
+	}
+	client := strconv.FormatUint(uint64(uid), 10)
+	db, ok := c.MustGet("DB").(*gorm.DB)
+	if !ok {
+		logging.Error("RateLimit: Unable to get DB from context")
+		return RateLimitTierUser, client
+	}
+	var user models.User
+	err := db.WithContext(c.Request.Context()).Select("admin", "approved", "suspended").Find(&user, "id = ?", uid).Error
+	if err != nil {
+		logging.Errorf("RateLimit: Error finding user %d: %v", uid, err)
+		return RateLimitTierUser, client
+	}
+	if user.Admin && user.Approved && !user.Suspended {
+		return RateLimitTierAdmin, client
+	}
+	return RateLimitTierUser, client
+}
+
+func rateLimitFor(tier string) config.RateLimit {
+	switch tier {
+	case RateLimitTierAdmin:
+		return config.GetConfig().RateLimitAdmin
+	case RateLimitTierUser:
+		return config.GetConfig().RateLimitUser
+	default:
+		return config.GetConfig().RateLimitAnonymous
+	}
+}
@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/envelope"
+	"github.com/USA-RedDragon/DMRHub/internal/i18n"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const registrationWindow = time.Hour
+
+// RegistrationRateLimit caps how many registration attempts one IP can make per hour.
+// It's much stricter than the API-wide limit, which is sized for browsing the dashboard.
+func RegistrationRateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		redisClient, ok := c.MustGet("Redis").(*redis.Client)
+		if !ok {
+			logging.Error("RegistrationRateLimit: Unable to get Redis from context")
+			c.Next()
+			return
+		}
+		key := "registration:ratelimit:" + c.ClientIP()
+		var incr *redis.IntCmd
+		var ttl *redis.DurationCmd
+		_, err := redisClient.TxPipelined(c.Request.Context(), func(pipe redis.Pipeliner) error {
+			incr = pipe.Incr(c.Request.Context(), key)
+			ttl = pipe.TTL(c.Request.Context(), key)
+			return nil
+		})
+		if err != nil {
+			// Don't lock everyone out of registering because Redis hiccupped
+			logging.Errorf("RegistrationRateLimit: Error counting attempts: %v", err)
+			c.Next()
+			return
+		}
+		retryAfter := ttl.Val()
+		if retryAfter < 0 {
+			// First attempt in this window, or the expiry was lost
+			retryAfter = registrationWindow
+			redisClient.Expire(c.Request.Context(), key, registrationWindow)
+		}
+		if incr.Val() > int64(config.GetConfig().RegistrationRateLimit) {
+			c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			envelope.Abort(c, http.StatusTooManyRequests, i18n.Translate(c, "registration_rate_limited"))
+			return
+		}
+		c.Next()
+	}
+}
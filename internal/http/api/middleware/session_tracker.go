@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package middleware
+
+import (
+	redisSessions "github.com/USA-RedDragon/DMRHub/internal/http/sessions"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// SessionTracker records activity on logged in sessions and logs out sessions that were revoked
+func SessionTracker() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := sessions.Default(c)
+		uid, ok := session.Get("user_id").(uint)
+		if !ok {
+			c.Next()
+			return
+		}
+		redis, ok := c.MustGet("Redis").(*redis.Client)
+		if !ok {
+			logging.Error("SessionTracker: Unable to get Redis from context")
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+
+		id, _ := session.Get(redisSessions.UserSessionKey).(string)
+		if id == "" {
+			// Sessions from before tracking are picked up on their next request
+			id, err := redisSessions.RegisterUserSession(ctx, redis, uid, c.ClientIP(), c.Request.UserAgent())
+			if err != nil {
+				logging.Errorf("SessionTracker: Error registering session: %v", err)
+				c.Next()
+				return
+			}
+			session.Set(redisSessions.UserSessionKey, id)
+			if err := session.Save(); err != nil {
+				logging.Errorf("SessionTracker: Error saving session: %v", err)
+			}
+			c.Next()
+			return
+		}
+
+		active, err := redisSessions.TouchUserSession(ctx, redis, uid, id, c.ClientIP(), c.Request.UserAgent())
+		if err != nil {
+			// Don't log everyone out because Redis hiccupped
+			logging.Errorf("SessionTracker: Error touching session: %v", err)
+		} else if !active {
+			session.Clear()
+			if err := session.Save(); err != nil {
+				logging.Errorf("SessionTracker: Error clearing revoked session: %v", err)
+			}
+		}
+		c.Next()
+	}
+}
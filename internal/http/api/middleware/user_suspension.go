@@ -24,6 +24,7 @@ import (
 
 	"github.com/USA-RedDragon/DMRHub/internal/config"
 	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/envelope"
 	"github.com/USA-RedDragon/DMRHub/internal/logging"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -40,20 +41,20 @@ func SuspendedUserLockout() gin.HandlerFunc {
 			if config.GetConfig().Debug {
 				logging.Error("SuspendedUserLockout: Failed to get user_id from session")
 			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		uid, ok := userID.(uint)
 		if !ok {
 			logging.Error("SuspendedUserLockout: Unable to convert user_id to uint")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 
 		db, ok := c.MustGet("DB").(*gorm.DB)
 		if !ok {
 			logging.Error("SuspendedUserLockout: Unable to get DB from context")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		db = db.WithContext(c.Request.Context())
@@ -61,20 +62,20 @@ func SuspendedUserLockout() gin.HandlerFunc {
 		userExists, err := models.UserIDExists(db, uid)
 		if err != nil {
 			logging.Error("SuspendedUserLockout: Unable to check if user exists")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 
 		if !userExists {
 			logging.Error("SuspendedUserLockout: User ID does not exist")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 
 		user, err := models.FindUserByID(db, uid)
 		if err != nil {
 			logging.Error("SuspendedUserLockout: Unable to find user by ID")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			envelope.Abort(c, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 
@@ -88,7 +89,7 @@ func SuspendedUserLockout() gin.HandlerFunc {
 
 		if user.Suspended {
 			logging.Error("SuspendedUserLockout: User is suspended")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User is suspended"})
+			envelope.Abort(c, http.StatusUnauthorized, "User is suspended")
 			return
 		}
 	}
@@ -0,0 +1,379 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package openapi describes the HTTP API as an OpenAPI 3 document and
+// validates request bodies against it.
+package openapi
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Access describes who may call an operation
+type Access string
+
+const (
+	AccessPublic     Access = "public"
+	AccessLogin      Access = "login"
+	AccessOperator   Access = "operator"
+	AccessOwner      Access = "owner"
+	AccessAdmin      Access = "admin"
+	AccessSuperAdmin Access = "superadmin"
+)
+
+// Operation is a single documented endpoint. Path uses gin syntax, such as /repeaters/:id.
+// OptionalBody operations can be called without a Request body.
+type Operation struct {
+	Method       string
+	Path         string
+	Tag          string
+	Summary      string
+	Access       Access
+	Request      any
+	OptionalBody bool
+	Paginated    bool
+	Deprecated   bool
+}
+
+// Document is the subset of OpenAPI 3.0 that DMRHub produces
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Servers    []Server                        `json:"servers"`
+	Paths      map[string]map[string]*PathItem `json:"paths"`
+	Components Components                      `json:"components"`
+
+	operations map[string]*PathItem
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type string `json:"type"`
+	In   string `json:"in"`
+	Name string `json:"name"`
+}
+
+// PathItem is an OpenAPI operation object
+type PathItem struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Tags        []string              `json:"tags"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Access      Access                `json:"x-dmrhub-access"`
+
+	body *Schema
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Response struct {
+	Description string `json:"description"`
+}
+
+// Schema is an OpenAPI schema object
+type Schema struct {
+	Ref        string             `json:"$ref,omitempty"`
+	Type       string             `json:"type,omitempty"`
+	Format     string             `json:"format,omitempty"`
+	Nullable   bool               `json:"nullable,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Enum       []string           `json:"enum,omitempty"`
+	Maximum    *float64           `json:"maximum,omitempty"`
+	Minimum    *float64           `json:"minimum,omitempty"`
+}
+
+const sessionScheme = "session"
+
+// stringParams are path parameters that aren't numeric IDs
+//
+//nolint:golint,gochecknoglobals
+var stringParams = map[string]bool{"ip": true, "type": true, "target": true, "session_id": true}
+
+// Build creates the document for operations served under basePath
+func Build(title, version, basePath string, operations []Operation) *Document {
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info:    Info{Title: title, Version: version},
+		Servers: []Server{{URL: basePath}},
+		Paths:   map[string]map[string]*PathItem{},
+		Components: Components{
+			Schemas: map[string]*Schema{},
+			SecuritySchemes: map[string]*SecurityScheme{
+				sessionScheme: {Type: "apiKey", In: "cookie", Name: "sessions"},
+			},
+		},
+		operations: map[string]*PathItem{},
+	}
+	for _, op := range operations {
+		doc.add(basePath, op)
+	}
+	return doc
+}
+
+func (d *Document) add(basePath string, op Operation) {
+	path, params := convertPath(op.Path)
+	item := &PathItem{
+		OperationID: operationID(op.Method, op.Path),
+		Summary:     op.Summary,
+		Tags:        []string{op.Tag},
+		Deprecated:  op.Deprecated,
+		Parameters:  params,
+		Responses: map[string]Response{
+			"200": {Description: "Success"},
+			"400": {Description: "Invalid request"},
+		},
+		Access: op.Access,
+	}
+	if op.Access != AccessPublic {
+		item.Security = []map[string][]string{{sessionScheme: {}}}
+		item.Responses["401"] = Response{Description: "Not logged in or not permitted"}
+	}
+	if op.Paginated {
+		item.Parameters = append(item.Parameters,
+			Parameter{Name: "page", In: "query", Schema: &Schema{Type: "integer", Minimum: ptr(1)}},
+			Parameter{Name: "limit", In: "query", Schema: &Schema{Type: "integer", Minimum: ptr(1)}},
+		)
+	}
+	if op.Request != nil {
+		item.body = d.schemaFor(reflect.TypeOf(op.Request))
+		item.RequestBody = &RequestBody{
+			Required: !op.OptionalBody,
+			Content:  map[string]MediaType{"application/json": {Schema: item.body}},
+		}
+	}
+
+	method := strings.ToLower(op.Method)
+	if d.Paths[path] == nil {
+		d.Paths[path] = map[string]*PathItem{}
+	}
+	d.Paths[path][method] = item
+	d.operations[op.Method+" "+basePath+op.Path] = item
+}
+
+// Operation finds the operation for a method and full gin route path
+func (d *Document) Operation(method, fullPath string) (*PathItem, bool) {
+	item, ok := d.operations[method+" "+fullPath]
+	return item, ok
+}
+
+// Resolve follows a $ref to its component schema
+func (d *Document) Resolve(schema *Schema) *Schema {
+	if schema != nil && schema.Ref != "" {
+		return d.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	return schema
+}
+
+// convertPath turns /repeaters/:id into /repeaters/{id} and lists the path parameters
+func convertPath(path string) (string, []Parameter) {
+	var params []Parameter
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if !strings.HasPrefix(part, ":") {
+			continue
+		}
+		name := strings.TrimPrefix(part, ":")
+		schema := &Schema{Type: "integer"}
+		if stringParams[name] {
+			schema = &Schema{Type: "string"}
+		}
+		params = append(params, Parameter{Name: name, In: "path", Required: true, Schema: schema})
+		parts[i] = "{" + name + "}"
+	}
+	return strings.Join(parts, "/"), params
+}
+
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '-' || r == '_' || r == ':' }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+//nolint:golint,gochecknoglobals
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// schemaFor describes a Go type, registering named structs as components
+func (d *Document) schemaFor(t reflect.Type) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		nullable = true
+	}
+	schema := d.baseSchema(t)
+	if nullable {
+		if schema.Ref != "" {
+			return schema
+		}
+		schema.Nullable = true
+	}
+	return schema
+}
+
+func (d *Document) baseSchema(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == durationType:
+		return &Schema{Type: "integer", Format: "int64"}
+	}
+
+	switch t.Kind() { //nolint:golint,exhaustive
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Minimum: ptr(0)}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object"}
+	case reflect.Struct:
+		name := t.Name()
+		if name == "" {
+			return d.structSchema(t)
+		}
+		ref := &Schema{Ref: "#/components/schemas/" + name}
+		if _, ok := d.Components.Schemas[name]; !ok {
+			// Register before walking the fields so recursive types terminate
+			d.Components.Schemas[name] = &Schema{}
+			*d.Components.Schemas[name] = *d.structSchema(t)
+		}
+		return ref
+	default:
+		return &Schema{}
+	}
+}
+
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	d.addFields(schema, t)
+	sort.Strings(schema.Required)
+	return schema
+}
+
+func (d *Document) addFields(schema *Schema, t reflect.Type) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				d.addFields(schema, embedded)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+		property := d.schemaFor(field.Type)
+		if applyBinding(property, field.Tag.Get("binding")) {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = property
+	}
+}
+
+// applyBinding copies gin binding rules onto the schema and reports whether the field is required
+func applyBinding(schema *Schema, binding string) bool {
+	required := false
+	for _, rule := range strings.Split(binding, ",") {
+		key, value, _ := strings.Cut(rule, "=")
+		switch key {
+		case "required":
+			required = true
+		case "email":
+			schema.Format = "email"
+		case "oneof":
+			schema.Enum = strings.Fields(value)
+		case "max":
+			if limit, err := strconv.ParseFloat(value, 64); err == nil {
+				schema.Maximum = &limit
+			}
+		case "min":
+			if limit, err := strconv.ParseFloat(value, 64); err == nil {
+				schema.Minimum = &limit
+			}
+		}
+	}
+	return required
+}
+
+func ptr(f float64) *float64 {
+	return &f
+}
@@ -0,0 +1,172 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package openapi_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/openapi"
+	"github.com/gin-gonic/gin"
+)
+
+type testPost struct {
+	ID        uint    `json:"id" binding:"required"`
+	Frequency string  `json:"frequency" binding:"required,oneof=daily weekly"`
+	Percent   uint    `json:"percent" binding:"max=100"`
+	Note      *string `json:"note"`
+	Secret    string  `json:"-"`
+}
+
+func testDocument() *openapi.Document {
+	return openapi.Build("Test", "1.0.0", "/api/v1", []openapi.Operation{
+		{Method: http.MethodPost, Path: "/things/:id", Tag: "things", Summary: "Create", Access: openapi.AccessLogin, Request: testPost{}},
+		{Method: http.MethodGet, Path: "/things", Tag: "things", Summary: "List", Access: openapi.AccessPublic, Paginated: true},
+		{Method: http.MethodPost, Path: "/things/:id/run", Tag: "things", Summary: "Run", Access: openapi.AccessLogin, Request: testPost{}, OptionalBody: true},
+	})
+}
+
+func TestBuild(t *testing.T) {
+	t.Parallel()
+	doc := testDocument()
+
+	post := doc.Paths["/things/{id}"]["post"]
+	if post == nil {
+		t.Fatal("Expected the gin path to be converted")
+	}
+	if len(post.Parameters) != 1 || post.Parameters[0].Name != "id" {
+		t.Errorf("Expected an id path parameter, got %+v", post.Parameters)
+	}
+	if len(post.Security) == 0 {
+		t.Error("Expected logged in operations to require a session")
+	}
+
+	schema := doc.Components.Schemas["testPost"]
+	if schema == nil {
+		t.Fatal("Expected the request body to be a component")
+	}
+	if strings.Join(schema.Required, ",") != "frequency,id" {
+		t.Errorf("Unexpected required fields %v", schema.Required)
+	}
+	if _, ok := schema.Properties["Secret"]; ok {
+		t.Error("Expected json:\"-\" fields to be skipped")
+	}
+	if !schema.Properties["note"].Nullable {
+		t.Error("Expected pointers to be nullable")
+	}
+
+	list := doc.Paths["/things"]["get"]
+	if len(list.Parameters) != 2 || len(list.Security) != 0 {
+		t.Errorf("Expected public paginated parameters, got %+v", list)
+	}
+
+	if _, err := json.Marshal(doc); err != nil {
+		t.Errorf("Failed to marshal document: %v", err)
+	}
+}
+
+func TestValidator(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(openapi.Validator(testDocument()))
+	router.POST("/api/v1/things/:id", func(c *gin.Context) {
+		var body testPost
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusTeapot, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "ok"})
+	})
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"id": 1, "frequency": "daily"}`, http.StatusOK},
+		{`{"id": 1, "frequency": "daily", "note": null, "extra": true}`, http.StatusOK},
+		{`{"frequency": "daily"}`, http.StatusBadRequest},
+		{`{"id": "1", "frequency": "daily"}`, http.StatusBadRequest},
+		{`{"id": -1, "frequency": "daily"}`, http.StatusBadRequest},
+		{`{"id": 1, "frequency": "hourly"}`, http.StatusBadRequest},
+		{`{"id": 1, "frequency": "daily", "percent": 101}`, http.StatusBadRequest},
+		{`[1, 2]`, http.StatusBadRequest},
+		{`not json`, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/things/1", strings.NewReader(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		if w.Code != test.code {
+			t.Errorf("%s: expected %d, got %d: %s", test.body, test.code, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestValidatorBodilessPost(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(openapi.Validator(testDocument()))
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"message": "ok"}) }
+	router.POST("/api/v1/things/:id", ok)
+	router.POST("/api/v1/things/:id/run", ok)
+
+	tests := []struct {
+		path string
+		body io.Reader
+		code int
+	}{
+		{"/api/v1/things/1/run", http.NoBody, http.StatusOK},
+		{"/api/v1/things/1/run", nil, http.StatusOK},
+		{"/api/v1/things/1/run", strings.NewReader(`{"frequency": "daily"}`), http.StatusBadRequest},
+		// The body is still required where the document says so
+		{"/api/v1/things/1", http.NoBody, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, test.path, test.body)
+		router.ServeHTTP(w, req)
+		if w.Code != test.code {
+			t.Errorf("%s: expected %d, got %d: %s", test.path, test.code, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestValidatorBodilessBenchmark(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(openapi.Validator(openapi.Build("DMRHub API", "1.0.0", "/api/v1", openapi.V1())))
+	router.POST("/api/v1/debug/benchmark", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "ok"})
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/debug/benchmark", http.NoBody))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected a bodiless benchmark to reach the controller, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,218 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package openapi
+
+import (
+	"net/http"
+
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+)
+
+// V1 lists every /api/v1 endpoint. Routes added in routes.go must be added here as well.
+//
+//nolint:golint,funlen
+func V1() []Operation {
+	return []Operation{
+		{Method: http.MethodGet, Path: "/openapi.json", Tag: "meta", Summary: "This document", Access: AccessPublic},
+		{Method: http.MethodGet, Path: "/features", Tag: "meta", Summary: "Features enabled on this server", Access: AccessPublic},
+		{Method: http.MethodGet, Path: "/featureflags", Tag: "meta", Summary: "List feature flags", Access: AccessAdmin},
+		{Method: http.MethodPut, Path: "/featureflags/:name", Tag: "meta", Summary: "Enable or disable a feature flag", Access: AccessAdmin, Request: apimodels.FeatureFlagPut{}},
+		{Method: http.MethodDelete, Path: "/featureflags/:name", Tag: "meta", Summary: "Reset a feature flag to its default", Access: AccessAdmin},
+		{Method: http.MethodGet, Path: "/network/name", Tag: "meta", Summary: "Network name", Access: AccessPublic, Deprecated: true},
+		{Method: http.MethodGet, Path: "/instance", Tag: "meta", Summary: "Instance settings", Access: AccessPublic},
+		{Method: http.MethodPatch, Path: "/instance", Tag: "meta", Summary: "Update instance settings", Access: AccessAdmin, Request: apimodels.InstanceSettingsPatch{}},
+		{Method: http.MethodGet, Path: "/version", Tag: "meta", Summary: "Server version", Access: AccessPublic},
+		{Method: http.MethodGet, Path: "/locales", Tag: "meta", Summary: "Supported locales", Access: AccessPublic},
+		{Method: http.MethodGet, Path: "/ping", Tag: "meta", Summary: "Liveness check", Access: AccessPublic},
+
+		{Method: http.MethodGet, Path: "/status", Tag: "status", Summary: "Public network status", Access: AccessPublic},
+		{Method: http.MethodPost, Path: "/status/incidents", Tag: "status", Summary: "Post an incident", Access: AccessAdmin, Request: apimodels.IncidentPost{}},
+		{Method: http.MethodPatch, Path: "/status/incidents/:id", Tag: "status", Summary: "Update an incident", Access: AccessAdmin, Request: apimodels.IncidentPatch{}},
+		{Method: http.MethodDelete, Path: "/status/incidents/:id", Tag: "status", Summary: "Delete an incident", Access: AccessAdmin},
+
+		{Method: http.MethodPost, Path: "/auth/login", Tag: "auth", Summary: "Log in", Access: AccessPublic, Request: apimodels.AuthLogin{}},
+		{Method: http.MethodGet, Path: "/auth/logout", Tag: "auth", Summary: "Log out", Access: AccessPublic},
+
+		{Method: http.MethodGet, Path: "/repeaters", Tag: "repeaters", Summary: "List repeaters", Access: AccessAdmin, Paginated: true},
+		{Method: http.MethodGet, Path: "/repeaters/my", Tag: "repeaters", Summary: "List your repeaters", Access: AccessLogin, Paginated: true, Deprecated: true},
+		{Method: http.MethodGet, Path: "/repeaters/uptime", Tag: "repeaters", Summary: "Uptime for all repeaters", Access: AccessAdmin},
+		{Method: http.MethodGet, Path: "/repeaters/validation", Tag: "repeaters", Summary: "List repeaters with band plan or color code problems", Access: AccessAdmin},
+		{Method: http.MethodGet, Path: "/repeaters/sessions", Tag: "repeaters", Summary: "Export connected repeater sessions", Access: AccessAdmin},
+		{Method: http.MethodPost, Path: "/repeaters/sessions", Tag: "repeaters", Summary: "Import connected repeater sessions", Access: AccessAdmin, Request: apimodels.RepeaterSessionSnapshot{}},
+		{Method: http.MethodPost, Path: "/repeaters", Tag: "repeaters", Summary: "Register a repeater", Access: AccessOperator, Request: apimodels.RepeaterPost{}},
+		{Method: http.MethodPost, Path: "/repeaters/:id/link", Tag: "repeaters", Summary: "Link a slot to a dynamic talkgroup", Access: AccessOwner, Request: apimodels.RepeaterDynamicLinkPost{}},
+		{Method: http.MethodPost, Path: "/repeaters/:id/unlink", Tag: "repeaters", Summary: "Unlink a slot's dynamic talkgroup", Access: AccessOwner, Request: apimodels.RepeaterDynamicUnlinkPost{}},
+		{Method: http.MethodPost, Path: "/repeaters/:id/message", Tag: "repeaters", Summary: "Show a status message on a hotspot", Access: AccessOwner, Request: apimodels.RepeaterMessagePost{}},
+		{Method: http.MethodPost, Path: "/repeaters/:id/link/:type/:slot/:target", Tag: "repeaters", Summary: "Link a talkgroup", Access: AccessOwner},
+		{Method: http.MethodPost, Path: "/repeaters/:id/unlink/:type/:slot/:target", Tag: "repeaters", Summary: "Unlink a talkgroup", Access: AccessOwner},
+		{Method: http.MethodPost, Path: "/repeaters/:id/talkgroups", Tag: "repeaters", Summary: "Set talkgroups", Access: AccessOwner, Request: apimodels.RepeaterTalkgroupsPost{}},
+		{Method: http.MethodPost, Path: "/repeaters/:id/template", Tag: "repeaters", Summary: "Apply a repeater template", Access: AccessOwner, Request: apimodels.RepeaterTemplateApplyPost{}},
+		{Method: http.MethodPost, Path: "/repeaters/:id/talkgroup-profile", Tag: "repeaters", Summary: "Opt in or out of the owner's talkgroup profile", Access: AccessOwner, Request: apimodels.RepeaterTalkgroupProfilePost{}},
+		{Method: http.MethodPost, Path: "/repeaters/:id/password", Tag: "repeaters", Summary: "Rotate the repeater password", Access: AccessOwner},
+		{Method: http.MethodGet, Path: "/repeaters/:id/mutes", Tag: "repeaters", Summary: "List muted talkgroups", Access: AccessOwner},
+		{Method: http.MethodDelete, Path: "/repeaters/:id/mutes", Tag: "repeaters", Summary: "Clear muted talkgroups", Access: AccessOwner},
+		{Method: http.MethodGet, Path: "/repeaters/:id/bridges", Tag: "repeaters", Summary: "List bridges", Access: AccessOwner},
+		{Method: http.MethodPost, Path: "/repeaters/:id/bridges", Tag: "repeaters", Summary: "Bridge to another repeater", Access: AccessOwner, Request: apimodels.RepeaterLinkPost{}},
+		{Method: http.MethodDelete, Path: "/repeaters/:id/bridges/:bridge_id", Tag: "repeaters", Summary: "Remove a bridge", Access: AccessOwner},
+		{Method: http.MethodGet, Path: "/repeaters/:id/uptime", Tag: "repeaters", Summary: "Repeater uptime", Access: AccessOwner},
+		{Method: http.MethodGet, Path: "/repeaters/:id/health", Tag: "repeaters", Summary: "Network latency and jitter", Access: AccessOwner},
+		{Method: http.MethodGet, Path: "/repeaters/:id/occupancy", Tag: "repeaters", Summary: "Get time slot occupancy history", Access: AccessOwner},
+		{Method: http.MethodGet, Path: "/repeaters/:id/validation", Tag: "repeaters", Summary: "Check the repeater's configuration against the band plan", Access: AccessOwner},
+		{Method: http.MethodPost, Path: "/repeaters/:id/color-code", Tag: "repeaters", Summary: "Set the repeater's expected color code", Access: AccessOwner, Request: apimodels.RepeaterColorCodePost{}},
+		{Method: http.MethodPost, Path: "/repeaters/:id/max-datagram", Tag: "repeaters", Summary: "Set the largest datagram sent to the repeater", Access: AccessOwner, Request: apimodels.MaxDatagramPost{}},
+		{Method: http.MethodPost, Path: "/repeaters/:id/keepalive", Tag: "repeaters", Summary: "Set how often the repeater is expected to ping", Access: AccessOwner, Request: apimodels.KeepalivePost{}},
+		{Method: http.MethodPost, Path: "/repeaters/:id/network", Tag: "repeaters", Summary: "Bind the repeater to a named network", Access: AccessAdmin, Request: apimodels.NetworkPost{}},
+		{Method: http.MethodGet, Path: "/repeaters/:id/history", Tag: "repeaters", Summary: "List configuration versions", Access: AccessOwner},
+		{Method: http.MethodPost, Path: "/repeaters/:id/history/:version/restore", Tag: "repeaters", Summary: "Restore a configuration version", Access: AccessAdmin},
+		{Method: http.MethodGet, Path: "/repeaters/:id/hotspot-config", Tag: "repeaters", Summary: "Get Pi-Star/WPSD settings for connecting a hotspot", Access: AccessOwner},
+		{Method: http.MethodPost, Path: "/repeaters/:id/test", Tag: "repeaters", Summary: "Check the repeater is still sending keepalives", Access: AccessOwner},
+		{Method: http.MethodGet, Path: "/repeaters/:id/permissions", Tag: "repeaters", Summary: "List delegated permissions", Access: AccessOwner},
+		{Method: http.MethodPost, Path: "/repeaters/:id/permissions", Tag: "repeaters", Summary: "Delegate permissions to a user", Access: AccessOwner, Request: apimodels.RepeaterPermissionPost{}},
+		{Method: http.MethodDelete, Path: "/repeaters/:id/permissions/:user_id", Tag: "repeaters", Summary: "Revoke a user's permissions", Access: AccessOwner},
+		{Method: http.MethodGet, Path: "/repeaters/:id", Tag: "repeaters", Summary: "Get a repeater", Access: AccessLogin},
+		{Method: http.MethodDelete, Path: "/repeaters/:id", Tag: "repeaters", Summary: "Delete a repeater", Access: AccessOwner},
+
+		{Method: http.MethodGet, Path: "/repeatergroups", Tag: "repeatergroups", Summary: "List repeater groups", Access: AccessAdmin, Paginated: true},
+		{Method: http.MethodPost, Path: "/repeatergroups", Tag: "repeatergroups", Summary: "Create a repeater group", Access: AccessAdmin, Request: apimodels.RepeaterGroupPost{}},
+		{Method: http.MethodGet, Path: "/repeatergroups/:id", Tag: "repeatergroups", Summary: "Get a repeater group", Access: AccessAdmin},
+		{Method: http.MethodPatch, Path: "/repeatergroups/:id", Tag: "repeatergroups", Summary: "Update a repeater group", Access: AccessAdmin, Request: apimodels.RepeaterGroupPatch{}},
+		{Method: http.MethodDelete, Path: "/repeatergroups/:id", Tag: "repeatergroups", Summary: "Delete a repeater group", Access: AccessAdmin},
+		{Method: http.MethodPost, Path: "/repeatergroups/:id/repeaters", Tag: "repeatergroups", Summary: "Set group members", Access: AccessAdmin, Request: apimodels.RepeaterGroupRepeatersPost{}},
+		{Method: http.MethodPost, Path: "/repeatergroups/:id/talkgroups", Tag: "repeatergroups", Summary: "Set talkgroups on every member", Access: AccessAdmin, Request: apimodels.RepeaterGroupTalkgroupsPost{}},
+		{Method: http.MethodPost, Path: "/repeatergroups/:id/disconnect", Tag: "repeatergroups", Summary: "Disconnect every member", Access: AccessAdmin},
+		{Method: http.MethodGet, Path: "/callouts", Tag: "callouts", Summary: "List callout groups", Access: AccessAdmin, Paginated: true},
+		{Method: http.MethodPost, Path: "/callouts", Tag: "callouts", Summary: "Create a callout group", Access: AccessAdmin, Request: apimodels.CalloutGroupPost{}},
+		{Method: http.MethodGet, Path: "/callouts/:id", Tag: "callouts", Summary: "Get a callout group", Access: AccessAdmin},
+		{Method: http.MethodPatch, Path: "/callouts/:id", Tag: "callouts", Summary: "Update a callout group", Access: AccessAdmin, Request: apimodels.CalloutGroupPatch{}},
+		{Method: http.MethodDelete, Path: "/callouts/:id", Tag: "callouts", Summary: "Delete a callout group", Access: AccessAdmin},
+		{Method: http.MethodPost, Path: "/callouts/:id/members", Tag: "callouts", Summary: "Set callout group members", Access: AccessAdmin, Request: apimodels.CalloutGroupMembersPost{}},
+		{Method: http.MethodGet, Path: "/repeatertemplates", Tag: "repeatertemplates", Summary: "List repeater templates", Access: AccessLogin, Paginated: true},
+		{Method: http.MethodPost, Path: "/repeatertemplates", Tag: "repeatertemplates", Summary: "Create or import a repeater template", Access: AccessAdmin, Request: apimodels.RepeaterTemplatePost{}},
+		{Method: http.MethodGet, Path: "/repeatertemplates/:id", Tag: "repeatertemplates", Summary: "Get or export a repeater template", Access: AccessLogin},
+		{Method: http.MethodPatch, Path: "/repeatertemplates/:id", Tag: "repeatertemplates", Summary: "Update a repeater template", Access: AccessAdmin, Request: apimodels.RepeaterTemplatePatch{}},
+		{Method: http.MethodDelete, Path: "/repeatertemplates/:id", Tag: "repeatertemplates", Summary: "Delete a repeater template", Access: AccessAdmin},
+
+		{Method: http.MethodGet, Path: "/talkgroups", Tag: "talkgroups", Summary: "List talkgroups", Access: AccessLogin, Paginated: true},
+		{Method: http.MethodGet, Path: "/talkgroups/my", Tag: "talkgroups", Summary: "List talkgroups you administer", Access: AccessLogin, Paginated: true},
+		{Method: http.MethodPost, Path: "/talkgroups", Tag: "talkgroups", Summary: "Create a talkgroup", Access: AccessAdmin, Request: apimodels.TalkgroupPost{}},
+		{Method: http.MethodPost, Path: "/talkgroups/import", Tag: "talkgroups", Summary: "Import talkgroups", Access: AccessAdmin, Request: apimodels.TalkgroupImportPost{}},
+		{Method: http.MethodGet, Path: "/talkgroups/pending", Tag: "talkgroups", Summary: "List talkgroups awaiting approval", Access: AccessAdmin},
+		{Method: http.MethodGet, Path: "/talkgroups/categories", Tag: "talkgroups", Summary: "List talkgroup categories", Access: AccessLogin},
+		{Method: http.MethodPost, Path: "/talkgroups/categories", Tag: "talkgroups", Summary: "Create a talkgroup category", Access: AccessAdmin, Request: apimodels.TalkgroupCategoryPost{}},
+		{Method: http.MethodPatch, Path: "/talkgroups/categories/:category_id", Tag: "talkgroups", Summary: "Update a talkgroup category", Access: AccessAdmin, Request: apimodels.TalkgroupCategoryPatch{}},
+		{Method: http.MethodDelete, Path: "/talkgroups/categories/:category_id", Tag: "talkgroups", Summary: "Delete a talkgroup category", Access: AccessAdmin},
+		{Method: http.MethodPost, Path: "/talkgroups/:id/approve", Tag: "talkgroups", Summary: "Approve a talkgroup", Access: AccessAdmin},
+		{Method: http.MethodPost, Path: "/talkgroups/:id/admins", Tag: "talkgroups", Summary: "Set talkgroup admins", Access: AccessAdmin, Request: apimodels.TalkgroupAdminAction{}},
+		{Method: http.MethodPost, Path: "/talkgroups/:id/ncos", Tag: "talkgroups", Summary: "Set net control operators", Access: AccessOwner, Request: apimodels.TalkgroupAdminAction{}},
+		{Method: http.MethodPost, Path: "/talkgroups/:id/categories", Tag: "talkgroups", Summary: "Set talkgroup categories", Access: AccessAdmin, Request: apimodels.TalkgroupCategoriesPost{}},
+		{Method: http.MethodGet, Path: "/talkgroups/:id", Tag: "talkgroups", Summary: "Get a talkgroup", Access: AccessLogin},
+		{Method: http.MethodGet, Path: "/talkgroups/:id/listeners", Tag: "talkgroups", Summary: "Count the repeaters and web clients that would hear a call", Access: AccessLogin},
+		{Method: http.MethodGet, Path: "/talkgroups/:id/allowed-repeaters", Tag: "talkgroups", Summary: "List the repeaters allowed on a private talkgroup", Access: AccessOwner},
+		{Method: http.MethodPost, Path: "/talkgroups/:id/allowed-repeaters", Tag: "talkgroups", Summary: "Set the repeaters allowed on a private talkgroup", Access: AccessOwner, Request: apimodels.TalkgroupAllowedRepeatersPost{}},
+		{Method: http.MethodPatch, Path: "/talkgroups/:id", Tag: "talkgroups", Summary: "Update a talkgroup", Access: AccessOwner, Request: apimodels.TalkgroupPatch{}},
+		{Method: http.MethodDelete, Path: "/talkgroups/:id", Tag: "talkgroups", Summary: "Delete a talkgroup", Access: AccessAdmin},
+		{Method: http.MethodGet, Path: "/talkgroups/:id/quota", Tag: "talkgroups", Summary: "Get the airtime quota", Access: AccessLogin},
+		{Method: http.MethodPost, Path: "/talkgroups/:id/quota", Tag: "talkgroups", Summary: "Set the airtime quota", Access: AccessOwner, Request: apimodels.TalkgroupQuotaPost{}},
+		{Method: http.MethodDelete, Path: "/talkgroups/:id/quota", Tag: "talkgroups", Summary: "Remove the airtime quota", Access: AccessOwner},
+		{Method: http.MethodGet, Path: "/talkgroups/:id/quota/usage", Tag: "talkgroups", Summary: "Your airtime usage", Access: AccessLogin},
+		{Method: http.MethodGet, Path: "/talkgroups/:id/quota/usage/:user_id", Tag: "talkgroups", Summary: "A user's airtime usage", Access: AccessOwner},
+		{Method: http.MethodPost, Path: "/talkgroups/:id/archive", Tag: "talkgroups", Summary: "Turn traffic archival on or off", Access: AccessAdmin, Request: apimodels.TalkgroupArchivePost{}},
+		{Method: http.MethodGet, Path: "/talkgroups/:id/archive/export", Tag: "talkgroups", Summary: "Export archived traffic as NDJSON", Access: AccessAdmin},
+		{Method: http.MethodGet, Path: "/talkgroups/:id/archive/verify", Tag: "talkgroups", Summary: "Verify the archive's hash chain", Access: AccessAdmin},
+		{Method: http.MethodGet, Path: "/talkgroups/:id/history", Tag: "talkgroups", Summary: "List configuration versions", Access: AccessOwner},
+		{Method: http.MethodPost, Path: "/talkgroups/:id/history/:version/restore", Tag: "talkgroups", Summary: "Restore a configuration version", Access: AccessAdmin},
+
+		{Method: http.MethodGet, Path: "/users", Tag: "users", Summary: "List users", Access: AccessAdmin, Paginated: true},
+		{Method: http.MethodPost, Path: "/users", Tag: "users", Summary: "Register", Access: AccessPublic, Request: apimodels.UserRegistration{}},
+		{Method: http.MethodPost, Path: "/users/listener", Tag: "users", Summary: "Register a listen-only account", Access: AccessPublic, Request: apimodels.ListenerRegistration{}},
+		{Method: http.MethodGet, Path: "/users/me", Tag: "users", Summary: "The logged in user", Access: AccessLogin},
+		{Method: http.MethodGet, Path: "/users/me/talkgroup-profile", Tag: "users", Summary: "Get your talkgroup profile", Access: AccessLogin},
+		{Method: http.MethodPost, Path: "/users/me/talkgroup-profile", Tag: "users", Summary: "Set your talkgroup profile", Access: AccessOperator, Request: apimodels.UserTalkgroupProfilePost{}},
+		{Method: http.MethodDelete, Path: "/users/me/talkgroup-profile", Tag: "users", Summary: "Clear your talkgroup profile", Access: AccessLogin},
+		{Method: http.MethodGet, Path: "/users/me/missed-calls", Tag: "users", Summary: "List missed calls", Access: AccessLogin},
+		{Method: http.MethodPost, Path: "/users/me/missed-calls/seen", Tag: "users", Summary: "Mark missed calls seen", Access: AccessLogin},
+		{Method: http.MethodGet, Path: "/users/me/audio-tests", Tag: "users", Summary: "List your audio test results", Access: AccessLogin},
+		{Method: http.MethodGet, Path: "/users/me/digest", Tag: "users", Summary: "Get your activity digest subscription", Access: AccessLogin},
+		{Method: http.MethodPut, Path: "/users/me/digest", Tag: "users", Summary: "Subscribe to the activity digest", Access: AccessLogin, Request: apimodels.UserDigestPut{}},
+		{Method: http.MethodDelete, Path: "/users/me/digest", Tag: "users", Summary: "Unsubscribe from the activity digest", Access: AccessLogin},
+		{Method: http.MethodGet, Path: "/users/admins", Tag: "users", Summary: "List admins", Access: AccessSuperAdmin, Paginated: true},
+		{Method: http.MethodGet, Path: "/users/suspended", Tag: "users", Summary: "List suspended users", Access: AccessAdmin, Paginated: true},
+		{Method: http.MethodGet, Path: "/users/unapproved", Tag: "users", Summary: "List users awaiting approval", Access: AccessAdmin},
+		{Method: http.MethodPost, Path: "/users/promote/:id", Tag: "users", Summary: "Make a user an admin", Access: AccessSuperAdmin},
+		{Method: http.MethodPost, Path: "/users/demote/:id", Tag: "users", Summary: "Remove a user's admin role", Access: AccessSuperAdmin},
+		{Method: http.MethodPost, Path: "/users/approve/:id", Tag: "users", Summary: "Approve a user", Access: AccessAdmin},
+		{Method: http.MethodPost, Path: "/users/unsuspend/:id", Tag: "users", Summary: "Unsuspend a user", Access: AccessAdmin},
+		{Method: http.MethodPost, Path: "/users/suspend/:id", Tag: "users", Summary: "Suspend a user", Access: AccessAdmin},
+		{Method: http.MethodPost, Path: "/users/bulk/approve", Tag: "users", Summary: "Approve pending users matching a filter", Access: AccessAdmin, Request: apimodels.UserBulkApprovePost{}},
+		{Method: http.MethodPost, Path: "/users/bulk/suspend", Tag: "users", Summary: "Suspend a list of users", Access: AccessAdmin, Request: apimodels.UserBulkSuspendPost{}},
+		{Method: http.MethodPost, Path: "/users/bulk/role", Tag: "users", Summary: "Promote or demote a list of users", Access: AccessSuperAdmin, Request: apimodels.UserBulkRolePost{}},
+		{Method: http.MethodGet, Path: "/users/export", Tag: "users", Summary: "Export users as CSV", Access: AccessAdmin},
+		{Method: http.MethodGet, Path: "/users/:id", Tag: "users", Summary: "Get a user", Access: AccessOwner},
+		{Method: http.MethodPatch, Path: "/users/:id", Tag: "users", Summary: "Update a user", Access: AccessOwner, Request: apimodels.UserPatch{}},
+		{Method: http.MethodDelete, Path: "/users/:id", Tag: "users", Summary: "Delete a user", Access: AccessSuperAdmin},
+		{Method: http.MethodGet, Path: "/users/:id/preferences", Tag: "users", Summary: "Get notification preferences", Access: AccessOwner},
+		{Method: http.MethodPut, Path: "/users/:id/preferences", Tag: "users", Summary: "Set notification preferences", Access: AccessOwner, Request: apimodels.UserPreferencesPut{}},
+		{Method: http.MethodGet, Path: "/users/:id/sessions", Tag: "users", Summary: "List logged in sessions", Access: AccessOwner},
+		{Method: http.MethodDelete, Path: "/users/:id/sessions", Tag: "users", Summary: "Log out every other session", Access: AccessOwner},
+		{Method: http.MethodDelete, Path: "/users/:id/sessions/:session_id", Tag: "users", Summary: "Log out a session", Access: AccessOwner},
+		{Method: http.MethodDelete, Path: "/users/:id/data", Tag: "users", Summary: "Erase a user's data", Access: AccessAdmin},
+
+		{Method: http.MethodGet, Path: "/peers", Tag: "peers", Summary: "List OpenBridge peers", Access: AccessAdmin, Paginated: true},
+		{Method: http.MethodGet, Path: "/peers/my", Tag: "peers", Summary: "List your peers", Access: AccessLogin, Paginated: true},
+		{Method: http.MethodPost, Path: "/peers", Tag: "peers", Summary: "Create a peer", Access: AccessAdmin, Request: apimodels.PeerPost{}},
+		{Method: http.MethodGet, Path: "/peers/:id", Tag: "peers", Summary: "Get a peer", Access: AccessOwner},
+		{Method: http.MethodDelete, Path: "/peers/:id", Tag: "peers", Summary: "Delete a peer", Access: AccessOwner},
+		{Method: http.MethodPost, Path: "/peers/:id/max-datagram", Tag: "peers", Summary: "Set the largest datagram sent to the peer", Access: AccessAdmin, Request: apimodels.MaxDatagramPost{}},
+		{Method: http.MethodPost, Path: "/peers/:id/network", Tag: "peers", Summary: "Bind the peer to a named network", Access: AccessAdmin, Request: apimodels.NetworkPost{}},
+
+		{Method: http.MethodGet, Path: "/calls/heatmap", Tag: "calls", Summary: "Call counts by geohash cell of the repeater", Access: AccessPublic},
+		{Method: http.MethodGet, Path: "/calls/export", Tag: "calls", Summary: "Export anonymized call metadata as gzipped NDJSON", Access: AccessAdmin},
+		{Method: http.MethodGet, Path: "/calls/:id/routing", Tag: "calls", Summary: "Explain how a call was routed", Access: AccessAdmin},
+		{Method: http.MethodGet, Path: "/calls/:id/telemetry", Tag: "calls", Summary: "Signal quality over a call", Access: AccessLogin},
+
+		{Method: http.MethodGet, Path: "/debug/runtime", Tag: "debug", Summary: "Runtime statistics, when profiling is enabled", Access: AccessAdmin},
+		{Method: http.MethodPost, Path: "/debug/benchmark", Tag: "debug", Summary: "Run a routing benchmark, when profiling is enabled", Access: AccessAdmin, Request: apimodels.BenchmarkPost{}, OptionalBody: true},
+		{Method: http.MethodPost, Path: "/debug/inject", Tag: "debug", Summary: "Inject a packet, when packet injection is enabled", Access: AccessAdmin, Request: apimodels.InjectPost{}},
+
+		{Method: http.MethodGet, Path: "/ingress/quarantine", Tag: "ingress", Summary: "List quarantined addresses", Access: AccessAdmin},
+		{Method: http.MethodDelete, Path: "/ingress/quarantine/:ip", Tag: "ingress", Summary: "Release a quarantined address", Access: AccessAdmin},
+
+		{Method: http.MethodGet, Path: "/hubevents", Tag: "hubevents", Summary: "List hub state transitions", Access: AccessAdmin},
+		{Method: http.MethodGet, Path: "/hubevents/state", Tag: "hubevents", Summary: "Replay hub state and report drift", Access: AccessAdmin},
+		{Method: http.MethodGet, Path: "/deferred", Tag: "deferred", Summary: "List data held for offline destinations", Access: AccessAdmin, Paginated: true},
+		{Method: http.MethodDelete, Path: "/deferred", Tag: "deferred", Summary: "Purge held data", Access: AccessAdmin},
+		{Method: http.MethodDelete, Path: "/deferred/:id", Tag: "deferred", Summary: "Drop a held data packet", Access: AccessAdmin},
+		{Method: http.MethodGet, Path: "/airtime", Tag: "airtime", Summary: "Report transmit time per user, talkgroup, or repeater", Access: AccessAdmin},
+		{Method: http.MethodGet, Path: "/airtime/leaderboard", Tag: "airtime", Summary: "List who has the most talk time", Access: AccessLogin},
+		{Method: http.MethodGet, Path: "/inhibits", Tag: "inhibits", Summary: "List TX inhibits, including lifted ones", Access: AccessAdmin},
+		{Method: http.MethodPost, Path: "/inhibits", Tag: "inhibits", Summary: "Inhibit routing on talkgroups or the whole hub", Access: AccessAdmin, Request: apimodels.TXInhibitPost{}},
+		{Method: http.MethodDelete, Path: "/inhibits/:id", Tag: "inhibits", Summary: "Lift a TX inhibit", Access: AccessAdmin},
+
+		{Method: http.MethodGet, Path: "/jobs", Tag: "jobs", Summary: "List background jobs", Access: AccessAdmin, Paginated: true},
+		{Method: http.MethodGet, Path: "/jobs/:id", Tag: "jobs", Summary: "Get a background job", Access: AccessAdmin},
+		{Method: http.MethodPost, Path: "/jobs/:id/retry", Tag: "jobs", Summary: "Run a dead or pending job again now", Access: AccessAdmin},
+		{Method: http.MethodPost, Path: "/jobs/:id/dead-letter", Tag: "jobs", Summary: "Stop a pending job from running", Access: AccessAdmin},
+
+		{Method: http.MethodGet, Path: "/lastheard", Tag: "lastheard", Summary: "Recent calls", Access: AccessPublic, Paginated: true},
+		{Method: http.MethodGet, Path: "/lastheard/user/:id", Tag: "lastheard", Summary: "Recent calls by a user", Access: AccessOwner, Paginated: true},
+		{Method: http.MethodGet, Path: "/lastheard/repeater/:id", Tag: "lastheard", Summary: "Recent calls through a repeater", Access: AccessOwner, Paginated: true},
+		{Method: http.MethodGet, Path: "/lastheard/talkgroup/:id", Tag: "lastheard", Summary: "Recent calls to a talkgroup", Access: AccessLogin, Paginated: true},
+	}
+}
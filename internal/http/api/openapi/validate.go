@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"slices"
+
+	"github.com/USA-RedDragon/DMRHub/internal/i18n"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrInvalidType = errors.New("has the wrong type")
+	ErrMissing     = errors.New("is required")
+	ErrNotAllowed  = errors.New("is not an allowed value")
+	ErrOutOfRange  = errors.New("is out of range")
+	ErrNotEmail    = errors.New("is not an email address")
+)
+
+// Validator rejects request bodies that don't match the document before they reach a controller
+func Validator(doc *Document) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		op, ok := doc.Operation(c.Request.Method, c.FullPath())
+		if !ok || op.body == nil || c.Request.Body == nil {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": i18n.Translate(c, "json_invalid")})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if len(body) == 0 && !op.RequestBody.Required {
+			c.Next()
+			return
+		}
+
+		var value any
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		err = decoder.Decode(&value)
+		if err == nil {
+			err = doc.Validate(op.body, value)
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": i18n.Translate(c, "json_invalid"), "details": err.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Validate checks a decoded JSON value against a schema
+func (d *Document) Validate(schema *Schema, value any) error {
+	return d.validate(d.Resolve(schema), value, "body")
+}
+
+func (d *Document) validate(schema *Schema, value any, path string) error {
+	if schema == nil || value == nil {
+		// Missing values are zeroed by the JSON binding, required fields are checked by the parent
+		return nil
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s %w", path, ErrInvalidType)
+		}
+		for _, name := range schema.Required {
+			if object[name] == nil {
+				return fmt.Errorf("%s.%s %w", path, name, ErrMissing)
+			}
+		}
+		for name, property := range schema.Properties {
+			if err := d.validate(d.Resolve(property), object[name], path+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		if schema.Format == "byte" {
+			if _, ok := value.(string); !ok {
+				return fmt.Errorf("%s %w", path, ErrInvalidType)
+			}
+			return nil
+		}
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s %w", path, ErrInvalidType)
+		}
+		for i, item := range items {
+			if err := d.validate(d.Resolve(schema.Items), item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s %w", path, ErrInvalidType)
+		}
+		if len(schema.Enum) > 0 && !slices.Contains(schema.Enum, s) {
+			return fmt.Errorf("%s %w", path, ErrNotAllowed)
+		}
+		if schema.Format == "email" {
+			if _, err := mail.ParseAddress(s); err != nil {
+				return fmt.Errorf("%s %w", path, ErrNotEmail)
+			}
+		}
+	case "integer", "number":
+		return validateNumber(schema, value, path)
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s %w", path, ErrInvalidType)
+		}
+	}
+	return nil
+}
+
+func validateNumber(schema *Schema, value any, path string) error {
+	number, ok := value.(json.Number)
+	if !ok {
+		return fmt.Errorf("%s %w", path, ErrInvalidType)
+	}
+	if schema.Type == "integer" {
+		if _, err := number.Int64(); err != nil {
+			return fmt.Errorf("%s %w", path, ErrInvalidType)
+		}
+	}
+	f, err := number.Float64()
+	if err != nil {
+		return fmt.Errorf("%s %w", path, ErrInvalidType)
+	}
+	if schema.Minimum != nil && f < *schema.Minimum {
+		return fmt.Errorf("%s %w", path, ErrOutOfRange)
+	}
+	if schema.Maximum != nil && f > *schema.Maximum {
+		return fmt.Errorf("%s %w", path, ErrOutOfRange)
+	}
+	return nil
+}
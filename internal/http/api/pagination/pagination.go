@@ -30,6 +30,14 @@ func NewPaginate(limit int, page int) *Paginate {
 	return &Paginate{limit: limit, page: page}
 }
 
+func (p *Paginate) Limit() int {
+	return p.limit
+}
+
+func (p *Paginate) Page() int {
+	return p.page
+}
+
 func (p *Paginate) Paginate(db *gorm.DB) *gorm.DB {
 	offset := (p.page - 1) * p.limit
 
@@ -21,18 +21,37 @@ package api
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers/hbrp"
 	v1Controllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1"
+	v1AirtimeControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/airtime"
 	v1AuthControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/auth"
+	v1CalloutsControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/callouts"
+	v1CallsControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/calls"
+	v1DebugControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/debug"
+	v1DeferredControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/deferred"
+	v1HubEventsControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/hubevents"
+	v1InhibitsControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/inhibits"
+	v1JobsControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/jobs"
 	v1LastheardControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/lastheard"
 	v1PeersControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/peers"
+	v1QuarantineControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/quarantine"
+	v1RepeaterGroupsControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/repeatergroups"
 	v1RepeatersControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/repeaters"
+	v1RepeaterTemplatesControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/repeatertemplates"
+	v1StatusControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/status"
 	v1TalkgroupsControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/talkgroups"
 	v1UsersControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/users"
+	v2Controllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v2"
 	"github.com/USA-RedDragon/DMRHub/internal/http/api/middleware"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/openapi"
 	websocketControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/websocket"
 	"github.com/USA-RedDragon/DMRHub/internal/http/websocket"
+	"github.com/USA-RedDragon/DMRHub/internal/pubsub"
+	"github.com/gin-contrib/pprof"
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
@@ -51,19 +70,65 @@ func ApplyRoutes(router *gin.Engine, db *gorm.DB, redis *redis.Client, ratelimit
 		}
 		c.String(http.StatusOK, "User-agent: *\nDisallow: /")
 	})
+	router.GET("/readyz", func(c *gin.Context) {
+		sqlDB, err := db.DB()
+		if err != nil || sqlDB.PingContext(c) != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": "database unreachable"})
+			return
+		}
+		if hbrp.WarmingUp() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "warming up"})
+			return
+		}
+		monitor := pubsub.Default()
+		if monitor == nil {
+			c.JSON(http.StatusOK, gin.H{"status": "ok"})
+			return
+		}
+		status := monitor.Status()
+		if !status.Healthy {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "degraded", "pubsub": status})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "pubsub": status})
+	})
+	spec := openapi.Build("DMRHub API", "1.0.0", "/api/v1", openapi.V1())
 	apiV1 := router.Group("/api/v1")
 	apiV1.Use(ratelimit)
+	apiV1.Use(openapi.Validator(spec))
+	apiV1.GET("/openapi.json", func(c *gin.Context) {
+		c.JSON(http.StatusOK, spec)
+	})
 	v1(apiV1, userSuspension)
 
+	apiV2 := router.Group("/api/v2")
+	apiV2.Use(ratelimit)
+	v2(apiV2, userSuspension)
+
 	ws := router.Group("/ws")
 	ws.Use(ratelimit)
 	ws.GET("/repeaters", middleware.RequireLogin(), userSuspension, websocket.CreateHandler(websocketControllers.CreateRepeatersWebsocket(db, redis)))
 	ws.GET("/calls", websocket.CreateHandler(websocketControllers.CreateCallsWebsocket(db, redis)))
 	ws.GET("/peers", websocket.CreateHandler(websocketControllers.CreatePeersWebsocket(db, redis)))
+	ws.GET("/talkgroups/listeners", middleware.RequireLogin(), userSuspension, websocket.CreateHandler(websocketControllers.CreateTalkgroupListenersWebsocket(db, redis)))
+	ws.GET("/notifications", middleware.RequireLogin(), userSuspension, websocket.CreateHandler(websocketControllers.CreateNotificationsWebsocket(db, redis)))
+	ws.GET("/events", middleware.RequireAdmin(), userSuspension, websocket.CreateHandler(websocketControllers.CreateEventsWebsocket(db, redis)))
 }
 
+// v1 endpoints with a replacement are removed after the sunset date. Everything
+// else in v1 stays stable until v1 as a whole is retired.
+//
+//nolint:golint,gochecknoglobals
+var (
+	v1DeprecatedAt = time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+	v1Sunset       = time.Date(2027, time.October, 1, 0, 0, 0, 0, time.UTC)
+)
+
 func v1(group *gin.RouterGroup, userSuspension gin.HandlerFunc) {
 	group.GET("/features", v1Controllers.GETFeatures)
+	group.GET("/featureflags", middleware.RequireAdmin(), userSuspension, v1Controllers.GETFeatureFlags)
+	group.PUT("/featureflags/:name", middleware.RequireAdmin(), userSuspension, v1Controllers.PUTFeatureFlag)
+	group.DELETE("/featureflags/:name", middleware.RequireAdmin(), userSuspension, v1Controllers.DELETEFeatureFlag)
 	v1Auth := group.Group("/auth")
 	v1Auth.POST("/login", v1AuthControllers.POSTLogin)
 	v1Auth.GET("/logout", v1AuthControllers.GETLogout)
@@ -72,31 +137,120 @@ func v1(group *gin.RouterGroup, userSuspension gin.HandlerFunc) {
 	// Paginated
 	v1Repeaters.GET("", middleware.RequireAdmin(), userSuspension, v1RepeatersControllers.GETRepeaters)
 	// Paginated
-	v1Repeaters.GET("/my", middleware.RequireLogin(), userSuspension, v1RepeatersControllers.GETMyRepeaters)
-	v1Repeaters.POST("", middleware.RequireLogin(), userSuspension, v1RepeatersControllers.POSTRepeater)
-	v1Repeaters.POST("/:id/link/:type/:slot/:target", middleware.RequireRepeaterOwnerOrAdmin(), userSuspension, v1RepeatersControllers.POSTRepeaterLink)
-	v1Repeaters.POST("/:id/unlink/:type/:slot/:target", middleware.RequireRepeaterOwnerOrAdmin(), userSuspension, v1RepeatersControllers.POSTRepeaterUnlink)
-	v1Repeaters.POST("/:id/talkgroups", middleware.RequireRepeaterOwnerOrAdmin(), userSuspension, v1RepeatersControllers.POSTRepeaterTalkgroups)
+	v1Repeaters.GET("/my", middleware.Deprecated(v1DeprecatedAt, v1Sunset, "/api/v2/users/me/repeaters"), middleware.RequireLogin(), userSuspension, v1RepeatersControllers.GETMyRepeaters)
+	v1Repeaters.GET("/uptime", middleware.RequireAdmin(), userSuspension, v1RepeatersControllers.GETRepeatersUptime)
+	v1Repeaters.GET("/validation", middleware.RequireAdmin(), userSuspension, v1RepeatersControllers.GETRepeatersValidation)
+	v1Repeaters.GET("/sessions", middleware.RequireAdmin(), userSuspension, v1RepeatersControllers.GETRepeaterSessions)
+	v1Repeaters.POST("/sessions", middleware.RequireAdmin(), userSuspension, v1RepeatersControllers.POSTRepeaterSessions)
+	v1Repeaters.POST("", middleware.RequireOperator(), userSuspension, v1RepeatersControllers.POSTRepeater)
+	v1Repeaters.POST("/:id/link", middleware.RequireRepeaterPermission(models.RepeaterPermissionEditTalkgroups), userSuspension, v1RepeatersControllers.POSTRepeaterDynamicLink)
+	v1Repeaters.POST("/:id/unlink", middleware.RequireRepeaterPermission(models.RepeaterPermissionEditTalkgroups), userSuspension, v1RepeatersControllers.POSTRepeaterDynamicUnlink)
+	v1Repeaters.POST("/:id/message", middleware.RequireRepeaterOwnerOrAdmin(), userSuspension, v1RepeatersControllers.POSTRepeaterMessage)
+	v1Repeaters.POST("/:id/link/:type/:slot/:target", middleware.RequireRepeaterPermission(models.RepeaterPermissionEditTalkgroups), userSuspension, v1RepeatersControllers.POSTRepeaterLink)
+	v1Repeaters.POST("/:id/unlink/:type/:slot/:target", middleware.RequireRepeaterPermission(models.RepeaterPermissionEditTalkgroups), userSuspension, v1RepeatersControllers.POSTRepeaterUnlink)
+	v1Repeaters.POST("/:id/talkgroups", middleware.RequireRepeaterPermission(models.RepeaterPermissionEditTalkgroups), userSuspension, v1RepeatersControllers.POSTRepeaterTalkgroups)
+	v1Repeaters.POST("/:id/template", middleware.RequireRepeaterPermission(models.RepeaterPermissionEditTalkgroups), userSuspension, v1RepeatersControllers.POSTRepeaterTemplate)
+	v1Repeaters.POST("/:id/talkgroup-profile", middleware.RequireRepeaterPermission(models.RepeaterPermissionEditTalkgroups), userSuspension, v1RepeatersControllers.POSTRepeaterTalkgroupProfile)
+	v1Repeaters.POST("/:id/password", middleware.RequireRepeaterPermission(models.RepeaterPermissionRotatePassword), userSuspension, v1RepeatersControllers.POSTRepeaterPassword)
+	v1Repeaters.GET("/:id/mutes", middleware.RequireRepeaterPermission(models.RepeaterPermissionViewStats), userSuspension, v1RepeatersControllers.GETRepeaterMutes)
+	v1Repeaters.DELETE("/:id/mutes", middleware.RequireRepeaterPermission(models.RepeaterPermissionEditTalkgroups), userSuspension, v1RepeatersControllers.DELETERepeaterMutes)
+	v1Repeaters.GET("/:id/bridges", middleware.RequireRepeaterPermission(models.RepeaterPermissionViewStats), userSuspension, v1RepeatersControllers.GETRepeaterBridges)
+	v1Repeaters.POST("/:id/bridges", middleware.RequireRepeaterPermission(models.RepeaterPermissionEditTalkgroups), userSuspension, v1RepeatersControllers.POSTRepeaterBridge)
+	v1Repeaters.DELETE("/:id/bridges/:bridge_id", middleware.RequireRepeaterPermission(models.RepeaterPermissionEditTalkgroups), userSuspension, v1RepeatersControllers.DELETERepeaterBridge)
+	v1Repeaters.GET("/:id/uptime", middleware.RequireRepeaterPermission(models.RepeaterPermissionViewStats), userSuspension, v1RepeatersControllers.GETRepeaterUptime)
+	v1Repeaters.GET("/:id/health", middleware.RequireRepeaterPermission(models.RepeaterPermissionViewStats), userSuspension, v1RepeatersControllers.GETRepeaterHealth)
+	v1Repeaters.GET("/:id/occupancy", middleware.RequireRepeaterPermission(models.RepeaterPermissionViewStats), userSuspension, v1RepeatersControllers.GETRepeaterOccupancy)
+	v1Repeaters.GET("/:id/hotspot-config", middleware.RequireRepeaterPermission(models.RepeaterPermissionRotatePassword), userSuspension, v1RepeatersControllers.GETRepeaterHotspotConfig)
+	v1Repeaters.GET("/:id/validation", middleware.RequireRepeaterPermission(models.RepeaterPermissionViewStats), userSuspension, v1RepeatersControllers.GETRepeaterValidation)
+	v1Repeaters.POST("/:id/color-code", middleware.RequireRepeaterOwnerOrAdmin(), userSuspension, v1RepeatersControllers.POSTRepeaterColorCode)
+	v1Repeaters.POST("/:id/max-datagram", middleware.RequireRepeaterOwnerOrAdmin(), userSuspension, v1RepeatersControllers.POSTRepeaterMaxDatagram)
+	v1Repeaters.POST("/:id/keepalive", middleware.RequireRepeaterOwnerOrAdmin(), userSuspension, v1RepeatersControllers.POSTRepeaterKeepalive)
+	v1Repeaters.POST("/:id/network", middleware.RequireAdmin(), userSuspension, v1RepeatersControllers.POSTRepeaterNetwork)
+	v1Repeaters.GET("/:id/history", middleware.RequireRepeaterOwnerOrAdmin(), userSuspension, v1RepeatersControllers.GETRepeaterHistory)
+	v1Repeaters.POST("/:id/history/:version/restore", middleware.RequireAdmin(), userSuspension, v1RepeatersControllers.POSTRepeaterHistoryRestore)
+	v1Repeaters.POST("/:id/test", middleware.RequireRepeaterPermission(models.RepeaterPermissionViewStats), userSuspension, v1RepeatersControllers.POSTRepeaterTest)
+	v1Repeaters.GET("/:id/permissions", middleware.RequireRepeaterOwnerOrAdmin(), userSuspension, v1RepeatersControllers.GETRepeaterPermissions)
+	v1Repeaters.POST("/:id/permissions", middleware.RequireRepeaterOwnerOrAdmin(), userSuspension, v1RepeatersControllers.POSTRepeaterPermission)
+	v1Repeaters.DELETE("/:id/permissions/:user_id", middleware.RequireRepeaterOwnerOrAdmin(), userSuspension, v1RepeatersControllers.DELETERepeaterPermission)
 	v1Repeaters.GET("/:id", middleware.RequireLogin(), userSuspension, v1RepeatersControllers.GETRepeater)
 	v1Repeaters.DELETE("/:id", middleware.RequireRepeaterOwnerOrAdmin(), userSuspension, v1RepeatersControllers.DELETERepeater)
 
+	v1RepeaterGroups := group.Group("/repeatergroups")
+	// Paginated
+	v1RepeaterGroups.GET("", middleware.RequireAdmin(), userSuspension, v1RepeaterGroupsControllers.GETRepeaterGroups)
+	v1RepeaterGroups.POST("", middleware.RequireAdmin(), userSuspension, v1RepeaterGroupsControllers.POSTRepeaterGroup)
+	v1RepeaterGroups.GET("/:id", middleware.RequireAdmin(), userSuspension, v1RepeaterGroupsControllers.GETRepeaterGroup)
+	v1RepeaterGroups.PATCH("/:id", middleware.RequireAdmin(), userSuspension, v1RepeaterGroupsControllers.PATCHRepeaterGroup)
+	v1RepeaterGroups.DELETE("/:id", middleware.RequireAdmin(), userSuspension, v1RepeaterGroupsControllers.DELETERepeaterGroup)
+	v1RepeaterGroups.POST("/:id/repeaters", middleware.RequireAdmin(), userSuspension, v1RepeaterGroupsControllers.POSTRepeaterGroupRepeaters)
+	v1RepeaterGroups.POST("/:id/talkgroups", middleware.RequireAdmin(), userSuspension, v1RepeaterGroupsControllers.POSTRepeaterGroupTalkgroups)
+	v1RepeaterGroups.POST("/:id/disconnect", middleware.RequireAdmin(), userSuspension, v1RepeaterGroupsControllers.POSTRepeaterGroupDisconnect)
+
+	v1Callouts := group.Group("/callouts")
+	// Paginated
+	v1Callouts.GET("", middleware.RequireAdmin(), userSuspension, v1CalloutsControllers.GETCalloutGroups)
+	v1Callouts.POST("", middleware.RequireAdmin(), userSuspension, v1CalloutsControllers.POSTCalloutGroup)
+	v1Callouts.GET("/:id", middleware.RequireAdmin(), userSuspension, v1CalloutsControllers.GETCalloutGroup)
+	v1Callouts.PATCH("/:id", middleware.RequireAdmin(), userSuspension, v1CalloutsControllers.PATCHCalloutGroup)
+	v1Callouts.DELETE("/:id", middleware.RequireAdmin(), userSuspension, v1CalloutsControllers.DELETECalloutGroup)
+	v1Callouts.POST("/:id/members", middleware.RequireAdmin(), userSuspension, v1CalloutsControllers.POSTCalloutGroupMembers)
+
+	v1RepeaterTemplates := group.Group("/repeatertemplates")
+	// Paginated
+	v1RepeaterTemplates.GET("", middleware.RequireLogin(), userSuspension, v1RepeaterTemplatesControllers.GETRepeaterTemplates)
+	v1RepeaterTemplates.POST("", middleware.RequireAdmin(), userSuspension, v1RepeaterTemplatesControllers.POSTRepeaterTemplate)
+	v1RepeaterTemplates.GET("/:id", middleware.RequireLogin(), userSuspension, v1RepeaterTemplatesControllers.GETRepeaterTemplate)
+	v1RepeaterTemplates.PATCH("/:id", middleware.RequireAdmin(), userSuspension, v1RepeaterTemplatesControllers.PATCHRepeaterTemplate)
+	v1RepeaterTemplates.DELETE("/:id", middleware.RequireAdmin(), userSuspension, v1RepeaterTemplatesControllers.DELETERepeaterTemplate)
+
 	v1Talkgroups := group.Group("/talkgroups")
 	// Paginated
 	v1Talkgroups.GET("", middleware.RequireLogin(), userSuspension, v1TalkgroupsControllers.GETTalkgroups)
 	// Paginated
 	v1Talkgroups.GET("/my", middleware.RequireLogin(), userSuspension, v1TalkgroupsControllers.GETMyTalkgroups)
 	v1Talkgroups.POST("", middleware.RequireAdmin(), userSuspension, v1TalkgroupsControllers.POSTTalkgroup)
+	v1Talkgroups.POST("/import", middleware.RequireAdmin(), userSuspension, v1TalkgroupsControllers.POSTTalkgroupImport)
+	v1Talkgroups.GET("/pending", middleware.RequireAdmin(), userSuspension, v1TalkgroupsControllers.GETPendingTalkgroups)
+	v1Talkgroups.GET("/categories", middleware.RequireLogin(), userSuspension, v1TalkgroupsControllers.GETTalkgroupCategories)
+	v1Talkgroups.POST("/categories", middleware.RequireAdmin(), userSuspension, v1TalkgroupsControllers.POSTTalkgroupCategory)
+	v1Talkgroups.PATCH("/categories/:category_id", middleware.RequireAdmin(), userSuspension, v1TalkgroupsControllers.PATCHTalkgroupCategory)
+	v1Talkgroups.DELETE("/categories/:category_id", middleware.RequireAdmin(), userSuspension, v1TalkgroupsControllers.DELETETalkgroupCategory)
+	v1Talkgroups.POST("/:id/approve", middleware.RequireAdmin(), userSuspension, v1TalkgroupsControllers.POSTTalkgroupApprove)
 	v1Talkgroups.POST("/:id/admins", middleware.RequireAdmin(), userSuspension, v1TalkgroupsControllers.POSTTalkgroupAdmins)
 	v1Talkgroups.POST("/:id/ncos", middleware.RequireTalkgroupOwnerOrAdmin(), userSuspension, v1TalkgroupsControllers.POSTTalkgroupNCOs)
+	v1Talkgroups.POST("/:id/categories", middleware.RequireAdmin(), userSuspension, v1TalkgroupsControllers.POSTTalkgroupCategories)
 	v1Talkgroups.GET("/:id", middleware.RequireLogin(), userSuspension, v1TalkgroupsControllers.GETTalkgroup)
+	v1Talkgroups.GET("/:id/listeners", middleware.RequireLogin(), userSuspension, v1TalkgroupsControllers.GETTalkgroupListeners)
+	v1Talkgroups.GET("/:id/allowed-repeaters", middleware.RequireTalkgroupOwnerOrAdmin(), userSuspension, v1TalkgroupsControllers.GETTalkgroupAllowedRepeaters)
+	v1Talkgroups.POST("/:id/allowed-repeaters", middleware.RequireTalkgroupOwnerOrAdmin(), userSuspension, v1TalkgroupsControllers.POSTTalkgroupAllowedRepeaters)
 	v1Talkgroups.PATCH("/:id", middleware.RequireTalkgroupOwnerOrAdmin(), userSuspension, v1TalkgroupsControllers.PATCHTalkgroup)
 	v1Talkgroups.DELETE("/:id", middleware.RequireAdmin(), userSuspension, v1TalkgroupsControllers.DELETETalkgroup)
+	v1Talkgroups.GET("/:id/quota", middleware.RequireLogin(), userSuspension, v1TalkgroupsControllers.GETTalkgroupQuota)
+	v1Talkgroups.POST("/:id/quota", middleware.RequireTalkgroupOwnerOrAdmin(), userSuspension, v1TalkgroupsControllers.POSTTalkgroupQuota)
+	v1Talkgroups.DELETE("/:id/quota", middleware.RequireTalkgroupOwnerOrAdmin(), userSuspension, v1TalkgroupsControllers.DELETETalkgroupQuota)
+	v1Talkgroups.GET("/:id/quota/usage", middleware.RequireLogin(), userSuspension, v1TalkgroupsControllers.GETTalkgroupQuotaUsage)
+	v1Talkgroups.GET("/:id/quota/usage/:user_id", middleware.RequireTalkgroupOwnerOrAdmin(), userSuspension, v1TalkgroupsControllers.GETTalkgroupQuotaUsage)
+	v1Talkgroups.POST("/:id/archive", middleware.RequireAdmin(), userSuspension, v1TalkgroupsControllers.POSTTalkgroupArchive)
+	v1Talkgroups.GET("/:id/archive/export", middleware.RequireAdmin(), userSuspension, v1TalkgroupsControllers.GETTalkgroupArchiveExport)
+	v1Talkgroups.GET("/:id/archive/verify", middleware.RequireAdmin(), userSuspension, v1TalkgroupsControllers.GETTalkgroupArchiveVerify)
+	v1Talkgroups.GET("/:id/history", middleware.RequireTalkgroupOwnerOrAdmin(), userSuspension, v1TalkgroupsControllers.GETTalkgroupHistory)
+	v1Talkgroups.POST("/:id/history/:version/restore", middleware.RequireAdmin(), userSuspension, v1TalkgroupsControllers.POSTTalkgroupHistoryRestore)
 
 	v1Users := group.Group("/users")
 	// Paginated
 	v1Users.GET("", middleware.RequireAdminOrTGOwner(), userSuspension, v1UsersControllers.GETUsers)
-	v1Users.POST("", v1UsersControllers.POSTUser)
+	v1Users.POST("", middleware.RegistrationRateLimit(), v1UsersControllers.POSTUser)
+	v1Users.POST("/listener", middleware.RegistrationRateLimit(), v1UsersControllers.POSTListener)
 	v1Users.GET("/me", middleware.RequireLogin(), userSuspension, v1UsersControllers.GETUserSelf)
+	v1Users.GET("/me/talkgroup-profile", middleware.RequireLogin(), userSuspension, v1UsersControllers.GETUserTalkgroupProfile)
+	v1Users.POST("/me/talkgroup-profile", middleware.RequireOperator(), userSuspension, v1UsersControllers.POSTUserTalkgroupProfile)
+	v1Users.DELETE("/me/talkgroup-profile", middleware.RequireLogin(), userSuspension, v1UsersControllers.DELETEUserTalkgroupProfile)
+	v1Users.GET("/me/missed-calls", middleware.RequireLogin(), userSuspension, v1UsersControllers.GETUserMissedCalls)
+	v1Users.POST("/me/missed-calls/seen", middleware.RequireLogin(), userSuspension, v1UsersControllers.POSTUserMissedCallsSeen)
+	v1Users.GET("/me/audio-tests", middleware.RequireLogin(), userSuspension, v1UsersControllers.GETUserAudioTests)
+	v1Users.GET("/me/digest", middleware.RequireLogin(), userSuspension, v1UsersControllers.GETUserDigest)
+	v1Users.PUT("/me/digest", middleware.RequireLogin(), userSuspension, v1UsersControllers.PUTUserDigest)
+	v1Users.DELETE("/me/digest", middleware.RequireLogin(), userSuspension, v1UsersControllers.DELETEUserDigest)
 	// Paginated
 	v1Users.GET("/admins", middleware.RequireSuperAdmin(), userSuspension, v1UsersControllers.GETUserAdmins)
 	// Paginated
@@ -107,9 +261,19 @@ func v1(group *gin.RouterGroup, userSuspension gin.HandlerFunc) {
 	v1Users.POST("/approve/:id", middleware.RequireAdmin(), userSuspension, v1UsersControllers.POSTUserApprove)
 	v1Users.POST("/unsuspend/:id", middleware.RequireAdmin(), userSuspension, v1UsersControllers.POSTUserUnsuspend)
 	v1Users.POST("/suspend/:id", middleware.RequireAdmin(), userSuspension, v1UsersControllers.POSTUserSuspend)
+	v1Users.POST("/bulk/approve", middleware.RequireAdmin(), userSuspension, v1UsersControllers.POSTUsersBulkApprove)
+	v1Users.POST("/bulk/suspend", middleware.RequireAdmin(), userSuspension, v1UsersControllers.POSTUsersBulkSuspend)
+	v1Users.POST("/bulk/role", middleware.RequireSuperAdmin(), userSuspension, v1UsersControllers.POSTUsersBulkRole)
+	v1Users.GET("/export", middleware.RequireAdmin(), userSuspension, v1UsersControllers.GETUsersExport)
 	v1Users.GET("/:id", middleware.RequireSelfOrAdmin(), userSuspension, v1UsersControllers.GETUser)
 	v1Users.PATCH("/:id", middleware.RequireSelfOrAdmin(), userSuspension, v1UsersControllers.PATCHUser)
 	v1Users.DELETE("/:id", middleware.RequireSuperAdmin(), userSuspension, v1UsersControllers.DELETEUser)
+	v1Users.GET("/:id/preferences", middleware.RequireSelfOrAdmin(), userSuspension, v1UsersControllers.GETUserPreferences)
+	v1Users.PUT("/:id/preferences", middleware.RequireSelfOrAdmin(), userSuspension, v1UsersControllers.PUTUserPreferences)
+	v1Users.GET("/:id/sessions", middleware.RequireSelfOrAdmin(), userSuspension, v1UsersControllers.GETUserSessions)
+	v1Users.DELETE("/:id/sessions", middleware.RequireSelfOrAdmin(), userSuspension, v1UsersControllers.DELETEUserSessions)
+	v1Users.DELETE("/:id/sessions/:session_id", middleware.RequireSelfOrAdmin(), userSuspension, v1UsersControllers.DELETEUserSession)
+	v1Users.DELETE("/:id/data", middleware.RequireAdmin(), userSuspension, v1UsersControllers.DELETEUserData)
 
 	v1Peers := group.Group("/peers")
 	// Paginated
@@ -119,6 +283,55 @@ func v1(group *gin.RouterGroup, userSuspension gin.HandlerFunc) {
 	v1Peers.POST("", middleware.RequireAdmin(), v1PeersControllers.POSTPeer)
 	v1Peers.GET("/:id", middleware.RequirePeerOwnerOrAdmin(), v1PeersControllers.GETPeer)
 	v1Peers.DELETE("/:id", middleware.RequirePeerOwnerOrAdmin(), v1PeersControllers.DELETEPeer)
+	v1Peers.POST("/:id/max-datagram", middleware.RequireAdmin(), v1PeersControllers.POSTPeerMaxDatagram)
+	v1Peers.POST("/:id/network", middleware.RequireAdmin(), v1PeersControllers.POSTPeerNetwork)
+
+	v1Calls := group.Group("/calls")
+	v1Calls.GET("/heatmap", v1CallsControllers.GETCallsHeatmap)
+	v1Calls.GET("/export", middleware.RequireAdmin(), userSuspension, v1CallsControllers.GETCallsExport)
+	v1Calls.GET("/:id/routing", middleware.RequireAdmin(), userSuspension, v1CallsControllers.GETCallRouting)
+	v1Calls.GET("/:id/telemetry", middleware.RequireLogin(), userSuspension, v1CallsControllers.GETCallTelemetry)
+
+	if config.GetConfig().EnableProfiling {
+		v1Debug := group.Group("/debug", middleware.RequireAdmin(), userSuspension)
+		v1Debug.GET("/runtime", v1DebugControllers.GETRuntime)
+		v1Debug.POST("/benchmark", v1DebugControllers.POSTBenchmark)
+		pprof.RouteRegister(v1Debug, "pprof")
+	}
+
+	if config.GetConfig().EnablePacketInjection {
+		group.POST("/debug/inject", middleware.RequireAdmin(), userSuspension, v1DebugControllers.POSTInject)
+	}
+
+	v1Quarantine := group.Group("/ingress/quarantine")
+	v1Quarantine.GET("", middleware.RequireAdmin(), userSuspension, v1QuarantineControllers.GETQuarantine)
+	v1Quarantine.DELETE("/:ip", middleware.RequireAdmin(), userSuspension, v1QuarantineControllers.DELETEQuarantine)
+
+	v1HubEvents := group.Group("/hubevents")
+	v1HubEvents.GET("", middleware.RequireAdmin(), userSuspension, v1HubEventsControllers.GETHubEvents)
+	v1HubEvents.GET("/state", middleware.RequireAdmin(), userSuspension, v1HubEventsControllers.GETHubState)
+
+	v1Deferred := group.Group("/deferred")
+	// Paginated
+	v1Deferred.GET("", middleware.RequireAdmin(), userSuspension, v1DeferredControllers.GETDeferredData)
+	v1Deferred.DELETE("", middleware.RequireAdmin(), userSuspension, v1DeferredControllers.DELETEDeferredData)
+	v1Deferred.DELETE("/:id", middleware.RequireAdmin(), userSuspension, v1DeferredControllers.DELETEDeferredDataPacket)
+
+	v1Airtime := group.Group("/airtime")
+	v1Airtime.GET("", middleware.RequireAdmin(), userSuspension, v1AirtimeControllers.GETAirtime)
+	v1Airtime.GET("/leaderboard", middleware.RequireLogin(), userSuspension, v1AirtimeControllers.GETAirtimeLeaderboard)
+
+	v1Inhibits := group.Group("/inhibits")
+	v1Inhibits.GET("", middleware.RequireAdmin(), userSuspension, v1InhibitsControllers.GETInhibits)
+	v1Inhibits.POST("", middleware.RequireAdmin(), userSuspension, v1InhibitsControllers.POSTInhibit)
+	v1Inhibits.DELETE("/:id", middleware.RequireAdmin(), userSuspension, v1InhibitsControllers.DELETEInhibit)
+
+	v1Jobs := group.Group("/jobs")
+	// Paginated
+	v1Jobs.GET("", middleware.RequireAdmin(), userSuspension, v1JobsControllers.GETJobs)
+	v1Jobs.GET("/:id", middleware.RequireAdmin(), userSuspension, v1JobsControllers.GETJob)
+	v1Jobs.POST("/:id/retry", middleware.RequireAdmin(), userSuspension, v1JobsControllers.POSTJobRetry)
+	v1Jobs.POST("/:id/dead-letter", middleware.RequireAdmin(), userSuspension, v1JobsControllers.POSTJobDeadLetter)
 
 	v1Lastheard := group.Group("/lastheard")
 	// Returns the lastheard data for the server, adds personal data if logged in
@@ -127,11 +340,45 @@ func v1(group *gin.RouterGroup, userSuspension gin.HandlerFunc) {
 	// Paginated
 	v1Lastheard.GET("/user/:id", middleware.RequireSelfOrAdmin(), userSuspension, v1LastheardControllers.GETLastheardUser)
 	// Paginated
-	v1Lastheard.GET("/repeater/:id", middleware.RequireRepeaterOwnerOrAdmin(), userSuspension, v1LastheardControllers.GETLastheardRepeater)
+	v1Lastheard.GET("/repeater/:id", middleware.RequireRepeaterPermission(models.RepeaterPermissionViewStats), userSuspension, v1LastheardControllers.GETLastheardRepeater)
 	// Paginated
 	v1Lastheard.GET("/talkgroup/:id", middleware.RequireLogin(), userSuspension, v1LastheardControllers.GETLastheardTalkgroup)
 
-	group.GET("/network/name", v1Controllers.GETNetworkName)
+	v1Status := group.Group("/status")
+	v1Status.GET("", v1StatusControllers.GETStatus)
+	v1Status.POST("/incidents", middleware.RequireAdmin(), userSuspension, v1StatusControllers.POSTIncident)
+	v1Status.PATCH("/incidents/:id", middleware.RequireAdmin(), userSuspension, v1StatusControllers.PATCHIncident)
+	v1Status.DELETE("/incidents/:id", middleware.RequireAdmin(), userSuspension, v1StatusControllers.DELETEIncident)
+
+	group.GET("/network/name", middleware.Deprecated(v1DeprecatedAt, v1Sunset, "/api/v1/instance"), v1Controllers.GETNetworkName)
+	group.GET("/instance", v1Controllers.GETInstance)
+	group.PATCH("/instance", middleware.RequireAdmin(), userSuspension, v1Controllers.PATCHInstance)
 	group.GET("/version", v1Controllers.GETVersion)
+	group.GET("/locales", v1Controllers.GETLocales)
 	group.GET("/ping", v1Controllers.GETPing)
 }
+
+// v2 uses the same session as v1, so clients log in through /api/v1/auth/login.
+func v2(group *gin.RouterGroup, userSuspension gin.HandlerFunc) {
+	// Paginated
+	group.GET("/calls", v2Controllers.GETCalls)
+
+	v2Talkgroups := group.Group("/talkgroups")
+	// Paginated
+	v2Talkgroups.GET("", middleware.RequireLogin(), userSuspension, v2Controllers.GETTalkgroups)
+	v2Talkgroups.GET("/:id", middleware.RequireLogin(), userSuspension, v2Controllers.GETTalkgroup)
+
+	v2Repeaters := group.Group("/repeaters")
+	// Paginated
+	v2Repeaters.GET("", middleware.RequireAdmin(), userSuspension, v2Controllers.GETRepeaters)
+	v2Repeaters.GET("/:id", middleware.RequireRepeaterPermission(models.RepeaterPermissionViewStats), userSuspension, v2Controllers.GETRepeater)
+
+	v2Users := group.Group("/users")
+	v2Users.GET("/me", middleware.RequireLogin(), userSuspension, v2Controllers.GETMe)
+	// Paginated
+	v2Users.GET("/me/repeaters", middleware.RequireLogin(), userSuspension, v2Controllers.GETMyRepeaters)
+	// Paginated
+	v2Users.GET("/me/calls", middleware.RequireLogin(), userSuspension, v2Controllers.GETMyCalls)
+
+	group.GET("/sync", middleware.RequireLogin(), userSuspension, v2Controllers.GETSync)
+}
@@ -18,3 +18,28 @@
 // The source code is available at <https://github.com/USA-RedDragon/DMRHub>
 
 package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/openapi"
+	"github.com/gin-gonic/gin"
+)
+
+func TestEveryV1RouteIsDocumented(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	noop := func(c *gin.Context) { c.Next() }
+	ApplyRoutes(router, nil, nil, noop, noop)
+
+	spec := openapi.Build("DMRHub API", "1.0.0", "/api/v1", openapi.V1())
+	for _, route := range router.Routes() {
+		if !strings.HasPrefix(route.Path, "/api/v1/") || strings.HasPrefix(route.Path, "/api/v1/debug/pprof") {
+			continue
+		}
+		if _, ok := spec.Operation(route.Method, route.Path); !ok {
+			t.Errorf("%s %s is missing from openapi.V1", route.Method, route.Path)
+		}
+	}
+}
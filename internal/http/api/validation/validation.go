@@ -0,0 +1,373 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package validation binds, sanitizes and validates API request bodies and
+// reports failures as machine-readable field errors.
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/i18n"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/text/language"
+)
+
+const (
+	minCallsignLength = 3
+	maxCallsignLength = 8
+
+	minUserID     = 1000000
+	maxUserID     = 9999999
+	minRepeaterID = 100000
+	maxRepeaterID = 999999
+	// Hotspots use the owner's DMR ID with a two digit suffix
+	minHotspotID = 100000000
+	maxHotspotID = 999999999
+
+	// DMR talkgroup and radio IDs are 24 bits
+	maxTalkgroupID = 0xFFFFFF
+	maxColorCode   = 15
+
+	// Bounds of the VHF and UHF ranges DMR radios transmit on, in Hz
+	minVHFFrequency = 136000000
+	maxVHFFrequency = 174000000
+	minUHFFrequency = 400000000
+	maxUHFFrequency = 527000000
+)
+
+// regionRegex matches an ISO 3166-1 alpha-2 country code, optionally followed
+// by an ISO 3166-2 subdivision such as US-TX
+var regionRegex = regexp.MustCompile(`^[A-Z]{2}(-[A-Z0-9]{1,3})?$`)
+
+var ErrEmptyBody = errors.New("request body is empty")
+
+// FieldError describes why a single field failed validation
+type FieldError struct {
+	// Field is the JSON path of the field, such as "callsign" or "ts1_static_talkgroups[0].id"
+	Field string `json:"field"`
+	// Tag is the validation rule that failed, such as "required" or "callsign"
+	Tag string `json:"tag"`
+	// Param is the rule's parameter, such as the 20 in max=20
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// messageKeys maps validation tags to i18n message keys.
+// Tags without an entry use validation_invalid.
+//
+//nolint:golint,gochecknoglobals
+var messageKeys = map[string]string{
+	"required":    "validation_required",
+	"max":         "validation_max",
+	"min":         "validation_min",
+	"oneof":       "validation_oneof",
+	"email":       "validation_email",
+	"callsign":    "callsign_invalid",
+	"dmrid":       "dmr_id_invalid",
+	"repeaterid":  "repeater_id_invalid",
+	"talkgroupid": "talkgroup_id_invalid",
+	"colorcode":   "color_code_invalid",
+	"frequency":   "frequency_invalid",
+	"timezone":    "timezone_invalid",
+	"slot":        "slot_invalid",
+	"language":    "language_invalid",
+	"region":      "region_invalid",
+	"bridgehint":  "bridge_hint_invalid",
+	"codecpolicy": "codec_policy_invalid",
+}
+
+//nolint:golint,gochecknoglobals
+var registerOnce sync.Once
+
+// Register adds DMRHub's validation tags to gin's validator so they can be used
+// in `binding` struct tags. It is safe to call more than once.
+func Register() {
+	registerOnce.Do(func() {
+		engine, ok := binding.Validator.Engine().(*validator.Validate)
+		if !ok {
+			logging.Error("Unexpected validator engine, custom validation tags are unavailable")
+			return
+		}
+		engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+		validators := map[string]validator.Func{
+			"callsign":    validateCallsign,
+			"dmrid":       uintInRange(minUserID, maxUserID),
+			"repeaterid":  validateRepeaterID,
+			"talkgroupid": uintInRange(1, maxTalkgroupID),
+			"colorcode":   uintInRange(0, maxColorCode),
+			"frequency":   validateFrequency,
+			"timezone":    validateTimezone,
+			"slot":        uintInRange(1, 2),
+			"language":    validateLanguage,
+			"region":      validateRegion,
+			"bridgehint":  validateBridgeHint,
+			"codecpolicy": validateCodecPolicy,
+		}
+		for tag, fn := range validators {
+			if err := engine.RegisterValidation(tag, fn); err != nil {
+				logging.Errorf("Failed to register validation tag %s: %v", tag, err)
+			}
+		}
+	})
+}
+
+// BindJSON decodes the request body into obj, sanitizes it according to its
+// `sanitize` struct tags, then validates it against its `binding` tags
+func BindJSON(c *gin.Context, obj any) error {
+	Register()
+	if c.Request == nil || c.Request.Body == nil {
+		return ErrEmptyBody
+	}
+	decoder := json.NewDecoder(c.Request.Body)
+	if binding.EnableDecoderUseNumber {
+		decoder.UseNumber()
+	}
+	if binding.EnableDecoderDisallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(obj); err != nil {
+		return fmt.Errorf("failed to decode JSON: %w", err)
+	}
+	Sanitize(obj)
+	if err := binding.Validator.ValidateStruct(obj); err != nil {
+		return fmt.Errorf("failed to validate JSON: %w", err)
+	}
+	return nil
+}
+
+// Respond writes a 400 for an error returned by BindJSON. Validation failures
+// list every failing field, and the top level error is the first field's message.
+func Respond(c *gin.Context, err error) {
+	fields := Errors(c, err)
+	if len(fields) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Translate(c, "json_invalid")})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": fields[0].Message, "fields": fields})
+}
+
+// Errors converts validation failures in err into translated field errors
+func Errors(c *gin.Context, err error) []FieldError {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return nil
+	}
+	fields := make([]FieldError, 0, len(validationErrors))
+	for _, fieldErr := range validationErrors {
+		field := fieldPath(fieldErr.Namespace())
+		key, ok := messageKeys[fieldErr.Tag()]
+		if !ok {
+			key = "validation_invalid"
+		}
+		var message string
+		switch key {
+		case "validation_required", "validation_email", "validation_invalid":
+			message = i18n.Translate(c, key, field)
+		case "validation_max", "validation_min", "validation_oneof":
+			message = i18n.Translate(c, key, field, fieldErr.Param())
+		default:
+			message = i18n.Translate(c, key)
+		}
+		fields = append(fields, FieldError{
+			Field:   field,
+			Tag:     fieldErr.Tag(),
+			Param:   fieldErr.Param(),
+			Message: message,
+		})
+	}
+	return fields
+}
+
+// fieldPath strips the struct name from a validator namespace like UserPatch.callsign
+func fieldPath(namespace string) string {
+	_, path, found := strings.Cut(namespace, ".")
+	if !found {
+		return namespace
+	}
+	return path
+}
+
+// Sanitize normalizes string fields tagged with `sanitize`. Supported
+// options are "trim" to strip surrounding whitespace and "upper" to
+// uppercase, such as `sanitize:"trim,upper"` on a callsign.
+func Sanitize(obj any) {
+	sanitizeValue(reflect.ValueOf(obj))
+}
+
+func sanitizeValue(v reflect.Value) {
+	switch v.Kind() { //nolint:golint,exhaustive
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			sanitizeValue(v.Elem())
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			sanitizeValue(v.Index(i))
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Field(i)
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			options := t.Field(i).Tag.Get("sanitize")
+			if options == "" {
+				sanitizeValue(field)
+				continue
+			}
+			sanitizeString(field, strings.Split(options, ","))
+		}
+	}
+}
+
+func sanitizeString(v reflect.Value, options []string) {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.String || !v.CanSet() {
+		return
+	}
+	s := v.String()
+	for _, option := range options {
+		switch option {
+		case "trim":
+			s = strings.TrimSpace(s)
+		case "upper":
+			s = strings.ToUpper(s)
+		}
+	}
+	v.SetString(s)
+}
+
+// uintValue returns the value of an unsigned or non-negative integer field
+func uintValue(field reflect.Value) (uint64, bool) {
+	switch field.Kind() { //nolint:golint,exhaustive
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return field.Uint(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if field.Int() < 0 {
+			return 0, false
+		}
+		return uint64(field.Int()), true
+	default:
+		return 0, false
+	}
+}
+
+func uintInRange(lowest, highest uint64) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		value, ok := uintValue(fl.Field())
+		return ok && value >= lowest && value <= highest
+	}
+}
+
+func validateCallsign(fl validator.FieldLevel) bool {
+	callsign := strings.ToUpper(fl.Field().String())
+	if len(callsign) < minCallsignLength || len(callsign) > maxCallsignLength {
+		return false
+	}
+	return dmrconst.CallsignRegex.MatchString(callsign)
+}
+
+// validateRepeaterID accepts six digit repeater IDs and seven or nine digit hotspot IDs
+func validateRepeaterID(fl validator.FieldLevel) bool {
+	id, ok := uintValue(fl.Field())
+	return ok && ((id >= minRepeaterID && id <= maxRepeaterID) ||
+		(id >= minUserID && id <= maxUserID) ||
+		(id >= minHotspotID && id <= maxHotspotID))
+}
+
+// validateFrequency checks a frequency in Hz is within the VHF or UHF range
+func validateFrequency(fl validator.FieldLevel) bool {
+	hz, ok := uintValue(fl.Field())
+	return ok && ((hz >= minVHFFrequency && hz <= maxVHFFrequency) ||
+		(hz >= minUHFFrequency && hz <= maxUHFFrequency))
+}
+
+func validateTimezone(fl validator.FieldLevel) bool {
+	name := fl.Field().String()
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// validateLanguage accepts a BCP 47 language tag such as "en" or "pt-BR".
+// An empty value is accepted so PATCH requests can clear the field.
+func validateLanguage(fl validator.FieldLevel) bool {
+	tag := fl.Field().String()
+	if tag == "" {
+		return true
+	}
+	_, err := language.Parse(tag)
+	return err == nil
+}
+
+// validateRegion accepts an ISO 3166 country or subdivision code.
+// An empty value is accepted so PATCH requests can clear the field.
+func validateRegion(fl validator.FieldLevel) bool {
+	region := fl.Field().String()
+	return region == "" || regionRegex.MatchString(region)
+}
+
+func validateBridgeHint(fl validator.FieldLevel) bool {
+	switch models.BridgeHint(fl.Field().String()) {
+	case models.BridgeHintNone, models.BridgeHintShare, models.BridgeHintLocal:
+		return true
+	default:
+		return false
+	}
+}
+
+func validateCodecPolicy(fl validator.FieldLevel) bool {
+	switch models.CodecPolicy(fl.Field().String()) {
+	case models.CodecPolicyBlock, models.CodecPolicyPassthrough, models.CodecPolicyTranscode:
+		return true
+	default:
+		return false
+	}
+}
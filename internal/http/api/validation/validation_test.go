@@ -0,0 +1,163 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package validation_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/validation"
+	"github.com/gin-gonic/gin"
+)
+
+type testRequest struct {
+	Callsign string  `json:"callsign" binding:"required,callsign" sanitize:"trim,upper"`
+	DMRID    uint    `json:"dmr_id" binding:"omitempty,dmrid"`
+	Repeater uint    `json:"repeater_id" binding:"omitempty,repeaterid"`
+	TG       uint    `json:"talkgroup" binding:"omitempty,talkgroupid"`
+	Color    *uint8  `json:"color_code" binding:"omitempty,colorcode"`
+	Freq     uint    `json:"frequency" binding:"omitempty,frequency"`
+	Timezone string  `json:"timezone" binding:"omitempty,timezone"`
+	Slot     uint    `json:"slot" binding:"omitempty,slot"`
+	Language *string `json:"language" binding:"omitempty,language"`
+	Region   *string `json:"region" binding:"omitempty,region"`
+	Hint     string  `json:"bridge_hint" binding:"omitempty,bridgehint"`
+	Codec    string  `json:"codec_policy" binding:"omitempty,codecpolicy"`
+	Password string  `json:"password"`
+	Note     *string `json:"note" sanitize:"trim"`
+}
+
+func bind(t *testing.T, body string) (testRequest, *httptest.ResponseRecorder, error) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	var req testRequest
+	err := validation.BindJSON(c, &req)
+	if err != nil {
+		validation.Respond(c, err)
+	}
+	return req, w, err
+}
+
+func TestBindJSONSanitizes(t *testing.T) {
+	t.Parallel()
+	req, _, err := bind(t, `{"callsign": " ki5vmf ", "password": " secret ", "note": "  hi  ", "dmr_id": 3191868,
+		"repeater_id": 311860, "talkgroup": 3100, "color_code": 0, "frequency": 444000000, "timezone": "America/Chicago", "slot": 2,
+		"language": "en-US", "region": "US-TX", "bridge_hint": "share", "codec_policy": "transcode"}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if req.Callsign != "KI5VMF" {
+		t.Errorf("Expected the callsign to be trimmed and uppercased, got %q", req.Callsign)
+	}
+	if req.Password != " secret " {
+		t.Errorf("Expected untagged fields to be left alone, got %q", req.Password)
+	}
+	if req.Note == nil || *req.Note != "hi" {
+		t.Errorf("Expected pointer fields to be trimmed, got %v", req.Note)
+	}
+}
+
+func TestBindJSONFieldErrors(t *testing.T) {
+	t.Parallel()
+	_, w, err := bind(t, `{"callsign": "not a callsign", "dmr_id": 12, "repeater_id": 12345678, "talkgroup": 16777216,
+		"color_code": 16, "frequency": 300000000, "timezone": "Mars/Olympus_Mons", "slot": 3,
+		"language": "not a language", "region": "Texas", "bridge_hint": "everywhere", "codec_policy": "allow"}`)
+	if err == nil {
+		t.Fatal("Expected a validation error")
+	}
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", w.Code)
+	}
+	var resp struct {
+		Error  string                  `json:"error"`
+		Fields []validation.FieldError `json:"fields"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	want := map[string]string{
+		"callsign":     "callsign",
+		"dmr_id":       "dmrid",
+		"repeater_id":  "repeaterid",
+		"talkgroup":    "talkgroupid",
+		"color_code":   "colorcode",
+		"frequency":    "frequency",
+		"timezone":     "timezone",
+		"slot":         "slot",
+		"language":     "language",
+		"region":       "region",
+		"bridge_hint":  "bridgehint",
+		"codec_policy": "codecpolicy",
+	}
+	if len(resp.Fields) != len(want) {
+		t.Fatalf("Expected %d field errors, got %+v", len(want), resp.Fields)
+	}
+	for _, field := range resp.Fields {
+		if want[field.Field] != field.Tag {
+			t.Errorf("Unexpected field error %+v", field)
+		}
+		if field.Message == "" {
+			t.Errorf("Expected a message for %s", field.Field)
+		}
+	}
+	if resp.Error != "Invalid callsign" {
+		t.Errorf("Expected the first field's message as the error, got %q", resp.Error)
+	}
+}
+
+func TestBindJSONClearsMetadata(t *testing.T) {
+	t.Parallel()
+	// PATCH requests send empty strings to clear optional metadata
+	req, _, err := bind(t, `{"callsign": "KI5VMF", "language": "", "region": "", "bridge_hint": ""}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if req.Language == nil || *req.Language != "" || req.Region == nil || *req.Region != "" {
+		t.Errorf("Expected empty metadata to be kept, got %v %v", req.Language, req.Region)
+	}
+}
+
+func TestBindJSONRequired(t *testing.T) {
+	t.Parallel()
+	_, w, err := bind(t, `{"callsign": "   "}`)
+	if err == nil {
+		t.Fatal("Expected a validation error")
+	}
+	if !strings.Contains(w.Body.String(), `"tag":"required"`) {
+		t.Errorf("Expected a required error for a blank callsign, got %s", w.Body.String())
+	}
+}
+
+func TestBindJSONMalformed(t *testing.T) {
+	t.Parallel()
+	_, w, err := bind(t, `{"callsign":`)
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if strings.Contains(w.Body.String(), "fields") {
+		t.Errorf("Expected no field errors for malformed JSON, got %s", w.Body.String())
+	}
+}
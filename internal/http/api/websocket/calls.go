@@ -27,6 +27,7 @@ import (
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers/hbrp"
 	"github.com/USA-RedDragon/DMRHub/internal/http/websocket"
 	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/pubsub"
 	"github.com/gin-contrib/sessions"
 	gorillaWebsocket "github.com/gorilla/websocket"
 	"github.com/redis/go-redis/v9"
@@ -70,14 +71,17 @@ func (c *CallsWebsocket) OnConnect(ctx context.Context, _ *http.Request, w webso
 	}
 
 	go func() {
-		channel := c.subscription.Channel()
+		channel := pubsub.Receive(newCtx, c.subscription, "websocket")
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			case <-newCtx.Done():
 				return
-			case msg := <-channel:
+			case msg, ok := <-channel:
+				if !ok {
+					return
+				}
 				w.WriteMessage(websocket.Message{
 					Type: gorillaWebsocket.TextMessage,
 					Data: []byte(msg.Payload),
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package websocket
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/USA-RedDragon/DMRHub/internal/events"
+	"github.com/USA-RedDragon/DMRHub/internal/http/websocket"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-contrib/sessions"
+	gorillaWebsocket "github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+type EventsWebsocket struct {
+	websocket.Websocket
+	redis        *redis.Client
+	db           *gorm.DB
+	subscription *redis.PubSub
+	cancel       context.CancelFunc
+}
+
+func CreateEventsWebsocket(db *gorm.DB, redis *redis.Client) *EventsWebsocket {
+	return &EventsWebsocket{
+		redis: redis,
+		db:    db,
+	}
+}
+
+func (c *EventsWebsocket) OnMessage(_ context.Context, _ *http.Request, _ websocket.Writer, _ sessions.Session, _ []byte, _ int) {
+}
+
+func (c *EventsWebsocket) OnConnect(ctx context.Context, _ *http.Request, w websocket.Writer, _ sessions.Session) {
+	newCtx, cancel := context.WithCancel(ctx)
+	c.cancel = cancel
+
+	c.subscription = c.redis.Subscribe(ctx, events.AdminChannel)
+
+	go func() {
+		channel := c.subscription.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-newCtx.Done():
+				return
+			case msg := <-channel:
+				w.WriteMessage(websocket.Message{
+					Type: gorillaWebsocket.TextMessage,
+					Data: []byte(msg.Payload),
+				})
+			}
+		}
+	}()
+}
+
+func (c *EventsWebsocket) OnDisconnect(_ context.Context, _ *http.Request, _ sessions.Session) {
+	err := c.subscription.Close()
+	if err != nil {
+		logging.Errorf("Failed to close pubsub: %v", err)
+	}
+	c.cancel()
+}
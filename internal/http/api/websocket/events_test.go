@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package websocket_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/events"
+	apiWebsocket "github.com/USA-RedDragon/DMRHub/internal/http/api/websocket"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	gorillaWebsocket "github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+func TestEventsStreamsAdminEvents(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	_, redis := fakeredis.New(t)
+	ws := apiWebsocket.CreateEventsWebsocket(db, redis)
+	writer := make(recordingWriter, 10)
+	router := testutils.ControllerRouter(db, redis, 1)
+	router.GET("/ws", func(c *gin.Context) {
+		// The handler's request context ends with the request, so stream on one that outlives it
+		ws.OnConnect(context.Background(), c.Request, writer, sessions.Default(c))
+		t.Cleanup(func() { ws.OnDisconnect(context.Background(), c.Request, sessions.Default(c)) })
+	})
+	testutils.Do(t, router, http.MethodGet, "/ws", nil)
+
+	// The subscription is made asynchronously, so keep publishing until it is live
+	deadline := time.After(time.Second)
+	for {
+		events.Publish(context.Background(), redis, events.UserRegistered, "N0CALL registered", nil)
+		select {
+		case msg := <-writer:
+			if msg.Type != gorillaWebsocket.TextMessage {
+				t.Fatalf("Expected a text message, got type %d", msg.Type)
+			}
+			var event events.Event
+			if err := json.Unmarshal(msg.Data, &event); err != nil {
+				t.Fatalf("Failed to decode event %q: %v", msg.Data, err)
+			}
+			if event.Type != events.UserRegistered || event.Message != "N0CALL registered" {
+				t.Errorf("Unexpected event: %+v", event)
+			}
+			return
+		case <-time.After(20 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("Timed out waiting for the event")
+		}
+	}
+}
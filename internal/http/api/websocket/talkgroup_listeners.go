@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package websocket
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers/hbrp"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/websocket"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/gin-contrib/sessions"
+	gorillaWebsocket "github.com/gorilla/websocket"
+	"github.com/puzpuzpuz/xsync/v3"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	// listenerCountInterval is how often the counts are checked for changes.
+	// It is well under servers.WebListenerTTL, so it also keeps this client's listens alive.
+	listenerCountInterval = 5 * time.Second
+	maxWatchedTalkgroups  = 20
+)
+
+// TalkgroupListenersWebsocket sends listener counts for the talkgroups given in ?talkgroup= whenever they change.
+// With ?listen=true the client is itself counted as a web listener on those talkgroups.
+type TalkgroupListenersWebsocket struct {
+	websocket.Websocket
+	redis *redis.Client
+	db    *gorm.DB
+	// cancels holds each connection's cleanup, since one handler serves every connection
+	cancels *xsync.MapOf[*http.Request, context.CancelFunc]
+}
+
+func CreateTalkgroupListenersWebsocket(db *gorm.DB, redis *redis.Client) *TalkgroupListenersWebsocket {
+	return &TalkgroupListenersWebsocket{
+		redis:   redis,
+		db:      db,
+		cancels: xsync.NewMapOf[*http.Request, context.CancelFunc](),
+	}
+}
+
+func (c *TalkgroupListenersWebsocket) OnMessage(_ context.Context, _ *http.Request, _ websocket.Writer, _ sessions.Session, _ []byte, _ int) {
+}
+
+func (c *TalkgroupListenersWebsocket) OnConnect(ctx context.Context, r *http.Request, w websocket.Writer, session sessions.Session) {
+	var user models.User
+	if userID, ok := session.Get("user_id").(uint); ok {
+		var err error
+		user, err = models.FindUserByID(c.db, userID)
+		if err != nil {
+			logging.Errorf("Failed to find user %d: %v", userID, err)
+			closeWith(w, gorillaWebsocket.CloseInternalServerErr, "try again later")
+			return
+		}
+	}
+	talkgroupIDs := c.watchedTalkgroups(r, user)
+	if len(talkgroupIDs) == 0 {
+		closeWith(w, gorillaWebsocket.ClosePolicyViolation, "no talkgroups to watch")
+		return
+	}
+
+	redisClient := servers.MakeRedisClient(c.redis)
+	listenerID := ""
+	if listen, _ := strconv.ParseBool(r.URL.Query().Get("listen")); listen {
+		raw := make([]byte, 16)
+		if _, err := rand.Read(raw); err != nil {
+			logging.Errorf("Failed to generate a web listener ID: %v", err)
+			closeWith(w, gorillaWebsocket.CloseInternalServerErr, "try again later")
+			return
+		}
+		listenerID = hex.EncodeToString(raw)
+	}
+
+	newCtx, cancel := context.WithCancel(ctx)
+	c.cancels.Store(r, func() {
+		cancel()
+		for _, talkgroupID := range talkgroupIDs {
+			if listenerID != "" {
+				// The request context is done by now, so don't let it stop the cleanup
+				redisClient.RemoveWebListener(context.WithoutCancel(ctx), talkgroupID, listenerID)
+			}
+		}
+	})
+
+	go func() {
+		ticker := time.NewTicker(listenerCountInterval)
+		defer ticker.Stop()
+		var last []apimodels.TalkgroupListeners
+		for {
+			counts := make([]apimodels.TalkgroupListeners, 0, len(talkgroupIDs))
+			for _, talkgroupID := range talkgroupIDs {
+				if listenerID != "" {
+					redisClient.AddWebListener(newCtx, talkgroupID, listenerID)
+				}
+				listeners, err := hbrp.CountTalkgroupListeners(newCtx, c.db, redisClient, talkgroupID)
+				if err != nil {
+					logging.Errorf("Error counting listeners on talkgroup %d: %v", talkgroupID, err)
+					continue
+				}
+				counts = append(counts, listeners)
+			}
+			if !slices.Equal(counts, last) {
+				data, err := json.Marshal(counts)
+				if err != nil {
+					logging.Errorf("Error marshalling talkgroup listeners: %v", err)
+				} else {
+					w.WriteMessage(websocket.Message{
+						Type: gorillaWebsocket.TextMessage,
+						Data: data,
+					})
+					last = counts
+				}
+			}
+
+			select {
+			case <-newCtx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (c *TalkgroupListenersWebsocket) OnDisconnect(_ context.Context, r *http.Request, _ sessions.Session) {
+	if cancel, ok := c.cancels.LoadAndDelete(r); ok {
+		cancel()
+	}
+}
+
+// watchedTalkgroups parses the talkgroups named in the query, dropping any that don't exist or the user can't see
+func (c *TalkgroupListenersWebsocket) watchedTalkgroups(r *http.Request, user models.User) []uint {
+	var talkgroupIDs []uint
+	for _, param := range r.URL.Query()["talkgroup"] {
+		id, err := strconv.ParseUint(param, 10, 32)
+		if err != nil || slices.Contains(talkgroupIDs, uint(id)) {
+			continue
+		}
+		visible, err := models.TalkgroupVisibleTo(c.db, uint(id), user)
+		if err != nil || !visible {
+			continue
+		}
+		talkgroupIDs = append(talkgroupIDs, uint(id))
+		if len(talkgroupIDs) == maxWatchedTalkgroups {
+			break
+		}
+	}
+	return talkgroupIDs
+}
+
+// closeWith asks the client to close the connection. Writer.Error can't be used before OnConnect returns.
+func closeWith(w websocket.Writer, code int, reason string) {
+	w.WriteMessage(websocket.Message{
+		Type: gorillaWebsocket.CloseMessage,
+		Data: gorillaWebsocket.FormatCloseMessage(code, reason),
+	})
+}
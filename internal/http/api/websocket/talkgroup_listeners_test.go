@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package websocket_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	apiWebsocket "github.com/USA-RedDragon/DMRHub/internal/http/api/websocket"
+	"github.com/USA-RedDragon/DMRHub/internal/http/websocket"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	gorillaWebsocket "github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+type recordingWriter chan websocket.Message
+
+func (w recordingWriter) WriteMessage(message websocket.Message) {
+	w <- message
+}
+
+func (w recordingWriter) Error(_ string) {}
+
+func (w recordingWriter) next(t *testing.T) websocket.Message {
+	t.Helper()
+	select {
+	case msg := <-w:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for a message")
+	}
+	return websocket.Message{}
+}
+
+// connect runs OnConnect for a user, as the websocket handler would once the connection is upgraded
+func connect(t *testing.T, db *gorm.DB, userID uint, query string) recordingWriter {
+	t.Helper()
+	_, redis := fakeredis.New(t)
+	ws := apiWebsocket.CreateTalkgroupListenersWebsocket(db, redis)
+	writer := make(recordingWriter, 10)
+	router := testutils.ControllerRouter(db, redis, userID)
+	router.GET("/ws", func(c *gin.Context) {
+		ws.OnConnect(c.Request.Context(), c.Request, writer, sessions.Default(c))
+		t.Cleanup(func() { ws.OnDisconnect(c.Request.Context(), c.Request, sessions.Default(c)) })
+	})
+	testutils.Do(t, router, http.MethodGet, "/ws?"+query, nil)
+	return writer
+}
+
+func TestTalkgroupListenersHidesPrivateTalkgroups(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Talkgroup{}, &models.TalkgroupAllowedRepeater{}, &models.Repeater{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	db.Create(&models.User{ID: 1, Callsign: "N0CALL", Username: "n0call", Approved: true})
+	db.Create(&models.User{ID: 2, Callsign: "N0MEM", Username: "n0mem", Approved: true})
+	db.Create(&models.Talkgroup{ID: 3100, Name: "Public"})
+	db.Create(&models.Talkgroup{ID: 3101, Name: "Private", Private: true})
+	repeater := models.Repeater{OwnerID: 2}
+	repeater.ID = 311002
+	db.Create(&repeater)
+	db.Create(&models.TalkgroupAllowedRepeater{TalkgroupID: 3101, RepeaterID: repeater.ID})
+
+	// A non-member asking only for the private talkgroup has nothing to watch
+	msg := connect(t, db, 1, "talkgroup=3101").next(t)
+	if msg.Type != gorillaWebsocket.CloseMessage {
+		t.Fatalf("Expected the connection to be closed, got a type %d message: %s", msg.Type, msg.Data)
+	}
+	if code := int(msg.Data[0])<<8 | int(msg.Data[1]); code != gorillaWebsocket.ClosePolicyViolation {
+		t.Errorf("Expected a policy violation close, got %d", code)
+	}
+
+	tests := []struct {
+		name   string
+		userID uint
+		want   []uint
+	}{
+		{"non-member", 1, []uint{3100}},
+		{"member", 2, []uint{3100, 3101}},
+	}
+	for _, tt := range tests {
+		msg := connect(t, db, tt.userID, "talkgroup=3100&talkgroup=3101").next(t)
+		var counts []apimodels.TalkgroupListeners
+		if err := json.Unmarshal(msg.Data, &counts); err != nil {
+			t.Fatalf("%s: failed to decode counts %q: %v", tt.name, msg.Data, err)
+		}
+		var got []uint
+		for _, count := range counts {
+			got = append(got, count.TalkgroupID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: expected counts for %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
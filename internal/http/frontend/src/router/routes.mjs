@@ -37,6 +37,15 @@ export default (features) => {
       },
       component: () => import('../views/LastHeard.vue'),
     },
+    {
+      path: '/status',
+      name: 'Status',
+      sitemap: {
+        changefreq: 'daily',
+        priority: 0.75,
+      },
+      component: () => import('../views/StatusPage.vue'),
+    },
     {
       path: '/login',
       name: 'Login',
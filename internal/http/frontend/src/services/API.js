@@ -26,14 +26,31 @@ const instance = axios.create({
   withCredentials: true,
 });
 
+// When CSRF protection is on, the server sends a token on every response to a
+// logged in session and expects it back on state-changing requests
+let csrfToken = '';
+
+instance.interceptors.request.use((config) => {
+  if (csrfToken) {
+    config.headers['X-CSRF-Token'] = csrfToken;
+  }
+  return config;
+});
+
 instance.interceptors.response.use(
   (response) => {
+    if (response.headers['x-csrf-token']) {
+      csrfToken = response.headers['x-csrf-token'];
+    }
     return response;
   },
   (error) => {
     if (error.response === undefined) {
       return Promise.reject(error);
     }
+    if (error.response.headers['x-csrf-token']) {
+      csrfToken = error.response.headers['x-csrf-token'];
+    }
     const status = error.response.status;
     if (
       window.location.pathname !== '/login' &&
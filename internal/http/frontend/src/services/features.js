@@ -20,6 +20,7 @@
 import API from './API.js';
 
 let features = [];
+let captcha = {};
 
 export default {
   OpenBridge: 'openbridge',
@@ -31,6 +32,7 @@ export default {
           return;
         }
         features = response.data.features;
+        captcha = response.data.captcha || {};
         resolve(this);
       }).catch((error) => {
         console.error(error);
@@ -41,4 +43,8 @@ export default {
   isEnabled(feature) {
     return features.includes(feature);
   },
+  // The CAPTCHA provider and site key registration needs, empty when CAPTCHAs are off
+  captcha() {
+    return captcha;
+  },
 };
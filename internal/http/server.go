@@ -25,18 +25,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"path"
 	"strings"
 	"time"
 
-	ratelimit "github.com/JGLTechnologies/gin-rate-limit"
 	"github.com/USA-RedDragon/DMRHub/internal/config"
 	"github.com/USA-RedDragon/DMRHub/internal/http/api"
 	"github.com/USA-RedDragon/DMRHub/internal/http/api/middleware"
 	redisSessions "github.com/USA-RedDragon/DMRHub/internal/http/sessions"
 	"github.com/USA-RedDragon/DMRHub/internal/logging"
-	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/pprof"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -50,15 +49,24 @@ var (
 	ErrReadDir = errors.New("error reading directory")
 )
 
+// Server serves the public site and API on HTTPListen. When ADMIN_HTTP_LISTEN is set,
+// admin endpoints are only reachable through admin, a second server on those addresses.
 type Server struct {
 	*http.Server
+	admin           *http.Server
+	addrs           []string
+	adminAddrs      []string
 	shutdownChannel chan bool
 }
 
+// boundListener is a listener and the server that serves it
+type boundListener struct {
+	server   *http.Server
+	listener net.Listener
+}
+
 const defTimeout = 10 * time.Second
 const debugWriteTimeout = 60 * time.Second
-const rateLimitRate = time.Second
-const rateLimitLimit = 10
 
 func MakeServer(db *gorm.DB, redisClient *redis.Client, version, commit string) Server {
 	if config.GetConfig().Debug {
@@ -74,18 +82,33 @@ func MakeServer(db *gorm.DB, redisClient *redis.Client, version, commit string)
 		writeTimeout = debugWriteTimeout
 	}
 
-	logging.Errorf("HTTP Server listening at %s on port %d\n", config.GetConfig().ListenAddr, config.GetConfig().HTTPPort)
 	s := &http.Server{
-		Addr:         fmt.Sprintf("%s:%d", config.GetConfig().ListenAddr, config.GetConfig().HTTPPort),
 		Handler:      r,
 		ReadTimeout:  defTimeout,
 		WriteTimeout: writeTimeout,
 	}
 	s.SetKeepAlivesEnabled(false)
 
+	adminAddrs := config.GetConfig().AdminHTTPListen
+	var admin *http.Server
+	if len(adminAddrs) > 0 {
+		admin = &http.Server{
+			Handler:      r,
+			ReadTimeout:  defTimeout,
+			WriteTimeout: writeTimeout,
+			BaseContext: func(net.Listener) context.Context {
+				return middleware.AdminListenerContext(context.Background())
+			},
+		}
+		admin.SetKeepAlivesEnabled(false)
+	}
+
 	return Server{
-		s,
-		make(chan bool),
+		Server:          s,
+		admin:           admin,
+		addrs:           config.GetConfig().HTTPListen,
+		adminAddrs:      adminAddrs,
+		shutdownChannel: make(chan bool, len(config.GetConfig().HTTPListen)+len(adminAddrs)),
 	}
 }
 
@@ -98,7 +121,7 @@ var FS embed.FS
 func addMiddleware(r *gin.Engine, db *gorm.DB, redisClient *redis.Client, version, commit string) {
 	// Debug
 	if config.GetConfig().Debug {
-		pprof.Register(r)
+		pprof.RouteRegister(r.Group("", middleware.RequireAdminListener()), pprof.DefaultPrefix)
 	}
 
 	// Tracing
@@ -113,14 +136,16 @@ func addMiddleware(r *gin.Engine, db *gorm.DB, redisClient *redis.Client, versio
 	r.Use(middleware.RedisProvider(redisClient))
 
 	// CORS
-	corsConfig := cors.DefaultConfig()
-	corsConfig.AllowCredentials = true
-	corsConfig.AllowOrigins = config.GetConfig().CORSHosts
-	r.Use(cors.New(corsConfig))
+	r.Use(middleware.CORS())
 
 	// Sessions
 	sessionStore, _ := redisSessions.NewStore(redisClient, config.GetConfig().Secret, config.GetConfig().Secret)
 	r.Use(sessions.Sessions("sessions", sessionStore))
+	r.Use(middleware.SessionTracker())
+	r.Use(middleware.CSRF())
+
+	// Translations
+	r.Use(middleware.LocaleProvider())
 
 	// Versioning
 	r.Use(middleware.VersionProvider(version, commit))
@@ -144,23 +169,9 @@ func CreateRouter(db *gorm.DB, redisClient *redis.Client, version, commit string
 
 	addMiddleware(r, db, redisClient, version, commit)
 
-	ratelimitStore := ratelimit.RedisStore(&ratelimit.RedisOptions{
-		RedisClient: redisClient,
-		Rate:        rateLimitRate,
-		Limit:       rateLimitLimit,
-	})
-	ratelimitMW := ratelimit.RateLimiter(ratelimitStore, &ratelimit.Options{
-		ErrorHandler: func(c *gin.Context, info ratelimit.Info) {
-			c.String(http.StatusTooManyRequests, "Too many requests. Try again in "+time.Until(info.ResetTime).String())
-		},
-		KeyFunc: func(c *gin.Context) string {
-			return c.ClientIP()
-		},
-	})
-
 	userLockoutMiddleware := middleware.SuspendedUserLockout()
 
-	api.ApplyRoutes(r, db, redisClient, ratelimitMW, userLockoutMiddleware)
+	api.ApplyRoutes(r, db, redisClient, middleware.RateLimit(), userLockoutMiddleware)
 
 	addFrontendRoutes(r)
 
@@ -335,28 +346,62 @@ func (s *Server) Stop() {
 	if err := s.Shutdown(ctx); err != nil {
 		logging.Errorf("Failed to shutdown HTTP server: %s", err)
 	}
-	<-s.shutdownChannel
+	if s.admin != nil {
+		if err := s.admin.Shutdown(ctx); err != nil {
+			logging.Errorf("Failed to shutdown admin HTTP server: %s", err)
+		}
+	}
+	for range len(s.addrs) + len(s.adminAddrs) {
+		<-s.shutdownChannel
+	}
 }
 
 var ErrClosed = errors.New("Server closed")
 var ErrFailed = errors.New("Failed to start server")
 
 func (s *Server) Start() error {
-	g := new(errgroup.Group)
-	g.Go(func() error {
-		err := s.ListenAndServe()
+	listeners := make([]boundListener, 0, len(s.addrs)+len(s.adminAddrs))
+	bind := func(server *http.Server, addr string, name string) bool {
+		listener, err := net.Listen("tcp", addr)
 		if err != nil {
-			switch {
-			case errors.Is(err, http.ErrServerClosed):
-				s.shutdownChannel <- true
-				return ErrClosed
-			default:
-				logging.Errorf("Failed to start HTTP server: %s", err)
-				return ErrFailed
+			logging.Errorf("Failed to start %s server on %s: %s", name, addr, err)
+			for _, l := range listeners {
+				_ = l.listener.Close()
 			}
+			return false
 		}
-		return nil
-	})
+		logging.Errorf("%s Server listening at %s\n", name, addr)
+		listeners = append(listeners, boundListener{server: server, listener: listener})
+		return true
+	}
+	for _, addr := range s.addrs {
+		if !bind(s.Server, addr, "HTTP") {
+			return ErrFailed
+		}
+	}
+	for _, addr := range s.adminAddrs {
+		if !bind(s.admin, addr, "Admin HTTP") {
+			return ErrFailed
+		}
+	}
+
+	g := new(errgroup.Group)
+	for _, bound := range listeners {
+		g.Go(func() error {
+			err := bound.server.Serve(bound.listener)
+			if err != nil {
+				switch {
+				case errors.Is(err, http.ErrServerClosed):
+					s.shutdownChannel <- true
+					return ErrClosed
+				default:
+					logging.Errorf("Failed to start HTTP server: %s", err)
+					return ErrFailed
+				}
+			}
+			return nil
+		})
+	}
 	if err := g.Wait(); err != nil {
 		return err //nolint:golint,wrapcheck
 	}
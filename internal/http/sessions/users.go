@@ -0,0 +1,177 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package sessions
+
+import (
+	"context"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+)
+
+// UserSessionKey is the session value holding the tracked session's ID
+const UserSessionKey = "session_id"
+
+// touchInterval limits how often last activity is written back to Redis
+const touchInterval = time.Minute
+
+// UserSession is a logged in browser session for a user
+type UserSession struct {
+	ID        string    `json:"id"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+func userSessionsKey(userID uint) string {
+	return fmt.Sprintf("user_sessions:%d", userID)
+}
+
+func expired(session UserSession, now time.Time) bool {
+	return now.Sub(session.LastSeen) > time.Duration(sessionExpire)*time.Second
+}
+
+func writeUserSession(ctx context.Context, client *redis.Client, userID uint, session UserSession) error {
+	b, err := json.Marshal(session)
+	if err != nil {
+		return ErrMarshal
+	}
+	key := userSessionsKey(userID)
+	pipe := client.TxPipeline()
+	pipe.HSet(ctx, key, session.ID, b)
+	pipe.Expire(ctx, key, time.Duration(sessionExpire)*time.Second)
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		return ErrRedis
+	}
+	return nil
+}
+
+// RegisterUserSession starts tracking a new session and returns its ID
+func RegisterUserSession(ctx context.Context, client *redis.Client, userID uint, ip, userAgent string) (string, error) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "sessions.RegisterUserSession")
+	defer span.End()
+	const idLength = 16
+	now := time.Now()
+	session := UserSession{
+		ID:        strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(idLength)), "="),
+		IP:        ip,
+		UserAgent: userAgent,
+		CreatedAt: now,
+		LastSeen:  now,
+	}
+	return session.ID, writeUserSession(ctx, client, userID, session)
+}
+
+// TouchUserSession records activity on a session. It returns false if the session was revoked.
+func TouchUserSession(ctx context.Context, client *redis.Client, userID uint, id, ip, userAgent string) (bool, error) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "sessions.TouchUserSession")
+	defer span.End()
+	data, err := client.HGet(ctx, userSessionsKey(userID), id).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	} else if err != nil {
+		return false, ErrRedis
+	}
+	var session UserSession
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return false, ErrUnmarshal
+	}
+	now := time.Now()
+	if now.Sub(session.LastSeen) < touchInterval && session.IP == ip {
+		return true, nil
+	}
+	session.LastSeen = now
+	session.IP = ip
+	session.UserAgent = userAgent
+	return true, writeUserSession(ctx, client, userID, session)
+}
+
+// ListUserSessions returns a user's active sessions, most recently used first
+func ListUserSessions(ctx context.Context, client *redis.Client, userID uint) ([]UserSession, error) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "sessions.ListUserSessions")
+	defer span.End()
+	entries, err := client.HGetAll(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return nil, ErrRedis
+	}
+	now := time.Now()
+	userSessions := make([]UserSession, 0, len(entries))
+	var stale []string
+	for id, data := range entries {
+		var session UserSession
+		if err := json.Unmarshal([]byte(data), &session); err != nil || expired(session, now) {
+			stale = append(stale, id)
+			continue
+		}
+		userSessions = append(userSessions, session)
+	}
+	if len(stale) > 0 {
+		// The cookie session has expired in the store, so drop the record too
+		client.HDel(ctx, userSessionsKey(userID), stale...)
+	}
+	sort.Slice(userSessions, func(i, j int) bool {
+		return userSessions[i].LastSeen.After(userSessions[j].LastSeen)
+	})
+	return userSessions, nil
+}
+
+// RevokeUserSession logs out a single session. It returns false if the session didn't exist.
+func RevokeUserSession(ctx context.Context, client *redis.Client, userID uint, id string) (bool, error) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "sessions.RevokeUserSession")
+	defer span.End()
+	deleted, err := client.HDel(ctx, userSessionsKey(userID), id).Result()
+	if err != nil {
+		return false, ErrRedis
+	}
+	return deleted > 0, nil
+}
+
+// RevokeUserSessions logs out every session for a user except the one with the ID keep, which may be empty
+func RevokeUserSessions(ctx context.Context, client *redis.Client, userID uint, keep string) (int, error) {
+	ctx, span := otel.Tracer("DMRHub").Start(ctx, "sessions.RevokeUserSessions")
+	defer span.End()
+	ids, err := client.HKeys(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return 0, ErrRedis
+	}
+	var revoke []string
+	for _, id := range ids {
+		if id != keep {
+			revoke = append(revoke, id)
+		}
+	}
+	if len(revoke) == 0 {
+		return 0, nil
+	}
+	if err := client.HDel(ctx, userSessionsKey(userID), revoke...).Err(); err != nil {
+		return 0, ErrRedis
+	}
+	return len(revoke), nil
+}
@@ -24,7 +24,7 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/middleware"
 	"github.com/USA-RedDragon/DMRHub/internal/logging"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -60,7 +60,7 @@ func CreateHandler(ws Websocket) func(*gin.Context) {
 				if origin == "" {
 					return false
 				}
-				for _, host := range config.GetConfig().CORSHosts {
+				for _, host := range middleware.CORSPolicyFor(r).Origins {
 					if strings.HasSuffix(host, ":443") && strings.HasPrefix(origin, "https://") {
 						host = strings.TrimSuffix(host, ":443")
 					}
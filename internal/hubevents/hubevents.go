@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package hubevents keeps an append-only log of hub state transitions, such as
+// repeaters logging in and talkgroup subscriptions starting and stopping, on every
+// replica. Replaying the log rebuilds what each replica should be subscribed to at
+// any point in time, which can be compared against what it really is.
+package hubevents
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultCapacity is plenty for every repeater on a busy hub reconnecting at once
+	DefaultCapacity = 10000
+
+	flushInterval = time.Second
+	insertBatch   = 500
+)
+
+//nolint:golint,gochecknoglobals
+var (
+	recordedCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dmrhub_hub_events_total",
+		Help: "Hub state transitions written to the hub event log",
+	})
+	droppedCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dmrhub_hub_events_dropped_total",
+		Help: "Hub state transitions that could not be queued or written, leaving a gap in the log",
+	})
+
+	defaultRecorder atomic.Pointer[Recorder]
+)
+
+// Recorder queues events off of the packet path and writes them in batches
+type Recorder struct {
+	db       *gorm.DB
+	instance string
+	queue    chan models.HubEvent
+	capacity int
+	pending  []models.HubEvent
+}
+
+// NewRecorder creates a Recorder for this replica holding at most capacity unwritten events
+func NewRecorder(db *gorm.DB, instance string, capacity int) *Recorder {
+	return &Recorder{
+		db:       db,
+		instance: instance,
+		queue:    make(chan models.HubEvent, capacity),
+		capacity: capacity,
+	}
+}
+
+// SetDefault installs the recorder used by Record
+func SetDefault(r *Recorder) {
+	defaultRecorder.Store(r)
+}
+
+// Default returns the recorder installed with SetDefault, if any
+func Default() *Recorder {
+	return defaultRecorder.Load()
+}
+
+// Instance returns the name events from this replica are recorded under
+func (r *Recorder) Instance() string {
+	return r.instance
+}
+
+// Record logs an event with the default recorder
+func Record(event models.HubEvent) {
+	if r := Default(); r != nil {
+		r.Record(event)
+	}
+}
+
+// Record queues an event, stamping it with this replica and the current time. It never
+// blocks; events that don't fit in the queue are counted and logged, as replays will be wrong.
+func (r *Recorder) Record(event models.HubEvent) {
+	event.Instance = r.instance
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	select {
+	case r.queue <- event:
+	default:
+		droppedCounter.Inc()
+		logging.Errorf("Hub event queue full, dropped %s event for repeater %d", event.Kind, event.RepeaterID)
+	}
+}
+
+// Run writes queued events every second until ctx is cancelled, then writes once more
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			r.Flush()
+			return
+		case <-ticker.C:
+			r.Flush()
+		}
+	}
+}
+
+// Flush writes everything queued in order. Must not be called concurrently with Run.
+func (r *Recorder) Flush() {
+drain:
+	for {
+		select {
+		case event := <-r.queue:
+			r.pending = append(r.pending, event)
+		default:
+			break drain
+		}
+	}
+	if len(r.pending) == 0 {
+		return
+	}
+	err := r.db.CreateInBatches(r.pending, insertBatch).Error
+	if err != nil {
+		logging.Errorf("Error writing %d hub events: %v", len(r.pending), err)
+		// Keep them for the next flush, dropping the oldest beyond capacity
+		if over := len(r.pending) - r.capacity; over > 0 {
+			droppedCounter.Add(float64(over))
+			r.pending = append(r.pending[:0], r.pending[over:]...)
+		}
+		return
+	}
+	recordedCounter.Add(float64(len(r.pending)))
+	r.pending = r.pending[:0]
+}
@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hubevents_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/hubevents"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func makeTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.HubEvent{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	return db
+}
+
+func TestReplayRebuildsEachInstance(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	start := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	a := hubevents.NewRecorder(db, "replica-a", 100)
+	b := hubevents.NewRecorder(db, "replica-b", 100)
+
+	a.Record(models.HubEvent{Kind: models.HubEventServerRegistered, Server: "hbrp", Time: start})
+	a.Record(models.HubEvent{Kind: models.HubEventRepeaterActivated, RepeaterID: 311001, Time: start})
+	a.Record(models.HubEvent{Kind: models.HubEventTalkgroupLinked, RepeaterID: 311001, TalkgroupID: 1, Time: start})
+	a.Record(models.HubEvent{Kind: models.HubEventTalkgroupLinked, RepeaterID: 311001, TalkgroupID: 2, Time: start.Add(time.Minute)})
+	a.Record(models.HubEvent{Kind: models.HubEventTalkgroupUnlinked, RepeaterID: 311001, TalkgroupID: 1, Time: start.Add(2 * time.Minute)})
+	a.Flush()
+	b.Record(models.HubEvent{Kind: models.HubEventTalkgroupLinked, RepeaterID: 311001, TalkgroupID: 3, Time: start})
+	b.Flush()
+
+	state, err := hubevents.Replay(db, models.HubEventFilter{})
+	if err != nil {
+		t.Fatalf("Failed to replay: %v", err)
+	}
+	replicaA := state["replica-a"]
+	if replicaA == nil || !replicaA.Servers["hbrp"] || !replicaA.Repeaters[311001].Active {
+		t.Fatalf("Expected replica-a to have hbrp and an active repeater, got %+v", replicaA)
+	}
+	talkgroups := replicaA.Repeaters[311001].Talkgroups
+	if len(talkgroups) != 1 || !talkgroups[2] {
+		t.Errorf("Expected replica-a to end subscribed to talkgroup 2 only, got %v", talkgroups)
+	}
+	if !state["replica-b"].Repeaters[311001].Talkgroups[3] {
+		t.Error("Expected replicas to be replayed separately")
+	}
+
+	earlier, err := hubevents.Replay(db, models.HubEventFilter{Instance: "replica-a", Until: start.Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("Failed to replay: %v", err)
+	}
+	talkgroups = earlier["replica-a"].Repeaters[311001].Talkgroups
+	if len(talkgroups) != 2 || !talkgroups[1] || !talkgroups[2] {
+		t.Errorf("Expected talkgroups 1 and 2 a minute in, got %v", talkgroups)
+	}
+	if _, ok := earlier["replica-b"]; ok {
+		t.Error("Expected the instance filter to skip replica-b")
+	}
+
+	drift := replicaA.Compare(map[uint][]uint{311001: {4}, 311002: {}})
+	if len(drift) != 1 || drift[0].RepeaterID != 311001 {
+		t.Fatalf("Expected drift on 311001 only, got %+v", drift)
+	}
+	if len(drift[0].Missing) != 1 || drift[0].Missing[0] != 2 || len(drift[0].Unexpected) != 1 || drift[0].Unexpected[0] != 4 {
+		t.Errorf("Expected talkgroup 2 missing and 4 unexpected, got %+v", drift[0])
+	}
+}
+
+func TestRecordDropsWhenFull(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	recorder := hubevents.NewRecorder(db, "replica-a", 1)
+	recorder.Record(models.HubEvent{Kind: models.HubEventRepeaterActivated, RepeaterID: 1})
+	recorder.Record(models.HubEvent{Kind: models.HubEventRepeaterActivated, RepeaterID: 2})
+	recorder.Flush()
+
+	events, err := models.ListHubEvents(db, models.HubEventFilter{}, 10)
+	if err != nil {
+		t.Fatalf("Failed to list events: %v", err)
+	}
+	if len(events) != 1 || events[0].RepeaterID != 1 || events[0].Instance != "replica-a" {
+		t.Errorf("Expected only the first event to be written, got %+v", events)
+	}
+}
+
+func TestRunFlushesWhenStopped(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	recorder := hubevents.NewRecorder(db, "replica-a", 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		recorder.Run(ctx)
+	}()
+
+	// Events from servers shutting down arrive just before the recorder is stopped
+	recorder.Record(models.HubEvent{Kind: models.HubEventTalkgroupUnlinked, RepeaterID: 311001, TalkgroupID: 1})
+	recorder.Record(models.HubEvent{Kind: models.HubEventServerUnregistered, Server: "hbrp"})
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the recorder to stop")
+	}
+
+	events, err := models.ListHubEvents(db, models.HubEventFilter{}, 10)
+	if err != nil {
+		t.Fatalf("Failed to list events: %v", err)
+	}
+	if len(events) != 2 {
+		t.Errorf("Expected both queued events to be written on stop, got %+v", events)
+	}
+}
@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package hubevents
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"gorm.io/gorm"
+)
+
+const replayBatch = 1000
+
+// State is the hub state of each replica, keyed by instance
+type State map[string]*InstanceState
+
+// InstanceState is what one replica had running
+type InstanceState struct {
+	Servers   map[string]bool         `json:"servers"`
+	Repeaters map[uint]*RepeaterState `json:"repeaters"`
+}
+
+// RepeaterState is whether a repeater was logged in to a replica and the
+// talkgroups the replica was subscribed to for it
+type RepeaterState struct {
+	Active     bool          `json:"active"`
+	Talkgroups map[uint]bool `json:"talkgroups"`
+}
+
+// Drift is how a repeater's live subscriptions differ from the replayed log
+type Drift struct {
+	RepeaterID uint   `json:"repeater_id"`
+	Missing    []uint `json:"missing"`
+	Unexpected []uint `json:"unexpected"`
+}
+
+// Replay rebuilds the state of every replica from the matching events
+func Replay(db *gorm.DB, filter models.HubEventFilter) (State, error) {
+	state := State{}
+	err := models.FindHubEventsInBatches(db, filter, replayBatch, func(events []models.HubEvent) error {
+		for _, event := range events {
+			state.Apply(event)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay hub events: %w", err)
+	}
+	return state, nil
+}
+
+// Apply moves the state forward by one event
+func (s State) Apply(event models.HubEvent) {
+	instance, ok := s[event.Instance]
+	if !ok {
+		instance = &InstanceState{Servers: map[string]bool{}, Repeaters: map[uint]*RepeaterState{}}
+		s[event.Instance] = instance
+	}
+	switch event.Kind {
+	case models.HubEventServerRegistered:
+		instance.Servers[event.Server] = true
+	case models.HubEventServerUnregistered:
+		delete(instance.Servers, event.Server)
+	case models.HubEventRepeaterActivated:
+		instance.repeater(event.RepeaterID).Active = true
+	case models.HubEventRepeaterDeactivated:
+		instance.repeater(event.RepeaterID).Active = false
+	case models.HubEventTalkgroupLinked:
+		instance.repeater(event.RepeaterID).Talkgroups[event.TalkgroupID] = true
+	case models.HubEventTalkgroupUnlinked:
+		repeater := instance.repeater(event.RepeaterID)
+		delete(repeater.Talkgroups, event.TalkgroupID)
+	}
+}
+
+func (i *InstanceState) repeater(id uint) *RepeaterState {
+	repeater, ok := i.Repeaters[id]
+	if !ok {
+		repeater = &RepeaterState{Talkgroups: map[uint]bool{}}
+		i.Repeaters[id] = repeater
+	}
+	return repeater
+}
+
+// Compare lists the repeaters whose live talkgroup subscriptions don't match the replayed ones
+func (i *InstanceState) Compare(live map[uint][]uint) []Drift {
+	ids := map[uint]bool{}
+	if i != nil {
+		for id := range i.Repeaters {
+			ids[id] = true
+		}
+	}
+	for id := range live {
+		ids[id] = true
+	}
+
+	drift := []Drift{}
+	for id := range ids {
+		replayed := map[uint]bool{}
+		if i != nil && i.Repeaters[id] != nil {
+			replayed = i.Repeaters[id].Talkgroups
+		}
+		current := map[uint]bool{}
+		for _, tg := range live[id] {
+			current[tg] = true
+		}
+		d := Drift{RepeaterID: id, Missing: []uint{}, Unexpected: []uint{}}
+		for tg := range replayed {
+			if !current[tg] {
+				d.Missing = append(d.Missing, tg)
+			}
+		}
+		for tg := range current {
+			if !replayed[tg] {
+				d.Unexpected = append(d.Unexpected, tg)
+			}
+		}
+		if len(d.Missing) > 0 || len(d.Unexpected) > 0 {
+			slices.Sort(d.Missing)
+			slices.Sort(d.Unexpected)
+			drift = append(drift, d)
+		}
+	}
+	slices.SortFunc(drift, func(a, b Drift) int { return cmp.Compare(a.RepeaterID, b.RepeaterID) })
+	return drift
+}
@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package i18n translates server-generated strings such as validation errors and emails.
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+)
+
+// DefaultLocale is used when nothing else matches, and is the source of every message.
+const DefaultLocale = "en"
+
+// ContextKey is the key the HTTP middleware stores the request locale under.
+const ContextKey = "Locale"
+
+// SessionKey is the session value holding the logged-in user's locale setting,
+// so it doesn't have to be read from the database on every request.
+const SessionKey = "locale"
+
+//go:embed locales/*.json
+var localeFS embed.FS
+
+var (
+	//nolint:golint,gochecknoglobals
+	catalogs map[string]map[string]string
+	//nolint:golint,gochecknoglobals
+	loadOnce sync.Once
+)
+
+func load() {
+	catalogs = make(map[string]map[string]string)
+	entries, err := localeFS.ReadDir("locales")
+	if err != nil {
+		logging.Errorf("Failed to read bundled translations: %v", err)
+		return
+	}
+	for _, entry := range entries {
+		data, err := localeFS.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			logging.Errorf("Failed to read translation %s: %v", entry.Name(), err)
+			continue
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			logging.Errorf("Failed to parse translation %s: %v", entry.Name(), err)
+			continue
+		}
+		catalogs[strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))] = messages
+	}
+}
+
+// Supported lists the locales with bundled translations.
+func Supported() []string {
+	loadOnce.Do(load)
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// IsSupported reports whether there is a bundled translation for locale.
+func IsSupported(locale string) bool {
+	loadOnce.Do(load)
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// Default returns the network's configured default locale.
+func Default() string {
+	if locale := config.GetConfig().DefaultLocale; IsSupported(locale) {
+		return locale
+	}
+	return DefaultLocale
+}
+
+// T translates key into locale, formatting it with args. Messages missing from
+// a translation fall back to English, and unknown keys are returned as-is.
+func T(locale string, key string, args ...any) string {
+	loadOnce.Do(load)
+	msg, ok := catalogs[locale][key]
+	if !ok {
+		msg, ok = catalogs[DefaultLocale][key]
+		if !ok {
+			msg = key
+		}
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// Translate translates key into the locale stored on ctx, such as a *gin.Context
+// that has been through the locale middleware.
+func Translate(ctx context.Context, key string, args ...any) string {
+	locale, ok := ctx.Value(ContextKey).(string)
+	if !ok {
+		locale = Default()
+	}
+	return T(locale, key, args...)
+}
+
+// Negotiate picks the best supported locale from an Accept-Language header.
+func Negotiate(acceptLanguage string) (string, bool) {
+	best := ""
+	bestQ := 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if qStr, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(qStr, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		// Only the primary language subtag is used, so en-GB matches en
+		lang, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if q > bestQ && IsSupported(lang) {
+			best = lang
+			bestQ = q
+		}
+	}
+	return best, best != ""
+}
@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package i18n_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/i18n"
+)
+
+func TestTranslate(t *testing.T) {
+	t.Parallel()
+	if msg := i18n.T("es", "username_taken"); msg != "El nombre de usuario ya está en uso" {
+		t.Errorf("Unexpected Spanish translation: %s", msg)
+	}
+	if msg := i18n.T("xx", "username_taken"); msg != "Username is already taken" {
+		t.Errorf("Expected unknown locales to fall back to English, got %s", msg)
+	}
+	if msg := i18n.T("en", "no_such_key"); msg != "no_such_key" {
+		t.Errorf("Expected unknown keys to be returned as-is, got %s", msg)
+	}
+	if msg := i18n.T("en", "email_admin_promoted_body", "user", "N0CALL", 1); !strings.Contains(msg, "N0CALL") {
+		t.Errorf("Expected arguments to be formatted into the message, got %s", msg)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	t.Parallel()
+	tests := map[string]string{
+		"de-DE,de;q=0.9,en;q=0.8": "de",
+		"ja,fr;q=0.5,en;q=0.7":    "en",
+		"fr-CA":                   "fr",
+		"ja":                      "",
+		"":                        "",
+	}
+	for header, expected := range tests {
+		locale, _ := i18n.Negotiate(header)
+		if locale != expected {
+			t.Errorf("Negotiate(%q) = %q, expected %q", header, locale, expected)
+		}
+	}
+}
+
+func TestTranslationsComplete(t *testing.T) {
+	t.Parallel()
+	read := func(locale string) map[string]string {
+		data, err := os.ReadFile(filepath.Join("locales", locale+".json"))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", locale, err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			t.Fatalf("Failed to parse %s: %v", locale, err)
+		}
+		return messages
+	}
+	english := read(i18n.DefaultLocale)
+	for _, locale := range i18n.Supported() {
+		messages := read(locale)
+		for key := range english {
+			if _, ok := messages[key]; !ok {
+				t.Errorf("Locale %s is missing %s", locale, key)
+			}
+		}
+	}
+}
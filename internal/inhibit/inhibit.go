@@ -0,0 +1,180 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package inhibit enforces emergency TX inhibits on the packet path.
+// Every replica keeps the active inhibits in memory and reloads them from
+// the database whenever one replica announces a change over pubsub.
+package inhibit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/pubsub"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Channel is the redis pubsub channel inhibit changes are announced on
+const Channel = "inhibit:changed"
+
+//nolint:golint,gochecknoglobals
+var defaultInhibitor atomic.Pointer[Inhibitor]
+
+type rule struct {
+	hub        bool
+	talkgroups map[uint]bool
+	exceptions map[uint]bool
+}
+
+func newRule(inhibit models.TXInhibit) rule {
+	r := rule{
+		hub:        inhibit.Hub,
+		talkgroups: make(map[uint]bool, len(inhibit.Talkgroups)),
+		exceptions: make(map[uint]bool, len(inhibit.Exceptions)),
+	}
+	for _, talkgroup := range inhibit.Talkgroups {
+		r.talkgroups[talkgroup.ID] = true
+	}
+	for _, talkgroup := range inhibit.Exceptions {
+		r.exceptions[talkgroup.ID] = true
+	}
+	return r
+}
+
+// blocks reports whether the rule stops a packet. Private calls have no
+// talkgroup, so only a hub-wide inhibit stops them.
+func (r rule) blocks(packet models.Packet) bool {
+	if !packet.GroupCall {
+		return r.hub
+	}
+	if r.exceptions[packet.Dst] {
+		return false
+	}
+	return r.hub || r.talkgroups[packet.Dst]
+}
+
+// Inhibitor holds the inhibits in force on this replica
+type Inhibitor struct {
+	db    *gorm.DB
+	mu    sync.RWMutex
+	rules []rule
+
+	handlersMu sync.RWMutex
+	handlers   []func(context.Context)
+}
+
+// NewInhibitor creates an Inhibitor with no inhibits loaded
+func NewInhibitor(db *gorm.DB) *Inhibitor {
+	return &Inhibitor{db: db}
+}
+
+// SetDefault installs the inhibitor used by Blocks
+func SetDefault(i *Inhibitor) {
+	defaultInhibitor.Store(i)
+}
+
+// Default returns the inhibitor installed with SetDefault, if any
+func Default() *Inhibitor {
+	return defaultInhibitor.Load()
+}
+
+// Blocks reports whether the default inhibitor stops a packet
+func Blocks(packet models.Packet) bool {
+	if i := Default(); i != nil {
+		return i.Blocks(packet)
+	}
+	return false
+}
+
+// Blocks reports whether any inhibit in force stops a packet
+func (i *Inhibitor) Blocks(packet models.Packet) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	for _, r := range i.rules {
+		if r.blocks(packet) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload replaces the inhibits in force with the ones in the database
+func (i *Inhibitor) Reload() error {
+	inhibits, err := models.ListActiveTXInhibits(i.db)
+	if err != nil {
+		return fmt.Errorf("failed to list TX inhibits: %w", err)
+	}
+	rules := make([]rule, 0, len(inhibits))
+	for _, inhibit := range inhibits {
+		rules = append(rules, newRule(inhibit))
+	}
+	i.mu.Lock()
+	i.rules = rules
+	i.mu.Unlock()
+	return nil
+}
+
+// OnChange registers a function to run after each reload announced by Notify,
+// so servers can cut off the streams a new inhibit covers
+func (i *Inhibitor) OnChange(handler func(context.Context)) {
+	i.handlersMu.Lock()
+	defer i.handlersMu.Unlock()
+	i.handlers = append(i.handlers, handler)
+}
+
+func (i *Inhibitor) changed(ctx context.Context) {
+	if err := i.Reload(); err != nil {
+		logging.Errorf("Error reloading TX inhibits: %v", err)
+		return
+	}
+	i.handlersMu.RLock()
+	handlers := append([]func(context.Context){}, i.handlers...)
+	i.handlersMu.RUnlock()
+	for _, handler := range handlers {
+		handler(ctx)
+	}
+}
+
+// Listen applies the changes announced by Notify until ctx is done
+func (i *Inhibitor) Listen(ctx context.Context, redis *redis.Client) {
+	subscription := redis.Subscribe(ctx, Channel)
+	defer func() {
+		err := subscription.Close()
+		if err != nil {
+			logging.Errorf("Error closing pubsub: %v", err)
+		}
+	}()
+	for range pubsub.Receive(ctx, subscription, "inhibit") {
+		i.changed(ctx)
+	}
+}
+
+// Notify tells every replica, including this one, to reload the inhibits
+func Notify(ctx context.Context, redis *redis.Client, inhibitID uint) error {
+	err := pubsub.Publish(ctx, redis, Channel, []byte(fmt.Sprint(inhibitID)))
+	if err != nil {
+		return fmt.Errorf("failed to announce TX inhibit change: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package inhibit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/inhibit"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func makeTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.AutoMigrate(&models.Talkgroup{}, &models.TXInhibit{})
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	for _, id := range []uint{91, 3100, 3172, 9112} {
+		db.Create(&models.Talkgroup{ID: id})
+	}
+	return db
+}
+
+func TestTalkgroupInhibit(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	db.Create(&models.TXInhibit{Talkgroups: []models.Talkgroup{{ID: 3100}}, Reason: "Jamming"})
+
+	inhibitor := inhibit.NewInhibitor(db)
+	if err := inhibitor.Reload(); err != nil {
+		t.Fatalf("Failed to load inhibits: %v", err)
+	}
+	if !inhibitor.Blocks(models.Packet{GroupCall: true, Dst: 3100}) {
+		t.Error("Expected the inhibited talkgroup to be blocked")
+	}
+	if inhibitor.Blocks(models.Packet{GroupCall: true, Dst: 91}) {
+		t.Error("Expected other talkgroups to keep routing")
+	}
+	if inhibitor.Blocks(models.Packet{Dst: 3100}) {
+		t.Error("Expected private calls to a matching ID to keep routing")
+	}
+}
+
+func TestHubInhibit(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	txInhibit := models.TXInhibit{Hub: true, Exceptions: []models.Talkgroup{{ID: 9112}}, Reason: "Legal takedown"}
+	db.Create(&txInhibit)
+
+	inhibitor := inhibit.NewInhibitor(db)
+	if err := inhibitor.Reload(); err != nil {
+		t.Fatalf("Failed to load inhibits: %v", err)
+	}
+	if !inhibitor.Blocks(models.Packet{GroupCall: true, Dst: 3172}) {
+		t.Error("Expected a hub-wide inhibit to block every talkgroup")
+	}
+	if !inhibitor.Blocks(models.Packet{Dst: 3191868}) {
+		t.Error("Expected a hub-wide inhibit to block private calls")
+	}
+	if inhibitor.Blocks(models.Packet{GroupCall: true, Dst: 9112}) {
+		t.Error("Expected the exception talkgroup to keep routing")
+	}
+
+	if err := models.LiftTXInhibit(db, txInhibit.ID, 1, time.Now()); err != nil {
+		t.Fatalf("Failed to lift inhibit: %v", err)
+	}
+	if err := inhibitor.Reload(); err != nil {
+		t.Fatalf("Failed to reload inhibits: %v", err)
+	}
+	if inhibitor.Blocks(models.Packet{GroupCall: true, Dst: 3172}) {
+		t.Error("Expected routing to resume once the inhibit is lifted")
+	}
+}
+
+func TestExceptionsAreScopedToTheirInhibit(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	db.Create(&models.TXInhibit{Hub: true, Exceptions: []models.Talkgroup{{ID: 3100}}, Reason: "Interference"})
+	db.Create(&models.TXInhibit{Talkgroups: []models.Talkgroup{{ID: 3100}}, Reason: "Takedown"})
+
+	inhibitor := inhibit.NewInhibitor(db)
+	if err := inhibitor.Reload(); err != nil {
+		t.Fatalf("Failed to load inhibits: %v", err)
+	}
+	if !inhibitor.Blocks(models.Packet{GroupCall: true, Dst: 3100}) {
+		t.Error("Expected an exception in one inhibit not to override another inhibit")
+	}
+}
@@ -0,0 +1,379 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package jobs runs background work from a queue kept in the database. Jobs survive
+// restarts, are retried with backoff when they fail, and are dead-lettered once they
+// run out of attempts, so admins can inspect and retry them.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultWorkers is how many jobs a replica runs at once
+	DefaultWorkers = 4
+	// DefaultMaxAttempts is how many times a job runs before it is dead-lettered
+	DefaultMaxAttempts = 5
+	// Timeout is the longest a job may run before its context is cancelled
+	Timeout = 10 * time.Minute
+	// FinishedRetention is how long succeeded and dead jobs are kept before being purged
+	FinishedRetention = 7 * 24 * time.Hour
+
+	pollInterval  = time.Second
+	staleInterval = time.Minute
+	// Jobs still running this long after they started belong to a replica that died
+	staleAfter  = Timeout + 5*time.Minute
+	baseBackoff = 30 * time.Second
+	maxBackoff  = time.Hour
+)
+
+var (
+	ErrUnknownKind = errors.New("no handler is registered for this kind of job")
+	ErrNoQueue     = errors.New("no job queue is running")
+)
+
+//nolint:golint,gochecknoglobals
+var (
+	finishedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dmrhub_jobs_finished_total",
+		Help: "Background job attempts by kind and result",
+	}, []string{"kind", "result"})
+
+	defaultQueue atomic.Pointer[Queue]
+)
+
+// Handler does the work for a job. Returning an error retries the job later,
+// unless the error is wrapped with Permanent.
+type Handler func(ctx context.Context, job models.Job) error
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks an error that retrying won't fix, so the job is dead-lettered right away
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// Queue runs the jobs it has handlers for
+type Queue struct {
+	db       *gorm.DB
+	worker   string
+	workers  int
+	handlers map[string]Handler
+	wake     chan struct{}
+	stopping atomic.Bool
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewQueue creates a queue that claims jobs as worker, running up to workers of them at once.
+// The worker name should be stable across restarts, so jobs it was running can be picked back up.
+func NewQueue(db *gorm.DB, worker string, workers int) *Queue {
+	return &Queue{
+		db:       db,
+		worker:   worker,
+		workers:  workers,
+		handlers: make(map[string]Handler),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// SetDefault installs the queue used by Enqueue
+func SetDefault(q *Queue) {
+	defaultQueue.Store(q)
+}
+
+// Default returns the queue installed with SetDefault, if any
+func Default() *Queue {
+	return defaultQueue.Load()
+}
+
+// Register sets the handler for a kind of job. Handlers must all be registered before Run.
+func (q *Queue) Register(kind string, handler Handler) {
+	q.handlers[kind] = handler
+}
+
+// EnqueueOption changes how a job is enqueued
+type EnqueueOption func(*enqueueOptions)
+
+type enqueueOptions struct {
+	runAt       time.Time
+	maxAttempts int
+	unique      bool
+}
+
+// At delays a job until runAt
+func At(runAt time.Time) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.runAt = runAt
+	}
+}
+
+// MaxAttempts overrides how many times a job runs before it is dead-lettered
+func MaxAttempts(attempts int) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.maxAttempts = attempts
+	}
+}
+
+// Unique skips enqueuing a job if one of the same kind is already pending or running,
+// so periodic work scheduled on every replica only runs once
+func Unique() EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.unique = true
+	}
+}
+
+// Enqueue adds a job to the default queue
+func Enqueue(kind string, payload any, opts ...EnqueueOption) (models.Job, error) {
+	q := Default()
+	if q == nil {
+		return models.Job{}, ErrNoQueue
+	}
+	return q.Enqueue(kind, payload, opts...)
+}
+
+// Enqueue adds a job with payload encoded as JSON. It returns the zero Job
+// if the job was Unique and one of its kind was already queued.
+func (q *Queue) Enqueue(kind string, payload any, opts ...EnqueueOption) (models.Job, error) {
+	options := enqueueOptions{
+		runAt:       time.Now(),
+		maxAttempts: DefaultMaxAttempts,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return models.Job{}, fmt.Errorf("failed to encode %s job payload: %w", kind, err)
+	}
+	job := models.Job{
+		Kind:        kind,
+		Payload:     string(encoded),
+		RunAt:       options.runAt,
+		MaxAttempts: options.maxAttempts,
+	}
+	if options.unique {
+		created, err := models.EnqueueUniqueJob(q.db, &job)
+		if err != nil {
+			return models.Job{}, fmt.Errorf("failed to enqueue %s job: %w", kind, err)
+		}
+		if !created {
+			return models.Job{}, nil
+		}
+	} else if err := models.EnqueueJob(q.db, &job); err != nil {
+		return models.Job{}, fmt.Errorf("failed to enqueue %s job: %w", kind, err)
+	}
+	if !job.RunAt.After(time.Now()) {
+		q.Wake()
+	}
+	return job, nil
+}
+
+// Decode unmarshals a job's payload
+func Decode[T any](job models.Job) (T, error) {
+	var payload T
+	err := json.Unmarshal([]byte(job.Payload), &payload)
+	if err != nil {
+		return payload, Permanent(fmt.Errorf("failed to decode %s job payload: %w", job.Kind, err))
+	}
+	return payload, nil
+}
+
+// Wake has an idle worker look for jobs now rather than at its next poll
+func (q *Queue) Wake() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run picks up the jobs this worker was running when it last stopped, then runs
+// jobs until ctx is cancelled or Stop is called
+func (q *Queue) Run(ctx context.Context) {
+	q.mu.Lock()
+	if q.stopping.Load() {
+		q.mu.Unlock()
+		return
+	}
+	ctx, q.cancel = context.WithCancel(ctx)
+	requeued, err := models.RequeueWorkerJobs(q.db, q.worker, time.Now())
+	if err != nil {
+		logging.Errorf("Failed to requeue jobs interrupted by the last shutdown: %s", err)
+	} else if requeued > 0 {
+		logging.Logf("Requeued %d jobs interrupted by the last shutdown", requeued)
+	}
+
+	for range q.workers {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			q.work(ctx)
+		}()
+	}
+	q.mu.Unlock()
+
+	ticker := time.NewTicker(staleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			requeued, err := models.RequeueStaleJobs(q.db, time.Now().Add(-staleAfter), time.Now())
+			if err != nil {
+				logging.Errorf("Failed to requeue stale jobs: %s", err)
+			} else if requeued > 0 {
+				logging.Logf("Requeued %d jobs abandoned by a stopped replica", requeued)
+			}
+		}
+	}
+}
+
+// Stop stops claiming jobs and waits for the running ones to finish. Jobs whose
+// handlers give up because of the shutdown are put back to run again later.
+func (q *Queue) Stop() {
+	q.mu.Lock()
+	q.stopping.Store(true)
+	if q.cancel != nil {
+		q.cancel()
+	}
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+func (q *Queue) work(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		// Keep going while there is work, only waiting when the queue is empty
+		for ctx.Err() == nil && q.RunOnce(ctx) {
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// RunOnce claims and runs a single due job, reporting whether there was one
+func (q *Queue) RunOnce(ctx context.Context) bool {
+	kinds := make([]string, 0, len(q.handlers))
+	for kind := range q.handlers {
+		kinds = append(kinds, kind)
+	}
+	if len(kinds) == 0 {
+		return false
+	}
+	job, ok, err := models.ClaimJob(q.db, q.worker, kinds, time.Now())
+	if err != nil {
+		logging.Errorf("Failed to claim a job: %s", err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+	q.run(ctx, job)
+	return true
+}
+
+func (q *Queue) run(ctx context.Context, job models.Job) {
+	handler, ok := q.handlers[job.Kind]
+	if !ok {
+		q.fail(job, Permanent(ErrUnknownKind))
+		return
+	}
+	jobCtx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+	err := q.call(jobCtx, handler, job)
+	switch {
+	case err == nil:
+		finishedCounter.WithLabelValues(job.Kind, "succeeded").Inc()
+		if err := models.CompleteJob(q.db, job.ID, time.Now()); err != nil {
+			logging.Errorf("Failed to mark %s job %d as succeeded: %s", job.Kind, job.ID, err)
+		}
+	case q.stopping.Load() && ctx.Err() != nil:
+		// The job didn't fail, this replica is shutting down
+		if err := models.ReleaseJob(q.db, job.ID); err != nil {
+			logging.Errorf("Failed to release %s job %d: %s", job.Kind, job.ID, err)
+		}
+	default:
+		q.fail(job, err)
+	}
+}
+
+// call runs a handler, turning a panic into a failed attempt
+func (q *Queue) call(ctx context.Context, handler Handler, job models.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+func (q *Queue) fail(job models.Job, err error) {
+	var permanent permanentError
+	dead := errors.As(err, &permanent) || job.Attempts >= job.MaxAttempts
+	now := time.Now()
+	if dead {
+		finishedCounter.WithLabelValues(job.Kind, "dead").Inc()
+		logging.Errorf("%s job %d failed for good after %d attempts: %s", job.Kind, job.ID, job.Attempts, err)
+	} else {
+		finishedCounter.WithLabelValues(job.Kind, "retried").Inc()
+		logging.Errorf("%s job %d failed on attempt %d, retrying: %s", job.Kind, job.ID, job.Attempts, err)
+	}
+	if err := models.FailJob(q.db, job, err.Error(), now.Add(Backoff(job.Attempts)), dead, now); err != nil {
+		logging.Errorf("Failed to record failure of %s job %d: %s", job.Kind, job.ID, err)
+	}
+}
+
+// Backoff is how long to wait before retrying a job that has failed attempts times
+func Backoff(attempts int) time.Duration {
+	backoff := baseBackoff
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxBackoff)
+}
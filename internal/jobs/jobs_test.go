@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/jobs"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+var errBoom = errors.New("boom")
+
+func makeTestQueue(t *testing.T) (*jobs.Queue, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Job{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	return jobs.NewQueue(db, "test", 1), db
+}
+
+func TestRunOnce(t *testing.T) {
+	t.Parallel()
+	q, db := makeTestQueue(t)
+	type payload struct {
+		Name string `json:"name"`
+	}
+	var got string
+	q.Register("greet", func(_ context.Context, job models.Job) error {
+		p, err := jobs.Decode[payload](job)
+		got = p.Name
+		return err
+	})
+
+	job, err := q.Enqueue("greet", payload{Name: "KI5VMF"})
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+	if !q.RunOnce(context.Background()) {
+		t.Fatal("Expected a job to run")
+	}
+	if got != "KI5VMF" {
+		t.Errorf("Expected the payload to be decoded, got %q", got)
+	}
+	job, _ = models.FindJobByID(db, job.ID)
+	if job.State != models.JobSucceeded || job.FinishedAt == nil {
+		t.Errorf("Expected the job to succeed, got %+v", job)
+	}
+	if q.RunOnce(context.Background()) {
+		t.Error("Expected the queue to be empty")
+	}
+}
+
+func TestFailedJobsAreRetried(t *testing.T) {
+	t.Parallel()
+	q, db := makeTestQueue(t)
+	q.Register("fail", func(context.Context, models.Job) error {
+		return errBoom
+	})
+	q.Register("panic", func(context.Context, models.Job) error {
+		panic("boom")
+	})
+
+	for _, kind := range []string{"fail", "panic"} {
+		job, err := q.Enqueue(kind, nil)
+		if err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+		start := time.Now()
+		q.RunOnce(context.Background())
+		job, _ = models.FindJobByID(db, job.ID)
+		if job.State != models.JobPending || job.Attempts != 1 || job.LastError == "" {
+			t.Errorf("Expected %s job to be retried, got %+v", kind, job)
+		}
+		if job.RunAt.Before(start.Add(jobs.Backoff(1))) {
+			t.Errorf("Expected %s job to back off, runs at %s", kind, job.RunAt)
+		}
+	}
+}
+
+func TestPermanentErrorsAreDeadLettered(t *testing.T) {
+	t.Parallel()
+	q, db := makeTestQueue(t)
+	q.Register("bad", func(_ context.Context, job models.Job) error {
+		_, err := jobs.Decode[int](job)
+		return err
+	})
+
+	job, err := q.Enqueue("bad", "not a number")
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+	q.RunOnce(context.Background())
+	job, _ = models.FindJobByID(db, job.ID)
+	if job.State != models.JobDead || job.Attempts != 1 {
+		t.Errorf("Expected the job to be dead-lettered on the first attempt, got %+v", job)
+	}
+}
+
+func TestDelayedAndUniqueJobs(t *testing.T) {
+	t.Parallel()
+	q, _ := makeTestQueue(t)
+	q.Register("later", func(context.Context, models.Job) error {
+		return nil
+	})
+
+	job, err := q.Enqueue("later", nil, jobs.At(time.Now().Add(time.Hour)), jobs.Unique())
+	if err != nil || job.ID == 0 {
+		t.Fatalf("Failed to enqueue job: %+v err=%v", job, err)
+	}
+	job, err = q.Enqueue("later", nil, jobs.Unique())
+	if err != nil || job.ID != 0 {
+		t.Errorf("Expected the duplicate to be skipped, got %+v err=%v", job, err)
+	}
+	if q.RunOnce(context.Background()) {
+		t.Error("Expected the delayed job not to run yet")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+	cases := map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		3:  2 * time.Minute,
+		20: time.Hour,
+	}
+	for attempts, want := range cases {
+		if got := jobs.Backoff(attempts); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"gorm.io/gorm"
+)
+
+// Kinds of database maintenance job
+const (
+	KindPurgeCalls        = "calls.purge"
+	KindPurgeTombstones   = "tombstones.purge"
+	KindPurgeDeferredData = "deferred.purge"
+	KindPurgeJobs         = "jobs.purge"
+)
+
+// RegisterMaintenance registers the handlers that prune old rows from the database.
+// Calls are kept for callRetention unless their talkgroup says otherwise.
+func RegisterMaintenance(q *Queue, db *gorm.DB, callRetention time.Duration) {
+	q.Register(KindPurgeCalls, func(ctx context.Context, _ models.Job) error {
+		purged, err := models.PurgeExpiredCalls(db.WithContext(ctx), callRetention, time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to purge expired calls: %w", err)
+		}
+		logging.Logf("Purged %d calls past their retention period", purged)
+		return nil
+	})
+	q.Register(KindPurgeTombstones, func(ctx context.Context, _ models.Job) error {
+		purged, err := models.PurgeExpiredTombstones(db.WithContext(ctx), time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to purge expired tombstones: %w", err)
+		}
+		logging.Logf("Purged %d tombstones older than the sync window", purged)
+		return nil
+	})
+	q.Register(KindPurgeDeferredData, func(ctx context.Context, _ models.Job) error {
+		purged, err := models.PurgeExpiredDeferredData(db.WithContext(ctx), time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to purge expired deferred data: %w", err)
+		}
+		if purged > 0 {
+			logging.Logf("Purged %d held data packets whose destination didn't reconnect", purged)
+		}
+		return nil
+	})
+	q.Register(KindPurgeJobs, func(ctx context.Context, _ models.Job) error {
+		purged, err := models.PurgeFinishedJobs(db.WithContext(ctx), time.Now().Add(-FinishedRetention))
+		if err != nil {
+			return fmt.Errorf("failed to purge finished jobs: %w", err)
+		}
+		if purged > 0 {
+			logging.Logf("Purged %d finished jobs", purged)
+		}
+		return nil
+	})
+}
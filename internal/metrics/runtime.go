@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package metrics
+
+import (
+	"runtime"
+	"time"
+)
+
+// RuntimeStats is a snapshot of the Go runtime, for spotting leaks and GC pressure
+type RuntimeStats struct {
+	Goroutines    int           `json:"goroutines"`
+	CPUs          int           `json:"cpus"`
+	HeapAlloc     uint64        `json:"heap_alloc_bytes"`
+	HeapSys       uint64        `json:"heap_sys_bytes"`
+	HeapObjects   uint64        `json:"heap_objects"`
+	NextGC        uint64        `json:"next_gc_bytes"`
+	NumGC         uint32        `json:"num_gc"`
+	PauseTotal    time.Duration `json:"gc_pause_total_ns"`
+	LastPause     time.Duration `json:"gc_last_pause_ns"`
+	LastGC        time.Time     `json:"last_gc"`
+	GCCPUFraction float64       `json:"gc_cpu_fraction"`
+}
+
+// ReadRuntimeStats collects the current runtime stats. It briefly stops the world.
+func ReadRuntimeStats() RuntimeStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	stats := RuntimeStats{
+		Goroutines:    runtime.NumGoroutine(),
+		CPUs:          runtime.NumCPU(),
+		HeapAlloc:     mem.HeapAlloc,
+		HeapSys:       mem.HeapSys,
+		HeapObjects:   mem.HeapObjects,
+		NextGC:        mem.NextGC,
+		NumGC:         mem.NumGC,
+		PauseTotal:    time.Duration(mem.PauseTotalNs),
+		GCCPUFraction: mem.GCCPUFraction,
+	}
+	if mem.NumGC > 0 {
+		stats.LastPause = time.Duration(mem.PauseNs[(mem.NumGC+255)%256])
+		stats.LastGC = time.Unix(0, int64(mem.LastGC))
+	}
+	return stats
+}
@@ -0,0 +1,262 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package monitor implements the `dmrhub monitor` subcommand, which follows
+// live call activity on a running DMRHub instance from the terminal.
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultURL     = "http://localhost:3005"
+	reconnectDelay = 5 * time.Second
+
+	colorReset = "\033[0m"
+	colorGreen = "\033[32m"
+	colorRed   = "\033[31m"
+	colorCyan  = "\033[36m"
+)
+
+var ErrInvalidURL = errors.New("invalid server URL")
+
+// EventType is the kind of line the monitor prints for a call
+type EventType string
+
+const (
+	EventStart EventType = "start"
+	EventEnd   EventType = "end"
+)
+
+// Event is a call start or end, as printed in JSON output mode
+type Event struct {
+	Event EventType                `json:"event"`
+	Call  apimodels.WSCallResponse `json:"call"`
+}
+
+// Monitor turns the calls websocket stream into start and end events
+type Monitor struct {
+	talkgroups map[uint]bool
+	active     map[uint]bool
+	json       bool
+	color      bool
+	out        io.Writer
+}
+
+// Run parses the subcommand arguments and streams calls until interrupted
+func Run(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("monitor", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	serverURL := flags.String("url", defaultURL, "Base URL of the DMRHub instance")
+	tgs := flags.String("tg", "", "Comma-separated talkgroup IDs to follow (default all)")
+	jsonOutput := flags.Bool("json", false, "Print one JSON object per event")
+	noColor := flags.Bool("no-color", os.Getenv("NO_COLOR") != "", "Disable colored output")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	talkgroups, err := ParseTalkgroups(*tgs)
+	if err != nil {
+		fmt.Fprintf(stderr, "Invalid --tg: %v\n", err)
+		return 2
+	}
+	wsURL, err := WebsocketURL(*serverURL)
+	if err != nil {
+		fmt.Fprintf(stderr, "Invalid --url: %v\n", err)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	m := New(stdout, talkgroups, *jsonOutput, !*noColor && !*jsonOutput)
+	for {
+		err := m.follow(ctx, wsURL)
+		if ctx.Err() != nil {
+			return 0
+		}
+		fmt.Fprintf(stderr, "Disconnected from %s: %v, reconnecting in %s\n", wsURL, err, reconnectDelay)
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// New creates a Monitor. An empty talkgroup set follows every talkgroup.
+func New(out io.Writer, talkgroups map[uint]bool, jsonOutput bool, color bool) *Monitor {
+	return &Monitor{
+		talkgroups: talkgroups,
+		active:     make(map[uint]bool),
+		json:       jsonOutput,
+		color:      color,
+		out:        out,
+	}
+}
+
+// ParseTalkgroups parses a comma-separated list of talkgroup IDs
+func ParseTalkgroups(list string) (map[uint]bool, error) {
+	talkgroups := make(map[uint]bool)
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("talkgroup %q: %w", field, err)
+		}
+		talkgroups[uint(id)] = true
+	}
+	return talkgroups, nil
+}
+
+// WebsocketURL converts the instance base URL into the calls websocket URL
+func WebsocketURL(base string) (string, error) {
+	parsed, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidURL, err)
+	}
+	switch parsed.Scheme {
+	case "http", "ws":
+		parsed.Scheme = "ws"
+	case "https", "wss":
+		parsed.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("%w: unsupported scheme %q", ErrInvalidURL, parsed.Scheme)
+	}
+	if parsed.Host == "" {
+		return "", fmt.Errorf("%w: missing host", ErrInvalidURL)
+	}
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/") + "/ws/calls"
+	return parsed.String(), nil
+}
+
+func (m *Monitor) follow(ctx context.Context, wsURL string) error {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return fmt.Errorf("failed to read message: %w", err)
+		}
+		var call apimodels.WSCallResponse
+		if err := json.Unmarshal(msg, &call); err != nil {
+			continue
+		}
+		if err := m.Handle(call); err != nil {
+			return err
+		}
+	}
+}
+
+// Handle prints a line when a followed call starts or ends.
+// Intermediate updates for an active call are ignored.
+func (m *Monitor) Handle(call apimodels.WSCallResponse) error {
+	if !call.IsToTalkgroup {
+		return nil
+	}
+	if len(m.talkgroups) > 0 && !m.talkgroups[call.ToTalkgroup.ID] {
+		return nil
+	}
+
+	var event EventType
+	switch {
+	case call.Active && !m.active[call.ID]:
+		m.active[call.ID] = true
+		event = EventStart
+	case !call.Active:
+		delete(m.active, call.ID)
+		event = EventEnd
+	default:
+		return nil
+	}
+
+	if m.json {
+		line, err := json.Marshal(Event{Event: event, Call: call})
+		if err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+		_, err = fmt.Fprintln(m.out, string(line))
+		return err
+	}
+	_, err := fmt.Fprintln(m.out, m.format(event, call))
+	return err
+}
+
+func (m *Monitor) format(event EventType, call apimodels.WSCallResponse) string {
+	slot := 1
+	if call.TimeSlot {
+		slot = 2
+	}
+	tg := strconv.FormatUint(uint64(call.ToTalkgroup.ID), 10)
+	if call.ToTalkgroup.Name != "" {
+		tg += " (" + call.ToTalkgroup.Name + ")"
+	}
+
+	when := call.StartTime
+	label := m.paint(colorGreen, "START")
+	var stats string
+	if event == EventEnd {
+		when = call.StartTime.Add(call.Duration)
+		label = m.paint(colorRed, "END  ")
+		stats = fmt.Sprintf(" %.1fs loss %.1f%% BER %.1f%%", call.Duration.Seconds(), call.Loss*100, call.BER*100)
+	}
+
+	callsign := call.User.Callsign
+	if callsign == "" {
+		callsign = strconv.FormatUint(uint64(call.User.ID), 10)
+	}
+
+	return fmt.Sprintf("%s %s %s -> TG %s TS%d%s",
+		when.Local().Format(time.TimeOnly), label, m.paint(colorCyan, callsign), tg, slot, stats)
+}
+
+func (m *Monitor) paint(color string, text string) string {
+	if !m.color {
+		return text
+	}
+	return color + text + colorReset
+}
@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package monitor_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/monitor"
+)
+
+func testCall(tg uint, active bool) apimodels.WSCallResponse {
+	return apimodels.WSCallResponse{
+		ID:            1,
+		User:          apimodels.WSCallResponseUser{ID: 3191868, Callsign: "KI5VMF"},
+		StartTime:     time.Now(),
+		Duration:      2 * time.Second,
+		Active:        active,
+		TimeSlot:      true,
+		GroupCall:     true,
+		IsToTalkgroup: true,
+		ToTalkgroup:   apimodels.WSCallResponseTalkgroup{ID: tg, Name: "USA"},
+	}
+}
+
+func TestParseTalkgroups(t *testing.T) {
+	t.Parallel()
+	tgs, err := monitor.ParseTalkgroups("3100, 91,")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tgs) != 2 || !tgs[3100] || !tgs[91] {
+		t.Errorf("Unexpected talkgroups: %v", tgs)
+	}
+	if _, err := monitor.ParseTalkgroups("abc"); err == nil {
+		t.Error("Expected an error for a non-numeric talkgroup")
+	}
+}
+
+func TestWebsocketURL(t *testing.T) {
+	t.Parallel()
+	cases := map[string]string{
+		"http://localhost:3005":     "ws://localhost:3005/ws/calls",
+		"https://hub.example.com/":  "wss://hub.example.com/ws/calls",
+		"wss://hub.example.com/dmr": "wss://hub.example.com/dmr/ws/calls",
+	}
+	for in, want := range cases {
+		got, err := monitor.WebsocketURL(in)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", in, err)
+		}
+		if got != want {
+			t.Errorf("WebsocketURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if _, err := monitor.WebsocketURL("ftp://example.com"); err == nil {
+		t.Error("Expected an error for an unsupported scheme")
+	}
+}
+
+func TestHandleStartAndEnd(t *testing.T) {
+	t.Parallel()
+	var out bytes.Buffer
+	m := monitor.New(&out, map[uint]bool{3100: true}, false, false)
+
+	for _, call := range []apimodels.WSCallResponse{testCall(3100, true), testCall(3100, true), testCall(3100, false)} {
+		if err := m.Handle(call); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d: %q", len(lines), out.String())
+	}
+	if !strings.Contains(lines[0], "START KI5VMF -> TG 3100 (USA) TS2") {
+		t.Errorf("Unexpected start line: %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "END   KI5VMF -> TG 3100 (USA) TS2 2.0s") {
+		t.Errorf("Unexpected end line: %q", lines[1])
+	}
+}
+
+func TestHandleFiltersTalkgroups(t *testing.T) {
+	t.Parallel()
+	var out bytes.Buffer
+	m := monitor.New(&out, map[uint]bool{3100: true}, false, false)
+	if err := m.Handle(testCall(91, true)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected no output for an unfollowed talkgroup, got %q", out.String())
+	}
+}
+
+func TestHandleJSON(t *testing.T) {
+	t.Parallel()
+	var out bytes.Buffer
+	m := monitor.New(&out, nil, true, false)
+	if err := m.Handle(testCall(91, true)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var event monitor.Event
+	if err := json.Unmarshal(out.Bytes(), &event); err != nil {
+		t.Fatalf("Output is not JSON: %v", err)
+	}
+	if event.Event != monitor.EventStart || event.Call.ToTalkgroup.ID != 91 {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+}
@@ -0,0 +1,165 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package notify delivers user notifications over the channels each user has chosen
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/pubsub"
+	"github.com/USA-RedDragon/DMRHub/internal/smtp"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const webhookTimeout = 10 * time.Second
+
+var (
+	ErrInvalidWebhookURL = errors.New("webhook URL must be an absolute http or https URL")
+	ErrWebhookFailed     = errors.New("webhook notification failed")
+	ErrForbiddenAddress  = errors.New("webhook address is not publicly routable")
+)
+
+//nolint:golint,gochecknoglobals
+var webhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: webhookTimeout,
+			// Webhook URLs come from users, so don't let them reach the hub's own network
+			Control: func(_, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err //nolint:golint,wrapcheck
+				}
+				ip := net.ParseIP(host)
+				if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+					return ErrForbiddenAddress
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+}
+
+// Notification is delivered as-is to WebSocket and webhook listeners, and as its subject and message by email
+type Notification struct {
+	Event   models.NotificationEvent `json:"event"`
+	Time    time.Time                `json:"time"`
+	Subject string                   `json:"subject"`
+	Message string                   `json:"message"`
+	Data    any                      `json:"data,omitempty"`
+}
+
+// Channel is the redis pubsub channel a user's notifications websocket listens on
+func Channel(userID uint) string {
+	return fmt.Sprintf("notifications:%d", userID)
+}
+
+// ValidateWebhookURL checks that a user-supplied webhook URL is one we'd post to
+func ValidateWebhookURL(webhookURL string) error {
+	parsed, err := url.Parse(webhookURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return ErrInvalidWebhookURL
+	}
+	return nil
+}
+
+// Send delivers a notification to a user on every channel they've enabled for its event.
+// Email and webhooks are sent in the background so callers on the call path aren't held up.
+func Send(ctx context.Context, db *gorm.DB, redis *redis.Client, userID uint, notification Notification) {
+	preferences, err := models.FindNotificationPreferences(db, userID)
+	if err != nil {
+		logging.Errorf("Error finding notification preferences for user %d: %v", userID, err)
+		return
+	}
+	SendWith(ctx, redis, preferences, notification)
+}
+
+// SendWith is Send for callers that already have the user's preferences
+func SendWith(ctx context.Context, redis *redis.Client, preferences models.NotificationPreferences, notification Notification) {
+	if notification.Time.IsZero() {
+		notification.Time = time.Now()
+	}
+	channels := preferences.Channels(notification.Event)
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		logging.Errorf("Error marshalling notification: %v", err)
+		return
+	}
+
+	if channels.WebSocket {
+		err = pubsub.Publish(ctx, redis, Channel(preferences.UserID), payload)
+		if err != nil {
+			logging.Errorf("Error publishing notification to user %d: %v", preferences.UserID, err)
+		}
+	}
+	if channels.Email && preferences.Email != "" && config.GetConfig().EnableEmail {
+		go func() {
+			err := smtp.Send(preferences.Email, notification.Subject, notification.Message)
+			if err != nil {
+				logging.Errorf("Error emailing notification to user %d: %v", preferences.UserID, err)
+			}
+		}()
+	}
+	if channels.Webhook && preferences.WebhookURL != "" {
+		go func() {
+			err := postWebhook(context.WithoutCancel(ctx), preferences.WebhookURL, payload)
+			if err != nil {
+				logging.Errorf("Error sending webhook notification to user %d: %v", preferences.UserID, err)
+			}
+		}()
+	}
+}
+
+func postWebhook(ctx context.Context, webhookURL string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrWebhookFailed, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrWebhookFailed, err)
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		if err := resp.Body.Close(); err != nil {
+			logging.Errorf("Error closing response body: %v", err)
+		}
+	}()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("%w: status %d", ErrWebhookFailed, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package notify_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/notify"
+)
+
+func TestValidateWebhookURL(t *testing.T) {
+	t.Parallel()
+	valid := []string{"https://hooks.example.com/dmr", "http://example.com:8080/notify?token=abc"}
+	for _, webhookURL := range valid {
+		if err := notify.ValidateWebhookURL(webhookURL); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", webhookURL, err)
+		}
+	}
+	invalid := []string{"", "example.com/hook", "ftp://example.com/hook", "https://", "javascript:alert(1)"}
+	for _, webhookURL := range invalid {
+		if err := notify.ValidateWebhookURL(webhookURL); !errors.Is(err, notify.ErrInvalidWebhookURL) {
+			t.Errorf("Expected %q to be rejected, got %v", webhookURL, err)
+		}
+	}
+}
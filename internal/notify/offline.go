@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package notify
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// offlineNoticeWindow stops owners who just opted in from hearing about repeaters that went down long ago
+const offlineNoticeWindow = 24 * time.Hour
+
+// offlineNoticeExpiry outlives offlineNoticeWindow so each outage is only reported once
+const offlineNoticeExpiry = 2 * offlineNoticeWindow
+
+// repeaterOffline reports whether a repeater has stopped pinging recently enough to tell its owner
+func repeaterOffline(repeater models.Repeater, now time.Time) bool {
+	if repeater.LastPing.IsZero() {
+		return false
+	}
+	down := now.Sub(repeater.LastPing)
+	return down >= repeater.PingTimeout() && down < repeater.PingTimeout()+offlineNoticeWindow
+}
+
+// CheckRepeatersOffline tells owners who asked about it that their repeater has gone offline.
+// It is meant to be run every minute and returns how many notifications were sent.
+func CheckRepeatersOffline(ctx context.Context, db *gorm.DB, redis *redis.Client, now time.Time) int {
+	subscribers, err := models.ListUsersNotifiedOf(db, models.NotificationRepeaterOffline)
+	if err != nil {
+		logging.Errorf("Failed to list repeater offline subscribers: %s", err)
+		return 0
+	}
+	sent := 0
+	for _, preferences := range subscribers {
+		repeaters, err := models.GetUserRepeaters(db, preferences.UserID)
+		if err != nil {
+			logging.Errorf("Failed to list repeaters for user %d: %s", preferences.UserID, err)
+			continue
+		}
+		for _, repeater := range repeaters {
+			if !repeaterOffline(repeater, now) {
+				continue
+			}
+			// The last ping identifies the outage, so a repeater that comes back and drops again is reported again
+			key := fmt.Sprintf("notify:offline:%d:%d", repeater.ID, repeater.LastPing.Unix())
+			first, err := redis.SetNX(ctx, key, now.Unix(), offlineNoticeExpiry).Result()
+			if err != nil {
+				logging.Errorf("Failed to record offline notice for repeater %d: %s", repeater.ID, err)
+				continue
+			}
+			if !first {
+				continue
+			}
+			SendWith(ctx, redis, preferences, Notification{
+				Event:   models.NotificationRepeaterOffline,
+				Time:    now,
+				Subject: fmt.Sprintf("Repeater %d (%s) is offline", repeater.ID, repeater.Callsign),
+				Message: fmt.Sprintf("Repeater %d (%s) has not been heard from since %s.", repeater.ID, repeater.Callsign, repeater.LastPing.UTC().Format(time.RFC3339)),
+				Data:    map[string]any{"repeater_id": repeater.ID, "last_ping": repeater.LastPing},
+			})
+			sent++
+		}
+	}
+	return sent
+}
@@ -0,0 +1,330 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package plugins feeds a copy of routed packet metadata and hub events to
+// external processes, so the hub can be extended without being forked.
+//
+// Each plugin is started as a subprocess and receives one JSON message per
+// line on its stdin. A plugin may narrow what it receives by writing a
+// subscription as a line of JSON on its stdout at any time, for example
+//
+//	{"types": ["packet"], "talkgroups": [91, 3100]}
+//
+// Plugins that can't keep up have messages dropped rather than slowing the hub.
+package plugins
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/events"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	TypePacket = "packet"
+	TypeEvent  = "event"
+	TypeCall   = "call"
+
+	queueSize        = 1024
+	dropLogInterval  = time.Minute
+	talkgroupChannel = "hbrp:packets:talkgroup:*"
+	repeaterChannel  = "hbrp:packets:repeater:*"
+	callsChannel     = "calls"
+)
+
+// PacketMetadata is the routing information of a DMR packet, without its voice payload
+type PacketMetadata struct {
+	StreamID  uint `json:"stream_id"`
+	Seq       uint `json:"seq"`
+	Src       uint `json:"src"`
+	Dst       uint `json:"dst"`
+	Repeater  uint `json:"repeater"`
+	Slot      uint `json:"slot"`
+	GroupCall bool `json:"group_call"`
+	FrameType uint `json:"frame_type"`
+}
+
+// Message is a single line sent to a plugin
+type Message struct {
+	Type   string          `json:"type"`
+	Time   time.Time       `json:"time"`
+	Packet *PacketMetadata `json:"packet,omitempty"`
+	Event  json.RawMessage `json:"event,omitempty"`
+	Call   json.RawMessage `json:"call,omitempty"`
+}
+
+// Subscription narrows the messages a plugin receives. Empty fields match everything.
+type Subscription struct {
+	Types      []string `json:"types"`
+	Talkgroups []uint   `json:"talkgroups"`
+	Repeaters  []uint   `json:"repeaters"`
+}
+
+func (s *Subscription) matches(msg *Message) bool {
+	if len(s.Types) > 0 && !slices.Contains(s.Types, msg.Type) {
+		return false
+	}
+	if msg.Packet == nil {
+		return true
+	}
+	if len(s.Talkgroups) > 0 && (!msg.Packet.GroupCall || !slices.Contains(s.Talkgroups, msg.Packet.Dst)) {
+		return false
+	}
+	if len(s.Repeaters) > 0 && !slices.Contains(s.Repeaters, msg.Packet.Repeater) {
+		return false
+	}
+	return true
+}
+
+type plugin struct {
+	command      string
+	cmd          *exec.Cmd
+	queue        chan []byte
+	subscription atomic.Pointer[Subscription]
+	dropped      atomic.Uint64
+}
+
+// Manager runs the configured plugins and fans hub traffic out to them
+type Manager struct {
+	redis   *redis.Client
+	plugins []*plugin
+	cancel  context.CancelFunc
+	// forwarding tracks the redis forwarder, which must stop before the plugin queues close
+	forwarding sync.WaitGroup
+	wg         sync.WaitGroup
+}
+
+// Start launches each plugin command and begins forwarding to them.
+// Plugins that fail to start are logged and skipped.
+func Start(ctx context.Context, redis *redis.Client, commands []string) *Manager {
+	ctx, cancel := context.WithCancel(ctx)
+	m := &Manager{
+		redis:  redis,
+		cancel: cancel,
+	}
+
+	for _, command := range commands {
+		command = strings.TrimSpace(command)
+		if command == "" {
+			continue
+		}
+		p, err := m.startPlugin(ctx, command)
+		if err != nil {
+			logging.Errorf("Failed to start plugin %s: %v", command, err)
+			continue
+		}
+		m.plugins = append(m.plugins, p)
+	}
+
+	if len(m.plugins) > 0 {
+		m.forwarding.Add(1)
+		go m.forward(ctx)
+	}
+	return m
+}
+
+// Stop shuts down all plugins
+func (m *Manager) Stop() {
+	m.cancel()
+	m.forwarding.Wait()
+	for _, p := range m.plugins {
+		close(p.queue)
+	}
+	m.wg.Wait()
+}
+
+func (m *Manager) startPlugin(ctx context.Context, command string) (*plugin, error) {
+	args := strings.Fields(command)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...) //#nosec G204 -- Plugins are configured by the operator
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err //nolint:golint,wrapcheck
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err //nolint:golint,wrapcheck
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err //nolint:golint,wrapcheck
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err //nolint:golint,wrapcheck
+	}
+
+	p := &plugin{
+		command: command,
+		cmd:     cmd,
+		queue:   make(chan []byte, queueSize),
+	}
+	p.subscription.Store(&Subscription{})
+	logging.Logf("Started plugin %s", command)
+
+	m.wg.Add(3) //nolint:golint,gomnd
+	go func() {
+		defer m.wg.Done()
+		p.write(stdin)
+	}()
+	go func() {
+		defer m.wg.Done()
+		p.readSubscriptions(stdout)
+	}()
+	go func() {
+		defer m.wg.Done()
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			logging.Logf("Plugin %s: %s", command, scanner.Text())
+		}
+		if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+			logging.Errorf("Plugin %s exited: %v", command, err)
+		}
+	}()
+	return p, nil
+}
+
+func (p *plugin) write(stdin io.WriteCloser) {
+	defer func() {
+		_ = stdin.Close()
+	}()
+	for line := range p.queue {
+		if _, err := stdin.Write(line); err != nil {
+			logging.Errorf("Error writing to plugin %s: %v", p.command, err)
+			// Keep draining so the forwarder never blocks on a dead plugin
+			for range p.queue {
+			}
+			return
+		}
+	}
+}
+
+func (p *plugin) readSubscriptions(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		var sub Subscription
+		if err := json.Unmarshal(scanner.Bytes(), &sub); err != nil {
+			logging.Errorf("Plugin %s sent an invalid subscription: %v", p.command, err)
+			continue
+		}
+		p.subscription.Store(&sub)
+	}
+}
+
+// send queues a message for the plugin, dropping it if the plugin is behind
+func (p *plugin) send(msg *Message, line []byte) {
+	if !p.subscription.Load().matches(msg) {
+		return
+	}
+	select {
+	case p.queue <- line:
+	default:
+		p.dropped.Add(1)
+	}
+}
+
+func (m *Manager) forward(ctx context.Context) {
+	defer m.forwarding.Done()
+
+	pubsub := m.redis.PSubscribe(ctx, talkgroupChannel, repeaterChannel)
+	defer func() {
+		_ = pubsub.Close()
+	}()
+	err := pubsub.Subscribe(ctx, events.AdminChannel, callsChannel)
+	if err != nil {
+		logging.Errorf("Error subscribing plugins to events: %v", err)
+	}
+
+	ticker := time.NewTicker(dropLogInterval)
+	defer ticker.Stop()
+
+	channel := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, p := range m.plugins {
+				if dropped := p.dropped.Swap(0); dropped > 0 {
+					logging.Errorf("Plugin %s is too slow, dropped %d messages", p.command, dropped)
+				}
+			}
+		case redisMsg := <-channel:
+			msg, ok := toMessage(redisMsg)
+			if !ok {
+				continue
+			}
+			line, err := json.Marshal(msg)
+			if err != nil {
+				logging.Errorf("Error marshalling plugin message: %v", err)
+				continue
+			}
+			line = append(line, '\n')
+			for _, p := range m.plugins {
+				p.send(msg, line)
+			}
+		}
+	}
+}
+
+func toMessage(redisMsg *redis.Message) (*Message, bool) {
+	msg := &Message{Time: time.Now()}
+	switch redisMsg.Channel {
+	case events.AdminChannel:
+		msg.Type = TypeEvent
+		msg.Event = json.RawMessage(redisMsg.Payload)
+	case callsChannel:
+		msg.Type = TypeCall
+		msg.Call = json.RawMessage(redisMsg.Payload)
+	default:
+		var rawPacket models.RawDMRPacket
+		if _, err := rawPacket.UnmarshalMsg([]byte(redisMsg.Payload)); err != nil {
+			return nil, false
+		}
+		packet, ok := models.UnpackPacket(rawPacket.Data)
+		if !ok {
+			return nil, false
+		}
+		slot := uint(1)
+		if packet.Slot {
+			slot = 2
+		}
+		msg.Type = TypePacket
+		msg.Packet = &PacketMetadata{
+			StreamID:  packet.StreamID,
+			Seq:       packet.Seq,
+			Src:       packet.Src,
+			Dst:       packet.Dst,
+			Repeater:  packet.Repeater,
+			Slot:      slot,
+			GroupCall: packet.GroupCall,
+			FrameType: uint(packet.FrameType),
+		}
+	}
+	return msg, true
+}
@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package plugins
+
+import (
+	"testing"
+)
+
+func TestSubscriptionMatches(t *testing.T) {
+	t.Parallel()
+	packet := &Message{Type: TypePacket, Packet: &PacketMetadata{Dst: 91, Repeater: 311860, GroupCall: true}}
+	event := &Message{Type: TypeEvent}
+
+	all := &Subscription{}
+	if !all.matches(packet) || !all.matches(event) {
+		t.Error("Expected an empty subscription to match everything")
+	}
+
+	packetsOnly := &Subscription{Types: []string{TypePacket}}
+	if !packetsOnly.matches(packet) || packetsOnly.matches(event) {
+		t.Error("Expected a type subscription to match only that type")
+	}
+
+	tg := &Subscription{Talkgroups: []uint{3100}}
+	if tg.matches(packet) {
+		t.Error("Expected a talkgroup subscription to filter other talkgroups")
+	}
+	if !tg.matches(event) {
+		t.Error("Expected a talkgroup subscription to still match events")
+	}
+
+	rpt := &Subscription{Repeaters: []uint{311860}}
+	if !rpt.matches(packet) {
+		t.Error("Expected a repeater subscription to match its repeater")
+	}
+}
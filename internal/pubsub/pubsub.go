@@ -0,0 +1,305 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package pubsub keeps track of whether Redis pubsub is reachable, and buffers
+// control-plane messages published during an outage so they can be replayed once
+// Redis comes back. Voice traffic is never buffered, replaying stale audio is worse
+// than dropping it.
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	healthyCheckInterval = 5 * time.Second
+	minBackoff           = 100 * time.Millisecond
+	maxBackoff           = 30 * time.Second
+	pingTimeout          = 2 * time.Second
+)
+
+//nolint:golint,gochecknoglobals
+var (
+	degradedGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dmrhub_pubsub_degraded",
+		Help: "1 while Redis pubsub is unreachable",
+	})
+	bufferedGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dmrhub_pubsub_buffered_messages",
+		Help: "Control-plane messages waiting to be replayed",
+	})
+	droppedCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dmrhub_pubsub_dropped_messages_total",
+		Help: "Messages lost because the buffer was full or they were too old to replay",
+	})
+	replayedCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dmrhub_pubsub_replayed_messages_total",
+		Help: "Buffered messages published after Redis recovered",
+	})
+
+	defaultMonitor atomic.Pointer[Monitor]
+)
+
+type message struct {
+	channel string
+	payload []byte
+	at      time.Time
+}
+
+// Status describes the pubsub connection for readiness checks
+type Status struct {
+	Healthy       bool       `json:"healthy"`
+	DegradedSince *time.Time `json:"degraded_since,omitempty"`
+	Buffered      int        `json:"buffered"`
+	Dropped       uint64     `json:"dropped"`
+	Replayed      uint64     `json:"replayed"`
+}
+
+// Monitor watches Redis and replays buffered messages after an outage
+type Monitor struct {
+	redis    *redis.Client
+	capacity int
+	maxAge   time.Duration
+	wake     chan struct{}
+
+	mu            sync.Mutex
+	degradedSince time.Time
+	buffer        []message
+	dropped       uint64
+	replayed      uint64
+}
+
+// NewMonitor creates a monitor that keeps up to capacity messages no older than maxAge
+func NewMonitor(redis *redis.Client, capacity int, maxAge time.Duration) *Monitor {
+	return &Monitor{
+		redis:    redis,
+		capacity: capacity,
+		maxAge:   maxAge,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// SetDefault installs the monitor used by Publish and Observe
+func SetDefault(m *Monitor) {
+	defaultMonitor.Store(m)
+}
+
+// Default returns the installed monitor, or nil before one is installed
+func Default() *Monitor {
+	return defaultMonitor.Load()
+}
+
+// Publish sends a control-plane message. If Redis is unreachable the message is
+// buffered by the default monitor and replayed when the connection returns.
+func Publish(ctx context.Context, client *redis.Client, channel string, payload []byte) error {
+	m := Default()
+	if m != nil && !m.Healthy() {
+		m.enqueue(message{channel: channel, payload: payload, at: time.Now()})
+		return nil
+	}
+	err := client.Publish(ctx, channel, payload).Err()
+	if err != nil && m != nil && m.isConnectionError(err) {
+		m.markDegraded(err)
+		m.enqueue(message{channel: channel, payload: payload, at: time.Now()})
+		return nil
+	}
+	return err //nolint:golint,wrapcheck
+}
+
+// Observe reports the result of a publish that shouldn't be buffered, such as
+// voice traffic, so outages are still noticed
+func Observe(err error) {
+	m := Default()
+	if err != nil && m != nil && m.isConnectionError(err) {
+		m.markDegraded(err)
+	}
+}
+
+// Healthy reports whether Redis is currently reachable
+func (m *Monitor) Healthy() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.degradedSince.IsZero()
+}
+
+// Status returns the current connection state
+func (m *Monitor) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := Status{
+		Healthy:  m.degradedSince.IsZero(),
+		Buffered: len(m.buffer),
+		Dropped:  m.dropped,
+		Replayed: m.replayed,
+	}
+	if !status.Healthy {
+		since := m.degradedSince
+		status.DegradedSince = &since
+	}
+	return status
+}
+
+// Run checks Redis periodically, and while degraded retries with exponential backoff
+func (m *Monitor) Run(ctx context.Context) {
+	backoff := minBackoff
+	for {
+		delay := healthyCheckInterval
+		if !m.Healthy() {
+			delay = backoff
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.wake:
+		case <-time.After(delay):
+		}
+
+		err := m.ping(ctx)
+		switch {
+		case err == nil && !m.Healthy():
+			m.recover(ctx)
+			backoff = minBackoff
+		case err == nil:
+		case m.Healthy():
+			m.markDegraded(err)
+		default:
+			backoff = min(backoff*2, maxBackoff) //nolint:golint,gomnd
+		}
+	}
+}
+
+func (m *Monitor) ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	return m.redis.Ping(ctx).Err() //nolint:golint,wrapcheck
+}
+
+func (m *Monitor) isConnectionError(err error) bool {
+	// A cancelled or timed out caller says nothing about Redis
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	// redis.Nil and server-side errors mean Redis answered
+	_, isServerError := err.(redis.Error) //nolint:golint,errorlint
+	return !isServerError
+}
+
+func (m *Monitor) markDegraded(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.degradedSince.IsZero() {
+		return
+	}
+	logging.Errorf("Redis pubsub is unreachable, buffering control-plane messages: %v", err)
+	m.degradedSince = time.Now()
+	degradedGauge.Set(1)
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (m *Monitor) enqueue(msg message) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.capacity <= 0 {
+		m.dropped++
+		droppedCounter.Inc()
+		return
+	}
+	if len(m.buffer) >= m.capacity {
+		// Drop the oldest, recent messages are the most useful to replay
+		m.buffer = m.buffer[1:]
+		m.dropped++
+		droppedCounter.Inc()
+	}
+	m.buffer = append(m.buffer, msg)
+	bufferedGauge.Set(float64(len(m.buffer)))
+}
+
+// requeue puts messages that couldn't be replayed back ahead of the ones buffered since
+func (m *Monitor) requeue(msgs []message) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.buffer = append(msgs, m.buffer...)
+	if over := len(m.buffer) - m.capacity; over > 0 {
+		m.buffer = m.buffer[over:]
+		m.dropped += uint64(over)
+		droppedCounter.Add(float64(over))
+	}
+	bufferedGauge.Set(float64(len(m.buffer)))
+}
+
+// recover replays what was buffered during the outage, then marks Redis healthy again.
+// Publishes are buffered until the replay finishes so they can't overtake older messages.
+func (m *Monitor) recover(ctx context.Context) {
+	m.mu.Lock()
+	outage := time.Since(m.degradedSince)
+	m.mu.Unlock()
+
+	replayed, dropped := 0, 0
+	defer func() {
+		m.mu.Lock()
+		m.replayed += uint64(replayed)
+		m.dropped += uint64(dropped)
+		m.mu.Unlock()
+		replayedCounter.Add(float64(replayed))
+		droppedCounter.Add(float64(dropped))
+	}()
+
+	for {
+		m.mu.Lock()
+		buffered := m.buffer
+		m.buffer = nil
+		if len(buffered) == 0 {
+			m.degradedSince = time.Time{}
+			m.mu.Unlock()
+			break
+		}
+		m.mu.Unlock()
+		bufferedGauge.Set(0)
+
+		cutoff := time.Now().Add(-m.maxAge)
+		for i, msg := range buffered {
+			if msg.at.Before(cutoff) {
+				dropped++
+				continue
+			}
+			err := m.redis.Publish(ctx, msg.channel, msg.payload).Err()
+			if err != nil {
+				// Redis went away again, keep the rest for the next recovery
+				logging.Errorf("Redis pubsub failed during replay: %v", err)
+				m.requeue(buffered[i:])
+				return
+			}
+			replayed++
+		}
+	}
+	degradedGauge.Set(0)
+	logging.Logf("Redis pubsub recovered after %s, replayed %d messages and dropped %d stale ones", outage.Round(time.Second), replayed, dropped)
+}
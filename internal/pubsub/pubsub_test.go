@@ -0,0 +1,189 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+	"github.com/redis/go-redis/v9"
+)
+
+func unreachableRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{
+		Addr:        "localhost:1",
+		DialTimeout: 100 * time.Millisecond,
+		MaxRetries:  -1,
+	})
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestPublishBuffersWhileUnreachable(t *testing.T) {
+	client := unreachableRedis(t)
+	monitor := NewMonitor(client, 2, time.Minute)
+	SetDefault(monitor)
+	t.Cleanup(func() { SetDefault(nil) })
+
+	for i := 0; i < 3; i++ {
+		if err := Publish(context.Background(), client, "calls", []byte("call")); err != nil {
+			t.Fatalf("Expected the publish to be buffered, got %v", err)
+		}
+	}
+
+	status := monitor.Status()
+	if status.Healthy {
+		t.Error("Expected the monitor to be degraded")
+	}
+	if status.DegradedSince == nil {
+		t.Error("Expected a degraded since time")
+	}
+	if status.Buffered != 2 {
+		t.Errorf("Expected 2 buffered messages, got %d", status.Buffered)
+	}
+	if status.Dropped != 1 {
+		t.Errorf("Expected the oldest message to be dropped, got %d drops", status.Dropped)
+	}
+}
+
+func TestObserveMarksDegraded(t *testing.T) {
+	client := unreachableRedis(t)
+	monitor := NewMonitor(client, 10, time.Minute)
+	SetDefault(monitor)
+	t.Cleanup(func() { SetDefault(nil) })
+
+	Observe(client.Publish(context.Background(), "voice", []byte("voice")).Err())
+
+	status := monitor.Status()
+	if status.Healthy {
+		t.Error("Expected the monitor to be degraded")
+	}
+	if status.Buffered != 0 {
+		t.Errorf("Expected observed publishes not to be buffered, got %d", status.Buffered)
+	}
+}
+
+func TestServerErrorsDoNotDegrade(t *testing.T) {
+	monitor := NewMonitor(nil, 10, time.Minute)
+	if monitor.isConnectionError(redis.Nil) {
+		t.Error("Expected redis.Nil to not be a connection error")
+	}
+}
+
+func TestContextErrorsDoNotDegrade(t *testing.T) {
+	monitor := NewMonitor(nil, 10, time.Minute)
+	if monitor.isConnectionError(context.Canceled) {
+		t.Error("Expected context.Canceled to not be a connection error")
+	}
+	if monitor.isConnectionError(fmt.Errorf("publish: %w", context.DeadlineExceeded)) {
+		t.Error("Expected a wrapped context.DeadlineExceeded to not be a connection error")
+	}
+
+	_, client := fakeredis.New(t)
+	SetDefault(NewMonitor(client, 10, time.Minute))
+	t.Cleanup(func() { SetDefault(nil) })
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Publish(ctx, client, "calls", []byte("call")); err == nil {
+		t.Error("Expected the cancelled publish to fail")
+	}
+	if !Default().Healthy() {
+		t.Error("Expected a cancelled publish to leave the monitor healthy")
+	}
+}
+
+func TestReplayKeepsOrder(t *testing.T) {
+	_, client := fakeredis.New(t)
+	monitor := NewMonitor(client, 1000, time.Minute)
+	SetDefault(monitor)
+	t.Cleanup(func() { SetDefault(nil) })
+	ctx := context.Background()
+
+	sub := client.Subscribe(ctx, "calls")
+	t.Cleanup(func() { _ = sub.Close() })
+	if _, err := sub.Receive(ctx); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	const buffered, live = 200, 20
+	monitor.markDegraded(context.Canceled)
+	for i := range buffered {
+		if err := Publish(ctx, client, "calls", []byte(fmt.Sprint(i))); err != nil {
+			t.Fatalf("Expected the publish to be buffered, got %v", err)
+		}
+	}
+
+	// Publishes made while the buffer replays must come after it
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		monitor.recover(ctx)
+	}()
+	for i := range live {
+		if err := Publish(ctx, client, "calls", []byte(fmt.Sprint(buffered+i))); err != nil {
+			t.Errorf("Publish failed: %v", err)
+		}
+	}
+	wg.Wait()
+
+	for i := range buffered + live {
+		msg, err := sub.ReceiveMessage(ctx)
+		if err != nil {
+			t.Fatalf("Failed to receive message %d: %v", i, err)
+		}
+		if msg.Payload != fmt.Sprint(i) {
+			t.Fatalf("Expected message %d, got %s", i, msg.Payload)
+		}
+	}
+	if status := monitor.Status(); !status.Healthy || status.Buffered != 0 || status.Replayed < buffered {
+		t.Errorf("Unexpected status after recovery: %+v", status)
+	}
+}
+
+func TestFailedReplayKeepsMessages(t *testing.T) {
+	client := unreachableRedis(t)
+	monitor := NewMonitor(client, 10, time.Minute)
+	SetDefault(monitor)
+	t.Cleanup(func() { SetDefault(nil) })
+
+	for range 3 {
+		if err := Publish(context.Background(), client, "calls", []byte("call")); err != nil {
+			t.Fatalf("Expected the publish to be buffered, got %v", err)
+		}
+	}
+	monitor.recover(context.Background())
+	if status := monitor.Status(); status.Healthy || status.Buffered != 3 {
+		t.Errorf("Expected the monitor to stay degraded with its messages, got %+v", status)
+	}
+}
+
+func TestPublishWithoutMonitor(t *testing.T) {
+	client := unreachableRedis(t)
+	SetDefault(nil)
+	if err := Publish(context.Background(), client, "calls", []byte("call")); err == nil {
+		t.Error("Expected an error without a monitor")
+	}
+}
@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package pubsub
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultMaxPending = 500
+	defaultMessageTTL = time.Second
+
+	dropReasonOverflow = "overflow"
+	dropReasonExpired  = "expired"
+)
+
+//nolint:golint,gochecknoglobals
+var (
+	subscriberDroppedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dmrhub_pubsub_subscriber_dropped_messages_total",
+		Help: "Messages a subscription dropped because its queue was full or they waited longer than the TTL",
+	}, []string{"kind", "reason"})
+
+	maxPending       atomic.Int64
+	messageTTL       atomic.Int64
+	subscriberDrops  atomic.Uint64
+	limitsConfigured atomic.Bool
+)
+
+type queuedMessage struct {
+	msg *redis.Message
+	at  time.Time
+}
+
+// SetSubscriptionLimits sets how many messages each subscription queues and how
+// long a message may wait before it is dropped. A ttl of 0 disables expiry.
+func SetSubscriptionLimits(pending int, ttl time.Duration) {
+	maxPending.Store(int64(pending))
+	messageTTL.Store(int64(ttl))
+	limitsConfigured.Store(true)
+}
+
+func subscriptionLimits() (int, time.Duration) {
+	if !limitsConfigured.Load() {
+		return defaultMaxPending, defaultMessageTTL
+	}
+	return int(maxPending.Load()), time.Duration(messageTTL.Load())
+}
+
+// SubscriberDrops returns how many messages subscriptions have dropped since startup
+func SubscriberDrops() uint64 {
+	return subscriberDrops.Load()
+}
+
+// Receive reads ps through a bounded queue. Messages are pulled off the Redis
+// connection as fast as they arrive, so a slow consumer can't grow Redis's
+// output buffer. When the queue is full new messages are dropped, and queued
+// messages older than the TTL are dropped instead of delivered. kind labels
+// the drop metrics, such as "talkgroup" or "websocket". The returned channel
+// is closed when ctx is done or the subscription is closed.
+func Receive(ctx context.Context, ps *redis.PubSub, kind string) <-chan *redis.Message {
+	pending, ttl := subscriptionLimits()
+	return receive(ctx, ps.Channel(), kind, pending, ttl)
+}
+
+func receive(ctx context.Context, in <-chan *redis.Message, kind string, pending int, ttl time.Duration) <-chan *redis.Message {
+	queue := make(chan queuedMessage, pending)
+	out := make(chan *redis.Message)
+
+	go func() {
+		defer close(queue)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-in:
+				if !ok {
+					return
+				}
+				select {
+				case queue <- queuedMessage{msg: msg, at: time.Now()}:
+				default:
+					dropSubscriberMessage(kind, dropReasonOverflow)
+				}
+			}
+		}
+	}()
+
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case queued, ok := <-queue:
+				if !ok {
+					return
+				}
+				if !deliver(ctx, out, queued, ttl) {
+					dropSubscriberMessage(kind, dropReasonExpired)
+				}
+			}
+		}
+	}()
+
+	return out
+}
+
+// deliver hands msg to the consumer, giving up once it has waited longer than ttl
+func deliver(ctx context.Context, out chan<- *redis.Message, queued queuedMessage, ttl time.Duration) bool {
+	if ttl <= 0 {
+		select {
+		case <-ctx.Done():
+		case out <- queued.msg:
+		}
+		return true
+	}
+	remaining := ttl - time.Since(queued.at)
+	if remaining <= 0 {
+		return false
+	}
+	timer := time.NewTimer(remaining)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return true
+	case <-timer.C:
+		return false
+	case out <- queued.msg:
+		return true
+	}
+}
+
+func dropSubscriberMessage(kind string, reason string) {
+	subscriberDrops.Add(1)
+	subscriberDroppedCounter.WithLabelValues(kind, reason).Inc()
+}
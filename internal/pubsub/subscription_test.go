@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestReceiveDropsWhenFull(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	in := make(chan *redis.Message)
+	out := receive(ctx, in, "test", 2, 0)
+	before := SubscriberDrops()
+
+	for _, payload := range []string{"1", "2", "3", "4"} {
+		in <- &redis.Message{Payload: payload}
+	}
+	// The forwarder has handed off the last message once this send completes
+	in <- &redis.Message{Payload: "5"}
+
+	for _, want := range []string{"1", "2"} {
+		msg := <-out
+		if msg.Payload != want {
+			t.Errorf("Expected %s, got %s", want, msg.Payload)
+		}
+	}
+	if dropped := SubscriberDrops() - before; dropped < 2 {
+		t.Errorf("Expected at least 2 drops, got %d", dropped)
+	}
+}
+
+func TestReceiveDropsExpired(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	in := make(chan *redis.Message)
+	out := receive(ctx, in, "test", 10, 20*time.Millisecond)
+
+	in <- &redis.Message{Payload: "stale"}
+	time.Sleep(50 * time.Millisecond)
+	in <- &redis.Message{Payload: "fresh"}
+
+	select {
+	case msg := <-out:
+		if msg.Payload != "fresh" {
+			t.Errorf("Expected the stale message to be dropped, got %s", msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for a message")
+	}
+}
+
+func TestReceiveClosesOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	out := receive(ctx, make(chan *redis.Message), "test", 10, 0)
+	cancel()
+	select {
+	case _, ok := <-out:
+		if ok {
+			t.Error("Expected the channel to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the channel to close")
+	}
+}
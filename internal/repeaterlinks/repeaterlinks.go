@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package repeaterlinks keeps the direct links between repeaters in memory for the packet path.
+// Every replica reloads them from the database whenever one replica announces a change over pubsub.
+package repeaterlinks
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/USA-RedDragon/DMRHub/internal/pubsub"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Channel is the redis pubsub channel link changes are announced on
+const Channel = "repeaterlinks:changed"
+
+//nolint:golint,gochecknoglobals
+var defaultLinks atomic.Pointer[Links]
+
+type slotKey struct {
+	repeaterID uint
+	slot       bool
+}
+
+// Links holds the repeater links on this replica. Links that expire are
+// skipped when they're looked up, so expiry doesn't need a reload.
+type Links struct {
+	db    *gorm.DB
+	mu    sync.RWMutex
+	links map[slotKey][]models.RepeaterLink
+}
+
+// NewLinks creates a Links with no links loaded
+func NewLinks(db *gorm.DB) *Links {
+	return &Links{db: db, links: map[slotKey][]models.RepeaterLink{}}
+}
+
+// SetDefault installs the links used by Linked and Bridged
+func SetDefault(l *Links) {
+	defaultLinks.Store(l)
+}
+
+// Default returns the links installed with SetDefault, if any
+func Default() *Links {
+	return defaultLinks.Load()
+}
+
+// Linked returns the repeaters the default links bridge to a repeater on a time slot
+func Linked(repeaterID uint, slot bool, now time.Time) []uint {
+	if l := Default(); l != nil {
+		return l.Linked(repeaterID, slot, now)
+	}
+	return nil
+}
+
+// Bridged reports whether the default links bridge two repeaters on a time slot
+func Bridged(repeaterID uint, otherID uint, slot bool, now time.Time) bool {
+	if l := Default(); l != nil {
+		return l.Bridged(repeaterID, otherID, slot, now)
+	}
+	return false
+}
+
+// Linked returns the repeaters bridged to a repeater on a time slot
+func (l *Links) Linked(repeaterID uint, slot bool, now time.Time) []uint {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var ids []uint
+	for _, link := range l.links[slotKey{repeaterID: repeaterID, slot: slot}] {
+		if link.Active(now) {
+			ids = append(ids, link.Peer(repeaterID))
+		}
+	}
+	return ids
+}
+
+// Bridged reports whether two repeaters are bridged on a time slot
+func (l *Links) Bridged(repeaterID uint, otherID uint, slot bool, now time.Time) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, link := range l.links[slotKey{repeaterID: repeaterID, slot: slot}] {
+		if link.Peer(repeaterID) == otherID && link.Active(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload replaces the links with the unexpired ones in the database
+func (l *Links) Reload(now time.Time) error {
+	active, err := models.ListActiveRepeaterLinks(l.db, now)
+	if err != nil {
+		return fmt.Errorf("failed to list repeater links: %w", err)
+	}
+	links := make(map[slotKey][]models.RepeaterLink, 2*len(active))
+	for _, link := range active {
+		for _, repeaterID := range []uint{link.RepeaterID, link.LinkedRepeaterID} {
+			key := slotKey{repeaterID: repeaterID, slot: link.TimeSlot}
+			links[key] = append(links[key], link)
+		}
+	}
+	l.mu.Lock()
+	l.links = links
+	l.mu.Unlock()
+	return nil
+}
+
+// Listen applies the changes announced by Notify until ctx is done
+func (l *Links) Listen(ctx context.Context, redis *redis.Client) {
+	subscription := redis.Subscribe(ctx, Channel)
+	defer func() {
+		err := subscription.Close()
+		if err != nil {
+			logging.Errorf("Error closing pubsub: %v", err)
+		}
+	}()
+	for range pubsub.Receive(ctx, subscription, "repeaterlinks") {
+		if err := l.Reload(time.Now()); err != nil {
+			logging.Errorf("Error reloading repeater links: %v", err)
+		}
+	}
+}
+
+// Notify tells every replica, including this one, to reload the links
+func Notify(ctx context.Context, redis *redis.Client) error {
+	err := pubsub.Publish(ctx, redis, Channel, []byte("changed"))
+	if err != nil {
+		return fmt.Errorf("failed to announce repeater link change: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package repeaterlinks_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/repeaterlinks"
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func makeTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.AutoMigrate(&models.RepeaterLink{})
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	return db
+}
+
+func TestLinks(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	now := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	soon := now.Add(time.Hour)
+	expired := now.Add(-time.Hour)
+	db.Create(&[]models.RepeaterLink{
+		{RepeaterID: 311001, LinkedRepeaterID: 311002, TimeSlot: true},
+		{RepeaterID: 311003, LinkedRepeaterID: 311001, TimeSlot: true, ExpiresAt: &soon},
+		{RepeaterID: 311001, LinkedRepeaterID: 311004, TimeSlot: true, ExpiresAt: &expired},
+		{RepeaterID: 311001, LinkedRepeaterID: 311005, TimeSlot: false},
+	})
+
+	links := repeaterlinks.NewLinks(db)
+	if err := links.Reload(now); err != nil {
+		t.Fatalf("Failed to load links: %v", err)
+	}
+	linked := links.Linked(311001, true, now)
+	slices.Sort(linked)
+	if !slices.Equal(linked, []uint{311002, 311003}) {
+		t.Errorf("Expected the unexpired TS2 links from either end, got %v", linked)
+	}
+	if !links.Bridged(311002, 311001, true, now) {
+		t.Error("Expected the link to work from the other end")
+	}
+	if links.Bridged(311001, 311005, true, now) {
+		t.Error("Expected links to stay on their own slot")
+	}
+	// Links expire without a reload
+	if linked := links.Linked(311001, true, soon.Add(time.Minute)); !slices.Equal(linked, []uint{311002}) {
+		t.Errorf("Expected the timed link to expire, got %v", linked)
+	}
+}
+
+func TestListenReloads(t *testing.T) {
+	t.Parallel()
+	db := makeTestDB(t)
+	_, redis := fakeredis.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	links := repeaterlinks.NewLinks(db)
+	go links.Listen(ctx, redis)
+	db.Create(&models.RepeaterLink{RepeaterID: 311001, LinkedRepeaterID: 311002, TimeSlot: false})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !links.Bridged(311001, 311002, false, time.Now()) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected Notify to reload the links")
+		}
+		// The subscription may not be open yet, so announce until it's heard
+		if err := repeaterlinks.Notify(ctx, redis); err != nil {
+			t.Fatalf("Failed to announce change: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
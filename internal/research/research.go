@@ -0,0 +1,173 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package research exports routed call metadata with every identity stripped, so
+// networks can share traffic data with researchers without handing over the database.
+package research
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"gorm.io/gorm"
+)
+
+// MaxWindow is the longest time range a single export may cover
+const MaxWindow = 31 * 24 * time.Hour
+
+// StartBucket is how coarsely start times are rounded. Lastheard shows exact times
+// next to callsigns, so finer times would let records be joined back to people.
+const StartBucket = 15 * time.Minute
+
+const batchSize = 500
+
+// Kinds of destination a call can have. Private call destinations are people and
+// repeaters, so only the kind is exported for them.
+const (
+	DestinationTalkgroup = "talkgroup"
+	DestinationUser      = "user"
+	DestinationRepeater  = "repeater"
+)
+
+var (
+	ErrWindowOrder = errors.New("the window must end after it starts")
+	ErrWindowSize  = fmt.Errorf("the window must be at most %s", MaxWindow)
+)
+
+// Sample is one downsampled BER/RSSI reading, positioned by its offset into the call
+type Sample struct {
+	OffsetMS uint    `json:"offset_ms"`
+	BER      float32 `json:"ber"`
+	RSSI     float32 `json:"rssi"`
+}
+
+// Record is a finished call with nothing that identifies who made it, who received
+// it, or which repeater carried it. Start times are truncated to the StartBucket.
+type Record struct {
+	Start         time.Time `json:"start"`
+	DurationMS    int64     `json:"duration_ms"`
+	Timeslot      uint      `json:"timeslot"`
+	GroupCall     bool      `json:"group_call"`
+	Destination   string    `json:"destination"`
+	TalkgroupID   uint      `json:"talkgroup_id,omitempty"`
+	Packets       uint      `json:"packets"`
+	LostSequences uint      `json:"lost_sequences"`
+	Bits          uint      `json:"bits"`
+	Loss          float32   `json:"loss"`
+	Jitter        float32   `json:"jitter"`
+	BER           float32   `json:"ber"`
+	RSSI          float32   `json:"rssi"`
+	Truncated     bool      `json:"truncated"`
+	Samples       []Sample  `json:"samples"`
+}
+
+// FromCall anonymizes a call and its telemetry
+func FromCall(call models.Call, telemetry []models.CallTelemetry) Record {
+	record := Record{
+		Start:         call.StartTime.UTC().Truncate(StartBucket),
+		DurationMS:    call.Duration.Milliseconds(),
+		Timeslot:      1,
+		GroupCall:     call.GroupCall,
+		Packets:       call.TotalPackets,
+		LostSequences: call.LostSequences,
+		Bits:          call.TotalBits,
+		Loss:          call.Loss,
+		Jitter:        call.Jitter,
+		BER:           call.BER,
+		RSSI:          call.RSSI,
+		Truncated:     call.Truncated,
+		Samples:       make([]Sample, 0, len(telemetry)),
+	}
+	if call.TimeSlot {
+		record.Timeslot = 2
+	}
+	switch {
+	case call.IsToTalkgroup:
+		record.Destination = DestinationTalkgroup
+		if call.ToTalkgroupID != nil {
+			record.TalkgroupID = *call.ToTalkgroupID
+		}
+	case call.IsToRepeater:
+		record.Destination = DestinationRepeater
+	default:
+		record.Destination = DestinationUser
+	}
+	for _, point := range telemetry {
+		record.Samples = append(record.Samples, Sample{OffsetMS: point.OffsetMS, BER: point.BER, RSSI: point.RSSI})
+	}
+	return record
+}
+
+// CheckWindow validates the time range of an export
+func CheckWindow(from, to time.Time) error {
+	if !to.After(from) {
+		return ErrWindowOrder
+	}
+	if to.Sub(from) > MaxWindow {
+		return ErrWindowSize
+	}
+	return nil
+}
+
+// Export writes every call that started in [from, to) and has finished to w as
+// gzip-compressed newline-delimited JSON, in the order the calls were recorded.
+// Calls on private talkgroups are left out.
+func Export(db *gorm.DB, w io.Writer, from, to time.Time) error {
+	if err := CheckWindow(from, to); err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(w)
+	encoder := json.NewEncoder(zw)
+
+	var calls []models.Call
+	err := models.PublicCalls(db).Where("start_time >= ? AND start_time < ? AND active = ?", from, to, false).
+		FindInBatches(&calls, batchSize, func(_ *gorm.DB, _ int) error {
+			ids := make([]uint, 0, len(calls))
+			for _, call := range calls {
+				ids = append(ids, call.ID)
+			}
+			var points []models.CallTelemetry
+			err := db.Where("call_id IN ?", ids).Order("call_id asc, offset_ms asc").Find(&points).Error
+			if err != nil {
+				return err //nolint:golint,wrapcheck
+			}
+			telemetry := make(map[uint][]models.CallTelemetry, len(calls))
+			for _, point := range points {
+				telemetry[point.CallID] = append(telemetry[point.CallID], point)
+			}
+			for _, call := range calls {
+				if err := encoder.Encode(FromCall(call, telemetry[call.ID])); err != nil {
+					return err //nolint:golint,wrapcheck
+				}
+			}
+			return zw.Flush() //nolint:golint,wrapcheck
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to export calls: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to finish export: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package research_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/research"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestFromCallDropsIdentities(t *testing.T) {
+	t.Parallel()
+	tg := uint(3100)
+	user := uint(3113001)
+	start := time.Date(2024, time.June, 1, 12, 7, 31, 500_000_000, time.UTC)
+	call := models.Call{ID: 42, StreamID: 1234, UserID: 3113002, RepeaterID: 311860, ConversationID: 42,
+		StartTime: start, Duration: 3 * time.Second, TimeSlot: true, GroupCall: true, IsToTalkgroup: true, ToTalkgroupID: &tg,
+		TotalPackets: 50, BER: 0.01}
+	record := research.FromCall(call, []models.CallTelemetry{{CallID: 42, OffsetMS: 360, BER: 0.02, RSSI: -90}})
+	if record.Destination != research.DestinationTalkgroup || record.TalkgroupID != 3100 || record.Timeslot != 2 {
+		t.Errorf("Expected a TS2 talkgroup call to 3100, got %+v", record)
+	}
+	// Start times are only given to the bucket, so they can't be matched against lastheard
+	if !record.Start.Equal(time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)) || record.DurationMS != 3000 || len(record.Samples) != 1 {
+		t.Errorf("Unexpected timing or samples: %+v", record)
+	}
+
+	encoded, err := json.Marshal(research.FromCall(models.Call{IsToUser: true, ToUserID: &user, UserID: 3113002}, nil))
+	if err != nil {
+		t.Fatalf("Failed to marshal record: %v", err)
+	}
+	for _, id := range []string{"3113001", "3113002"} {
+		if strings.Contains(string(encoded), id) {
+			t.Errorf("Expected no identities in a private call record, got %s", encoded)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.AutoMigrate(&models.User{}, &models.Talkgroup{}, &models.Repeater{}, &models.Call{}, &models.CallTelemetry{})
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	now := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	tg := uint(3100)
+	private := uint(3101)
+	db.Create(&models.Talkgroup{ID: tg, Name: "Public"})
+	db.Create(&models.Talkgroup{ID: private, Name: "Private", Private: true})
+	calls := []models.Call{
+		{IsToTalkgroup: true, ToTalkgroupID: &tg, StartTime: now.Add(-2 * time.Hour)},
+		{IsToTalkgroup: true, ToTalkgroupID: &tg, StartTime: now.Add(-time.Hour)},
+		{IsToTalkgroup: true, ToTalkgroupID: &tg, StartTime: now.Add(-time.Minute), Active: true},
+		{IsToTalkgroup: true, ToTalkgroupID: &tg, StartTime: now.Add(-48 * time.Hour)},
+		{IsToTalkgroup: true, ToTalkgroupID: &private, StartTime: now.Add(-30 * time.Minute)},
+	}
+	if err := db.Create(&calls).Error; err != nil {
+		t.Fatalf("Failed to create calls: %v", err)
+	}
+	db.Create(&models.CallTelemetry{CallID: calls[1].ID, OffsetMS: 360, BER: 0.05})
+
+	if err := research.Export(db, &bytes.Buffer{}, now, now.Add(-time.Hour)); !errors.Is(err, research.ErrWindowOrder) {
+		t.Errorf("Expected a backwards window to be rejected, got %v", err)
+	}
+	if err := research.Export(db, &bytes.Buffer{}, now.Add(-research.MaxWindow-time.Hour), now); !errors.Is(err, research.ErrWindowSize) {
+		t.Errorf("Expected an oversized window to be rejected, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := research.Export(db, &buf, now.Add(-24*time.Hour), now); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("Expected a gzip stream: %v", err)
+	}
+	var records []research.Record
+	scanner := bufio.NewScanner(zr)
+	for scanner.Scan() {
+		var record research.Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Failed to decode line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected the two finished public calls in the window, got %+v", records)
+	}
+	if len(records[0].Samples) != 0 || len(records[1].Samples) != 1 || records[1].Samples[0].BER != 0.05 {
+		t.Errorf("Expected telemetry on the second call only, got %+v", records)
+	}
+}
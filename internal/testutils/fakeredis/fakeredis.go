@@ -0,0 +1,702 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package fakeredis is an in-memory Redis for tests that can't start a container.
+// It speaks enough RESP2 for go-redis and covers the commands DMRHub uses: strings,
+// lists, hashes, sorted sets, SCAN, MULTI/EXEC transactions and pub/sub.
+package fakeredis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Server is an in-memory Redis listening on a loopback port
+type Server struct {
+	listener net.Listener
+
+	mu      sync.Mutex
+	strings map[string]string
+	lists   map[string][]string
+	hashes  map[string]map[string]string
+	zsets   map[string]map[string]float64
+	expires map[string]time.Time
+
+	subscribers map[*conn]struct{}
+
+	// ScanCount is how many keys SCAN looks at per call when the caller doesn't pass COUNT
+	ScanCount int
+}
+
+// New starts a Server and returns a client connected to it. Both are closed when the test ends.
+func New(t testing.TB) (*Server, *redis.Client) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Starting fake Redis: %v", err)
+	}
+	s := &Server{
+		listener:    listener,
+		strings:     map[string]string{},
+		lists:       map[string][]string{},
+		hashes:      map[string]map[string]string{},
+		zsets:       map[string]map[string]float64{},
+		expires:     map[string]time.Time{},
+		subscribers: map[*conn]struct{}{},
+		ScanCount:   10, //nolint:golint,gomnd
+	}
+	go s.serve()
+	client := redis.NewClient(&redis.Options{Addr: listener.Addr().String(), Protocol: 2, DisableIndentity: true})
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = listener.Close()
+	})
+	return s, client
+}
+
+// Keys returns every key that hasn't expired, sorted
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keysLocked()
+}
+
+func (s *Server) serve() {
+	for {
+		nc, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		c := &conn{server: s, conn: nc, w: bufio.NewWriter(nc), channels: map[string]struct{}{}, patterns: map[string]struct{}{}}
+		go c.run()
+	}
+}
+
+type conn struct {
+	server   *Server
+	conn     net.Conn
+	writeMu  sync.Mutex
+	w        *bufio.Writer
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	multi    [][]string
+	inMulti  bool
+}
+
+func (c *conn) run() {
+	defer func() {
+		c.server.mu.Lock()
+		delete(c.server.subscribers, c)
+		c.server.mu.Unlock()
+		_ = c.conn.Close()
+	}()
+	r := bufio.NewReader(c.conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		c.writeMu.Lock()
+		c.dispatch(args)
+		err = c.w.Flush()
+		c.writeMu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimRight(header, "\r\n")[1:])
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2) //nolint:golint,gomnd
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+var errWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// status is a RESP simple string. Replies are otherwise nil, a bulk string, an error, an int64, or an []any.
+type status string
+
+func (c *conn) dispatch(args []string) {
+	name := strings.ToUpper(args[0])
+	if c.inMulti && name != "EXEC" && name != "DISCARD" && name != "MULTI" {
+		c.multi = append(c.multi, args)
+		writeReply(c.w, status("QUEUED"))
+		return
+	}
+	switch name {
+	case "MULTI":
+		c.inMulti = true
+		c.multi = nil
+		writeReply(c.w, status("OK"))
+	case "EXEC":
+		replies := make([]any, 0, len(c.multi))
+		c.server.mu.Lock()
+		for _, queued := range c.multi {
+			replies = append(replies, c.server.execLocked(queued))
+		}
+		c.server.mu.Unlock()
+		c.inMulti = false
+		c.multi = nil
+		writeReply(c.w, replies)
+	case "DISCARD":
+		c.inMulti = false
+		c.multi = nil
+		writeReply(c.w, status("OK"))
+	case "SUBSCRIBE", "PSUBSCRIBE":
+		c.subscribe(name == "PSUBSCRIBE", args[1:])
+	case "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		c.unsubscribe(name == "PUNSUBSCRIBE", args[1:])
+	case "PING":
+		if len(c.channels)+len(c.patterns) > 0 {
+			payload := ""
+			if len(args) > 1 {
+				payload = args[1]
+			}
+			writeReply(c.w, []any{"pong", payload})
+			return
+		}
+		writeReply(c.w, status("PONG"))
+	case "PUBLISH":
+		writeReply(c.w, c.server.publish(args[1], args[2]))
+	default:
+		c.server.mu.Lock()
+		result := c.server.execLocked(args)
+		c.server.mu.Unlock()
+		writeReply(c.w, result)
+	}
+}
+
+func (c *conn) subscribe(pattern bool, names []string) {
+	c.server.mu.Lock()
+	c.server.subscribers[c] = struct{}{}
+	c.server.mu.Unlock()
+	kind := "subscribe"
+	set := c.channels
+	if pattern {
+		kind = "psubscribe"
+		set = c.patterns
+	}
+	for _, name := range names {
+		set[name] = struct{}{}
+		writeReply(c.w, []any{kind, name, int64(len(c.channels) + len(c.patterns))})
+	}
+}
+
+func (c *conn) unsubscribe(pattern bool, names []string) {
+	kind := "unsubscribe"
+	set := c.channels
+	if pattern {
+		kind = "punsubscribe"
+		set = c.patterns
+	}
+	if len(names) == 0 {
+		for name := range set {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		writeReply(c.w, []any{kind, nil, int64(len(c.channels) + len(c.patterns))})
+		return
+	}
+	for _, name := range names {
+		delete(set, name)
+		writeReply(c.w, []any{kind, name, int64(len(c.channels) + len(c.patterns))})
+	}
+}
+
+func (s *Server) publish(channel, message string) int64 {
+	s.mu.Lock()
+	subscribers := make([]*conn, 0, len(s.subscribers))
+	for c := range s.subscribers {
+		subscribers = append(subscribers, c)
+	}
+	s.mu.Unlock()
+
+	var delivered int64
+	for _, c := range subscribers {
+		c.writeMu.Lock()
+		if _, ok := c.channels[channel]; ok {
+			writeReply(c.w, []any{"message", channel, message})
+			delivered++
+		}
+		for pattern := range c.patterns {
+			if match(pattern, channel) {
+				writeReply(c.w, []any{"pmessage", pattern, channel, message})
+				delivered++
+			}
+		}
+		_ = c.w.Flush()
+		c.writeMu.Unlock()
+	}
+	return delivered
+}
+
+func match(pattern, name string) bool {
+	ok, err := path.Match(pattern, name)
+	return err == nil && ok
+}
+
+func (s *Server) expireLocked(key string) {
+	if at, ok := s.expires[key]; ok && !time.Now().Before(at) {
+		s.deleteLocked(key)
+	}
+}
+
+func (s *Server) deleteLocked(key string) bool {
+	_, str := s.strings[key]
+	_, list := s.lists[key]
+	_, hash := s.hashes[key]
+	_, zset := s.zsets[key]
+	delete(s.strings, key)
+	delete(s.lists, key)
+	delete(s.hashes, key)
+	delete(s.zsets, key)
+	delete(s.expires, key)
+	return str || list || hash || zset
+}
+
+func (s *Server) existsLocked(key string) bool {
+	s.expireLocked(key)
+	_, str := s.strings[key]
+	_, list := s.lists[key]
+	_, hash := s.hashes[key]
+	_, zset := s.zsets[key]
+	return str || list || hash || zset
+}
+
+func (s *Server) keysLocked() []string {
+	seen := map[string]struct{}{}
+	for _, m := range []func() []string{
+		func() []string { return keysOf(s.strings) },
+		func() []string { return keysOf(s.lists) },
+		func() []string { return keysOf(s.hashes) },
+		func() []string { return keysOf(s.zsets) },
+	} {
+		for _, key := range m() {
+			seen[key] = struct{}{}
+		}
+	}
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		if s.existsLocked(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func keysOf[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+//nolint:golint,gocyclo,cyclop,maintidx
+func (s *Server) execLocked(args []string) any {
+	name := strings.ToUpper(args[0])
+	args = args[1:]
+	switch name {
+	case "HELLO":
+		return errors.New("ERR unknown command 'HELLO'")
+	case "CLIENT", "AUTH", "SELECT", "READONLY":
+		return status("OK")
+	case "ECHO":
+		return args[0]
+	case "GET":
+		s.expireLocked(args[0])
+		if _, ok := s.strings[args[0]]; !ok {
+			if s.existsLocked(args[0]) {
+				return errWrongType
+			}
+			return nil
+		}
+		return s.strings[args[0]]
+	case "SET":
+		return s.set(args)
+	case "SETNX":
+		if s.existsLocked(args[0]) {
+			return int64(0)
+		}
+		s.strings[args[0]] = args[1]
+		return int64(1)
+	case "SETEX":
+		seconds, _ := strconv.Atoi(args[1])
+		s.deleteLocked(args[0])
+		s.strings[args[0]] = args[2]
+		s.expires[args[0]] = time.Now().Add(time.Duration(seconds) * time.Second)
+		return status("OK")
+	case "DEL", "UNLINK":
+		var deleted int64
+		for _, key := range args {
+			s.expireLocked(key)
+			if s.deleteLocked(key) {
+				deleted++
+			}
+		}
+		return deleted
+	case "EXISTS":
+		var found int64
+		for _, key := range args {
+			if s.existsLocked(key) {
+				found++
+			}
+		}
+		return found
+	case "EXPIRE", "PEXPIRE":
+		if !s.existsLocked(args[0]) {
+			return int64(0)
+		}
+		amount, _ := strconv.Atoi(args[1])
+		unit := time.Second
+		if name == "PEXPIRE" {
+			unit = time.Millisecond
+		}
+		s.expires[args[0]] = time.Now().Add(time.Duration(amount) * unit)
+		return int64(1)
+	case "TTL", "PTTL":
+		if !s.existsLocked(args[0]) {
+			return int64(-2) //nolint:golint,gomnd
+		}
+		at, ok := s.expires[args[0]]
+		if !ok {
+			return int64(-1)
+		}
+		if name == "PTTL" {
+			return time.Until(at).Milliseconds()
+		}
+		return int64(time.Until(at).Seconds())
+	case "INCR", "INCRBY":
+		by := int64(1)
+		if name == "INCRBY" {
+			by, _ = strconv.ParseInt(args[1], 10, 64)
+		}
+		s.expireLocked(args[0])
+		current, _ := strconv.ParseInt(s.strings[args[0]], 10, 64)
+		current += by
+		s.strings[args[0]] = strconv.FormatInt(current, 10)
+		return current
+	case "KEYS":
+		var keys []any
+		for _, key := range s.keysLocked() {
+			if match(args[0], key) {
+				keys = append(keys, key)
+			}
+		}
+		return keys
+	case "SCAN":
+		return s.scan(args)
+	case "LPUSH", "RPUSH":
+		s.expireLocked(args[0])
+		list := s.lists[args[0]]
+		for _, value := range args[1:] {
+			if name == "LPUSH" {
+				list = append([]string{value}, list...)
+			} else {
+				list = append(list, value)
+			}
+		}
+		s.lists[args[0]] = list
+		return int64(len(list))
+	case "LLEN":
+		s.expireLocked(args[0])
+		return int64(len(s.lists[args[0]]))
+	case "LINDEX":
+		s.expireLocked(args[0])
+		list := s.lists[args[0]]
+		index, _ := strconv.Atoi(args[1])
+		if index < 0 {
+			index += len(list)
+		}
+		if index < 0 || index >= len(list) {
+			return nil
+		}
+		return list[index]
+	case "LRANGE":
+		s.expireLocked(args[0])
+		list := s.lists[args[0]]
+		start, stop := listRange(len(list), args[1], args[2])
+		values := []any{}
+		for _, value := range list[start:stop] {
+			values = append(values, value)
+		}
+		return values
+	case "LTRIM":
+		s.expireLocked(args[0])
+		list := s.lists[args[0]]
+		start, stop := listRange(len(list), args[1], args[2])
+		if start >= stop {
+			delete(s.lists, args[0])
+		} else {
+			s.lists[args[0]] = append([]string(nil), list[start:stop]...)
+		}
+		return status("OK")
+	case "HSET":
+		s.expireLocked(args[0])
+		hash, ok := s.hashes[args[0]]
+		if !ok {
+			hash = map[string]string{}
+			s.hashes[args[0]] = hash
+		}
+		var added int64
+		for i := 1; i+1 < len(args); i += 2 {
+			if _, ok := hash[args[i]]; !ok {
+				added++
+			}
+			hash[args[i]] = args[i+1]
+		}
+		return added
+	case "HGET":
+		s.expireLocked(args[0])
+		value, ok := s.hashes[args[0]][args[1]]
+		if !ok {
+			return nil
+		}
+		return value
+	case "HGETALL":
+		s.expireLocked(args[0])
+		hash := s.hashes[args[0]]
+		fields := keysOf(hash)
+		sort.Strings(fields)
+		values := []any{}
+		for _, field := range fields {
+			values = append(values, field, hash[field])
+		}
+		return values
+	case "HDEL":
+		s.expireLocked(args[0])
+		var deleted int64
+		for _, field := range args[1:] {
+			if _, ok := s.hashes[args[0]][field]; ok {
+				delete(s.hashes[args[0]], field)
+				deleted++
+			}
+		}
+		if len(s.hashes[args[0]]) == 0 {
+			delete(s.hashes, args[0])
+		}
+		return deleted
+	case "ZADD":
+		s.expireLocked(args[0])
+		zset, ok := s.zsets[args[0]]
+		if !ok {
+			zset = map[string]float64{}
+			s.zsets[args[0]] = zset
+		}
+		var added int64
+		for i := 1; i+1 < len(args); i += 2 {
+			score, err := strconv.ParseFloat(args[i], 64)
+			if err != nil {
+				return fmt.Errorf("ERR value is not a valid float")
+			}
+			if _, ok := zset[args[i+1]]; !ok {
+				added++
+			}
+			zset[args[i+1]] = score
+		}
+		return added
+	case "ZREM":
+		s.expireLocked(args[0])
+		var removed int64
+		for _, member := range args[1:] {
+			if _, ok := s.zsets[args[0]][member]; ok {
+				delete(s.zsets[args[0]], member)
+				removed++
+			}
+		}
+		return removed
+	case "ZCARD":
+		s.expireLocked(args[0])
+		return int64(len(s.zsets[args[0]]))
+	case "ZREMRANGEBYSCORE":
+		s.expireLocked(args[0])
+		minScore, maxScore := scoreBound(args[1]), scoreBound(args[2])
+		var removed int64
+		for member, score := range s.zsets[args[0]] {
+			if score >= minScore && score <= maxScore {
+				delete(s.zsets[args[0]], member)
+				removed++
+			}
+		}
+		return removed
+	default:
+		return fmt.Errorf("ERR unknown command '%s'", name)
+	}
+}
+
+func (s *Server) set(args []string) any {
+	key, value := args[0], args[1]
+	var expires time.Time
+	keepTTL := false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			if s.existsLocked(key) {
+				return nil
+			}
+		case "XX":
+			if !s.existsLocked(key) {
+				return nil
+			}
+		case "EX", "PX":
+			amount, _ := strconv.Atoi(args[i+1])
+			unit := time.Second
+			if strings.ToUpper(args[i]) == "PX" {
+				unit = time.Millisecond
+			}
+			expires = time.Now().Add(time.Duration(amount) * unit)
+			i++
+		case "KEEPTTL":
+			keepTTL = true
+		}
+	}
+	previous, hadTTL := s.expires[key]
+	s.deleteLocked(key)
+	s.strings[key] = value
+	switch {
+	case !expires.IsZero():
+		s.expires[key] = expires
+	case keepTTL && hadTTL:
+		s.expires[key] = previous
+	}
+	return status("OK")
+}
+
+// scan pages through the sorted keys like Redis does, matching after each page is taken,
+// so a page can come back empty before the cursor returns to 0
+func (s *Server) scan(args []string) any {
+	cursor, _ := strconv.Atoi(args[0])
+	pattern := "*"
+	count := s.ScanCount
+	for i := 1; i+1 < len(args); i += 2 {
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			if n, err := strconv.Atoi(args[i+1]); err == nil && n > 0 {
+				count = n
+			}
+		}
+	}
+	keys := s.keysLocked()
+	end := min(cursor+count, len(keys))
+	page := []any{}
+	for _, key := range keys[min(cursor, len(keys)):end] {
+		if match(pattern, key) {
+			page = append(page, key)
+		}
+	}
+	next := end
+	if next >= len(keys) {
+		next = 0
+	}
+	return []any{strconv.Itoa(next), page}
+}
+
+func listRange(length int, startArg, stopArg string) (int, int) {
+	start, _ := strconv.Atoi(startArg)
+	stop, _ := strconv.Atoi(stopArg)
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	start = max(start, 0)
+	stop = min(stop+1, length)
+	if start > stop {
+		return 0, 0
+	}
+	return start, stop
+}
+
+func scoreBound(arg string) float64 {
+	switch arg {
+	case "-inf":
+		return -1e308
+	case "+inf", "inf":
+		return 1e308
+	}
+	score, _ := strconv.ParseFloat(strings.TrimPrefix(arg, "("), 64)
+	return score
+}
+
+func writeReply(w *bufio.Writer, reply any) {
+	switch v := reply.(type) {
+	case nil:
+		_, _ = w.WriteString("$-1\r\n")
+	case status:
+		_, _ = fmt.Fprintf(w, "+%s\r\n", v)
+	case error:
+		_, _ = fmt.Fprintf(w, "-%s\r\n", v.Error())
+	case int64:
+		_, _ = fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		_, _ = fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []any:
+		_, _ = fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package fakeredis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/testutils/fakeredis"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestStrings(t *testing.T) {
+	t.Parallel()
+	_, client := fakeredis.New(t)
+	ctx := context.Background()
+
+	if err := client.Set(ctx, "key", "value", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if value := client.Get(ctx, "key").Val(); value != "value" {
+		t.Errorf("Expected value, got %q", value)
+	}
+	if err := client.Get(ctx, "missing").Err(); err != redis.Nil {
+		t.Errorf("Expected redis.Nil for a missing key, got %v", err)
+	}
+	if err := client.Set(ctx, "short", "lived", time.Millisecond).Err(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if n := client.Exists(ctx, "short").Val(); n != 0 {
+		t.Error("Expected the key to expire")
+	}
+}
+
+func TestTransactions(t *testing.T) {
+	t.Parallel()
+	_, client := fakeredis.New(t)
+	ctx := context.Background()
+
+	_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, "list", "a", "b", "c")
+		pipe.LTrim(ctx, "list", -2, -1)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values := client.LRange(ctx, "list", 0, -1).Val(); len(values) != 2 || values[0] != "b" {
+		t.Errorf("Expected [b c], got %v", values)
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	t.Parallel()
+	_, client := fakeredis.New(t)
+	ctx := context.Background()
+
+	sub := client.Subscribe(ctx, "channel")
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := client.Publish(ctx, "channel", "hello").Val(); n != 1 {
+		t.Errorf("Expected one subscriber, got %d", n)
+	}
+	select {
+	case msg := <-sub.Channel():
+		if msg.Payload != "hello" {
+			t.Errorf("Expected hello, got %q", msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the message to be delivered")
+	}
+}
@@ -69,6 +69,26 @@ func RegisterUser(t *testing.T, router *gin.Engine, user apimodels.UserRegistrat
 	return resp, w
 }
 
+func RegisterListener(t *testing.T, router *gin.Engine, listener apimodels.ListenerRegistration) (APIResponse, *httptest.ResponseRecorder) {
+	jsonBytes, err := json.Marshal(listener)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/api/v1/users/listener", bytes.NewBuffer(jsonBytes))
+	assert.NoError(t, err)
+	router.ServeHTTP(w, req)
+
+	var resp APIResponse
+	err = json.Unmarshal(w.Body.Bytes(), &resp)
+
+	assert.NoError(t, err)
+	return resp, w
+}
+
 func LoginUser(t *testing.T, router *gin.Engine, user apimodels.AuthLogin) (APIResponse, *httptest.ResponseRecorder, CookieJar) {
 	jsonBytes, err := json.Marshal(user)
 	assert.NoError(t, err)
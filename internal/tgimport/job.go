@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package tgimport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/events"
+	"github.com/USA-RedDragon/DMRHub/internal/jobs"
+	"github.com/USA-RedDragon/DMRHub/internal/logging"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// ImportJob applies an import in the background, fetching the list again if it came from a URL
+const ImportJob = "talkgroups.import"
+
+// ImportRequest is the payload of an ImportJob. Exactly one of URL and Data is set.
+type ImportRequest struct {
+	URL    string `json:"url,omitempty"`
+	Data   string `json:"data,omitempty"`
+	Format string `json:"format"`
+	// UserID is who asked for the import, recorded against the new talkgroup versions
+	UserID uint `json:"user_id"`
+}
+
+// RegisterJobs registers the handler that applies queued imports
+func RegisterJobs(q *jobs.Queue, db *gorm.DB, redis *redis.Client) {
+	q.Register(ImportJob, func(ctx context.Context, job models.Job) error {
+		request, err := jobs.Decode[ImportRequest](job)
+		if err != nil {
+			return err
+		}
+		return runImport(ctx, db.WithContext(ctx), redis, request)
+	})
+}
+
+func runImport(ctx context.Context, db *gorm.DB, redis *redis.Client, request ImportRequest) error {
+	data := []byte(request.Data)
+	if request.URL != "" {
+		var err error
+		// Upstream lists can be briefly unavailable, so a failed fetch is retried
+		data, err = Fetch(ctx, request.URL)
+		if errors.Is(err, ErrInvalidURL) || errors.Is(err, ErrForbiddenAddress) || errors.Is(err, ErrListTooLarge) {
+			return jobs.Permanent(err)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch talkgroup list from %s: %w", request.URL, err)
+		}
+	}
+	entries, err := Parse(data, request.Format)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	diff, err := Preview(db, entries)
+	if err != nil {
+		return err
+	}
+	err = Apply(db, diff)
+	if err != nil {
+		return err
+	}
+	for _, change := range append(diff.Create, diff.Update...) {
+		_, _, err := models.RecordTalkgroupVersion(db, change.ID, request.UserID)
+		if err != nil {
+			logging.Errorf("Error recording configuration version of talkgroup %d: %s", change.ID, err)
+		}
+	}
+	message := fmt.Sprintf("Imported %d new and %d updated talkgroups", len(diff.Create), len(diff.Update))
+	if diff.Duplicates > 0 {
+		message += fmt.Sprintf(", skipping %d duplicate entries", diff.Duplicates)
+	}
+	logging.Log(message)
+	events.Publish(ctx, redis, events.ConfigurationChanged, message, nil)
+	return nil
+}
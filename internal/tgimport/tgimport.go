@@ -0,0 +1,338 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package tgimport
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"gorm.io/gorm"
+)
+
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+
+	maxNameLength        = 20
+	maxDescriptionLength = 240
+	fetchTimeout         = 30 * time.Second
+	maxListSize          = 16 << 20
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown talkgroup list format")
+	ErrFetchFailed   = errors.New("failed to fetch talkgroup list")
+	ErrEmptyList     = errors.New("talkgroup list is empty")
+	ErrInvalidID     = errors.New("invalid talkgroup ID")
+	ErrInvalidURL    = errors.New("talkgroup list URL must be an absolute http or https URL")
+	ErrListTooLarge  = errors.New("talkgroup list is too large")
+	// ErrForbiddenAddress is returned when a list URL resolves to a loopback, private or link-local address
+	ErrForbiddenAddress = errors.New("talkgroup list address is not publicly routable")
+)
+
+//nolint:golint,gochecknoglobals
+var fetchClient = &http.Client{
+	Timeout: fetchTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: fetchTimeout,
+			// Checked on the resolved address so a public name can't point the hub at its own network
+			Control: func(_, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err //nolint:golint,wrapcheck
+				}
+				ip := net.ParseIP(host)
+				if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+					return ErrForbiddenAddress
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+}
+
+// Entry is a single talkgroup definition from an upstream list
+type Entry struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Change is a talkgroup that an import would create or update
+type Change struct {
+	Entry
+	OldName        string `json:"old_name,omitempty"`
+	OldDescription string `json:"old_description,omitempty"`
+}
+
+// Diff is the preview of what an import will do
+type Diff struct {
+	Create    []Change `json:"create"`
+	Update    []Change `json:"update"`
+	Unchanged int      `json:"unchanged"`
+	// Duplicates counts entries skipped because an earlier entry in the list had the same ID
+	Duplicates int `json:"duplicates"`
+}
+
+// ValidateURL checks that a talkgroup list URL is one we'd fetch
+func ValidateURL(listURL string) error {
+	parsed, err := url.Parse(listURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+// Fetch downloads a talkgroup list from an upstream network. Lists on private
+// networks and lists larger than 16MiB are refused.
+func Fetch(ctx context.Context, listURL string) ([]byte, error) {
+	if err := ValidateURL(listURL); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, listURL, nil)
+	if err != nil {
+		return nil, ErrFetchFailed
+	}
+	resp, err := fetchClient.Do(req)
+	if errors.Is(err, ErrForbiddenAddress) {
+		return nil, ErrForbiddenAddress
+	}
+	if err != nil {
+		return nil, ErrFetchFailed
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, ErrFetchFailed
+	}
+	// One byte over the limit tells a list that is exactly the limit from one that was cut off
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxListSize+1))
+	if err != nil {
+		return nil, ErrFetchFailed
+	}
+	if len(data) > maxListSize {
+		return nil, ErrListTooLarge
+	}
+	return data, nil
+}
+
+// Parse reads a talkgroup list. JSON lists may either be an array of
+// {"id", "name", "description"} objects, as TGIF publishes, or an object
+// mapping IDs to names, as BrandMeister publishes. CSV lists are
+// id,name[,description] rows with an optional header.
+func Parse(data []byte, format string) ([]Entry, error) {
+	var entries []Entry
+	var err error
+	switch strings.ToLower(format) {
+	case FormatJSON:
+		entries, err = parseJSON(data)
+	case FormatCSV:
+		entries, err = parseCSV(data)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrEmptyList
+	}
+	for i := range entries {
+		entries[i].Name = truncate(strings.TrimSpace(entries[i].Name), maxNameLength)
+		entries[i].Description = truncate(strings.TrimSpace(entries[i].Description), maxDescriptionLength)
+	}
+	// Stable, so when a list repeats an ID the entry that came first is the one kept
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries, nil
+}
+
+func parseJSON(data []byte) ([]Entry, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		var named map[string]string
+		if err := json.Unmarshal(data, &named); err != nil {
+			return nil, fmt.Errorf("error decoding talkgroup list: %w", err)
+		}
+		entries := make([]Entry, 0, len(named))
+		for id, name := range named {
+			tgID, err := parseID(id)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, Entry{ID: tgID, Name: name})
+		}
+		return entries, nil
+	}
+
+	var raw []struct {
+		ID          json.Number `json:"id"`
+		Name        string      `json:"name"`
+		Description string      `json:"description"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error decoding talkgroup list: %w", err)
+	}
+	entries := make([]Entry, 0, len(raw))
+	for _, r := range raw {
+		tgID, err := parseID(r.ID.String())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, Entry{ID: tgID, Name: r.Name, Description: r.Description})
+	}
+	return entries, nil
+}
+
+func parseCSV(data []byte) ([]Entry, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error decoding talkgroup list: %w", err)
+	}
+	entries := make([]Entry, 0, len(records))
+	for i, record := range records {
+		if len(record) < 2 {
+			continue
+		}
+		tgID, err := parseID(record[0])
+		if err != nil {
+			if i == 0 {
+				// Header row
+				continue
+			}
+			return nil, err
+		}
+		entry := Entry{ID: tgID, Name: record[1]}
+		if len(record) > 2 {
+			entry.Description = record[2]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func parseID(id string) (uint, error) {
+	tgID, err := strconv.ParseUint(strings.TrimSpace(id), 10, 32)
+	if err != nil || tgID == 0 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidID, id)
+	}
+	return uint(tgID), nil
+}
+
+func truncate(s string, length int) string {
+	runes := []rune(s)
+	if len(runes) > length {
+		return strings.TrimSpace(string(runes[:length]))
+	}
+	return s
+}
+
+// Preview compares a talkgroup list against the database. Entries repeating
+// an ID already seen are skipped and counted in Duplicates.
+func Preview(db *gorm.DB, entries []Entry) (Diff, error) {
+	diff := Diff{
+		Create: []Change{},
+		Update: []Change{},
+	}
+	var existing []models.Talkgroup
+	if err := db.Find(&existing).Error; err != nil {
+		return diff, fmt.Errorf("error listing talkgroups: %w", err)
+	}
+	byID := make(map[uint]models.Talkgroup, len(existing))
+	for _, tg := range existing {
+		byID[tg.ID] = tg
+	}
+
+	seen := make(map[uint]bool, len(entries))
+	for _, entry := range entries {
+		if seen[entry.ID] {
+			diff.Duplicates++
+			continue
+		}
+		seen[entry.ID] = true
+		tg, ok := byID[entry.ID]
+		if !ok {
+			diff.Create = append(diff.Create, Change{Entry: entry})
+			continue
+		}
+		description := entry.Description
+		if description == "" {
+			description = tg.Description
+		}
+		if tg.Name == entry.Name && tg.Description == description {
+			diff.Unchanged++
+			continue
+		}
+		diff.Update = append(diff.Update, Change{
+			Entry:          Entry{ID: entry.ID, Name: entry.Name, Description: description},
+			OldName:        tg.Name,
+			OldDescription: tg.Description,
+		})
+	}
+	return diff, nil
+}
+
+// Apply creates and updates the talkgroups in a diff
+func Apply(db *gorm.DB, diff Diff) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, change := range diff.Create {
+			talkgroup := models.Talkgroup{
+				ID:          change.ID,
+				Name:        change.Name,
+				Description: change.Description,
+			}
+			if err := tx.Create(&talkgroup).Error; err != nil {
+				return fmt.Errorf("error creating talkgroup %d: %w", change.ID, err)
+			}
+		}
+		for _, change := range diff.Update {
+			err := tx.Model(&models.Talkgroup{ID: change.ID}).Updates(map[string]any{
+				"name":        change.Name,
+				"description": change.Description,
+			}).Error
+			if err != nil {
+				return fmt.Errorf("error updating talkgroup %d: %w", change.ID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error importing talkgroups: %w", err)
+	}
+	return nil
+}
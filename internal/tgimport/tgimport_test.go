@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package tgimport_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/tgimport"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestParseBrandmeisterJSON(t *testing.T) {
+	t.Parallel()
+	entries, err := tgimport.Parse([]byte(`{"91": "World-wide", "3100": "USA"}`), tgimport.FormatJSON)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].ID != 91 || entries[0].Name != "World-wide" {
+		t.Errorf("Unexpected first entry: %+v", entries[0])
+	}
+}
+
+func TestParseTGIFJSON(t *testing.T) {
+	t.Parallel()
+	entries, err := tgimport.Parse([]byte(`[{"id": 31665, "name": "TGIF Network", "description": "The TGIF Network"}]`), tgimport.FormatJSON)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ID != 31665 || entries[0].Description != "The TGIF Network" {
+		t.Errorf("Unexpected entries: %+v", entries)
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	t.Parallel()
+	entries, err := tgimport.Parse([]byte("id,name,description\n3100,USA,\n91,A very long talkgroup name,World-wide\n"), tgimport.FormatCSV)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].ID != 91 || len(entries[0].Name) > 20 {
+		t.Errorf("Expected truncated name for TG 91, got %+v", entries[0])
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	t.Parallel()
+	if _, err := tgimport.Parse([]byte(`[]`), tgimport.FormatJSON); err == nil {
+		t.Error("Expected an error for an empty list")
+	}
+	if _, err := tgimport.Parse([]byte("id,name\nabc,Bad\n"), tgimport.FormatCSV); err == nil {
+		t.Error("Expected an error for an invalid ID")
+	}
+	if _, err := tgimport.Parse([]byte(`{}`), "xml"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestFetchRefusesUnsafeURLs(t *testing.T) {
+	t.Parallel()
+	for _, listURL := range []string{"file:///etc/passwd", "gopher://example.com/", "/talkgroups.json", "http://"} {
+		if _, err := tgimport.Fetch(context.Background(), listURL); !errors.Is(err, tgimport.ErrInvalidURL) {
+			t.Errorf("Expected %q to be refused as invalid, got %v", listURL, err)
+		}
+	}
+
+	requested := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requested = true
+		_, _ = w.Write([]byte(`{"91": "World-wide"}`))
+	}))
+	defer server.Close()
+	if _, err := tgimport.Fetch(context.Background(), server.URL); !errors.Is(err, tgimport.ErrForbiddenAddress) {
+		t.Errorf("Expected a loopback list to be refused, got %v", err)
+	}
+	if requested {
+		t.Error("Expected the loopback server not to be contacted")
+	}
+}
+
+func TestImportSkipsDuplicateIDs(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(""), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Talkgroup{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	entries, err := tgimport.Parse([]byte("id,name\n3100,USA\n91,World-wide\n3100,Duplicate\n"), tgimport.FormatCSV)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	diff, err := tgimport.Preview(db, entries)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(diff.Create) != 2 || diff.Duplicates != 1 {
+		t.Fatalf("Expected 2 creates and 1 duplicate, got %+v", diff)
+	}
+	if err := tgimport.Apply(db, diff); err != nil {
+		t.Fatalf("Expected duplicates not to abort the import: %v", err)
+	}
+	var talkgroup models.Talkgroup
+	if err := db.First(&talkgroup, 3100).Error; err != nil {
+		t.Fatalf("Expected TG 3100 to be created: %v", err)
+	}
+	if talkgroup.Name != "USA" {
+		t.Errorf("Expected the first entry for an ID to be kept, got %q", talkgroup.Name)
+	}
+}
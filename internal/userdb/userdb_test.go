@@ -24,7 +24,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/USA-RedDragon/DMRHub/internal/testutils/retry"
+	"github.com/USA-RedDragon/DMRHub/pkg/dmrtest/retry"
 )
 
 func TestUserdb(t *testing.T) {
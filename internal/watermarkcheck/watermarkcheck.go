@@ -0,0 +1,185 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package watermarkcheck implements the `dmrhub watermark detect` subcommand, which checks
+// captured voice for the per-repeater watermark to find where leaked audio was sent.
+package watermarkcheck
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/watermark"
+)
+
+const usage = "Usage: dmrhub watermark detect --repeaters ID,ID,... [--secret SECRET] [--json] FILE"
+
+// archive exports can have long lines when payloads are included
+const maxLineLength = 1 << 20
+
+var ErrNoRepeaters = errors.New("no repeater IDs given")
+
+// Report is the result of a detection, as printed in JSON output mode
+type Report struct {
+	Bursts int               `json:"bursts"`
+	Scores []watermark.Score `json:"scores"`
+	// Likely is the repeater the audio was most likely sent to, or 0 if none match
+	Likely uint `json:"likely"`
+}
+
+// Run parses the subcommand arguments and checks a capture against the candidate repeaters.
+// It exits 0 when a repeater likely matches and 1 when none do.
+func Run(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "detect" {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+	flags := flag.NewFlagSet("watermark detect", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	repeaterList := flags.String("repeaters", "", "Comma-separated repeater IDs the audio may have been sent to")
+	secret := flags.String("secret", os.Getenv("WATERMARK_SECRET"), "The hub's WATERMARK_SECRET")
+	jsonOutput := flags.Bool("json", false, "Print the report as JSON")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 || *secret == "" {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+	repeaters, err := ParseRepeaters(*repeaterList)
+	if err != nil {
+		fmt.Fprintf(stderr, "Invalid --repeaters: %v\n", err)
+		return 2
+	}
+
+	input := os.Stdin
+	if flags.Arg(0) != "-" {
+		input, err = os.Open(flags.Arg(0))
+		if err != nil {
+			fmt.Fprintf(stderr, "Failed to open capture: %v\n", err)
+			return 1
+		}
+		defer input.Close()
+	}
+	bursts, err := ReadArchive(input)
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to read capture: %v\n", err)
+		return 1
+	}
+
+	report := Detect(bursts, []byte(*secret), repeaters)
+	if *jsonOutput {
+		encoded, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Fprintf(stderr, "Failed to encode report: %v\n", err)
+			return 1
+		}
+		fmt.Fprintln(stdout, string(encoded))
+	} else {
+		Print(stdout, report)
+	}
+	if report.Likely == 0 {
+		return 1
+	}
+	return 0
+}
+
+// ParseRepeaters parses a comma-separated list of repeater IDs
+func ParseRepeaters(list string) ([]uint, error) {
+	repeaters := []uint{}
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a repeater ID: %w", field, err)
+		}
+		repeaters = append(repeaters, uint(id))
+	}
+	if len(repeaters) == 0 {
+		return nil, ErrNoRepeaters
+	}
+	return repeaters, nil
+}
+
+// ReadArchive reads the voice bursts from a talkgroup archive export. The talkgroup
+// needs archive_payload set, as records without a payload carry no audio.
+func ReadArchive(r io.Reader) ([][33]byte, error) {
+	bursts := [][33]byte{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineLength)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var record models.ArchiveRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		frameType := dmrconst.FrameType(record.FrameType)
+		if frameType != dmrconst.FrameVoice && frameType != dmrconst.FrameVoiceSync {
+			continue
+		}
+		var burst [33]byte
+		if len(record.Payload) != len(burst) {
+			continue
+		}
+		copy(burst[:], record.Payload)
+		bursts = append(bursts, burst)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	return bursts, nil
+}
+
+// Detect scores the candidate repeaters and names the best one if it likely matches
+func Detect(bursts [][33]byte, key []byte, repeaters []uint) Report {
+	report := Report{Bursts: len(bursts), Scores: watermark.Detect(bursts, key, repeaters)}
+	if len(report.Scores) > 0 && report.Scores[0].Likely() {
+		report.Likely = report.Scores[0].RepeaterID
+	}
+	return report
+}
+
+// Print writes a report one repeater per line, followed by the verdict
+func Print(out io.Writer, report Report) {
+	for _, score := range report.Scores {
+		fmt.Fprintf(out, "%-10d %6d/%-6d %5.1f%%\n", score.RepeaterID, score.Matches, score.Frames, score.Ratio()*100)
+	}
+	switch {
+	case report.Likely != 0:
+		fmt.Fprintf(out, "Audio was most likely sent to repeater %d\n", report.Likely)
+	case report.Bursts*watermark.FramesPerBurst < watermark.MinFrames:
+		fmt.Fprintf(out, "Not enough audio to tell, found %d voice bursts\n", report.Bursts)
+	default:
+		fmt.Fprintln(out, "No repeater matches")
+	}
+}
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package watermarkcheck_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/watermark"
+	"github.com/USA-RedDragon/DMRHub/internal/watermarkcheck"
+)
+
+func TestRunUsage(t *testing.T) {
+	t.Parallel()
+	var stdout, stderr bytes.Buffer
+	if code := watermarkcheck.Run([]string{"apply"}, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected exit code 2 for an unknown subcommand, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "watermark detect") {
+		t.Errorf("Expected usage on stderr, got %q", stderr.String())
+	}
+}
+
+func TestParseRepeaters(t *testing.T) {
+	t.Parallel()
+	repeaters, err := watermarkcheck.ParseRepeaters("311001, 311002,")
+	if err != nil || len(repeaters) != 2 || repeaters[1] != 311002 {
+		t.Errorf("Unexpected result: %v %v", repeaters, err)
+	}
+	if _, err := watermarkcheck.ParseRepeaters(""); err == nil {
+		t.Error("Expected an empty list to be rejected")
+	}
+	if _, err := watermarkcheck.ParseRepeaters("abc"); err == nil {
+		t.Error("Expected a non-numeric ID to be rejected")
+	}
+}
+
+func TestDetectArchive(t *testing.T) {
+	t.Parallel()
+	key := []byte("secret")
+	var archive bytes.Buffer
+	encoder := json.NewEncoder(&archive)
+	for i := 0; i < watermark.MinFrames; i++ {
+		var burst [33]byte
+		for j := range burst {
+			burst[j] = byte(i*31 + j*7)
+		}
+		watermark.Apply(&burst, key, 311002)
+		frameType := dmrconst.FrameVoice
+		if i%6 == 0 {
+			frameType = dmrconst.FrameVoiceSync
+		}
+		_ = encoder.Encode(models.ArchiveRecord{FrameType: uint(frameType), Payload: burst[:]})
+	}
+	// Headers and records without a payload carry no audio
+	_ = encoder.Encode(models.ArchiveRecord{FrameType: uint(dmrconst.FrameDataSync), Payload: make([]byte, 33)})
+	_ = encoder.Encode(models.ArchiveRecord{FrameType: uint(dmrconst.FrameVoice)})
+
+	bursts, err := watermarkcheck.ReadArchive(&archive)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(bursts) != watermark.MinFrames {
+		t.Fatalf("Expected %d voice bursts, got %d", watermark.MinFrames, len(bursts))
+	}
+	report := watermarkcheck.Detect(bursts, key, []uint{311001, 311002})
+	if report.Likely != 311002 {
+		t.Errorf("Expected repeater 311002, got %+v", report)
+	}
+
+	var out bytes.Buffer
+	watermarkcheck.Print(&out, report)
+	if !strings.Contains(out.String(), "most likely sent to repeater 311002") {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+}
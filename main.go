@@ -27,19 +27,35 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/USA-RedDragon/DMRHub/internal/alerting"
+	"github.com/USA-RedDragon/DMRHub/internal/archive"
 	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/configcheck"
 	"github.com/USA-RedDragon/DMRHub/internal/db"
 	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/digest"
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/calltracker"
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers"
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers/hbrp"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers/m17"
 	"github.com/USA-RedDragon/DMRHub/internal/dmr/servers/openbridge"
 	"github.com/USA-RedDragon/DMRHub/internal/featureflags"
+	"github.com/USA-RedDragon/DMRHub/internal/heatmap"
 	"github.com/USA-RedDragon/DMRHub/internal/http"
+	"github.com/USA-RedDragon/DMRHub/internal/hubevents"
+	"github.com/USA-RedDragon/DMRHub/internal/inhibit"
+	"github.com/USA-RedDragon/DMRHub/internal/jobs"
 	"github.com/USA-RedDragon/DMRHub/internal/logging"
 	"github.com/USA-RedDragon/DMRHub/internal/metrics"
+	"github.com/USA-RedDragon/DMRHub/internal/monitor"
+	"github.com/USA-RedDragon/DMRHub/internal/notify"
+	"github.com/USA-RedDragon/DMRHub/internal/plugins"
+	"github.com/USA-RedDragon/DMRHub/internal/pubsub"
 	"github.com/USA-RedDragon/DMRHub/internal/repeaterdb"
+	"github.com/USA-RedDragon/DMRHub/internal/repeaterlinks"
+	"github.com/USA-RedDragon/DMRHub/internal/tgimport"
 	"github.com/USA-RedDragon/DMRHub/internal/userdb"
+	"github.com/USA-RedDragon/DMRHub/internal/watermarkcheck"
 	"github.com/go-co-op/gocron/v2"
 	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
@@ -96,9 +112,27 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "monitor" {
+		os.Exit(monitor.Run(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(configcheck.Run(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "watermark" {
+		os.Exit(watermarkcheck.Run(os.Args[2:], os.Stdout, os.Stderr))
+	}
 	os.Exit(start())
 }
 
+// enqueueMaintenance queues a database maintenance job. Every replica schedules
+// maintenance, but only one job of each kind is queued at a time.
+func enqueueMaintenance(queue *jobs.Queue, kind string) {
+	_, err := queue.Enqueue(kind, nil, jobs.Unique())
+	if err != nil {
+		logging.Errorf("Failed to queue %s job: %s", kind, err)
+	}
+}
+
 func start() int {
 	logging.Errorf("DMRHub v%s-%s", version, commit)
 	logging.Logf("DMRHub v%s-%s", version, commit)
@@ -106,8 +140,6 @@ func start() int {
 
 	ctx := context.Background()
 
-	featureflags.Init(config.GetConfig())
-
 	scheduler, err := gocron.NewScheduler()
 	if err != nil {
 		logging.Errorf("Failed to create scheduler: %s", err)
@@ -128,6 +160,28 @@ func start() int {
 
 	database := db.MakeDB()
 
+	instance, err := os.Hostname()
+	if err != nil {
+		instance = "unknown"
+	}
+	queue := jobs.NewQueue(database, instance, jobs.DefaultWorkers)
+	jobs.SetDefault(queue)
+	jobs.RegisterMaintenance(queue, database, config.GetConfig().CallRetention)
+
+	featureFlags := featureflags.Init(config.GetConfig(), database)
+	_, err = scheduler.NewJob(
+		gocron.DurationJob(time.Minute),
+		gocron.NewTask(func() {
+			err := featureFlags.Reload(database)
+			if err != nil {
+				logging.Errorf("Failed to reload feature flags: %s", err)
+			}
+		}),
+	)
+	if err != nil {
+		logging.Errorf("Failed to schedule feature flag reloads: %s", err)
+	}
+
 	// Dummy call to get the data decoded into memory early
 	go func() {
 		err := repeaterdb.Update()
@@ -171,6 +225,92 @@ func start() int {
 		logging.Errorf("Failed to schedule user update: %s", err)
 	}
 
+	_, err = scheduler.NewJob(
+		gocron.DurationJob(time.Minute),
+		gocron.NewTask(func() {
+			// Repeaters that drop off without sending RPTCL would otherwise look connected forever
+			err := models.CloseStaleRepeaterSessions(database, time.Now())
+			if err != nil {
+				logging.Errorf("Failed to close stale repeater uptime sessions: %s", err)
+			}
+		}),
+	)
+	if err != nil {
+		logging.Errorf("Failed to schedule repeater uptime cleanup: %s", err)
+	}
+
+	_, err = scheduler.NewJob(
+		gocron.DailyJob(1, gocron.NewAtTimes(
+			gocron.NewAtTime(0, 0, 0),
+		)),
+		gocron.NewTask(enqueueMaintenance, queue, jobs.KindPurgeCalls),
+	)
+	if err != nil {
+		logging.Errorf("Failed to schedule call retention: %s", err)
+	}
+
+	_, err = scheduler.NewJob(
+		gocron.DailyJob(1, gocron.NewAtTimes(
+			gocron.NewAtTime(0, 30, 0),
+		)),
+		gocron.NewTask(enqueueMaintenance, queue, jobs.KindPurgeTombstones),
+	)
+	if err != nil {
+		logging.Errorf("Failed to schedule tombstone expiry: %s", err)
+	}
+
+	_, err = scheduler.NewJob(
+		gocron.DurationJob(time.Hour),
+		gocron.NewTask(enqueueMaintenance, queue, jobs.KindPurgeDeferredData),
+	)
+	if err != nil {
+		logging.Errorf("Failed to schedule deferred data expiry: %s", err)
+	}
+
+	_, err = scheduler.NewJob(
+		gocron.DailyJob(1, gocron.NewAtTimes(
+			gocron.NewAtTime(1, 0, 0),
+		)),
+		gocron.NewTask(enqueueMaintenance, queue, jobs.KindPurgeJobs),
+	)
+	if err != nil {
+		logging.Errorf("Failed to schedule finished job expiry: %s", err)
+	}
+
+	_, err = scheduler.NewJob(
+		gocron.DurationJob(time.Hour),
+		gocron.NewTask(func() {
+			// Yesterday is rolled up again to pick up calls that were still on the air at midnight
+			now := time.Now()
+			for _, day := range []time.Time{now.Add(-24 * time.Hour), now} {
+				err := models.RollupAirtime(database, day)
+				if err != nil {
+					logging.Errorf("Failed to roll up airtime: %s", err)
+				}
+			}
+		}),
+		gocron.WithStartAt(gocron.WithStartImmediately()),
+	)
+	if err != nil {
+		logging.Errorf("Failed to schedule airtime rollups: %s", err)
+	}
+
+	if config.GetConfig().EnableEmail {
+		// Every replica runs this, each digest is claimed before it is sent so it only goes out once
+		_, err = scheduler.NewJob(
+			gocron.DailyJob(1, gocron.NewAtTimes(
+				gocron.NewAtTime(6, 0, 0),
+			)),
+			gocron.NewTask(func() {
+				sent := digest.SendDue(database, time.Now())
+				logging.Logf("Sent %d activity digests", sent)
+			}),
+		)
+		if err != nil {
+			logging.Errorf("Failed to schedule activity digests: %s", err)
+		}
+	}
+
 	scheduler.Start()
 
 	const connsPerCPU = 10
@@ -208,6 +348,89 @@ func start() int {
 		}
 	}
 
+	pubsubMonitor := pubsub.NewMonitor(redis, config.GetConfig().PubSubBufferSize, config.GetConfig().PubSubReplayWindow)
+	pubsub.SetDefault(pubsubMonitor)
+	pubsub.SetSubscriptionLimits(config.GetConfig().PubSubMaxPending, config.GetConfig().PubSubMessageTTL)
+	go pubsubMonitor.Run(ctx)
+
+	_, err = scheduler.NewJob(
+		gocron.DurationJob(time.Minute),
+		gocron.NewTask(func() {
+			notify.CheckRepeatersOffline(ctx, database, redis, time.Now())
+		}),
+	)
+	if err != nil {
+		logging.Errorf("Failed to schedule repeater offline notifications: %s", err)
+	}
+
+	_, err = scheduler.NewJob(
+		gocron.DurationJob(time.Minute),
+		gocron.NewTask(func() {
+			err := heatmap.Refresh(ctx, database, redis, time.Now())
+			if err != nil {
+				logging.Errorf("Failed to refresh call heatmaps: %s", err)
+			}
+		}),
+	)
+	if err != nil {
+		logging.Errorf("Failed to schedule call heatmap refreshes: %s", err)
+	}
+
+	alertManager := alerting.NewManagerFromConfig()
+	if alertManager.Enabled() {
+		alertMonitor := alerting.NewMonitor(alertManager, database, redis, instance, servers.RepeaterExpireTime)
+		err = alertMonitor.CountDatabaseErrors(database)
+		if err != nil {
+			logging.Errorf("Failed to hook database errors for alerting: %s", err)
+		}
+		defer alertMonitor.Deregister(context.Background())
+		_, err = scheduler.NewJob(
+			gocron.DurationJob(time.Minute),
+			gocron.NewTask(func() {
+				alertMonitor.Check(ctx)
+			}),
+		)
+		if err != nil {
+			logging.Errorf("Failed to schedule alert checks: %s", err)
+		}
+	}
+
+	archiver := archive.NewArchiver(database, config.GetConfig().ArchiveQueueSize)
+	archive.SetDefault(archiver)
+	archiverCtx, stopArchiver := context.WithCancel(ctx)
+	defer stopArchiver()
+	archiverDone := make(chan struct{})
+	go func() {
+		defer close(archiverDone)
+		archiver.Run(archiverCtx)
+	}()
+
+	hubEventRecorder := hubevents.NewRecorder(database, instance, hubevents.DefaultCapacity)
+	hubevents.SetDefault(hubEventRecorder)
+	hubEventRecorderCtx, stopHubEventRecorder := context.WithCancel(ctx)
+	defer stopHubEventRecorder()
+	hubEventRecorderDone := make(chan struct{})
+	go func() {
+		defer close(hubEventRecorderDone)
+		hubEventRecorder.Run(hubEventRecorderCtx)
+	}()
+
+	inhibitor := inhibit.NewInhibitor(database)
+	err = inhibitor.Reload()
+	if err != nil {
+		logging.Errorf("Failed to load TX inhibits: %s", err)
+	}
+	inhibit.SetDefault(inhibitor)
+	go inhibitor.Listen(ctx, redis)
+
+	links := repeaterlinks.NewLinks(database)
+	err = links.Reload(time.Now())
+	if err != nil {
+		logging.Errorf("Failed to load repeater links: %s", err)
+	}
+	repeaterlinks.SetDefault(links)
+	go links.Listen(ctx, redis)
+
 	callTracker := calltracker.NewCallTracker(database, redis)
 
 	redisClient := servers.MakeRedisClient(redis)
@@ -219,21 +442,21 @@ func start() int {
 		return 1
 	}
 	defer hbrpServer.Stop(ctx)
+	servers.Register("hbrp", &hbrpServer)
+
+	tgimport.RegisterJobs(queue, database, redis)
+	go queue.Run(ctx)
 
 	g := new(errgroup.Group)
 	g.Go(func() error {
-		// For each repeater in the DB, start a gofunc to listen for calls
-		repeaters, err := models.ListRepeaters(database)
-		if err != nil {
-			return err //nolint:golint,wrapcheck
-		}
-		for _, repeater := range repeaters {
-			go hbrp.GetSubscriptionManager(database).ListenForCalls(redis, repeater.ID)
-		}
-		return nil
+		// Subscribe every repeater in the DB before reporting ready
+		return hbrp.GetSubscriptionManager(database).WarmUp(ctx, redis) //nolint:golint,wrapcheck
 	})
 
-	if config.GetConfig().OpenBridgePort != 0 {
+	// Servers other than HBRP, stopped once HBRP calls have drained
+	var serverStops []func(context.Context)
+
+	if len(config.GetConfig().OpenBridgeListen) > 0 {
 		// Start the OpenBridge server
 		openbridgeServer := openbridge.MakeServer(database, redisClient, callTracker)
 		err := openbridgeServer.Start(ctx)
@@ -241,7 +464,8 @@ func start() int {
 			logging.Errorf("Failed to start OpenBridge server: %v", err)
 			return 1
 		}
-		defer openbridgeServer.Stop(ctx)
+		serverStops = append(serverStops, openbridgeServer.Stop)
+		servers.Register("openbridge", &openbridgeServer)
 
 		go func() {
 			// For each peer in the DB, start a gofunc to listen for calls
@@ -252,6 +476,23 @@ func start() int {
 		}()
 	}
 
+	if len(config.GetConfig().M17Bridges) > 0 {
+		// Start the M17 bridges
+		m17Server := m17.MakeServer(database, redisClient)
+		err := m17Server.Start(ctx)
+		if err != nil {
+			logging.Errorf("Failed to start M17 bridges: %v", err)
+			return 1
+		}
+		serverStops = append(serverStops, m17Server.Stop)
+		servers.Register("m17", &m17Server)
+	}
+
+	if len(config.GetConfig().Plugins) > 0 {
+		pluginManager := plugins.Start(ctx, redis, config.GetConfig().Plugins)
+		defer pluginManager.Stop()
+	}
+
 	http := http.MakeServer(database, redis, version, commit)
 	err = http.Start()
 	if err != nil {
@@ -267,6 +508,34 @@ func start() int {
 
 	stop := func(sig os.Signal) {
 		logging.Errorf("Shutting down due to %v", sig)
+
+		// Stop taking new calls and give the ones on the air a chance to finish
+		if drainTimeout := config.GetConfig().ShutdownDrainTimeout; drainTimeout > 0 {
+			drainCtx, cancel := context.WithTimeout(ctx, drainTimeout)
+			active := servers.Drain(drainCtx)
+			cancel()
+			if active > 0 {
+				logging.Errorf("Drain timed out, cutting off %d active calls", active)
+			}
+		}
+
+		deadline, cancelDeadline := context.WithTimeout(ctx, config.GetConfig().ShutdownTimeout)
+		defer cancelDeadline()
+		wait := func(wg *sync.WaitGroup) bool {
+			c := make(chan struct{})
+			go func() {
+				defer close(c)
+				wg.Wait()
+			}()
+			select {
+			case <-c:
+				return true
+			case <-deadline.Done():
+				return false
+			}
+		}
+
+		// Flush queued work while the servers it belongs to are still up
 		wg := new(sync.WaitGroup)
 
 		wg.Add(1)
@@ -282,6 +551,33 @@ func start() int {
 			}
 		}(wg)
 
+		wg.Add(1)
+		go func(wg *sync.WaitGroup) {
+			defer wg.Done()
+			queue.Stop()
+		}(wg)
+
+		wg.Add(1)
+		go func(wg *sync.WaitGroup) {
+			defer wg.Done()
+			stopArchiver()
+			<-archiverDone
+		}(wg)
+
+		wg.Add(1)
+		go func(wg *sync.WaitGroup) {
+			defer wg.Done()
+			hbrpServer.Writes.Flush()
+		}(wg)
+
+		flushed := wait(wg)
+		if !flushed {
+			logging.Error("Timed out flushing queues")
+		}
+
+		// Then stop the servers
+		wg = new(sync.WaitGroup)
+
 		wg.Add(1)
 		go func(wg *sync.WaitGroup) {
 			defer wg.Done()
@@ -289,6 +585,14 @@ func start() int {
 			hbrpServer.Stop(ctx)
 		}(wg)
 
+		for _, serverStop := range serverStops {
+			wg.Add(1)
+			go func(wg *sync.WaitGroup) {
+				defer wg.Done()
+				serverStop(ctx)
+			}(wg)
+		}
+
 		wg.Add(1)
 		go func(wg *sync.WaitGroup) {
 			defer wg.Done()
@@ -309,25 +613,26 @@ func start() int {
 			http.Stop()
 		}(wg)
 
-		// Wait for all the servers to stop
-		const timeout = 10 * time.Second
+		stopped := flushed && wait(wg)
 
-		c := make(chan struct{})
-		go func() {
-			defer close(c)
-			wg.Wait()
-		}()
+		// The servers record hub events as they stop, so the recorder is flushed after them
+		stopHubEventRecorder()
 		select {
-		case <-c:
+		case <-hubEventRecorderDone:
+		case <-deadline.Done():
+			logging.Error("Timed out writing hub events")
+			stopped = false
+		}
+
+		if stopped {
 			redis.Close()
 			logging.Error("Shutdown safely completed")
 			logging.Close()
 			os.Exit(0)
-		case <-time.After(timeout):
-			logging.Error("Shutdown timed out")
-			logging.Close()
-			os.Exit(1)
 		}
+		logging.Error("Shutdown timed out")
+		logging.Close()
+		os.Exit(1)
 	}
 	defer stop(syscall.SIGINT)
 
@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package dmrtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+)
+
+// APIError is a non-2xx response from the DMRHub API
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("DMRHub API returned %d: %s", e.StatusCode, e.Message)
+}
+
+// APIClient calls the DMRHub HTTP API, keeping the session cookie from Login
+type APIClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewAPIClient makes a client for the DMRHub at baseURL, such as "http://localhost:3005"
+func NewAPIClient(baseURL string) *APIClient {
+	jar, _ := cookiejar.New(nil)
+	return &APIClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Jar: jar, Timeout: DefaultTimeout},
+	}
+}
+
+// Do sends body as JSON to a path under /api, such as "/v1/repeaters",
+// and decodes the response into out when it isn't nil
+func (c *APIClient) Do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+"/api"+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		var message struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &message) != nil || message.Error == "" {
+			message.Error = strings.TrimSpace(string(data))
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: message.Error}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// Login starts a session as the given user
+func (c *APIClient) Login(ctx context.Context, username, password string) error {
+	return c.Do(ctx, http.MethodPost, "/v1/auth/login", map[string]string{"username": username, "password": password}, nil)
+}
+
+// Callsign returns the callsign of the logged in user
+func (c *APIClient) Callsign(ctx context.Context) (string, error) {
+	var user struct {
+		Callsign string `json:"callsign"`
+	}
+	err := c.Do(ctx, http.MethodGet, "/v1/users/me", nil, &user)
+	return user.Callsign, err
+}
+
+// CreateRepeater adds a repeater owned by the logged in user and returns its password
+func (c *APIClient) CreateRepeater(ctx context.Context, repeaterID uint) (string, error) {
+	var created struct {
+		Password string `json:"password"`
+	}
+	err := c.Do(ctx, http.MethodPost, "/v1/repeaters", map[string]uint{"id": repeaterID}, &created)
+	return created.Password, err
+}
+
+// DeleteRepeater removes a repeater
+func (c *APIClient) DeleteRepeater(ctx context.Context, repeaterID uint) error {
+	return c.Do(ctx, http.MethodDelete, fmt.Sprintf("/v1/repeaters/%d", repeaterID), nil, nil)
+}
@@ -0,0 +1,35 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+// Package dmrtest drives a real DMRHub instance from automated tests.
+//
+// MMDVMClient logs in over the Homebrew Repeater Protocol the way MMDVMHost and
+// hotspot firmware do, then sends and receives DMRD packets. APIClient talks to the
+// HTTP API, and IntegrationStack ties the two together for a DMRHub under test,
+// such as one started with the docker-compose.yml in the repository:
+//
+//	func TestGroupCall(t *testing.T) {
+//		stack := dmrtest.NewIntegrationStack(t)
+//		talker := stack.ConnectRepeater(t, 311860100)
+//		listener := stack.ConnectRepeater(t, 311860101)
+//		...
+//	}
+//
+// The retry subpackage reruns test steps that wait on the hub to catch up.
+package dmrtest
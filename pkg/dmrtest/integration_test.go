@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package dmrtest_test
+
+import (
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/pkg/dmrtest"
+)
+
+// TestExtendedLogin logs in to a running DMRHub with an extension block, which has to
+// get past the ingress filter and the RPTC handler to be granted
+func TestExtendedLogin(t *testing.T) {
+	t.Parallel()
+	stack := dmrtest.NewIntegrationStack(t)
+	client := stack.ConnectRepeaterWithConfig(t, dmrtest.MMDVMConfig{
+		RepeaterID: 311860100,
+		Extensions: dmrconst.ExtensionTalkgroupList | dmrconst.ExtensionRejectReason,
+	})
+	if client.Extensions()&dmrconst.ExtensionTalkgroupList == 0 {
+		t.Errorf("Expected the talkgroup list extension to be granted, got %b", client.Extensions())
+	}
+}
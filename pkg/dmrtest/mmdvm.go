@@ -0,0 +1,332 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package dmrtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+)
+
+var (
+	ErrLoginRejected = errors.New("login rejected")
+	ErrDisconnected  = errors.New("disconnected by DMRHub")
+	ErrClientClosed  = errors.New("client closed")
+	ErrNoExtensions  = errors.New("no extension block in the RPTACK")
+)
+
+// DefaultTimeout bounds a login, ping, or receive when the context has no deadline
+const DefaultTimeout = 5 * time.Second
+
+// MMDVMConfig describes the repeater an MMDVMClient logs in as.
+// Unset fields get values DMRHub accepts.
+type MMDVMConfig struct {
+	RepeaterID  uint
+	Password    string
+	Callsign    string
+	RXFrequency uint // Hz
+	TXFrequency uint // Hz
+	ColorCode   uint
+	// Options are sent in an RPTO after login when set, such as "KEEPALIVE=15"
+	Options string
+	// Extensions are requested with an extension block after the RPTC when set
+	Extensions dmrconst.Extension
+}
+
+// MMDVMClient is a repeater logged in to DMRHub over the Homebrew Repeater Protocol,
+// the same way MMDVMHost does.
+type MMDVMClient struct {
+	config     MMDVMConfig
+	conn       *net.UDPConn
+	extensions dmrconst.Extension
+
+	packets chan Packet
+	pongs   chan struct{}
+
+	dead     chan struct{}
+	deadOnce sync.Once
+	err      error
+}
+
+const (
+	rptcLength    = 302
+	packetBuffer  = 1024
+	maxDatagram   = 1500
+	defaultCall   = "N0CALL"
+	defaultRXFreq = 449000000
+	defaultTXFreq = 444000000
+)
+
+// DialMMDVM logs in to the DMRHub at addr, such as "localhost:62031".
+// The repeater must already exist in DMRHub with the configured password.
+func DialMMDVM(ctx context.Context, addr string, config MMDVMConfig) (*MMDVMClient, error) {
+	if config.Callsign == "" {
+		config.Callsign = defaultCall
+	}
+	if config.RXFrequency == 0 {
+		config.RXFrequency = defaultRXFreq
+	}
+	if config.TXFrequency == 0 {
+		config.TXFrequency = defaultTXFreq
+	}
+	if config.ColorCode == 0 {
+		config.ColorCode = 1
+	}
+
+	remote, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", addr, err)
+	}
+	conn, err := net.DialUDP("udp", nil, remote)
+	if err != nil {
+		return nil, fmt.Errorf("dialing %s: %w", addr, err)
+	}
+	c := &MMDVMClient{
+		config:  config,
+		conn:    conn,
+		packets: make(chan Packet, packetBuffer),
+		pongs:   make(chan struct{}, 1),
+		dead:    make(chan struct{}),
+	}
+	if err := c.login(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// RepeaterID is the ID the client logged in as
+func (c *MMDVMClient) RepeaterID() uint {
+	return c.config.RepeaterID
+}
+
+// Extensions are the extensions DMRHub granted at login
+func (c *MMDVMClient) Extensions() dmrconst.Extension {
+	return c.extensions
+}
+
+func (c *MMDVMClient) login(ctx context.Context) error {
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.conn.SetReadDeadline(deadline)
+		defer func() { _ = c.conn.SetReadDeadline(time.Time{}) }()
+	}
+
+	ack, err := c.exchange(dmrconst.CommandRPTL, c.idBytes())
+	if err != nil {
+		return fmt.Errorf("RPTL: %w", err)
+	}
+	if len(ack) < 4 {
+		return fmt.Errorf("RPTL: short salt")
+	}
+	hash := sha256.Sum256(append(bytes.Clone(ack[:4]), []byte(c.config.Password)...))
+	if _, err := c.exchange(dmrconst.CommandRPTK, append(c.idBytes(), hash[:]...)); err != nil {
+		return fmt.Errorf("RPTK: %w", err)
+	}
+	ack, err = c.exchange(dmrconst.CommandRPTC, c.configBytes())
+	if err != nil {
+		return fmt.Errorf("RPTC: %w", err)
+	}
+	if c.config.Extensions != 0 {
+		// The granted extensions follow the repeater ID
+		block := ack[min(len(ack), 4):]
+		if len(block) != dmrconst.ExtensionBlockLength || string(block[:len(dmrconst.ExtensionMagic)]) != dmrconst.ExtensionMagic {
+			return fmt.Errorf("RPTC: %w", ErrNoExtensions)
+		}
+		c.extensions = dmrconst.Extension(binary.BigEndian.Uint32(block[len(dmrconst.ExtensionMagic)+1:]))
+	}
+	if c.config.Options != "" {
+		// DMRHub doesn't answer an RPTO
+		if err := c.write(dmrconst.CommandRPTO, append(c.idBytes(), []byte(c.config.Options)...)); err != nil {
+			return fmt.Errorf("RPTO: %w", err)
+		}
+	}
+	return nil
+}
+
+// exchange sends a login step and waits for DMRHub to acknowledge it, returning what follows the RPTACK
+func (c *MMDVMClient) exchange(command dmrconst.Command, data []byte) ([]byte, error) {
+	if err := c.write(command, data); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, maxDatagram)
+	for {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case bytes.HasPrefix(buf[:n], []byte(dmrconst.CommandRPTACK)):
+			return bytes.Clone(buf[len(dmrconst.CommandRPTACK):n]), nil
+		case bytes.HasPrefix(buf[:n], []byte(dmrconst.CommandMSTNAK)):
+			return nil, ErrLoginRejected
+		}
+		// Anything else, such as a site beacon, isn't part of the login
+	}
+}
+
+func (c *MMDVMClient) readLoop() {
+	buf := make([]byte, maxDatagram)
+	for {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			c.fail(ErrClientClosed)
+			return
+		}
+		data := buf[:n]
+		switch {
+		case bytes.HasPrefix(data, []byte(dmrconst.CommandDMRD)):
+			packet, ok := DecodePacket(data)
+			if !ok {
+				continue
+			}
+			select {
+			case c.packets <- packet:
+			case <-c.dead:
+				return
+			}
+		case bytes.HasPrefix(data, []byte(dmrconst.CommandMSTPONG)):
+			select {
+			case c.pongs <- struct{}{}:
+			default:
+			}
+		case bytes.HasPrefix(data, []byte(dmrconst.CommandMSTNAK)), bytes.HasPrefix(data, []byte(dmrconst.CommandMSTCL)):
+			c.fail(ErrDisconnected)
+		}
+	}
+}
+
+func (c *MMDVMClient) fail(err error) {
+	c.deadOnce.Do(func() {
+		c.err = err
+		close(c.dead)
+	})
+}
+
+// Ping sends an RPTPING and waits for the MSTPONG
+func (c *MMDVMClient) Ping(ctx context.Context) error {
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+	if err := c.write(dmrconst.CommandRPTPING, c.idBytes()); err != nil {
+		return err
+	}
+	select {
+	case <-c.pongs:
+		return nil
+	case <-c.dead:
+		return c.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Send sends a DMRD packet, from this repeater unless the packet says otherwise
+func (c *MMDVMClient) Send(packet Packet) error {
+	if packet.Repeater == 0 {
+		packet.Repeater = c.config.RepeaterID
+	}
+	select {
+	case <-c.dead:
+		return c.err
+	default:
+	}
+	_, err := c.conn.Write(packet.Encode())
+	return err
+}
+
+// Receive waits for the next DMRD packet DMRHub sends this repeater
+func (c *MMDVMClient) Receive(ctx context.Context) (Packet, error) {
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+	select {
+	case packet := <-c.packets:
+		return packet, nil
+	case <-c.dead:
+		return Packet{}, c.err
+	case <-ctx.Done():
+		return Packet{}, ctx.Err()
+	}
+}
+
+// Close logs the repeater out with an RPTCL
+func (c *MMDVMClient) Close() error {
+	_ = c.write(dmrconst.CommandRPTCL, c.idBytes())
+	c.fail(ErrClientClosed)
+	return c.conn.Close()
+}
+
+func (c *MMDVMClient) write(command dmrconst.Command, data []byte) error {
+	_, err := c.conn.Write(append([]byte(command), data...))
+	return err
+}
+
+func (c *MMDVMClient) idBytes() []byte {
+	return binary.BigEndian.AppendUint32(nil, uint32(c.config.RepeaterID))
+}
+
+// configBytes is the RPTC payload after the command, in the layout MMDVMHost sends
+func (c *MMDVMClient) configBytes() []byte {
+	config := make([]byte, 0, rptcLength)
+	config = append(config, c.idBytes()...)
+	config = append(config, field(c.config.Callsign, 8)...)
+	config = append(config, fmt.Sprintf("%09d%09d", c.config.RXFrequency, c.config.TXFrequency)...)
+	config = append(config, "01"...) // TX power
+	config = append(config, fmt.Sprintf("%02d", c.config.ColorCode)...)
+	config = append(config, field("0.0000", 8)...)   // latitude
+	config = append(config, field("0.0000", 9)...)   // longitude
+	config = append(config, "000"...)                // height
+	config = append(config, field("", 20)...)        // location
+	config = append(config, field("dmrtest", 19)...) // description
+	config = append(config, '3')                     // both slots
+	config = append(config, field("", 124)...)       // URL
+	config = append(config, field("USA-RedDragon/DMRHub dmrtest", 40)...)
+	config = append(config, field("dmrtest", 40)...)
+	if c.config.Extensions != 0 {
+		config = append(config, dmrconst.ExtensionMagic...)
+		config = append(config, dmrconst.ExtensionVersion)
+		config = binary.BigEndian.AppendUint32(config, uint32(c.config.Extensions))
+	}
+	return config
+}
+
+// field pads or truncates s to a fixed width RPTC field
+func field(s string, width int) string {
+	if len(s) > width {
+		return s[:width]
+	}
+	return fmt.Sprintf("%-*s", width, s)
+}
+
+func withDefaultTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, DefaultTimeout)
+}
@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package dmrtest_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/pkg/dmrtest"
+)
+
+// fakeMaster answers a Homebrew login for one repeater and echoes its DMRD packets back
+func fakeMaster(t *testing.T, password string) string {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	salt := []byte{0x01, 0x02, 0x03, 0x04}
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			data := buf[:n]
+			reply := func(command string, payload []byte) {
+				_, _ = conn.WriteToUDP(append([]byte(command), payload...), addr)
+			}
+			switch {
+			case bytes.HasPrefix(data, []byte("RPTL")):
+				reply("RPTACK", salt)
+			case bytes.HasPrefix(data, []byte("RPTK")):
+				hash := sha256.Sum256(append(bytes.Clone(salt), []byte(password)...))
+				if !bytes.Equal(data[8:], hash[:]) {
+					reply("MSTNAK", data[4:8])
+					continue
+				}
+				reply("RPTACK", data[4:8])
+			case bytes.HasPrefix(data, []byte("RPTC")) && len(data) == 302:
+				reply("RPTACK", data[4:8])
+			case bytes.HasPrefix(data, []byte("RPTC")) && len(data) == 302+dmrconst.ExtensionBlockLength:
+				// Grant whatever was asked for
+				reply("RPTACK", append(bytes.Clone(data[4:8]), data[302:]...))
+			case bytes.HasPrefix(data, []byte("RPTPING")):
+				reply("MSTPONG", data[7:11])
+			case bytes.HasPrefix(data, []byte("DMRD")):
+				_, _ = conn.WriteToUDP(bytes.Clone(data), addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestMMDVMClient(t *testing.T) {
+	t.Parallel()
+	addr := fakeMaster(t, "secret")
+	ctx := context.Background()
+
+	client, err := dmrtest.DialMMDVM(ctx, addr, dmrtest.MMDVMConfig{RepeaterID: 311860100, Password: "secret"})
+	if err != nil {
+		t.Fatalf("Expected the login to succeed, got %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Ping(ctx); err != nil {
+		t.Errorf("Expected a pong, got %v", err)
+	}
+
+	sent := dmrtest.Packet{Src: 3118601, Dst: 91, GroupCall: true, Slot: true, FrameType: dmrtest.FrameVoice, DTypeOrVSeq: 2, StreamID: 1234}
+	sent.DMRData[0] = 0xAB
+	if err := client.Send(sent); err != nil {
+		t.Fatal(err)
+	}
+	received, err := client.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Expected the packet back, got %v", err)
+	}
+	sent.Repeater = client.RepeaterID()
+	if received != sent {
+		t.Errorf("Expected %+v, got %+v", sent, received)
+	}
+}
+
+func TestMMDVMClientRejected(t *testing.T) {
+	t.Parallel()
+	addr := fakeMaster(t, "secret")
+
+	_, err := dmrtest.DialMMDVM(context.Background(), addr, dmrtest.MMDVMConfig{RepeaterID: 311860100, Password: "wrong"})
+	if !errors.Is(err, dmrtest.ErrLoginRejected) {
+		t.Errorf("Expected the login to be rejected, got %v", err)
+	}
+}
+
+func TestMMDVMClientExtensions(t *testing.T) {
+	t.Parallel()
+	addr := fakeMaster(t, "secret")
+
+	requested := dmrconst.ExtensionTalkgroupList | dmrconst.ExtensionRejectReason
+	client, err := dmrtest.DialMMDVM(context.Background(), addr, dmrtest.MMDVMConfig{RepeaterID: 311860100, Password: "secret", Extensions: requested})
+	if err != nil {
+		t.Fatalf("Expected the login to succeed, got %v", err)
+	}
+	defer client.Close()
+	if client.Extensions() != requested {
+		t.Errorf("Expected extensions %b to be granted, got %b", requested, client.Extensions())
+	}
+}
@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package dmrtest
+
+import (
+	"github.com/USA-RedDragon/DMRHub/internal/db/models"
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/dmrconst"
+)
+
+// Frame types carried in a DMRD packet
+const (
+	FrameVoice     = uint(dmrconst.FrameVoice)
+	FrameVoiceSync = uint(dmrconst.FrameVoiceSync)
+	FrameDataSync  = uint(dmrconst.FrameDataSync)
+)
+
+// Packet is a DMRD packet, the unit of voice and data on the Homebrew Repeater Protocol.
+type Packet struct {
+	Seq         uint
+	Src         uint
+	Dst         uint
+	Repeater    uint
+	Slot        bool // false for timeslot 1, true for timeslot 2
+	GroupCall   bool
+	FrameType   uint
+	DTypeOrVSeq uint
+	StreamID    uint
+	DMRData     [33]byte
+}
+
+// Encode returns the packet as it is sent over the wire
+func (p Packet) Encode() []byte {
+	packet := models.Packet{
+		Signature:   string(dmrconst.CommandDMRD),
+		Seq:         p.Seq,
+		Src:         p.Src,
+		Dst:         p.Dst,
+		Repeater:    p.Repeater,
+		Slot:        p.Slot,
+		GroupCall:   p.GroupCall,
+		FrameType:   dmrconst.FrameType(p.FrameType),
+		DTypeOrVSeq: p.DTypeOrVSeq,
+		StreamID:    p.StreamID,
+		DMRData:     p.DMRData,
+		BER:         -1,
+		RSSI:        -1,
+	}
+	return packet.Encode()
+}
+
+// DecodePacket parses a DMRD packet received from DMRHub
+func DecodePacket(data []byte) (Packet, bool) {
+	packet, ok := models.UnpackPacket(data)
+	if !ok || packet.Signature != string(dmrconst.CommandDMRD) {
+		return Packet{}, false
+	}
+	return Packet{
+		Seq:         packet.Seq,
+		Src:         packet.Src,
+		Dst:         packet.Dst,
+		Repeater:    packet.Repeater,
+		Slot:        packet.Slot,
+		GroupCall:   packet.GroupCall,
+		FrameType:   uint(packet.FrameType),
+		DTypeOrVSeq: packet.DTypeOrVSeq,
+		StreamID:    packet.StreamID,
+		DMRData:     packet.DMRData,
+	}, true
+}
@@ -17,6 +17,7 @@
 //
 // The source code is available at <https://github.com/USA-RedDragon/DMRHub>
 
+// Package retry reruns flaky test steps, such as waiting on a DMRHub instance to catch up.
 package retry
 
 import (
@@ -70,7 +71,9 @@ func lineNumber() string {
 	return filepath.Base(file) + ":" + strconv.Itoa(line) + ": "
 }
 
-func Retry(t *testing.T, maxAttempts int, sleep time.Duration, f func(r *R)) bool {
+// Retry runs f until it doesn't fail or maxAttempts is reached, sleeping between attempts.
+// Only the log of the final failed attempt or the first successful one is reported to t.
+func Retry(t testing.TB, maxAttempts int, sleep time.Duration, f func(r *R)) bool {
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
 		r := &R{Attempt: attempt, log: &bytes.Buffer{}}
 
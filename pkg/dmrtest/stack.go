@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// DMRHub - Run a DMR network server in a single binary
+// Copyright (C) 2023-2024 Jacob McSwain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+//
+// The source code is available at <https://github.com/USA-RedDragon/DMRHub>
+
+package dmrtest
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+// Environment variables NewIntegrationStack reads
+const (
+	EnvAPIURL   = "DMRTEST_API_URL"   // such as http://localhost:3005
+	EnvHBRPAddr = "DMRTEST_HBRP_ADDR" // such as localhost:62031
+	EnvUsername = "DMRTEST_USERNAME"
+	EnvPassword = "DMRTEST_PASSWORD"
+)
+
+// IntegrationStack is a running DMRHub under test and a user to drive it as
+type IntegrationStack struct {
+	HBRPAddr string
+	API      *APIClient
+	callsign string
+}
+
+// NewIntegrationStack logs in to the DMRHub named by the DMRTEST_* environment variables.
+// The test is skipped when DMRTEST_API_URL isn't set, so integration tests can live
+// alongside unit tests.
+func NewIntegrationStack(t testing.TB) *IntegrationStack {
+	t.Helper()
+	apiURL := os.Getenv(EnvAPIURL)
+	if apiURL == "" {
+		t.Skipf("%s is not set, skipping integration test", EnvAPIURL)
+	}
+	hbrpAddr := os.Getenv(EnvHBRPAddr)
+	if hbrpAddr == "" {
+		t.Fatalf("%s must be set along with %s", EnvHBRPAddr, EnvAPIURL)
+	}
+
+	api := NewAPIClient(apiURL)
+	ctx := context.Background()
+	if err := api.Login(ctx, os.Getenv(EnvUsername), os.Getenv(EnvPassword)); err != nil {
+		t.Fatalf("Logging in to DMRHub: %v", err)
+	}
+	callsign, err := api.Callsign(ctx)
+	if err != nil {
+		t.Fatalf("Getting the DMRHub user: %v", err)
+	}
+	return &IntegrationStack{HBRPAddr: hbrpAddr, API: api, callsign: callsign}
+}
+
+// ConnectRepeater creates a repeater owned by the stack's user and logs it in.
+// The repeater ID must be one DMRHub lets that user own, such as their DMR ID
+// followed by two digits for a hotspot. It is logged out and deleted when the test ends.
+func (s *IntegrationStack) ConnectRepeater(t testing.TB, repeaterID uint) *MMDVMClient {
+	t.Helper()
+	return s.ConnectRepeaterWithConfig(t, MMDVMConfig{RepeaterID: repeaterID})
+}
+
+// ConnectRepeaterWithConfig is ConnectRepeater with control over what the repeater reports.
+// The password is always the one DMRHub generates.
+func (s *IntegrationStack) ConnectRepeaterWithConfig(t testing.TB, config MMDVMConfig) *MMDVMClient {
+	t.Helper()
+	ctx := context.Background()
+	password, err := s.API.CreateRepeater(ctx, config.RepeaterID)
+	if err != nil {
+		t.Fatalf("Creating repeater %d: %v", config.RepeaterID, err)
+	}
+	t.Cleanup(func() {
+		if err := s.API.DeleteRepeater(context.Background(), config.RepeaterID); err != nil {
+			t.Errorf("Deleting repeater %d: %v", config.RepeaterID, err)
+		}
+	})
+
+	config.Password = password
+	if config.Callsign == "" {
+		config.Callsign = s.callsign
+	}
+	client, err := DialMMDVM(ctx, s.HBRPAddr, config)
+	if err != nil {
+		t.Fatalf("Logging in repeater %d: %v", config.RepeaterID, err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}